@@ -3,151 +3,475 @@
 package main
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
+	"github.com/OrgaNiUS/OrgaNiUS/server/config"
 	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
 	"github.com/OrgaNiUS/OrgaNiUS/server/db"
 	"github.com/OrgaNiUS/OrgaNiUS/server/handlers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/integrity"
+	"github.com/OrgaNiUS/OrgaNiUS/server/logging"
 	"github.com/OrgaNiUS/OrgaNiUS/server/mailer"
+	"github.com/OrgaNiUS/OrgaNiUS/server/memdb"
+	"github.com/OrgaNiUS/OrgaNiUS/server/metrics"
+	"github.com/OrgaNiUS/OrgaNiUS/server/migrations"
+	"github.com/OrgaNiUS/OrgaNiUS/server/recurrence"
+	"github.com/OrgaNiUS/OrgaNiUS/server/routes"
 	"github.com/OrgaNiUS/OrgaNiUS/server/socket"
+	"github.com/OrgaNiUS/OrgaNiUS/server/storage"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
+	"github.com/OrgaNiUS/OrgaNiUS/server/trash"
+	"github.com/OrgaNiUS/OrgaNiUS/server/txn"
 
 	"github.com/gin-gonic/contrib/static"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func handleRoutes(router *gin.Engine, userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, eventController controllers.EventController, jwtParser *auth.JWTParser, mailer *mailer.Mailer) {
+func handleRoutes(router *gin.Engine, cfg config.Config, userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, eventController controllers.EventController, commentController controllers.CommentController, attachmentController controllers.AttachmentController, store storage.Store, timeEntryController controllers.TimeEntryController, templateController controllers.TemplateController, runner *txn.Runner, jwtParser *auth.JWTParser, mailer *mailer.Mailer, hub *socket.ChatHub, activity *socket.ActivityHub, readiness *handlers.Readiness) {
+	// probes, outside of the API as they are not for the client
+	router.GET("/healthz", handlers.Healthz())
+	router.GET("/readyz", handlers.Readyz(readiness))
+
 	// serve React build at root
 	// make sure to re-build the React client after every change
 	// run `make bc`
-	router.Use(static.Serve("/", static.LocalFile("/root/git/organius/client/build", true)))
+	router.Use(static.Serve("/", static.LocalFile(cfg.Server.StaticDir, true)))
 
 	// always serve React build if path is not valid (for Gin Router)
 	// React will handle actual invalid paths
 	// which is any path not defined in Gin Router AND React Router
 	router.NoRoute(func(ctx *gin.Context) {
-		ctx.File("/root/git/organius/client/build")
+		ctx.File(cfg.Server.StaticDir)
 	})
 
-	// API Routes Group
-	// accessed via "http://{URL}/api/v1/{path}" (with correct GET/POST/PATCH/DELETE request)
-	v1 := router.Group("/api/v1")
-
-	v1.POST("/signup", handlers.UserSignup(userController, jwtParser, mailer))
-	v1.POST("/verify", handlers.UserVerify(userController, jwtParser))
-	v1.POST("/login", handlers.UserLogin(userController, jwtParser))
-	v1.GET("/refresh_jwt", handlers.UserRefreshJWT(userController, jwtParser))
-	v1.DELETE("/logout", handlers.UserLogout(userController, jwtParser))
-
-	v1.POST("/forgot_pw", handlers.UserForgotPW(userController, mailer))
-	v1.POST("/verify_forgot_pw", handlers.UserVerifyForgotPW(userController))
-	v1.POST("/change_forgot_pw", handlers.UserChangeForgotPW(userController))
-
-	v1.GET("/own_user", handlers.UserGetSelf(userController, jwtParser))
-	v1.PATCH("/user", handlers.UserPatch(userController, jwtParser))
-	v1.DELETE("/user", handlers.UserDelete(userController, jwtParser))
-
-	v1.GET("/user_exists", handlers.UserExistsGet(userController))
-	v1.GET("/user", handlers.UserGet(userController))
-
-	v1.GET("/user_get_project_invites", handlers.UserGetProjectInvites(userController, projectController, jwtParser))
-	v1.PATCH("/user_apply", handlers.UserApplyProject(projectController, jwtParser))
-	v1.PATCH("/user_accept", handlers.UserAcceptProject(userController, projectController, jwtParser))
-	v1.PATCH("/user_reject", handlers.UserRejectProject(userController, projectController, jwtParser))
-
-	v1.POST("/project_create", handlers.ProjectCreate(userController, projectController, jwtParser))
-	v1.GET("/project_get", handlers.ProjectGet(userController, projectController, taskController, eventController, jwtParser))
-	v1.GET("/project_get_all", handlers.ProjectGetAll(userController, projectController, jwtParser))
-	v1.PATCH("/project_modify", handlers.ProjectModify(projectController, jwtParser))
-	v1.PATCH("/project_invite", handlers.ProjectInviteUser(userController, jwtParser))
-	v1.GET("/project_get_applications", handlers.ProjectGetApplicants(userController, projectController, jwtParser))
-	v1.PATCH("/project_choose", handlers.ProjectChooseUsers(userController, projectController, jwtParser))
-	v1.PATCH("/project_remove_user", handlers.ProjectRemoveUsers(userController, projectController, jwtParser))
-	v1.PATCH("/project_leave", handlers.ProjectLeave(userController, projectController, taskController, jwtParser))
-	v1.DELETE("/project_delete", handlers.ProjectDelete(userController, projectController, taskController, jwtParser))
-
-	v1.POST("/task_create", handlers.TaskCreate(userController, projectController, taskController, jwtParser))
-	v1.DELETE("/task_delete", handlers.TaskDelete(userController, projectController, taskController, jwtParser))
-	v1.PATCH("/task_modify", handlers.TaskModify(userController, taskController, jwtParser))
-	v1.GET("/task_get_all", handlers.TaskGetAll(userController, projectController, taskController, jwtParser))
-
-	v1.POST("/event_create", handlers.EventCreate(userController, projectController, eventController, jwtParser))
-	v1.GET("/event_get", handlers.EventGet(eventController, jwtParser))
-	v1.GET("/event_get_all", handlers.EventGetAll(userController, projectController, eventController, jwtParser))
-	v1.PATCH("/event_modify", handlers.EventModify(eventController, jwtParser))
-	v1.DELETE("/event_delete", handlers.EventDelete(userController, projectController, eventController, jwtParser))
-	v1.POST("/event_nusmods", handlers.EventNusmods(userController, eventController, jwtParser))
-	v1.POST("/event_ics", handlers.EventIcs(userController, eventController, jwtParser))
-	v1.POST("/event_find_common", handlers.EventCommonSlots(userController, projectController, eventController, jwtParser))
-
-	// web socket handlers here
-	v1.GET("/project_search", handlers.ProjectSearch(projectController, jwtParser))
-	v1.GET("/project_invite_search", handlers.ProjectInviteSearch(userController, jwtParser))
-
-	hub := socket.NewChatHub()
-	go hub.Run()
-
-	v1.GET("/project_chat", handlers.ProjectChat(hub, userController, jwtParser))
+	routes.API(router, userController, projectController, taskController, eventController, commentController, attachmentController, store, timeEntryController, templateController, runner, jwtParser, mailer, hub, activity)
+}
+
+// Usage: integrity [-repair] [-json]
+// Reports the references between documents that do not match, repairing them if -repair is given.
+// Returns the exit code, which is 1 if issues remain.
+func runIntegrity(args []string, userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, eventController controllers.EventController) int {
+	flags := flag.NewFlagSet("integrity", flag.ExitOnError)
+	repair := flags.Bool("repair", false, "repair the issues found, instead of only reporting them")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	flags.Parse(args)
+
+	report, err := integrity.Check(context.Background(), userController, projectController, taskController, eventController, *repair)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error checking references: %v\n", err)
+		return 2
+	}
+
+	remaining := 0
+	for _, issue := range report.Issues {
+		if !issue.Repaired {
+			remaining++
+		}
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		fmt.Printf("checked %v users, %v projects, %v tasks and %v events\n", report.Users, report.Projects, report.Tasks, report.Events)
+		for _, issue := range report.Issues {
+			fmt.Printf("%v %v %v", issue.Kind, issue.Collection, issue.Id)
+			if issue.Field != "" {
+				fmt.Printf(" %v %v", issue.Field, issue.Ref)
+			}
+			switch {
+			case issue.Repaired:
+				fmt.Printf(": repaired, %v\n", issue.Repair)
+			case issue.Error != "":
+				fmt.Printf(": failed to %v: %v\n", issue.Repair, issue.Error)
+			case issue.Repair == "":
+				fmt.Printf(": repair by hand\n")
+			default:
+				fmt.Printf(": can %v\n", issue.Repair)
+			}
+		}
+		fmt.Printf("%v issues found, %v remaining\n", len(report.Issues), remaining)
+	}
+	if remaining > 0 {
+		return 1
+	}
+	return 0
+}
+
+// Usage: migrate [-to version] [up | down | status]
+// Applies the pending migrations up to the version, undoes those after it, or prints the status of each migration.
+// Without -to, up applies all of them and down undoes the latest one.
+// Returns the exit code.
+func runMigrate(args []string, database controllers.Database) int {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	to := flags.Int("to", -1, "the version to migrate up or down to")
+	flags.Parse(args)
+	action := "up"
+	if flags.NArg() > 0 {
+		action = flags.Arg(0)
+	}
+
+	ctx := context.Background()
+	var err error
+	switch action {
+	case "up":
+		version := *to
+		if version < 0 {
+			version = 0
+		}
+		var done []migrations.Migration
+		done, err = migrations.Up(ctx, database, migrations.All, version)
+		fmt.Printf("applied %v migrations\n", len(done))
+	case "down":
+		version := *to
+		if version < 0 {
+			version = 0
+			// the latest applied migration
+			applied, err := migrations.Applied(ctx, database)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error reading migrations: %v\n", err)
+				return 2
+			}
+			for v := range applied {
+				if v > version {
+					version = v
+				}
+			}
+			version--
+		}
+		var done []migrations.Migration
+		done, err = migrations.Down(ctx, database, migrations.All, version)
+		fmt.Printf("undid %v migrations\n", len(done))
+	case "status":
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate action %q, expected up, down or status\n", action)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error migrating: %v\n", err)
+		return 1
+	}
+
+	statuses, err := migrations.Statuses(ctx, database, migrations.All)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error reading migrations: %v\n", err)
+		return 2
+	}
+	for _, status := range statuses {
+		if status.Applied != nil {
+			fmt.Printf("%v %v: applied %v\n", status.Version, status.Name, status.Applied.AppliedAt.Format(time.RFC3339))
+		} else {
+			fmt.Printf("%v %v: pending\n", status.Version, status.Name)
+		}
+	}
+	return 0
+}
+
+// A database kept in memory, which is lost when the server stops.
+// Collection options are ignored.
+func memoryDatabase(database *memdb.Database) controllers.Database {
+	return func(name string, opts ...*options.CollectionOptions) controllers.MongoCollection {
+		return database.Collection(name)
+	}
+}
+
+// Logs the error and exits, as log.Fatal does.
+func fatal(message string, err error) {
+	slog.Error(message, "error", err)
+	os.Exit(1)
 }
 
 func main() {
 	// Uncomment the following line below to enable Production mode.
 	gin.SetMode(gin.ReleaseMode)
 
-	// Set up logging.
-	// Create "logs" directory if it does not exist.
-	_ = os.Mkdir("logs", os.ModePerm)
-	// FileMode from https://en.wikipedia.org/wiki/File-system_permissions#Numeric_notation
-	// 0666 is read & write
-	logFile, err := os.OpenFile("/root/git/organius/logs/server.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	// Set up loading of environment variables.
+	// Variables already set in the environment take precedence over those in ".env".
+	envErr := godotenv.Load()
+
+	// the config is loaded from a JSON file, the environment variables (sample ".env" file found in ".env.example") and flags
+	cfg, options, err := config.Load(os.Args[1:], os.LookupEnv)
+	if options.PrintConfig {
+		cfg.Print(os.Stdout)
+	}
 	if err != nil {
-		log.Fatalf("error creating/opening logger file: %v", err)
+		fmt.Fprintf(os.Stderr, "error loading config: %v\n", err)
+		if errors.Is(err, flag.ErrHelp) {
+			config.Usage(os.Stderr)
+		}
+		os.Exit(2)
+	}
+	if options.PrintConfig {
+		os.Exit(0)
 	}
-	defer logFile.Close()
-	log.SetOutput(logFile)
 
-	// Set up loading of environment variables.
-	if err := godotenv.Load(); err != nil {
+	// Set up logging.
+	// The log package writes to the same logger, for the libraries using it.
+	logger, logSink, err := logging.New(cfg.Log)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error opening log file: %v\n", err)
+		os.Exit(1)
+	}
+	defer logSink.Close()
+	slog.SetDefault(logger)
+	if envErr != nil {
 		// will fail on heroku server
-		log.Printf("error loading environment variables: %v", err)
+		slog.Info("error loading environment variables", "error", envErr)
 	}
 
-	var (
-		// environment variables found in ".env" file
-		// sample ".env" file found in ".env.example"
-		URL = os.Getenv("URL")
-
-		dbUsername = os.Getenv("db_username")
-		dbPassword = os.Getenv("db_password")
-
-		jwtSecret = os.Getenv("jwt_secret")
-
-		emailSender = os.Getenv("email")
-		sendGridKey = os.Getenv("sendgrid_api_key")
-	)
+	// spans are recorded from here on, and those left are sent once the server has shut down
+	stopTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("error setting up tracing", err)
+	}
 
-	// essentially same as gin.Default() for now
-	// potentially can customise Logger or Recovery or other middleware
+	// same as gin.Default(), except for logging
 	router := gin.New()
-	router.Use(gin.Recovery(), gin.Logger())
+	router.Use(logging.RequestIDMiddleware(), tracing.Middleware(), logging.AccessLog(), gin.Recovery())
+	if cfg.Features.Metrics {
+		router.Use(metrics.Middleware())
+	}
+	// innermost, so that the error responses are what the middleware above see
+	router.Use(handlers.Errors())
 
 	// kept here for reference, in case we need to load templates in the future
 	// router.LoadHTMLGlob("./server/templates/*.html")
 
-	client, cancel := db.Connect(dbUsername, dbPassword)
-	defer cancel()
+	var database controllers.Database
+	// updates spanning multiple documents use transactions where the deployment supports them
+	var runner *txn.Runner
+	var disconnect func()
+	// the dependencies needed to serve requests, checked by /readyz
+	readiness := handlers.NewReadiness(5 * time.Second)
+	if cfg.DB.Backend == config.BackendMemory {
+		slog.Warn("using the in-memory database, data is lost when the server stops")
+		database = memoryDatabase(memdb.New())
+		runner = txn.NewSagaRunner()
+		disconnect = func() {}
+	} else {
+		client, err := db.Connect(cfg.DB.URI, cfg.DB.Username, cfg.DB.Password)
+		if err != nil {
+			fatal("error connecting to the database", err)
+		}
+		database = controllers.MongoDatabase(client)
+		runner = txn.New(context.Background(), client)
+		disconnect = func() {
+			db.Disconnect(client, 10*time.Second)
+		}
+		readiness.Add("database", func(ctx context.Context) error {
+			return db.Ping(ctx, client)
+		})
+	}
+
+	if cfg.Features.Metrics || cfg.Tracing.Exporter != config.TracingNone {
+		database = controllers.InstrumentedDatabase(database)
+	}
+
+	var search controllers.SearchProvider = controllers.AtlasSearch{}
+	if cfg.Search.Provider == config.SearchEmbedded {
+		search = controllers.NewEmbeddedSearch(cfg.Search.Refresh.Duration)
+	}
+
+	URL := cfg.Server.URL
+	userController := controllers.NewU(database, URL, search)
+	projectController := controllers.NewP(database, URL, search)
+	taskController := controllers.NewT(database, URL)
+	eventController := controllers.NewE(database, URL)
+	commentController := controllers.NewC(database, URL)
+	attachmentController := controllers.NewA(database, URL)
+	timeEntryController := controllers.NewTE(database, URL)
+	templateController := controllers.NewTM(database, URL)
+
+	// "integrity" checks the references between documents instead of starting the server
+	if len(options.Args) > 0 && options.Args[0] == "integrity" {
+		code := runIntegrity(options.Args[1:], *userController, *projectController, *taskController, *eventController)
+		disconnect()
+		os.Exit(code)
+	}
 
-	userController := controllers.NewU(client, URL)
-	projectController := controllers.NewP(client, URL)
-	taskController := controllers.NewT(client, URL)
-	eventController := controllers.NewE(client, URL)
-	jwtParser := auth.New(jwtSecret)
-	mailer := mailer.New("OrgaNiUS", emailSender, sendGridKey)
-	handleRoutes(router, *userController, *projectController, *taskController, *eventController, jwtParser, mailer)
+	// "migrate" applies or undoes migrations instead of starting the server
+	if len(options.Args) > 0 && options.Args[0] == "migrate" {
+		code := runMigrate(options.Args[1:], database)
+		disconnect()
+		os.Exit(code)
+	}
+	if cfg.DB.MigrateOnStart {
+		if _, err := migrations.Up(context.Background(), database, migrations.All, 0); err != nil {
+			fatal("error migrating the database", err)
+		}
+	}
+	if err := migrations.CheckIndexes(context.Background(), database); err != nil {
+		fatal("error checking indexes", err)
+	}
+	if err := search.CheckIndexes(context.Background(), database, controllers.SearchFields); err != nil {
+		fatal("error checking search indexes", err)
+	}
 
-	log.Print("Server booted up!")
+	var store storage.Store
+	if cfg.Storage.S3Bucket != "" {
+		store, err = storage.NewS3(cfg.Storage.S3Endpoint, cfg.Storage.S3Bucket, cfg.Storage.S3Region, cfg.Storage.S3AccessKey, cfg.Storage.S3SecretKey)
+	} else {
+		store, err = storage.NewLocal(cfg.Storage.Dir)
+	}
+	if err != nil {
+		fatal("error setting up attachment storage", err)
+	}
+	jwtParser := auth.NewWithExpiry(cfg.JWT.Secret, cfg.JWT.Expiry.Duration)
+	var mail *mailer.Mailer
+	if cfg.Mail.Transport == config.TransportLog {
+		mail = mailer.NewLog("OrgaNiUS", cfg.Mail.Sender)
+	} else {
+		mail = mailer.New("OrgaNiUS", cfg.Mail.Sender, cfg.Mail.SendGridKey)
+	}
+	// SendGrid is not called on every check, as its API is rate limited
+	readiness.Add("mail", handlers.CachedCheck(mail.Ping, time.Minute))
 
-	router.Run(":8081")
+	var hub *socket.ChatHub
+	if cfg.Features.Chat {
+		// rooms are shared through Redis when running several instances
+		var backplane socket.Backplane = socket.NewMemoryBus().Connect()
+		if cfg.Chat.Backplane == config.BackplaneRedis {
+			if cfg.Chat.RedisSkipVerify {
+				slog.Warn("not verifying the certificate of the chat backplane", "setting", "chat_redis_skip_verify")
+			}
+			backplane, err = socket.NewRedisBackplane(cfg.Chat.RedisURL, cfg.Chat.RedisChannel, cfg.Chat.RedisSkipVerify)
+			if err != nil {
+				fatal("error connecting to the chat backplane", err)
+			}
+		}
+		hub = socket.NewChatHubWithBackplane(backplane)
+		go hub.Run()
+	}
+	var activity *socket.ActivityHub
+	if cfg.Features.Activity {
+		activity = socket.NewActivityHub()
+		go activity.Run()
+	}
+	handleRoutes(router, cfg, *userController, *projectController, *taskController, *eventController, *commentController, *attachmentController, store, *timeEntryController, *templateController, runner, jwtParser, mail, hub, activity, readiness)
+
+	// the workers are stopped once the server has shut down
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workers sync.WaitGroup
+	if cfg.Features.Recurrence {
+		// creates the next instance of recurring tasks whose deadline has passed
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			recurrence.Run(workerCtx, *userController, *projectController, *taskController)
+		}()
+	}
+
+	if cfg.Features.TrashPurge {
+		// permanently deletes items that have been in the trash for too long
+		retention := time.Duration(cfg.Trash.RetentionDays) * 24 * time.Hour
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			trash.Run(workerCtx, *projectController, *taskController, *eventController, *commentController, *attachmentController, store, *timeEntryController, *templateController, retention)
+		}()
+	}
+
+	server := &http.Server{Addr: cfg.Server.Address, Handler: router}
+	// of the API and metrics servers
+	serverErr := make(chan error, 2)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+	slog.Info("Server booted up!", "address", cfg.Server.Address)
+
+	// metrics are served on their own address, which is not exposed publicly
+	var metricsServer *http.Server
+	if cfg.Features.Metrics {
+		metricsRouter := gin.New()
+		metricsRouter.Use(gin.Recovery())
+		metricsRouter.GET("/metrics", metrics.Handler())
+		metricsServer = &http.Server{Addr: cfg.Server.MetricsAddress, Handler: metricsRouter}
+		go func() {
+			serverErr <- metricsServer.ListenAndServe()
+		}()
+		slog.Info("serving metrics", "address", cfg.Server.MetricsAddress)
+	}
+
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+	exitCode := 0
+	select {
+	case <-signals.Done():
+		slog.Info("shutting down")
+	case err := <-serverErr:
+		slog.Error("error serving", "error", err)
+		exitCode = 1
+	}
+
+	// new requests keep being served until load balancers have seen /readyz fail, which takes up to their probe period
+	readiness.Drain()
+	if exitCode == 0 && cfg.Server.ShutdownDrain.Duration > 0 {
+		slog.Info("draining before closing the listener", "drain", cfg.Server.ShutdownDrain.Duration)
+		select {
+		case <-time.After(cfg.Server.ShutdownDrain.Duration):
+		case err := <-serverErr:
+			slog.Error("error serving", "error", err)
+			exitCode = 1
+		}
+	}
+	// requests in progress and chat clients have until the timeout to finish, after which they are cut off
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout.Duration)
+	defer cancel()
+	var closing sync.WaitGroup
+	if hub != nil {
+		// chat connections are hijacked from the server, so Shutdown does not wait for them
+		closing.Add(1)
+		go func() {
+			defer closing.Done()
+			if err := hub.Shutdown(shutdownCtx); err != nil {
+				slog.Warn("error closing chat clients", "error", err)
+			}
+		}()
+	}
+	if activity != nil {
+		closing.Add(1)
+		go func() {
+			defer closing.Done()
+			if err := activity.Shutdown(shutdownCtx); err != nil {
+				slog.Warn("error closing activity clients", "error", err)
+			}
+		}()
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("error waiting for requests in progress", "error", err)
+	}
+	closing.Wait()
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("error stopping the metrics server", "error", err)
+		}
+	}
+
+	stopWorkers()
+	workers.Wait()
+	disconnect()
+	tracingCtx, cancelTracing := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelTracing()
+	if err := stopTracing(tracingCtx); err != nil {
+		slog.Warn("error sending the last spans", "error", err)
+	}
+	slog.Info("Server shut down")
+	if exitCode != 0 {
+		logSink.Close()
+		os.Exit(exitCode)
+	}
 }
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/config"
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/handlers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/openapi"
+	"github.com/OrgaNiUS/OrgaNiUS/server/socket"
+	"github.com/gin-gonic/gin"
+)
+
+// Registers every route, with every feature enabled.
+// The handlers are not run, so the controllers are left empty.
+func allRoutes() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	cfg := config.Default()
+	handleRoutes(router, cfg, controllers.UserController{}, controllers.ProjectController{}, controllers.TaskController{}, controllers.EventController{}, controllers.CommentController{}, controllers.AttachmentController{}, nil, controllers.TimeEntryController{}, controllers.TemplateController{}, nil, nil, nil, socket.NewChatHub(), socket.NewActivityHub(), handlers.NewReadiness(time.Second))
+	return router
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	router := allRoutes()
+	versions := []struct {
+		prefix string
+		spec   *openapi.Document
+		routes []openapi.Route
+	}{
+		{"/api/v1/", handlers.V1Spec(), handlers.V1Routes()},
+		{"/api/v2/", handlers.V2Spec(), handlers.V2Routes()},
+	}
+
+	for _, version := range versions {
+		registered := map[string]bool{}
+		for _, route := range router.Routes() {
+			if !strings.HasPrefix(route.Path, version.prefix) {
+				continue
+			}
+			registered[route.Method+" "+route.Path] = true
+			if !version.spec.Has(route.Method, route.Path) {
+				t.Errorf("Expected %v %v to be in the OpenAPI document of %v", route.Method, route.Path, version.prefix)
+			}
+		}
+		for _, route := range version.routes {
+			if !registered[route.Method+" "+route.Path] {
+				t.Errorf("Expected %v %v in the OpenAPI document of %v to be registered", route.Method, route.Path, version.prefix)
+			}
+		}
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	// the routes that take nothing but the JWT cookie, and If-Match
+	noInput := map[string]bool{
+		"get /api/v1/refresh_jwt":              true,
+		"delete /api/v1/logout":                true,
+		"get /api/v1/own_user":                 true,
+		"delete /api/v1/user":                  true,
+		"get /api/v1/user_get_project_invites": true,
+		"get /api/v1/project_get_all":          true,
+		"get /api/v1/project_template_get_all": true,
+		"patch /api/v1/task_timer_stop":        true,
+		"get /api/v1/task_timer_get":           true,
+		"get /api/v1/project_search":           true, // the searches are sent over the websocket
+		"get /api/v1/project_invite_search":    true,
+		"get /api/v1/openapi.json":             true,
+		"get /api/v1/docs":                     true,
+		"get /api/v2/users/me":                 true,
+		"delete /api/v2/users/me":              true,
+		"delete /api/v2/sessions":              true,
+		"get /api/v2/openapi.json":             true,
+		"get /api/v2/docs":                     true,
+	}
+	untyped := &openapi.Schema{Type: "object"}
+
+	for _, spec := range []*openapi.Document{handlers.V1Spec(), handlers.V2Spec()} {
+		for path, item := range spec.Paths {
+			for method, op := range item {
+				input := op.RequestBody != nil
+				for _, param := range op.Parameters {
+					input = input || param.In != "header"
+				}
+				if !input && !noInput[method+" "+path] {
+					t.Errorf("Expected %v %v to have a request schema", method, path)
+				}
+
+				for status, response := range op.Responses {
+					if status == "default" || status == "101" || status == "204" {
+						continue
+					}
+					if len(response.Content) == 0 {
+						t.Errorf("Expected the %v response of %v %v to have a schema", status, method, path)
+					}
+					for _, media := range response.Content {
+						if media.Schema == nil || reflect.DeepEqual(media.Schema, untyped) {
+							t.Errorf("Expected the %v response of %v %v to have a schema but got %+v", status, method, path, media.Schema)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	router := allRoutes()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"openapi":"`+openapi.Version+`"`) {
+		t.Errorf("Expected the OpenAPI document but got %v %v", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/docs", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "openapi.json") {
+		t.Errorf("Expected the docs page but got %v", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/openapi.json", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"version":"v2"`) {
+		t.Errorf("Expected the OpenAPI document of v2 but got %v %v", w.Code, w.Body.String())
+	}
+}
+
+func TestMetricsNotPublic(t *testing.T) {
+	for _, route := range allRoutes().Routes() {
+		if route.Path == "/metrics" {
+			t.Errorf("Expected /metrics to be served apart from the API")
+		}
+	}
+}
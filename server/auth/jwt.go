@@ -2,7 +2,7 @@ package auth
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"time"
 
@@ -12,6 +12,7 @@ import (
 
 type JWTParser struct {
 	secret []byte
+	expiry time.Duration
 }
 
 const (
@@ -23,9 +24,15 @@ var (
 )
 
 func New(jwtSecret string) *JWTParser {
+	return NewWithExpiry(jwtSecret, expTime)
+}
+
+// JWTs expire after the given time, instead of the default 10 minutes.
+func NewWithExpiry(jwtSecret string, expiry time.Duration) *JWTParser {
 	jwtSecretBytes := []byte(jwtSecret)
 	return &JWTParser{
 		jwtSecretBytes,
+		expiry,
 	}
 }
 
@@ -44,14 +51,14 @@ func (p *JWTParser) Generate(id, name string) (string, error) {
 	claims["id"] = id
 	claims["name"] = name
 	claims["iat"] = now.Unix()
-	claims["exp"] = now.Add(expTime).Unix()
+	claims["exp"] = now.Add(p.expiry).Unix()
 
 	token := jwt.NewWithClaims(signingMethod, claims)
 
 	tokenString, err := token.SignedString(p.secret)
 
 	if err != nil {
-		log.Printf("failed to generate jwt: %v", err)
+		slog.Error("failed to generate jwt", "error", err)
 		return "", err
 	}
 	return tokenString, nil
@@ -107,7 +114,10 @@ func (p *JWTParser) RefreshJWT(ctx *gin.Context, id, name string) error {
 		return err
 	}
 	// https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Set-Cookie
-	http.SetCookie(ctx.Writer, MakeJWTCookie(jwt))
+	cookie := MakeJWTCookie(jwt)
+	cookie.Expires = time.Now().Add(p.expiry)
+	cookie.MaxAge = int(p.expiry.Seconds())
+	http.SetCookie(ctx.Writer, cookie)
 	return nil
 }
 
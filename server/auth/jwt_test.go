@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
 	"github.com/gin-gonic/gin"
@@ -49,6 +50,27 @@ func TestGenerationAndParsing(t *testing.T) {
 	}
 }
 
+// Tests that the token and the cookie expire after the expiry given.
+func TestExpiry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	parser := auth.NewWithExpiry(secret, time.Hour)
+
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	parser.RefreshJWT(ctx, "123456", "testUser123")
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].MaxAge != 60*60 {
+		t.Fatalf("Expected a cookie lasting an hour, got %v", cookies)
+	}
+	claims, err := parser.Parse(cookies[0].Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := int64(claims["exp"].(float64)) - int64(claims["iat"].(float64)); exp != 60*60 {
+		t.Errorf("Expected the token to expire after an hour but got %v seconds", exp)
+	}
+}
+
 // Tests RefreshJWT.
 func TestRefreshJWT(t *testing.T) {
 	// Set gin to be in test mode.
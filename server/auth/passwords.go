@@ -1,12 +1,18 @@
 package auth
 
 import (
+	"errors"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
 	"golang.org/x/crypto/bcrypt"
 )
 
 func HashPassword(password string) (string, error) {
 	passwordBytes := []byte(password)
 	bytes, err := bcrypt.GenerateFromPassword(passwordBytes, bcrypt.DefaultCost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", errs.Invalid("password", "cannot be longer than 72 bytes")
+	}
 	return string(bytes), err
 }
 
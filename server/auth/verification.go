@@ -3,7 +3,7 @@ package auth
 import (
 	"crypto/rand"
 	"encoding/base32"
-	"log"
+	"log/slog"
 )
 
 // Generates a hash and the 6-character PIN. Used for email verification.
@@ -16,13 +16,13 @@ func GeneratePin() (string, string) {
 	randomBytes := make([]byte, 20)
 	_, err := rand.Read(randomBytes)
 	if err != nil {
-		log.Printf("failed to generate PIN: %v", err)
+		slog.Error("failed to generate PIN", "error", err)
 		return "", ""
 	}
 	pin := base32.StdEncoding.EncodeToString(randomBytes)[:length]
 	hash, err := HashPassword(pin)
 	if err != nil {
-		log.Printf("failed to hash PIN: %v", err)
+		slog.Error("failed to hash PIN", "error", err)
 		return "", ""
 	}
 	return hash, pin
@@ -0,0 +1,468 @@
+// Configuration of the server, loaded from a JSON file, the environment and flags.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Server   Server   `json:"server"`
+	Log      Log      `json:"log"`
+	DB       DB       `json:"db"`
+	JWT      JWT      `json:"jwt"`
+	Mail     Mail     `json:"mail"`
+	Storage  Storage  `json:"storage"`
+	Trash    Trash    `json:"trash"`
+	Search   Search   `json:"search"`
+	Tracing  Tracing  `json:"tracing"`
+	Chat     Chat     `json:"chat"`
+	Features Features `json:"features"`
+}
+
+type Server struct {
+	Address   string `json:"address"`   // address to listen on, such as ":8081"
+	URL       string `json:"url"`       // public URL of the website, used in emails
+	StaticDir string `json:"staticDir"` // React build served at the root
+	// address serving /metrics, apart from the API so that metrics are not public, such as ":9091"
+	MetricsAddress string `json:"metricsAddress"`
+	// time allowed for requests in progress to finish and chat clients to be closed when shutting down
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+	// time between /readyz failing and the server no longer accepting connections, for load balancers to stop sending requests
+	ShutdownDrain Duration `json:"shutdownDrain"`
+}
+
+type Log struct {
+	File       string `json:"file"`       // "-" or "stderr" logs to stderr and "stdout" to stdout, other files are rotated
+	Level      string `json:"level"`      // "debug", "info", "warn" or "error"
+	Format     string `json:"format"`     // "json", or "text" to read in a terminal
+	MaxSizeMB  int    `json:"maxSizeMB"`  // size at which the file is rotated
+	MaxBackups int    `json:"maxBackups"` // rotated files to keep, 0 keeps all of them
+	MaxAgeDays int    `json:"maxAgeDays"` // days to keep rotated files, 0 keeps them forever
+}
+
+type DB struct {
+	Backend        string `json:"backend"` // "mongodb", or "memory" to keep all data in memory
+	URI            string `json:"uri"`
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	MigrateOnStart bool   `json:"migrateOnStart"` // apply the pending migrations before serving
+}
+
+type JWT struct {
+	Secret string   `json:"secret"`
+	Expiry Duration `json:"expiry"` // refreshed on every request
+}
+
+type Mail struct {
+	Transport   string `json:"transport"` // "sendgrid", or "log" to log emails instead of sending them
+	Sender      string `json:"sender"`
+	SendGridKey string `json:"sendGridKey"`
+}
+
+// Attachments are stored in S3 if a bucket is given, else in Dir.
+type Storage struct {
+	Dir         string `json:"dir"`
+	S3Endpoint  string `json:"s3Endpoint"`
+	S3Bucket    string `json:"s3Bucket"`
+	S3Region    string `json:"s3Region"`
+	S3AccessKey string `json:"s3AccessKey"`
+	S3SecretKey string `json:"s3SecretKey"`
+}
+
+type Trash struct {
+	RetentionDays int `json:"retentionDays"` // days that deleted tasks, projects and events stay in the trash
+}
+
+type Search struct {
+	Provider string   `json:"provider"` // "atlas" to use Atlas Search, or "embedded" to search an index kept in memory
+	Refresh  Duration `json:"refresh"`  // how often the embedded index is reloaded from the database
+}
+
+type Tracing struct {
+	Exporter    string  `json:"exporter"`    // "none", "stdout" to write spans to stdout, or "otlp" to send them to a collector
+	Endpoint    string  `json:"endpoint"`    // URL of the OTLP collector, else OTEL_EXPORTER_OTLP_ENDPOINT or http://localhost:4318
+	SampleRatio float64 `json:"sampleRatio"` // fraction of the traces started by the server that are recorded
+}
+
+type Chat struct {
+	Backplane       string `json:"backplane"`       // "memory" to keep chat rooms within this instance, or "redis" to share them between instances
+	RedisURL        string `json:"redisURL"`        // redis:// or rediss:// URL of the Redis shared by the instances
+	RedisChannel    string `json:"redisChannel"`    // Redis channel the instances publish to, for instances sharing a Redis
+	RedisSkipVerify bool   `json:"redisSkipVerify"` // accept any certificate from a rediss:// URL, for providers with self-signed ones
+}
+
+type Features struct {
+	Recurrence bool `json:"recurrence"` // create the next instances of recurring tasks
+	TrashPurge bool `json:"trashPurge"` // permanently delete items that have been in the trash for too long
+	Chat       bool `json:"chat"`       // project chat over websockets
+	Activity   bool `json:"activity"`   // stream of the changes to each project over websockets
+	Metrics    bool `json:"metrics"`    // Prometheus metrics at /metrics, on server.metricsAddress
+}
+
+// A time.Duration written as a string such as "10m" in JSON.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+const (
+	BackendMongoDB = "mongodb"
+	BackendMemory  = "memory"
+
+	TransportSendGrid = "sendgrid"
+	TransportLog      = "log"
+
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+
+	FormatJSON = "json"
+	FormatText = "text"
+
+	SearchAtlas    = "atlas"
+	SearchEmbedded = "embedded"
+
+	TracingNone   = "none"
+	TracingStdout = "stdout"
+	TracingOTLP   = "otlp"
+
+	BackplaneMemory = "memory"
+	BackplaneRedis  = "redis"
+
+	redacted = "REDACTED"
+)
+
+func Default() Config {
+	return Config{
+		Server: Server{
+			Address:         ":8081",
+			MetricsAddress:  ":9091",
+			StaticDir:       "client/build",
+			ShutdownTimeout: Duration{15 * time.Second},
+			ShutdownDrain:   Duration{5 * time.Second},
+		},
+		Log: Log{
+			File:       "logs/server.log",
+			Level:      LevelInfo,
+			Format:     FormatJSON,
+			MaxSizeMB:  100,
+			MaxBackups: 5,
+			MaxAgeDays: 30,
+		},
+		DB: DB{
+			Backend:        BackendMongoDB,
+			URI:            "mongodb+srv://organius.zwjpt.mongodb.net/myFirstDatabase?retryWrites=true&w=majority",
+			MigrateOnStart: true,
+		},
+		JWT:      JWT{Expiry: Duration{10 * time.Minute}},
+		Mail:     Mail{Transport: TransportSendGrid},
+		Storage:  Storage{Dir: "uploads"},
+		Trash:    Trash{RetentionDays: 30},
+		Search:   Search{Provider: SearchAtlas, Refresh: Duration{30 * time.Second}},
+		Tracing:  Tracing{Exporter: TracingNone, SampleRatio: 1},
+		Chat:     Chat{Backplane: BackplaneMemory, RedisChannel: "organius:chat"},
+		Features: Features{Recurrence: true, TrashPurge: true, Chat: true, Activity: true, Metrics: true},
+	}
+}
+
+// A setting that can be given by an environment variable or a flag.
+// The environment variables are the same as those the server used before it had a config file.
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	set   func(c *Config, value string) error
+}
+
+func setString(field func(c *Config) *string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func setBool(field func(c *Config) *bool) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func setInt(field func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func setFloat(field func(c *Config) *float64) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*field(c) = f
+		return nil
+	}
+}
+
+var settings = []setting{
+	{"listen_address", "address", "address to listen on", setString(func(c *Config) *string { return &c.Server.Address })},
+	{"metrics_address", "metrics-address", "address to serve /metrics on, apart from the API", setString(func(c *Config) *string { return &c.Server.MetricsAddress })},
+	{"URL", "url", "public URL of the website", setString(func(c *Config) *string { return &c.Server.URL })},
+	{"static_dir", "static-dir", "directory of the React build", setString(func(c *Config) *string { return &c.Server.StaticDir })},
+	{"shutdown_timeout", "shutdown-timeout", "time allowed for requests in progress to finish when shutting down, such as 15s", func(c *Config, value string) error {
+		return c.Server.ShutdownTimeout.UnmarshalText([]byte(value))
+	}},
+	{"shutdown_drain", "shutdown-drain", "time between failing readiness probes and closing the listener when shutting down, such as 5s", func(c *Config, value string) error {
+		return c.Server.ShutdownDrain.UnmarshalText([]byte(value))
+	}},
+	{"log_file", "log-file", `file to log to, "stdout", or "-" for stderr`, setString(func(c *Config) *string { return &c.Log.File })},
+	{"log_level", "log-level", `"debug", "info", "warn" or "error"`, setString(func(c *Config) *string { return &c.Log.Level })},
+	{"log_format", "log-format", `"json", or "text" to read in a terminal`, setString(func(c *Config) *string { return &c.Log.Format })},
+	{"log_max_size_mb", "log-max-size-mb", "size in MB at which the log file is rotated", setInt(func(c *Config) *int { return &c.Log.MaxSizeMB })},
+	{"log_max_backups", "log-max-backups", "rotated log files to keep, 0 keeps all of them", setInt(func(c *Config) *int { return &c.Log.MaxBackups })},
+	{"log_max_age_days", "log-max-age-days", "days to keep rotated log files, 0 keeps them forever", setInt(func(c *Config) *int { return &c.Log.MaxAgeDays })},
+	{"db_backend", "db-backend", `"mongodb", or "memory" to keep all data in memory`, setString(func(c *Config) *string { return &c.DB.Backend })},
+	{"db_uri", "db-uri", "MongoDB connection string", setString(func(c *Config) *string { return &c.DB.URI })},
+	{"db_migrate_on_start", "db-migrate-on-start", "apply the pending migrations before serving", setBool(func(c *Config) *bool { return &c.DB.MigrateOnStart })},
+	{"db_username", "", "", setString(func(c *Config) *string { return &c.DB.Username })},
+	{"db_password", "", "", setString(func(c *Config) *string { return &c.DB.Password })},
+	{"jwt_secret", "", "", setString(func(c *Config) *string { return &c.JWT.Secret })},
+	{"jwt_expiry", "jwt-expiry", "time until a JWT expires, such as 10m", func(c *Config, value string) error {
+		return c.JWT.Expiry.UnmarshalText([]byte(value))
+	}},
+	{"mail_transport", "mail-transport", `"sendgrid", or "log" to log emails instead of sending them`, setString(func(c *Config) *string { return &c.Mail.Transport })},
+	{"email", "", "", setString(func(c *Config) *string { return &c.Mail.Sender })},
+	{"sendgrid_api_key", "", "", setString(func(c *Config) *string { return &c.Mail.SendGridKey })},
+	{"storage_dir", "storage-dir", "directory to store attachments in, when not using S3", setString(func(c *Config) *string { return &c.Storage.Dir })},
+	{"s3_endpoint", "", "", setString(func(c *Config) *string { return &c.Storage.S3Endpoint })},
+	{"s3_bucket", "", "", setString(func(c *Config) *string { return &c.Storage.S3Bucket })},
+	{"s3_region", "", "", setString(func(c *Config) *string { return &c.Storage.S3Region })},
+	{"s3_access_key", "", "", setString(func(c *Config) *string { return &c.Storage.S3AccessKey })},
+	{"s3_secret_key", "", "", setString(func(c *Config) *string { return &c.Storage.S3SecretKey })},
+	{"trash_retention_days", "trash-retention-days", "days that deleted items stay in the trash", setInt(func(c *Config) *int { return &c.Trash.RetentionDays })},
+	{"search_provider", "search-provider", `"atlas" for Atlas Search, or "embedded" to search an index kept in memory`, setString(func(c *Config) *string { return &c.Search.Provider })},
+	{"search_refresh", "search-refresh", "how often the embedded search index is reloaded, such as 30s", func(c *Config, value string) error {
+		return c.Search.Refresh.UnmarshalText([]byte(value))
+	}},
+	{"tracing_exporter", "tracing-exporter", `"none", "stdout", or "otlp" to send spans to a collector`, setString(func(c *Config) *string { return &c.Tracing.Exporter })},
+	{"tracing_endpoint", "tracing-endpoint", "URL of the OTLP collector, such as http://localhost:4318", setString(func(c *Config) *string { return &c.Tracing.Endpoint })},
+	{"tracing_sample_ratio", "tracing-sample-ratio", "fraction of traces recorded, from 0 to 1", setFloat(func(c *Config) *float64 { return &c.Tracing.SampleRatio })},
+	{"chat_backplane", "chat-backplane", `"memory" to keep chat rooms within this instance, or "redis" to share them between instances`, setString(func(c *Config) *string { return &c.Chat.Backplane })},
+	{"REDIS_URL", "", "", setString(func(c *Config) *string { return &c.Chat.RedisURL })},
+	{"chat_redis_channel", "chat-redis-channel", "Redis channel the instances publish chat messages to", setString(func(c *Config) *string { return &c.Chat.RedisChannel })},
+	{"chat_redis_skip_verify", "chat-redis-skip-verify", "accept any certificate from a rediss:// Redis, for providers with self-signed ones", setBool(func(c *Config) *bool { return &c.Chat.RedisSkipVerify })},
+	{"feature_recurrence", "feature-recurrence", "create the next instances of recurring tasks", setBool(func(c *Config) *bool { return &c.Features.Recurrence })},
+	{"feature_trash_purge", "feature-trash-purge", "permanently delete items that have been in the trash for too long", setBool(func(c *Config) *bool { return &c.Features.TrashPurge })},
+	{"feature_chat", "feature-chat", "project chat over websockets", setBool(func(c *Config) *bool { return &c.Features.Chat })},
+	{"feature_activity", "feature-activity", "stream of the changes to each project over websockets", setBool(func(c *Config) *bool { return &c.Features.Activity })},
+	{"feature_metrics", "feature-metrics", "Prometheus metrics at /metrics on metrics_address", setBool(func(c *Config) *bool { return &c.Features.Metrics })},
+}
+
+// Options given on the command line that are not part of the config.
+type Options struct {
+	PrintConfig bool     // print the config and exit
+	Args        []string // the arguments after the flags, such as a subcommand
+}
+
+// Loads the config, with each source overriding the ones before:
+// the defaults, the JSON file given by -config or the "config_file" environment variable, the environment variables, and the flags in args.
+// Secrets are not accepted as flags, as those are visible to other processes.
+// getenv is os.LookupEnv outside of tests.
+func Load(args []string, getenv func(key string) (string, bool)) (Config, Options, error) {
+	config := Default()
+	options := Options{}
+
+	flags := flag.NewFlagSet("organius", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	file := flags.String("config", "", "JSON file to load the config from")
+	flags.BoolVar(&options.PrintConfig, "print-config", false, "print the config with secrets redacted and exit")
+	for _, s := range settings {
+		if s.flag != "" {
+			flags.String(s.flag, "", s.usage)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return config, options, err
+	}
+	options.Args = flags.Args()
+
+	if *file == "" {
+		*file, _ = getenv("config_file")
+	}
+	if *file != "" {
+		if err := loadFile(&config, *file); err != nil {
+			return config, options, err
+		}
+	}
+
+	for _, s := range settings {
+		if value, ok := getenv(s.env); ok && value != "" {
+			if err := s.set(&config, value); err != nil {
+				return config, options, fmt.Errorf("invalid %v: %v", s.env, err)
+			}
+		}
+	}
+
+	var err error
+	flags.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if err == nil && s.flag == f.Name {
+				if setErr := s.set(&config, f.Value.String()); setErr != nil {
+					err = fmt.Errorf("invalid -%v: %v", s.flag, setErr)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return config, options, err
+	}
+
+	return config, options, config.Validate()
+}
+
+func loadFile(config *Config, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	decoder := json.NewDecoder(file)
+	// a misspelt field would otherwise be silently ignored
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return fmt.Errorf("invalid config file %v: %v", path, err)
+	}
+	return nil
+}
+
+// Returns the problems with the config, all at once.
+func (c Config) Validate() error {
+	problems := []string{}
+	check := func(ok bool, problem string) {
+		if !ok {
+			problems = append(problems, problem)
+		}
+	}
+
+	check(c.Server.Address != "", "server.address cannot be empty")
+	check(c.Server.ShutdownTimeout.Duration > 0, "server.shutdownTimeout must be positive")
+	check(c.Server.ShutdownDrain.Duration >= 0, "server.shutdownDrain cannot be negative")
+	if c.Features.Metrics {
+		check(c.Server.MetricsAddress != "" && c.Server.MetricsAddress != c.Server.Address, "server.metricsAddress cannot be empty or the same as server.address, as metrics are not served publicly")
+	}
+	check(c.Log.File != "", `log.file cannot be empty, use "-" for stderr`)
+	check(c.Log.Level == LevelDebug || c.Log.Level == LevelInfo || c.Log.Level == LevelWarn || c.Log.Level == LevelError, fmt.Sprintf("log.level must be %q, %q, %q or %q", LevelDebug, LevelInfo, LevelWarn, LevelError))
+	check(c.Log.Format == FormatJSON || c.Log.Format == FormatText, fmt.Sprintf("log.format must be %q or %q", FormatJSON, FormatText))
+	check(c.Log.MaxSizeMB > 0, "log.maxSizeMB must be positive")
+	check(c.Log.MaxBackups >= 0 && c.Log.MaxAgeDays >= 0, "log.maxBackups and log.maxAgeDays cannot be negative")
+	check(c.DB.Backend == BackendMongoDB || c.DB.Backend == BackendMemory, fmt.Sprintf("db.backend must be %q or %q", BackendMongoDB, BackendMemory))
+	if c.DB.Backend == BackendMongoDB {
+		uri, err := url.Parse(c.DB.URI)
+		check(err == nil && (uri.Scheme == "mongodb" || uri.Scheme == "mongodb+srv"), "db.uri must be a mongodb:// or mongodb+srv:// connection string")
+	}
+	check(c.JWT.Secret != "", "jwt.secret cannot be empty")
+	check(c.JWT.Expiry.Duration > 0, "jwt.expiry must be positive")
+	check(c.Mail.Transport == TransportSendGrid || c.Mail.Transport == TransportLog, fmt.Sprintf("mail.transport must be %q or %q", TransportSendGrid, TransportLog))
+	if c.Mail.Transport == TransportSendGrid {
+		check(c.Mail.SendGridKey != "", "mail.sendGridKey cannot be empty when sending with sendgrid")
+		check(c.Mail.Sender != "", "mail.sender cannot be empty when sending with sendgrid")
+	}
+	if c.Storage.S3Bucket == "" {
+		check(c.Storage.Dir != "", "storage.dir cannot be empty when not using S3")
+	}
+	check(c.Trash.RetentionDays > 0, "trash.retentionDays must be positive")
+	check(c.Search.Provider == SearchAtlas || c.Search.Provider == SearchEmbedded, fmt.Sprintf("search.provider must be %q or %q", SearchAtlas, SearchEmbedded))
+	check(c.Search.Refresh.Duration > 0, "search.refresh must be positive")
+	check(c.Tracing.Exporter == TracingNone || c.Tracing.Exporter == TracingStdout || c.Tracing.Exporter == TracingOTLP, fmt.Sprintf("tracing.exporter must be %q, %q or %q", TracingNone, TracingStdout, TracingOTLP))
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sampleRatio must be between 0 and 1")
+	check(c.Chat.Backplane == BackplaneMemory || c.Chat.Backplane == BackplaneRedis, fmt.Sprintf("chat.backplane must be %q or %q", BackplaneMemory, BackplaneRedis))
+	if c.Chat.Backplane == BackplaneRedis {
+		uri, err := url.Parse(c.Chat.RedisURL)
+		check(err == nil && (uri.Scheme == "redis" || uri.Scheme == "rediss"), "chat.redisURL must be a redis:// or rediss:// URL when sharing chat rooms through redis")
+		check(c.Chat.RedisChannel != "", "chat.redisChannel cannot be empty when sharing chat rooms through redis")
+		check(!c.Chat.RedisSkipVerify || uri.Scheme == "rediss", "chat.redisSkipVerify needs a rediss:// URL")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid config: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// Returns a copy of the config with the secrets replaced, safe to print or log.
+func (c Config) Redacted() Config {
+	hide := func(secret *string) {
+		if *secret != "" {
+			*secret = redacted
+		}
+	}
+	hide(&c.DB.Password)
+	hide(&c.JWT.Secret)
+	hide(&c.Mail.SendGridKey)
+	hide(&c.Storage.S3AccessKey)
+	hide(&c.Storage.S3SecretKey)
+	// the connection strings may have a password in them too
+	hideInURL := func(raw *string) {
+		if uri, err := url.Parse(*raw); err == nil && uri.User != nil {
+			if _, hasPassword := uri.User.Password(); hasPassword {
+				uri.User = url.UserPassword(uri.User.Username(), redacted)
+				*raw = uri.String()
+			}
+		}
+	}
+	hideInURL(&c.DB.URI)
+	hideInURL(&c.Chat.RedisURL)
+	return c
+}
+
+// Writes the config as JSON with the secrets redacted.
+func (c Config) Print(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(c.Redacted())
+}
+
+// The flags that can be given, for usage messages.
+func Usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: organius [flags] [integrity [-repair] [-json] | migrate [-to version] [up | down | status]]")
+	fmt.Fprintln(w, "  -config string\n\tJSON file to load the config from")
+	fmt.Fprintln(w, "  -print-config\n\tprint the config with secrets redacted and exit")
+	for _, s := range settings {
+		if s.flag != "" {
+			fmt.Fprintf(w, "  -%v string\n\t%v (environment variable %v)\n", s.flag, s.usage, s.env)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	attachmentCollection = "attachments"
+)
+
+// The Id and Key of the attachment should already be populated, as the file is stored before the attachment is created.
+func (c *AttachmentController) AttachmentCreate(ctx context.Context, attachment *models.Attachment) error {
+	ctx, span := tracing.Start(ctx, "AttachmentController.AttachmentCreate")
+	defer span.End()
+	attachment.CreationTime = time.Now()
+	id, err := c.Collection(attachmentCollection).InsertOne(ctx, attachment)
+	if err != nil {
+		return err
+	}
+	attachment.Id = id
+	return nil
+}
+
+func (c *AttachmentController) AttachmentRetrieve(ctx context.Context, id string) (models.Attachment, error) {
+	ctx, span := tracing.Start(ctx, "AttachmentController.AttachmentRetrieve")
+	defer span.End()
+	if id == "" {
+		return models.Attachment{}, errs.Validation("cannot leave attachment id empty")
+	}
+	attachment, err := c.Collection(attachmentCollection).FindOne(ctx, id)
+	return *attachment, err
+}
+
+// Returns all attachments of a task or project, oldest first.
+func (c *AttachmentController) AttachmentGetAll(ctx context.Context, ownerType, ownerid string) ([]models.Attachment, error) {
+	ctx, span := tracing.Start(ctx, "AttachmentController.AttachmentGetAll")
+	defer span.End()
+	attachments := []models.Attachment{}
+	filter := bson.D{
+		{Key: "ownerType", Value: ownerType},
+		{Key: "ownerid", Value: ownerid},
+	}
+	err := c.Collection(attachmentCollection).FindAll(ctx, filter, &attachments)
+	return attachments, err
+}
+
+func (c *AttachmentController) AttachmentDelete(ctx context.Context, attachment models.Attachment) error {
+	ctx, span := tracing.Start(ctx, "AttachmentController.AttachmentDelete")
+	defer span.End()
+	_, err := c.Collection(attachmentCollection).DeleteByID(ctx, attachment.Id)
+	return err
+}
+
+// Deletes all attachments of the tasks or projects.
+// Returns the deleted attachments so that their files can be removed from storage.
+func (c *AttachmentController) AttachmentDeleteByOwners(ctx context.Context, ownerType string, ownerids []string) ([]models.Attachment, error) {
+	ctx, span := tracing.Start(ctx, "AttachmentController.AttachmentDeleteByOwners")
+	defer span.End()
+	attachments := []models.Attachment{}
+	filter := bson.D{
+		{Key: "ownerType", Value: ownerType},
+		{Key: "ownerid", Value: bson.D{{Key: "$in", Value: ownerids}}},
+	}
+	if err := c.Collection(attachmentCollection).FindAll(ctx, filter, &attachments); err != nil {
+		return attachments, err
+	}
+	_, err := c.Collection(attachmentCollection).DeleteMany(ctx, filter)
+	return attachments, err
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AttachmentCollectionInterface interface {
+	// Insert a new attachment into the database
+	// Returns the object ID
+	InsertOne(ctx context.Context, attachment *models.Attachment) (primitive.ObjectID, error)
+
+	// Find one attachment by id
+	FindOne(ctx context.Context, id string) (*models.Attachment, error)
+
+	// Find all attachments matching the filter, oldest first
+	FindAll(ctx context.Context, filter bson.D, attachments *[]models.Attachment) error
+
+	// Deletes an attachment by ID
+	DeleteByID(ctx context.Context, id primitive.ObjectID) (int64, error)
+
+	// Delete many attachments from Attachment Collection
+	DeleteMany(ctx context.Context, params bson.D) (int64, error)
+}
+
+type AttachmentCollection struct {
+	attachmentCollection MongoCollection
+}
+
+func (c *AttachmentCollection) InsertOne(ctx context.Context, attachment *models.Attachment) (primitive.ObjectID, error) {
+	result, err := c.attachmentCollection.InsertOne(ctx, attachment)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	id := result.InsertedID.(primitive.ObjectID)
+	return id, nil
+}
+
+func (c *AttachmentCollection) FindOne(ctx context.Context, id string) (*models.Attachment, error) {
+	attachment := models.Attachment{}
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return &attachment, err
+	}
+	params := bson.D{{Key: "_id", Value: objectId}}
+	err = c.attachmentCollection.FindOne(ctx, params).Decode(&attachment)
+	return &attachment, err
+}
+
+func (c *AttachmentCollection) FindAll(ctx context.Context, filter bson.D, attachments *[]models.Attachment) error {
+	opts := options.Find().SetSort(bson.D{{Key: "creationTime", Value: 1}})
+	cursor, err := c.attachmentCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, attachments)
+}
+
+func (c *AttachmentCollection) DeleteByID(ctx context.Context, id primitive.ObjectID) (int64, error) {
+	params := bson.D{{Key: "_id", Value: id}}
+	result, err := c.attachmentCollection.DeleteOne(ctx, params)
+	if err != nil {
+		return -1, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (c *AttachmentCollection) DeleteMany(ctx context.Context, params bson.D) (int64, error) {
+	result, err := c.attachmentCollection.DeleteMany(ctx, params)
+	if err != nil {
+		return -1, err
+	}
+	return result.DeletedCount, nil
+}
+
+type AttachmentController struct {
+	Collection func(name string, opts ...*options.CollectionOptions) AttachmentCollectionInterface
+	URL        string
+}
+
+func NewA(database Database, URL string) *AttachmentController {
+	return &AttachmentController{
+		func(name string, opts ...*options.CollectionOptions) AttachmentCollectionInterface {
+			return &AttachmentCollection{
+				database(name, opts...),
+			}
+		},
+		URL,
+	}
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	commentCollection = "comments"
+)
+
+func (c *CommentController) CommentCreate(ctx context.Context, comment *models.Comment) error {
+	ctx, span := tracing.Start(ctx, "CommentController.CommentCreate")
+	defer span.End()
+	comment.CreationTime = time.Now()
+	comment.IsDeleted = false
+	id, err := c.Collection(commentCollection).InsertOne(ctx, comment)
+	if err != nil {
+		return err
+	}
+	comment.Id = id
+	return nil
+}
+
+func (c *CommentController) CommentRetrieve(ctx context.Context, id string) (models.Comment, error) {
+	ctx, span := tracing.Start(ctx, "CommentController.CommentRetrieve")
+	defer span.End()
+	if id == "" {
+		return models.Comment{}, errs.Validation("cannot leave comment id empty")
+	}
+	comment, err := c.Collection(commentCollection).FindOne(ctx, id)
+	return *comment, err
+}
+
+// Returns all comments of a task, oldest first.
+func (c *CommentController) CommentGetAll(ctx context.Context, taskid string) ([]models.Comment, error) {
+	ctx, span := tracing.Start(ctx, "CommentController.CommentGetAll")
+	defer span.End()
+	comments := []models.Comment{}
+	filter := bson.D{{Key: "taskid", Value: taskid}}
+	err := c.Collection(commentCollection).FindAll(ctx, filter, &comments)
+	return comments, err
+}
+
+// Clears the content of a comment but keeps it, so that its replies remain in the thread.
+func (c *CommentController) CommentDelete(ctx context.Context, comment models.Comment) error {
+	ctx, span := tracing.Start(ctx, "CommentController.CommentDelete")
+	defer span.End()
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "content", Value: ""},
+		{Key: "mentions", Value: []string{}},
+		{Key: "isDeleted", Value: true},
+	}}}
+	_, err := c.Collection(commentCollection).UpdateByID(ctx, comment.Id, update)
+	return err
+}
+
+// Permanently deletes all comments of the tasks.
+func (c *CommentController) CommentDeleteByTasks(ctx context.Context, taskids []string) error {
+	ctx, span := tracing.Start(ctx, "CommentController.CommentDeleteByTasks")
+	defer span.End()
+	params := bson.D{{Key: "taskid", Value: bson.D{{Key: "$in", Value: taskids}}}}
+	_, err := c.Collection(commentCollection).DeleteMany(ctx, params)
+	return err
+}
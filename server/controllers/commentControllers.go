@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CommentCollectionInterface interface {
+	// Insert a new comment into the database
+	// Returns the object ID
+	InsertOne(ctx context.Context, comment *models.Comment) (primitive.ObjectID, error)
+
+	// Find one comment by id
+	FindOne(ctx context.Context, id string) (*models.Comment, error)
+
+	// Find all comments matching the filter, oldest first
+	FindAll(ctx context.Context, filter bson.D, comments *[]models.Comment) error
+
+	// Modifies a comment by ID
+	UpdateByID(ctx context.Context, id primitive.ObjectID, params bson.D) (*mongo.UpdateResult, error)
+
+	// Delete many comments from Comment Collection
+	DeleteMany(ctx context.Context, params bson.D) (int64, error)
+}
+
+type CommentCollection struct {
+	commentCollection MongoCollection
+}
+
+func (c *CommentCollection) InsertOne(ctx context.Context, comment *models.Comment) (primitive.ObjectID, error) {
+	result, err := c.commentCollection.InsertOne(ctx, comment)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	id := result.InsertedID.(primitive.ObjectID)
+	return id, nil
+}
+
+func (c *CommentCollection) FindOne(ctx context.Context, id string) (*models.Comment, error) {
+	comment := models.Comment{}
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return &comment, err
+	}
+	params := bson.D{{Key: "_id", Value: objectId}}
+	err = c.commentCollection.FindOne(ctx, params).Decode(&comment)
+	return &comment, err
+}
+
+func (c *CommentCollection) FindAll(ctx context.Context, filter bson.D, comments *[]models.Comment) error {
+	opts := options.Find().SetSort(bson.D{{Key: "creationTime", Value: 1}})
+	cursor, err := c.commentCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, comments)
+}
+
+func (c *CommentCollection) UpdateByID(ctx context.Context, id primitive.ObjectID, params bson.D) (*mongo.UpdateResult, error) {
+	return c.commentCollection.UpdateByID(ctx, id, params)
+}
+
+func (c *CommentCollection) DeleteMany(ctx context.Context, params bson.D) (int64, error) {
+	result, err := c.commentCollection.DeleteMany(ctx, params)
+	if err != nil {
+		return -1, err
+	}
+	return result.DeletedCount, nil
+}
+
+type CommentController struct {
+	Collection func(name string, opts ...*options.CollectionOptions) CommentCollectionInterface
+	URL        string
+}
+
+func NewC(database Database, URL string) *CommentController {
+	return &CommentController{
+		func(name string, opts ...*options.CollectionOptions) CommentCollectionInterface {
+			return &CommentCollection{
+				database(name, opts...),
+			}
+		},
+		URL,
+	}
+}
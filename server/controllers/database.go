@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/metrics"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// The methods of *mongo.Collection that the controllers use.
+// Implemented by *memdb.Collection as well, so that the server can run without MongoDB, see main.go.
+type MongoCollection interface {
+	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
+	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult
+	InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
+	InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error)
+	UpdateByID(ctx context.Context, id interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error)
+	Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error)
+}
+
+// Returns the collection with the name.
+type Database func(name string, opts ...*options.CollectionOptions) MongoCollection
+
+// The OrgaNiUS database of the MongoDB deployment.
+func MongoDatabase(client *mongo.Client) Database {
+	database := client.Database(databaseName)
+	return func(name string, opts ...*options.CollectionOptions) MongoCollection {
+		return database.Collection(name, opts...)
+	}
+}
+
+// Records the latency and errors of each operation on the collections of the database, and traces it.
+func InstrumentedDatabase(database Database) Database {
+	return func(name string, opts ...*options.CollectionOptions) MongoCollection {
+		collection := database(name, opts...)
+		timed := timedCollection{collection, name}
+		// keeps the indexes of MongoDB collections reachable for the migrations
+		if indexed, ok := collection.(interface{ Indexes() mongo.IndexView }); ok {
+			return timedIndexedCollection{timed, indexed.Indexes}
+		}
+		// and the unique indexes of memory collections
+		if unique, ok := collection.(UniqueIndexer); ok {
+			return timedUniqueCollection{timed, unique}
+		}
+		return timed
+	}
+}
+
+type timedCollection struct {
+	collection MongoCollection
+	name       string
+}
+
+type timedIndexedCollection struct {
+	timedCollection
+	indexes func() mongo.IndexView
+}
+
+func (c timedIndexedCollection) Indexes() mongo.IndexView {
+	return c.indexes()
+}
+
+// Implemented by the collections kept in memory, which have no indexes other than unique ones.
+type UniqueIndexer interface {
+	CreateUniqueIndex(name string, keys []string, partial bson.D) error
+	DropUniqueIndex(name string)
+}
+
+type timedUniqueCollection struct {
+	timedCollection
+	UniqueIndexer
+}
+
+// Starts timing and tracing the operation, which is recorded once the returned function is called with its error.
+// The returned context holds the span of the operation, for the driver to use.
+func (c timedCollection) start(ctx context.Context, operation string) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, operation+" "+c.name,
+		semconv.DBSystemMongoDB,
+		semconv.DBOperation(operation),
+		semconv.DBMongoDBCollection(c.name),
+	)
+	return ctx, func(err error) {
+		metrics.DBDuration.WithLabelValues(c.name, operation).Observe(time.Since(start).Seconds())
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			metrics.DBErrors.WithLabelValues(c.name, operation).Inc()
+			tracing.Fail(span, err)
+		}
+		span.End()
+	}
+}
+
+func (c timedCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	ctx, done := c.start(ctx, "find")
+	cursor, err := c.collection.Find(ctx, filter, opts...)
+	done(err)
+	return cursor, err
+}
+
+func (c timedCollection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+	ctx, done := c.start(ctx, "findOne")
+	result := c.collection.FindOne(ctx, filter, opts...)
+	done(result.Err())
+	return result
+}
+
+func (c timedCollection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	ctx, done := c.start(ctx, "insertOne")
+	result, err := c.collection.InsertOne(ctx, document, opts...)
+	done(err)
+	return result, err
+}
+
+func (c timedCollection) InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
+	ctx, done := c.start(ctx, "insertMany")
+	result, err := c.collection.InsertMany(ctx, documents, opts...)
+	done(err)
+	return result, err
+}
+
+func (c timedCollection) UpdateByID(ctx context.Context, id interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	ctx, done := c.start(ctx, "updateByID")
+	result, err := c.collection.UpdateByID(ctx, id, update, opts...)
+	done(err)
+	return result, err
+}
+
+func (c timedCollection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	ctx, done := c.start(ctx, "updateOne")
+	result, err := c.collection.UpdateOne(ctx, filter, update, opts...)
+	done(err)
+	return result, err
+}
+
+func (c timedCollection) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	ctx, done := c.start(ctx, "updateMany")
+	result, err := c.collection.UpdateMany(ctx, filter, update, opts...)
+	done(err)
+	return result, err
+}
+
+func (c timedCollection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	ctx, done := c.start(ctx, "deleteOne")
+	result, err := c.collection.DeleteOne(ctx, filter, opts...)
+	done(err)
+	return result, err
+}
+
+func (c timedCollection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	ctx, done := c.start(ctx, "deleteMany")
+	result, err := c.collection.DeleteMany(ctx, filter, opts...)
+	done(err)
+	return result, err
+}
+
+func (c timedCollection) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+	ctx, done := c.start(ctx, "bulkWrite")
+	result, err := c.collection.BulkWrite(ctx, models, opts...)
+	done(err)
+	return result, err
+}
+
+func (c timedCollection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+	ctx, done := c.start(ctx, "aggregate")
+	cursor, err := c.collection.Aggregate(ctx, pipeline, opts...)
+	done(err)
+	return cursor, err
+}
@@ -0,0 +1,69 @@
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/metrics"
+	"github.com/OrgaNiUS/OrgaNiUS/server/testdb"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestInstrumentedDatabase(t *testing.T) {
+	database := controllers.InstrumentedDatabase(testdb.New())
+	ctx := context.Background()
+	collection := database("instrumented")
+
+	if _, err := collection.InsertOne(ctx, bson.D{{Key: "_id", Value: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := collection.InsertOne(ctx, bson.D{{Key: "_id", Value: 1}}); err == nil {
+		t.Fatal("Expected a duplicate key error")
+	}
+	// finding nothing is not an error of the database
+	collection.FindOne(ctx, bson.D{{Key: "_id", Value: 2}})
+
+	if n := testutil.CollectAndCount(metrics.DBDuration, "organius_db_operation_duration_seconds"); n < 2 {
+		t.Errorf("Expected the insert and find to be timed, got %v series", n)
+	}
+	if n := testutil.ToFloat64(metrics.DBErrors.WithLabelValues("instrumented", "insertOne")); n != 1 {
+		t.Errorf("Expected 1 failed insert, got %v", n)
+	}
+	if n := testutil.ToFloat64(metrics.DBErrors.WithLabelValues("instrumented", "findOne")); n != 0 {
+		t.Errorf("Expected no failed finds, got %v", n)
+	}
+}
+
+func TestInstrumentedDatabaseTraces(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer provider.Shutdown(context.Background())
+
+	database := controllers.InstrumentedDatabase(testdb.New())
+	ctx := context.Background()
+	collection := database("traced")
+	collection.InsertOne(ctx, bson.D{{Key: "_id", Value: 1}})
+	collection.InsertOne(ctx, bson.D{{Key: "_id", Value: 1}})
+	collection.FindOne(ctx, bson.D{{Key: "_id", Value: 2}})
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("Expected a span for each operation, got %v", len(spans))
+	}
+	if spans[0].Name() != "insertOne traced" || spans[2].Name() != "findOne traced" {
+		t.Errorf("Expected the spans to be named by operation and collection, got %v and %v", spans[0].Name(), spans[2].Name())
+	}
+	expected := []codes.Code{codes.Unset, codes.Error, codes.Unset}
+	for i, span := range spans {
+		if span.Status().Code != expected[i] {
+			t.Errorf("Expected %v to have status %v, got %v", span.Name(), expected[i], span.Status().Code)
+		}
+	}
+}
@@ -2,12 +2,14 @@ package controllers
 
 import (
 	"context"
-	"errors"
 
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
 	"github.com/OrgaNiUS/OrgaNiUS/server/functions"
 	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -15,6 +17,8 @@ const (
 )
 
 func (c *EventController) EventCreate(ctx context.Context, event *models.Event) error {
+	ctx, span := tracing.Start(ctx, "EventController.EventCreate")
+	defer span.End()
 	id, err := c.Collection(eventCollection).InsertOne(ctx, event)
 	if err != nil {
 		return err
@@ -26,6 +30,8 @@ func (c *EventController) EventCreate(ctx context.Context, event *models.Event)
 
 // Returns a string slice of eventids & error.
 func (c *EventController) EventCreateMany(ctx context.Context, events []*models.Event) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "EventController.EventCreateMany")
+	defer span.End()
 	result, err := c.Collection(eventCollection).InsertMany(ctx, events)
 	if err != nil {
 		return []string{}, err
@@ -41,14 +47,18 @@ func (c *EventController) EventCreateMany(ctx context.Context, events []*models.
 }
 
 func (c *EventController) EventGet(ctx context.Context, eventid string) (*models.Event, error) {
+	ctx, span := tracing.Start(ctx, "EventController.EventGet")
+	defer span.End()
 	if eventid == "" {
-		return nil, errors.New("cannot leave id empty")
+		return nil, errs.Validation("cannot leave id empty")
 	}
 	event, err := c.Collection(eventCollection).FindOne(ctx, eventid)
 	return event, err
 }
 
 func (c *EventController) EventMapToArray(ctx context.Context, events []string) []models.Event {
+	ctx, span := tracing.Start(ctx, "EventController.EventMapToArray", attribute.Int("events", len(events)))
+	defer span.End()
 	size := len(events)
 	ids := make([]primitive.ObjectID, size)
 	result := make([]models.Event, size)
@@ -60,7 +70,11 @@ func (c *EventController) EventMapToArray(ctx context.Context, events []string)
 	return result
 }
 
-func (c *EventController) EventModify(ctx context.Context, eventid primitive.ObjectID, name, start, end *string) error {
+// Changes the name and times given.
+// If version is not nil, the event is only modified if it is still at the version, else a precondition error is returned.
+func (c *EventController) EventModify(ctx context.Context, eventid primitive.ObjectID, version *int64, name, start, end *string) error {
+	ctx, span := tracing.Start(ctx, "EventController.EventModify")
+	defer span.End()
 	params := bson.D{}
 	if name != nil {
 		params = append(params, bson.E{Key: "name", Value: *name})
@@ -68,24 +82,30 @@ func (c *EventController) EventModify(ctx context.Context, eventid primitive.Obj
 	if start != nil {
 		startTime, err := functions.StringToTime(*start)
 		if err != nil {
-			return errors.New("bad start time")
+			return errs.Validation("bad start time")
 		}
 		params = append(params, bson.E{Key: "start", Value: startTime})
 	}
 	if end != nil {
 		endTime, err := functions.StringToTime(*end)
 		if err != nil {
-			return errors.New("bad end time")
+			return errs.Validation("bad end time")
 		}
 		params = append(params, bson.E{Key: "end", Value: endTime})
 	}
 
 	update := bson.D{{Key: "$set", Value: params}}
-	c.Collection(eventCollection).UpdateByID(ctx, eventid, update)
-	return nil
+	if version == nil {
+		_, err := c.Collection(eventCollection).UpdateByID(ctx, eventid, update)
+		return err
+	}
+	result, err := c.Collection(eventCollection).UpdateByVersion(ctx, eventid, *version, update)
+	return checkVersion(result, err, "event")
 }
 
 func (c *EventController) EventDelete(ctx context.Context, eventid primitive.ObjectID) error {
+	ctx, span := tracing.Start(ctx, "EventController.EventDelete")
+	defer span.End()
 	_, err := c.Collection(eventCollection).DeleteByID(ctx, eventid)
 	return err
 }
@@ -15,17 +15,32 @@ type EventCollectionInterface interface {
 
 	InsertMany(ctx context.Context, events []*models.Event) (*mongo.InsertManyResult, error)
 
+	// Find one event by id, excluding events in the trash
 	FindOne(ctx context.Context, id string) (*models.Event, error)
 
+	// Find all events in the id array, excluding events in the trash
 	FindAll(ctx context.Context, ids []primitive.ObjectID, events *[]models.Event) error
 
+	// Find all events matching the filter
+	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
+
+	// Every update increments the version of the events it modifies.
 	UpdateByID(ctx context.Context, id primitive.ObjectID, params bson.D) (*mongo.UpdateResult, error)
 
+	// Modifies an event by ID only if it is at the version
+	UpdateByVersion(ctx context.Context, id primitive.ObjectID, version int64, params bson.D) (*mongo.UpdateResult, error)
+
+	// Modifies all events matching the filter
+	UpdateMany(ctx context.Context, filter bson.D, params bson.D) (*mongo.UpdateResult, error)
+
 	DeleteByID(ctx context.Context, id primitive.ObjectID) (int64, error)
+
+	// Deletes all events matching the filter
+	DeleteMany(ctx context.Context, filter bson.D) (int64, error)
 }
 
 type EventCollection struct {
-	eventCollection *mongo.Collection
+	eventCollection MongoCollection
 }
 
 func (c *EventCollection) InsertOne(ctx context.Context, event *models.Event) (primitive.ObjectID, error) {
@@ -47,7 +62,7 @@ func (c *EventCollection) InsertMany(ctx context.Context, events []*models.Event
 }
 
 func (c *EventCollection) FindAll(ctx context.Context, ids []primitive.ObjectID, events *[]models.Event) error {
-	params := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	params := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}, notDeleted}
 	cursor, err := c.eventCollection.Find(ctx, params)
 	if err != nil {
 		return err
@@ -62,19 +77,31 @@ func (c *EventCollection) FindOne(ctx context.Context, id string) (*models.Event
 	if err != nil {
 		return &event, err
 	}
-	params := bson.D{{Key: "_id", Value: objectId}}
+	params := bson.D{{Key: "_id", Value: objectId}, notDeleted}
 	err = c.eventCollection.FindOne(ctx, params).Decode(&event)
 	return &event, err
 }
 
+func (c *EventCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	return c.eventCollection.Find(ctx, filter, opts...)
+}
+
 func (c *EventCollection) UpdateByID(ctx context.Context, id primitive.ObjectID, params bson.D) (*mongo.UpdateResult, error) {
-	result, err := c.eventCollection.UpdateByID(ctx, id, params)
+	result, err := c.eventCollection.UpdateByID(ctx, id, bumpVersion(params))
 	if err != nil {
 		return nil, err
 	}
 	return result, err
 }
 
+func (c *EventCollection) UpdateByVersion(ctx context.Context, id primitive.ObjectID, version int64, params bson.D) (*mongo.UpdateResult, error) {
+	return c.eventCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: id}, atVersion(version)}, bumpVersion(params))
+}
+
+func (c *EventCollection) UpdateMany(ctx context.Context, filter bson.D, params bson.D) (*mongo.UpdateResult, error) {
+	return c.eventCollection.UpdateMany(ctx, filter, bumpVersion(params))
+}
+
 func (c *EventCollection) DeleteByID(ctx context.Context, id primitive.ObjectID) (int64, error) {
 	params := bson.D{{Key: "_id", Value: id}}
 	result, err := c.eventCollection.DeleteOne(ctx, params)
@@ -84,17 +111,24 @@ func (c *EventCollection) DeleteByID(ctx context.Context, id primitive.ObjectID)
 	return result.DeletedCount, nil
 }
 
+func (c *EventCollection) DeleteMany(ctx context.Context, filter bson.D) (int64, error) {
+	result, err := c.eventCollection.DeleteMany(ctx, filter)
+	if err != nil {
+		return -1, err
+	}
+	return result.DeletedCount, nil
+}
+
 type EventController struct {
 	Collection func(name string, opts ...*options.CollectionOptions) EventCollectionInterface
 	URL        string
 }
 
-func NewE(client *mongo.Client, URL string) *EventController {
-	database := client.Database(databaseName)
+func NewE(database Database, URL string) *EventController {
 	return &EventController{
 		func(name string, opts ...*options.CollectionOptions) EventCollectionInterface {
 			return &EventCollection{
-				database.Collection(name, opts...),
+				database(name, opts...),
 			}
 		},
 		URL,
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Everything in the collections, including what is in the trash, for checking the references between them.
+// The documents are decoded one at a time from a cursor, with only the fields holding references, so that the collections are never loaded into memory whole.
+
+func eachDocument[T any](ctx context.Context, cursor *mongo.Cursor, err error, fn func(document T)) error {
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var document T
+		if err := cursor.Decode(&document); err != nil {
+			return err
+		}
+		fn(document)
+	}
+	return cursor.Err()
+}
+
+func projectFields(fields ...string) *options.FindOptions {
+	projection := bson.D{}
+	for _, field := range fields {
+		projection = append(projection, bson.E{Key: field, Value: 1})
+	}
+	return options.Find().SetProjection(projection)
+}
+
+func (c *UserController) UsersEach(ctx context.Context, fn func(user models.User)) error {
+	ctx, span := tracing.Start(ctx, "UserController.UsersEach")
+	defer span.End()
+	cursor, err := c.Collection(userCollection).Find(ctx, bson.D{}, projectFields("projects", "tasks", "events", "invites"))
+	return eachDocument(ctx, cursor, err, fn)
+}
+
+func (c *ProjectController) ProjectsEach(ctx context.Context, fn func(project models.Project)) error {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectsEach")
+	defer span.End()
+	cursor, err := c.Collection(projectCollection).Find(ctx, bson.D{}, projectFields("members", "applications", "tasks", "events", "deletedAt"))
+	return eachDocument(ctx, cursor, err, fn)
+}
+
+func (c *TaskController) TasksEach(ctx context.Context, fn func(task models.Task)) error {
+	ctx, span := tracing.Start(ctx, "TaskController.TasksEach")
+	defer span.End()
+	cursor, err := c.Collection(taskCollection).Find(ctx, bson.D{}, projectFields("assignedTo", "isPersonal", "projectid", "deletedAt"))
+	return eachDocument(ctx, cursor, err, fn)
+}
+
+func (c *EventController) EventsEach(ctx context.Context, fn func(event models.Event)) error {
+	ctx, span := tracing.Start(ctx, "EventController.EventsEach")
+	defer span.End()
+	cursor, err := c.Collection(eventCollection).Find(ctx, bson.D{}, projectFields("deletedAt"))
+	return eachDocument(ctx, cursor, err, fn)
+}
+
+// Sets the project of a task without one, such as a project task created before tasks recorded their project.
+func (c *TaskController) TaskSetProject(ctx context.Context, taskid, projectid string) error {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskSetProject")
+	defer span.End()
+	id, _ := primitive.ObjectIDFromHex(taskid)
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "projectid", Value: bson.D{{Key: "$in", Value: bson.A{"", nil}}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "projectid", Value: projectid}}}}
+	_, err := c.Collection(taskCollection).UpdateOne(ctx, filter, update)
+	return err
+}
+
+// Removes the users from the members of the project, without changing the projects of the users.
+func (c *ProjectController) ProjectRemoveMembers(ctx context.Context, id primitive.ObjectID, userids []string) error {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectRemoveMembers")
+	defer span.End()
+	unset := bson.D{}
+	for _, userid := range userids {
+		unset = append(unset, bson.E{Key: "members." + userid, Value: ""})
+	}
+	update := bson.D{{Key: "$unset", Value: unset}}
+	_, err := c.Collection(projectCollection).UpdateByID(ctx, id, update)
+	return err
+}
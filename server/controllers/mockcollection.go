@@ -65,7 +65,7 @@ func (c *MockCollection) UpdateManyByID(ctx context.Context, useridArr []primiti
 	return nil, nil
 }
 
-func (c *MockCollection) UpdateAll(ctx context.Context, params bson.D) (*mongo.UpdateResult, error) {
+func (c *MockCollection) UpdateMany(ctx context.Context, filter bson.D, params bson.D) (*mongo.UpdateResult, error) {
 	return nil, nil
 }
 
@@ -108,6 +108,7 @@ func (c *MockCollection) UpdateByID(ctx context.Context, id primitive.ObjectID,
 			user.ForgotPWPin = v.(string)
 		}
 	}
+	user.Version++
 	return &mongo.UpdateResult{
 		MatchedCount:  1,
 		ModifiedCount: 1,
@@ -116,6 +117,13 @@ func (c *MockCollection) UpdateByID(ctx context.Context, id primitive.ObjectID,
 	}, nil
 }
 
+func (c *MockCollection) UpdateByVersion(ctx context.Context, id primitive.ObjectID, version int64, params bson.D) (*mongo.UpdateResult, error) {
+	if user, ok := c.Data[id]; !ok || user.Version != version {
+		return &mongo.UpdateResult{}, nil
+	}
+	return c.UpdateByID(ctx, id, params)
+}
+
 func (c *MockCollection) DeleteByID(ctx context.Context, id string) (int64, error) {
 	objectId, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -129,6 +137,17 @@ func (c *MockCollection) DeleteByID(ctx context.Context, id string) (int64, erro
 	return 1, nil
 }
 
+func (c *MockCollection) DeleteByVersion(ctx context.Context, id string, version int64) (int64, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return 0, nil
+	}
+	if user, ok := c.Data[objectId]; !ok || user.Version != version {
+		return 0, nil
+	}
+	return c.DeleteByID(ctx, id)
+}
+
 func (c *MockCollection) Aggregate(ctx context.Context, pipeline interface{},
 	opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
 	return nil, nil
@@ -2,13 +2,13 @@ package controllers
 
 import (
 	"context"
-	"errors"
 	"time"
 
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
 	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 const (
@@ -17,9 +17,11 @@ const (
 
 // Returns the project associated with the id
 func (c *ProjectController) ProjectRetrieve(ctx context.Context, id string) (models.Project, error) {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectRetrieve")
+	defer span.End()
 	var project models.Project
 	if id == "" {
-		return project, errors.New("cannot leave both id and name empty")
+		return project, errs.Validation("cannot leave both id and name empty")
 	}
 	_, err := c.Collection(projectCollection).FindOne(ctx, &project, id)
 
@@ -27,6 +29,8 @@ func (c *ProjectController) ProjectRetrieve(ctx context.Context, id string) (mod
 }
 
 func (c *ProjectController) ProjectCreate(ctx context.Context, project *models.Project, userid string) error {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectCreate")
+	defer span.End()
 
 	project.Members = map[string]string{
 		userid: "admin",
@@ -50,6 +54,8 @@ func (c *ProjectController) ProjectCreate(ctx context.Context, project *models.P
 
 // Deletes the project.
 func (c *ProjectController) ProjectDelete(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectDelete")
+	defer span.End()
 	_, err := c.Collection(projectCollection).DeleteByID(ctx, id)
 	if err != nil {
 		return err
@@ -57,8 +63,11 @@ func (c *ProjectController) ProjectDelete(ctx context.Context, id string) error
 	return nil
 }
 
-// Updates
-func (c *ProjectController) ProjectModifyGeneral(ctx context.Context, Id primitive.ObjectID, Name, Description *string, IsPublic *bool) {
+// Updates the name, description and visibility of the project.
+// If version is not nil, the project is only modified if it is still at the version, else a precondition error is returned.
+func (c *ProjectController) ProjectModifyGeneral(ctx context.Context, Id primitive.ObjectID, version *int64, Name, Description *string, IsPublic *bool) error {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectModifyGeneral")
+	defer span.End()
 	params := bson.D{}
 	if Name != nil {
 		params = append(params, bson.E{Key: "name", Value: *Name})
@@ -70,34 +79,129 @@ func (c *ProjectController) ProjectModifyGeneral(ctx context.Context, Id primiti
 		params = append(params, bson.E{Key: "isPublic", Value: *IsPublic})
 	}
 	update := bson.D{{Key: "$set", Value: params}}
-	c.Collection(projectCollection).UpdateByID(ctx, Id, update)
+	if version == nil {
+		_, err := c.Collection(projectCollection).UpdateByID(ctx, Id, update)
+		return err
+	}
+	result, err := c.Collection(projectCollection).UpdateByVersion(ctx, Id, *version, update)
+	return checkVersion(result, err, "project")
+}
+
+// Archives the project, making it read-only, or unarchives it.
+func (c *ProjectController) ProjectArchive(ctx context.Context, Id primitive.ObjectID, isArchived bool) error {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectArchive")
+	defer span.End()
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "isArchived", Value: isArchived}}}}
+	_, err := c.Collection(projectCollection).UpdateByID(ctx, Id, update)
+	return err
+}
+
+// Replaces the workflow states (task board columns) of the project.
+func (c *ProjectController) ProjectModifyStates(ctx context.Context, Id primitive.ObjectID, states []models.WorkflowState) error {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectModifyStates")
+	defer span.End()
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "settings.states", Value: states}}}}
+	_, err := c.Collection(projectCollection).UpdateByID(ctx, Id, update)
+	return err
+}
+
+// Replaces all settings of the project, such as when it is created from a template.
+func (c *ProjectController) ProjectModifySettings(ctx context.Context, Id primitive.ObjectID, settings models.ProjectSettings) error {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectModifySettings")
+	defer span.End()
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "settings", Value: settings}}}}
+	_, err := c.Collection(projectCollection).UpdateByID(ctx, Id, update)
+	return err
+}
+
+// Replaces the upload limits for attachments of the project.
+func (c *ProjectController) ProjectModifyAttachmentLimits(ctx context.Context, Id primitive.ObjectID, limits models.AttachmentLimits) error {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectModifyAttachmentLimits")
+	defer span.End()
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "settings.attachments", Value: limits}}}}
+	_, err := c.Collection(projectCollection).UpdateByID(ctx, Id, update)
+	return err
 }
 
 func (c *ProjectController) ProjectModifyTask(ctx context.Context, project *models.Project) {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectModifyTask")
+	defer span.End()
 	params := bson.D{}
 	params = append(params, bson.E{Key: "tasks", Value: project.Tasks})
 	update := bson.D{{Key: "$set", Value: params}}
 	c.Collection(projectCollection).UpdateByID(ctx, project.Id, update)
 }
 
-func (c *ProjectController) ProjectModifyUser(ctx context.Context, project *models.Project) {
+func (c *ProjectController) ProjectModifyUser(ctx context.Context, project *models.Project) error {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectModifyUser")
+	defer span.End()
 	params := bson.D{}
 	params = append(params, bson.E{Key: "members", Value: project.Members})
 	update := bson.D{{Key: "$set", Value: params}}
-	c.Collection(projectCollection).UpdateByID(ctx, project.Id, update)
+	_, err := c.Collection(projectCollection).UpdateByID(ctx, project.Id, update)
+	return err
+}
+
+// Returns the project the task belongs to, or nil for personal tasks.
+// Tasks created before they recorded their projectid are found through the tasks of the projects.
+func (c *ProjectController) ProjectOfTask(ctx context.Context, task models.Task) (*models.Project, error) {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectOfTask")
+	defer span.End()
+	if task.ProjectId != "" {
+		project, err := c.ProjectRetrieve(ctx, task.ProjectId)
+		if err != nil {
+			return nil, errs.OrNotFound(err, "project does not exist")
+		}
+		return &project, nil
+	}
+	if task.IsPersonal {
+		return nil, nil
+	}
+	filter := bson.D{{Key: "tasks", Value: task.Id.Hex()}, notDeleted}
+	cursor, err := c.Collection(projectCollection).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	projects := []models.Project{}
+	if err := cursor.All(ctx, &projects); err != nil {
+		return nil, err
+	}
+	if len(projects) == 0 {
+		return nil, errs.NotFound("project does not exist")
+	}
+	return &projects[0], nil
+}
+
+// Add multiple tasks to project.Tasks
+func (c *ProjectController) ProjectAddTasks(ctx context.Context, projectId string, taskIds []string) error {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectAddTasks")
+	defer span.End()
+	update := bson.D{
+		{Key: "$addToSet", Value: bson.D{
+			{Key: "tasks", Value: bson.D{{Key: "$each", Value: taskIds}}},
+		}},
+	}
+	id, _ := primitive.ObjectIDFromHex(projectId)
+	_, err := c.Collection(projectCollection).UpdateByID(ctx, id, update)
+	return err
 }
 
 // Delete multiple tasks from project.Tasks
-func (c *ProjectController) ProjectDeleteTasks(ctx context.Context, projectId string, taskIds []string) {
+func (c *ProjectController) ProjectDeleteTasks(ctx context.Context, projectId string, taskIds []string) error {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectDeleteTasks")
+	defer span.End()
 	params := bson.D{}
 	params = append(params, bson.E{Key: "tasks", Value: bson.D{{Key: "$in", Value: taskIds}}})
 	update := bson.D{{Key: "$pull", Value: params}}
 	id, _ := primitive.ObjectIDFromHex(projectId)
-	c.Collection(projectCollection).UpdateByID(ctx, id, update)
+	_, err := c.Collection(projectCollection).UpdateByID(ctx, id, update)
+	return err
 }
 
 // if the same user applies multiple times, it will override the previous application
 func (c *ProjectController) ProjectAddAppl(ctx context.Context, projectId, userId, description string) {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectAddAppl")
+	defer span.End()
 	application := models.ProjectApplication{
 		Id:          userId,
 		Description: description,
@@ -108,6 +212,8 @@ func (c *ProjectController) ProjectAddAppl(ctx context.Context, projectId, userI
 }
 
 func (c *ProjectController) ProjectRemoveAppl(ctx context.Context, projectId string, userIds []string) {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectRemoveAppl")
+	defer span.End()
 	unsetIds := bson.D{}
 	for _, id := range userIds {
 		unsetIds = append(unsetIds, bson.E{Key: "applications." + id, Value: ""})
@@ -118,6 +224,8 @@ func (c *ProjectController) ProjectRemoveAppl(ctx context.Context, projectId str
 }
 
 func (c *ProjectController) ProjectAddUsers(ctx context.Context, projectId string, project *models.Project) {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectAddUsers")
+	defer span.End()
 	params := bson.D{}
 	params = append(params, bson.E{Key: "members", Value: project.Members})
 	update := bson.D{{Key: "$set", Value: params}}
@@ -126,6 +234,8 @@ func (c *ProjectController) ProjectAddUsers(ctx context.Context, projectId strin
 }
 
 func (c *ProjectController) ProjectArrayToModel(ctx context.Context, Projects []string) []models.Project {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectArrayToModel")
+	defer span.End()
 	projectsArray := []models.Project{}
 	projectidArr := []primitive.ObjectID{}
 
@@ -139,6 +249,8 @@ func (c *ProjectController) ProjectArrayToModel(ctx context.Context, Projects []
 }
 
 func (c *ProjectController) ProjectAddEvents(ctx context.Context, projectid string, eventids []string) {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectAddEvents")
+	defer span.End()
 	update := bson.D{
 		{Key: "$addToSet", Value: bson.D{
 			{Key: "events", Value: bson.D{{Key: "$each", Value: eventids}}},
@@ -149,6 +261,8 @@ func (c *ProjectController) ProjectAddEvents(ctx context.Context, projectid stri
 }
 
 func (c *ProjectController) ProjectRemoveEvents(ctx context.Context, projectid primitive.ObjectID, eventids []string) {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectRemoveEvents")
+	defer span.End()
 	update := bson.D{
 		{Key: "$pull", Value: bson.D{
 			{Key: "events", Value: bson.D{{Key: "$in", Value: eventids}}},
@@ -159,6 +273,7 @@ func (c *ProjectController) ProjectRemoveEvents(ctx context.Context, projectid p
 
 /*
 Define search index in Atlas for better autocomplete performance.
+Without Atlas Search, set search_provider to "embedded" instead.
 
 https://www.mongodb.com/docs/atlas/atlas-search/tutorial/autocomplete-tutorial/
 https://www.mongodb.com/docs/atlas/atlas-search/autocomplete/
@@ -189,6 +304,8 @@ index name: autoCompleteProjects
 */
 
 func (c *ProjectController) ProjectSearch(ctx context.Context, userid, query string) ([]bson.D, error) {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectSearch")
+	defer span.End()
 	const searchLimit = 10
 	if query == "" {
 		// autocomplete.query cannot be empty!
@@ -196,62 +313,21 @@ func (c *ProjectController) ProjectSearch(ctx context.Context, userid, query str
 		return []bson.D{}, nil
 	}
 
-	searchStage := bson.D{
-		{
-			Key: "$search",
-			Value: bson.D{
-				{Key: "index", Value: "autoCompleteProjects"},
-				{Key: "autocomplete", Value: bson.D{
-					{Key: "path", Value: "name"},
-					{Key: "query", Value: query},
-					{Key: "tokenOrder", Value: "sequential"},
-					{Key: "fuzzy", Value: bson.D{
-						{Key: "maxEdits", Value: 1},
-						{Key: "prefixLength", Value: 1},
-						{Key: "maxExpansions", Value: 256},
-					}},
-				}},
-			},
-		},
-	}
-	// could not get this to work with a compound search
-	// so opted to make it an extra stage instead
-	filterStage := bson.D{
-		{Key: "$match", Value: bson.D{
+	return c.searchProvider().Search(ctx, c.Collection(projectCollection), projectNameSearch, SearchRequest{
+		Query: query,
+		Filter: bson.D{
 			{Key: "isPublic", Value: true},
+			{Key: "isArchived", Value: bson.D{{Key: "$ne", Value: true}}},
+			notDeleted,
 			// filter out the projects where the user is already a member of
 			{Key: "members." + userid, Value: bson.D{{Key: "$exists", Value: false}}},
-		}},
-	}
-	limitStage := bson.D{
-		{Key: "$limit", Value: searchLimit},
-	}
-	projectStage := bson.D{
-		{
-			Key: "$project",
-			Value: bson.D{
-				{Key: "_id", Value: 0},     /* hide _id field */
-				{Key: "id", Value: "$_id"}, /* create a id field that is _id's value (essentially renaming the field) */
-				{Key: "name", Value: 1},
-				{Key: "description", Value: 1},
-			},
 		},
-	}
-
-	// run pipeline
-	cursor, err := c.Collection(projectCollection).Aggregate(ctx, mongo.Pipeline{searchStage, filterStage, limitStage, projectStage})
-
-	var results []bson.D
-	if err != nil {
-		return nil, err
-	}
-
-	if cursor == nil {
-		return results, errors.New("check server project controller")
-	}
-	if err = cursor.All(ctx, &results); err != nil {
-		return results, err
-	}
-
-	return results, nil
+		Limit: searchLimit,
+		Projection: bson.D{
+			{Key: "_id", Value: 0},     /* hide _id field */
+			{Key: "id", Value: "$_id"}, /* create a id field that is _id's value (essentially renaming the field) */
+			{Key: "name", Value: 1},
+			{Key: "description", Value: 1},
+		},
+	})
 }
@@ -2,8 +2,8 @@ package controllers
 
 import (
 	"context"
-	"errors"
 
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
 	"github.com/OrgaNiUS/OrgaNiUS/server/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -12,19 +12,26 @@ import (
 )
 
 type ProjectCollectionInterface interface {
-	// Find one project by id or name
+	// Find one project by id or name, excluding projects in the trash
 	FindOne(ctx context.Context, project *models.Project, id string) (*models.Project, error)
 
-	// Find All projects in id array
+	// Find All projects in id array, excluding projects in the trash
 	FindAll(ctx context.Context, projectidArr []primitive.ObjectID, ProjectArr *[]models.Project) error
 
+	// Find all projects matching the filter
+	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
+
 	// Insert a new project into the database
 	// Returns the object ID
 	InsertOne(ctx context.Context, project *models.Project) (primitive.ObjectID, error)
 
 	// Modifies a project by ID
+	// Every update increments the version of the project.
 	UpdateByID(ctx context.Context, id primitive.ObjectID, params bson.D) (*mongo.UpdateResult, error)
 
+	// Modifies a project by ID only if it is at the version
+	UpdateByVersion(ctx context.Context, id primitive.ObjectID, version int64, params bson.D) (*mongo.UpdateResult, error)
+
 	// Deletes a project by ID
 	DeleteByID(ctx context.Context, id string) (int64, error)
 
@@ -32,7 +39,7 @@ type ProjectCollectionInterface interface {
 }
 
 type ProjectCollection struct {
-	projectCollection *mongo.Collection
+	projectCollection MongoCollection
 }
 
 func (c *ProjectCollection) FindOne(ctx context.Context, project *models.Project, id string) (*models.Project, error) {
@@ -41,7 +48,7 @@ func (c *ProjectCollection) FindOne(ctx context.Context, project *models.Project
 		project = &models.Project{}
 	}
 	if id == "" {
-		return project, errors.New("cannot leave all params blank")
+		return project, errs.Validation("cannot leave all params blank")
 	}
 	params := []interface{}{}
 	if id != "" {
@@ -51,13 +58,13 @@ func (c *ProjectCollection) FindOne(ctx context.Context, project *models.Project
 		}
 		params = append(params, bson.D{{Key: "_id", Value: objectId}})
 	}
-	filter := bson.D{{Key: "$or", Value: params}}
+	filter := bson.D{{Key: "$or", Value: params}, notDeleted}
 	err := c.projectCollection.FindOne(ctx, filter).Decode(&project)
 	return project, err
 }
 
 func (c *ProjectCollection) FindAll(ctx context.Context, projectidArr []primitive.ObjectID, ProjectArr *[]models.Project) error {
-	cur, err := c.projectCollection.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: projectidArr}}}})
+	cur, err := c.projectCollection.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: projectidArr}}}, notDeleted})
 	if err != nil {
 		return err
 	}
@@ -65,6 +72,10 @@ func (c *ProjectCollection) FindAll(ctx context.Context, projectidArr []primitiv
 	return nil
 }
 
+func (c *ProjectCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	return c.projectCollection.Find(ctx, filter, opts...)
+}
+
 func (c *ProjectCollection) InsertOne(ctx context.Context, project *models.Project) (primitive.ObjectID, error) {
 	result, err := c.projectCollection.InsertOne(ctx, project)
 	if err != nil {
@@ -75,13 +86,17 @@ func (c *ProjectCollection) InsertOne(ctx context.Context, project *models.Proje
 }
 
 func (c *ProjectCollection) UpdateByID(ctx context.Context, id primitive.ObjectID, params bson.D) (*mongo.UpdateResult, error) {
-	result, err := c.projectCollection.UpdateByID(ctx, id, params)
+	result, err := c.projectCollection.UpdateByID(ctx, id, bumpVersion(params))
 	if err != nil {
 		return nil, err
 	}
 	return result, err
 }
 
+func (c *ProjectCollection) UpdateByVersion(ctx context.Context, id primitive.ObjectID, version int64, params bson.D) (*mongo.UpdateResult, error) {
+	return c.projectCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: id}, atVersion(version)}, bumpVersion(params))
+}
+
 func (c *ProjectCollection) DeleteByID(ctx context.Context, id string) (int64, error) {
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
@@ -103,16 +118,24 @@ func (c *ProjectCollection) Aggregate(ctx context.Context, pipeline interface{},
 type ProjectController struct {
 	Collection func(name string, opts ...*options.CollectionOptions) ProjectCollectionInterface
 	URL        string
+	Search     SearchProvider // Atlas Search if nil
 }
 
-func NewP(client *mongo.Client, URL string) *ProjectController {
-	database := client.Database(databaseName) // databaseName declared in userControllers
+func NewP(database Database, URL string, search SearchProvider) *ProjectController {
 	return &ProjectController{
 		func(name string, opts ...*options.CollectionOptions) ProjectCollectionInterface {
 			return &ProjectCollection{
-				database.Collection(name, opts...),
+				database(name, opts...),
 			}
 		},
 		URL,
+		search,
+	}
+}
+
+func (c *ProjectController) searchProvider() SearchProvider {
+	if c.Search == nil {
+		return AtlasSearch{}
 	}
+	return c.Search
 }
@@ -0,0 +1,282 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/search"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// A field that is searched for autocomplete.
+type SearchField struct {
+	Collection string
+	Index      string // name of the Atlas Search index
+	Path       string // a top level field holding text
+}
+
+var (
+	projectNameSearch = SearchField{projectCollection, "autoCompleteProjects", "name"}
+	userNameSearch    = SearchField{userCollection, "autoCompleteUsers", "name"}
+)
+
+// The fields searched by the controllers.
+var SearchFields = []SearchField{projectNameSearch, userNameSearch}
+
+// How queries match the names, the same as the autocomplete operator of the Atlas Search indexes.
+var autocomplete = search.Options{Autocomplete: true, Sequential: true, MaxEdits: 1, PrefixLength: 1}
+
+type SearchRequest struct {
+	Query      string
+	Filter     bson.D // only the matching documents are returned
+	Limit      int
+	Projection bson.D
+}
+
+type SearchCollection interface {
+	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
+	Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error)
+}
+
+// Finds documents by a field for autocomplete.
+type SearchProvider interface {
+	// Returns the documents of the collection matching the request, best first.
+	Search(ctx context.Context, collection SearchCollection, field SearchField, request SearchRequest) ([]bson.D, error)
+	// Checks that the fields can be searched, returning an error describing what is missing if not.
+	CheckIndexes(ctx context.Context, database Database, fields []SearchField) error
+}
+
+// Searches with the $search stage of Atlas Search, which needs an index defined in Atlas for each field.
+// The zero value is ready to use.
+type AtlasSearch struct{}
+
+func (AtlasSearch) Search(ctx context.Context, collection SearchCollection, field SearchField, request SearchRequest) ([]bson.D, error) {
+	searchStage := bson.D{
+		{
+			Key: "$search",
+			Value: bson.D{
+				{Key: "index", Value: field.Index},
+				{Key: "autocomplete", Value: bson.D{
+					{Key: "path", Value: field.Path},
+					{Key: "query", Value: request.Query},
+					{Key: "tokenOrder", Value: "sequential"},
+					{Key: "fuzzy", Value: bson.D{
+						{Key: "maxEdits", Value: autocomplete.MaxEdits},
+						{Key: "prefixLength", Value: autocomplete.PrefixLength},
+						{Key: "maxExpansions", Value: 256},
+					}},
+				}},
+			},
+		},
+	}
+	// could not get this to work with a compound search
+	// so opted to make it an extra stage instead
+	filterStage := bson.D{{Key: "$match", Value: request.Filter}}
+	limitStage := bson.D{{Key: "$limit", Value: request.Limit}}
+	projectStage := bson.D{{Key: "$project", Value: request.Projection}}
+
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{searchStage, filterStage, limitStage, projectStage})
+	if err != nil {
+		return nil, err
+	}
+	if cursor == nil {
+		return nil, errs.Internal(errors.New("search provider is not configured"))
+	}
+	results := []bson.D{}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// Checks that the Atlas Search indexes exist and can be queried.
+// Collections kept in memory are skipped, as they emulate $search.
+func (AtlasSearch) CheckIndexes(ctx context.Context, database Database, fields []SearchField) error {
+	for _, field := range fields {
+		collection := database(field.Collection)
+		if _, ok := collection.(interface{ Indexes() mongo.IndexView }); !ok {
+			continue
+		}
+		stage := bson.D{{Key: "$listSearchIndexes", Value: bson.D{{Key: "name", Value: field.Index}}}}
+		cursor, err := collection.Aggregate(ctx, mongo.Pipeline{stage})
+		if err != nil {
+			return fmt.Errorf("cannot list the Atlas Search indexes of %v, use the embedded search provider if this is not Atlas: %w", field.Collection, err)
+		}
+		var indexes []struct {
+			Queryable *bool `bson:"queryable"`
+		}
+		if err := cursor.All(ctx, &indexes); err != nil {
+			return err
+		}
+		if len(indexes) == 0 {
+			return fmt.Errorf("the Atlas Search index %v on %v.%v does not exist", field.Index, field.Collection, field.Path)
+		}
+		if indexes[0].Queryable != nil && !*indexes[0].Queryable {
+			return fmt.Errorf("the Atlas Search index %v on %v.%v is not ready", field.Index, field.Collection, field.Path)
+		}
+	}
+	return nil
+}
+
+// Searches an index of edge n-grams kept in memory, for deployments without Atlas Search.
+// Each index is loaded from its collection when first searched, and reloaded once it is older than the refresh interval,
+// so new and renamed documents can take that long to be found. Deleted documents are never returned, as the results are filtered in the database.
+type EmbeddedSearch struct {
+	refresh time.Duration
+
+	mu      sync.Mutex
+	indexes map[SearchField]*embeddedIndex
+}
+
+type embeddedIndex struct {
+	mu     sync.Mutex
+	index  *search.Index
+	ids    map[string]interface{} // the _id of each document in the index
+	loaded time.Time
+}
+
+func NewEmbeddedSearch(refresh time.Duration) *EmbeddedSearch {
+	return &EmbeddedSearch{
+		refresh: refresh,
+		indexes: map[SearchField]*embeddedIndex{},
+	}
+}
+
+// The key of an _id in the index.
+func searchKey(id interface{}) string {
+	if objectID, ok := id.(primitive.ObjectID); ok {
+		return objectID.Hex()
+	}
+	return fmt.Sprint(id)
+}
+
+func (s *EmbeddedSearch) load(ctx context.Context, collection SearchCollection, field SearchField, index *embeddedIndex) error {
+	opts := options.Find().SetProjection(bson.D{{Key: field.Path, Value: 1}})
+	cursor, err := collection.Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return err
+	}
+	var documents []bson.M
+	if err := cursor.All(ctx, &documents); err != nil {
+		return err
+	}
+	texts := map[string]string{}
+	ids := map[string]interface{}{}
+	for _, document := range documents {
+		text, ok := document[field.Path].(string)
+		if !ok {
+			continue
+		}
+		key := searchKey(document["_id"])
+		texts[key] = text
+		ids[key] = document["_id"]
+	}
+	if index.index == nil {
+		// the same grams as the Atlas Search indexes
+		index.index = search.NewIndex(2, 15)
+	}
+	index.index.Replace(texts)
+	index.ids = ids
+	index.loaded = time.Now()
+	return nil
+}
+
+// Returns the index of the field, loading it if it is missing or out of date.
+func (s *EmbeddedSearch) index(ctx context.Context, collection SearchCollection, field SearchField) (*embeddedIndex, error) {
+	s.mu.Lock()
+	index, ok := s.indexes[field]
+	if !ok {
+		index = &embeddedIndex{}
+		s.indexes[field] = index
+	}
+	s.mu.Unlock()
+
+	index.mu.Lock()
+	defer index.mu.Unlock()
+	if index.index != nil && time.Since(index.loaded) < s.refresh {
+		return index, nil
+	}
+	if err := s.load(ctx, collection, field, index); err != nil {
+		if index.index == nil {
+			return nil, err
+		}
+		// an out of date index is better than none
+		slog.WarnContext(ctx, "error reloading the search index", "collection", field.Collection, "path", field.Path, "error", err)
+	}
+	return index, nil
+}
+
+func (s *EmbeddedSearch) Search(ctx context.Context, collection SearchCollection, field SearchField, request SearchRequest) ([]bson.D, error) {
+	index, err := s.index(ctx, collection, field)
+	if err != nil {
+		return nil, err
+	}
+	index.mu.Lock()
+	keys := index.index.Search(request.Query, autocomplete)
+	rank := map[string]int{}
+	ids := bson.A{}
+	for i, key := range keys {
+		rank[key] = i
+		ids = append(ids, index.ids[key])
+	}
+	index.mu.Unlock()
+	if len(ids) == 0 {
+		return []bson.D{}, nil
+	}
+
+	// the _id is kept under another name, as the projection may hide or rename it
+	const idField = "_searchid"
+	filterStage := bson.D{{Key: "$match", Value: bson.D{
+		{Key: "$and", Value: bson.A{
+			bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}},
+			request.Filter,
+		}},
+	}}}
+	projection := append(bson.D{}, request.Projection...)
+	projection = append(projection, bson.E{Key: idField, Value: "$_id"})
+	projectStage := bson.D{{Key: "$project", Value: projection}}
+
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{filterStage, projectStage})
+	if err != nil {
+		return nil, err
+	}
+	var documents []bson.D
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, err
+	}
+
+	ranked := make([]bson.D, len(keys))
+	for _, document := range documents {
+		for i, e := range document {
+			if e.Key == idField {
+				ranked[rank[searchKey(e.Value)]] = append(document[:i:i], document[i+1:]...)
+				break
+			}
+		}
+	}
+	results := []bson.D{}
+	for _, document := range ranked {
+		if document != nil && len(results) < request.Limit {
+			results = append(results, document)
+		}
+	}
+	return results, nil
+}
+
+// Loads the index of each field, so that the first searches are not slowed by it.
+func (s *EmbeddedSearch) CheckIndexes(ctx context.Context, database Database, fields []SearchField) error {
+	for _, field := range fields {
+		if _, err := s.index(ctx, database(field.Collection), field); err != nil {
+			return fmt.Errorf("cannot load the search index of %v.%v: %w", field.Collection, field.Path, err)
+		}
+	}
+	return nil
+}
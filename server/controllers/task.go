@@ -2,23 +2,29 @@ package controllers
 
 import (
 	"context"
-	"errors"
+	"sort"
 	"time"
 
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
 	"github.com/OrgaNiUS/OrgaNiUS/server/functions"
 	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 const (
-	taskCollection = "tasks"
+	taskCollection         = "tasks"
+	taskActivityCollection = "taskActivities"
 )
 
 func (c *TaskController) TaskRetrieve(ctx context.Context, id string) (models.Task, error) {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskRetrieve")
+	defer span.End()
 	var task models.Task
 	if id == "" {
-		return task, errors.New("cannot leave task id empty")
+		return task, errs.Validation("cannot leave task id empty")
 	}
 	_, err := c.Collection(taskCollection).FindOne(ctx, &task, id)
 
@@ -26,8 +32,17 @@ func (c *TaskController) TaskRetrieve(ctx context.Context, id string) (models.Ta
 }
 
 func (c *TaskController) TaskCreate(ctx context.Context, task *models.Task) error {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskCreate")
+	defer span.End()
 	task.CreationTime = time.Now()
 	task.IsDone = false
+	task.NextCreated = false
+	if task.Recurrence != nil && task.SeriesId == "" {
+		// first task of a new series, the series is identified by this task's id
+		task.Id = primitive.NewObjectID()
+		task.SeriesId = task.Id.Hex()
+		task.Recurrence.Anchor(task.Deadline)
+	}
 	id, err := c.Collection(taskCollection).InsertOne(ctx, task)
 
 	if err != nil {
@@ -38,7 +53,17 @@ func (c *TaskController) TaskCreate(ctx context.Context, task *models.Task) erro
 	return nil
 }
 
-func (c *TaskController) TaskModify(ctx context.Context, taskid primitive.ObjectID, name, description, deadline *string, isdone *bool, addAssignedTo, removeAssignedTo, addTags, removeTags *[]string) {
+// Modifies a task on behalf of userid.
+// Changes to the name, deadline, estimate, assignees, tags and isDone are recorded in the task's activity history.
+// If version is not nil, the task is only modified if it is still at the version, else a precondition error is returned.
+func (c *TaskController) TaskModify(ctx context.Context, userid string, taskid primitive.ObjectID, version *int64, name, description, deadline *string, isdone *bool, estimate *int, addAssignedTo, removeAssignedTo, addTags, removeTags *[]string) error {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskModify")
+	defer span.End()
+	var old models.Task
+	if _, err := c.Collection(taskCollection).FindOne(ctx, &old, taskid.Hex()); err != nil {
+		return err
+	}
+
 	setParams := bson.D{}
 	if name != nil {
 		setParams = append(setParams, bson.E{Key: "name", Value: *name})
@@ -46,13 +71,17 @@ func (c *TaskController) TaskModify(ctx context.Context, taskid primitive.Object
 	if description != nil {
 		setParams = append(setParams, bson.E{Key: "description", Value: *description})
 	}
+	var parsedDeadline time.Time
 	if deadline != nil {
-		parsedDeadline, _ := functions.StringToTime(*deadline)
+		parsedDeadline, _ = functions.StringToTime(*deadline)
 		setParams = append(setParams, bson.E{Key: "deadline", Value: parsedDeadline})
 	}
 	if isdone != nil {
 		setParams = append(setParams, bson.E{Key: "isDone", Value: *isdone})
 	}
+	if estimate != nil {
+		setParams = append(setParams, bson.E{Key: "estimate", Value: *estimate})
+	}
 
 	addParams := bson.D{}
 	if addAssignedTo != nil {
@@ -81,11 +110,217 @@ func (c *TaskController) TaskModify(ctx context.Context, taskid primitive.Object
 		{Key: "$pull", Value: removeParams},
 	}
 
-	c.Collection(taskCollection).UpdateByID(ctx, taskid, update)
-	c.Collection(taskCollection).UpdateByID(ctx, taskid, pullUpdate)
+	if version == nil {
+		if _, err := c.Collection(taskCollection).UpdateByID(ctx, taskid, update); err != nil {
+			return err
+		}
+	} else {
+		result, err := c.Collection(taskCollection).UpdateByVersion(ctx, taskid, *version, update)
+		if err := checkVersion(result, err, "task"); err != nil {
+			return err
+		}
+	}
+	// the version was incremented by the first update, so no other conditional update can come in between
+	if len(removeParams) > 0 {
+		if _, err := c.Collection(taskCollection).UpdateByID(ctx, taskid, pullUpdate); err != nil {
+			return err
+		}
+	}
+
+	// record what changed
+	now := time.Now()
+	activities := []*models.TaskActivity{}
+	record := func(field string, oldValue, newValue interface{}) {
+		activities = append(activities, &models.TaskActivity{
+			TaskId: taskid.Hex(),
+			UserId: userid,
+			Field:  field,
+			Old:    oldValue,
+			New:    newValue,
+			Time:   now,
+		})
+	}
+	if name != nil && *name != old.Name {
+		record("name", old.Name, *name)
+	}
+	if deadline != nil && !parsedDeadline.Equal(old.Deadline) {
+		record("deadline", old.Deadline, parsedDeadline)
+	}
+	if isdone != nil && *isdone != old.IsDone {
+		record("isDone", old.IsDone, *isdone)
+	}
+	if estimate != nil && *estimate != old.Estimate {
+		record("estimate", old.Estimate, *estimate)
+	}
+	if newAssignedTo, changed := applyDelta(old.AssignedTo, addAssignedTo, removeAssignedTo); changed {
+		record("assignedTo", old.AssignedTo, newAssignedTo)
+	}
+	if newTags, changed := applyDelta(old.Tags, addTags, removeTags); changed {
+		record("tags", old.Tags, newTags)
+	}
+	if len(activities) == 0 {
+		return nil
+	}
+	return c.ActivityCollection(taskActivityCollection).InsertMany(ctx, activities)
+}
+
+// Applies the same $addToSet and $pull as TaskModify to a string array.
+// Returns the resulting array and whether it differs from the original.
+func applyDelta(arr []string, add, remove *[]string) ([]string, bool) {
+	result := append([]string{}, arr...)
+	if add != nil {
+		for _, s := range *add {
+			if !contains(result, s) {
+				result = append(result, s)
+			}
+		}
+	}
+	if remove != nil {
+		kept := []string{}
+		for _, s := range result {
+			if !contains(*remove, s) {
+				kept = append(kept, s)
+			}
+		}
+		result = kept
+	}
+	if len(result) != len(arr) {
+		return result, true
+	}
+	for i := range result {
+		if result[i] != arr[i] {
+			return result, true
+		}
+	}
+	return result, false
+}
+
+func contains(arr []string, s string) bool {
+	for _, x := range arr {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the activity history of a task, oldest first.
+func (c *TaskController) TaskActivity(ctx context.Context, taskid string) ([]models.TaskActivity, error) {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskActivity")
+	defer span.End()
+	activities := []models.TaskActivity{}
+	err := c.ActivityCollection(taskActivityCollection).FindAll(ctx, taskid, &activities)
+	return activities, err
+}
+
+// Permanently deletes the activity history of the tasks.
+func (c *TaskController) TaskActivityDelete(ctx context.Context, taskids []string) error {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskActivityDelete")
+	defer span.End()
+	params := bson.D{{Key: "taskid", Value: bson.D{{Key: "$in", Value: taskids}}}}
+	_, err := c.ActivityCollection(taskActivityCollection).DeleteMany(ctx, params)
+	return err
+}
+
+// Marks that the next instance of a recurring task is being created.
+// Returns false if it was already marked, so that each instance only creates one successor.
+func (c *TaskController) TaskClaimNext(ctx context.Context, taskid primitive.ObjectID) (bool, error) {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskClaimNext")
+	defer span.End()
+	filter := bson.D{
+		{Key: "_id", Value: taskid},
+		{Key: "nextCreated", Value: bson.D{{Key: "$ne", Value: true}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "nextCreated", Value: true}}}}
+	result, err := c.Collection(taskCollection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// Returns the recurring tasks whose deadline has passed without the next instance being created.
+func (c *TaskController) TaskFindOverdueRecurring(ctx context.Context, now time.Time) ([]models.Task, error) {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskFindOverdueRecurring")
+	defer span.End()
+	filter := bson.D{
+		{Key: "recurrence", Value: bson.D{{Key: "$exists", Value: true}}},
+		{Key: "nextCreated", Value: bson.D{{Key: "$ne", Value: true}}},
+		{Key: "deadline", Value: bson.D{{Key: "$lt", Value: now}, {Key: "$gt", Value: time.Time{}}}},
+		notDeleted,
+	}
+	cursor, err := c.Collection(taskCollection).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	tasks := []models.Task{}
+	if err := cursor.All(ctx, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// Modifies every instance of a series that is not done yet.
+// Completed instances are left untouched as a record of what was done.
+func (c *TaskController) TaskSeriesModify(ctx context.Context, seriesid string, name, description *string, addTags, removeTags *[]string, recurrence *models.Recurrence) error {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskSeriesModify")
+	defer span.End()
+	if seriesid == "" {
+		return errs.Conflict("task is not part of a series")
+	}
+	filter := bson.D{
+		{Key: "seriesid", Value: seriesid},
+		{Key: "isDone", Value: false},
+	}
+	setParams := bson.D{}
+	if name != nil {
+		setParams = append(setParams, bson.E{Key: "name", Value: *name})
+	}
+	if description != nil {
+		setParams = append(setParams, bson.E{Key: "description", Value: *description})
+	}
+	if recurrence != nil {
+		setParams = append(setParams, bson.E{Key: "recurrence", Value: *recurrence})
+	}
+	addParams := bson.D{}
+	if addTags != nil {
+		addParams = append(addParams, bson.E{Key: "tags", Value: bson.D{{Key: "$each", Value: *addTags}}})
+	}
+	removeParams := bson.D{}
+	if removeTags != nil {
+		removeParams = append(removeParams, bson.E{Key: "tags", Value: bson.D{{Key: "$in", Value: *removeTags}}})
+	}
+
+	// same as TaskModify, addToSet and pull have to be separate queries
+	update := bson.D{
+		{Key: "$set", Value: setParams},
+		{Key: "$addToSet", Value: addParams},
+	}
+	if _, err := c.Collection(taskCollection).UpdateMany(ctx, filter, update); err != nil {
+		return err
+	}
+	pullUpdate := bson.D{{Key: "$pull", Value: removeParams}}
+	_, err := c.Collection(taskCollection).UpdateMany(ctx, filter, pullUpdate)
+	return err
+}
+
+// Stops a series by removing the recurrence rule from every instance.
+// Existing instances are kept as normal tasks.
+func (c *TaskController) TaskSeriesStop(ctx context.Context, seriesid string) error {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskSeriesStop")
+	defer span.End()
+	if seriesid == "" {
+		return errs.Conflict("task is not part of a series")
+	}
+	filter := bson.D{{Key: "seriesid", Value: seriesid}}
+	update := bson.D{{Key: "$unset", Value: bson.D{{Key: "recurrence", Value: ""}}}}
+	_, err := c.Collection(taskCollection).UpdateMany(ctx, filter, update)
+	return err
 }
 
 func (c *TaskController) TaskDelete(ctx context.Context, id string) error {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskDelete")
+	defer span.End()
 	_, err := c.Collection(taskCollection).DeleteByID(ctx, id)
 	if err != nil {
 		return err
@@ -95,6 +330,8 @@ func (c *TaskController) TaskDelete(ctx context.Context, id string) error {
 
 // Deletes all tasks passed in to this
 func (c *TaskController) TaskDeleteMany(ctx context.Context, ids []string) error {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskDeleteMany")
+	defer span.End()
 	var idArr []primitive.ObjectID
 	for _, id := range ids {
 		temp, _ := primitive.ObjectIDFromHex(id)
@@ -107,6 +344,8 @@ func (c *TaskController) TaskDeleteMany(ctx context.Context, ids []string) error
 }
 
 func (c *TaskController) TaskMapToArrayUser(ctx context.Context, Tasks map[string]bool) []models.Task {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskMapToArrayUser")
+	defer span.End()
 	tasksArray := []models.Task{}
 	taskidArr := []primitive.ObjectID{}
 	for taskid := range Tasks {
@@ -118,6 +357,8 @@ func (c *TaskController) TaskMapToArrayUser(ctx context.Context, Tasks map[strin
 }
 
 func (c *TaskController) TaskMapToArray(ctx context.Context, Tasks []string) []models.Task {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskMapToArray")
+	defer span.End()
 	tasksArray := []models.Task{}
 	taskPrimitiveIdArr := []primitive.ObjectID{}
 	for _, taskid := range Tasks {
@@ -128,12 +369,159 @@ func (c *TaskController) TaskMapToArray(ctx context.Context, Tasks []string) []m
 	return tasksArray
 }
 
-func (c *TaskController) TasksDeleteUser(ctx context.Context, Tasks []string, userId string) {
+func (c *TaskController) TasksDeleteUser(ctx context.Context, Tasks []string, userId string) error {
+	ctx, span := tracing.Start(ctx, "TaskController.TasksDeleteUser")
+	defer span.End()
 	primitiveArr := []primitive.ObjectID{}
 	for _, taskid := range Tasks {
 		id, _ := primitive.ObjectIDFromHex(taskid)
 		primitiveArr = append(primitiveArr, id)
 	}
 	params := bson.D{{Key: "$pull", Value: bson.D{{Key: "assignedTo", Value: userId}}}}
-	c.Collection(taskCollection).UpdateManyByID(ctx, primitiveArr, params)
+	_, err := c.Collection(taskCollection).UpdateManyByID(ctx, primitiveArr, params)
+	return err
+}
+
+// Assigns the user to all the tasks, the reverse of TasksDeleteUser.
+func (c *TaskController) TasksAddUser(ctx context.Context, Tasks []string, userId string) error {
+	ctx, span := tracing.Start(ctx, "TaskController.TasksAddUser")
+	defer span.End()
+	primitiveArr := []primitive.ObjectID{}
+	for _, taskid := range Tasks {
+		id, _ := primitive.ObjectIDFromHex(taskid)
+		primitiveArr = append(primitiveArr, id)
+	}
+	params := bson.D{{Key: "$addToSet", Value: bson.D{{Key: "assignedTo", Value: userId}}}}
+	_, err := c.Collection(taskCollection).UpdateManyByID(ctx, primitiveArr, params)
+	return err
+}
+
+// Returns the tasks in a workflow state, ordered by their position in the column.
+// tasks should be all the tasks of the project.
+func TaskColumn(settings models.ProjectSettings, tasks []models.Task, state string) []models.Task {
+	column := []models.Task{}
+	for _, task := range tasks {
+		if settings.TaskState(task) == state {
+			column = append(column, task)
+		}
+	}
+	sort.SliceStable(column, func(i, j int) bool {
+		return column[i].Position < column[j].Position
+	})
+	return column
+}
+
+// Moves a task into a workflow state of its project at the given position (clamped to the column's size).
+// The remaining tasks in both the old and new columns are renumbered, and every change is sent as a single ordered bulk write.
+// tasks should be all the tasks of the project.
+func (c *TaskController) TaskMove(ctx context.Context, project models.Project, tasks []models.Task, taskid string, state string, position int) error {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskMove")
+	defer span.End()
+	settings := project.Settings
+	projectid := project.Id.Hex()
+	target, ok := settings.FindState(state)
+	if !ok {
+		return errs.Invalid("state", "does not exist")
+	}
+	var moved *models.Task
+	for i := range tasks {
+		if tasks[i].Id.Hex() == taskid {
+			moved = &tasks[i]
+			break
+		}
+	}
+	if moved == nil {
+		return errs.NotFound("task does not exist in project")
+	}
+	oldState := settings.TaskState(*moved)
+
+	// remove the task from its current column
+	without := func(column []models.Task) []models.Task {
+		result := []models.Task{}
+		for _, task := range column {
+			if task.Id != moved.Id {
+				result = append(result, task)
+			}
+		}
+		return result
+	}
+	oldColumn := without(TaskColumn(settings, tasks, oldState))
+	newColumn := without(TaskColumn(settings, tasks, target.Name))
+
+	if position < 0 {
+		position = 0
+	}
+	if position > len(newColumn) {
+		position = len(newColumn)
+	}
+	newColumn = append(newColumn[:position], append([]models.Task{*moved}, newColumn[position:]...)...)
+
+	operations := []mongo.WriteModel{}
+	renumber := func(column []models.Task) {
+		for i, task := range column {
+			if task.Id == moved.Id {
+				update := bson.D{{Key: "$set", Value: bson.D{
+					{Key: "projectid", Value: projectid},
+					{Key: "state", Value: target.Name},
+					{Key: "position", Value: i},
+					{Key: "isDone", Value: target.IsTerminal},
+				}}}
+				operations = append(operations, mongo.NewUpdateOneModel().SetFilter(bson.D{{Key: "_id", Value: task.Id}}).SetUpdate(update))
+			} else if task.Position != i || task.State != settings.TaskState(task) || task.ProjectId != projectid {
+				// also persists the derived state and projectid of tasks created before they were recorded
+				update := bson.D{{Key: "$set", Value: bson.D{
+					{Key: "projectid", Value: projectid},
+					{Key: "state", Value: settings.TaskState(task)},
+					{Key: "position", Value: i},
+				}}}
+				operations = append(operations, mongo.NewUpdateOneModel().SetFilter(bson.D{{Key: "_id", Value: task.Id}}).SetUpdate(update))
+			}
+		}
+	}
+	if oldState != target.Name {
+		renumber(oldColumn)
+	}
+	renumber(newColumn)
+
+	_, err := c.Collection(taskCollection).BulkWrite(ctx, operations)
+	return err
+}
+
+// Brings tasks in line with a project's new workflow states.
+// Tasks in a removed state are appended to the initial state, and IsDone is recomputed for every task in case a state's terminal flag changed.
+// tasks should be all the tasks of the project.
+func (c *TaskController) TaskApplyStates(ctx context.Context, oldSettings, newSettings models.ProjectSettings, tasks []models.Task) error {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskApplyStates")
+	defer span.End()
+	fallback := newSettings.InitialState()
+	// the tasks from removed states go after those staying in the initial state
+	position := 0
+	for _, task := range tasks {
+		if state, ok := newSettings.FindState(oldSettings.TaskState(task)); ok && state.Name == fallback.Name {
+			position++
+		}
+	}
+	operations := []mongo.WriteModel{}
+	for _, task := range tasks {
+		params := bson.D{}
+		state, ok := newSettings.FindState(oldSettings.TaskState(task))
+		if !ok {
+			state = fallback
+			params = append(params, bson.E{Key: "state", Value: state.Name}, bson.E{Key: "position", Value: position})
+			position++
+		}
+		if task.IsDone != state.IsTerminal || !ok {
+			params = append(params, bson.E{Key: "isDone", Value: state.IsTerminal})
+		}
+		if len(params) == 0 {
+			continue
+		}
+		update := bson.D{{Key: "$set", Value: params}}
+		operations = append(operations, mongo.NewUpdateOneModel().SetFilter(bson.D{{Key: "_id", Value: task.Id}}).SetUpdate(update))
+	}
+	if len(operations) == 0 {
+		return nil
+	}
+	_, err := c.Collection(taskCollection).BulkWrite(ctx, operations)
+	return err
 }
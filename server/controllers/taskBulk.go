@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/functions"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	TaskBulkMarkDone      = "markDone"
+	TaskBulkReassign      = "reassign"
+	TaskBulkAddTags       = "addTags"
+	TaskBulkRemoveTags    = "removeTags"
+	TaskBulkShiftDeadline = "shiftDeadline"
+	TaskBulkDelete        = "delete"
+)
+
+var (
+	ErrNoDeadline = errs.Conflict("task has no deadline")
+	ErrNotApplied = errs.Conflict("not applied as an earlier change failed")
+)
+
+// A change applied to many tasks at once.
+type TaskBulkOperation struct {
+	Type       string
+	IsDone     bool                     // for markDone
+	AssignedTo []string                 // for reassign, replaces the assignees
+	Tags       []string                 // for addTags and removeTags
+	Days       int                      // for shiftDeadline, negative to move earlier
+	Placements map[string]TaskPlacement // for markDone, the new workflow state of project tasks by taskid
+	ProjectIds map[string]string        // for delete, the project of project tasks by taskid, recorded as in TaskSoftDelete
+}
+
+// Where a project task is placed on the task board.
+type TaskPlacement struct {
+	ProjectId string // recorded on tasks created before they recorded their projectid
+	State     string
+	Position  int
+}
+
+// Applies the operation to the tasks on behalf of userid, in a single bulk write.
+// Returns an error for each task that was not changed, and nil for those that were.
+// Changes are recorded in the activity history of the tasks, except for deletions.
+func (c *TaskController) TaskBulk(ctx context.Context, userid string, tasks []models.Task, op TaskBulkOperation) []error {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskBulk")
+	defer span.End()
+	results := make([]error, len(tasks))
+	operations := []mongo.WriteModel{}
+	// index of the task of each operation
+	indexes := []int{}
+	activities := [][]*models.TaskActivity{}
+
+	now := time.Now()
+	for i, task := range tasks {
+		filter := bson.D{{Key: "_id", Value: task.Id}}
+		record := func(field string, oldValue, newValue interface{}) *models.TaskActivity {
+			return &models.TaskActivity{
+				TaskId: task.Id.Hex(),
+				UserId: userid,
+				Field:  field,
+				Old:    oldValue,
+				New:    newValue,
+				Time:   now,
+			}
+		}
+		var operation mongo.WriteModel
+		taskActivities := []*models.TaskActivity{}
+		switch op.Type {
+		case TaskBulkMarkDone:
+			set := bson.D{{Key: "isDone", Value: op.IsDone}}
+			if placement, ok := op.Placements[task.Id.Hex()]; ok {
+				set = append(set, bson.E{Key: "projectid", Value: placement.ProjectId}, bson.E{Key: "state", Value: placement.State}, bson.E{Key: "position", Value: placement.Position})
+			}
+			operation = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(bson.D{{Key: "$set", Value: set}})
+			if task.IsDone != op.IsDone {
+				taskActivities = append(taskActivities, record("isDone", task.IsDone, op.IsDone))
+			}
+		case TaskBulkReassign:
+			update := bson.D{{Key: "$set", Value: bson.D{{Key: "assignedTo", Value: op.AssignedTo}}}}
+			operation = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update)
+			added, removed := functions.Diff(task.AssignedTo, op.AssignedTo)
+			if len(added) > 0 || len(removed) > 0 {
+				taskActivities = append(taskActivities, record("assignedTo", task.AssignedTo, op.AssignedTo))
+			}
+		case TaskBulkAddTags, TaskBulkRemoveTags:
+			var update bson.D
+			var newTags []string
+			var changed bool
+			if op.Type == TaskBulkAddTags {
+				update = bson.D{{Key: "$addToSet", Value: bson.D{{Key: "tags", Value: bson.D{{Key: "$each", Value: op.Tags}}}}}}
+				newTags, changed = applyDelta(task.Tags, &op.Tags, nil)
+			} else {
+				update = bson.D{{Key: "$pull", Value: bson.D{{Key: "tags", Value: bson.D{{Key: "$in", Value: op.Tags}}}}}}
+				newTags, changed = applyDelta(task.Tags, nil, &op.Tags)
+			}
+			operation = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update)
+			if changed {
+				taskActivities = append(taskActivities, record("tags", task.Tags, newTags))
+			}
+		case TaskBulkShiftDeadline:
+			if task.Deadline.IsZero() {
+				results[i] = ErrNoDeadline
+				continue
+			}
+			deadline := task.Deadline.AddDate(0, 0, op.Days)
+			update := bson.D{{Key: "$set", Value: bson.D{{Key: "deadline", Value: deadline}}}}
+			operation = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update)
+			taskActivities = append(taskActivities, record("deadline", task.Deadline, deadline))
+		case TaskBulkDelete:
+			// moved to the trash, like any other deletion
+			set := bson.D{{Key: "deletedAt", Value: now}}
+			if projectid, ok := op.ProjectIds[task.Id.Hex()]; ok {
+				set = append(set, bson.E{Key: "projectid", Value: projectid})
+			}
+			update := bson.D{{Key: "$set", Value: set}}
+			operation = mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update)
+		default:
+			results[i] = errs.Validation("unknown operation " + op.Type)
+			continue
+		}
+		operations = append(operations, operation)
+		indexes = append(indexes, i)
+		activities = append(activities, taskActivities)
+	}
+	if len(operations) == 0 {
+		return results
+	}
+
+	// the bulk write is ordered, so everything after the first failure is not applied
+	applied := len(operations)
+	if _, err := c.Collection(taskCollection).BulkWrite(ctx, operations); err != nil {
+		var bulkErr mongo.BulkWriteException
+		if errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0 {
+			failed := bulkErr.WriteErrors[0]
+			applied = failed.Index
+			results[indexes[failed.Index]] = errors.New(failed.Message)
+			for j := failed.Index + 1; j < len(operations); j++ {
+				results[indexes[j]] = ErrNotApplied
+			}
+		} else {
+			for _, index := range indexes {
+				results[index] = err
+			}
+			return results
+		}
+	}
+
+	recorded := []*models.TaskActivity{}
+	for j := 0; j < applied; j++ {
+		recorded = append(recorded, activities[j]...)
+	}
+	if len(recorded) > 0 {
+		// the changes were made, so only the history is missing if this fails
+		if err := c.ActivityCollection(taskActivityCollection).InsertMany(ctx, recorded); err != nil {
+			slog.ErrorContext(ctx, "failed to record the history of bulk change", "error", err)
+		}
+	}
+	return results
+}
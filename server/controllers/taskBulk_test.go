@@ -0,0 +1,88 @@
+package controllers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Records bulk writes, failing the operation at failAt if it is not negative.
+type bulkCollection struct {
+	controllers.TaskCollectionInterface
+	operations []mongo.WriteModel
+	failAt     int
+}
+
+func (c *bulkCollection) BulkWrite(ctx context.Context, operations []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+	c.operations = operations
+	if c.failAt < 0 {
+		return &mongo.BulkWriteResult{}, nil
+	}
+	return nil, mongo.BulkWriteException{
+		WriteErrors: []mongo.BulkWriteError{{WriteError: mongo.WriteError{Index: c.failAt, Message: "write failed"}}},
+	}
+}
+
+type activityCollection struct {
+	controllers.TaskActivityCollectionInterface
+	activities []*models.TaskActivity
+}
+
+func (c *activityCollection) InsertMany(ctx context.Context, activities []*models.TaskActivity) error {
+	c.activities = append(c.activities, activities...)
+	return nil
+}
+
+func TestTaskBulk(t *testing.T) {
+	collection := &bulkCollection{failAt: -1}
+	activity := &activityCollection{}
+	c := controllers.TaskController{
+		Collection: func(name string, opts ...*options.CollectionOptions) controllers.TaskCollectionInterface {
+			return collection
+		},
+		ActivityCollection: func(name string, opts ...*options.CollectionOptions) controllers.TaskActivityCollectionInterface {
+			return activity
+		},
+	}
+	ctx := context.Background()
+	deadline := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	tasks := []models.Task{
+		{Id: primitive.NewObjectID(), Deadline: deadline},
+		{Id: primitive.NewObjectID()},
+		{Id: primitive.NewObjectID(), Deadline: deadline},
+	}
+
+	// tasks without a deadline are skipped
+	errs := c.TaskBulk(ctx, "user", tasks, controllers.TaskBulkOperation{Type: controllers.TaskBulkShiftDeadline, Days: 7})
+	if errs[0] != nil || errs[1] != controllers.ErrNoDeadline || errs[2] != nil {
+		t.Errorf("Expected only the task without a deadline to fail but got %v", errs)
+	}
+	if len(collection.operations) != 2 {
+		t.Fatalf("Expected a single bulk write of 2 operations but got %v", collection.operations)
+	}
+	update := collection.operations[0].(*mongo.UpdateOneModel).Update.(bson.D)
+	if shifted := update.Map()["$set"].(bson.D).Map()["deadline"]; shifted != deadline.AddDate(0, 0, 7) {
+		t.Errorf("Expected deadline to be shifted by 7 days but got %v", shifted)
+	}
+	if len(activity.activities) != 2 || activity.activities[0].Field != "deadline" {
+		t.Errorf("Expected 2 deadline changes to be recorded but got %v", activity.activities)
+	}
+
+	// everything after a failed write is not applied
+	collection.failAt = 1
+	activity.activities = nil
+	errs = c.TaskBulk(ctx, "user", tasks, controllers.TaskBulkOperation{Type: controllers.TaskBulkAddTags, Tags: []string{"sprint"}})
+	if errs[0] != nil || errs[1] == nil || errs[1].Error() != "write failed" || errs[2] != controllers.ErrNotApplied {
+		t.Errorf("Expected [nil, write failed, not applied] but got %v", errs)
+	}
+	if len(activity.activities) != 1 || activity.activities[0].TaskId != tasks[0].Id.Hex() {
+		t.Errorf("Expected only the applied change to be recorded but got %v", activity.activities)
+	}
+}
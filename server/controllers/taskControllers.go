@@ -2,8 +2,8 @@ package controllers
 
 import (
 	"context"
-	"errors"
 
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
 	"github.com/OrgaNiUS/OrgaNiUS/server/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -12,10 +12,12 @@ import (
 )
 
 type TaskCollectionInterface interface {
-	// Find one task by id
+	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error)
+
+	// Find one task by id, excluding tasks in the trash
 	FindOne(ctx context.Context, task *models.Task, id string) (*models.Task, error)
 
-	// Find all tasks matching in the id array
+	// Find all tasks matching in the id array, excluding tasks in the trash
 	FindAll(ctx context.Context, taskidArr []primitive.ObjectID, TaskArr *[]models.Task) error
 
 	// Insert a new task into the database
@@ -23,8 +25,18 @@ type TaskCollectionInterface interface {
 	InsertOne(ctx context.Context, task *models.Task) (primitive.ObjectID, error)
 
 	// Modifies a task by ID
+	// Every update increments the version of the tasks it modifies.
 	UpdateByID(ctx context.Context, id primitive.ObjectID, params bson.D) (*mongo.UpdateResult, error)
 
+	// Modifies a task by ID only if it is at the version
+	UpdateByVersion(ctx context.Context, id primitive.ObjectID, version int64, params bson.D) (*mongo.UpdateResult, error)
+
+	// Modifies the first task matching the filter
+	UpdateOne(ctx context.Context, filter bson.D, params bson.D) (*mongo.UpdateResult, error)
+
+	// Modifies all tasks matching the filter
+	UpdateMany(ctx context.Context, filter bson.D, params bson.D) (*mongo.UpdateResult, error)
+
 	// Modifies many tasks by ID
 	UpdateManyByID(ctx context.Context, taskIdArr []primitive.ObjectID, params bson.D) (*mongo.UpdateResult, error)
 
@@ -33,10 +45,13 @@ type TaskCollectionInterface interface {
 
 	// Delete many tasks from Task Collection
 	DeleteMany(ctx context.Context, params bson.D) (int64, error)
+
+	// Runs multiple write operations in a single request
+	BulkWrite(ctx context.Context, operations []mongo.WriteModel) (*mongo.BulkWriteResult, error)
 }
 
 type TaskCollection struct {
-	taskCollection *mongo.Collection
+	taskCollection MongoCollection
 }
 
 func (c *TaskCollection) FindOne(ctx context.Context, task *models.Task, id string) (*models.Task, error) {
@@ -45,7 +60,7 @@ func (c *TaskCollection) FindOne(ctx context.Context, task *models.Task, id stri
 		task = &models.Task{}
 	}
 	if id == "" {
-		return task, errors.New("cannot leave all params blank")
+		return task, errs.Validation("cannot leave all params blank")
 	}
 	params := []interface{}{}
 	objectId, err := primitive.ObjectIDFromHex(id)
@@ -53,13 +68,13 @@ func (c *TaskCollection) FindOne(ctx context.Context, task *models.Task, id stri
 		return task, err
 	}
 	params = append(params, bson.D{{Key: "_id", Value: objectId}})
-	filter := bson.D{{Key: "$or", Value: params}}
+	filter := bson.D{{Key: "$or", Value: params}, notDeleted}
 	err2 := c.taskCollection.FindOne(ctx, filter).Decode(&task)
 	return task, err2
 }
 
 func (c *TaskCollection) FindAll(ctx context.Context, taskidArr []primitive.ObjectID, TaskArr *[]models.Task) error {
-	cur, err := c.taskCollection.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: taskidArr}}}})
+	cur, err := c.taskCollection.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: taskidArr}}}, notDeleted})
 	if err != nil {
 		return err
 	}
@@ -67,6 +82,10 @@ func (c *TaskCollection) FindAll(ctx context.Context, taskidArr []primitive.Obje
 	return nil
 }
 
+func (c *TaskCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	return c.taskCollection.Find(ctx, filter, opts...)
+}
+
 func (c *TaskCollection) InsertOne(ctx context.Context, task *models.Task) (primitive.ObjectID, error) {
 	result, err := c.taskCollection.InsertOne(ctx, task)
 	if err != nil {
@@ -77,15 +96,27 @@ func (c *TaskCollection) InsertOne(ctx context.Context, task *models.Task) (prim
 }
 
 func (c *TaskCollection) UpdateByID(ctx context.Context, id primitive.ObjectID, params bson.D) (*mongo.UpdateResult, error) {
-	result, err := c.taskCollection.UpdateByID(ctx, id, params)
+	result, err := c.taskCollection.UpdateByID(ctx, id, bumpVersion(params))
 	if err != nil {
 		return nil, err
 	}
 	return result, err
 }
 
+func (c *TaskCollection) UpdateByVersion(ctx context.Context, id primitive.ObjectID, version int64, params bson.D) (*mongo.UpdateResult, error) {
+	return c.taskCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: id}, atVersion(version)}, bumpVersion(params))
+}
+
+func (c *TaskCollection) UpdateOne(ctx context.Context, filter bson.D, params bson.D) (*mongo.UpdateResult, error) {
+	return c.taskCollection.UpdateOne(ctx, filter, bumpVersion(params))
+}
+
+func (c *TaskCollection) UpdateMany(ctx context.Context, filter bson.D, params bson.D) (*mongo.UpdateResult, error) {
+	return c.taskCollection.UpdateMany(ctx, filter, bumpVersion(params))
+}
+
 func (c *TaskCollection) UpdateManyByField(ctx context.Context, field string, arr interface{}, params bson.D) (*mongo.UpdateResult, error) {
-	result, err := c.taskCollection.UpdateMany(ctx, bson.D{{Key: field, Value: bson.D{{Key: "$in", Value: arr}}}}, params)
+	result, err := c.taskCollection.UpdateMany(ctx, bson.D{{Key: field, Value: bson.D{{Key: "$in", Value: arr}}}}, bumpVersion(params))
 	if err != nil {
 		return nil, err
 	}
@@ -117,17 +148,69 @@ func (c *TaskCollection) DeleteMany(ctx context.Context, params bson.D) (int64,
 	return result.DeletedCount, nil
 }
 
+func (c *TaskCollection) BulkWrite(ctx context.Context, operations []mongo.WriteModel) (*mongo.BulkWriteResult, error) {
+	// ordered, so that a failure stops the remaining writes from being applied
+	opts := options.BulkWrite().SetOrdered(true)
+	return c.taskCollection.BulkWrite(ctx, bumpVersions(operations), opts)
+}
+
+type TaskActivityCollectionInterface interface {
+	// Insert multiple activity entries into the database
+	InsertMany(ctx context.Context, activities []*models.TaskActivity) error
+
+	// Find all activity of a task, oldest first
+	FindAll(ctx context.Context, taskid string, activities *[]models.TaskActivity) error
+
+	// Delete many activity entries from Task Activity Collection
+	DeleteMany(ctx context.Context, params bson.D) (int64, error)
+}
+
+type TaskActivityCollection struct {
+	activityCollection MongoCollection
+}
+
+func (c *TaskActivityCollection) InsertMany(ctx context.Context, activities []*models.TaskActivity) error {
+	documents := make([]interface{}, len(activities))
+	for i, activity := range activities {
+		documents[i] = activity
+	}
+	_, err := c.activityCollection.InsertMany(ctx, documents)
+	return err
+}
+
+func (c *TaskActivityCollection) FindAll(ctx context.Context, taskid string, activities *[]models.TaskActivity) error {
+	opts := options.Find().SetSort(bson.D{{Key: "time", Value: 1}})
+	cursor, err := c.activityCollection.Find(ctx, bson.D{{Key: "taskid", Value: taskid}}, opts)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, activities)
+}
+
+func (c *TaskActivityCollection) DeleteMany(ctx context.Context, params bson.D) (int64, error) {
+	result, err := c.activityCollection.DeleteMany(ctx, params)
+	if err != nil {
+		return -1, err
+	}
+	return result.DeletedCount, nil
+}
+
 type TaskController struct {
-	Collection func(name string, opts ...*options.CollectionOptions) TaskCollectionInterface
-	URL        string
+	Collection         func(name string, opts ...*options.CollectionOptions) TaskCollectionInterface
+	ActivityCollection func(name string, opts ...*options.CollectionOptions) TaskActivityCollectionInterface
+	URL                string
 }
 
-func NewT(client *mongo.Client, URL string) *TaskController {
-	database := client.Database(databaseName) // databaseName declared in userControllers
+func NewT(database Database, URL string) *TaskController {
 	return &TaskController{
 		func(name string, opts ...*options.CollectionOptions) TaskCollectionInterface {
 			return &TaskCollection{
-				database.Collection(name, opts...),
+				database(name, opts...),
+			}
+		},
+		func(name string, opts ...*options.CollectionOptions) TaskActivityCollectionInterface {
+			return &TaskActivityCollection{
+				database(name, opts...),
 			}
 		},
 		URL,
@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultTaskQueryLimit = 50
+	MaxTaskQueryLimit     = 200
+)
+
+var (
+	ErrInvalidCursor = errs.Validation("invalid cursor")
+	ErrCursorSort    = errs.Validation("cursor is for a different sort")
+
+	// fields that tasks can be sorted on
+	taskSortFields = map[string]bool{
+		"name":         true,
+		"description":  true,
+		"creationTime": true,
+		"deadline":     true,
+		"isDone":       true,
+		"isPersonal":   true,
+		"state":        true,
+		"position":     true,
+		"estimate":     true,
+	}
+)
+
+// Filters for querying tasks. Nil fields are not filtered on.
+type TaskQuery struct {
+	UserId       string     // scope to tasks assigned to this user, used if ProjectId is empty
+	ProjectId    string     // scope to tasks of this project
+	ProjectTasks []string   // the tasks of the project, which include those created before tasks recorded their projectid
+	AssignedTo   []string   // assigned to any of these users
+	Tags         []string   // has all of these tags
+	DeadlineFrom *time.Time // inclusive
+	DeadlineTo   *time.Time // exclusive
+	IsDone       *bool
+	IsPersonal   *bool
+	Text         string // case insensitive match in the name or description
+	Sort         string // field to sort on, prefixed with "-" for descending order
+	Limit        int
+	Cursor       string // returned by the previous page
+}
+
+// Whether tasks can be sorted on the field, ignoring any "-" prefix.
+func IsTaskSortField(sort string) bool {
+	return taskSortFields[strings.TrimPrefix(sort, "-")]
+}
+
+// Position of a task within a sorted query, encoded into an opaque string.
+// Holds the sort it was given for, as the position means nothing in another order.
+type taskCursor struct {
+	Sort  string             `bson:"s"`
+	Value interface{}        `bson:"v"`
+	Id    primitive.ObjectID `bson:"id"`
+}
+
+// Tasks are given as stored, so that a missing field can be told apart from its zero value.
+func encodeTaskCursor(raw bson.Raw, sort string) (string, error) {
+	field := strings.TrimPrefix(sort, "-")
+	cursor := taskCursor{Sort: sort}
+	if id, ok := raw.Lookup("_id").ObjectIDOK(); ok {
+		cursor.Id = id
+	}
+	if value, err := raw.LookupErr(field); err == nil && value.Type != bsontype.Null {
+		cursor.Value = value
+	}
+	encoded, err := bson.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded), nil
+}
+
+func decodeTaskCursor(s, sort string) (taskCursor, error) {
+	var cursor taskCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := bson.Unmarshal(decoded, &cursor); err != nil || cursor.Id.IsZero() {
+		return cursor, ErrInvalidCursor
+	}
+	if cursor.Sort != sort {
+		return cursor, ErrCursorSort
+	}
+	return cursor, nil
+}
+
+// Returns the filter matching tasks after the cursor, in the order of the sort.
+// Tasks without the field (created before it existed) sort before all others.
+func afterTaskCursor(cursor taskCursor, field string, descending bool) bson.D {
+	op := "$gt"
+	if descending {
+		op = "$lt"
+	}
+	tiebreak := bson.D{
+		{Key: field, Value: cursor.Value},
+		{Key: "_id", Value: bson.D{{Key: op, Value: cursor.Id}}},
+	}
+	var after bson.A
+	if cursor.Value == nil {
+		if descending {
+			after = bson.A{tiebreak}
+		} else {
+			after = bson.A{bson.D{{Key: field, Value: bson.D{{Key: "$ne", Value: nil}}}}, tiebreak}
+		}
+	} else {
+		after = bson.A{bson.D{{Key: field, Value: bson.D{{Key: op, Value: cursor.Value}}}}, tiebreak}
+		if descending {
+			after = append(after, bson.D{{Key: field, Value: nil}})
+		}
+	}
+	return bson.D{{Key: "$or", Value: after}}
+}
+
+// Converts the query into a MongoDB filter.
+func taskQueryFilter(query TaskQuery) bson.D {
+	filter := bson.D{notDeleted}
+	if query.ProjectId != "" {
+		ids := bson.A{}
+		for _, taskid := range query.ProjectTasks {
+			if id, err := primitive.ObjectIDFromHex(taskid); err == nil {
+				ids = append(ids, id)
+			}
+		}
+		filter = append(filter, bson.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: "projectid", Value: query.ProjectId}},
+			bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}},
+		}})
+	} else {
+		filter = append(filter, bson.E{Key: "assignedTo", Value: query.UserId})
+	}
+	// $and as assignedTo might already be used for the scope
+	and := bson.A{}
+	if len(query.AssignedTo) > 0 {
+		and = append(and, bson.D{{Key: "assignedTo", Value: bson.D{{Key: "$in", Value: query.AssignedTo}}}})
+	}
+	if len(query.Tags) > 0 {
+		and = append(and, bson.D{{Key: "tags", Value: bson.D{{Key: "$all", Value: query.Tags}}}})
+	}
+	deadline := bson.D{}
+	if query.DeadlineFrom != nil {
+		deadline = append(deadline, bson.E{Key: "$gte", Value: *query.DeadlineFrom})
+	}
+	if query.DeadlineTo != nil {
+		deadline = append(deadline, bson.E{Key: "$lt", Value: *query.DeadlineTo})
+	}
+	if len(deadline) > 0 {
+		and = append(and, bson.D{{Key: "deadline", Value: deadline}})
+	}
+	if query.IsDone != nil {
+		and = append(and, bson.D{{Key: "isDone", Value: *query.IsDone}})
+	}
+	if query.IsPersonal != nil {
+		and = append(and, bson.D{{Key: "isPersonal", Value: *query.IsPersonal}})
+	}
+	if query.Text != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(query.Text), Options: "i"}
+		and = append(and, bson.D{{Key: "$or", Value: bson.A{
+			bson.D{{Key: "name", Value: pattern}},
+			bson.D{{Key: "description", Value: pattern}},
+		}}})
+	}
+	if len(and) > 0 {
+		filter = append(filter, bson.E{Key: "$and", Value: and})
+	}
+	return filter
+}
+
+// Returns a page of tasks matching the query, and the cursor for the next page.
+// The cursor is empty on the last page.
+func (c *TaskController) TaskQuery(ctx context.Context, query TaskQuery) ([]models.Task, string, error) {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskQuery")
+	defer span.End()
+	tasks := []models.Task{}
+	sort := query.Sort
+	if sort == "" {
+		sort = "deadline"
+	}
+	if !IsTaskSortField(sort) {
+		return tasks, "", errs.Validation("cannot sort on " + sort)
+	}
+	descending := strings.HasPrefix(sort, "-")
+	field := strings.TrimPrefix(sort, "-")
+	order := 1
+	if descending {
+		order = -1
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultTaskQueryLimit
+	} else if limit > MaxTaskQueryLimit {
+		limit = MaxTaskQueryLimit
+	}
+
+	filter := taskQueryFilter(query)
+	if query.Cursor != "" {
+		cursor, err := decodeTaskCursor(query.Cursor, sort)
+		if err != nil {
+			return tasks, "", err
+		}
+		filter = bson.D{{Key: "$and", Value: bson.A{filter, afterTaskCursor(cursor, field, descending)}}}
+	}
+
+	// fetch one extra to know if there is a next page
+	opts := options.Find().
+		SetSort(bson.D{{Key: field, Value: order}, {Key: "_id", Value: order}}).
+		SetLimit(int64(limit + 1))
+	cur, err := c.Collection(taskCollection).Find(ctx, filter, opts)
+	if err != nil {
+		return tasks, "", err
+	}
+	raws := []bson.Raw{}
+	if err := cur.All(ctx, &raws); err != nil {
+		return tasks, "", err
+	}
+	hasNext := len(raws) > limit
+	if hasNext {
+		raws = raws[:limit]
+	}
+	for _, raw := range raws {
+		var task models.Task
+		if err := bson.Unmarshal(raw, &task); err != nil {
+			return tasks, "", err
+		}
+		tasks = append(tasks, task)
+	}
+	if !hasNext {
+		return tasks, "", nil
+	}
+	next, err := encodeTaskCursor(raws[limit-1], sort)
+	return tasks, next, err
+}
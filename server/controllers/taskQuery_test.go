@@ -0,0 +1,97 @@
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Returns the stored tasks in order from Find, ignoring the filter and sort but recording them.
+type queryCollection struct {
+	controllers.TaskCollectionInterface
+	tasks   []interface{}
+	filters []interface{}
+	opts    []*options.FindOptions
+}
+
+func (c *queryCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	c.filters = append(c.filters, filter)
+	c.opts = append(c.opts, opts...)
+	limit := len(c.tasks)
+	if len(opts) > 0 && opts[0].Limit != nil && int(*opts[0].Limit) < limit {
+		limit = int(*opts[0].Limit)
+	}
+	return mongo.NewCursorFromDocuments(c.tasks[:limit], nil, nil)
+}
+
+func TestTaskQuery(t *testing.T) {
+	collection := &queryCollection{}
+	for _, name := range []string{"a", "b", "c"} {
+		collection.tasks = append(collection.tasks, models.Task{Id: primitive.NewObjectID(), Name: name, ProjectId: "project"})
+	}
+	c := controllers.TaskController{
+		Collection: func(name string, opts ...*options.CollectionOptions) controllers.TaskCollectionInterface {
+			return collection
+		},
+	}
+	ctx := context.Background()
+
+	legacy := primitive.NewObjectID()
+	tasks, cursor, err := c.TaskQuery(ctx, controllers.TaskQuery{ProjectId: "project", ProjectTasks: []string{legacy.Hex()}, Sort: "-name", Limit: 2})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	// tasks created before they recorded their projectid are found by their id
+	raw, err := bson.Marshal(collection.filters[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, ok := bson.Raw(raw).Lookup("$or", "1", "_id", "$in", "0").ObjectIDOK(); !ok || id != legacy {
+		t.Errorf("Expected the tasks of the project to be included by id but got %v", bson.Raw(raw))
+	}
+	if len(tasks) != 2 || tasks[1].Name != "b" {
+		t.Errorf("Expected first page to have 2 tasks but got %v", tasks)
+	}
+	if cursor == "" {
+		t.Errorf("Expected a cursor for the next page")
+	}
+	sort := collection.opts[0].Sort.(bson.D)
+	if sort[0].Key != "name" || sort[0].Value != -1 || sort[1].Key != "_id" || sort[1].Value != -1 {
+		t.Errorf("Expected descending sort on name then _id but got %v", sort)
+	}
+
+	// the next page continues after the last task of this page
+	if _, _, err := c.TaskQuery(ctx, controllers.TaskQuery{ProjectId: "project", Sort: "-name", Limit: 2, Cursor: cursor}); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	raw, err = bson.Marshal(collection.filters[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := bson.Raw(raw).Lookup("$and", "1", "$or", "0", "name", "$lt")
+	if value, ok := after.StringValueOK(); !ok || value != "b" {
+		t.Errorf("Expected next page to be filtered on names before b but got %v", bson.Raw(raw))
+	}
+
+	collection.tasks = collection.tasks[:1]
+	if _, cursor, _ := c.TaskQuery(ctx, controllers.TaskQuery{ProjectId: "project", Limit: 2}); cursor != "" {
+		t.Errorf("Expected no cursor on the last page but got %v", cursor)
+	}
+
+	// the cursor only continues the sort it was given for
+	if _, _, err := c.TaskQuery(ctx, controllers.TaskQuery{ProjectId: "project", Sort: "name", Cursor: cursor}); err != controllers.ErrCursorSort {
+		t.Errorf("Expected cursor sort error but got %v", err)
+	}
+	if _, _, err := c.TaskQuery(ctx, controllers.TaskQuery{ProjectId: "project", Cursor: "not a cursor"}); err != controllers.ErrInvalidCursor {
+		t.Errorf("Expected invalid cursor error but got %v", err)
+	}
+	if _, _, err := c.TaskQuery(ctx, controllers.TaskQuery{ProjectId: "project", Sort: "tags"}); err == nil {
+		t.Errorf("Expected error when sorting on tags")
+	}
+}
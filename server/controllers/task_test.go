@@ -0,0 +1,69 @@
+package controllers_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestTaskColumn(t *testing.T) {
+	settings := models.DefaultSettings()
+	tasks := []models.Task{
+		{Name: "b", State: "Review", Position: 1},
+		{Name: "a", State: "Review", Position: 0},
+		// created before workflow states existed
+		{Name: "legacy undone"},
+		{Name: "legacy done", IsDone: true},
+		{Name: "unknown state", State: "Removed"},
+	}
+
+	review := controllers.TaskColumn(settings, tasks, "Review")
+	if len(review) != 2 || review[0].Name != "a" || review[1].Name != "b" {
+		t.Errorf("Expected Review column to be [a b] but got %v", review)
+	}
+
+	backlog := controllers.TaskColumn(settings, tasks, "Backlog")
+	if len(backlog) != 2 || backlog[0].Name != "legacy undone" || backlog[1].Name != "unknown state" {
+		t.Errorf("Expected Backlog column to contain tasks without a valid state but got %v", backlog)
+	}
+
+	done := controllers.TaskColumn(settings, tasks, "Done")
+	if len(done) != 1 || done[0].Name != "legacy done" {
+		t.Errorf("Expected Done column to be [legacy done] but got %v", done)
+	}
+}
+
+func TestTaskApplyStates(t *testing.T) {
+	collection := &bulkCollection{failAt: -1}
+	c := controllers.TaskController{
+		Collection: func(name string, opts ...*options.CollectionOptions) controllers.TaskCollectionInterface {
+			return collection
+		},
+	}
+	oldSettings := models.DefaultSettings()
+	newSettings := models.ProjectSettings{States: []models.WorkflowState{{Name: "In Progress"}, {Name: "Done", IsTerminal: true}}}
+	removed := primitive.NewObjectID()
+	tasks := []models.Task{
+		{Id: primitive.NewObjectID(), State: "In Progress", Position: 0},
+		{Id: removed, State: "Backlog", Position: 0},
+		{Id: primitive.NewObjectID(), State: "In Progress", Position: 1},
+	}
+
+	if err := c.TaskApplyStates(context.Background(), oldSettings, newSettings, tasks); err != nil {
+		t.Fatal(err)
+	}
+	if len(collection.operations) != 1 {
+		t.Fatalf("Expected only the task of the removed state to be moved but got %v", collection.operations)
+	}
+	update := collection.operations[0].(*mongo.UpdateOneModel)
+	set := update.Update.(bson.D).Map()["$set"].(bson.D).Map()
+	if update.Filter.(bson.D).Map()["_id"] != removed || set["state"] != "In Progress" || set["position"] != 2 {
+		t.Errorf("Expected the task to be moved after the tasks staying in In Progress but got %v", set)
+	}
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	projectTemplateCollection = "projectTemplates"
+	taskTemplateCollection    = "taskTemplates"
+)
+
+func (c *TemplateController) ProjectTemplateCreate(ctx context.Context, template *models.ProjectTemplate) error {
+	ctx, span := tracing.Start(ctx, "TemplateController.ProjectTemplateCreate")
+	defer span.End()
+	template.CreationTime = time.Now()
+	if template.Tasks == nil {
+		template.Tasks = []models.TaskTemplate{}
+	}
+	id, err := c.ProjectCollection(projectTemplateCollection).InsertOne(ctx, template)
+	if err != nil {
+		return err
+	}
+	template.Id = id
+	return nil
+}
+
+func (c *TemplateController) ProjectTemplateRetrieve(ctx context.Context, id string) (models.ProjectTemplate, error) {
+	ctx, span := tracing.Start(ctx, "TemplateController.ProjectTemplateRetrieve")
+	defer span.End()
+	if id == "" {
+		return models.ProjectTemplate{}, errs.Validation("cannot leave template id empty")
+	}
+	template, err := c.ProjectCollection(projectTemplateCollection).FindOne(ctx, id)
+	return *template, err
+}
+
+// Returns all project templates of the user, oldest first.
+func (c *TemplateController) ProjectTemplateGetAll(ctx context.Context, userid string) ([]models.ProjectTemplate, error) {
+	ctx, span := tracing.Start(ctx, "TemplateController.ProjectTemplateGetAll")
+	defer span.End()
+	templates := []models.ProjectTemplate{}
+	filter := bson.D{{Key: "owner", Value: userid}}
+	err := c.ProjectCollection(projectTemplateCollection).FindAll(ctx, filter, &templates)
+	return templates, err
+}
+
+func (c *TemplateController) ProjectTemplateDelete(ctx context.Context, template models.ProjectTemplate) error {
+	ctx, span := tracing.Start(ctx, "TemplateController.ProjectTemplateDelete")
+	defer span.End()
+	_, err := c.ProjectCollection(projectTemplateCollection).DeleteByID(ctx, template.Id)
+	return err
+}
+
+func (c *TemplateController) TaskTemplateCreate(ctx context.Context, template *models.TaskTemplate) error {
+	ctx, span := tracing.Start(ctx, "TemplateController.TaskTemplateCreate")
+	defer span.End()
+	id, err := c.TaskCollection(taskTemplateCollection).InsertOne(ctx, template)
+	if err != nil {
+		return err
+	}
+	template.Id = id
+	return nil
+}
+
+func (c *TemplateController) TaskTemplateRetrieve(ctx context.Context, id string) (models.TaskTemplate, error) {
+	ctx, span := tracing.Start(ctx, "TemplateController.TaskTemplateRetrieve")
+	defer span.End()
+	if id == "" {
+		return models.TaskTemplate{}, errs.Validation("cannot leave template id empty")
+	}
+	template, err := c.TaskCollection(taskTemplateCollection).FindOne(ctx, id)
+	return *template, err
+}
+
+// Returns all task templates of a project, by name.
+func (c *TemplateController) TaskTemplateGetAll(ctx context.Context, projectid string) ([]models.TaskTemplate, error) {
+	ctx, span := tracing.Start(ctx, "TemplateController.TaskTemplateGetAll")
+	defer span.End()
+	templates := []models.TaskTemplate{}
+	filter := bson.D{{Key: "projectid", Value: projectid}}
+	err := c.TaskCollection(taskTemplateCollection).FindAll(ctx, filter, &templates)
+	return templates, err
+}
+
+func (c *TemplateController) TaskTemplateDelete(ctx context.Context, template models.TaskTemplate) error {
+	ctx, span := tracing.Start(ctx, "TemplateController.TaskTemplateDelete")
+	defer span.End()
+	_, err := c.TaskCollection(taskTemplateCollection).DeleteByID(ctx, template.Id)
+	return err
+}
+
+// Deletes all task templates of the project.
+func (c *TemplateController) TaskTemplateDeleteByProject(ctx context.Context, projectid string) error {
+	ctx, span := tracing.Start(ctx, "TemplateController.TaskTemplateDeleteByProject")
+	defer span.End()
+	params := bson.D{{Key: "projectid", Value: projectid}}
+	_, err := c.TaskCollection(taskTemplateCollection).DeleteMany(ctx, params)
+	return err
+}
@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ProjectTemplateCollectionInterface interface {
+	// Insert a new project template into the database
+	// Returns the object ID
+	InsertOne(ctx context.Context, template *models.ProjectTemplate) (primitive.ObjectID, error)
+
+	// Find one project template by id
+	FindOne(ctx context.Context, id string) (*models.ProjectTemplate, error)
+
+	// Find all project templates matching the filter, oldest first
+	FindAll(ctx context.Context, filter bson.D, templates *[]models.ProjectTemplate) error
+
+	// Deletes a project template by ID
+	DeleteByID(ctx context.Context, id primitive.ObjectID) (int64, error)
+}
+
+type ProjectTemplateCollection struct {
+	templateCollection MongoCollection
+}
+
+func (c *ProjectTemplateCollection) InsertOne(ctx context.Context, template *models.ProjectTemplate) (primitive.ObjectID, error) {
+	result, err := c.templateCollection.InsertOne(ctx, template)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	id := result.InsertedID.(primitive.ObjectID)
+	return id, nil
+}
+
+func (c *ProjectTemplateCollection) FindOne(ctx context.Context, id string) (*models.ProjectTemplate, error) {
+	template := models.ProjectTemplate{}
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return &template, err
+	}
+	params := bson.D{{Key: "_id", Value: objectId}}
+	err = c.templateCollection.FindOne(ctx, params).Decode(&template)
+	return &template, err
+}
+
+func (c *ProjectTemplateCollection) FindAll(ctx context.Context, filter bson.D, templates *[]models.ProjectTemplate) error {
+	opts := options.Find().SetSort(bson.D{{Key: "creationTime", Value: 1}})
+	cursor, err := c.templateCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, templates)
+}
+
+func (c *ProjectTemplateCollection) DeleteByID(ctx context.Context, id primitive.ObjectID) (int64, error) {
+	result, err := c.templateCollection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return -1, err
+	}
+	return result.DeletedCount, nil
+}
+
+type TaskTemplateCollectionInterface interface {
+	// Insert a new task template into the database
+	// Returns the object ID
+	InsertOne(ctx context.Context, template *models.TaskTemplate) (primitive.ObjectID, error)
+
+	// Find one task template by id
+	FindOne(ctx context.Context, id string) (*models.TaskTemplate, error)
+
+	// Find all task templates matching the filter, by name
+	FindAll(ctx context.Context, filter bson.D, templates *[]models.TaskTemplate) error
+
+	// Deletes a task template by ID
+	DeleteByID(ctx context.Context, id primitive.ObjectID) (int64, error)
+
+	// Delete many task templates from Task Template Collection
+	DeleteMany(ctx context.Context, params bson.D) (int64, error)
+}
+
+type TaskTemplateCollection struct {
+	templateCollection MongoCollection
+}
+
+func (c *TaskTemplateCollection) InsertOne(ctx context.Context, template *models.TaskTemplate) (primitive.ObjectID, error) {
+	result, err := c.templateCollection.InsertOne(ctx, template)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	id := result.InsertedID.(primitive.ObjectID)
+	return id, nil
+}
+
+func (c *TaskTemplateCollection) FindOne(ctx context.Context, id string) (*models.TaskTemplate, error) {
+	template := models.TaskTemplate{}
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return &template, err
+	}
+	params := bson.D{{Key: "_id", Value: objectId}}
+	err = c.templateCollection.FindOne(ctx, params).Decode(&template)
+	return &template, err
+}
+
+func (c *TaskTemplateCollection) FindAll(ctx context.Context, filter bson.D, templates *[]models.TaskTemplate) error {
+	opts := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cursor, err := c.templateCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, templates)
+}
+
+func (c *TaskTemplateCollection) DeleteByID(ctx context.Context, id primitive.ObjectID) (int64, error) {
+	result, err := c.templateCollection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return -1, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (c *TaskTemplateCollection) DeleteMany(ctx context.Context, params bson.D) (int64, error) {
+	result, err := c.templateCollection.DeleteMany(ctx, params)
+	if err != nil {
+		return -1, err
+	}
+	return result.DeletedCount, nil
+}
+
+type TemplateController struct {
+	ProjectCollection func(name string, opts ...*options.CollectionOptions) ProjectTemplateCollectionInterface
+	TaskCollection    func(name string, opts ...*options.CollectionOptions) TaskTemplateCollectionInterface
+	URL               string
+}
+
+func NewTM(database Database, URL string) *TemplateController {
+	return &TemplateController{
+		func(name string, opts ...*options.CollectionOptions) ProjectTemplateCollectionInterface {
+			return &ProjectTemplateCollection{
+				database(name, opts...),
+			}
+		},
+		func(name string, opts ...*options.CollectionOptions) TaskTemplateCollectionInterface {
+			return &TaskTemplateCollection{
+				database(name, opts...),
+			}
+		},
+		URL,
+	}
+}
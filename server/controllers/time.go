@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	timeEntryCollection = "timeEntries"
+)
+
+// Starts a timer for the user on the task.
+// Fails if the user already has a running timer.
+func (c *TimeEntryController) TimeEntryStart(ctx context.Context, entry *models.TimeEntry) error {
+	ctx, span := tracing.Start(ctx, "TimeEntryController.TimeEntryStart")
+	defer span.End()
+	if _, err := c.TimeEntryRunning(ctx, entry.UserId); err == nil {
+		return errs.Conflict("a timer is already running, stop it first")
+	} else if err != mongo.ErrNoDocuments {
+		return err
+	}
+	entry.Start = time.Now()
+	entry.End = time.Time{}
+	entry.IsRunning = true
+	entry.IsManual = false
+	id, err := c.Collection(timeEntryCollection).InsertOne(ctx, entry)
+	// the unique index on the running timers catches a timer started in the meantime
+	if mongo.IsDuplicateKeyError(err) {
+		return errs.Conflict("a timer is already running, stop it first")
+	} else if err != nil {
+		return err
+	}
+	entry.Id = id
+	return nil
+}
+
+// Returns the running timer of the user, or mongo.ErrNoDocuments if there is none.
+func (c *TimeEntryController) TimeEntryRunning(ctx context.Context, userid string) (models.TimeEntry, error) {
+	ctx, span := tracing.Start(ctx, "TimeEntryController.TimeEntryRunning")
+	defer span.End()
+	entries := []models.TimeEntry{}
+	filter := bson.D{
+		{Key: "userid", Value: userid},
+		{Key: "isRunning", Value: true},
+	}
+	if err := c.Collection(timeEntryCollection).FindAll(ctx, filter, &entries); err != nil {
+		return models.TimeEntry{}, err
+	}
+	if len(entries) == 0 {
+		return models.TimeEntry{}, mongo.ErrNoDocuments
+	}
+	return entries[0], nil
+}
+
+// Stops the running timer of the user.
+// Returns the stopped entry, or mongo.ErrNoDocuments if there is no running timer.
+func (c *TimeEntryController) TimeEntryStop(ctx context.Context, userid string) (models.TimeEntry, error) {
+	ctx, span := tracing.Start(ctx, "TimeEntryController.TimeEntryStop")
+	defer span.End()
+	entry, err := c.TimeEntryRunning(ctx, userid)
+	if err != nil {
+		return entry, err
+	}
+	entry.End = time.Now()
+	entry.IsRunning = false
+	// only stop the timer if it has not been stopped in the meantime
+	filter := bson.D{
+		{Key: "_id", Value: entry.Id},
+		{Key: "isRunning", Value: true},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "end", Value: entry.End},
+		{Key: "isRunning", Value: false},
+	}}}
+	matched, err := c.Collection(timeEntryCollection).UpdateOne(ctx, filter, update)
+	if err != nil {
+		return entry, err
+	}
+	if matched == 0 {
+		return entry, mongo.ErrNoDocuments
+	}
+	return entry, nil
+}
+
+// Logs time that was not tracked with a timer.
+func (c *TimeEntryController) TimeEntryCreate(ctx context.Context, entry *models.TimeEntry) error {
+	ctx, span := tracing.Start(ctx, "TimeEntryController.TimeEntryCreate")
+	defer span.End()
+	entry.IsRunning = false
+	entry.IsManual = true
+	id, err := c.Collection(timeEntryCollection).InsertOne(ctx, entry)
+	if err != nil {
+		return err
+	}
+	entry.Id = id
+	return nil
+}
+
+func (c *TimeEntryController) TimeEntryRetrieve(ctx context.Context, id string) (models.TimeEntry, error) {
+	ctx, span := tracing.Start(ctx, "TimeEntryController.TimeEntryRetrieve")
+	defer span.End()
+	if id == "" {
+		return models.TimeEntry{}, errs.Validation("cannot leave time entry id empty")
+	}
+	entry, err := c.Collection(timeEntryCollection).FindOne(ctx, id)
+	return *entry, err
+}
+
+// Returns all time entries of a task, earliest first.
+func (c *TimeEntryController) TimeEntryGetAll(ctx context.Context, taskid string) ([]models.TimeEntry, error) {
+	ctx, span := tracing.Start(ctx, "TimeEntryController.TimeEntryGetAll")
+	defer span.End()
+	entries := []models.TimeEntry{}
+	filter := bson.D{{Key: "taskid", Value: taskid}}
+	err := c.Collection(timeEntryCollection).FindAll(ctx, filter, &entries)
+	return entries, err
+}
+
+// Returns all time entries of a project that start within [from, to).
+// Zero times leave the range open.
+// Time logged on tasks before they recorded their projectid is found through the tasks of the project.
+func (c *TimeEntryController) TimeEntryGetByProject(ctx context.Context, project models.Project, from, to time.Time) ([]models.TimeEntry, error) {
+	ctx, span := tracing.Start(ctx, "TimeEntryController.TimeEntryGetByProject")
+	defer span.End()
+	entries := []models.TimeEntry{}
+	filter := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "projectid", Value: project.Id.Hex()}},
+		bson.D{{Key: "taskid", Value: bson.D{{Key: "$in", Value: project.Tasks}}}},
+	}}}
+	startRange := bson.D{}
+	if !from.IsZero() {
+		startRange = append(startRange, bson.E{Key: "$gte", Value: from})
+	}
+	if !to.IsZero() {
+		startRange = append(startRange, bson.E{Key: "$lt", Value: to})
+	}
+	if len(startRange) > 0 {
+		filter = append(filter, bson.E{Key: "start", Value: startRange})
+	}
+	err := c.Collection(timeEntryCollection).FindAll(ctx, filter, &entries)
+	return entries, err
+}
+
+func (c *TimeEntryController) TimeEntryDelete(ctx context.Context, entry models.TimeEntry) error {
+	ctx, span := tracing.Start(ctx, "TimeEntryController.TimeEntryDelete")
+	defer span.End()
+	_, err := c.Collection(timeEntryCollection).DeleteByID(ctx, entry.Id)
+	return err
+}
+
+// Deletes all time entries of the tasks.
+func (c *TimeEntryController) TimeEntryDeleteByTasks(ctx context.Context, taskids []string) error {
+	ctx, span := tracing.Start(ctx, "TimeEntryController.TimeEntryDeleteByTasks")
+	defer span.End()
+	params := bson.D{{Key: "taskid", Value: bson.D{{Key: "$in", Value: taskids}}}}
+	_, err := c.Collection(timeEntryCollection).DeleteMany(ctx, params)
+	return err
+}
+
+// Aggregates the time entries of a project by member, tag and week.
+// Running timers count up till now.
+func TimeReport(projectid string, tasks []models.Task, entries []models.TimeEntry, now time.Time) models.TimeReport {
+	taskMap := map[string]models.Task{}
+	var estimate int64
+	for _, task := range tasks {
+		taskMap[task.Id.Hex()] = task
+		estimate += int64(task.Estimate)
+	}
+
+	var total time.Duration
+	members := map[string]time.Duration{}
+	tags := map[string]time.Duration{}
+	weeks := map[string]time.Duration{}
+	for _, entry := range entries {
+		duration := entry.Duration(now)
+		total += duration
+		members[entry.UserId] += duration
+		task := taskMap[entry.TaskId]
+		if len(task.Tags) == 0 {
+			tags[""] += duration
+		}
+		for _, tag := range task.Tags {
+			tags[tag] += duration
+		}
+		year, week := entry.Start.ISOWeek()
+		weeks[fmt.Sprintf("%04d-W%02d", year, week)] += duration
+	}
+
+	return models.TimeReport{
+		ProjectId: projectid,
+		Total:     int64(total / time.Minute),
+		Estimate:  estimate,
+		Members:   timeReportRows(members),
+		Tags:      timeReportRows(tags),
+		Weeks:     timeReportRows(weeks),
+	}
+}
+
+// Converts the durations to rows sorted by key.
+func timeReportRows(durations map[string]time.Duration) []models.TimeReportRow {
+	rows := []models.TimeReportRow{}
+	for key, duration := range durations {
+		rows = append(rows, models.TimeReportRow{Key: key, Minutes: int64(duration / time.Minute)})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Key < rows[j].Key
+	})
+	return rows
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type TimeEntryCollectionInterface interface {
+	// Insert a new time entry into the database
+	// Returns the object ID
+	InsertOne(ctx context.Context, entry *models.TimeEntry) (primitive.ObjectID, error)
+
+	// Find one time entry by id
+	FindOne(ctx context.Context, id string) (*models.TimeEntry, error)
+
+	// Find all time entries matching the filter, earliest first
+	FindAll(ctx context.Context, filter bson.D, entries *[]models.TimeEntry) error
+
+	// Modifies the first time entry matching the filter
+	// Returns the number of matched entries
+	UpdateOne(ctx context.Context, filter bson.D, params bson.D) (int64, error)
+
+	// Deletes a time entry by ID
+	DeleteByID(ctx context.Context, id primitive.ObjectID) (int64, error)
+
+	// Delete many time entries from TimeEntry Collection
+	DeleteMany(ctx context.Context, params bson.D) (int64, error)
+}
+
+type TimeEntryCollection struct {
+	timeEntryCollection MongoCollection
+}
+
+func (c *TimeEntryCollection) InsertOne(ctx context.Context, entry *models.TimeEntry) (primitive.ObjectID, error) {
+	result, err := c.timeEntryCollection.InsertOne(ctx, entry)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	id := result.InsertedID.(primitive.ObjectID)
+	return id, nil
+}
+
+func (c *TimeEntryCollection) FindOne(ctx context.Context, id string) (*models.TimeEntry, error) {
+	entry := models.TimeEntry{}
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return &entry, err
+	}
+	params := bson.D{{Key: "_id", Value: objectId}}
+	err = c.timeEntryCollection.FindOne(ctx, params).Decode(&entry)
+	return &entry, err
+}
+
+func (c *TimeEntryCollection) FindAll(ctx context.Context, filter bson.D, entries *[]models.TimeEntry) error {
+	opts := options.Find().SetSort(bson.D{{Key: "start", Value: 1}})
+	cursor, err := c.timeEntryCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, entries)
+}
+
+func (c *TimeEntryCollection) UpdateOne(ctx context.Context, filter bson.D, params bson.D) (int64, error) {
+	result, err := c.timeEntryCollection.UpdateOne(ctx, filter, params)
+	if err != nil {
+		return 0, err
+	}
+	return result.MatchedCount, nil
+}
+
+func (c *TimeEntryCollection) DeleteByID(ctx context.Context, id primitive.ObjectID) (int64, error) {
+	result, err := c.timeEntryCollection.DeleteOne(ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return -1, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (c *TimeEntryCollection) DeleteMany(ctx context.Context, params bson.D) (int64, error) {
+	result, err := c.timeEntryCollection.DeleteMany(ctx, params)
+	if err != nil {
+		return -1, err
+	}
+	return result.DeletedCount, nil
+}
+
+type TimeEntryController struct {
+	Collection func(name string, opts ...*options.CollectionOptions) TimeEntryCollectionInterface
+	URL        string
+}
+
+func NewTE(database Database, URL string) *TimeEntryController {
+	return &TimeEntryController{
+		func(name string, opts ...*options.CollectionOptions) TimeEntryCollectionInterface {
+			return &TimeEntryCollection{
+				database(name, opts...),
+			}
+		},
+		URL,
+	}
+}
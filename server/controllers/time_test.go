@@ -0,0 +1,80 @@
+package controllers_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/testdb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTimeReport(t *testing.T) {
+	design := models.Task{Id: primitive.NewObjectID(), Tags: []string{"design", "ui"}, Estimate: 120}
+	untagged := models.Task{Id: primitive.NewObjectID(), Estimate: 30}
+	tasks := []models.Task{design, untagged}
+
+	// Monday of ISO week 5 of 2022
+	monday := time.Date(2022, 1, 31, 9, 0, 0, 0, time.UTC)
+	now := monday.AddDate(0, 0, 7)
+	entries := []models.TimeEntry{
+		{TaskId: design.Id.Hex(), UserId: "alice", Start: monday, End: monday.Add(90 * time.Minute)},
+		{TaskId: untagged.Id.Hex(), UserId: "bob", Start: monday.AddDate(0, 0, -1), End: monday.AddDate(0, 0, -1).Add(30 * time.Minute)},
+		// running timer counts up till now
+		{TaskId: untagged.Id.Hex(), UserId: "alice", Start: now.Add(-15 * time.Minute), IsRunning: true},
+	}
+
+	report := controllers.TimeReport("project", tasks, entries, now)
+
+	if report.Total != 135 {
+		t.Errorf("Expected total of 135 but got %v", report.Total)
+	}
+	if report.Estimate != 150 {
+		t.Errorf("Expected estimate of 150 but got %v", report.Estimate)
+	}
+	expectedMembers := []models.TimeReportRow{{Key: "alice", Minutes: 105}, {Key: "bob", Minutes: 30}}
+	if !reflect.DeepEqual(report.Members, expectedMembers) {
+		t.Errorf("Expected members %v but got %v", expectedMembers, report.Members)
+	}
+	expectedTags := []models.TimeReportRow{{Key: "", Minutes: 45}, {Key: "design", Minutes: 90}, {Key: "ui", Minutes: 90}}
+	if !reflect.DeepEqual(report.Tags, expectedTags) {
+		t.Errorf("Expected tags %v but got %v", expectedTags, report.Tags)
+	}
+	// the entry on Sunday belongs to the previous week
+	expectedWeeks := []models.TimeReportRow{{Key: "2022-W04", Minutes: 30}, {Key: "2022-W05", Minutes: 90}, {Key: "2022-W06", Minutes: 15}}
+	if !reflect.DeepEqual(report.Weeks, expectedWeeks) {
+		t.Errorf("Expected weeks %v but got %v", expectedWeeks, report.Weeks)
+	}
+}
+
+func TestTimeEntryGetByProject(t *testing.T) {
+	ctx := context.Background()
+	c := controllers.NewTE(testdb.New(), "")
+	project := models.Project{Id: primitive.NewObjectID(), Tasks: []string{"legacy", "task"}}
+	start := time.Date(2022, 7, 1, 9, 0, 0, 0, time.UTC)
+	entries := []models.TimeEntry{
+		{TaskId: "task", ProjectId: project.Id.Hex(), UserId: "alice", Start: start},
+		// logged before the task recorded its projectid
+		{TaskId: "legacy", UserId: "alice", Start: start},
+		{TaskId: "personal", UserId: "alice", Start: start},
+		// before the range
+		{TaskId: "task", ProjectId: project.Id.Hex(), UserId: "alice", Start: start.AddDate(0, 0, -1)},
+	}
+	for i := range entries {
+		entries[i].End = entries[i].Start.Add(time.Hour)
+		if err := c.TimeEntryCreate(ctx, &entries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := c.TimeEntryGetByProject(ctx, project, start, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found[0].Id != entries[0].Id || found[1].Id != entries[1].Id {
+		t.Errorf("Expected the entries of the project and its legacy task in range, got %+v", found)
+	}
+}
@@ -0,0 +1,326 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+	Deleted tasks, projects and events are moved to the trash by setting deletedAt instead of being removed.
+	FindOne and FindAll of their collections exclude them, so the rest of the server does not see them.
+	The functions here are the only way to reach items in the trash, until they are restored or purged.
+*/
+
+var (
+	// filter for documents not in the trash
+	notDeleted = bson.E{Key: "deletedAt", Value: nil}
+	// filter for documents in the trash
+	isDeleted = bson.E{Key: "deletedAt", Value: bson.D{{Key: "$ne", Value: nil}}}
+)
+
+// most recently deleted first
+var trashSort = options.Find().SetSort(bson.D{{Key: "deletedAt", Value: -1}})
+
+func toObjectIDs(ids []string) []primitive.ObjectID {
+	objectids := []primitive.ObjectID{}
+	for _, id := range ids {
+		if objectid, err := primitive.ObjectIDFromHex(id); err == nil {
+			objectids = append(objectids, objectid)
+		}
+	}
+	return objectids
+}
+
+// Moves the tasks of the project (projectid empty for personal tasks) to the trash.
+// Tasks already in the trash keep their original deletion time.
+// The projectid is recorded, as tasks created before they recorded it cannot be found through the project once removed from it.
+func (c *TaskController) TaskSoftDelete(ctx context.Context, taskids []string, projectid string, at time.Time) error {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskSoftDelete")
+	defer span.End()
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: toObjectIDs(taskids)}}}, notDeleted}
+	_, err := c.Collection(taskCollection).UpdateMany(ctx, filter, taskTrashUpdate(projectid, at))
+	return err
+}
+
+// Moves the task to the trash, as TaskSoftDelete does.
+// If version is not nil, the task is only moved if it is still at the version, else a precondition error is returned.
+func (c *TaskController) TaskSoftDeleteOne(ctx context.Context, taskid, projectid string, version *int64, at time.Time) error {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskSoftDeleteOne")
+	defer span.End()
+	if version == nil {
+		return c.TaskSoftDelete(ctx, []string{taskid}, projectid, at)
+	}
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: toObjectIDs([]string{taskid})}}}, notDeleted, atVersion(*version)}
+	result, err := c.Collection(taskCollection).UpdateMany(ctx, filter, taskTrashUpdate(projectid, at))
+	return checkVersion(result, err, "task")
+}
+
+func taskTrashUpdate(projectid string, at time.Time) bson.D {
+	params := bson.D{{Key: "deletedAt", Value: at}}
+	if projectid != "" {
+		params = append(params, bson.E{Key: "projectid", Value: projectid})
+	}
+	return bson.D{{Key: "$set", Value: params}}
+}
+
+// Returns the task with the id, only if it is in the trash.
+func (c *TaskController) TaskRetrieveDeleted(ctx context.Context, id string) (models.Task, error) {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskRetrieveDeleted")
+	defer span.End()
+	tasks, err := c.findTasks(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: toObjectIDs([]string{id})}}}, isDeleted})
+	if err != nil {
+		return models.Task{}, err
+	} else if len(tasks) == 0 {
+		return models.Task{}, mongo.ErrNoDocuments
+	}
+	return tasks[0], nil
+}
+
+// Returns the tasks of the project in the trash, or the personal tasks of the user if projectid is empty.
+func (c *TaskController) TaskTrash(ctx context.Context, userid, projectid string) ([]models.Task, error) {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskTrash")
+	defer span.End()
+	filter := bson.D{{Key: "projectid", Value: projectid}, isDeleted}
+	if projectid == "" {
+		filter = bson.D{{Key: "assignedTo", Value: userid}, {Key: "isPersonal", Value: true}, isDeleted}
+	}
+	return c.findTasks(ctx, filter, trashSort)
+}
+
+// Takes the tasks out of the trash.
+func (c *TaskController) TaskRestore(ctx context.Context, taskids []string) error {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskRestore")
+	defer span.End()
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: toObjectIDs(taskids)}}}}
+	update := bson.D{{Key: "$unset", Value: bson.D{{Key: "deletedAt", Value: ""}}}}
+	_, err := c.Collection(taskCollection).UpdateMany(ctx, filter, update)
+	return err
+}
+
+// Takes the tasks that were deleted together with the project out of the trash, and returns them.
+// Tasks created before they recorded their projectid are found through the tasks of the project.
+func (c *TaskController) TaskRestoreWithProject(ctx context.Context, project models.Project, deletedAt time.Time) ([]models.Task, error) {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskRestoreWithProject")
+	defer span.End()
+	filter := bson.D{
+		{Key: "$or", Value: bson.A{
+			bson.D{{Key: "projectid", Value: project.Id.Hex()}},
+			bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: toObjectIDs(project.Tasks)}}}},
+		}},
+		{Key: "deletedAt", Value: deletedAt},
+	}
+	tasks, err := c.findTasks(ctx, filter)
+	if err != nil || len(tasks) == 0 {
+		return tasks, err
+	}
+	taskids := make([]string, len(tasks))
+	for i, task := range tasks {
+		taskids[i] = task.Id.Hex()
+	}
+	return tasks, c.TaskRestore(ctx, taskids)
+}
+
+// Returns the tasks that were moved to the trash before the time.
+func (c *TaskController) TaskFindPurgeable(ctx context.Context, before time.Time) ([]models.Task, error) {
+	ctx, span := tracing.Start(ctx, "TaskController.TaskFindPurgeable")
+	defer span.End()
+	return c.findTasks(ctx, bson.D{{Key: "deletedAt", Value: bson.D{{Key: "$lt", Value: before}}}})
+}
+
+func (c *TaskController) findTasks(ctx context.Context, filter bson.D, opts ...*options.FindOptions) ([]models.Task, error) {
+	ctx, span := tracing.Start(ctx, "TaskController.findTasks")
+	defer span.End()
+	cursor, err := c.Collection(taskCollection).Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	tasks := []models.Task{}
+	if err := cursor.All(ctx, &tasks); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// Moves the project to the trash.
+// If version is not nil, the project is only moved if it is still at the version, else a precondition error is returned.
+func (c *ProjectController) ProjectSoftDelete(ctx context.Context, id primitive.ObjectID, version *int64, at time.Time) error {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectSoftDelete")
+	defer span.End()
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "deletedAt", Value: at}}}}
+	if version == nil {
+		_, err := c.Collection(projectCollection).UpdateByID(ctx, id, update)
+		return err
+	}
+	result, err := c.Collection(projectCollection).UpdateByVersion(ctx, id, *version, update)
+	return checkVersion(result, err, "project")
+}
+
+// Returns the project with the id, only if it is in the trash.
+func (c *ProjectController) ProjectRetrieveDeleted(ctx context.Context, id string) (models.Project, error) {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectRetrieveDeleted")
+	defer span.End()
+	projects, err := c.findProjects(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: toObjectIDs([]string{id})}}}, isDeleted})
+	if err != nil {
+		return models.Project{}, err
+	} else if len(projects) == 0 {
+		return models.Project{}, mongo.ErrNoDocuments
+	}
+	return projects[0], nil
+}
+
+// Returns the projects in the trash that the user was a member of.
+func (c *ProjectController) ProjectTrash(ctx context.Context, userid string) ([]models.Project, error) {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectTrash")
+	defer span.End()
+	filter := bson.D{{Key: "members." + userid, Value: bson.D{{Key: "$exists", Value: true}}}, isDeleted}
+	return c.findProjects(ctx, filter, trashSort)
+}
+
+// Takes the project out of the trash.
+func (c *ProjectController) ProjectRestore(ctx context.Context, id primitive.ObjectID) error {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectRestore")
+	defer span.End()
+	update := bson.D{{Key: "$unset", Value: bson.D{{Key: "deletedAt", Value: ""}}}}
+	_, err := c.Collection(projectCollection).UpdateByID(ctx, id, update)
+	return err
+}
+
+// Returns the projects that were moved to the trash before the time.
+func (c *ProjectController) ProjectFindPurgeable(ctx context.Context, before time.Time) ([]models.Project, error) {
+	ctx, span := tracing.Start(ctx, "ProjectController.ProjectFindPurgeable")
+	defer span.End()
+	return c.findProjects(ctx, bson.D{{Key: "deletedAt", Value: bson.D{{Key: "$lt", Value: before}}}})
+}
+
+func (c *ProjectController) findProjects(ctx context.Context, filter bson.D, opts ...*options.FindOptions) ([]models.Project, error) {
+	ctx, span := tracing.Start(ctx, "ProjectController.findProjects")
+	defer span.End()
+	cursor, err := c.Collection(projectCollection).Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	projects := []models.Project{}
+	if err := cursor.All(ctx, &projects); err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+// Moves the events of the user (projectid empty) or the project to the trash.
+// userid is the user deleting the events.
+func (c *EventController) EventSoftDelete(ctx context.Context, eventids []string, userid, projectid string, at time.Time) error {
+	ctx, span := tracing.Start(ctx, "EventController.EventSoftDelete")
+	defer span.End()
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: toObjectIDs(eventids)}}}, notDeleted}
+	_, err := c.Collection(eventCollection).UpdateMany(ctx, filter, eventTrashUpdate(userid, projectid, at))
+	return err
+}
+
+// Moves the event to the trash, as EventSoftDelete does.
+// If version is not nil, the event is only moved if it is still at the version, else a precondition error is returned.
+func (c *EventController) EventSoftDeleteOne(ctx context.Context, eventid, userid, projectid string, version *int64, at time.Time) error {
+	ctx, span := tracing.Start(ctx, "EventController.EventSoftDeleteOne")
+	defer span.End()
+	if version == nil {
+		return c.EventSoftDelete(ctx, []string{eventid}, userid, projectid, at)
+	}
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: toObjectIDs([]string{eventid})}}}, notDeleted, atVersion(*version)}
+	result, err := c.Collection(eventCollection).UpdateMany(ctx, filter, eventTrashUpdate(userid, projectid, at))
+	return checkVersion(result, err, "event")
+}
+
+func eventTrashUpdate(userid, projectid string, at time.Time) bson.D {
+	params := bson.D{
+		{Key: "deletedAt", Value: at},
+		{Key: "deletedBy", Value: userid},
+	}
+	if projectid != "" {
+		params = append(params, bson.E{Key: "deletedFrom", Value: projectid})
+	}
+	return bson.D{{Key: "$set", Value: params}}
+}
+
+// Returns the event with the id, only if it is in the trash.
+func (c *EventController) EventRetrieveDeleted(ctx context.Context, id string) (models.Event, error) {
+	ctx, span := tracing.Start(ctx, "EventController.EventRetrieveDeleted")
+	defer span.End()
+	events, err := c.findEvents(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: toObjectIDs([]string{id})}}}, isDeleted})
+	if err != nil {
+		return models.Event{}, err
+	} else if len(events) == 0 {
+		return models.Event{}, mongo.ErrNoDocuments
+	}
+	return events[0], nil
+}
+
+// Returns the events of the project in the trash, or the personal events of the user if projectid is empty.
+func (c *EventController) EventTrash(ctx context.Context, userid, projectid string) ([]models.Event, error) {
+	ctx, span := tracing.Start(ctx, "EventController.EventTrash")
+	defer span.End()
+	filter := bson.D{{Key: "deletedFrom", Value: projectid}, isDeleted}
+	if projectid == "" {
+		filter = bson.D{
+			{Key: "deletedBy", Value: userid},
+			{Key: "deletedFrom", Value: bson.D{{Key: "$exists", Value: false}}},
+			isDeleted,
+		}
+	}
+	return c.findEvents(ctx, filter, trashSort)
+}
+
+// Takes the events out of the trash.
+func (c *EventController) EventRestore(ctx context.Context, eventids []string) error {
+	ctx, span := tracing.Start(ctx, "EventController.EventRestore")
+	defer span.End()
+	filter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: toObjectIDs(eventids)}}}}
+	update := bson.D{{Key: "$unset", Value: bson.D{
+		{Key: "deletedAt", Value: ""},
+		{Key: "deletedBy", Value: ""},
+		{Key: "deletedFrom", Value: ""},
+	}}}
+	_, err := c.Collection(eventCollection).UpdateMany(ctx, filter, update)
+	return err
+}
+
+// Takes the events that were deleted together with the project out of the trash.
+func (c *EventController) EventRestoreWithProject(ctx context.Context, projectid string, deletedAt time.Time) error {
+	ctx, span := tracing.Start(ctx, "EventController.EventRestoreWithProject")
+	defer span.End()
+	filter := bson.D{{Key: "deletedFrom", Value: projectid}, {Key: "deletedAt", Value: deletedAt}}
+	update := bson.D{{Key: "$unset", Value: bson.D{
+		{Key: "deletedAt", Value: ""},
+		{Key: "deletedBy", Value: ""},
+		{Key: "deletedFrom", Value: ""},
+	}}}
+	_, err := c.Collection(eventCollection).UpdateMany(ctx, filter, update)
+	return err
+}
+
+// Permanently deletes the events that were moved to the trash before the time.
+// Returns the number of events deleted.
+func (c *EventController) EventPurge(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := tracing.Start(ctx, "EventController.EventPurge")
+	defer span.End()
+	return c.Collection(eventCollection).DeleteMany(ctx, bson.D{{Key: "deletedAt", Value: bson.D{{Key: "$lt", Value: before}}}})
+}
+
+func (c *EventController) findEvents(ctx context.Context, filter bson.D, opts ...*options.FindOptions) ([]models.Event, error) {
+	ctx, span := tracing.Start(ctx, "EventController.findEvents")
+	defer span.End()
+	cursor, err := c.Collection(eventCollection).Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	events := []models.Event{}
+	if err := cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
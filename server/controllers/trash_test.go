@@ -0,0 +1,91 @@
+package controllers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Records the filter and update of UpdateMany.
+type updateManyCollection struct {
+	controllers.TaskCollectionInterface
+	filter bson.D
+	update bson.D
+}
+
+func (c *updateManyCollection) UpdateMany(ctx context.Context, filter bson.D, params bson.D) (*mongo.UpdateResult, error) {
+	c.filter = filter
+	c.update = params
+	return &mongo.UpdateResult{}, nil
+}
+
+func TestTaskSoftDelete(t *testing.T) {
+	collection := &updateManyCollection{}
+	c := controllers.TaskController{
+		Collection: func(name string, opts ...*options.CollectionOptions) controllers.TaskCollectionInterface {
+			return collection
+		},
+	}
+	ctx := context.Background()
+	now := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	taskid := primitive.NewObjectID()
+
+	if err := c.TaskSoftDelete(ctx, []string{taskid.Hex(), "invalid"}, "project", now); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	filter := collection.filter.Map()
+	if ids := filter["_id"].(bson.D).Map()["$in"].([]primitive.ObjectID); len(ids) != 1 || ids[0] != taskid {
+		t.Errorf("Expected only the valid taskid to be deleted but got %v", ids)
+	}
+	// tasks already in the trash keep their original deletion time
+	if deletedAt, ok := filter["deletedAt"]; !ok || deletedAt != nil {
+		t.Errorf("Expected tasks already in the trash to be excluded but got %v", collection.filter)
+	}
+	if deletedAt := collection.update.Map()["$set"].(bson.D).Map()["deletedAt"]; deletedAt != now {
+		t.Errorf("Expected deletedAt to be set to %v but got %v", now, deletedAt)
+	}
+	// recorded for tasks created before they recorded their projectid
+	if projectid := collection.update.Map()["$set"].(bson.D).Map()["projectid"]; projectid != "project" {
+		t.Errorf("Expected projectid to be set to project but got %v", projectid)
+	}
+
+	if err := c.TaskRestore(ctx, []string{taskid.Hex()}); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if _, ok := collection.update.Map()["$unset"].(bson.D).Map()["deletedAt"]; !ok {
+		t.Errorf("Expected deletedAt to be removed but got %v", collection.update)
+	}
+}
+
+func TestTaskBulkDeleteMovesToTrash(t *testing.T) {
+	collection := &bulkCollection{failAt: -1}
+	activity := &activityCollection{}
+	c := controllers.TaskController{
+		Collection: func(name string, opts ...*options.CollectionOptions) controllers.TaskCollectionInterface {
+			return collection
+		},
+		ActivityCollection: func(name string, opts ...*options.CollectionOptions) controllers.TaskActivityCollectionInterface {
+			return activity
+		},
+	}
+	tasks := []models.Task{{Id: primitive.NewObjectID()}}
+
+	errs := c.TaskBulk(context.Background(), "user", tasks, controllers.TaskBulkOperation{Type: controllers.TaskBulkDelete})
+	if errs[0] != nil {
+		t.Fatalf("Expected no error but got %v", errs[0])
+	}
+	operation, ok := collection.operations[0].(*mongo.UpdateOneModel)
+	if !ok {
+		t.Fatalf("Expected the task to be updated instead of deleted but got %v", collection.operations[0])
+	}
+	if _, ok := operation.Update.(bson.D).Map()["$set"].(bson.D).Map()["deletedAt"]; !ok {
+		t.Errorf("Expected deletedAt to be set but got %v", operation.Update)
+	}
+}
@@ -2,15 +2,17 @@ package controllers
 
 import (
 	"context"
-	"errors"
 
 	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
 	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 const (
@@ -19,9 +21,11 @@ const (
 
 // Retrives a user by id or name.
 func (c *UserController) UserRetrieve(ctx context.Context, id, name string) (models.User, error) {
+	ctx, span := tracing.Start(ctx, "UserController.UserRetrieve")
+	defer span.End()
 	var user models.User
 	if id == "" && name == "" {
-		return user, errors.New("cannot leave both user id and name empty")
+		return user, errs.Validation("cannot leave both user id and name empty")
 	}
 	_, err := c.Collection(userCollection).FindOne(ctx, &user, id, name, "")
 
@@ -30,9 +34,11 @@ func (c *UserController) UserRetrieve(ctx context.Context, id, name string) (mod
 
 // Checks if a user with a particular name OR email exists.
 func (c *UserController) UserExists(ctx context.Context, name, email string) (bool, error) {
+	ctx, span := tracing.Start(ctx, "UserController.UserExists")
+	defer span.End()
 	var user models.User
 	if name == "" && email == "" {
-		return false, errors.New("cannot leave both name and email empty")
+		return false, errs.Validation("cannot leave both name and email empty")
 	}
 	_, err := c.Collection(userCollection).FindOne(ctx, &user, "", name, email)
 	if err == nil {
@@ -45,6 +51,8 @@ func (c *UserController) UserExists(ctx context.Context, name, email string) (bo
 
 // Creates a new user.
 func (c *UserController) UserCreate(ctx context.Context, user *models.User) error {
+	ctx, span := tracing.Start(ctx, "UserController.UserCreate")
+	defer span.End()
 	id, err := c.Collection(userCollection).InsertOne(ctx, user)
 	if err != nil {
 		return err
@@ -56,6 +64,8 @@ func (c *UserController) UserCreate(ctx context.Context, user *models.User) erro
 // Verifies PIN from email verification. If successful, also marks the user as verified in the database.
 // Also returns the user ID for creation of JWT.
 func (c *UserController) UserVerifyPin(ctx context.Context, name, pin string) (primitive.ObjectID, error) {
+	ctx, span := tracing.Start(ctx, "UserController.UserVerifyPin")
+	defer span.End()
 	var user models.User
 	_, err := c.Collection(userCollection).FindOne(ctx, &user, "", name, "")
 	if err != nil {
@@ -71,21 +81,23 @@ func (c *UserController) UserVerifyPin(ctx context.Context, name, pin string) (p
 		}
 		return user.Id, nil
 	}
-	return primitive.NilObjectID, errors.New("wrong pin")
+	return primitive.NilObjectID, errs.Validation("wrong pin")
 }
 
 // Checks whether the password matches the hashed password for a particular username.
 // Also validates if the user is verified.
 func (c *UserController) UserCheckPassword(ctx context.Context, user *models.User) (bool, error) {
+	ctx, span := tracing.Start(ctx, "UserController.UserCheckPassword")
+	defer span.End()
 	password := user.Password
 	_, err := c.Collection(userCollection).FindOne(ctx, user, "", user.Name, "")
 	if err != nil {
-		return false, errors.New("username and password do not match")
+		return false, errs.Unauthorized("username and password do not match")
 	} else if !user.Verified {
-		return false, errors.New("please verify the account first")
+		return false, errs.Forbidden("please verify the account first")
 	}
 	if !auth.CheckPasswordHash(user.Password, password) {
-		return false, errors.New("username and password do not match")
+		return false, errs.Unauthorized("username and password do not match")
 	}
 	return true, nil
 }
@@ -93,12 +105,14 @@ func (c *UserController) UserCheckPassword(ctx context.Context, user *models.Use
 // Step 1 of Forgot Password protocol.
 // If user requests for password reset multiple times, only the latest one will be valid.
 func (c *UserController) UserForgotPW(ctx context.Context, name, hash string) (string, error) {
+	ctx, span := tracing.Start(ctx, "UserController.UserForgotPW")
+	defer span.End()
 	var user models.User
 	_, err := c.Collection(userCollection).FindOne(ctx, &user, "", name, "")
 	if err != nil {
 		return "", err
 	} else if !user.Verified {
-		return "", errors.New("user not verified")
+		return "", errs.Forbidden("user not verified")
 	}
 	update := bson.D{{Key: "$set", Value: bson.D{
 		{Key: "forgotPw", Value: true},
@@ -112,28 +126,32 @@ func (c *UserController) UserForgotPW(ctx context.Context, name, hash string) (s
 
 // Step 2 of Forgot Password protocol.
 func (c *UserController) UserVerifyForgotPW(ctx context.Context, name, pin string) (bool, error) {
+	ctx, span := tracing.Start(ctx, "UserController.UserVerifyForgotPW")
+	defer span.End()
 	var user models.User
 	_, err := c.Collection(userCollection).FindOne(ctx, &user, "", name, "")
 	if err != nil {
 		return false, err
 	} else if !user.ForgotPW {
-		return false, errors.New("user did not request for a password reset")
+		return false, errs.Conflict("user did not request for a password reset")
 	} else if !auth.CheckPasswordHash(user.ForgotPWPin, pin) {
-		return false, errors.New("pin is incorrect")
+		return false, errs.Validation("pin is incorrect")
 	}
 	return true, err
 }
 
 // Step 3 of Forgot Password protocol.
 func (c *UserController) UserChangeForgotPW(ctx context.Context, name, pin, hash string) error {
+	ctx, span := tracing.Start(ctx, "UserController.UserChangeForgotPW")
+	defer span.End()
 	var user models.User
 	_, err := c.Collection(userCollection).FindOne(ctx, &user, "", name, "")
 	if err != nil {
 		return err
 	} else if !user.ForgotPW {
-		return errors.New("user did not request for a password reset")
+		return errs.Conflict("user did not request for a password reset")
 	} else if !auth.CheckPasswordHash(user.ForgotPWPin, pin) {
-		return errors.New("pin is incorrect")
+		return errs.Validation("pin is incorrect")
 	}
 	update := bson.D{{Key: "$set", Value: bson.D{
 		{Key: "forgotPw", Value: false},
@@ -147,7 +165,10 @@ func (c *UserController) UserChangeForgotPW(ctx context.Context, name, pin, hash
 }
 
 // Modifies the user's Name, Password, Email.
-func (c *UserController) UserModify(ctx context.Context, user *models.User) {
+// If version is not nil, the user is only modified if it is still at the version, else a precondition error is returned.
+func (c *UserController) UserModify(ctx context.Context, user *models.User, version *int64) error {
+	ctx, span := tracing.Start(ctx, "UserController.UserModify")
+	defer span.End()
 	params := bson.D{}
 	if user.Name != "" {
 		params = append(params, bson.E{Key: "name", Value: user.Name})
@@ -159,63 +180,130 @@ func (c *UserController) UserModify(ctx context.Context, user *models.User) {
 		params = append(params, bson.E{Key: "email", Value: user.Email})
 	}
 	update := bson.D{{Key: "$set", Value: params}}
-	c.Collection(userCollection).UpdateByID(ctx, user.Id, update)
+	if version == nil {
+		_, err := c.Collection(userCollection).UpdateByID(ctx, user.Id, update)
+		return err
+	}
+	result, err := c.Collection(userCollection).UpdateByVersion(ctx, user.Id, *version, update)
+	return checkVersion(result, err, "user")
 }
 
 // Deletes the user.
-func (c *UserController) UserDelete(ctx context.Context, id string) error {
-	_, err := c.Collection(userCollection).DeleteByID(ctx, id)
+// If version is not nil, the user is only deleted if it is still at the version, else a precondition error is returned.
+func (c *UserController) UserDelete(ctx context.Context, id string, version *int64) error {
+	ctx, span := tracing.Start(ctx, "UserController.UserDelete")
+	defer span.End()
+	if version == nil {
+		_, err := c.Collection(userCollection).DeleteByID(ctx, id)
+		return err
+	}
+	deleted, err := c.Collection(userCollection).DeleteByVersion(ctx, id, *version)
 	if err != nil {
 		return err
 	}
+	if deleted == 0 {
+		return errs.Precondition("user was modified since it was read")
+	}
 	return nil
 }
 
 func (c *UserController) UserAddProject(ctx context.Context, userid primitive.ObjectID, projectid string) {
+	ctx, span := tracing.Start(ctx, "UserController.UserAddProject")
+	defer span.End()
 	params := bson.D{}
 	params = append(params, bson.E{Key: "projects", Value: projectid})
 	update := bson.D{{Key: "$addToSet", Value: params}}
 	c.Collection(userCollection).UpdateByID(ctx, userid, update)
 }
 
-func (c *UserController) UsersAddProject(ctx context.Context, useridArr []string, projectId string) {
+func (c *UserController) UsersAddProject(ctx context.Context, useridArr []string, projectId string) error {
+	ctx, span := tracing.Start(ctx, "UserController.UsersAddProject")
+	defer span.End()
+	if len(useridArr) == 0 {
+		return nil
+	}
 	params := bson.D{{Key: "$addToSet", Value: bson.D{{Key: "projects", Value: projectId}}}}
 	var primitiveArr []primitive.ObjectID
 	for _, userid := range useridArr {
 		primitiveId, _ := primitive.ObjectIDFromHex(userid)
 		primitiveArr = append(primitiveArr, primitiveId)
 	}
-	c.Collection(userCollection).UpdateManyByID(ctx, primitiveArr, params)
+	_, err := c.Collection(userCollection).UpdateManyByID(ctx, primitiveArr, params)
+	return err
 }
 
-func (c *UserController) UsersDeleteProject(ctx context.Context, useridArr []string, projectId string) {
-	params := bson.D{{Key: "$pull", Value: bson.D{{Key: "projects", Value: projectId}}}}
-	if len(useridArr) == 0 {
-		c.Collection(userCollection).UpdateAll(ctx, params)
-	} else {
-		var primitiveArr []primitive.ObjectID
-		for _, userid := range useridArr {
-			primitiveId, _ := primitive.ObjectIDFromHex(userid)
-			primitiveArr = append(primitiveArr, primitiveId)
-		}
-		c.Collection(userCollection).UpdateManyByID(ctx, primitiveArr, params)
+// Removes the project from the users, or from every user if useridArr is empty.
+// Only the users with the project are updated, so that the versions of the others stay the same.
+func (c *UserController) UsersDeleteProject(ctx context.Context, useridArr []string, projectId string) error {
+	ctx, span := tracing.Start(ctx, "UserController.UsersDeleteProject")
+	defer span.End()
+	filter := bson.D{{Key: "projects", Value: projectId}}
+	if len(useridArr) != 0 {
+		filter = append(filter, bson.E{Key: "_id", Value: bson.D{{Key: "$in", Value: toObjectIDs(useridArr)}}})
 	}
+	params := bson.D{{Key: "$pull", Value: bson.D{{Key: "projects", Value: projectId}}}}
+	_, err := c.Collection(userCollection).UpdateMany(ctx, filter, params)
+	return err
 }
 
 func (c *UserController) UsersInviteFromProject(ctx context.Context, usernames []string, projectId string) {
+	ctx, span := tracing.Start(ctx, "UserController.UsersInviteFromProject")
+	defer span.End()
 	params := bson.D{{Key: "$addToSet", Value: bson.D{{Key: "invites", Value: projectId}}}}
 	c.Collection(userCollection).UpdateManyByName(ctx, usernames, params)
 }
 
 // Modifies task array of user
 func (c *UserController) UserModifyTask(ctx context.Context, user *models.User) {
+	ctx, span := tracing.Start(ctx, "UserController.UserModifyTask")
+	defer span.End()
 	params := bson.D{}
 	params = append(params, bson.E{Key: "tasks", Value: user.Tasks})
 	update := bson.D{{Key: "$set", Value: params}}
 	c.Collection(userCollection).UpdateByID(ctx, user.Id, update)
 }
 
+// Adds a task to the task map of multiple users.
+func (c *UserController) UsersAddTask(ctx context.Context, useridArr []string, taskid string, isPersonal bool) error {
+	ctx, span := tracing.Start(ctx, "UserController.UsersAddTask")
+	defer span.End()
+	if len(useridArr) == 0 {
+		return nil
+	}
+	params := bson.D{{Key: "$set", Value: bson.D{{Key: "tasks." + taskid, Value: isPersonal}}}}
+	var primitiveArr []primitive.ObjectID
+	for _, userid := range useridArr {
+		primitiveId, _ := primitive.ObjectIDFromHex(userid)
+		primitiveArr = append(primitiveArr, primitiveId)
+	}
+	_, err := c.Collection(userCollection).UpdateManyByID(ctx, primitiveArr, params)
+	return err
+}
+
+// Removes tasks from the task map of multiple users.
+func (c *UserController) UsersRemoveTasks(ctx context.Context, useridArr []string, taskids []string) error {
+	ctx, span := tracing.Start(ctx, "UserController.UsersRemoveTasks")
+	defer span.End()
+	if len(useridArr) == 0 || len(taskids) == 0 {
+		return nil
+	}
+	unset := bson.D{}
+	for _, taskid := range taskids {
+		unset = append(unset, bson.E{Key: "tasks." + taskid, Value: ""})
+	}
+	params := bson.D{{Key: "$unset", Value: unset}}
+	var primitiveArr []primitive.ObjectID
+	for _, userid := range useridArr {
+		primitiveId, _ := primitive.ObjectIDFromHex(userid)
+		primitiveArr = append(primitiveArr, primitiveId)
+	}
+	_, err := c.Collection(userCollection).UpdateManyByID(ctx, primitiveArr, params)
+	return err
+}
+
 func (c *UserController) UserMapToArray(ctx context.Context, useridStrArr []string) []models.User {
+	ctx, span := tracing.Start(ctx, "UserController.UserMapToArray")
+	defer span.End()
 	usersArray := []models.User{}
 	useridArr := []primitive.ObjectID{}
 	for _, userid := range useridStrArr {
@@ -227,6 +315,8 @@ func (c *UserController) UserMapToArray(ctx context.Context, useridStrArr []stri
 }
 
 func (c *UserController) UserDeleteInvites(ctx context.Context, userid string, projectids []string) {
+	ctx, span := tracing.Start(ctx, "UserController.UserDeleteInvites")
+	defer span.End()
 	params := bson.D{}
 	params = append(params, bson.E{Key: "invites", Value: bson.D{{Key: "$in", Value: projectids}}})
 	update := bson.D{{Key: "$pull", Value: params}}
@@ -236,6 +326,8 @@ func (c *UserController) UserDeleteInvites(ctx context.Context, userid string, p
 
 // adds multiple events to a user
 func (c *UserController) UserAddEvents(ctx context.Context, userid string, eventids []string) {
+	ctx, span := tracing.Start(ctx, "UserController.UserAddEvents")
+	defer span.End()
 	update := bson.D{
 		{Key: "$addToSet", Value: bson.D{
 			{Key: "events", Value: bson.D{{Key: "$each", Value: eventids}}},
@@ -246,6 +338,8 @@ func (c *UserController) UserAddEvents(ctx context.Context, userid string, event
 }
 
 func (c *UserController) UserRemoveEvents(ctx context.Context, userid primitive.ObjectID, eventids []string) {
+	ctx, span := tracing.Start(ctx, "UserController.UserRemoveEvents")
+	defer span.End()
 	update := bson.D{
 		{Key: "$pull", Value: bson.D{
 			{Key: "events", Value: bson.D{{Key: "$in", Value: eventids}}},
@@ -256,6 +350,8 @@ func (c *UserController) UserRemoveEvents(ctx context.Context, userid primitive.
 
 // Get all eventids from multiple users.
 func (c *UserController) UsersGetEventIds(ctx context.Context, userids []primitive.ObjectID) ([]string, error) {
+	ctx, span := tracing.Start(ctx, "UserController.UsersGetEventIds", attribute.Int("users", len(userids)))
+	defer span.End()
 	filter := bson.D{
 		{Key: "_id", Value: bson.D{{Key: "$in", Value: userids}}},
 		{Key: ""},
@@ -307,64 +403,25 @@ index name: autoCompleteUsers
 */
 
 func (c *UserController) ProjectInviteSearch(ctx context.Context, projectid, query string) ([]bson.D, error) {
+	ctx, span := tracing.Start(ctx, "UserController.ProjectInviteSearch")
+	defer span.End()
 	const searchLimit = 10
 	if query == "" {
 		// autocomplete.query cannot be empty!
 		// we will just return no results instead
 		return []bson.D{}, nil
 	}
-	searchStage := bson.D{
-		{
-			Key: "$search",
-			Value: bson.D{
-				{Key: "index", Value: "autoCompleteUsers"},
-				{Key: "autocomplete", Value: bson.D{
-					{Key: "path", Value: "name"},
-					{Key: "query", Value: query},
-					{Key: "tokenOrder", Value: "sequential"},
-					{Key: "fuzzy", Value: bson.D{
-						{Key: "maxEdits", Value: 1},
-						{Key: "prefixLength", Value: 1},
-						{Key: "maxExpansions", Value: 256},
-					}},
-				}},
-			},
-		},
-	}
-	filterStage := bson.D{
-		{Key: "$match", Value: bson.D{
+	return c.searchProvider().Search(ctx, c.Collection(userCollection), userNameSearch, SearchRequest{
+		Query: query,
+		Filter: bson.D{
 			// filter out the users who are already in the project
 			{Key: "projects", Value: bson.D{{Key: "$ne", Value: projectid}}},
-		}},
-	}
-	limitStage := bson.D{
-		{Key: "$limit", Value: searchLimit},
-	}
-	projectStage := bson.D{
-		{
-			Key: "$project",
-			Value: bson.D{
-				{Key: "_id", Value: 0}, /* hide _id field */
-				{Key: "id", Value: bson.D{{Key: "$toString", Value: "$_id"}}}, /* create a id field that is _id's value (essentially renaming the field & changing to string) */
-				{Key: "name", Value: 1},
-			},
 		},
-	}
-
-	// run pipeline
-	cursor, err := c.Collection(userCollection).Aggregate(ctx, mongo.Pipeline{searchStage, filterStage, limitStage, projectStage})
-
-	var results []bson.D
-	if err != nil {
-		return nil, err
-	}
-
-	if cursor == nil {
-		return results, errors.New("check server project controller")
-	}
-	if err = cursor.All(ctx, &results); err != nil {
-		return results, err
-	}
-
-	return results, nil
+		Limit: searchLimit,
+		Projection: bson.D{
+			{Key: "_id", Value: 0}, /* hide _id field */
+			{Key: "id", Value: bson.D{{Key: "$toString", Value: "$_id"}}}, /* create a id field that is _id's value (essentially renaming the field & changing to string) */
+			{Key: "name", Value: 1},
+		},
+	})
 }
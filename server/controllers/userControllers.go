@@ -3,8 +3,8 @@ package controllers
 
 import (
 	"context"
-	"errors"
 
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
 	"github.com/OrgaNiUS/OrgaNiUS/server/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -30,25 +30,32 @@ type UserCollectionInterface interface {
 	InsertOne(ctx context.Context, user *models.User) (primitive.ObjectID, error)
 
 	// Modifies/patches a user by ID.
+	// Every update increments the version of the users it modifies.
 	UpdateByID(ctx context.Context, id primitive.ObjectID, params bson.D) (*mongo.UpdateResult, error)
 
+	// Modifies a user by ID only if it is at the version.
+	UpdateByVersion(ctx context.Context, id primitive.ObjectID, version int64, params bson.D) (*mongo.UpdateResult, error)
+
 	// Modifies all usernames
 	UpdateManyByName(ctx context.Context, usernames []string, params bson.D) (*mongo.UpdateResult, error)
 
 	// Modifies all userids
 	UpdateManyByID(ctx context.Context, useridArr []primitive.ObjectID, params bson.D) (*mongo.UpdateResult, error)
 
-	// Modifies all users
-	UpdateAll(ctx context.Context, params bson.D) (*mongo.UpdateResult, error)
+	// Modifies all users matching the filter
+	UpdateMany(ctx context.Context, filter bson.D, params bson.D) (*mongo.UpdateResult, error)
 
 	// Deletes a user by ID.
 	DeleteByID(ctx context.Context, id string) (int64, error)
 
+	// Deletes a user by ID only if it is at the version.
+	DeleteByVersion(ctx context.Context, id string, version int64) (int64, error)
+
 	Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error)
 }
 
 type UserCollection struct {
-	userCollection *mongo.Collection
+	userCollection MongoCollection
 }
 
 func (c *UserCollection) FindOne(ctx context.Context, user *models.User, id, name, email string) (*models.User, error) {
@@ -57,7 +64,7 @@ func (c *UserCollection) FindOne(ctx context.Context, user *models.User, id, nam
 		user = &models.User{}
 	}
 	if id == "" && name == "" && email == "" {
-		return user, errors.New("cannot leave all params blank")
+		return user, errs.Validation("cannot leave all params blank")
 	}
 	params := []interface{}{}
 	if id != "" {
@@ -109,23 +116,23 @@ func (c *UserCollection) InsertOne(ctx context.Context, user *models.User) (prim
 }
 
 func (c *UserCollection) UpdateByID(ctx context.Context, id primitive.ObjectID, params bson.D) (*mongo.UpdateResult, error) {
-	result, err := c.userCollection.UpdateByID(ctx, id, params)
+	result, err := c.userCollection.UpdateByID(ctx, id, bumpVersion(params))
 	if err != nil {
 		return nil, err
 	}
 	return result, err
 }
 
-func (c *UserCollection) UpdateAll(ctx context.Context, params bson.D) (*mongo.UpdateResult, error) {
-	result, err := c.userCollection.UpdateMany(ctx, bson.D{}, params)
-	if err != nil {
-		return nil, err
-	}
-	return result, err
+func (c *UserCollection) UpdateByVersion(ctx context.Context, id primitive.ObjectID, version int64, params bson.D) (*mongo.UpdateResult, error) {
+	return c.userCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: id}, atVersion(version)}, bumpVersion(params))
+}
+
+func (c *UserCollection) UpdateMany(ctx context.Context, filter bson.D, params bson.D) (*mongo.UpdateResult, error) {
+	return c.userCollection.UpdateMany(ctx, filter, bumpVersion(params))
 }
 
 func (c *UserCollection) UpdateManyByField(ctx context.Context, field string, arr interface{}, params bson.D) (*mongo.UpdateResult, error) {
-	result, err := c.userCollection.UpdateMany(ctx, bson.D{{Key: field, Value: bson.D{{Key: "$in", Value: arr}}}}, params)
+	result, err := c.userCollection.UpdateMany(ctx, bson.D{{Key: field, Value: bson.D{{Key: "$in", Value: arr}}}}, bumpVersion(params))
 	if err != nil {
 		return nil, err
 	}
@@ -153,6 +160,19 @@ func (c *UserCollection) DeleteByID(ctx context.Context, id string) (int64, erro
 	return result.DeletedCount, nil
 }
 
+func (c *UserCollection) DeleteByVersion(ctx context.Context, id string, version int64) (int64, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return -1, err
+	}
+	params := bson.D{{Key: "_id", Value: objectID}, atVersion(version)}
+	result, err := c.userCollection.DeleteOne(ctx, params)
+	if err != nil {
+		return -1, err
+	}
+	return result.DeletedCount, nil
+}
+
 func (c *UserCollection) Aggregate(ctx context.Context, pipeline interface{},
 	opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
 	return c.userCollection.Aggregate(ctx, pipeline, opts...)
@@ -161,20 +181,28 @@ func (c *UserCollection) Aggregate(ctx context.Context, pipeline interface{},
 type UserController struct {
 	Collection func(name string, opts ...*options.CollectionOptions) UserCollectionInterface
 	URL        string
+	Search     SearchProvider // Atlas Search if nil
 }
 
 const (
 	databaseName = "OrgaNiUS"
 )
 
-func NewU(client *mongo.Client, URL string) *UserController {
-	database := client.Database(databaseName)
+func NewU(database Database, URL string, search SearchProvider) *UserController {
 	return &UserController{
 		func(name string, opts ...*options.CollectionOptions) UserCollectionInterface {
 			return &UserCollection{
-				database.Collection(name, opts...),
+				database(name, opts...),
 			}
 		},
 		URL,
+		search,
+	}
+}
+
+func (c *UserController) searchProvider() SearchProvider {
+	if c.Search == nil {
+		return AtlasSearch{}
 	}
+	return c.Search
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
 	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
 	"github.com/OrgaNiUS/OrgaNiUS/server/models"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -507,7 +508,7 @@ func TestUserModify(t *testing.T) {
 	controller.UserModify(ctx, &models.User{
 		Id:   id,
 		Name: name,
-	})
+	}, nil)
 	if data[0].Name != name {
 		t.Errorf("Expected name %v but got %v", name, data[0].Name)
 	}
@@ -516,10 +517,24 @@ func TestUserModify(t *testing.T) {
 	controller.UserModify(ctx, &models.User{
 		Id:    id,
 		Email: email,
-	})
+	}, nil)
 	if data[0].Email != email {
 		t.Errorf("Expected email %v but got %v", email, data[0].Email)
 	}
+
+	// each modification increments the version, so the first version is stale
+	stale := int64(0)
+	err := controller.UserModify(ctx, &models.User{
+		Id:   id,
+		Name: "staleName",
+	}, &stale)
+	if errs.CodeOf(err) != errs.CodePrecondition || data[0].Name != name {
+		t.Errorf("Expected the stale modification to fail but got %v with name %v", err, data[0].Name)
+	}
+	current := data[0].Version
+	if err := controller.UserModify(ctx, &models.User{Id: id, Name: "currentName"}, &current); err != nil || data[0].Name != "currentName" {
+		t.Errorf("Expected the modification at the current version to succeed but got %v with name %v", err, data[0].Name)
+	}
 }
 
 func TestUserDelete(t *testing.T) {
@@ -543,7 +558,12 @@ func TestUserDelete(t *testing.T) {
 	w := httptest.NewRecorder()
 	ctx, _ := gin.CreateTestContext(w)
 
-	err := controller.UserDelete(ctx, ids[1].Hex())
+	// only deleted at its current version
+	stale := data[1].Version + 1
+	if err := controller.UserDelete(ctx, ids[1].Hex(), &stale); errs.CodeOf(err) != errs.CodePrecondition {
+		t.Errorf("Expected deleting another version to fail but got %v", err)
+	}
+	err := controller.UserDelete(ctx, ids[1].Hex(), nil)
 	if err != nil {
 		t.Error("Expected no error when deleting valid user")
 	} else if exists, _ := controller.UserExists(ctx, data[1].Name, data[1].Email); exists {
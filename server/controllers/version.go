@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+/*
+	Tasks, projects, events and users have a version, which every update through their collections increments.
+	Updates that expect a version only apply if the document is still at it, so that changes made since a client read
+	the document are not silently overwritten, and fail with a precondition error instead.
+*/
+
+var versionIncrement = bson.E{Key: "version", Value: int64(1)}
+
+// Returns the update with the version incremented.
+func bumpVersion(update bson.D) bson.D {
+	bumped := make(bson.D, 0, len(update)+1)
+	incremented := false
+	for _, operator := range update {
+		if fields, ok := operator.Value.(bson.D); ok && operator.Key == "$inc" {
+			operator.Value = append(fields[:len(fields):len(fields)], versionIncrement)
+			incremented = true
+		}
+		bumped = append(bumped, operator)
+	}
+	if !incremented {
+		bumped = append(bumped, bson.E{Key: "$inc", Value: bson.D{versionIncrement}})
+	}
+	return bumped
+}
+
+// Returns copies of the operations whose updates increment the version.
+func bumpVersions(operations []mongo.WriteModel) []mongo.WriteModel {
+	bumped := make([]mongo.WriteModel, len(operations))
+	for i, operation := range operations {
+		switch model := operation.(type) {
+		case *mongo.UpdateOneModel:
+			if update, ok := model.Update.(bson.D); ok {
+				copied := *model
+				copied.Update = bumpVersion(update)
+				operation = &copied
+			}
+		case *mongo.UpdateManyModel:
+			if update, ok := model.Update.(bson.D); ok {
+				copied := *model
+				copied.Update = bumpVersion(update)
+				operation = &copied
+			}
+		}
+		bumped[i] = operation
+	}
+	return bumped
+}
+
+// Filter for documents at the version.
+// Documents written before versions existed have none, which is version 0.
+func atVersion(version int64) bson.E {
+	if version == 0 {
+		return bson.E{Key: "version", Value: bson.D{{Key: "$in", Value: bson.A{int64(0), nil}}}}
+	}
+	return bson.E{Key: "version", Value: version}
+}
+
+// Returns a precondition error if the update expecting a version matched nothing,
+// as the document was modified or deleted since it was read.
+func checkVersion(result *mongo.UpdateResult, err error, name string) error {
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return errs.Precondition(name + " was modified since it was read")
+	}
+	return nil
+}
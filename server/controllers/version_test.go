@@ -0,0 +1,158 @@
+package controllers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/testdb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTaskModifyVersion(t *testing.T) {
+	ctx := context.Background()
+	database := testdb.New()
+	c := controllers.NewT(database, "")
+
+	// written before versions existed
+	taskid := primitive.NewObjectID()
+	if _, err := database("tasks").InsertOne(ctx, bson.D{{Key: "_id", Value: taskid}, {Key: "name", Value: "old"}}); err != nil {
+		t.Fatal(err)
+	}
+	version := func() int64 {
+		t.Helper()
+		task, err := c.TaskRetrieve(ctx, taskid.Hex())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return task.Version
+	}
+
+	name := "first"
+	unversioned := int64(0)
+	if err := c.TaskModify(ctx, "", taskid, &unversioned, &name, nil, nil, nil, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("Expected tasks without a version to be at version 0 but got %v", err)
+	}
+	if v := version(); v != 1 {
+		t.Errorf("Expected the version to be incremented to 1 but got %v", v)
+	}
+
+	// a client that read the task before the first modification
+	name = "second"
+	if err := c.TaskModify(ctx, "", taskid, &unversioned, &name, nil, nil, nil, nil, nil, nil, nil, nil); errs.CodeOf(err) != errs.CodePrecondition {
+		t.Errorf("Expected a stale version to fail the precondition but got %v", err)
+	}
+	if task, _ := c.TaskRetrieve(ctx, taskid.Hex()); task.Name != "first" {
+		t.Errorf("Expected the stale modification to not be applied but got %v", task.Name)
+	}
+
+	// other writes increment the version as well
+	if _, err := c.TaskClaimNext(ctx, taskid); err != nil {
+		t.Fatal(err)
+	}
+	if v := version(); v != 2 {
+		t.Errorf("Expected every write to increment the version but got %v", v)
+	}
+
+	// without a version, modifications are applied regardless
+	if err := c.TaskModify(ctx, "", taskid, nil, &name, nil, nil, nil, nil, nil, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if task, _ := c.TaskRetrieve(ctx, taskid.Hex()); task.Name != "second" || task.Version != 3 {
+		t.Errorf("Expected the modification to be applied at version 3 but got %+v", task)
+	}
+}
+
+func TestEventModifyVersion(t *testing.T) {
+	ctx := context.Background()
+	c := controllers.NewE(testdb.New(), "")
+	event := models.Event{Name: "event"}
+	if err := c.EventCreate(ctx, &event); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "renamed"
+	if err := c.EventModify(ctx, event.Id, &event.Version, &name, nil, nil); err != nil {
+		t.Fatalf("Expected the modification at the current version to succeed but got %v", err)
+	}
+	if err := c.EventModify(ctx, event.Id, &event.Version, &name, nil, nil); errs.CodeOf(err) != errs.CodePrecondition {
+		t.Errorf("Expected the second modification at the same version to fail but got %v", err)
+	}
+	if modified, err := c.EventGet(ctx, event.Id.Hex()); err != nil || modified.Version != event.Version+1 {
+		t.Errorf("Expected the version to be incremented once but got %+v %v", modified, err)
+	}
+}
+
+func TestSoftDeleteVersion(t *testing.T) {
+	ctx := context.Background()
+	database := testdb.New()
+	tasks := controllers.NewT(database, "")
+	events := controllers.NewE(database, "")
+	projects := controllers.NewP(database, "", nil)
+
+	task := models.Task{Name: "task"}
+	if err := tasks.TaskCreate(ctx, &task); err != nil {
+		t.Fatal(err)
+	}
+	stale := task.Version + 1
+	if err := tasks.TaskSoftDeleteOne(ctx, task.Id.Hex(), "", &stale, time.Now()); errs.CodeOf(err) != errs.CodePrecondition {
+		t.Errorf("Expected deleting the task at another version to fail but got %v", err)
+	}
+	if err := tasks.TaskSoftDeleteOne(ctx, task.Id.Hex(), "", &task.Version, time.Now()); err != nil {
+		t.Errorf("Expected the task to be deleted at its version but got %v", err)
+	}
+	if _, err := tasks.TaskRetrieveDeleted(ctx, task.Id.Hex()); err != nil {
+		t.Errorf("Expected the task to be in the trash but got %v", err)
+	}
+
+	event := models.Event{Name: "event"}
+	if err := events.EventCreate(ctx, &event); err != nil {
+		t.Fatal(err)
+	}
+	stale = event.Version + 1
+	if err := events.EventSoftDeleteOne(ctx, event.Id.Hex(), "", "", &stale, time.Now()); errs.CodeOf(err) != errs.CodePrecondition {
+		t.Errorf("Expected deleting the event at another version to fail but got %v", err)
+	}
+	if _, err := events.EventGet(ctx, event.Id.Hex()); err != nil {
+		t.Errorf("Expected the event to not be deleted but got %v", err)
+	}
+
+	project := models.Project{Name: "project", Members: map[string]string{}}
+	if err := projects.ProjectCreate(ctx, &project, primitive.NewObjectID().Hex()); err != nil {
+		t.Fatal(err)
+	}
+	stale = project.Version + 1
+	if err := projects.ProjectSoftDelete(ctx, project.Id, &stale, time.Now()); errs.CodeOf(err) != errs.CodePrecondition {
+		t.Errorf("Expected deleting the project at another version to fail but got %v", err)
+	}
+	if _, err := projects.ProjectRetrieve(ctx, project.Id.Hex()); err != nil {
+		t.Errorf("Expected the project to not be deleted but got %v", err)
+	}
+}
+
+func TestUsersDeleteProjectVersion(t *testing.T) {
+	ctx := context.Background()
+	c := controllers.NewU(testdb.New(), "", nil)
+	member := models.User{Name: "member", Projects: []string{"project"}}
+	other := models.User{Name: "other", Projects: []string{"another"}}
+	for _, user := range []*models.User{&member, &other} {
+		if err := c.UserCreate(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := c.UsersDeleteProject(ctx, []string{}, "project"); err != nil {
+		t.Fatal(err)
+	}
+	// only the users with the project are modified
+	if user, _ := c.UserRetrieve(ctx, member.Id.Hex(), ""); len(user.Projects) != 0 || user.Version != member.Version+1 {
+		t.Errorf("Expected the project to be removed from the member but got %+v", user)
+	}
+	if user, _ := c.UserRetrieve(ctx, other.Id.Hex(), ""); user.Version != other.Version {
+		t.Errorf("Expected the version of the other user to stay %v but got %v", other.Version, user.Version)
+	}
+}
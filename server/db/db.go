@@ -3,24 +3,39 @@ package db
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
-func Connect(dbUsername, dbPassword string) (*mongo.Client, context.CancelFunc) {
+// Connects to the deployment at the URI.
+// The username and password are used if given, so that they can be kept out of the URI.
+func Connect(URI, dbUsername, dbPassword string) (*mongo.Client, error) {
 	serverAPIOptions := options.ServerAPI(options.ServerAPIVersion1)
-	URI := fmt.Sprintf("mongodb+srv://%s:%s@organius.zwjpt.mongodb.net/myFirstDatabase?retryWrites=true&w=majority", dbUsername, dbPassword)
 	clientOptions := options.Client().
 		ApplyURI(URI).
 		SetServerAPIOptions(serverAPIOptions)
+	if dbUsername != "" {
+		clientOptions.SetAuth(options.Credential{Username: dbUsername, Password: dbPassword})
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	client, err := mongo.Connect(ctx, clientOptions)
-	if err != nil {
-		log.Fatal(err)
+	defer cancel()
+	return mongo.Connect(ctx, clientOptions)
+}
+
+// Checks that the primary can be reached, which is needed for writes.
+func Ping(ctx context.Context, client *mongo.Client) error {
+	return client.Ping(ctx, readpref.Primary())
+}
+
+// Closes the connections to the deployment, waiting up to the timeout for operations in progress.
+func Disconnect(client *mongo.Client, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := client.Disconnect(ctx); err != nil {
+		slog.Error("error disconnecting from the database", "error", err)
 	}
-	return client, cancel
 }
@@ -0,0 +1,141 @@
+// Errors with a code that tells clients what went wrong, which decides the HTTP status they are responded with.
+package errs
+
+import (
+	"errors"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Machine-readable, and so stable: clients compare them.
+type Code string
+
+const (
+	CodeValidation   Code = "validation"   // the request is malformed or has invalid fields
+	CodeUnauthorized Code = "unauthorized" // not logged in, or the credentials are wrong
+	CodeForbidden    Code = "forbidden"    // logged in but not allowed to do this
+	CodeNotFound     Code = "not_found"
+	CodeConflict     Code = "conflict"            // not possible in the current state, such as starting a second timer
+	CodePrecondition Code = "precondition_failed" // the resource was modified since the version the client gave in If-Match
+	CodeInternal     Code = "internal"            // a problem of the server, whose details are not shown
+)
+
+var statuses = map[Code]int{
+	CodeValidation:   http.StatusBadRequest,
+	CodeUnauthorized: http.StatusUnauthorized,
+	CodeForbidden:    http.StatusForbidden,
+	CodeNotFound:     http.StatusNotFound,
+	CodeConflict:     http.StatusConflict,
+	CodePrecondition: http.StatusPreconditionFailed,
+	CodeInternal:     http.StatusInternalServerError,
+}
+
+type Error struct {
+	Code    Code
+	Message string            // shown to the client
+	Fields  map[string]string // the problem with each invalid field of a validation error
+	Err     error             // the cause, logged but not shown to the client
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// The HTTP status of the code.
+func (e *Error) Status() int {
+	if status, ok := statuses[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+func Validation(message string) *Error {
+	return &Error{Code: CodeValidation, Message: message}
+}
+
+// A validation error of a single field, such as Invalid("duration", "must be positive").
+func Invalid(field, problem string) *Error {
+	return &Error{Code: CodeValidation, Message: field + " " + problem, Fields: map[string]string{field: problem}}
+}
+
+func Unauthorized(message string) *Error {
+	return &Error{Code: CodeUnauthorized, Message: message}
+}
+
+func Forbidden(message string) *Error {
+	return &Error{Code: CodeForbidden, Message: message}
+}
+
+func NotFound(message string) *Error {
+	return &Error{Code: CodeNotFound, Message: message}
+}
+
+func Conflict(message string) *Error {
+	return &Error{Code: CodeConflict, Message: message}
+}
+
+func Precondition(message string) *Error {
+	return &Error{Code: CodePrecondition, Message: message}
+}
+
+func Internal(err error) *Error {
+	return &Error{Code: CodeInternal, Message: "internal server error", Err: err}
+}
+
+// Returns a not found error with the message if no document matched, else err.
+// For the errors of retrieving a document by the id the client gave.
+func OrNotFound(err error, message string) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &Error{Code: CodeNotFound, Message: message, Err: err}
+	}
+	return err
+}
+
+// Implemented by errors wrapping another with something the client has to know whatever the code, such as changes that could not be undone.
+type Noted interface {
+	Note() string // empty if there is nothing to add
+}
+
+// Returns err as an *Error.
+// Errors of the database that clients can cause are given their code, and any other error is internal.
+// The note of a Noted error wrapping the cause is added to the message in brackets.
+func From(err error) *Error {
+	e := from(err)
+	var noted Noted
+	if errors.As(err, &noted) && noted.Note() != "" {
+		// a copy, as the error may be shared
+		withNote := *e
+		withNote.Message += " (" + noted.Note() + ")"
+		return &withNote
+	}
+	return e
+}
+
+func from(err error) *Error {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		return e
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return &Error{Code: CodeNotFound, Message: "not found", Err: err}
+	case errors.Is(err, primitive.ErrInvalidHex):
+		return &Error{Code: CodeValidation, Message: "invalid id", Err: err}
+	case mongo.IsDuplicateKeyError(err):
+		return &Error{Code: CodeConflict, Message: "already exists", Err: err}
+	}
+	return Internal(err)
+}
+
+// The code of err, as in From.
+func CodeOf(err error) Code {
+	return from(err).Code
+}
@@ -0,0 +1,81 @@
+package errs_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestFrom(t *testing.T) {
+	_, invalidHex := primitive.ObjectIDFromHex("abc")
+	cause := errors.New("connection refused")
+
+	type Expected struct {
+		code    errs.Code
+		status  int
+		message string
+	}
+
+	tests := map[error]Expected{
+		errs.Forbidden("you lack permissions"):                       {errs.CodeForbidden, http.StatusForbidden, "you lack permissions"},
+		fmt.Errorf("wrapped: %w", errs.Conflict("already running")):  {errs.CodeConflict, http.StatusConflict, "already running"},
+		mongo.ErrNoDocuments:                                         {errs.CodeNotFound, http.StatusNotFound, "not found"},
+		errs.Precondition("task was modified since it was read"):     {errs.CodePrecondition, http.StatusPreconditionFailed, "task was modified since it was read"},
+		errs.OrNotFound(mongo.ErrNoDocuments, "task does not exist"): {errs.CodeNotFound, http.StatusNotFound, "task does not exist"},
+		invalidHex: {errs.CodeValidation, http.StatusBadRequest, "invalid id"},
+		cause:      {errs.CodeInternal, http.StatusInternalServerError, "internal server error"},
+		errs.OrNotFound(cause, "task does not exist"): {errs.CodeInternal, http.StatusInternalServerError, "internal server error"},
+	}
+
+	for err, expected := range tests {
+		e := errs.From(err)
+		if e.Code != expected.code || e.Status() != expected.status || e.Message != expected.message {
+			t.Errorf("Expected %v but got {%v %v %v} for %v", expected, e.Code, e.Status(), e.Message, err)
+		}
+	}
+}
+
+type notedError struct {
+	err  error
+	note string
+}
+
+func (e notedError) Error() string { return e.err.Error() }
+func (e notedError) Unwrap() error { return e.err }
+func (e notedError) Note() string  { return e.note }
+
+func TestFromKeepsNote(t *testing.T) {
+	forbidden := errs.Forbidden("you lack permissions")
+	e := errs.From(notedError{forbidden, "could not undo earlier changes"})
+	if e.Code != errs.CodeForbidden || e.Message != "you lack permissions (could not undo earlier changes)" {
+		t.Errorf("Expected the note to be added to the message, got {%v %v}", e.Code, e.Message)
+	}
+	if forbidden.Message != "you lack permissions" {
+		t.Errorf("Expected the wrapped error to be unchanged, got %v", forbidden.Message)
+	}
+	e = errs.From(notedError{errors.New("connection refused"), "could not undo earlier changes"})
+	if e.Code != errs.CodeInternal || e.Message != "internal server error (could not undo earlier changes)" {
+		t.Errorf("Expected the note to be added to internal errors, got {%v %v}", e.Code, e.Message)
+	}
+	if e := errs.From(notedError{forbidden, ""}); e.Message != "you lack permissions" {
+		t.Errorf("Expected an empty note to be left out, got %v", e.Message)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	e := errs.Invalid("password", "cannot be longer than 72 bytes")
+	if e.Message != "password cannot be longer than 72 bytes" {
+		t.Errorf("Expected the message to name the field but got %v", e.Message)
+	}
+	if e.Fields["password"] != "cannot be longer than 72 bytes" {
+		t.Errorf("Expected the field to be reported but got %v", e.Fields)
+	}
+	if !errors.Is(errs.Internal(mongo.ErrClientDisconnected), mongo.ErrClientDisconnected) {
+		t.Errorf("Expected internal errors to wrap their cause")
+	}
+}
@@ -0,0 +1,35 @@
+package functions
+
+// Returns the strings only in after, and those only in before.
+func Diff(before, after []string) ([]string, []string) {
+	inBefore := map[string]bool{}
+	for _, s := range before {
+		inBefore[s] = true
+	}
+	inAfter := map[string]bool{}
+	for _, s := range after {
+		inAfter[s] = true
+	}
+	added := []string{}
+	for _, s := range after {
+		if !inBefore[s] {
+			added = append(added, s)
+		}
+	}
+	removed := []string{}
+	for _, s := range before {
+		if !inAfter[s] {
+			removed = append(removed, s)
+		}
+	}
+	return added, removed
+}
+
+func Contains(arr []string, s string) bool {
+	for _, element := range arr {
+		if element == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/functions"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/socket"
+	"github.com/gin-gonic/gin"
+)
+
+// holds the activity hub of the request, if the activity stream is enabled
+const activityKey = "activity"
+
+// Makes the activity hub available to the handlers, which publish the changes they make to projects.
+func Activity(hub *socket.ActivityHub) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set(activityKey, hub)
+		ctx.Next()
+	}
+}
+
+// Returns the activity hub, or nil if the activity stream is disabled.
+func activityHub(ctx *gin.Context) *socket.ActivityHub {
+	value, _ := ctx.Get(activityKey)
+	hub, _ := value.(*socket.ActivityHub)
+	return hub
+}
+
+// Publishes the change the user made to the project.
+// Does nothing for personal tasks and events, which have no projectid.
+func publishActivity(ctx *gin.Context, projectid, userid, activityType string, payload interface{}) {
+	if projectid == "" {
+		return
+	}
+	if hub := activityHub(ctx); hub != nil {
+		hub.Publish(projectid, userid, activityType, payload)
+	}
+}
+
+// Publishes the task as it is after the user's change, if the activity stream is enabled.
+func publishTask(ctx *gin.Context, taskController controllers.TaskController, projectid, userid, activityType, taskid string) {
+	if projectid == "" || activityHub(ctx) == nil {
+		return
+	}
+	task, err := taskController.TaskRetrieve(ctx, taskid)
+	if err != nil {
+		// the change was made, only the activity is lost
+		return
+	}
+	publishActivity(ctx, projectid, userid, activityType, socket.TaskPayload{Task: task})
+}
+
+// Publishes the event as it is after the user's change, if it is one of the project's.
+// v1 takes the projectid of events from the client, so it is checked before the members are told.
+func publishEvent(ctx *gin.Context, projectController controllers.ProjectController, eventController controllers.EventController, projectid, userid, activityType, eventid string) {
+	if projectid == "" || activityHub(ctx) == nil {
+		return
+	}
+	project, err := projectController.ProjectRetrieve(ctx, projectid)
+	if err != nil || !functions.Contains(project.Events, eventid) {
+		return
+	}
+	event, err := eventController.EventGet(ctx, eventid)
+	if err != nil {
+		return
+	}
+	publishActivity(ctx, projectid, userid, activityType, socket.EventPayload{Event: *event})
+}
+
+// Publishes the project as it is after the user's change, if the activity stream is enabled.
+func publishProject(ctx *gin.Context, projectController controllers.ProjectController, projectid, userid string) {
+	if activityHub(ctx) == nil {
+		return
+	}
+	project, err := projectController.ProjectRetrieve(ctx, projectid)
+	if err != nil {
+		return
+	}
+	publishActivity(ctx, projectid, userid, socket.ActivityProjectModified, toProjectPayload(project))
+}
+
+func toProjectPayload(project models.Project) socket.ProjectPayload {
+	return socket.ProjectPayload{
+		Name:        project.Name,
+		Description: project.Description,
+		IsPublic:    project.IsPublic,
+		IsArchived:  project.IsArchived,
+		States:      project.Settings.States,
+	}
+}
+
+// Publishes that the users joined or left the project.
+func publishMembers(ctx *gin.Context, userController controllers.UserController, projectid, actor, activityType string, userids []string) {
+	if activityHub(ctx) == nil {
+		return
+	}
+	for _, userid := range userids {
+		member := socket.MemberPayload{UserId: userid}
+		if user, err := userController.UserRetrieve(ctx, userid, ""); err == nil {
+			member.Name = user.Name
+		}
+		publishActivity(ctx, projectid, actor, activityType, member)
+	}
+}
+
+// Input parameters "projectid" and optionally "since"
+// Streams the changes made to the project to a member over websocket, resuming after since if it is given.
+func ProjectActivity(hub *socket.ActivityHub, projectController controllers.ProjectController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query activityQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Invalid("since", "must be a sequence number"))
+			return
+		}
+		projectid, since := query.ProjectId, query.Since
+		if projectid == "" {
+			Respond(ctx, errs.Validation("provide a projectid"))
+			return
+		}
+		project, err := projectController.ProjectRetrieve(ctx, projectid)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+			return
+		}
+		if _, ok := project.Members[id]; !ok {
+			Respond(ctx, errs.Forbidden("you lack permissions"))
+			return
+		}
+
+		socket.ConnectActivityClient(ctx, hub, projectid, id, since)
+	}
+}
@@ -0,0 +1,125 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/socket"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// An activity as decoded by a client, with the fields of every payload.
+type streamedActivity struct {
+	Seq     uint64 `json:"seq"`
+	Type    string `json:"type"`
+	Actor   string `json:"actor"`
+	Payload struct {
+		Task  models.Task  `json:"task"`
+		Event models.Event `json:"event"`
+		Ids   []string     `json:"ids"`
+	} `json:"payload"`
+}
+
+// Connects to the activity stream of the project, returning a function reading the next activity.
+func (s *memoryServer) streamActivity(t *testing.T, server *httptest.Server, cookie *http.Cookie, query url.Values) (*websocket.Conn, func() streamedActivity) {
+	t.Helper()
+	header := http.Header{"Cookie": {cookie.Name + "=" + cookie.Value}}
+	conn, response, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/v1/project_activity?"+query.Encode(), header)
+	if err != nil {
+		t.Fatalf("Expected to connect to the activity stream, got %v %v", response.StatusCode, err)
+	}
+	queued := []streamedActivity{}
+	return conn, func() streamedActivity {
+		t.Helper()
+		for len(queued) == 0 {
+			var frame struct {
+				Activities []streamedActivity `json:"activities"`
+			}
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if err := conn.ReadJSON(&frame); err != nil {
+				t.Fatalf("Expected an activity, got %v", err)
+			}
+			queued = frame.Activities
+		}
+		activity := queued[0]
+		queued = queued[1:]
+		return activity
+	}
+}
+
+func TestProjectActivity(t *testing.T) {
+	s := newMemoryServer(t)
+	admin, adminCookie := s.signup(t, "admin")
+	_, otherCookie := s.signup(t, "other")
+	projectid := s.createProject(t, adminCookie, "Project One")
+	server := httptest.NewServer(s.router)
+	defer server.Close()
+
+	// only members can follow the project
+	header := http.Header{"Cookie": {otherCookie.Name + "=" + otherCookie.Value}}
+	if _, response, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/v1/project_activity?projectid="+projectid, header); err == nil || response.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected non-members to be forbidden, got %v", err)
+	}
+
+	conn, next := s.streamActivity(t, server, adminCookie, url.Values{"projectid": {projectid}})
+	if activity := next(); activity.Type != socket.ActivityReset {
+		t.Fatalf("Expected a reset first, got %+v", activity)
+	}
+
+	// personal tasks are not published
+	s.do(t, adminCookie, "POST", "/task_create", nil, gin.H{"name": "personal"}, nil)
+	var created struct {
+		TaskId string `json:"taskid"`
+	}
+	s.do(t, adminCookie, "POST", "/task_create", nil, gin.H{"name": "task", "projectid": projectid}, &created)
+	activity := next()
+	if activity.Type != socket.ActivityTaskCreated || activity.Payload.Task.Name != "task" || activity.Actor != admin.Id.Hex() {
+		t.Errorf("Expected the project task to be created by the admin, got %+v", activity)
+	}
+
+	s.v2(t, adminCookie, "PATCH", "/projects/"+projectid+"/tasks/"+created.TaskId, nil, gin.H{"name": "renamed", "isDone": true}, nil)
+	if activity := next(); activity.Type != socket.ActivityTaskModified || activity.Payload.Task.Name != "renamed" || !activity.Payload.Task.IsDone {
+		t.Errorf("Expected the task to be modified, got %+v", activity)
+	}
+
+	var event struct {
+		EventId string `json:"eventid"`
+	}
+	s.do(t, adminCookie, "POST", "/event_create", nil, gin.H{"name": "meeting", "start": "2022-06-01T10:00:00Z", "end": "2022-06-01T11:00:00Z", "projectid": projectid}, &event)
+	if activity := next(); activity.Type != socket.ActivityEventCreated || activity.Payload.Event.Name != "meeting" {
+		t.Errorf("Expected the event to be created, got %+v", activity)
+	}
+	// v1 takes the project of the event from the client, which is checked
+	s.do(t, adminCookie, "PATCH", "/event_modify", nil, gin.H{"eventid": event.EventId, "projectid": s.createProject(t, adminCookie, "Project Two"), "name": "elsewhere"}, nil)
+	s.do(t, adminCookie, "PATCH", "/event_modify", nil, gin.H{"eventid": event.EventId, "projectid": projectid, "name": "standup"}, nil)
+	last := next()
+	if last.Type != socket.ActivityEventModified || last.Payload.Event.Name != "standup" {
+		t.Errorf("Expected only the event modified with its project to be published, got %+v", last)
+	}
+
+	// the client resumes from the last activity it received after reconnecting
+	conn.Close()
+	s.v2(t, adminCookie, "DELETE", "/projects/"+projectid+"/tasks/"+created.TaskId, nil, nil, nil)
+	conn, next = s.streamActivity(t, server, adminCookie, url.Values{"projectid": {projectid}, "since": {strconv.FormatUint(last.Seq, 10)}})
+	defer conn.Close()
+	if activity := next(); activity.Type != socket.ActivityTaskDeleted || len(activity.Payload.Ids) != 1 || activity.Payload.Ids[0] != created.TaskId {
+		t.Errorf("Expected the deletion made while disconnected, got %+v", activity)
+	}
+
+	// deleting the project closes the stream
+	s.do(t, adminCookie, "DELETE", "/project_delete", url.Values{"projectid": {projectid}}, nil, nil)
+	if activity := next(); activity.Type != socket.ActivityProjectDeleted {
+		t.Errorf("Expected the project to be deleted, got %+v", activity)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("Expected the stream to be closed, got %v", err)
+	}
+}
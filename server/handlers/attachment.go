@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// projects cannot raise their upload size limit above this
+	maxAttachmentSize = 50 << 20
+	// room for the other fields and the multipart boundaries around the file
+	maxAttachmentFormOverhead = 1 << 20
+)
+
+// Checks that the user can access the task or project owning an attachment.
+// Returns the upload limits that apply to the owner, or the error to respond with.
+func attachmentOwnerAccess(ctx *gin.Context, projectController controllers.ProjectController, taskController controllers.TaskController, ownerType, ownerid, userid string) (models.AttachmentLimits, error) {
+	projectid := ownerid
+	if ownerType == models.AttachmentOwnerTask {
+		task, err := taskController.TaskRetrieve(ctx, ownerid)
+		if err != nil {
+			return models.AttachmentLimits{}, errs.OrNotFound(err, "task does not exist")
+		}
+		if !canAccessTask(ctx, projectController, task, userid) {
+			return models.AttachmentLimits{}, errs.Forbidden("you lack permissions")
+		}
+		if task.ProjectId == "" {
+			return models.DefaultAttachmentLimits(), nil
+		}
+		projectid = task.ProjectId
+	}
+	project, err := projectController.ProjectRetrieve(ctx, projectid)
+	if err != nil {
+		return models.AttachmentLimits{}, errs.OrNotFound(err, "project does not exist")
+	}
+	if ownerType == models.AttachmentOwnerProject {
+		if _, ok := project.Members[userid]; !ok {
+			return models.AttachmentLimits{}, errs.Forbidden("you lack permissions")
+		}
+	}
+	return project.Settings.AttachmentLimits(), nil
+}
+
+// Same as checkProjectWritable, for the task or project owning an attachment.
+func checkAttachmentOwnerWritable(ctx *gin.Context, projectController controllers.ProjectController, taskController controllers.TaskController, ownerType, ownerid string) bool {
+	if ownerType == models.AttachmentOwnerTask {
+		task, err := taskController.TaskRetrieve(ctx, ownerid)
+		return err != nil || checkTaskWritable(ctx, projectController, task)
+	}
+	project, err := projectController.ProjectRetrieve(ctx, ownerid)
+	return err != nil || checkProjectWritable(ctx, project)
+}
+
+// Returns the owner of an attachment from the "taskid" or "projectid" parameter.
+func attachmentOwner(taskid, projectid string) (string, string, bool) {
+	if taskid != "" && projectid == "" {
+		return models.AttachmentOwnerTask, taskid, true
+	} else if projectid != "" && taskid == "" {
+		return models.AttachmentOwnerProject, projectid, true
+	}
+	return "", "", false
+}
+
+// Multipart form with "file" and either "taskid" or "projectid".
+func AttachmentUpload(projectController controllers.ProjectController, taskController controllers.TaskController, attachmentController controllers.AttachmentController, store storage.Store, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		// stop reading before the whole body is parsed, the limit of the owner is checked after
+		ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxAttachmentSize+maxAttachmentFormOverhead)
+		if _, err := ctx.MultipartForm(); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				Respond(ctx, errs.Validation(fmt.Sprintf("file cannot be larger than %v bytes", maxAttachmentSize)))
+				return
+			}
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		var form attachmentForm
+		if err := ctx.ShouldBindWith(&form, binding.FormMultipart); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		ownerType, ownerid, ok := attachmentOwner(form.TaskId, form.ProjectId)
+		if !ok {
+			Respond(ctx, errs.Validation("provide either a taskid or a projectid"))
+			return
+		}
+		limits, err := attachmentOwnerAccess(ctx, projectController, taskController, ownerType, ownerid, id)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		if !checkAttachmentOwnerWritable(ctx, projectController, taskController, ownerType, ownerid) {
+			return
+		}
+
+		formFile := form.File
+		if formFile == nil {
+			Respond(ctx, errs.Validation(http.ErrMissingFile.Error()))
+			return
+		}
+		if formFile.Size > limits.MaxSize {
+			Respond(ctx, errs.Validation(fmt.Sprintf("file cannot be larger than %v bytes", limits.MaxSize)))
+			return
+		}
+		openedFile, err := formFile.Open()
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		defer openedFile.Close()
+
+		// detect the type from the contents instead of trusting the client
+		head := make([]byte, 512)
+		n, err := io.ReadFull(openedFile, head)
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			Respond(ctx, err)
+			return
+		}
+		head = head[:n]
+		contentType := http.DetectContentType(head)
+		if !limits.Allows(contentType) {
+			Respond(ctx, errs.Validation("file type "+contentType+" is not allowed"))
+			return
+		}
+
+		attachment := models.Attachment{
+			Id:          primitive.NewObjectID(),
+			OwnerType:   ownerType,
+			OwnerId:     ownerid,
+			Name:        filepath.Base(formFile.Filename),
+			ContentType: contentType,
+			Size:        formFile.Size,
+			Uploader:    id,
+		}
+		attachment.Key = ownerType + "/" + ownerid + "/" + attachment.Id.Hex()
+
+		reader := io.MultiReader(bytes.NewReader(head), openedFile)
+		if err := store.Put(ctx, attachment.Key, reader, formFile.Size, contentType); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		if err := attachmentController.AttachmentCreate(ctx, &attachment); err != nil {
+			// do not leave the file behind without an attachment pointing to it
+			store.Delete(ctx, attachment.Key)
+			Respond(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, attachmentResponse{Attachment: attachment})
+	}
+}
+
+// Input parameters "taskid" or "projectid"
+func AttachmentGetAll(projectController controllers.ProjectController, taskController controllers.TaskController, attachmentController controllers.AttachmentController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query attachmentOwnerQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		ownerType, ownerid, ok := attachmentOwner(query.TaskId, query.ProjectId)
+		if !ok {
+			Respond(ctx, errs.Validation("provide either a taskid or a projectid"))
+			return
+		}
+		if _, err := attachmentOwnerAccess(ctx, projectController, taskController, ownerType, ownerid, id); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		attachments, err := attachmentController.AttachmentGetAll(ctx, ownerType, ownerid)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, attachmentsResponse{Attachments: attachments})
+	}
+}
+
+// Input parameters "attachmentid"
+// Responds with the file itself.
+func AttachmentDownload(projectController controllers.ProjectController, taskController controllers.TaskController, attachmentController controllers.AttachmentController, store storage.Store, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query attachmentIdQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		attachment, err := attachmentController.AttachmentRetrieve(ctx, query.AttachmentId)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "attachment does not exist"))
+			return
+		}
+		if _, err := attachmentOwnerAccess(ctx, projectController, taskController, attachment.OwnerType, attachment.OwnerId, id); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		reader, err := store.Get(ctx, attachment.Key)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		defer reader.Close()
+		// encodes names that are not plain ASCII as filename*=utf-8''...
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name})
+		if disposition == "" {
+			disposition = "attachment"
+		}
+		ctx.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, reader, map[string]string{
+			"Content-Disposition":    disposition,
+			"X-Content-Type-Options": "nosniff",
+		})
+	}
+}
+
+// Input parameters "attachmentid"
+// Only the uploader or an admin of the project can delete an attachment.
+func AttachmentDelete(projectController controllers.ProjectController, taskController controllers.TaskController, attachmentController controllers.AttachmentController, store storage.Store, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query attachmentIdQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		attachment, err := attachmentController.AttachmentRetrieve(ctx, query.AttachmentId)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "attachment does not exist"))
+			return
+		}
+		if attachment.Uploader != id {
+			projectid := attachment.OwnerId
+			if attachment.OwnerType == models.AttachmentOwnerTask {
+				task, _ := taskController.TaskRetrieve(ctx, attachment.OwnerId)
+				projectid = task.ProjectId
+			}
+			project, err := projectController.ProjectRetrieve(ctx, projectid)
+			if err != nil || !project.Settings.Roles[project.Members[id]].IsAdmin {
+				Respond(ctx, errs.Forbidden("you lack permissions"))
+				return
+			}
+		}
+		if !checkAttachmentOwnerWritable(ctx, projectController, taskController, attachment.OwnerType, attachment.OwnerId) {
+			return
+		}
+		if err := attachmentController.AttachmentDelete(ctx, attachment); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		storage.DeleteFiles(ctx, store, []models.Attachment{attachment})
+		ctx.JSON(http.StatusOK, emptyResponse{})
+	}
+}
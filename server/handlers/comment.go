@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"regexp"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/mailer"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxCommentLength = 2000
+)
+
+// usernames may contain spaces, but only the part without spaces can be mentioned
+var mentionRegex = regexp.MustCompile(`@([A-Za-z0-9_.]+)`)
+
+// Returns the unique usernames mentioned in a comment, in order of appearance.
+func parseMentions(content string) []string {
+	names := []string{}
+	seen := make(map[string]bool)
+	for _, match := range mentionRegex.FindAllStringSubmatch(content, -1) {
+		name := match[1]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// Creates the comment of the user on the task, replying to the parent comment if given.
+// Mentioned users who can access the task are notified by email.
+func createComment(ctx *gin.Context, userController controllers.UserController, projectController controllers.ProjectController, commentController controllers.CommentController, mailer *mailer.Mailer, task models.Task, parentid, content, userid, username string) (models.Comment, error) {
+	if content == "" {
+		return models.Comment{}, errs.Validation("comment cannot be empty")
+	} else if len(content) > maxCommentLength {
+		return models.Comment{}, errs.Validation("comment too long")
+	}
+	if !canAccessTask(ctx, projectController, task, userid) {
+		return models.Comment{}, errs.Forbidden("you lack permissions")
+	}
+	if task.ProjectId != "" {
+		if project, err := projectController.ProjectRetrieve(ctx, task.ProjectId); err == nil {
+			if err := projectWritable(project); err != nil {
+				return models.Comment{}, err
+			}
+		}
+	}
+	taskid := task.Id.Hex()
+	if parentid != "" {
+		parent, err := commentController.CommentRetrieve(ctx, parentid)
+		if err != nil || parent.TaskId != taskid {
+			return models.Comment{}, errs.NotFound("comment being replied to does not exist")
+		}
+	}
+
+	// resolve mentions, ignoring unknown users and users who cannot see the task
+	mentioned := []models.User{}
+	for _, mention := range parseMentions(content) {
+		user, err := userController.UserRetrieve(ctx, "", mention)
+		if err != nil {
+			continue
+		}
+		if !canAccessTask(ctx, projectController, task, user.Id.Hex()) {
+			continue
+		}
+		mentioned = append(mentioned, user)
+	}
+
+	comment := models.Comment{
+		TaskId:   taskid,
+		ParentId: parentid,
+		Author:   userid,
+		Content:  content,
+		Mentions: []string{},
+	}
+	for _, user := range mentioned {
+		comment.Mentions = append(comment.Mentions, user.Id.Hex())
+	}
+	if err := commentController.CommentCreate(ctx, &comment); err != nil {
+		return comment, err
+	}
+
+	for _, user := range mentioned {
+		if user.Id.Hex() == userid {
+			// no need to notify the author
+			continue
+		}
+		if err := mailer.SendMention(ctx, user.Name, user.Email, username, task.Name, comment.Content); err != nil {
+			slog.WarnContext(ctx, "failed to notify user of mention", "user", user.Name, "error", err)
+		}
+	}
+	return comment, nil
+}
+
+// taskid: string, parentid: string, content: string
+// Mentioned users who can access the task are notified by email.
+func TaskCommentCreate(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, commentController controllers.CommentController, jwtParser *auth.JWTParser, mailer *mailer.Mailer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, name, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query commentCreateBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		task, err := taskController.TaskRetrieve(ctx, query.TaskId)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "task does not exist"))
+			return
+		}
+		comment, err := createComment(ctx, userController, projectController, commentController, mailer, task, query.ParentId, query.Content, id, name)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, commentIdResponse{CommentId: comment.Id.Hex()})
+	}
+}
+
+// Input parameters "taskid"
+// Returns all comments of the task, oldest first. Replies reference their parent comment through parentid.
+func TaskCommentGetAll(projectController controllers.ProjectController, taskController controllers.TaskController, commentController controllers.CommentController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query taskIdQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		taskid := query.TaskId
+		task, err := taskController.TaskRetrieve(ctx, taskid)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "task does not exist"))
+			return
+		}
+		if !canAccessTask(ctx, projectController, task, id) {
+			Respond(ctx, errs.Forbidden("you lack permissions"))
+			return
+		}
+		comments, err := commentController.CommentGetAll(ctx, taskid)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, commentsResponse{Comments: comments})
+	}
+}
+
+// Input parameters "commentid"
+// Only the author can delete their comment. Replies to it are kept.
+func TaskCommentDelete(commentController controllers.CommentController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query commentIdQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		comment, err := commentController.CommentRetrieve(ctx, query.CommentId)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "comment does not exist"))
+			return
+		}
+		if comment.Author != id {
+			Respond(ctx, errs.Forbidden("you lack permissions"))
+			return
+		}
+		if err := commentController.CommentDelete(ctx, comment); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, emptyResponse{})
+	}
+}
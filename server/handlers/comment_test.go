@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMentions(t *testing.T) {
+	tests := map[string][]string{
+		"":                                {},
+		"no mentions here":                {},
+		"@name1 please check":             {"name1"},
+		"@name1 and @name_2, also @name1": {"name1", "name_2"},
+		"cc @first.last!":                 {"first.last"},
+		"@ alone":                         {},
+	}
+
+	for content, expected := range tests {
+		actual := parseMentions(content)
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected %v but got %v for %q", expected, actual, content)
+		}
+	}
+}
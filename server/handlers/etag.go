@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/gin-gonic/gin"
+)
+
+/*
+	Tasks, projects, events and users are versioned, and their ETag is their version.
+	Responses with one of them carry its ETag, and PATCH and DELETE requests with If-Match only apply to the version it names,
+	failing with 412 if it was modified since, so that clients do not overwrite changes they have not seen.
+	The version is part of the filter of the update or deletion itself, so that a change made between reading and writing is caught.
+	Requests without If-Match apply to any version.
+*/
+
+// Sets the ETag of the response to that of the version.
+func setETag(ctx *gin.Context, version int64) {
+	ctx.Header("ETag", `"`+strconv.FormatInt(version, 10)+`"`)
+}
+
+// Returns the version named by the If-Match header, or nil if there is none or it is *.
+// ETags that are weak or not of a version match no version, so they fail the precondition.
+func ifMatch(ctx *gin.Context) (*int64, error) {
+	header := strings.TrimSpace(ctx.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+	if strings.Contains(header, ",") {
+		return nil, errs.Invalid("If-Match", "must be a single ETag")
+	}
+	unquoted, ok := strings.CutPrefix(header, `"`)
+	unquoted, closed := strings.CutSuffix(unquoted, `"`)
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if !ok || !closed || err != nil || version < 0 {
+		return nil, errs.Precondition("If-Match is not the ETag of a version")
+	}
+	return &version, nil
+}
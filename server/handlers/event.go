@@ -1,65 +1,76 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 	"sort"
 	"time"
 
 	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
 	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
 	"github.com/OrgaNiUS/OrgaNiUS/server/functions"
 	"github.com/OrgaNiUS/OrgaNiUS/server/ics"
 	"github.com/OrgaNiUS/OrgaNiUS/server/models"
 	"github.com/OrgaNiUS/OrgaNiUS/server/nusmods"
+	"github.com/OrgaNiUS/OrgaNiUS/server/socket"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// Validates the name and times of an event to create.
+func newEvent(name, start, end string) (models.Event, error) {
+	if name == "" {
+		return models.Event{}, errs.Validation("name is required")
+	}
+	startTime, err := functions.StringToTime(start)
+	if err != nil {
+		return models.Event{}, errs.Validation("bad start time")
+	}
+	endTime, err := functions.StringToTime(end)
+	if err != nil {
+		return models.Event{}, errs.Validation("bad end time")
+	}
+	if startTime.After(endTime) {
+		return models.Event{}, errs.Validation("start cannot be after end")
+	}
+	return models.Event{Name: name, Start: startTime, End: endTime}, nil
+}
+
 func EventCreate(userController controllers.UserController, projectController controllers.ProjectController, eventController controllers.EventController, jwtParser *auth.JWTParser) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
-		type q struct {
-			Name      string `bson:"name" json:"name"`
-			Start     string `bson:"start" json:"start"`
-			End       string `bson:"end" json:"end"`
-			ProjectId string `bson:"projectid" json:"projectid"`
-		}
-		var query q
-		if err := ctx.BindJSON(&query); err != nil {
-			DisplayError(ctx, err.Error())
+		var query eventCreateBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
 			return
 		}
-		if query.Name == "" {
-			DisplayError(ctx, "name is required")
-			return
-		}
-		start, err := functions.StringToTime(query.Start)
-		if err != nil {
-			DisplayError(ctx, "bad start time")
-			return
-		}
-		end, err := functions.StringToTime(query.End)
+		event, err := newEvent(query.Name, query.Start, query.End)
 		if err != nil {
-			DisplayError(ctx, "bad end time")
+			Respond(ctx, err)
 			return
 		}
-		if start.After(end) {
-			DisplayError(ctx, "start cannot be after end")
-			return
-		}
-		event := models.Event{
-			Name:  query.Name,
-			Start: start,
-			End:   end,
+		if query.ProjectId != "" {
+			project, err := projectController.ProjectRetrieve(ctx, query.ProjectId)
+			if err != nil {
+				Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+				return
+			}
+			if !checkProjectWritable(ctx, project) {
+				return
+			}
 		}
 
 		// create the event in database, the Id field of event will be populated as a side effect
 		if err := eventController.EventCreate(ctx, &event); err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
 
@@ -68,11 +79,10 @@ func EventCreate(userController controllers.UserController, projectController co
 			userController.UserAddEvents(ctx, id, eventids)
 		} else {
 			projectController.ProjectAddEvents(ctx, query.ProjectId, eventids)
+			publishActivity(ctx, query.ProjectId, id, socket.ActivityEventCreated, socket.EventPayload{Event: event})
 		}
 
-		ctx.JSON(http.StatusCreated, gin.H{
-			"eventid": event.Id,
-		})
+		ctx.JSON(http.StatusCreated, eventIdResponse{EventId: event.Id.Hex()})
 	}
 }
 
@@ -80,20 +90,26 @@ func EventGet(eventController controllers.EventController, jwtParser *auth.JWTPa
 	return func(ctx *gin.Context) {
 		_, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query eventIdQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
 			return
 		}
-		eventid := ctx.DefaultQuery("eventid", "")
-		event, err := eventController.EventGet(ctx, eventid)
+		event, err := eventController.EventGet(ctx, query.EventId)
 		if err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
-		ctx.JSON(http.StatusOK, gin.H{
-			"id":    event.Id.Hex(),
-			"name":  event.Name,
-			"start": event.Start,
-			"end":   event.End,
+		setETag(ctx, event.Version)
+		ctx.JSON(http.StatusOK, eventResponse{
+			Id:      event.Id.Hex(),
+			Name:    event.Name,
+			Start:   event.Start,
+			End:     event.End,
+			Version: event.Version,
 		})
 	}
 }
@@ -102,17 +118,22 @@ func EventGetAll(userController controllers.UserController, projectController co
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
-		projectid := ctx.DefaultQuery("projectid", "")
+		var query optionalProjectIdQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		projectid := query.ProjectId
 		var eventids []string
 		if projectid == "" {
 			// Get all user events.
 			user, err := userController.UserRetrieve(ctx, id, "")
 			if err != nil {
 				// should never reach here unless someone messed with their JWT
-				DisplayNotAuthorized(ctx, "something went wrong, try again")
+				Respond(ctx, errs.Unauthorized("something went wrong, try again"))
 				return
 			}
 			eventids = user.Events
@@ -120,52 +141,50 @@ func EventGetAll(userController controllers.UserController, projectController co
 			// Get all project events for a projectid.
 			project, err := projectController.ProjectRetrieve(ctx, projectid)
 			if err != nil {
-				DisplayNotAuthorized(ctx, "bad project id")
+				Respond(ctx, errs.Forbidden("bad project id"))
 				return
 			}
 			eventids = project.Events
 		}
 		events := eventController.EventMapToArray(ctx, eventids)
-		ctx.JSON(http.StatusOK, gin.H{
-			"events": events,
-		})
+		ctx.JSON(http.StatusOK, eventsResponse{Events: events})
 	}
 }
 
-func EventModify(eventController controllers.EventController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+func EventModify(projectController controllers.ProjectController, eventController controllers.EventController, jwtParser *auth.JWTParser) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		_, _, ok := jwtParser.GetFromJWT(ctx)
+		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
-		type q struct {
-			Id    string  `bson:"eventid" json:"eventid"`
-			Name  *string `bson:"name" json:"name"`
-			Start *string `bson:"start" json:"start"`
-			End   *string `bson:"end" json:"end"`
+		var query eventModifyBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
 		}
-		var query q
-		if err := ctx.BindJSON(&query); err != nil {
-			DisplayError(ctx, err.Error())
+		if query.EventId == "" {
+			Respond(ctx, errs.Validation("please provide eventid"))
 			return
 		}
-		if query.Id == "" {
-			DisplayError(ctx, "please provide eventid")
+		eventid, err := primitive.ObjectIDFromHex(query.EventId)
+		if err != nil {
+			Respond(ctx, errs.Validation("invalid eventid"))
 			return
 		}
-		eventid, err := primitive.ObjectIDFromHex(query.Id)
+		version, err := ifMatch(ctx)
 		if err != nil {
-			DisplayError(ctx, "invalid eventid")
+			Respond(ctx, err)
 			return
 		}
 
-		err = eventController.EventModify(ctx, eventid, query.Name, query.Start, query.End)
+		err = eventController.EventModify(ctx, eventid, version, query.Name, query.Start, query.End)
 		if err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
-		ctx.JSON(http.StatusOK, gin.H{})
+		publishEvent(ctx, projectController, eventController, query.ProjectId, id, socket.ActivityEventModified, query.EventId)
+		ctx.JSON(http.StatusOK, emptyResponse{})
 	}
 }
 
@@ -173,78 +192,117 @@ func EventDelete(userController controllers.UserController, projectController co
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query eventDeleteQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
 			return
 		}
-		eventid := ctx.DefaultQuery("eventid", "")
+		eventid := query.EventId
 		if eventid == "" {
-			DisplayError(ctx, "provide the eventid")
+			Respond(ctx, errs.Validation("provide the eventid"))
 			return
 		}
-		objectid, err := primitive.ObjectIDFromHex(eventid)
-		if err != nil {
-			DisplayError(ctx, "invalid eventid")
+		if _, err := primitive.ObjectIDFromHex(eventid); err != nil {
+			Respond(ctx, errs.Validation("invalid eventid"))
 			return
 		}
-		if err := eventController.EventDelete(ctx, objectid); err != nil {
-			DisplayError(ctx, "could not delete event")
+		if _, err := eventController.EventGet(ctx, eventid); err != nil {
+			Respond(ctx, errs.OrNotFound(err, "event does not exist"))
 			return
 		}
-		projectid := ctx.DefaultQuery("projectid", "")
-		if projectid == "" {
-			// Delete from the user.
-			userid, _ := primitive.ObjectIDFromHex(id)
-			userController.UserRemoveEvents(ctx, userid, []string{eventid})
-		} else {
-			// Delete from the project.
-			projectobjectid, err := primitive.ObjectIDFromHex(projectid)
+		version, err := ifMatch(ctx)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		projectid := query.ProjectId
+		var project models.Project
+		if projectid != "" {
+			retrieved, err := projectController.ProjectRetrieve(ctx, projectid)
 			if err != nil {
-				DisplayError(ctx, "invalid projectid")
+				Respond(ctx, errs.Validation("invalid projectid"))
 				return
 			}
-			projectController.ProjectRemoveEvents(ctx, projectobjectid, []string{eventid})
+			if !checkProjectWritable(ctx, retrieved) {
+				return
+			}
+			project = retrieved
+		}
+		var from *models.Project
+		if projectid != "" {
+			from = &project
+		}
+		if err := deleteEvent(ctx, userController, projectController, eventController, eventid, from, version, id); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		if functions.Contains(project.Events, eventid) {
+			publishActivity(ctx, projectid, id, socket.ActivityEventDeleted, socket.DeletedPayload{Ids: []string{eventid}})
+		}
+		ctx.JSON(http.StatusOK, emptyResponse{})
+	}
+}
+
+// Moves the event of the project, or of the user if project is nil, to the trash.
+// If version is not nil, the event is only deleted if it is still at the version.
+func deleteEvent(ctx context.Context, userController controllers.UserController, projectController controllers.ProjectController, eventController controllers.EventController, eventid string, project *models.Project, version *int64, userid string) error {
+	projectid := ""
+	if project != nil {
+		projectid = project.Id.Hex()
+	}
+	// moved to the trash, remembering where it was deleted from so that it can be restored there
+	if err := eventController.EventSoftDeleteOne(ctx, eventid, userid, projectid, version, time.Now()); err != nil {
+		if errs.CodeOf(err) == errs.CodePrecondition {
+			return err
 		}
-		ctx.JSON(http.StatusOK, gin.H{})
+		return errs.Validation("could not delete event")
+	}
+	if project == nil {
+		// Delete from the user.
+		id, _ := primitive.ObjectIDFromHex(userid)
+		userController.UserRemoveEvents(ctx, id, []string{eventid})
+	} else {
+		// Delete from the project.
+		projectController.ProjectRemoveEvents(ctx, project.Id, []string{eventid})
 	}
+	return nil
 }
 
 func EventNusmods(userController controllers.UserController, eventController controllers.EventController, jwtParser *auth.JWTParser) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
 
-		type q struct {
-			Url string `bson:"url" json:"url"`
-		}
-		var query q
-		if err := ctx.BindJSON(&query); err != nil {
-			DisplayError(ctx, err.Error())
+		var query nusmodsBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
 			return
 		}
 
 		// generate events by getting data from nusmods API
-		events, err := nusmods.GenerateEvents(query.Url)
+		events, err := nusmods.GenerateEvents(ctx, query.Url)
 		if err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, errs.Validation(err.Error()))
 			return
 		}
 
 		// create events in database
 		eventids, err := eventController.EventCreateMany(ctx, events)
 		if err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
 
 		// add the events to the user
 		userController.UserAddEvents(ctx, id, eventids)
 
-		ctx.JSON(http.StatusCreated, gin.H{
-			"events": events,
-		})
+		ctx.JSON(http.StatusCreated, importedEventsResponse{Events: events})
 	}
 }
 
@@ -252,40 +310,42 @@ func EventIcs(userController controllers.UserController, eventController control
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
 
-		formFile, err := ctx.FormFile("ics_file")
-		if err != nil {
-			DisplayError(ctx, err.Error())
+		var form icsForm
+		if err := ctx.ShouldBindWith(&form, binding.FormMultipart); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
 			return
 		}
-		openedFile, err := formFile.Open()
+		if form.IcsFile == nil {
+			Respond(ctx, errs.Validation(http.ErrMissingFile.Error()))
+			return
+		}
+		openedFile, err := form.IcsFile.Open()
 		if err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
 
 		events, err := ics.Parse(openedFile)
 		if err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, errs.Validation(err.Error()))
 			return
 		}
 
 		// create events in database
 		eventids, err := eventController.EventCreateMany(ctx, events)
 		if err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
 
 		// add the events to the user
 		userController.UserAddEvents(ctx, id, eventids)
 
-		ctx.JSON(http.StatusCreated, gin.H{
-			"events": events,
-		})
+		ctx.JSON(http.StatusCreated, importedEventsResponse{Events: events})
 	}
 }
 
@@ -301,22 +361,13 @@ func EventCommonSlots(userController controllers.UserController, projectControll
 	return func(ctx *gin.Context) {
 		_, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
 
-		type q struct {
-			ProjectId string   `bson:"projectid" json:"projectid"`
-			UserIds   []string `bson:"userids" json:"userids"`
-			DateStart string   `bson:"dateStart" json:"dateStart"`
-			DateEnd   string   `bson:"dateEnd" json:"dateEnd"`
-			TimeStart string   `bson:"timeStart" json:"timeStart"`
-			TimeEnd   string   `bson:"timeEnd" json:"timeEnd"`
-			Duration  int64    `bson:"duration" json:"duration"`
-		}
-		var query q
-		if err := ctx.BindJSON(&query); err != nil {
-			DisplayError(ctx, err.Error())
+		var query commonSlotsBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
 			return
 		}
 
@@ -325,48 +376,48 @@ func EventCommonSlots(userController controllers.UserController, projectControll
 		dateLayout := "06-01-02"
 		dateStart, err := time.ParseInLocation(dateLayout, query.DateStart, location)
 		if err != nil {
-			DisplayError(ctx, "bad date start")
+			Respond(ctx, errs.Validation("bad date start"))
 			return
 		}
 		dateEnd, err := time.ParseInLocation(dateLayout, query.DateEnd, location)
 		dateEnd = dateEnd.Add(time.Minute * (23*60 + 59))
 		if err != nil {
-			DisplayError(ctx, "bad date end")
+			Respond(ctx, errs.Validation("bad date end"))
 			return
 		}
 		if dateStart.After(dateEnd) {
-			DisplayError(ctx, "date must start before end")
+			Respond(ctx, errs.Validation("date must start before end"))
 			return
 		}
 
 		timeLayout := "15:04"
 		timeStart, err := time.ParseInLocation(timeLayout, query.TimeStart, location)
 		if err != nil {
-			DisplayError(ctx, "bad time start")
+			Respond(ctx, errs.Validation("bad time start"))
 			return
 		}
 		timeEnd, err := time.ParseInLocation(timeLayout, query.TimeEnd, location)
 		if err != nil {
-			DisplayError(ctx, "bad time end")
+			Respond(ctx, errs.Validation("bad time end"))
 			return
 		}
 		if timeStart.After(timeEnd) {
-			DisplayError(ctx, "time must start before end")
+			Respond(ctx, errs.Validation("time must start before end"))
 			return
 		}
 
 		if query.Duration <= 0 {
-			DisplayError(ctx, "duration must be positive")
+			Respond(ctx, errs.Validation("duration must be positive"))
 			return
 		}
 
 		if query.Duration > 60*24 {
-			DisplayError(ctx, "duration cannot last more than 24 hours")
+			Respond(ctx, errs.Validation("duration cannot last more than 24 hours"))
 			return
 		}
 
 		if query.ProjectId == "" {
-			DisplayError(ctx, "provide a projectid")
+			Respond(ctx, errs.Validation("provide a projectid"))
 			return
 		}
 
@@ -374,7 +425,7 @@ func EventCommonSlots(userController controllers.UserController, projectControll
 		for i, uid := range query.UserIds {
 			objectid, err := primitive.ObjectIDFromHex(uid)
 			if err != nil {
-				DisplayError(ctx, "bad userid "+uid)
+				Respond(ctx, errs.Validation("bad userid "+uid))
 				return
 			}
 			userids[i] = objectid
@@ -382,13 +433,13 @@ func EventCommonSlots(userController controllers.UserController, projectControll
 
 		eventids, err := userController.UsersGetEventIds(ctx, userids)
 		if err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
 
 		project, err := projectController.ProjectRetrieve(ctx, query.ProjectId)
 		if err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
 		eventids = append(eventids, project.Events...)
@@ -396,6 +447,9 @@ func EventCommonSlots(userController controllers.UserController, projectControll
 		// thus, parse into events
 		events := eventController.EventMapToArray(ctx, eventids)
 
+		// traces the algorithm apart from loading the events, which is traced by the controllers
+		_, span := tracing.Start(ctx, "EventCommonSlots.findSlots", attribute.Int("events", len(events)))
+
 		/*
 			Performance is semi relevant here because there can be MANY events & users.
 
@@ -410,12 +464,7 @@ func EventCommonSlots(userController controllers.UserController, projectControll
 			Note: potentially can optimise by merging steps 3 & 4
 		*/
 
-		type s struct {
-			Start time.Time `json:"start"`
-			End   time.Time `json:"end"`
-		}
-
-		intervals := []s{}
+		intervals := []timeSlot{}
 
 		// filter out events that are out of date range
 		// and convert them into slots at the same time (to save on a teeny bit of space, maybe)
@@ -427,7 +476,7 @@ func EventCommonSlots(userController controllers.UserController, projectControll
 				continue
 			}
 
-			intervals = append(intervals, s{
+			intervals = append(intervals, timeSlot{
 				Start: e.Start,
 				End:   e.End,
 			})
@@ -446,8 +495,8 @@ func EventCommonSlots(userController controllers.UserController, projectControll
 			return x.End.Before(y.End)
 		})
 
-		mergedIntervals := []s{}
-		prev := s{}
+		mergedIntervals := []timeSlot{}
+		prev := timeSlot{}
 
 		// I took my previous solutions for this problem and translated it to golang
 		for i, curr := range intervals {
@@ -473,7 +522,7 @@ func EventCommonSlots(userController controllers.UserController, projectControll
 		}
 
 		// inverting intervals to find empty slots
-		invertedIntervals := []s{}
+		invertedIntervals := []timeSlot{}
 
 		for i, curr := range mergedIntervals {
 			if i == 0 {
@@ -481,7 +530,7 @@ func EventCommonSlots(userController controllers.UserController, projectControll
 				// run the third block
 				if curr.Start.After(dateStart) {
 					// only if valid space
-					slot := s{
+					slot := timeSlot{
 						Start: dateStart,
 						End:   curr.Start.In(location),
 					}
@@ -492,7 +541,7 @@ func EventCommonSlots(userController controllers.UserController, projectControll
 				// catch slots after last interval
 				// and don't run the third block
 				if dateEnd.After((curr.End)) {
-					slot := s{
+					slot := timeSlot{
 						Start: curr.End.In(location),
 						End:   dateEnd,
 					}
@@ -500,7 +549,7 @@ func EventCommonSlots(userController controllers.UserController, projectControll
 				}
 			} else {
 				// always valid because intervals have been merged
-				slot := s{
+				slot := timeSlot{
 					Start: curr.End.In(location),
 					End:   mergedIntervals[i+1].Start.In(location),
 				}
@@ -510,7 +559,7 @@ func EventCommonSlots(userController controllers.UserController, projectControll
 
 		if len(mergedIntervals) == 0 {
 			// put the whole range here
-			invertedIntervals = []s{
+			invertedIntervals = []timeSlot{
 				{
 					Start: dateStart,
 					End:   dateEnd,
@@ -519,7 +568,7 @@ func EventCommonSlots(userController controllers.UserController, projectControll
 		}
 
 		// returns if a slot is valid (based on the query duration)
-		isValidSlot := func(slot s) bool {
+		isValidSlot := func(slot timeSlot) bool {
 			if slot.Start.After(slot.End) {
 				return false
 			}
@@ -540,9 +589,9 @@ func EventCommonSlots(userController controllers.UserController, projectControll
 		truncateToStart := truncateTime(timeStartHour, timeStartMin)
 		truncateToEnd := truncateTime(timeEndHour, timeEndMin)
 
-		trimSlot := func(slot s) []s {
-			slots := []s{}
-			current := s{
+		trimSlot := func(slot timeSlot) []timeSlot {
+			slots := []timeSlot{}
+			current := timeSlot{
 				Start: slot.Start,
 				End:   slot.End,
 			}
@@ -563,7 +612,7 @@ func EventCommonSlots(userController controllers.UserController, projectControll
 					end = current.End
 				}
 
-				slot := s{
+				slot := timeSlot{
 					Start: start,
 					End:   end,
 				}
@@ -577,15 +626,15 @@ func EventCommonSlots(userController controllers.UserController, projectControll
 			return slots
 		}
 
-		slots := []s{}
+		slots := []timeSlot{}
 
 		for _, interval := range invertedIntervals {
 			trimmedSlots := trimSlot(interval)
 			slots = append(slots, trimmedSlots...)
 		}
+		span.SetAttributes(attribute.Int("slots", len(slots)))
+		span.End()
 
-		ctx.JSON(http.StatusOK, gin.H{
-			"slots": slots,
-		})
+		ctx.JSON(http.StatusOK, slotsResponse{Slots: slots})
 	}
 }
@@ -2,17 +2,97 @@
 package handlers
 
 import (
-	"log"
-	"net/http"
+	"encoding/json"
+	"errors"
+	"log/slog"
 
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func DisplayError(ctx *gin.Context, message string) {
-	log.Printf("displaying error to client: %v", message)
-	ctx.JSON(http.StatusBadRequest, gin.H{"error": message})
+// Responds with the error as {"error": message, "code": code}, with "fields" for invalid fields, and the HTTP status of its code.
+// Errors of v2 are enveloped as {"error": {"code": code, "message": message, "fields": fields}}.
+// The handlers after the current one are not run, and the current one must return.
+// Errors without a code are internal: they are logged, and their details are not shown to the client.
+func Respond(ctx *gin.Context, err error) {
+	e := errs.From(err)
+	if e.Code == errs.CodeInternal {
+		slog.ErrorContext(ctx, "internal error", "error", err)
+		tracing.Fail(trace.SpanFromContext(tracing.Context(ctx)), err)
+	} else {
+		// errors shown to clients are mostly invalid requests, which are not a problem of the server
+		slog.DebugContext(ctx, "displaying error to client", "code", e.Code, "error", e.Message)
+	}
+
+	if ctx.GetBool(v2Key) {
+		ctx.AbortWithStatusJSON(e.Status(), errorEnvelope{Error: problem{Code: e.Code, Message: e.Message, Fields: e.Fields}})
+	} else {
+		ctx.AbortWithStatusJSON(e.Status(), errorBody{Code: e.Code, Error: e.Message, Fields: e.Fields})
+	}
+	if w, ok := ctx.Writer.(*errorWriter); ok {
+		w.responded = true
+	}
+}
+
+// Returns the error of binding the body of a request, naming the field of the wrong type if there is one.
+func invalidBody(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return errs.Invalid(typeErr.Field, "must be a "+typeErr.Type.String())
+	}
+	return errs.Validation(err.Error())
+}
+
+// Stops each request at its first error response.
+// A handler that carries on after responding with an error cannot write to the response again,
+// and the last error added with ctx.Error is responded with if the handlers return without writing a response.
+func Errors() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Writer = &errorWriter{ResponseWriter: ctx.Writer}
+		ctx.Next()
+		if len(ctx.Errors) > 0 && !ctx.Writer.Written() {
+			Respond(ctx, ctx.Errors.Last().Err)
+		}
+	}
+}
+
+// Drops what is written after an error response.
+type errorWriter struct {
+	gin.ResponseWriter
+	responded bool
+	warned    bool
+}
+
+func (w *errorWriter) dropped() {
+	if !w.warned {
+		w.warned = true
+		slog.Warn("handler wrote a response after an error response, which was dropped")
+	}
+}
+
+func (w *errorWriter) WriteHeader(code int) {
+	if w.responded {
+		w.dropped()
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Reports the write as done, as the renderers of gin panic on errors.
+func (w *errorWriter) Write(data []byte) (int, error) {
+	if w.responded {
+		w.dropped()
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
 }
 
-func DisplayNotAuthorized(ctx *gin.Context, message string) {
-	ctx.JSON(http.StatusUnauthorized, gin.H{"error": message})
+func (w *errorWriter) WriteString(s string) (int, error) {
+	if w.responded {
+		w.dropped()
+		return len(s), nil
+	}
+	return w.ResponseWriter.WriteString(s)
 }
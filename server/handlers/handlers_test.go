@@ -1,53 +1,92 @@
 package handlers_test
 
 import (
-	"fmt"
-	"io"
+	"errors"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
 	"github.com/OrgaNiUS/OrgaNiUS/server/handlers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/txn"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// Used because display errors and not authorized are very similar.
-func testDisplay(t *testing.T, f func(ctx *gin.Context, message string), code int) {
-	msgs := []string{
-		"",
-		"abc",
-		"some error message",
-		`very long lorem ipsum: Lorem ipsum dolor sit amet, consectetur adipiscing elit. In sollicitudin augue diam. Curabitur quis accumsan diam, eu pharetra sapien. Quisque accumsan ut sapien ut mollis. Curabitur convallis tellus suscipit, gravida turpis ac, rutrum mi. Mauris eu eros purus. Nullam quis elementum orci, sit amet bibendum nisi. Etiam nec ipsum urna. Sed non scelerisque erat. Morbi at varius nibh, a consectetur dolor. Praesent vitae viverra purus. Pellentesque sodales pharetra dolor, id ornare libero molestie at.`,
+func TestRespond(t *testing.T) {
+	type Expected struct {
+		code int
+		body string
 	}
 
-	for _, msg := range msgs {
+	tests := map[error]Expected{
+		errs.Validation("abc"):                        {http.StatusBadRequest, `{"code":"validation","error":"abc"}`},
+		errs.Invalid("name", "cannot be empty"):       {http.StatusBadRequest, `{"code":"validation","error":"name cannot be empty","fields":{"name":"cannot be empty"}}`},
+		errs.Unauthorized("not logged in"):            {http.StatusUnauthorized, `{"code":"unauthorized","error":"not logged in"}`},
+		errs.Forbidden("you lack permissions"):        {http.StatusForbidden, `{"code":"forbidden","error":"you lack permissions"}`},
+		errs.OrNotFound(mongo.ErrNoDocuments, "gone"): {http.StatusNotFound, `{"code":"not_found","error":"gone"}`},
+		errs.Conflict("project is archived"):          {http.StatusConflict, `{"code":"conflict","error":"project is archived"}`},
+		// the details of internal errors are not shown
+		errors.New("connection refused to 10.0.0.1"): {http.StatusInternalServerError, `{"code":"internal","error":"internal server error"}`},
+		// clients are told that a failed update left changes behind, without the cause
+		&txn.Error{Err: errs.Forbidden("you lack permissions"), Rollback: errors.New("connection refused")}: {http.StatusForbidden, `{"code":"forbidden","error":"you lack permissions (could not undo earlier changes)"}`},
+		&txn.Error{Err: errors.New("connection refused"), Rollback: errors.New("connection refused")}:       {http.StatusInternalServerError, `{"code":"internal","error":"internal server error (could not undo earlier changes)"}`},
+		&txn.Error{Err: errs.Forbidden("you lack permissions")}:                                             {http.StatusForbidden, `{"code":"forbidden","error":"you lack permissions"}`},
+	}
+
+	for err, expected := range tests {
 		w := httptest.NewRecorder()
 		ctx, _ := gin.CreateTestContext(w)
-		f(ctx, msg)
-		result := w.Result()
-		if result.StatusCode != code {
-			t.Errorf("Expected status code %v but got %v", code, result.StatusCode)
+		handlers.Respond(ctx, err)
+		if w.Code != expected.code {
+			t.Errorf("Expected status code %v but got %v for %v", expected.code, w.Code, err)
 		}
-		body, err := io.ReadAll(result.Body)
-		if err != nil {
-			t.Error(err)
+		if body := w.Body.String(); body != expected.body {
+			t.Errorf("Expected %v but got %v (JSON)", expected.body, body)
 		}
-		actualBody := string(body)
-		expectedBody := fmt.Sprintf(`{"error":"%v"}`, msg)
-		if actualBody != expectedBody {
-			t.Errorf("Expected %v but got %v (JSON)", expectedBody, actualBody)
+		if !ctx.IsAborted() {
+			t.Errorf("Expected the handlers after responding with %v to be aborted", err)
 		}
 	}
 }
 
-func TestDisplayError(t *testing.T) {
-	testDisplay(t, handlers.DisplayError, http.StatusBadRequest)
-}
+func TestErrors(t *testing.T) {
+	router := gin.New()
+	router.Use(handlers.Errors())
+	// responds with an error but carries on, as if a return is missing
+	router.GET("/carry-on", func(ctx *gin.Context) {
+		handlers.Respond(ctx, errs.NotFound("project does not exist"))
+		ctx.JSON(http.StatusOK, gin.H{"project": "leaked"})
+	})
+	// adds an error without responding
+	router.GET("/unwritten", func(ctx *gin.Context) {
+		ctx.Error(errs.Conflict("a timer is already running"))
+	})
+	router.GET("/ok", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{})
+	})
+
+	tests := map[string]struct {
+		code int
+		body string
+	}{
+		"/carry-on":  {http.StatusNotFound, `{"code":"not_found","error":"project does not exist"}`},
+		"/unwritten": {http.StatusConflict, `{"code":"conflict","error":"a timer is already running"}`},
+		"/ok":        {http.StatusOK, `{}`},
+	}
 
-func TestDisplayNotAuthorized(t *testing.T) {
-	testDisplay(t, handlers.DisplayNotAuthorized, http.StatusUnauthorized)
+	for path, expected := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != expected.code {
+			t.Errorf("Expected status code %v but got %v for %v", expected.code, w.Code, path)
+		}
+		if body := w.Body.String(); body != expected.body {
+			t.Errorf("Expected %v but got %v for %v", expected.body, body, path)
+		}
+	}
 }
 
 func TestMain(m *testing.M) {
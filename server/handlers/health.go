@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Checks that a dependency of the server, such as the database, can be used.
+type ReadyCheck func(ctx context.Context) error
+
+// Whether the server is ready to serve requests.
+// It stops being ready once it starts shutting down, so that load balancers stop sending it requests.
+type Readiness struct {
+	checks   map[string]ReadyCheck
+	timeout  time.Duration
+	draining int32
+}
+
+// Each check has up to the timeout to respond.
+func NewReadiness(timeout time.Duration) *Readiness {
+	return &Readiness{
+		checks:  map[string]ReadyCheck{},
+		timeout: timeout,
+	}
+}
+
+func (r *Readiness) Add(name string, check ReadyCheck) {
+	r.checks[name] = check
+}
+
+// Makes the server report that it is not ready, for the rest of its life.
+func (r *Readiness) Drain() {
+	atomic.StoreInt32(&r.draining, 1)
+}
+
+// Runs the checks concurrently, returning the error of each by name, nil if it passed.
+func (r *Readiness) Check(ctx context.Context) map[string]error {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := map[string]error{}
+	for name, check := range r.checks {
+		wg.Add(1)
+		go func(name string, check ReadyCheck) {
+			defer wg.Done()
+			err := check(ctx)
+			mu.Lock()
+			results[name] = err
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+	return results
+}
+
+// Caches the result of the check, for a dependency that should not be called on every request, such as a paid API.
+func CachedCheck(check ReadyCheck, ttl time.Duration) ReadyCheck {
+	var mu sync.Mutex
+	var checked time.Time
+	var result error
+	return func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if checked.IsZero() || time.Since(checked) >= ttl {
+			result = check(ctx)
+			checked = time.Now()
+		}
+		return result
+	}
+}
+
+// Reports that the server is running, without checking its dependencies.
+// Used by liveness probes, which restart the server when it fails.
+func Healthz() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, gin.H{"status": "ok"})
+	}
+}
+
+// Reports whether the server can serve requests, which needs each of its dependencies.
+// Used by readiness probes, which stop sending requests to the server while it fails.
+func Readyz(readiness *Readiness) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if atomic.LoadInt32(&readiness.draining) == 1 {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting down"})
+			return
+		}
+		ready := true
+		checks := gin.H{}
+		for name, err := range readiness.Check(ctx) {
+			if err != nil {
+				ready = false
+				checks[name] = err.Error()
+			} else {
+				checks[name] = "ok"
+			}
+		}
+		if !ready {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{"status": "not ready", "checks": checks})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"status": "ready", "checks": checks})
+	}
+}
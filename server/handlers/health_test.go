@@ -0,0 +1,68 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/handlers"
+	"github.com/gin-gonic/gin"
+)
+
+func readyz(t *testing.T, readiness *handlers.Readiness) (int, map[string]interface{}) {
+	t.Helper()
+	router := gin.New()
+	router.GET("/readyz", handlers.Readyz(readiness))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, body
+}
+
+func TestReadyz(t *testing.T) {
+	readiness := handlers.NewReadiness(50 * time.Millisecond)
+	readiness.Add("database", func(ctx context.Context) error { return nil })
+	if code, body := readyz(t, readiness); code != http.StatusOK || body["status"] != "ready" {
+		t.Errorf("Expected the server to be ready, got %v %v", code, body)
+	}
+
+	// a check that does not respond in time fails
+	readiness.Add("mail", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	code, body := readyz(t, readiness)
+	checks, _ := body["checks"].(map[string]interface{})
+	if code != http.StatusServiceUnavailable || checks["database"] != "ok" || checks["mail"] != context.DeadlineExceeded.Error() {
+		t.Errorf("Expected the mail check to fail, got %v %v", code, body)
+	}
+
+	readiness = handlers.NewReadiness(time.Second)
+	readiness.Drain()
+	if code, body := readyz(t, readiness); code != http.StatusServiceUnavailable || body["status"] != "shutting down" {
+		t.Errorf("Expected the server not to be ready once draining, got %v %v", code, body)
+	}
+}
+
+func TestCachedCheck(t *testing.T) {
+	calls := 0
+	check := handlers.CachedCheck(func(ctx context.Context) error {
+		calls++
+		return errors.New("unreachable")
+	}, time.Hour)
+	for i := 0; i < 3; i++ {
+		if err := check(context.Background()); err == nil {
+			t.Error("Expected the cached error")
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected the check to be called once, got %v", calls)
+	}
+}
@@ -0,0 +1,506 @@
+package handlers
+
+import (
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/openapi"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// The body of error responses, as written by Respond.
+type errorBody struct {
+	Code   errs.Code         `json:"code" required:"true" enum:"validation,unauthorized,forbidden,not_found,conflict,precondition_failed,internal" doc:"compare this rather than the message"`
+	Error  string            `json:"error" required:"true" doc:"can be shown to the user"`
+	Fields map[string]string `json:"fields,omitempty" doc:"the problem with each invalid field"`
+}
+
+// The request and response bodies of v1 that are not models.
+// The handlers decode and write these types, so that the spec built from them describes what they take and respond with.
+type (
+	emptyResponse struct{}
+	nameQuery     struct {
+		Name  string `form:"name"`
+		Email string `form:"email"`
+	}
+	existsResponse struct {
+		Exists bool `json:"exists"`
+	}
+	userQuery struct {
+		Id   string `form:"id" doc:"either id or name"`
+		Name string `form:"name"`
+	}
+	publicUser struct {
+		Name     string   `json:"name"`
+		Email    string   `json:"email"`
+		Projects []string `json:"projects" doc:"projectids"`
+	}
+	signupBody struct {
+		Name     string `json:"name" required:"true" doc:"at least 5 characters of letters, digits, ' ', '_' and '.'"`
+		Password string `json:"password" required:"true" doc:"at least 8 characters with a lowercase letter, an uppercase letter and a digit"`
+		Email    string `json:"email" required:"true"`
+	}
+	loginBody struct {
+		Name     string `json:"name" required:"true"`
+		Password string `json:"password" required:"true"`
+	}
+	pinBody struct {
+		Name string `json:"name" required:"true"`
+		Pin  string `json:"pin" required:"true" doc:"sent by email"`
+	}
+	forgotPWBody struct {
+		Name string `json:"name" required:"true"`
+	}
+	validResponse struct {
+		Valid bool `json:"valid"`
+	}
+	changeForgotPWBody struct {
+		Name     string `json:"name" required:"true"`
+		Pin      string `json:"pin" required:"true"`
+		Password string `json:"password" required:"true"`
+	}
+	projectInvite struct {
+		Id          primitive.ObjectID `json:"id"`
+		Name        string             `json:"name"`
+		Description string             `json:"description"`
+		Members     map[string]string  `json:"members" doc:"userid to role"`
+	}
+	projectInvitesResponse struct {
+		Projects []projectInvite `json:"projects"`
+	}
+	applyBody struct {
+		ProjectId   string `json:"projectid" required:"true"`
+		Description string `json:"description"`
+	}
+	projectIdBody struct {
+		ProjectId string `json:"projectid" required:"true"`
+	}
+	projectIdQuery struct {
+		ProjectId string `form:"projectid" required:"true"`
+	}
+	optionalProjectIdQuery struct {
+		ProjectId string `form:"projectid" doc:"the user's own if not given"`
+	}
+	projectCreateBody struct {
+		Name        string `json:"name" required:"true" doc:"at least 5 characters"`
+		Description string `json:"description"`
+		IsPublic    bool   `json:"isPublic"`
+	}
+	projectIdResponse struct {
+		ProjectId string `json:"projectid"`
+	}
+	projectMember struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+		Role string `json:"role"`
+	}
+	projectResponse struct {
+		Name         string                 `json:"name"`
+		Description  string                 `json:"description"`
+		CreationTime time.Time              `json:"creationTime"`
+		Members      []projectMember        `json:"members"`
+		Tasks        []models.Task          `json:"tasks"`
+		IsPublic     bool                   `json:"isPublic"`
+		Events       []models.Event         `json:"events"`
+		States       []models.WorkflowState `json:"states"`
+		Version      int64                  `json:"version" doc:"the ETag of the project"`
+	}
+	projectSummary struct {
+		Id           string    `json:"id"`
+		Name         string    `json:"name"`
+		Description  string    `json:"description"`
+		CreationTime time.Time `json:"creationTime"`
+	}
+	projectsResponse struct {
+		Projects []projectSummary `json:"projects"`
+	}
+	projectModifyBody struct {
+		ProjectId string `json:"projectid" required:"true"`
+		projectChanges
+	}
+	projectStatesBody struct {
+		ProjectId string                 `json:"projectid" required:"true"`
+		States    []models.WorkflowState `json:"states" required:"true" doc:"ordered, with unique names and both terminal and non-terminal states"`
+	}
+	attachmentLimitsBody struct {
+		ProjectId    string   `json:"projectid" required:"true"`
+		MaxSize      int64    `json:"maxSize" doc:"in bytes"`
+		AllowedTypes []string `json:"allowedTypes" doc:"content types such as image/png or image/*, all if empty"`
+	}
+	projectTemplateCreateBody struct {
+		ProjectId string `json:"projectid" required:"true"`
+		Name      string `json:"name" required:"true"`
+		Start     string `json:"start" doc:"ISO 8601, which task deadlines are relative to, the creation of the project if not given"`
+	}
+	templateIdResponse struct {
+		TemplateId string `json:"templateid"`
+	}
+	projectTemplatesResponse struct {
+		Templates []models.ProjectTemplate `json:"templates"`
+	}
+	projectTemplateUseBody struct {
+		TemplateId  string  `json:"templateid" required:"true"`
+		Name        string  `json:"name" required:"true"`
+		Description *string `json:"description" doc:"that of the template if not given"`
+		Start       string  `json:"start" doc:"ISO 8601, which task deadlines are rebased on, now if not given"`
+	}
+	templateIdQuery struct {
+		TemplateId string `form:"templateid" required:"true"`
+	}
+	timeReportQuery struct {
+		ProjectId string `form:"projectid" required:"true"`
+		From      string `form:"from" doc:"ISO 8601"`
+		To        string `form:"to" doc:"ISO 8601"`
+		Format    string `form:"format" enum:"json,csv" doc:"json by default"`
+	}
+	timeReportResponse struct {
+		Report models.TimeReport `json:"report"`
+	}
+	projectInviteBody struct {
+		ProjectId string   `json:"projectid" required:"true"`
+		Users     []string `json:"users" required:"true" doc:"usernames"`
+	}
+	applicant struct {
+		Id          string `json:"id"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	}
+	applicantsResponse struct {
+		Id         string      `json:"id"`
+		Name       string      `json:"name"`
+		Applicants []applicant `json:"applicants"`
+	}
+	projectChooseBody struct {
+		ProjectId     string   `json:"projectid" required:"true"`
+		AcceptedUsers []string `json:"acceptedUsers" doc:"userids"`
+		RejectedUsers []string `json:"rejectedUsers" doc:"userids"`
+	}
+	projectRemoveBody struct {
+		ProjectId string   `json:"projectid" required:"true"`
+		UserIds   []string `json:"userids" required:"true"`
+	}
+	projectArchiveBody struct {
+		ProjectId  string `json:"projectid" required:"true"`
+		IsArchived bool   `json:"isArchived"`
+	}
+	trashResponse struct {
+		Tasks    []models.Task    `json:"tasks"`
+		Projects []models.Project `json:"projects"`
+		Events   []models.Event   `json:"events"`
+	}
+	trashRestoreBody struct {
+		Type string `json:"type" required:"true" enum:"task,project,event"`
+		Id   string `json:"id" required:"true"`
+	}
+	taskIdResponse struct {
+		TaskId string `json:"taskid"`
+	}
+	taskDeleteQuery struct {
+		ProjectId string   `form:"projectid" doc:"personal tasks if not given"`
+		Tasks     []string `form:"tasks" required:"true" doc:"taskids, repeated"`
+	}
+	taskModifyBody struct {
+		TaskId string `json:"taskid" required:"true"`
+		taskChanges
+	}
+	taskMoveBody struct {
+		ProjectId string `json:"projectid" required:"true"`
+		TaskId    string `json:"taskid" required:"true"`
+		State     string `json:"state" required:"true"`
+		Position  int    `json:"position" doc:"within the column of the state, from 0"`
+	}
+	taskSeriesModifyBody struct {
+		TaskId      string             `json:"taskid" required:"true"`
+		Name        *string            `json:"name"`
+		Description *string            `json:"description"`
+		AddTags     *[]string          `json:"addTags"`
+		RemoveTags  *[]string          `json:"removeTags"`
+		Recurrence  *models.Recurrence `json:"recurrence"`
+	}
+	taskIdBody struct {
+		TaskId string `json:"taskid" required:"true"`
+	}
+	taskIdQuery struct {
+		TaskId string `form:"taskid" required:"true"`
+	}
+	tasksResponse struct {
+		Tasks []models.Task `json:"tasks"`
+	}
+	taskQueryResponse struct {
+		Tasks  []models.Task `json:"tasks"`
+		Cursor string        `json:"cursor" doc:"of the next page, empty on the last page"`
+	}
+	taskBulkBody struct {
+		TaskIds    []string        `json:"taskids" doc:"either taskids or filter"`
+		Filter     *taskQueryInput `json:"filter"`
+		Operation  string          `json:"operation" required:"true" enum:"markDone,delete,reassign,addTags,removeTags,shiftDeadline"`
+		IsDone     bool            `json:"isDone" doc:"for markDone"`
+		AssignedTo []string        `json:"assignedTo" doc:"for reassign"`
+		Tags       []string        `json:"tags" doc:"for addTags and removeTags"`
+		Days       int             `json:"days" doc:"for shiftDeadline"`
+	}
+	taskBulkResult struct {
+		TaskId string    `json:"taskid"`
+		Ok     bool      `json:"ok"`
+		Error  string    `json:"error,omitempty"`
+		Code   errs.Code `json:"code,omitempty"`
+	}
+	taskBulkResponse struct {
+		Results []taskBulkResult `json:"results"`
+	}
+	taskTemplateCreateBody struct {
+		models.TaskTemplate
+		TaskId string `json:"taskid" doc:"an existing task to save, instead of the fields of the template"`
+	}
+	taskTemplatesResponse struct {
+		Templates []models.TaskTemplate `json:"templates"`
+	}
+	taskTemplateUseBody struct {
+		TemplateId string   `json:"templateid" required:"true"`
+		Start      string   `json:"start" doc:"ISO 8601, which the deadline is rebased on, now if not given"`
+		AssignedTo []string `json:"assignedTo"`
+	}
+	activityResponse struct {
+		Activity []models.TaskActivity `json:"activity"`
+	}
+	commentCreateBody struct {
+		TaskId string `json:"taskid" required:"true"`
+		commentBody
+	}
+	commentIdResponse struct {
+		CommentId string `json:"commentid"`
+	}
+	commentsResponse struct {
+		Comments []models.Comment `json:"comments"`
+	}
+	commentIdQuery struct {
+		CommentId string `form:"commentid" required:"true"`
+	}
+	entryResponse struct {
+		Entry *models.TimeEntry `json:"entry"`
+	}
+	timeAddBody struct {
+		TaskId string `json:"taskid" required:"true"`
+		Start  string `json:"start" required:"true" doc:"ISO 8601"`
+		End    string `json:"end" required:"true" doc:"ISO 8601, at most a day after start"`
+		Note   string `json:"note"`
+	}
+	entriesResponse struct {
+		Entries []models.TimeEntry `json:"entries"`
+	}
+	entryIdQuery struct {
+		EntryId string `form:"entryid" required:"true"`
+	}
+	attachmentForm struct {
+		File      *multipart.FileHeader `json:"file" form:"file" required:"true"`
+		TaskId    string                `json:"taskid" form:"taskid" doc:"either taskid or projectid"`
+		ProjectId string                `json:"projectid" form:"projectid"`
+	}
+	attachmentResponse struct {
+		Attachment models.Attachment `json:"attachment"`
+	}
+	attachmentOwnerQuery struct {
+		TaskId    string `form:"taskid" doc:"either taskid or projectid"`
+		ProjectId string `form:"projectid"`
+	}
+	attachmentsResponse struct {
+		Attachments []models.Attachment `json:"attachments"`
+	}
+	attachmentIdQuery struct {
+		AttachmentId string `form:"attachmentid" required:"true"`
+	}
+	eventCreateBody struct {
+		eventInput
+		ProjectId string `json:"projectid" doc:"a personal event if not given"`
+	}
+	eventIdResponse struct {
+		EventId string `json:"eventid"`
+	}
+	eventIdQuery struct {
+		EventId string `form:"eventid" required:"true"`
+	}
+	eventResponse struct {
+		Id      string    `json:"id"`
+		Name    string    `json:"name"`
+		Start   time.Time `json:"start"`
+		End     time.Time `json:"end"`
+		Version int64     `json:"version" doc:"the ETag of the event"`
+	}
+	eventDeleteQuery struct {
+		EventId   string `form:"eventid" required:"true"`
+		ProjectId string `form:"projectid" doc:"for project events"`
+	}
+	eventsResponse struct {
+		Events []models.Event `json:"events"`
+	}
+	importedEventsResponse struct {
+		Events []*models.Event `json:"events"`
+	}
+	eventModifyBody struct {
+		EventId   string `json:"eventid" required:"true"`
+		ProjectId string `json:"projectid" doc:"the project of the event, whose members are told of the change"`
+		eventPatchBody
+	}
+	nusmodsBody struct {
+		Url string `json:"url" required:"true" doc:"a share link of a NUSMods timetable"`
+	}
+	icsForm struct {
+		IcsFile *multipart.FileHeader `json:"ics_file" form:"ics_file" required:"true"`
+	}
+	commonSlotsBody struct {
+		ProjectId string   `json:"projectid" required:"true"`
+		UserIds   []string `json:"userids" doc:"the members to find a slot for"`
+		DateStart string   `json:"dateStart" required:"true" doc:"YY-MM-DD"`
+		DateEnd   string   `json:"dateEnd" required:"true" doc:"YY-MM-DD"`
+		TimeStart string   `json:"timeStart" required:"true" doc:"HH:MM of each day"`
+		TimeEnd   string   `json:"timeEnd" required:"true" doc:"HH:MM of each day"`
+		Duration  int64    `json:"duration" required:"true" doc:"in minutes, at most a day"`
+	}
+	timeSlot struct {
+		Start time.Time `json:"start"`
+		End   time.Time `json:"end"`
+	}
+	slotsResponse struct {
+		Slots []timeSlot `json:"slots"`
+	}
+	roomQuery struct {
+		RoomId string `form:"roomid" required:"true" doc:"the projectid"`
+	}
+	activityQuery struct {
+		ProjectId string  `form:"projectid" required:"true"`
+		Since     *uint64 `form:"since" doc:"the seq of the last activity received, to be sent those after it"`
+	}
+)
+
+// The routes of v1, in the order they are registered in.
+// Every route registered under /api/v1 must be here, which is checked by a test of the server.
+func V1Routes() []openapi.Route {
+	const (
+		users     = "users"
+		projects  = "projects"
+		templates = "templates"
+		trash     = "trash"
+		tasks     = "tasks"
+		comments  = "comments"
+		times     = "time tracking"
+		files     = "attachments"
+		events    = "events"
+		realtime  = "realtime"
+		docs      = "docs"
+	)
+	get, post, patch, del := http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete
+	return []openapi.Route{
+		{Method: post, Path: "/api/v1/signup", Tag: users, Summary: "Signs up, sending a pin to verify the email with", Body: signupBody{}, Status: http.StatusCreated, Response: emptyResponse{}},
+		{Method: post, Path: "/api/v1/verify", Tag: users, Summary: "Verifies the email of a user who signed up, logging in", Body: pinBody{}, Response: emptyResponse{}},
+		{Method: post, Path: "/api/v1/login", Tag: users, Summary: "Logs in, setting the JWT cookie", Body: loginBody{}, Status: http.StatusCreated, Response: emptyResponse{}},
+		{Method: get, Path: "/api/v1/refresh_jwt", Tag: users, Summary: "Refreshes the JWT cookie", Auth: true, Response: emptyResponse{}},
+		{Method: del, Path: "/api/v1/logout", Tag: users, Summary: "Logs out, deleting the JWT cookie", Auth: true, Response: emptyResponse{}},
+		{Method: post, Path: "/api/v1/forgot_pw", Tag: users, Summary: "Sends a pin to reset the password with by email", Body: forgotPWBody{}, Response: emptyResponse{}},
+		{Method: post, Path: "/api/v1/verify_forgot_pw", Tag: users, Summary: "Checks the pin to reset the password with", Body: pinBody{}, Response: validResponse{}},
+		{Method: post, Path: "/api/v1/change_forgot_pw", Tag: users, Summary: "Resets the password with the pin", Body: changeForgotPWBody{}, Response: emptyResponse{}},
+		{Method: get, Path: "/api/v1/own_user", Tag: users, Summary: "Returns the user who is logged in", Auth: true, Response: models.User{}, Versioned: true},
+		{Method: patch, Path: "/api/v1/user", Tag: users, Summary: "Changes the name, password or email of the user", Auth: true, Body: userChanges{}, Response: models.User{}, Versioned: true},
+		{Method: del, Path: "/api/v1/user", Tag: users, Summary: "Deletes the user, logging out", Auth: true, Versioned: true, Response: emptyResponse{}},
+		{Method: get, Path: "/api/v1/user_exists", Tag: users, Summary: "Checks whether a name or email is taken", Query: nameQuery{}, Response: existsResponse{}},
+		{Method: get, Path: "/api/v1/user", Tag: users, Summary: "Returns the public details of a user", Query: userQuery{}, Response: publicUser{}},
+		{Method: get, Path: "/api/v1/user_get_project_invites", Tag: users, Summary: "Returns the projects the user is invited to", Auth: true, Response: projectInvitesResponse{}},
+		{Method: patch, Path: "/api/v1/user_apply", Tag: users, Summary: "Applies to join a public project", Auth: true, Body: applyBody{}, Response: emptyResponse{}},
+		{Method: patch, Path: "/api/v1/user_accept", Tag: users, Summary: "Accepts an invite to a project", Auth: true, Body: projectIdBody{}, Response: emptyResponse{}},
+		{Method: patch, Path: "/api/v1/user_reject", Tag: users, Summary: "Rejects an invite to a project", Auth: true, Body: projectIdBody{}, Response: emptyResponse{}},
+
+		{Method: post, Path: "/api/v1/project_create", Tag: projects, Summary: "Creates a project with the user as its admin", Auth: true, Body: projectCreateBody{}, Status: http.StatusCreated, Response: projectIdResponse{}},
+		{Method: get, Path: "/api/v1/project_get", Tag: projects, Summary: "Returns a project of the user with its members, tasks and events", Auth: true, Query: projectIdQuery{}, Response: projectResponse{}, Versioned: true},
+		{Method: get, Path: "/api/v1/project_get_all", Tag: projects, Summary: "Returns the projects of the user", Auth: true, Response: projectsResponse{}},
+		{Method: patch, Path: "/api/v1/project_modify", Tag: projects, Summary: "Changes the name, description or visibility of a project", Description: "Only for admins.", Auth: true, Body: projectModifyBody{}, Versioned: true, Response: emptyResponse{}},
+		{Method: patch, Path: "/api/v1/project_modify_states", Tag: projects, Summary: "Replaces the workflow states of a project", Description: "Tasks in removed states are moved to the initial state.", Auth: true, Body: projectStatesBody{}, Response: emptyResponse{}},
+		{Method: patch, Path: "/api/v1/project_modify_attachment_limits", Tag: projects, Summary: "Sets the upload limits of attachments of a project", Auth: true, Body: attachmentLimitsBody{}, Response: emptyResponse{}},
+		{Method: post, Path: "/api/v1/project_template_create", Tag: templates, Summary: "Saves a project as a template", Auth: true, Body: projectTemplateCreateBody{}, Status: http.StatusCreated, Response: templateIdResponse{}},
+		{Method: get, Path: "/api/v1/project_template_get_all", Tag: templates, Summary: "Returns the project templates of the user", Auth: true, Response: projectTemplatesResponse{}},
+		{Method: post, Path: "/api/v1/project_template_use", Tag: templates, Summary: "Creates a project from a template", Auth: true, Body: projectTemplateUseBody{}, Status: http.StatusCreated, Response: projectIdResponse{}},
+		{Method: del, Path: "/api/v1/project_template_delete", Tag: templates, Summary: "Deletes a project template", Auth: true, Query: templateIdQuery{}, Response: emptyResponse{}},
+		{Method: get, Path: "/api/v1/project_time_report", Tag: times, Summary: "Reports the time logged in a project by member, tag and week", Auth: true, Query: timeReportQuery{}, Response: timeReportResponse{}, Description: "Responds with a CSV file instead if format is csv."},
+		{Method: patch, Path: "/api/v1/project_invite", Tag: projects, Summary: "Invites users to a project", Auth: true, Body: projectInviteBody{}, Response: emptyResponse{}},
+		{Method: get, Path: "/api/v1/project_get_applications", Tag: projects, Summary: "Returns the applications to join a project", Description: "Only for admins.", Auth: true, Query: projectIdQuery{}, Response: applicantsResponse{}},
+		{Method: patch, Path: "/api/v1/project_choose", Tag: projects, Summary: "Accepts or rejects applications to join a project", Description: "Only for admins.", Auth: true, Body: projectChooseBody{}, Response: emptyResponse{}},
+		{Method: patch, Path: "/api/v1/project_remove_user", Tag: projects, Summary: "Removes members from a project", Description: "Only for admins.", Auth: true, Body: projectRemoveBody{}, Response: emptyResponse{}},
+		{Method: patch, Path: "/api/v1/project_leave", Tag: projects, Summary: "Leaves a project", Auth: true, Body: projectIdBody{}, Response: emptyResponse{}},
+		{Method: del, Path: "/api/v1/project_delete", Tag: projects, Summary: "Moves a project to the trash", Description: "Only for admins.", Auth: true, Query: projectIdQuery{}, Versioned: true, Response: emptyResponse{}},
+		{Method: patch, Path: "/api/v1/project_archive", Tag: projects, Summary: "Archives a project, making it read-only, or unarchives it", Auth: true, Body: projectArchiveBody{}, Response: emptyResponse{}},
+
+		{Method: get, Path: "/api/v1/trash_get", Tag: trash, Summary: "Returns the items in the trash", Description: "Those of the project if projectid is given, else the personal tasks and events of the user and the projects the user was an admin of.", Auth: true, Query: optionalProjectIdQuery{}, Response: trashResponse{}},
+		{Method: patch, Path: "/api/v1/trash_restore", Tag: trash, Summary: "Restores an item from the trash", Auth: true, Body: trashRestoreBody{}, Response: emptyResponse{}},
+
+		{Method: post, Path: "/api/v1/task_create", Tag: tasks, Summary: "Creates a personal or project task", Auth: true, Body: taskInput{}, Status: http.StatusCreated, Response: taskIdResponse{}},
+		{Method: del, Path: "/api/v1/task_delete", Tag: tasks, Summary: "Moves tasks to the trash", Auth: true, Query: taskDeleteQuery{}, Response: emptyResponse{}},
+		{Method: patch, Path: "/api/v1/task_modify", Tag: tasks, Summary: "Changes the fields of a task that are given", Auth: true, Body: taskModifyBody{}, Versioned: true, Response: emptyResponse{}},
+		{Method: patch, Path: "/api/v1/task_move", Tag: tasks, Summary: "Moves a project task to a workflow state at a position", Auth: true, Body: taskMoveBody{}, Response: emptyResponse{}},
+		{Method: patch, Path: "/api/v1/task_series_modify", Tag: tasks, Summary: "Changes every instance of a recurring task that is not done", Auth: true, Body: taskSeriesModifyBody{}, Response: emptyResponse{}},
+		{Method: patch, Path: "/api/v1/task_series_stop", Tag: tasks, Summary: "Stops a recurring task from creating further instances", Auth: true, Body: taskIdBody{}, Response: emptyResponse{}},
+		{Method: get, Path: "/api/v1/task_get_all", Tag: tasks, Summary: "Returns the tasks of a project, or those of the user", Auth: true, Query: optionalProjectIdQuery{}, Response: tasksResponse{}},
+		{Method: post, Path: "/api/v1/task_query", Tag: tasks, Summary: "Returns a page of the tasks that match the filters", Auth: true, Body: taskQueryInput{}, Response: taskQueryResponse{}},
+		{Method: post, Path: "/api/v1/task_bulk", Tag: tasks, Summary: "Applies an operation to many tasks", Description: "Permissions are checked for each task, whose results are reported separately.", Auth: true, Body: taskBulkBody{}, Response: taskBulkResponse{}},
+		{Method: post, Path: "/api/v1/task_template_create", Tag: templates, Summary: "Saves a reusable task within a project", Auth: true, Body: taskTemplateCreateBody{}, Status: http.StatusCreated, Response: templateIdResponse{}},
+		{Method: get, Path: "/api/v1/task_template_get_all", Tag: templates, Summary: "Returns the task templates of a project", Auth: true, Query: projectIdQuery{}, Response: taskTemplatesResponse{}},
+		{Method: post, Path: "/api/v1/task_template_use", Tag: templates, Summary: "Creates a task from a task template", Auth: true, Body: taskTemplateUseBody{}, Status: http.StatusCreated, Response: taskIdResponse{}},
+		{Method: del, Path: "/api/v1/task_template_delete", Tag: templates, Summary: "Deletes a task template", Auth: true, Query: templateIdQuery{}, Response: emptyResponse{}},
+		{Method: get, Path: "/api/v1/task_get_activity", Tag: tasks, Summary: "Returns the history of changes to a task", Auth: true, Query: taskIdQuery{}, Response: activityResponse{}},
+
+		{Method: post, Path: "/api/v1/task_comment_create", Tag: comments, Summary: "Comments on a task", Auth: true, Body: commentCreateBody{}, Status: http.StatusCreated, Response: commentIdResponse{}},
+		{Method: get, Path: "/api/v1/task_comment_get_all", Tag: comments, Summary: "Returns the comments of a task, oldest first", Auth: true, Query: taskIdQuery{}, Response: commentsResponse{}},
+		{Method: del, Path: "/api/v1/task_comment_delete", Tag: comments, Summary: "Deletes a comment of the user", Auth: true, Query: commentIdQuery{}, Response: emptyResponse{}},
+
+		{Method: post, Path: "/api/v1/task_timer_start", Tag: times, Summary: "Starts a timer on a task", Description: "Each user can only have one running timer.", Auth: true, Body: taskIdBody{}, Status: http.StatusCreated, Response: entryResponse{}},
+		{Method: patch, Path: "/api/v1/task_timer_stop", Tag: times, Summary: "Stops the running timer of the user", Auth: true, Response: entryResponse{}},
+		{Method: get, Path: "/api/v1/task_timer_get", Tag: times, Summary: "Returns the running timer of the user, if any", Auth: true, Response: entryResponse{}},
+		{Method: post, Path: "/api/v1/task_time_add", Tag: times, Summary: "Logs time on a task that was not tracked with a timer", Auth: true, Body: timeAddBody{}, Status: http.StatusCreated, Response: entryResponse{}},
+		{Method: get, Path: "/api/v1/task_time_get_all", Tag: times, Summary: "Returns the time logged on a task", Auth: true, Query: taskIdQuery{}, Response: entriesResponse{}},
+		{Method: del, Path: "/api/v1/task_time_delete", Tag: times, Summary: "Deletes a time entry of the user", Auth: true, Query: entryIdQuery{}, Response: emptyResponse{}},
+
+		{Method: post, Path: "/api/v1/attachment_upload", Tag: files, Summary: "Uploads a file to a task or project", Auth: true, Form: attachmentForm{}, Status: http.StatusCreated, Response: attachmentResponse{}},
+		{Method: get, Path: "/api/v1/attachment_get_all", Tag: files, Summary: "Returns the attachments of a task or project", Auth: true, Query: attachmentOwnerQuery{}, Response: attachmentsResponse{}},
+		{Method: get, Path: "/api/v1/attachment_download", Tag: files, Summary: "Downloads an attachment", Auth: true, Query: attachmentIdQuery{}, ContentType: "application/octet-stream"},
+		{Method: del, Path: "/api/v1/attachment_delete", Tag: files, Summary: "Deletes an attachment", Description: "Only for the uploader or an admin of the project.", Auth: true, Query: attachmentIdQuery{}, Response: emptyResponse{}},
+
+		{Method: post, Path: "/api/v1/event_create", Tag: events, Summary: "Creates a personal or project event", Auth: true, Body: eventCreateBody{}, Status: http.StatusCreated, Response: eventIdResponse{}},
+		{Method: get, Path: "/api/v1/event_get", Tag: events, Summary: "Returns an event", Auth: true, Query: eventIdQuery{}, Response: eventResponse{}, Versioned: true},
+		{Method: get, Path: "/api/v1/event_get_all", Tag: events, Summary: "Returns the events of a project, or those of the user", Auth: true, Query: optionalProjectIdQuery{}, Response: eventsResponse{}},
+		{Method: patch, Path: "/api/v1/event_modify", Tag: events, Summary: "Changes the fields of an event that are given", Auth: true, Body: eventModifyBody{}, Versioned: true, Response: emptyResponse{}},
+		{Method: del, Path: "/api/v1/event_delete", Tag: events, Summary: "Moves an event to the trash", Auth: true, Query: eventDeleteQuery{}, Versioned: true, Response: emptyResponse{}},
+		{Method: post, Path: "/api/v1/event_nusmods", Tag: events, Summary: "Imports the lessons of a NUSMods timetable as events", Auth: true, Body: nusmodsBody{}, Status: http.StatusCreated, Response: importedEventsResponse{}},
+		{Method: post, Path: "/api/v1/event_ics", Tag: events, Summary: "Imports the events of an iCalendar file", Auth: true, Form: icsForm{}, Status: http.StatusCreated, Response: importedEventsResponse{}},
+		{Method: post, Path: "/api/v1/event_find_common", Tag: events, Summary: "Finds the time slots in which the members are all free", Auth: true, Body: commonSlotsBody{}, Response: slotsResponse{}},
+
+		{Method: get, Path: "/api/v1/project_search", Tag: realtime, Summary: "Searches for public projects to apply to", Description: "Each message is the text to search for, which is answered with {projects: object[]}.", Auth: true, WebSocket: true},
+		{Method: get, Path: "/api/v1/project_invite_search", Tag: realtime, Summary: "Searches for users to invite to a project", Description: "Each message is {projectid: string, query: string}, which is answered with {users: object[]}.", Auth: true, WebSocket: true},
+		{Method: get, Path: "/api/v1/project_chat", Tag: realtime, Summary: "Joins the chat room of a project", Description: "Only when chat is enabled.", Auth: true, Query: roomQuery{}, WebSocket: true},
+		{Method: get, Path: "/api/v1/project_activity", Tag: realtime, Summary: "Streams the changes made to a project to its members", Description: "Only when the activity stream is enabled. Sends {activities: Activity[]}, starting with the activities after since, or a reset if they are not kept.", Auth: true, Query: activityQuery{}, WebSocket: true},
+
+		{Method: get, Path: "/api/v1/openapi.json", Tag: docs, Summary: "Returns this document", Response: map[string]any{}},
+		{Method: get, Path: "/api/v1/docs", Tag: docs, Summary: "Shows this document as a web page", ContentType: "text/html"},
+	}
+}
+
+// The document of v1.
+func V1Spec() *openapi.Document {
+	return openapi.Build(openapi.Spec{
+		Title:       "OrgaNiUS API",
+		Description: "Authentication is by the httpOnly jwt cookie set when signing up or logging in, which is refreshed by each request.",
+		Version:     "v1",
+		Routes:      V1Routes(),
+		Error:       errorBody{},
+	})
+}
+
+// Serves the document of v1 as JSON.
+func OpenAPISpec() gin.HandlerFunc {
+	return openapi.Handler(V1Spec())
+}
+
+// Serves a page showing the document of v1, which must be next to OpenAPISpec.
+func OpenAPIDocs() gin.HandlerFunc {
+	return openapi.Docs()
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/openapi"
+	"github.com/gin-gonic/gin"
+)
+
+// The request bodies of v2 that are not shared with v1, which the handlers decode as the spec describes.
+// v1 takes them too, together with the ids that v2 takes in the path.
+type (
+	commentBody struct {
+		ParentId string `json:"parentid" doc:"the comment replied to"`
+		Content  string `json:"content" required:"true" doc:"mentioned users are notified by email"`
+	}
+	eventPatchBody struct {
+		Name  *string `json:"name"`
+		Start *string `json:"start" doc:"ISO 8601"`
+		End   *string `json:"end" doc:"ISO 8601"`
+	}
+)
+
+// The routes of v2, in the order they are registered in.
+// Every route registered under /api/v2 must be here, which is checked by a test of the server.
+func V2Routes() []openapi.Route {
+	const (
+		users    = "users"
+		projects = "projects"
+		tasks    = "tasks"
+		comments = "comments"
+		events   = "events"
+		docs     = "docs"
+	)
+	get, post, patch, del := http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete
+	created, deleted := http.StatusCreated, http.StatusNoContent
+	routes := []openapi.Route{
+		{Method: post, Path: "/api/v2/users", Tag: users, Summary: "Signs up, sending a pin to verify the email with through /api/v1/verify", Body: signupBody{}, Status: created, Response: data[v2Profile]{}},
+		{Method: get, Path: "/api/v2/users/me", Tag: users, Summary: "Returns the user who is logged in", Auth: true, Response: data[v2Profile]{}, Versioned: true},
+		{Method: patch, Path: "/api/v2/users/me", Tag: users, Summary: "Changes the name, password or email of the user", Auth: true, Body: userChanges{}, Response: data[v2Profile]{}, Versioned: true},
+		{Method: del, Path: "/api/v2/users/me", Tag: users, Summary: "Deletes the user, logging out", Auth: true, Status: deleted, Versioned: true},
+		{Method: get, Path: "/api/v2/users/:userid", Tag: users, Summary: "Returns the public information of a user", Response: data[v2User]{}},
+		{Method: post, Path: "/api/v2/sessions", Tag: users, Summary: "Logs in, setting the JWT cookie", Body: loginBody{}, Status: created, Response: data[v2Profile]{}},
+		{Method: del, Path: "/api/v2/sessions", Tag: users, Summary: "Logs out, deleting the JWT cookie", Auth: true, Status: deleted},
+
+		{Method: get, Path: "/api/v2/projects", Tag: projects, Summary: "Returns a page of the projects of the user", Auth: true, Query: pageQuery{}, Response: page[v2Project]{}},
+		{Method: post, Path: "/api/v2/projects", Tag: projects, Summary: "Creates a project with the user as its admin", Auth: true, Body: projectCreateBody{}, Status: created, Response: data[v2Project]{}, Versioned: true},
+		{Method: get, Path: "/api/v2/projects/:projectid", Tag: projects, Summary: "Returns a project of the user", Auth: true, Response: data[v2Project]{}, Versioned: true},
+		{Method: patch, Path: "/api/v2/projects/:projectid", Tag: projects, Summary: "Changes the name, description or visibility of a project, for admins", Auth: true, Body: projectChanges{}, Response: data[v2Project]{}, Versioned: true},
+		{Method: del, Path: "/api/v2/projects/:projectid", Tag: projects, Summary: "Moves a project to the trash with its tasks and events, for admins", Auth: true, Status: deleted, Versioned: true},
+		{Method: get, Path: "/api/v2/projects/:projectid/members", Tag: projects, Summary: "Returns a page of the members of a project, by name", Auth: true, Query: pageQuery{}, Response: page[v2Member]{}},
+		{Method: del, Path: "/api/v2/projects/:projectid/members/:userid", Tag: projects, Summary: "Removes a member, for admins, or leaves the project if the userid is the user's or me", Auth: true, Status: deleted},
+	}
+	// tasks, comments and events are served at the same paths under a project and for the user
+	for _, scope := range []struct{ prefix, whose string }{{"/api/v2/projects/:projectid", "of a project"}, {"/api/v2", "of the user"}} {
+		routes = append(routes, []openapi.Route{
+			{Method: get, Path: scope.prefix + "/tasks", Tag: tasks, Summary: "Returns a page of the tasks " + scope.whose + " that match the filters", Auth: true, Query: taskFilter{}, Response: page[models.Task]{}},
+			{Method: post, Path: scope.prefix + "/tasks", Tag: tasks, Summary: "Creates a task " + scope.whose, Auth: true, Body: taskBody{}, Status: created, Response: data[models.Task]{}, Versioned: true},
+			{Method: get, Path: scope.prefix + "/tasks/:taskid", Tag: tasks, Summary: "Returns a task " + scope.whose, Auth: true, Response: data[models.Task]{}, Versioned: true},
+			{Method: patch, Path: scope.prefix + "/tasks/:taskid", Tag: tasks, Summary: "Changes a task " + scope.whose, Auth: true, Body: taskChanges{}, Response: data[models.Task]{}, Versioned: true},
+			{Method: del, Path: scope.prefix + "/tasks/:taskid", Tag: tasks, Summary: "Moves a task " + scope.whose + " to the trash", Auth: true, Status: deleted, Versioned: true},
+			{Method: get, Path: scope.prefix + "/tasks/:taskid/comments", Tag: comments, Summary: "Returns a page of the comments of a task " + scope.whose + ", oldest first", Auth: true, Query: pageQuery{}, Response: page[models.Comment]{}},
+			{Method: post, Path: scope.prefix + "/tasks/:taskid/comments", Tag: comments, Summary: "Comments on a task " + scope.whose, Auth: true, Body: commentBody{}, Status: created, Response: data[models.Comment]{}},
+			{Method: del, Path: scope.prefix + "/tasks/:taskid/comments/:commentid", Tag: comments, Summary: "Deletes a comment of the user, keeping its replies", Auth: true, Status: deleted},
+			{Method: get, Path: scope.prefix + "/events", Tag: events, Summary: "Returns a page of the events " + scope.whose + ", by start time", Auth: true, Query: pageQuery{}, Response: page[models.Event]{}},
+			{Method: post, Path: scope.prefix + "/events", Tag: events, Summary: "Creates an event " + scope.whose, Auth: true, Body: eventInput{}, Status: created, Response: data[models.Event]{}, Versioned: true},
+			{Method: get, Path: scope.prefix + "/events/:eventid", Tag: events, Summary: "Returns an event " + scope.whose, Auth: true, Response: data[models.Event]{}, Versioned: true},
+			{Method: patch, Path: scope.prefix + "/events/:eventid", Tag: events, Summary: "Changes an event " + scope.whose, Auth: true, Body: eventPatchBody{}, Response: data[models.Event]{}, Versioned: true},
+			{Method: del, Path: scope.prefix + "/events/:eventid", Tag: events, Summary: "Moves an event " + scope.whose + " to the trash", Auth: true, Status: deleted, Versioned: true},
+		}...)
+	}
+	return append(routes,
+		openapi.Route{Method: get, Path: "/api/v2/openapi.json", Tag: docs, Summary: "Returns this document", Response: map[string]any{}},
+		openapi.Route{Method: get, Path: "/api/v2/docs", Tag: docs, Summary: "Shows this document as a web page", ContentType: "text/html"},
+	)
+}
+
+// The document of v2.
+func V2Spec() *openapi.Document {
+	return openapi.Build(openapi.Spec{
+		Title:       "OrgaNiUS API",
+		Description: "Resources are at their own paths, with the method as the action. Responses are {\"data\": ...}, with \"page\" for collections, whose next cursor gives the next page. Authentication is by the httpOnly jwt cookie set by creating a session.",
+		Version:     "v2",
+		Routes:      V2Routes(),
+		Error:       errorEnvelope{},
+	})
+}
+
+// Serves the document of v2 as JSON.
+func OpenAPISpecV2() gin.HandlerFunc {
+	return openapi.Handler(V2Spec())
+}
@@ -1,18 +1,21 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
 	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/functions"
 	"github.com/OrgaNiUS/OrgaNiUS/server/models"
 	"github.com/OrgaNiUS/OrgaNiUS/server/socket"
+	"github.com/OrgaNiUS/OrgaNiUS/server/txn"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // Input parameters "projectid" : "projectid"
@@ -20,49 +23,49 @@ func ProjectGet(userController controllers.UserController, projectController con
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
-		projectid := ctx.DefaultQuery("projectid", "")
-		project, err := projectController.ProjectRetrieve(ctx, projectid)
-		if err == mongo.ErrNoDocuments {
-			DisplayError(ctx, "project does not exist")
-		} else if err != nil {
-			DisplayError(ctx, err.Error())
-		} else {
-			if _, ok := project.Members[id]; !ok {
-				DisplayNotAuthorized(ctx, "you lack permissions")
-				return
-			}
-			// only return a non-sensitive subset of the information
-			type NameIdRole struct {
-				Name string `bson:"name" json:"name"`
-				Id   string `bson:"_id,omitempty" json:"id,omitempty"`
-				Role string `bson:"role" json:"role"`
-			}
-			userArr := []NameIdRole{}
-			useridStrArr := []string{}
-			for userid := range project.Members {
-				useridStrArr = append(useridStrArr, userid)
-			}
-			for _, user := range userController.UserMapToArray(ctx, useridStrArr) {
-				var nameid NameIdRole
-				nameid.Name = user.Name
-				nameid.Id = user.Id.Hex()
-				nameid.Role = project.Members[nameid.Id]
-				userArr = append(userArr, nameid)
-			}
-			returnedProject := gin.H{
-				"name":         project.Name,
-				"description":  project.Description,
-				"creationTime": project.CreationTime,
-				"members":      userArr,
-				"tasks":        taskController.TaskMapToArray(ctx, project.Tasks),
-				"isPublic":     project.IsPublic,
-				"events":       eventController.EventMapToArray(ctx, project.Events),
-			}
-			ctx.JSON(http.StatusOK, returnedProject)
+		var query projectIdQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
 		}
+		project, err := projectController.ProjectRetrieve(ctx, query.ProjectId)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+			return
+		}
+		if _, ok := project.Members[id]; !ok {
+			Respond(ctx, errs.Forbidden("you lack permissions"))
+			return
+		}
+		// only return a non-sensitive subset of the information
+		userArr := []projectMember{}
+		useridStrArr := []string{}
+		for userid := range project.Members {
+			useridStrArr = append(useridStrArr, userid)
+		}
+		for _, user := range userController.UserMapToArray(ctx, useridStrArr) {
+			var nameid projectMember
+			nameid.Name = user.Name
+			nameid.Id = user.Id.Hex()
+			nameid.Role = project.Members[nameid.Id]
+			userArr = append(userArr, nameid)
+		}
+		returnedProject := projectResponse{
+			Name:         project.Name,
+			Description:  project.Description,
+			CreationTime: project.CreationTime,
+			Members:      userArr,
+			Tasks:        taskController.TaskMapToArray(ctx, project.Tasks),
+			IsPublic:     project.IsPublic,
+			Events:       eventController.EventMapToArray(ctx, project.Events),
+			States:       project.Settings.WorkflowStates(),
+			Version:      project.Version,
+		}
+		setETag(ctx, project.Version)
+		ctx.JSON(http.StatusOK, returnedProject)
 	}
 }
 
@@ -70,32 +73,25 @@ func ProjectGetAll(userController controllers.UserController, projectController
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
 		user, err := userController.UserRetrieve(ctx, id, "")
-		if err == mongo.ErrNoDocuments {
-			DisplayError(ctx, "user does not exist")
-		} else if err != nil {
-			DisplayError(ctx, err.Error())
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "user does not exist"))
+			return
 		}
 		projArr := projectController.ProjectArrayToModel(ctx, user.Projects)
-		type Result struct {
-			Id           string    `bson:"_id,omitempty" json:"id,omitempty"`
-			Name         string    `bson:"name" json:"name"`
-			Description  string    `bson:"description" json:"description"`
-			CreationTime time.Time `bson:"creationTime" json:"creationTime"`
-		}
-		resultArr := []Result{}
+		resultArr := []projectSummary{}
 		for _, project := range projArr {
-			resultArr = append(resultArr, Result{
+			resultArr = append(resultArr, projectSummary{
 				Id:           project.Id.Hex(),
 				Name:         project.Name,
 				Description:  project.Description,
 				CreationTime: project.CreationTime,
 			})
 		}
-		ctx.JSON(http.StatusOK, gin.H{"projects": resultArr})
+		ctx.JSON(http.StatusOK, projectsResponse{Projects: resultArr})
 	}
 }
 
@@ -108,48 +104,52 @@ func isValidProjectName(name string) (string, bool) {
 	return "", true
 }
 
+// Creates the project with the user as its admin.
+func createProject(ctx context.Context, userController controllers.UserController, projectController controllers.ProjectController, project *models.Project, userid string) error {
+	tests := []func() (string, bool){
+		// create valid project name allow spaces
+		func() (string, bool) {
+			return isValidProjectName(project.Name)
+		},
+		// add test for description here
+	}
+	for _, t := range tests {
+		if msg, ok := t(); !ok {
+			return errs.Validation(msg)
+		}
+	}
+	user, err := userController.UserRetrieve(ctx, userid, "")
+	if err != nil {
+		return errs.OrNotFound(err, "user does not exist")
+	}
+
+	if err := projectController.ProjectCreate(ctx, project, userid); err != nil {
+		return err
+	}
+	userController.UserAddProject(ctx, user.Id, project.Id.Hex())
+	return nil
+}
+
 // Input parameters "name" : "projectname" "description" : "projectDescription" return projectid
 func ProjectCreate(userController controllers.UserController, projectController controllers.ProjectController, jwtParser *auth.JWTParser) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
-		var project models.Project
-		if err := ctx.BindJSON(&project); err != nil {
-			DisplayError(ctx, err.Error())
+		var query projectCreateBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
 			return
 		}
-		tests := []func() (string, bool){
-			// create valid project name allow spaces
-			func() (string, bool) {
-				return isValidProjectName(project.Name)
-			},
-			// add test for description here
-		}
-		for _, t := range tests {
-			if msg, ok := t(); !ok {
-				DisplayError(ctx, msg)
-				return
-			}
-		}
-		user, err := userController.UserRetrieve(ctx, id, "")
-		if err == mongo.ErrNoDocuments {
-			DisplayError(ctx, "user does not exist")
-		} else if err != nil {
-			DisplayError(ctx, err.Error())
-		}
-
-		if err := projectController.ProjectCreate(ctx, &project, id); err != nil {
-			DisplayError(ctx, err.Error())
+		project := models.Project{Name: query.Name, Description: query.Description, IsPublic: query.IsPublic}
+		if err := createProject(ctx, userController, projectController, &project, id); err != nil {
+			Respond(ctx, err)
 			return
 		}
-		userController.UserAddProject(ctx, user.Id, project.Id.Hex())
 
-		ctx.JSON(http.StatusCreated, gin.H{
-			"projectid": project.Id.Hex(),
-		})
+		ctx.JSON(http.StatusCreated, projectIdResponse{ProjectId: project.Id.Hex()})
 	}
 }
 
@@ -158,20 +158,16 @@ func ProjectInviteUser(userController controllers.UserController, jwtParser *aut
 	return func(ctx *gin.Context) {
 		_, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
-		type Query struct {
-			Id        string   `bson:"projectid" json:"projectid"`
-			Usernames []string `bson:"users" json:"users"`
-		}
-		var query Query
-		if err := ctx.BindJSON(&query); err != nil {
-			DisplayError(ctx, err.Error())
+		var query projectInviteBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
 			return
 		}
-		userController.UsersInviteFromProject(ctx, query.Usernames, query.Id)
-		ctx.JSON(http.StatusOK, gin.H{})
+		userController.UsersInviteFromProject(ctx, query.Users, query.ProjectId)
+		ctx.JSON(http.StatusOK, emptyResponse{})
 	}
 }
 
@@ -179,18 +175,23 @@ func ProjectGetApplicants(userController controllers.UserController, projectCont
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query projectIdQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
 			return
 		}
-		projectid := ctx.DefaultQuery("projectid", "")
 
-		project, err := projectController.ProjectRetrieve(ctx, projectid)
+		project, err := projectController.ProjectRetrieve(ctx, query.ProjectId)
 		if err != nil {
-			DisplayError(ctx, "project not found")
+			Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+			return
 		}
 
 		if !project.Settings.Roles[project.Members[id]].IsAdmin {
-			DisplayNotAuthorized(ctx, "lacking admin permissions to execute action")
+			Respond(ctx, errs.Forbidden("lacking admin permissions to execute action"))
 			return
 		}
 
@@ -205,27 +206,21 @@ func ProjectGetApplicants(userController controllers.UserController, projectCont
 
 		users := userController.UserMapToArray(ctx, userids)
 
-		type resultType struct {
-			Id          string `bson:"id" json:"id"`
-			Name        string `bson:"name" json:"name"`
-			Description string `bson:"description" json:"description"`
-		}
-
-		result := make([]resultType, size)
+		result := make([]applicant, size)
 
 		for i, user := range users {
 			id := user.Id.Hex()
-			result[i] = resultType{
+			result[i] = applicant{
 				Id:          id,
 				Name:        user.Name,
 				Description: project.Applications[id].Description,
 			}
 		}
 
-		ctx.JSON(http.StatusOK, gin.H{
-			"id":         project.Id.Hex(),
-			"name":       project.Name,
-			"applicants": result,
+		ctx.JSON(http.StatusOK, applicantsResponse{
+			Id:         project.Id.Hex(),
+			Name:       project.Name,
+			Applicants: result,
 		})
 	}
 }
@@ -237,42 +232,38 @@ func ProjectChooseUsers(userController controllers.UserController, projectContro
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
-		type Query struct {
-			Id     string   `bson:"projectid" json:"projectid"`
-			AccIds []string `bson:"acceptedUsers" json:"acceptedUsers"`
-			RejIds []string `bson:"rejectedUsers" json:"rejectedUsers"`
-		}
-		var query Query
-		if err := ctx.BindJSON(&query); err != nil {
-			DisplayError(ctx, err.Error())
+		var query projectChooseBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
 			return
 		}
-		project, err := projectController.ProjectRetrieve(ctx, query.Id)
+		project, err := projectController.ProjectRetrieve(ctx, query.ProjectId)
 		if err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
 
 		if !project.Settings.Roles[project.Members[id]].IsAdmin {
-			DisplayNotAuthorized(ctx, "lacking admin permissions to execute action")
+			Respond(ctx, errs.Forbidden("lacking admin permissions to execute action"))
 			return
 		}
 
-		if len(query.RejIds) != 0 {
-			projectController.ProjectRemoveAppl(ctx, query.Id, query.RejIds)
+		if len(query.RejectedUsers) != 0 {
+			projectController.ProjectRemoveAppl(ctx, query.ProjectId, query.RejectedUsers)
 		}
-		if len(query.AccIds) != 0 {
-			for _, userid := range query.AccIds {
+		if len(query.AcceptedUsers) != 0 {
+			for _, userid := range query.AcceptedUsers {
 				project.Members[userid] = "member"
 			}
-			projectController.ProjectAddUsers(ctx, query.Id, &project)       // Add userid to project.Members
-			projectController.ProjectRemoveAppl(ctx, query.Id, query.AccIds) // Remove userid from project.Applications
-			userController.UsersAddProject(ctx, query.AccIds, query.Id)      // Add projectid to user.Projects
+			projectController.ProjectAddUsers(ctx, query.ProjectId, &project)              // Add userid to project.Members
+			projectController.ProjectRemoveAppl(ctx, query.ProjectId, query.AcceptedUsers) // Remove userid from project.Applications
+			userController.UsersAddProject(ctx, query.AcceptedUsers, query.ProjectId)      // Add projectid to user.Projects
+			publishMembers(ctx, userController, query.ProjectId, id, socket.ActivityMemberJoined, query.AcceptedUsers)
 		}
-		ctx.JSON(http.StatusOK, gin.H{})
+		ctx.JSON(http.StatusOK, emptyResponse{})
 	}
 }
 
@@ -281,54 +272,81 @@ func ProjectRemoveUsers(userController controllers.UserController, projectContro
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
-		type Query struct {
-			Id      string   `bson:"projectid" json:"projectid"`
-			UserIds []string `bson:"userids" json:"userids"`
-		}
-		var query Query
-		if err := ctx.BindJSON(&query); err != nil {
-			DisplayError(ctx, err.Error())
+		var query projectRemoveBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
 			return
 		}
 		if len(query.UserIds) == 0 {
 			return
 		}
-		project, err := projectController.ProjectRetrieve(ctx, query.Id)
+		project, err := projectController.ProjectRetrieve(ctx, query.ProjectId)
 		if err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
 
 		if !project.Settings.Roles[project.Members[id]].IsAdmin {
-			DisplayNotAuthorized(ctx, "lacking admin permissions to execute action")
+			Respond(ctx, errs.Forbidden("lacking admin permissions to execute action"))
+			return
+		}
+		if err := removeMembers(ctx, userController, projectController, project, query.UserIds); err != nil {
+			Respond(ctx, err)
 			return
 		}
+		publishMembers(ctx, userController, query.ProjectId, id, socket.ActivityMemberLeft, query.UserIds)
+		ctx.JSON(http.StatusOK, emptyResponse{})
+	}
+}
 
-		// cross check any project tasks from removed users.
-		for _, userid := range query.UserIds {
-			user, err := userController.UserRetrieve(ctx, userid, "")
-			if err != nil {
-				DisplayError(ctx, err.Error())
-				return
-			}
-			for _, projectid := range project.Tasks {
-				delete(user.Tasks, projectid)
-			}
-			userController.UserModifyTask(ctx, &user)
-			delete(project.Members, userid)
+// Removes the users from the project, unassigning them from its tasks.
+func removeMembers(ctx context.Context, userController controllers.UserController, projectController controllers.ProjectController, project models.Project, userids []string) error {
+	// cross check any project tasks from removed users.
+	for _, userid := range userids {
+		user, err := userController.UserRetrieve(ctx, userid, "")
+		if err != nil {
+			return err
 		}
+		for _, projectid := range project.Tasks {
+			delete(user.Tasks, projectid)
+		}
+		userController.UserModifyTask(ctx, &user)
+		delete(project.Members, userid)
+	}
 
-		// delete the projectid from user
-		userController.UsersDeleteProject(ctx, query.UserIds, query.Id)
+	// delete the projectid from user
+	userController.UsersDeleteProject(ctx, userids, project.Id.Hex())
 
-		// delete the userids from project
-		projectController.ProjectModifyUser(ctx, &project)
+	// delete the userids from project
+	projectController.ProjectModifyUser(ctx, &project)
+	return nil
+}
+
+// Changes to the general information of a project, of which only those given are made.
+type projectChanges struct {
+	Name        *string `bson:"name" json:"name" doc:"at least 5 characters, unchanged if not given"`
+	Description *string `bson:"description" json:"description" doc:"unchanged if not given"`
+	IsPublic    *bool   `bson:"isPublic" json:"isPublic" doc:"unchanged if not given"`
+}
 
-		ctx.JSON(http.StatusOK, gin.H{})
+// Makes the changes to the project on behalf of the user, who must be an admin.
+// If version is not nil, the changes are only made if the project is still at the version.
+func modifyProject(ctx context.Context, projectController controllers.ProjectController, project models.Project, version *int64, changes projectChanges, userid string) error {
+	if !project.Settings.Roles[project.Members[userid]].IsAdmin {
+		return errs.Forbidden("lacking admin permissions to execute action")
 	}
+	if err := projectWritable(project); err != nil {
+		return err
+	}
+	if changes.Name != nil {
+		if msg, ok := isValidProjectName(*changes.Name); !ok {
+			return errs.Validation(msg)
+		}
+	}
+	return projectController.ProjectModifyGeneral(ctx, project.Id, version, changes.Name, changes.Description, changes.IsPublic)
 }
 
 // projectid: string; name: string; description: string; isPublic: bool
@@ -336,160 +354,375 @@ func ProjectModify(projectController controllers.ProjectController, jwtParser *a
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
-		type Query struct {
-			Id          string  `bson:"projectid" json:"projectid"`
-			Name        *string `bson:"name" json:"name"`
-			Description *string `bson:"description" json:"description"`
-			IsPublic    *bool   `bson:"isPublic" json:"isPublic"`
+		var query projectModifyBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
 		}
-		var query Query
-		if err := ctx.BindJSON(&query); err != nil {
-			DisplayError(ctx, err.Error())
+		if query.ProjectId == "" {
+			Respond(ctx, errs.Validation("Please provide id of project to modify"))
 			return
 		}
-		if query.Id == "" {
-			DisplayError(ctx, "Please provide id of project to modify")
+		version, err := ifMatch(ctx)
+		if err != nil {
+			Respond(ctx, err)
 			return
 		}
-		project, err := projectController.ProjectRetrieve(ctx, query.Id)
+		project, err := projectController.ProjectRetrieve(ctx, query.ProjectId)
 		if err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
-		if !project.Settings.Roles[project.Members[id]].IsAdmin {
-			DisplayNotAuthorized(ctx, "lacking admin permissions to execute action")
+		if err := modifyProject(ctx, projectController, project, version, query.projectChanges, id); err != nil {
+			Respond(ctx, err)
 			return
 		}
-		primId, _ := primitive.ObjectIDFromHex(query.Id)
-		projectController.ProjectModifyGeneral(ctx, primId, query.Name, query.Description, query.IsPublic)
-		ctx.JSON(http.StatusOK, gin.H{})
+		publishProject(ctx, projectController, query.ProjectId, id)
+		ctx.JSON(http.StatusOK, emptyResponse{})
 	}
 }
 
-// projectid: string
-func ProjectDelete(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+func isValidStates(states []models.WorkflowState) (string, bool) {
+	if len(states) == 0 {
+		return "please provide at least one state", false
+	}
+	names := make(map[string]bool)
+	hasTerminal := false
+	hasNonTerminal := false
+	for _, state := range states {
+		if state.Name == "" {
+			return "state name cannot be empty", false
+		} else if names[state.Name] {
+			return "state names must be unique", false
+		}
+		names[state.Name] = true
+		if state.IsTerminal {
+			hasTerminal = true
+		} else {
+			hasNonTerminal = true
+		}
+	}
+	if !hasTerminal {
+		return "at least one state must be terminal", false
+	} else if !hasNonTerminal {
+		return "at least one state must not be terminal", false
+	}
+	return "", true
+}
+
+// projectid: string; states: WorkflowState[]
+// Replaces the ordered workflow states of the project. Tasks in removed states are moved to the initial state.
+func ProjectModifyStates(projectController controllers.ProjectController, taskController controllers.TaskController, jwtParser *auth.JWTParser) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
-		projectid := ctx.DefaultQuery("projectid", "")
-		project, err := projectController.ProjectRetrieve(ctx, projectid)
+		var query projectStatesBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		if msg, ok := isValidStates(query.States); !ok {
+			Respond(ctx, errs.Validation(msg))
+			return
+		}
+		project, err := projectController.ProjectRetrieve(ctx, query.ProjectId)
 		if err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
-
-		if !project.Settings.Roles[project.Members[id]].IsAdmin {
-			DisplayNotAuthorized(ctx, "lacking admin permissions to execute action")
+		permissions := project.Settings.Roles[project.Members[id]]
+		if !permissions.IsAdmin && !permissions.EditSettings {
+			Respond(ctx, errs.Forbidden("lacking permissions to execute action"))
 			return
 		}
-
-		// Delete projectid from all users in userCollection
-		userController.UsersDeleteProject(ctx, []string{}, projectid)
-
-		// Delete all project tasks completely
-		for _, taskid := range project.Tasks {
-			task, err := taskController.TaskRetrieve(ctx, taskid)
-			if err == mongo.ErrNoDocuments {
-				DisplayError(ctx, "task does not exist")
-			} else if err != nil {
-				DisplayError(ctx, err.Error())
-			}
-			for _, userid := range task.AssignedTo {
-				user, err := userController.UserRetrieve(ctx, userid, "")
-				if err == mongo.ErrNoDocuments {
-					DisplayError(ctx, "user does not exist")
-				} else if err != nil {
-					DisplayError(ctx, err.Error())
-				}
-				delete(user.Tasks, taskid)
-				userController.UserModifyTask(ctx, &user)
-			}
+		if !checkProjectWritable(ctx, project) {
+			return
 		}
-		taskController.TaskDeleteMany(ctx, project.Tasks)
-
-		// Delete project from database
-		projectController.ProjectDelete(ctx, projectid)
-		ctx.JSON(http.StatusOK, gin.H{})
+		newSettings := project.Settings
+		newSettings.States = query.States
+		tasks := taskController.TaskMapToArray(ctx, project.Tasks)
+		if err := taskController.TaskApplyStates(ctx, project.Settings, newSettings, tasks); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		if err := projectController.ProjectModifyStates(ctx, project.Id, query.States); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		publishProject(ctx, projectController, query.ProjectId, id)
+		ctx.JSON(http.StatusOK, emptyResponse{})
 	}
 }
 
-func ProjectLeave(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+// projectid: string; maxSize: number; allowedTypes: string[]
+// Sets the upload limits for attachments of the project and its tasks.
+func ProjectModifyAttachmentLimits(projectController controllers.ProjectController, jwtParser *auth.JWTParser) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
-		type Query struct {
-			Id string `bson:"projectid" json:"projectid"`
+		var query attachmentLimitsBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
 		}
-		var query Query
-		if err := ctx.BindJSON(&query); err != nil {
-			DisplayError(ctx, err.Error())
+		if query.MaxSize <= 0 || query.MaxSize > maxAttachmentSize {
+			Respond(ctx, errs.Validation(fmt.Sprintf("maxSize must be between 1 and %v bytes", maxAttachmentSize)))
 			return
 		}
-		project, err := projectController.ProjectRetrieve(ctx, query.Id)
+		project, err := projectController.ProjectRetrieve(ctx, query.ProjectId)
 		if err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
-		user, err := userController.UserRetrieve(ctx, id, "")
-		if err == mongo.ErrNoDocuments {
-			DisplayError(ctx, "user does not exist")
-			return
-		} else if err != nil {
-			DisplayError(ctx, err.Error())
-			return
-		}
-		useridArr := []string{id}
-
-		// If user is admin & there are no other admins in the project, assign someone else admin role.
-		if len(project.Members) > 1 {
-			if project.Settings.Roles[project.Members[id]].IsAdmin {
-				onlyAdmin := true
-				for nextUserId := range project.Members {
-					if nextUserId == id {
-						continue
-					}
-					if project.Members[nextUserId] == "admin" {
-						onlyAdmin = false
-						break
-					}
-				}
-				if onlyAdmin {
-					for nextUserId := range project.Members {
-						if nextUserId != id {
-							project.Members[nextUserId] = "admin"
-							break
-						}
-					}
+		permissions := project.Settings.Roles[project.Members[id]]
+		if !permissions.IsAdmin && !permissions.EditSettings {
+			Respond(ctx, errs.Forbidden("lacking permissions to execute action"))
+			return
+		}
+		if !checkProjectWritable(ctx, project) {
+			return
+		}
+		if query.AllowedTypes == nil {
+			query.AllowedTypes = []string{}
+		}
+		limits := models.AttachmentLimits{
+			MaxSize:      query.MaxSize,
+			AllowedTypes: query.AllowedTypes,
+		}
+		if err := projectController.ProjectModifyAttachmentLimits(ctx, project.Id, limits); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, emptyResponse{})
+	}
+}
+
+// projectid: string
+// Removes the project from its members and their tasks, and moves it to the trash together with its tasks and events, from which they can be restored until they are purged.
+// Either all of them are updated, or none are.
+// If version is not nil, the project is only deleted if it is still at the version, which is checked first so that nothing else is changed otherwise.
+func deleteProject(ctx context.Context, runner *txn.Runner, userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, eventController controllers.EventController, project models.Project, version *int64, userid string, now time.Time) error {
+	projectid := project.Id.Hex()
+	members := make([]string, 0, len(project.Members))
+	for memberid := range project.Members {
+		members = append(members, memberid)
+	}
+	tasks := taskController.TaskMapToArray(ctx, project.Tasks)
+	// the tasks moved to the trash, so that undoing only restores these
+	taskids := make([]string, len(tasks))
+	assignees := []string{}
+	for i, task := range tasks {
+		taskids[i] = task.Id.Hex()
+		for _, assignee := range task.AssignedTo {
+			if !functions.Contains(assignees, assignee) {
+				assignees = append(assignees, assignee)
+			}
+		}
+	}
+
+	return runner.Run(ctx, func(ctx context.Context, saga *txn.Saga) error {
+		if err := saga.Do(ctx, func(ctx context.Context) error {
+			return projectController.ProjectSoftDelete(ctx, project.Id, version, now)
+		}, func(ctx context.Context) error {
+			return projectController.ProjectRestore(ctx, project.Id)
+		}); err != nil {
+			return err
+		}
+		// Delete projectid from all users in userCollection
+		if err := saga.Do(ctx, func(ctx context.Context) error {
+			return userController.UsersDeleteProject(ctx, []string{}, projectid)
+		}, func(ctx context.Context) error {
+			return userController.UsersAddProject(ctx, members, projectid)
+		}); err != nil {
+			return err
+		}
+		// Remove all project tasks from their assignees
+		if err := saga.Do(ctx, func(ctx context.Context) error {
+			return userController.UsersRemoveTasks(ctx, assignees, project.Tasks)
+		}, func(ctx context.Context) error {
+			for _, task := range tasks {
+				if err := userController.UsersAddTask(ctx, task.AssignedTo, task.Id.Hex(), false); err != nil {
+					return err
 				}
 			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := saga.Do(ctx, func(ctx context.Context) error {
+			return taskController.TaskSoftDelete(ctx, taskids, projectid, now)
+		}, func(ctx context.Context) error {
+			return taskController.TaskRestore(ctx, taskids)
+		}); err != nil {
+			return err
+		}
+		return saga.Do(ctx, func(ctx context.Context) error {
+			return eventController.EventSoftDelete(ctx, project.Events, userid, projectid, now)
+		}, func(ctx context.Context) error {
+			return eventController.EventRestoreWithProject(ctx, projectid, now)
+		})
+	})
+}
+
+// Returns the members of the project after the user leaves.
+// If the user is the only admin, another member is made admin.
+func membersAfterLeaving(project models.Project, userid string) map[string]string {
+	members := make(map[string]string, len(project.Members))
+	for memberid, role := range project.Members {
+		if memberid != userid {
+			members[memberid] = role
 		}
+	}
+	if len(members) == 0 || !project.Settings.Roles[project.Members[userid]].IsAdmin {
+		return members
+	}
+	for _, role := range members {
+		if role == "admin" {
+			return members
+		}
+	}
+	for memberid := range members {
+		members[memberid] = "admin"
+		break
+	}
+	return members
+}
 
-		// Delete user from project.Members
-		delete(project.Members, id)
-		projectController.ProjectModifyUser(ctx, &project)
+// Removes the user from the project and its tasks.
+// Either all of them are updated, or none are.
+func leaveProject(ctx context.Context, runner *txn.Runner, userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, project models.Project, user models.User) error {
+	userid := user.Id.Hex()
+	projectid := project.Id.Hex()
+	updated := project
+	updated.Members = membersAfterLeaving(project, userid)
+	// the project tasks of the user, to restore if leaving fails
+	assigned := []string{}
+	for _, task := range taskController.TaskMapToArray(ctx, project.Tasks) {
+		if functions.Contains(task.AssignedTo, userid) {
+			assigned = append(assigned, task.Id.Hex())
+		}
+	}
+	userTasks := []string{}
+	for _, taskid := range project.Tasks {
+		if _, ok := user.Tasks[taskid]; ok {
+			userTasks = append(userTasks, taskid)
+		}
+	}
 
+	return runner.Run(ctx, func(ctx context.Context, saga *txn.Saga) error {
+		// Delete user from project.Members
+		if err := saga.Do(ctx, func(ctx context.Context) error {
+			return projectController.ProjectModifyUser(ctx, &updated)
+		}, func(ctx context.Context) error {
+			return projectController.ProjectModifyUser(ctx, &project)
+		}); err != nil {
+			return err
+		}
+		// Remove User from all project.Tasks.assignedTo
+		if err := saga.Do(ctx, func(ctx context.Context) error {
+			return taskController.TasksDeleteUser(ctx, project.Tasks, userid)
+		}, func(ctx context.Context) error {
+			return taskController.TasksAddUser(ctx, assigned, userid)
+		}); err != nil {
+			return err
+		}
 		// Delete all project tasks from user.Tasks
-		for _, taskid := range project.Tasks {
-			delete(user.Tasks, taskid)
+		if err := saga.Do(ctx, func(ctx context.Context) error {
+			return userController.UsersRemoveTasks(ctx, []string{userid}, project.Tasks)
+		}, func(ctx context.Context) error {
+			for _, taskid := range userTasks {
+				if err := userController.UsersAddTask(ctx, []string{userid}, taskid, false); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
 		}
+		// delete projectid from user.projects
+		return saga.Do(ctx, func(ctx context.Context) error {
+			return userController.UsersDeleteProject(ctx, []string{userid}, projectid)
+		}, nil)
+	})
+}
 
-		// Remove User from all project.Tasks.assignedTo
-		taskController.TasksDeleteUser(ctx, project.Tasks, id)
-		userController.UserModifyTask(ctx, &user)
+func ProjectDelete(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, eventController controllers.EventController, runner *txn.Runner, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query projectIdQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		projectid := query.ProjectId
+		project, err := projectController.ProjectRetrieve(ctx, projectid)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
 
-		// delete projectid from user.projects
-		userController.UsersDeleteProject(ctx, useridArr, query.Id)
+		if !project.Settings.Roles[project.Members[id]].IsAdmin {
+			Respond(ctx, errs.Forbidden("lacking admin permissions to execute action"))
+			return
+		}
+		version, err := ifMatch(ctx)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
 
-		ctx.JSON(http.StatusOK, gin.H{})
+		// Move the project to the trash, with the same time for its tasks and events so that they are restored together
+		if err := deleteProject(ctx, runner, userController, projectController, taskController, eventController, project, version, id, time.Now()); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		publishActivity(ctx, projectid, id, socket.ActivityProjectDeleted, nil)
+		ctx.JSON(http.StatusOK, emptyResponse{})
+	}
+}
+
+func ProjectLeave(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, runner *txn.Runner, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query projectIdBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		project, err := projectController.ProjectRetrieve(ctx, query.ProjectId)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		user, err := userController.UserRetrieve(ctx, id, "")
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "user does not exist"))
+			return
+		}
+		if err := leaveProject(ctx, runner, userController, projectController, taskController, project, user); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		publishMembers(ctx, userController, query.ProjectId, id, socket.ActivityMemberLeft, []string{id})
+
+		ctx.JSON(http.StatusOK, emptyResponse{})
 	}
 }
 
@@ -562,14 +795,19 @@ func ProjectChat(hub *socket.ChatHub, userController controllers.UserController,
 	return func(ctx *gin.Context) {
 		_, name, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
 
 		// using projectid as roomid, but this also means that we can easily extend this out to other applications
-		roomid := ctx.DefaultQuery("roomid", "")
+		var query roomQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		roomid := query.RoomId
 		if roomid == "" {
-			DisplayError(ctx, "provide a roomid")
+			Respond(ctx, errs.Validation("provide a roomid"))
 			return
 		}
 
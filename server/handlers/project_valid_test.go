@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+)
+
+func TestIsValidStates(t *testing.T) {
+	type test struct {
+		states   []models.WorkflowState
+		expected Result
+	}
+
+	tests := []test{
+		{models.DefaultStates(), Result{"", true}},
+		{[]models.WorkflowState{{Name: "Todo"}, {Name: "Done", IsTerminal: true}}, Result{"", true}},
+		{[]models.WorkflowState{}, Result{"please provide at least one state", false}},
+		{[]models.WorkflowState{{Name: ""}, {Name: "Done", IsTerminal: true}}, Result{"state name cannot be empty", false}},
+		{[]models.WorkflowState{{Name: "Todo"}, {Name: "Todo", IsTerminal: true}}, Result{"state names must be unique", false}},
+		{[]models.WorkflowState{{Name: "Todo"}, {Name: "Doing"}}, Result{"at least one state must be terminal", false}},
+		{[]models.WorkflowState{{Name: "Done", IsTerminal: true}}, Result{"at least one state must not be terminal", false}},
+	}
+
+	for _, test := range tests {
+		message, ok := isValidStates(test.states)
+		if message != test.expected.message || ok != test.expected.ok {
+			t.Errorf("Expected %v but got %v for %v", test.expected, Result{message, ok}, test.states)
+		}
+	}
+}
@@ -0,0 +1,618 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/functions"
+	"github.com/OrgaNiUS/OrgaNiUS/server/handlers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/mailer"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/routes"
+	"github.com/OrgaNiUS/OrgaNiUS/server/socket"
+	"github.com/OrgaNiUS/OrgaNiUS/server/storage"
+	"github.com/OrgaNiUS/OrgaNiUS/server/testdb"
+	"github.com/OrgaNiUS/OrgaNiUS/server/txn"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+/*
+	Routes tested against the in-memory database, so that the handlers and controllers are tested together.
+*/
+
+type memoryServer struct {
+	router            *gin.Engine
+	userController    controllers.UserController
+	projectController controllers.ProjectController
+	taskController    controllers.TaskController
+	eventController   controllers.EventController
+	activity          *socket.ActivityHub
+}
+
+func newMemoryServer(t *testing.T) *memoryServer {
+	t.Helper()
+	database := testdb.New()
+	store, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &memoryServer{
+		router:            gin.New(),
+		userController:    *controllers.NewU(database, "", nil),
+		projectController: *controllers.NewP(database, "", nil),
+		taskController:    *controllers.NewT(database, ""),
+		eventController:   *controllers.NewE(database, ""),
+		activity:          socket.NewActivityHub(),
+	}
+	go s.activity.Run()
+	uc, pc, tc, ec := s.userController, s.projectController, s.taskController, s.eventController
+	runner := txn.NewSagaRunner()
+	jwtParser := getJWT()
+
+	s.router.Use(handlers.Errors())
+
+	// the same routes as the server, without chat
+	routes.API(s.router, uc, pc, tc, ec, *controllers.NewC(database, ""), *controllers.NewA(database, ""), store, *controllers.NewTE(database, ""), *controllers.NewTM(database, ""), runner, jwtParser, mailer.NewLog("OrgaNiUS", "noreply@organius.test"), nil, s.activity)
+	return s
+}
+
+// Creates a user and returns the JWT cookie to make requests as the user.
+func (s *memoryServer) signup(t *testing.T, name string) (*models.User, *http.Cookie) {
+	t.Helper()
+	user := &models.User{
+		Name:     name,
+		Email:    name + "@mail.com",
+		Verified: true,
+		Tasks:    map[string]bool{},
+		Projects: []string{},
+		Events:   []string{},
+	}
+	if err := s.userController.UserCreate(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	token, err := getJWT().Generate(user.Id.Hex(), user.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, auth.MakeJWTCookie(token)
+}
+
+// Makes the request to v1, decoding the JSON response into response if it is not nil.
+func (s *memoryServer) do(t *testing.T, cookie *http.Cookie, method, path string, queries url.Values, body interface{}, response interface{}) int {
+	t.Helper()
+	return s.request(t, cookie, nil, method, "/api/v1"+path, queries, body, response).Code
+}
+
+// Same as do, for v2.
+func (s *memoryServer) v2(t *testing.T, cookie *http.Cookie, method, path string, queries url.Values, body interface{}, response interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	return s.request(t, cookie, nil, method, "/api/v2"+path, queries, body, response)
+}
+
+func (s *memoryServer) request(t *testing.T, cookie *http.Cookie, header http.Header, method, path string, queries url.Values, body interface{}, response interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader *bytes.Reader
+	if body == nil {
+		reader = bytes.NewReader(nil)
+	} else {
+		jsonbytes, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(jsonbytes)
+	}
+	if len(queries) > 0 {
+		path += "?" + queries.Encode()
+	}
+	request := httptest.NewRequest(method, path, reader)
+	request.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	if cookie != nil {
+		request.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, request)
+	if response != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), response); err != nil {
+			t.Fatalf("%v %v: %v (%v)", method, path, err, w.Body.String())
+		}
+	}
+	return w
+}
+
+func (s *memoryServer) createProject(t *testing.T, cookie *http.Cookie, name string) string {
+	t.Helper()
+	var created struct {
+		ProjectId string `json:"projectid"`
+	}
+	if code := s.do(t, cookie, "POST", "/project_create", nil, gin.H{"name": name, "description": "a project"}, &created); code != http.StatusCreated {
+		t.Fatalf("Expected the project to be created, got %v", code)
+	}
+	return created.ProjectId
+}
+
+// Every route of the server needs the user to be logged in, except for these.
+var publicRoutes = map[string]int{
+	"POST /api/v1/signup":           http.StatusBadRequest,
+	"POST /api/v1/verify":           http.StatusBadRequest,
+	"POST /api/v1/login":            http.StatusBadRequest,
+	"POST /api/v1/forgot_pw":        http.StatusBadRequest,
+	"POST /api/v1/verify_forgot_pw": http.StatusBadRequest,
+	"POST /api/v1/change_forgot_pw": http.StatusBadRequest,
+	"GET /api/v1/user_exists":       http.StatusBadRequest,
+	"GET /api/v1/user":              http.StatusBadRequest,
+	"GET /api/v1/openapi.json":      http.StatusOK,
+	"GET /api/v1/docs":              http.StatusOK,
+	"POST /api/v2/users":            http.StatusBadRequest,
+	"GET /api/v2/users/:userid":     http.StatusNotFound,
+	"POST /api/v2/sessions":         http.StatusBadRequest,
+	"GET /api/v2/openapi.json":      http.StatusOK,
+	"GET /api/v2/docs":              http.StatusOK,
+	// web sockets, which check the login with each message after upgrading
+	"GET /api/v1/project_search":        http.StatusBadRequest,
+	"GET /api/v1/project_invite_search": http.StatusBadRequest,
+}
+
+func TestRoutesNotLoggedIn(t *testing.T) {
+	s := newMemoryServer(t)
+	param := regexp.MustCompile(`:[a-z]+`)
+	checked := map[string]bool{}
+	for _, route := range s.router.Routes() {
+		checked[route.Method+" "+route.Path] = true
+		// any valid id for the path parameters
+		path := param.ReplaceAllString(route.Path, primitive.NewObjectID().Hex())
+		w := s.request(t, nil, nil, route.Method, path, nil, nil, nil)
+		expected, ok := publicRoutes[route.Method+" "+route.Path]
+		if !ok {
+			expected = http.StatusUnauthorized
+		}
+		if w.Code != expected {
+			t.Errorf("Expected %v %v to respond with %v when not logged in but got %v", route.Method, route.Path, expected, w.Code)
+		}
+	}
+	// the routes are those of the server, less chat which needs a hub
+	for _, route := range append(handlers.V1Routes(), handlers.V2Routes()...) {
+		if !checked[route.Method+" "+route.Path] && route.Path != "/api/v1/project_chat" {
+			t.Errorf("Expected %v %v to be checked", route.Method, route.Path)
+		}
+	}
+}
+
+func TestProjectRoutes(t *testing.T) {
+	s := newMemoryServer(t)
+	admin, adminCookie := s.signup(t, "admin")
+	_, otherCookie := s.signup(t, "other")
+
+	projectid := s.createProject(t, adminCookie, "Project One")
+
+	var all struct {
+		Projects []struct {
+			Id   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"projects"`
+	}
+	if code := s.do(t, adminCookie, "GET", "/project_get_all", nil, nil, &all); code != http.StatusOK {
+		t.Fatalf("Expected the projects to be found, got %v", code)
+	}
+	if len(all.Projects) != 1 || all.Projects[0].Id != projectid || all.Projects[0].Name != "Project One" {
+		t.Errorf("Expected the created project, got %v", all.Projects)
+	}
+
+	var project struct {
+		Name    string `json:"name"`
+		Members []struct {
+			Id   string `json:"id"`
+			Role string `json:"role"`
+		} `json:"members"`
+	}
+	query := url.Values{"projectid": {projectid}}
+	if code := s.do(t, adminCookie, "GET", "/project_get", query, nil, &project); code != http.StatusOK {
+		t.Fatalf("Expected the project to be found, got %v", code)
+	}
+	if project.Name != "Project One" || len(project.Members) != 1 || project.Members[0].Id != admin.Id.Hex() || project.Members[0].Role != "admin" {
+		t.Errorf("Expected the creator to be the only member, got %+v", project)
+	}
+
+	// not a member
+	if code := s.do(t, otherCookie, "DELETE", "/project_delete", query, nil, nil); code == http.StatusOK {
+		t.Errorf("Expected a user outside the project to not be able to delete it")
+	}
+
+	if code := s.do(t, adminCookie, "DELETE", "/project_delete", query, nil, nil); code != http.StatusOK {
+		t.Fatalf("Expected the project to be deleted, got %v", code)
+	}
+	user, err := s.userController.UserRetrieve(context.Background(), admin.Id.Hex(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(user.Projects) != 0 {
+		t.Errorf("Expected the project to be removed from the user, got %v", user.Projects)
+	}
+
+	var trashed struct {
+		Projects []models.Project `json:"projects"`
+	}
+	if code := s.do(t, adminCookie, "GET", "/trash_get", nil, nil, &trashed); code != http.StatusOK {
+		t.Fatalf("Expected the trash to be found, got %v", code)
+	}
+	if len(trashed.Projects) != 1 || trashed.Projects[0].Id.Hex() != projectid {
+		t.Errorf("Expected the project to be in the trash, got %v", trashed.Projects)
+	}
+
+	if code := s.do(t, adminCookie, "PATCH", "/trash_restore", nil, gin.H{"type": "project", "id": projectid}, nil); code != http.StatusOK {
+		t.Fatalf("Expected the project to be restored, got %v", code)
+	}
+	if code := s.do(t, adminCookie, "GET", "/project_get_all", nil, nil, &all); code != http.StatusOK || len(all.Projects) != 1 {
+		t.Errorf("Expected the restored project to be found, got %v", all.Projects)
+	}
+}
+
+func TestTaskRoutes(t *testing.T) {
+	s := newMemoryServer(t)
+	user, cookie := s.signup(t, "user")
+	projectid := s.createProject(t, cookie, "Project One")
+
+	deadline := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	var created struct {
+		TaskId string `json:"taskid"`
+	}
+	task := gin.H{"name": "task", "projectid": projectid, "assignedTo": []string{user.Id.Hex()}, "deadline": deadline, "tags": []string{"a"}}
+	if code := s.do(t, cookie, "POST", "/task_create", nil, task, &created); code != http.StatusCreated {
+		t.Fatalf("Expected the task to be created, got %v", code)
+	}
+	if code := s.do(t, cookie, "POST", "/task_create", nil, gin.H{"name": "personal"}, nil); code != http.StatusCreated {
+		t.Fatalf("Expected the personal task to be created, got %v", code)
+	}
+
+	var tasks struct {
+		Tasks []models.Task `json:"tasks"`
+	}
+	if code := s.do(t, cookie, "GET", "/task_get_all", url.Values{"projectid": {projectid}}, nil, &tasks); code != http.StatusOK {
+		t.Fatalf("Expected the tasks to be found, got %v", code)
+	}
+	if len(tasks.Tasks) != 1 || tasks.Tasks[0].Id.Hex() != created.TaskId || tasks.Tasks[0].State == "" {
+		t.Fatalf("Expected the task to be in the project, got %v", tasks.Tasks)
+	}
+	// the user's tasks include both the project and personal tasks
+	if code := s.do(t, cookie, "GET", "/task_get_all", nil, nil, &tasks); code != http.StatusOK || len(tasks.Tasks) != 2 {
+		t.Errorf("Expected the user to have 2 tasks, got %v", tasks.Tasks)
+	}
+
+	modify := gin.H{"taskid": created.TaskId, "name": "renamed", "isDone": true, "addTags": []string{"b"}, "removeTags": []string{"a"}}
+	if code := s.do(t, cookie, "PATCH", "/task_modify", nil, modify, nil); code != http.StatusOK {
+		t.Fatalf("Expected the task to be modified, got %v", code)
+	}
+	modified, err := s.taskController.TaskRetrieve(context.Background(), created.TaskId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modified.Name != "renamed" || !modified.IsDone || len(modified.Tags) != 1 || modified.Tags[0] != "b" {
+		t.Errorf("Expected the task to be modified, got %+v", modified)
+	}
+
+	if code := s.do(t, cookie, "DELETE", "/task_delete", url.Values{"projectid": {projectid}, "tasks": {created.TaskId}}, nil, nil); code != http.StatusOK {
+		t.Fatalf("Expected the task to be deleted, got %v", code)
+	}
+	if code := s.do(t, cookie, "GET", "/task_get_all", url.Values{"projectid": {projectid}}, nil, &tasks); code != http.StatusOK || len(tasks.Tasks) != 0 {
+		t.Errorf("Expected the project to have no tasks, got %v", tasks.Tasks)
+	}
+}
+
+// Creates a task of the project as it was stored before tasks recorded their projectid and workflow state.
+func (s *memoryServer) legacyTask(t *testing.T, projectid, name string, assignees ...string) string {
+	t.Helper()
+	ctx := context.Background()
+	task := &models.Task{Name: name, AssignedTo: assignees, Tags: []string{}}
+	if err := s.taskController.TaskCreate(ctx, task); err != nil {
+		t.Fatal(err)
+	}
+	taskid := task.Id.Hex()
+	if err := s.userController.UsersAddTask(ctx, assignees, taskid, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.projectController.ProjectAddTasks(ctx, projectid, []string{taskid}); err != nil {
+		t.Fatal(err)
+	}
+	return taskid
+}
+
+func TestLegacyProjectTask(t *testing.T) {
+	s := newMemoryServer(t)
+	user, cookie := s.signup(t, "user")
+	projectid := s.createProject(t, cookie, "Project One")
+	taskid := s.legacyTask(t, projectid, "legacy", user.Id.Hex())
+
+	// queries on the project find the task through the tasks of the project
+	var listed struct {
+		Data []models.Task `json:"data"`
+	}
+	if w := s.v2(t, cookie, "GET", "/projects/"+projectid+"/tasks", nil, nil, &listed); w.Code != http.StatusOK || len(listed.Data) != 1 || listed.Data[0].Id.Hex() != taskid {
+		t.Errorf("Expected the task to be listed in its project, got %v %+v", w.Code, listed.Data)
+	}
+	if w := s.v2(t, cookie, "GET", "/projects/"+projectid+"/tasks/"+taskid, nil, nil, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected the task to be at the path of its project, got %v", w.Code)
+	}
+	if w := s.v2(t, cookie, "GET", "/tasks/"+taskid, nil, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the task to not be a personal task, got %v", w.Code)
+	}
+
+	// completing the task moves it to the terminal state, which records its project
+	if code := s.do(t, cookie, "PATCH", "/task_modify", nil, gin.H{"taskid": taskid, "isDone": true}, nil); code != http.StatusOK {
+		t.Fatalf("Expected the task to be modified, got %v", code)
+	}
+	task, err := s.taskController.TaskRetrieve(context.Background(), taskid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !task.IsDone || task.State != "Done" || task.ProjectId != projectid {
+		t.Errorf("Expected the task to be done in the Done state of its project, got %+v", task)
+	}
+}
+
+func TestLegacyProjectTaskV2Delete(t *testing.T) {
+	s := newMemoryServer(t)
+	ctx := context.Background()
+	user, cookie := s.signup(t, "user")
+	projectid := s.createProject(t, cookie, "Project One")
+	taskid := s.legacyTask(t, projectid, "legacy", user.Id.Hex())
+
+	if w := s.v2(t, cookie, "DELETE", "/projects/"+projectid+"/tasks/"+taskid, nil, nil, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected the task to be deleted, got %v", w.Code)
+	}
+	project, err := s.projectController.ProjectRetrieve(ctx, projectid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(project.Tasks) != 0 {
+		t.Errorf("Expected the task to be removed from the project, got %v", project.Tasks)
+	}
+	var trashed struct {
+		Tasks []models.Task `json:"tasks"`
+	}
+	if code := s.do(t, cookie, "GET", "/trash_get", url.Values{"projectid": {projectid}}, nil, &trashed); code != http.StatusOK || len(trashed.Tasks) != 1 || trashed.Tasks[0].Id.Hex() != taskid {
+		t.Errorf("Expected the task to be in the trash of the project, got %v %+v", code, trashed.Tasks)
+	}
+}
+
+func TestLegacyProjectTaskBulk(t *testing.T) {
+	s := newMemoryServer(t)
+	ctx := context.Background()
+	admin, adminCookie := s.signup(t, "admin")
+	member, memberCookie := s.signup(t, "member")
+	projectid := s.createProject(t, adminCookie, "Project One")
+	stored, err := s.projectController.ProjectRetrieve(ctx, projectid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Members[member.Id.Hex()] = "member"
+	s.projectController.ProjectModifyUser(ctx, &stored)
+	taskid := s.legacyTask(t, projectid, "legacy", member.Id.Hex())
+
+	type results struct {
+		Results []struct {
+			TaskId string `json:"taskid"`
+			Ok     bool   `json:"ok"`
+			Error  string `json:"error"`
+		} `json:"results"`
+	}
+	bulk := func(cookie *http.Cookie, body gin.H) results {
+		t.Helper()
+		var response results
+		if code := s.do(t, cookie, "POST", "/task_bulk", nil, body, &response); code != http.StatusOK || len(response.Results) != 1 {
+			t.Fatalf("Expected a result for the task, got %v %+v", code, response)
+		}
+		return response
+	}
+
+	// the task belongs to the project, so the permissions of the project apply
+	if response := bulk(memberCookie, gin.H{"taskids": []string{taskid}, "operation": "reassign", "assignedTo": []string{admin.Id.Hex()}}); response.Results[0].Error != "you lack permissions to assign others" {
+		t.Errorf("Expected members to not reassign the task, got %+v", response.Results[0])
+	}
+	if response := bulk(adminCookie, gin.H{"taskids": []string{taskid}, "operation": "reassign", "assignedTo": []string{admin.Id.Hex()}}); !response.Results[0].Ok {
+		t.Errorf("Expected admins to reassign the task, got %+v", response.Results[0])
+	}
+	if response := bulk(adminCookie, gin.H{"taskids": []string{taskid}, "operation": "delete"}); !response.Results[0].Ok {
+		t.Fatalf("Expected the task to be deleted, got %+v", response.Results[0])
+	}
+	project, err := s.projectController.ProjectRetrieve(ctx, projectid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(project.Tasks) != 0 {
+		t.Errorf("Expected the task to be removed from the project, got %v", project.Tasks)
+	}
+}
+
+func TestTaskDeleteScope(t *testing.T) {
+	s := newMemoryServer(t)
+	ctx := context.Background()
+	user, cookie := s.signup(t, "user")
+	other, otherCookie := s.signup(t, "other")
+	projectid := s.createProject(t, cookie, "Project One")
+	taskid := s.legacyTask(t, projectid, "legacy", user.Id.Hex())
+	personal := &models.Task{Name: "personal", AssignedTo: []string{other.Id.Hex()}, IsPersonal: true, Tags: []string{}}
+	if err := s.taskController.TaskCreate(ctx, personal); err != nil {
+		t.Fatal(err)
+	}
+
+	// tasks outside the project are refused, and nothing is deleted
+	if code := s.do(t, cookie, "DELETE", "/task_delete", url.Values{"projectid": {projectid}, "tasks": {taskid, personal.Id.Hex()}}, nil, nil); code != http.StatusNotFound {
+		t.Errorf("Expected the personal task of another user to not be found in the project, got %v", code)
+	}
+	if code := s.do(t, otherCookie, "DELETE", "/task_delete", url.Values{"projectid": {projectid}, "tasks": {taskid}}, nil, nil); code != http.StatusForbidden {
+		t.Errorf("Expected non-members to not delete the tasks of the project, got %v", code)
+	}
+	for _, id := range []string{taskid, personal.Id.Hex()} {
+		if task, err := s.taskController.TaskRetrieve(ctx, id); err != nil || task.DeletedAt != nil {
+			t.Errorf("Expected task %v to not be deleted, got %v", id, err)
+		}
+	}
+	project, err := s.projectController.ProjectRetrieve(ctx, projectid)
+	if err != nil || !functions.Contains(project.Tasks, taskid) {
+		t.Errorf("Expected the task to still be in the project, got %v %v", project.Tasks, err)
+	}
+}
+
+func TestTaskBulkOrder(t *testing.T) {
+	s := newMemoryServer(t)
+	admin, adminCookie := s.signup(t, "admin")
+	_, otherCookie := s.signup(t, "other")
+	projectid := s.createProject(t, adminCookie, "Project One")
+	first := s.legacyTask(t, projectid, "first", admin.Id.Hex())
+	second := s.legacyTask(t, projectid, "second", admin.Id.Hex())
+	missing := primitive.NewObjectID().Hex()
+
+	var response struct {
+		Results []struct {
+			TaskId string `json:"taskid"`
+			Ok     bool   `json:"ok"`
+		} `json:"results"`
+	}
+	// the results follow the order of the taskids, whatever their outcome
+	body := gin.H{"taskids": []string{first, missing, second}, "operation": "addTags", "tags": []string{"tag"}}
+	if code := s.do(t, adminCookie, "POST", "/task_bulk", nil, body, &response); code != http.StatusOK || len(response.Results) != 3 {
+		t.Fatalf("Expected a result for each task, got %v %+v", code, response)
+	}
+	for i, taskid := range []string{first, missing, second} {
+		if result := response.Results[i]; result.TaskId != taskid || result.Ok != (taskid != missing) {
+			t.Errorf("Expected result %v to be for %v, got %+v", i, taskid, result)
+		}
+	}
+	if code := s.do(t, otherCookie, "POST", "/task_bulk", nil, body, &response); code != http.StatusOK || response.Results[0].TaskId != first || response.Results[1].TaskId != missing || response.Results[0].Ok {
+		t.Errorf("Expected the tasks of the project to be refused in order, got %v %+v", code, response)
+	}
+}
+
+func TestLegacyProjectTaskTrash(t *testing.T) {
+	s := newMemoryServer(t)
+	ctx := context.Background()
+	user, cookie := s.signup(t, "user")
+	projectid := s.createProject(t, cookie, "Project One")
+	taskid := s.legacyTask(t, projectid, "legacy", user.Id.Hex())
+
+	// restored together with the project
+	if code := s.do(t, cookie, "DELETE", "/project_delete", url.Values{"projectid": {projectid}}, nil, nil); code != http.StatusOK {
+		t.Fatalf("Expected the project to be deleted, got %v", code)
+	}
+	if code := s.do(t, cookie, "PATCH", "/trash_restore", nil, gin.H{"type": "project", "id": projectid}, nil); code != http.StatusOK {
+		t.Fatalf("Expected the project to be restored, got %v", code)
+	}
+	if _, err := s.taskController.TaskRetrieve(ctx, taskid); err != nil {
+		t.Fatalf("Expected the task to be restored with the project, got %v", err)
+	}
+
+	// deleted on its own, it is in the trash of the project
+	if code := s.do(t, cookie, "DELETE", "/task_delete", url.Values{"projectid": {projectid}, "tasks": {taskid}}, nil, nil); code != http.StatusOK {
+		t.Fatalf("Expected the task to be deleted, got %v", code)
+	}
+	var trashed struct {
+		Tasks []models.Task `json:"tasks"`
+	}
+	if code := s.do(t, cookie, "GET", "/trash_get", url.Values{"projectid": {projectid}}, nil, &trashed); code != http.StatusOK || len(trashed.Tasks) != 1 || trashed.Tasks[0].Id.Hex() != taskid {
+		t.Fatalf("Expected the task to be in the trash of the project, got %v %+v", code, trashed.Tasks)
+	}
+	if code := s.do(t, cookie, "PATCH", "/trash_restore", nil, gin.H{"type": "task", "id": taskid}, nil); code != http.StatusOK {
+		t.Fatalf("Expected the task to be restored, got %v", code)
+	}
+	project, err := s.projectController.ProjectRetrieve(ctx, projectid)
+	if err != nil || !functions.Contains(project.Tasks, taskid) {
+		t.Errorf("Expected the task to be back in the project, got %v %v", project.Tasks, err)
+	}
+}
+
+func TestEventRoutes(t *testing.T) {
+	s := newMemoryServer(t)
+	_, cookie := s.signup(t, "user")
+
+	start := time.Date(2022, 7, 1, 9, 0, 0, 0, time.UTC)
+	event := gin.H{"name": "meeting", "start": start.Format(time.RFC3339), "end": start.Add(time.Hour).Format(time.RFC3339)}
+	var created struct {
+		EventId string `json:"eventid"`
+	}
+	if code := s.do(t, cookie, "POST", "/event_create", nil, event, &created); code != http.StatusCreated {
+		t.Fatalf("Expected the event to be created, got %v", code)
+	}
+	reversed := gin.H{"name": "meeting", "start": event["end"], "end": event["start"]}
+	if code := s.do(t, cookie, "POST", "/event_create", nil, reversed, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected an event ending before it starts to be rejected, got %v", code)
+	}
+
+	var found struct {
+		Name  string    `json:"name"`
+		Start time.Time `json:"start"`
+	}
+	if code := s.do(t, cookie, "GET", "/event_get", url.Values{"eventid": {created.EventId}}, nil, &found); code != http.StatusOK {
+		t.Fatalf("Expected the event to be found, got %v", code)
+	}
+	if found.Name != "meeting" || !found.Start.Equal(start) {
+		t.Errorf("Expected the created event, got %+v", found)
+	}
+
+	var all struct {
+		Events []models.Event `json:"events"`
+	}
+	if code := s.do(t, cookie, "GET", "/event_get_all", nil, nil, &all); code != http.StatusOK || len(all.Events) != 1 {
+		t.Fatalf("Expected the user to have 1 event, got %v", all.Events)
+	}
+
+	if code := s.do(t, cookie, "DELETE", "/event_delete", url.Values{"eventid": {created.EventId}}, nil, nil); code != http.StatusOK {
+		t.Fatalf("Expected the event to be deleted, got %v", code)
+	}
+	if code := s.do(t, cookie, "GET", "/event_get_all", nil, nil, &all); code != http.StatusOK || len(all.Events) != 0 {
+		t.Errorf("Expected the user to have no events, got %v", all.Events)
+	}
+}
+
+func TestSearchInMemory(t *testing.T) {
+	providers := map[string]controllers.SearchProvider{
+		// $search is emulated by the in-memory database
+		"atlas":    controllers.AtlasSearch{},
+		"embedded": controllers.NewEmbeddedSearch(time.Minute),
+	}
+	for name, provider := range providers {
+		s := newMemoryServer(t)
+		s.projectController.Search = provider
+		s.userController.Search = provider
+		_, cookie := s.signup(t, "admin")
+		other, _ := s.signup(t, "other")
+		s.signup(t, "otter")
+		public := s.createProject(t, cookie, "Orange Juice")
+		private := s.createProject(t, cookie, "Orange Squash")
+		ctx := context.Background()
+		publicid, _ := primitive.ObjectIDFromHex(public)
+		isPublic := true
+		s.projectController.ProjectModifyGeneral(ctx, publicid, nil, nil, nil, &isPublic)
+
+		results, err := s.projectController.ProjectSearch(ctx, other.Id.Hex(), "ornge")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 || results[0].Map()["name"] != "Orange Juice" || results[0].Map()["id"] != publicid {
+			t.Errorf("%v: Expected only the public project to be found, got %v (private project %v)", name, results, private)
+		}
+
+		// the admin is already in the project
+		results, err = s.userController.ProjectInviteSearch(ctx, public, "ot")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 2 || results[0].Map()["name"] != "other" || results[1].Map()["name"] != "otter" {
+			t.Errorf("%v: Expected the other users to be found, got %v", name, results)
+		}
+		if err := provider.CheckIndexes(ctx, testdb.New(), controllers.SearchFields); err != nil {
+			t.Errorf("%v: Expected no indexes to be needed in memory, got %v", name, err)
+		}
+	}
+}
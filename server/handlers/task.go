@@ -1,236 +1,737 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
 	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
 	"github.com/OrgaNiUS/OrgaNiUS/server/functions"
 	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/recurrence"
+	"github.com/OrgaNiUS/OrgaNiUS/server/socket"
+	"github.com/OrgaNiUS/OrgaNiUS/server/txn"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// name: string, description: string, assignedTo: string[userids], deadline: time.Time, projectID: string
+func isValidRecurrence(rule *models.Recurrence, deadline time.Time) (string, bool) {
+	if rule == nil {
+		return "", true
+	}
+	if rule.Frequency != models.RecurDaily && rule.Frequency != models.RecurWeekly && rule.Frequency != models.RecurMonthly {
+		return "frequency must be daily, weekly or monthly", false
+	} else if rule.Interval < 1 {
+		return "interval must be positive", false
+	} else if deadline.IsZero() {
+		return "recurring tasks require a deadline", false
+	} else if !rule.Until.IsZero() && rule.Until.Before(deadline) {
+		return "recurrence cannot end before the deadline", false
+	} else if rule.Day < 0 || rule.Day > 31 {
+		return "day must be a day of the month", false
+	}
+	return "", true
+}
+
+// Whether the user is assigned to the task, or is a member of the task's project.
+func canAccessTask(ctx *gin.Context, projectController controllers.ProjectController, task models.Task, userid string) bool {
+	for _, assignee := range task.AssignedTo {
+		if assignee == userid {
+			return true
+		}
+	}
+	if task.ProjectId == "" {
+		return false
+	}
+	project, err := projectController.ProjectRetrieve(ctx, task.ProjectId)
+	if err != nil {
+		return false
+	}
+	_, ok := project.Members[userid]
+	return ok
+}
+
+// Creates the task, and adds it to its assignees and project.
+// Either all of them are updated, or none are.
+func createTask(ctx context.Context, runner *txn.Runner, userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, task *models.Task) error {
+	return runner.Run(ctx, func(ctx context.Context, saga *txn.Saga) error {
+		if err := saga.Do(ctx, func(ctx context.Context) error {
+			return taskController.TaskCreate(ctx, task)
+		}, func(ctx context.Context) error {
+			return taskController.TaskDelete(ctx, task.Id.Hex())
+		}); err != nil {
+			return err
+		}
+		taskid := task.Id.Hex()
+		if err := saga.Do(ctx, func(ctx context.Context) error {
+			return userController.UsersAddTask(ctx, task.AssignedTo, taskid, task.IsPersonal)
+		}, func(ctx context.Context) error {
+			return userController.UsersRemoveTasks(ctx, task.AssignedTo, []string{taskid})
+		}); err != nil {
+			return err
+		}
+		if task.ProjectId == "" {
+			return nil
+		}
+		return saga.Do(ctx, func(ctx context.Context) error {
+			return projectController.ProjectAddTasks(ctx, task.ProjectId, []string{taskid})
+		}, func(ctx context.Context) error {
+			return projectController.ProjectDeleteTasks(ctx, task.ProjectId, []string{taskid})
+		})
+	})
+}
+
+// A task to create, as given by the client.
+type taskBody struct {
+	Name        string             `bson:"name" json:"name" required:"true"`
+	Description string             `bson:"description" json:"description"`
+	AssignedTo  []string           `bson:"assignedTo" json:"assignedTo" doc:"userids, ignored for personal tasks, which are assigned to the user"`
+	Deadline    string             `bson:"deadline" json:"deadline" doc:"ISO 8601"`
+	Tags        []string           `bson:"tags" json:"tags"`
+	Recurrence  *models.Recurrence `bson:"recurrence" json:"recurrence"`
+	Estimate    int                `bson:"estimate" json:"estimate" doc:"in minutes"`
+}
+
+// A task to create in the project, or a personal task if there is no projectid.
+type taskInput struct {
+	taskBody
+	ProjectId string `bson:"projectid" json:"projectid" doc:"a personal task if not given"`
+}
+
+// Validates the input and converts it into the task to be created by the user.
+// Tasks of a project are placed at the bottom of the project's initial workflow state.
+func newTask(ctx context.Context, projectController controllers.ProjectController, taskController controllers.TaskController, input taskInput, userid string) (models.Task, error) {
+	var task models.Task
+	task.Name = input.Name
+	task.Description = input.Description
+	if input.Deadline != "" {
+		deadline, err := functions.StringToTime(input.Deadline)
+		if err != nil {
+			return task, errs.Validation("Please provide time in proper ISO8601 format")
+		}
+		task.Deadline = deadline
+	}
+	task.Tags = input.Tags
+	if msg, ok := isValidRecurrence(input.Recurrence, task.Deadline); !ok {
+		return task, errs.Validation(msg)
+	}
+	task.Recurrence = input.Recurrence
+	if msg, ok := isValidEstimate(input.Estimate); !ok {
+		return task, errs.Validation(msg)
+	}
+	task.Estimate = input.Estimate
+
+	if input.ProjectId == "" {
+		task.AssignedTo = []string{userid}
+		task.IsPersonal = true
+		return task, nil
+	}
+	project, err := projectController.ProjectRetrieve(ctx, input.ProjectId)
+	if err != nil {
+		return task, errs.OrNotFound(err, "project does not exist")
+	}
+	if err := projectWritable(project); err != nil {
+		return task, err
+	}
+	// Add Users to newly Created Task
+	task.AssignedTo = []string{}
+	task.AssignedTo = append(task.AssignedTo, input.AssignedTo...)
+	task.ProjectId = input.ProjectId
+	task.State = project.Settings.InitialState().Name
+	task.Position = len(controllers.TaskColumn(project.Settings, taskController.TaskMapToArray(ctx, project.Tasks), task.State))
+	return task, nil
+}
+
+// name: string, description: string, assignedTo: string[userids], deadline: time.Time, projectID: string, recurrence: Recurrence
 // No projectid -> Personal Task;
 // projectid and No Users -> A project task, waiting to be assigned;
 // projectId and Users -> A project task is assigned to users
-func TaskCreate(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+func TaskCreate(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, runner *txn.Runner, jwtParser *auth.JWTParser) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
-		var task models.Task
-		type Query struct {
-			Name        string   `bson:"name" json:"name"`
-			Description string   `bson:"description" json:"description"`
-			Users       []string `bson:"assignedTo" json:"assignedTo"`
-			ProjectId   string   `bson:"projectid" json:"projectid"`
-			Deadline    string   `bson:"deadline" json:"deadline"`
-			Tags        []string `bson:"tags" json:"tags"`
-		}
-		var query Query
-		if err := ctx.BindJSON(&query); err != nil {
-			DisplayError(ctx, err.Error())
+		var input taskInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			Respond(ctx, invalidBody(err))
 			return
 		}
-		task.Name = query.Name
-		task.Description = query.Description
-		if query.Deadline != "" {
-			deadline, err := functions.StringToTime(query.Deadline)
-			if err != nil {
-				DisplayError(ctx, "Please provide time in proper ISO8601 format")
-				return
-			}
-			task.Deadline = deadline
+		task, err := newTask(ctx, projectController, taskController, input, id)
+		if err != nil {
+			Respond(ctx, err)
+			return
 		}
-		task.Tags = query.Tags
-
-		if query.ProjectId == "" {
-			task.AssignedTo = []string{id}
-			task.IsPersonal = true
-			if err := taskController.TaskCreate(ctx, &task); err != nil {
-				DisplayError(ctx, err.Error())
-				return
-			}
-			user, err := userController.UserRetrieve(ctx, id, "")
-			if err == mongo.ErrNoDocuments {
-				DisplayError(ctx, "user does not exist")
-			} else if err != nil {
-				DisplayError(ctx, err.Error())
-			}
-			user.Tasks[task.Id.Hex()] = true
-			userController.UserModifyTask(ctx, &user)
-		} else {
-			project, err := projectController.ProjectRetrieve(ctx, query.ProjectId)
-			if err == mongo.ErrNoDocuments {
-				DisplayError(ctx, "project does not exist")
-			} else if err != nil {
-				DisplayError(ctx, err.Error())
-			}
-			// Add Users to newly Created Task
-			task.AssignedTo = []string{}
-			task.AssignedTo = append(task.AssignedTo, query.Users...)
-			if err := taskController.TaskCreate(ctx, &task); err != nil {
-				DisplayError(ctx, err.Error())
-				return
-			}
-			taskid := task.Id.Hex()
-			// Add Task to User.Tasks Array
-			for _, userid := range query.Users {
-				user, err := userController.UserRetrieve(ctx, userid, "")
-				if err == mongo.ErrNoDocuments {
-					DisplayError(ctx, "user does not exist")
-				} else if err != nil {
-					DisplayError(ctx, err.Error())
-				}
-				user.Tasks[taskid] = false
-				userController.UserModifyTask(ctx, &user)
-			}
-			// Add Task to Project.Tasks Array
-			project.Tasks = append(project.Tasks, taskid)
-			projectController.ProjectModifyTask(ctx, &project)
+		if err := createTask(ctx, runner, userController, projectController, taskController, &task); err != nil {
+			Respond(ctx, err)
+			return
 		}
+		publishActivity(ctx, task.ProjectId, id, socket.ActivityTaskCreated, socket.TaskPayload{Task: task})
 
-		ctx.JSON(http.StatusCreated, gin.H{
-			"taskid": task.Id.Hex(),
-		})
+		ctx.JSON(http.StatusCreated, taskIdResponse{TaskId: task.Id.Hex()})
 	}
 }
 
 // projectid: string, tasks: string[taskid]
-func TaskDelete(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+// Tasks are moved to the trash, keeping their comments, attachments and time entries until they are purged.
+// With a projectid, every task must be in the project and the user must be able to remove its tasks, else none are deleted.
+func TaskDelete(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, runner *txn.Runner, jwtParser *auth.JWTParser) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query taskDeleteQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
 			return
 		}
-		projectid := ctx.DefaultQuery("projectid", "")
-		tasks := ctx.QueryArray("tasks")
+		projectid, tasks := query.ProjectId, query.Tasks
 		if len(tasks) == 0 {
-			DisplayError(ctx, "please provide a task to delete")
+			Respond(ctx, errs.Validation("please provide a task to delete"))
+			return
 		}
+		now := time.Now()
 		// if True delete Personal Task,
 		// else delete Project Task
 		if projectid == "" {
 			user, err := userController.UserRetrieve(ctx, id, "")
-			if err == mongo.ErrNoDocuments {
-				DisplayError(ctx, "user does not exist")
-			} else if err != nil {
-				DisplayError(ctx, err.Error())
+			if err != nil {
+				Respond(ctx, errs.OrNotFound(err, "user does not exist"))
+				return
 			}
+			deleted := []string{}
 			for _, taskid := range tasks {
 				_, containsTask := user.Tasks[taskid]
 				if !containsTask {
 					continue
 				}
 				delete(user.Tasks, taskid)
-				if err := taskController.TaskDelete(ctx, taskid); err != nil {
-					DisplayError(ctx, err.Error())
-				}
+				deleted = append(deleted, taskid)
+			}
+			if err := taskController.TaskSoftDelete(ctx, deleted, "", now); err != nil {
+				Respond(ctx, err)
+				return
 			}
 			userController.UserModifyTask(ctx, &user)
-			ctx.JSON(http.StatusOK, gin.H{})
+			ctx.JSON(http.StatusOK, emptyResponse{})
 		} else {
-			// delete the tasks from project
-			projectController.ProjectDeleteTasks(ctx, projectid, tasks)
-
-			// delete each taskid from each user
+			project, err := projectController.ProjectRetrieve(ctx, projectid)
+			if err != nil {
+				Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+				return
+			}
+			if !checkProjectWritable(ctx, project) {
+				return
+			}
+			// every task is checked before anything is changed
+			deleted := []models.Task{}
+			checked := map[string]bool{}
 			for _, taskid := range tasks {
+				if checked[taskid] {
+					continue
+				}
+				checked[taskid] = true
 				task, err := taskController.TaskRetrieve(ctx, taskid)
-				if err == mongo.ErrNoDocuments {
-					DisplayError(ctx, "task does not exist")
-				} else if err != nil {
-					DisplayError(ctx, err.Error())
+				if err != nil {
+					Respond(ctx, errs.OrNotFound(err, "task does not exist"))
+					return
+				}
+				// tasks created before they recorded their projectid are found through their project
+				owner, err := projectController.ProjectOfTask(ctx, task)
+				if err != nil {
+					Respond(ctx, err)
+					return
 				}
-				for _, userid := range task.AssignedTo {
-					user, err := userController.UserRetrieve(ctx, userid, "")
-					if err == mongo.ErrNoDocuments {
-						DisplayError(ctx, "user does not exist")
-					} else if err != nil {
-						DisplayError(ctx, err.Error())
-					}
-					delete(user.Tasks, taskid)
-					userController.UserModifyTask(ctx, &user)
+				if owner == nil || owner.Id != project.Id {
+					Respond(ctx, errs.NotFound("task does not exist in the project"))
+					return
 				}
+				if err := canBulkModifyTask(&project, task, controllers.TaskBulkDelete, nil, id); err != nil {
+					Respond(ctx, err)
+					return
+				}
+				deleted = append(deleted, task)
+			}
+			if err := deleteProjectTasks(ctx, runner, userController, projectController, taskController, project, deleted, now); err != nil {
+				Respond(ctx, err)
+				return
 			}
+			publishActivity(ctx, projectid, id, socket.ActivityTaskDeleted, socket.DeletedPayload{Ids: tasks})
+			ctx.JSON(http.StatusOK, emptyResponse{})
+		}
+	}
+}
 
-			// delete all tasks from taskCollection
-			taskController.TaskDeleteMany(ctx, tasks)
-			ctx.JSON(http.StatusOK, gin.H{})
+// Moves the tasks of the project to the trash, and removes them from the project and their assignees.
+// Either all of them are updated, or none are.
+func deleteProjectTasks(ctx context.Context, runner *txn.Runner, userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, project models.Project, tasks []models.Task, now time.Time) error {
+	projectid := project.Id.Hex()
+	taskids := make([]string, len(tasks))
+	// the tasks listed by the project, so that undoing only adds these back
+	listed := []string{}
+	assignees := []string{}
+	for i, task := range tasks {
+		taskids[i] = task.Id.Hex()
+		if functions.Contains(project.Tasks, taskids[i]) {
+			listed = append(listed, taskids[i])
+		}
+		for _, assignee := range task.AssignedTo {
+			if !functions.Contains(assignees, assignee) {
+				assignees = append(assignees, assignee)
+			}
 		}
 	}
+
+	return runner.Run(ctx, func(ctx context.Context, saga *txn.Saga) error {
+		if err := saga.Do(ctx, func(ctx context.Context) error {
+			return taskController.TaskSoftDelete(ctx, taskids, projectid, now)
+		}, func(ctx context.Context) error {
+			return taskController.TaskRestore(ctx, taskids)
+		}); err != nil {
+			return err
+		}
+		if err := saga.Do(ctx, func(ctx context.Context) error {
+			return projectController.ProjectDeleteTasks(ctx, projectid, taskids)
+		}, func(ctx context.Context) error {
+			return projectController.ProjectAddTasks(ctx, projectid, listed)
+		}); err != nil {
+			return err
+		}
+		return saga.Do(ctx, func(ctx context.Context) error {
+			return userController.UsersRemoveTasks(ctx, assignees, taskids)
+		}, func(ctx context.Context) error {
+			for _, task := range tasks {
+				if err := userController.UsersAddTask(ctx, task.AssignedTo, task.Id.Hex(), false); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// Changes to a task, of which only those given are made.
+type taskChanges struct {
+	Name             *string   `bson:"name" json:"name"`
+	AddAssignedTo    *[]string `bson:"addAssignedTo" json:"addAssignedTo" doc:"userids, for project tasks"`
+	RemoveAssignedTo *[]string `bson:"removeAssignedTo" json:"removeAssignedTo" doc:"userids, for project tasks"`
+	Description      *string   `bson:"description" json:"description"`
+	Deadline         *string   `bson:"deadline" json:"deadline" doc:"ISO 8601"`
+	IsDone           *bool     `bson:"isDone" json:"isDone" doc:"moves project tasks to the terminal or initial state"`
+	Estimate         *int      `bson:"estimate" json:"estimate" doc:"in minutes"`
+	AddTags          *[]string `bson:"addTags" json:"addTags"`
+	RemoveTags       *[]string `bson:"removeTags" json:"removeTags"`
+}
+
+// Makes the changes to the task on behalf of the user, updating its assignees.
+// The workflow state of project tasks is kept in sync with isDone, and completing a recurring task creates its next instance.
+// If version is not nil, the changes are only made if the task is still at the version.
+func modifyTask(ctx context.Context, userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, task models.Task, version *int64, changes taskChanges, userid string) error {
+	if changes.Estimate != nil {
+		if msg, ok := isValidEstimate(*changes.Estimate); !ok {
+			return errs.Validation(msg)
+		}
+	}
+	project, err := projectController.ProjectOfTask(ctx, task)
+	if err != nil {
+		return err
+	}
+	if project != nil {
+		if err := projectWritable(*project); err != nil {
+			return err
+		}
+	}
+	taskid := task.Id.Hex()
+
+	// the assignees are retrieved first, so that nothing is changed if one does not exist or the task was modified
+	retrieveUsers := func(userids *[]string) ([]models.User, error) {
+		users := []models.User{}
+		if userids == nil {
+			return users, nil
+		}
+		for _, userid := range *userids {
+			user, err := userController.UserRetrieve(ctx, userid, "")
+			if err != nil {
+				return nil, errs.OrNotFound(err, "user does not exist")
+			}
+			users = append(users, user)
+		}
+		return users, nil
+	}
+	removed, err := retrieveUsers(changes.RemoveAssignedTo)
+	if err != nil {
+		return err
+	}
+	added, err := retrieveUsers(changes.AddAssignedTo)
+	if err != nil {
+		return err
+	}
+
+	if err := taskController.TaskModify(ctx, userid, task.Id, version, changes.Name, changes.Description, changes.Deadline, changes.IsDone, changes.Estimate, changes.AddAssignedTo, changes.RemoveAssignedTo, changes.AddTags, changes.RemoveTags); err != nil {
+		return err
+	}
+
+	// Delete users from task
+	for _, user := range removed {
+		delete(user.Tasks, taskid)
+		userController.UserModifyTask(ctx, &user)
+	}
+	// Add users to task
+	for _, user := range added {
+		user.Tasks[taskid] = false
+		userController.UserModifyTask(ctx, &user)
+	}
+
+	// Keep the workflow state of project tasks in sync with isDone
+	if changes.IsDone != nil && project != nil && task.IsDone != *changes.IsDone {
+		state := project.Settings.InitialState()
+		if *changes.IsDone {
+			state = project.Settings.TerminalState()
+		}
+		tasks := taskController.TaskMapToArray(ctx, project.Tasks)
+		// moving past the end of the column places the task at the bottom
+		if err := taskController.TaskMove(ctx, *project, tasks, taskid, state.Name, len(tasks)); err != nil {
+			return err
+		}
+	}
+
+	// Completing a recurring task creates its next instance
+	if changes.IsDone != nil && *changes.IsDone && task.Recurrence != nil {
+		task, err := taskController.TaskRetrieve(ctx, taskid)
+		if err != nil {
+			return err
+		}
+		if _, _, err := recurrence.Spawn(ctx, userController, projectController, taskController, task, time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // taskid: string, name: string, assignedTo: string[userid], description: string, deadline: string, isDone: bool
-func TaskModify(userController controllers.UserController, taskController controllers.TaskController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+func TaskModify(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, jwtParser *auth.JWTParser) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		_, _, ok := jwtParser.GetFromJWT(ctx)
+		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
-		type Query struct {
-			TaskId           string    `bson:"taskid" json:"taskid"`
-			Name             *string   `bson:"name" json:"name"`
-			AddAssignedTo    *[]string `bson:"addAssignedTo" json:"addAssignedTo"`
-			RemoveAssignedTo *[]string `bson:"removeAssignedTo" json:"removeAssignedTo"`
-			Description      *string   `bson:"description" json:"description"`
-			Deadline         *string   `bson:"deadline" json:"deadline"`
-			IsDone           *bool     `bson:"isDone" json:"isDone"`
-			AddTags          *[]string `bson:"addTags" json:"addTags"`
-			RemoveTags       *[]string `bson:"removeTags" json:"removeTags"`
-		}
-		var query Query
-		if err := ctx.BindJSON(&query); err != nil {
-			DisplayError(ctx, err.Error())
+		var query taskModifyBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
 			return
 		}
 		if query.TaskId == "" {
-			DisplayError(ctx, "Please provide taskid of task to modify")
+			Respond(ctx, errs.Validation("Please provide taskid of task to modify"))
+			return
+		}
+		if _, err := primitive.ObjectIDFromHex(query.TaskId); err != nil {
+			Respond(ctx, errs.Validation("invalid taskid"))
+			return
+		}
+		version, err := ifMatch(ctx)
+		if err != nil {
+			Respond(ctx, err)
 			return
 		}
+		task, err := taskController.TaskRetrieve(ctx, query.TaskId)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "task does not exist"))
+			return
+		}
+		if err := modifyTask(ctx, userController, projectController, taskController, task, version, query.taskChanges, id); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		publishTask(ctx, taskController, task.ProjectId, id, socket.ActivityTaskModified, query.TaskId)
+		ctx.JSON(http.StatusOK, emptyResponse{})
+	}
+}
 
-		taskid, err := primitive.ObjectIDFromHex(query.TaskId)
+// projectid: string, taskid: string, state: string, position: int
+// Moves a project task to a workflow state (column) at the given position, reordering the other tasks.
+func TaskMove(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query taskMoveBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		if query.ProjectId == "" || query.TaskId == "" || query.State == "" {
+			Respond(ctx, errs.Validation("please provide projectid, taskid and state"))
+			return
+		}
+		project, err := projectController.ProjectRetrieve(ctx, query.ProjectId)
 		if err != nil {
-			DisplayError(ctx, "invalid taskid")
+			Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+			return
+		}
+		if _, ok := project.Members[id]; !ok {
+			Respond(ctx, errs.Forbidden("you lack permissions"))
+			return
+		}
+		if !checkProjectWritable(ctx, project) {
+			return
+		}
+		state, ok := project.Settings.FindState(query.State)
+		if !ok {
+			Respond(ctx, errs.Invalid("state", "does not exist"))
+			return
+		}
+		tasks := taskController.TaskMapToArray(ctx, project.Tasks)
+		wasTerminal := false
+		for _, task := range tasks {
+			if task.Id.Hex() == query.TaskId {
+				previous, _ := project.Settings.FindState(project.Settings.TaskState(task))
+				wasTerminal = previous.IsTerminal
+			}
+		}
+		if err := taskController.TaskMove(ctx, project, tasks, query.TaskId, query.State, query.Position); err != nil {
+			Respond(ctx, err)
 			return
 		}
 
-		// Delete users from task
-		if query.RemoveAssignedTo != nil {
-			for _, userid := range *query.RemoveAssignedTo {
-				user, err := userController.UserRetrieve(ctx, userid, "")
-				if err == mongo.ErrNoDocuments {
-					DisplayError(ctx, "user does not exist")
-				} else if err != nil {
-					DisplayError(ctx, err.Error())
-				}
-				delete(user.Tasks, query.TaskId)
-				userController.UserModifyTask(ctx, &user)
+		// Completing a recurring task creates its next instance, which reordering it among the done tasks does not
+		if state.IsTerminal && !wasTerminal {
+			task, err := taskController.TaskRetrieve(ctx, query.TaskId)
+			if err != nil {
+				Respond(ctx, err)
+				return
+			}
+			if _, _, err := recurrence.Spawn(ctx, userController, projectController, taskController, task, time.Now()); err != nil {
+				Respond(ctx, err)
+				return
 			}
 		}
+		publishTask(ctx, taskController, query.ProjectId, id, socket.ActivityTaskModified, query.TaskId)
+		ctx.JSON(http.StatusOK, emptyResponse{})
+	}
+}
 
-		// Add users to task
-		if query.AddAssignedTo != nil {
-			for _, userid := range *query.AddAssignedTo {
-				user, err := userController.UserRetrieve(ctx, userid, "")
-				if err == mongo.ErrNoDocuments {
-					DisplayError(ctx, "user does not exist")
-				} else if err != nil {
-					DisplayError(ctx, err.Error())
-				}
-				user.Tasks[query.TaskId] = false
-				userController.UserModifyTask(ctx, &user)
+// taskid: string, name: string, description: string, addTags: string[], removeTags: string[], recurrence: Recurrence
+// Modifies every instance of the task's series that is not done yet.
+func TaskSeriesModify(projectController controllers.ProjectController, taskController controllers.TaskController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query taskSeriesModifyBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		task, err := taskController.TaskRetrieve(ctx, query.TaskId)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "task does not exist"))
+			return
+		}
+		if !canAccessTask(ctx, projectController, task, id) {
+			Respond(ctx, errs.Forbidden("you lack permissions"))
+			return
+		}
+		if !checkTaskWritable(ctx, projectController, task) {
+			return
+		}
+		if task.SeriesId == "" {
+			Respond(ctx, errs.Validation("task is not part of a series"))
+			return
+		}
+		if msg, ok := isValidRecurrence(query.Recurrence, task.Deadline); !ok {
+			Respond(ctx, errs.Validation(msg))
+			return
+		}
+		if query.Recurrence != nil && query.Recurrence.Day == 0 {
+			// keeps the day of the month the series started on, which the task's deadline may have moved from
+			if task.Recurrence != nil && task.Recurrence.Day != 0 {
+				query.Recurrence.Day = task.Recurrence.Day
+			} else {
+				query.Recurrence.Anchor(task.Deadline)
 			}
 		}
+		if err := taskController.TaskSeriesModify(ctx, task.SeriesId, query.Name, query.Description, query.AddTags, query.RemoveTags, query.Recurrence); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, emptyResponse{})
+	}
+}
 
-		taskController.TaskModify(ctx, taskid, query.Name, query.Description, query.Deadline, query.IsDone, query.AddAssignedTo, query.RemoveAssignedTo, query.AddTags, query.RemoveTags)
-		ctx.JSON(http.StatusOK, gin.H{})
+// taskid: string
+// Stops the task's series from creating further instances. Existing instances are kept.
+func TaskSeriesStop(projectController controllers.ProjectController, taskController controllers.TaskController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query taskIdBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		task, err := taskController.TaskRetrieve(ctx, query.TaskId)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "task does not exist"))
+			return
+		}
+		if !canAccessTask(ctx, projectController, task, id) {
+			Respond(ctx, errs.Forbidden("you lack permissions"))
+			return
+		}
+		if !checkTaskWritable(ctx, projectController, task) {
+			return
+		}
+		if err := taskController.TaskSeriesStop(ctx, task.SeriesId); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, emptyResponse{})
+	}
+}
+
+// Input parameters "taskid"
+// Returns the history of changes made to the task.
+func TaskGetActivity(projectController controllers.ProjectController, taskController controllers.TaskController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query taskIdQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		taskid := query.TaskId
+		task, err := taskController.TaskRetrieve(ctx, taskid)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "task does not exist"))
+			return
+		}
+		if !canAccessTask(ctx, projectController, task, id) {
+			Respond(ctx, errs.Forbidden("you lack permissions"))
+			return
+		}
+		activity, err := taskController.TaskActivity(ctx, taskid)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, activityResponse{Activity: activity})
+	}
+}
+
+func isValidTaskQuery(sort string, limit int) (string, bool) {
+	if sort != "" && !controllers.IsTaskSortField(sort) {
+		return "cannot sort on " + sort, false
+	} else if limit < 0 || limit > controllers.MaxTaskQueryLimit {
+		return fmt.Sprintf("limit must be between 1 and %v, or 0 for the default", controllers.MaxTaskQueryLimit), false
+	}
+	return "", true
+}
+
+// Filters of a task query, as given by the client.
+type taskQueryInput struct {
+	ProjectId    string   `bson:"projectid" json:"projectid"`
+	AssignedTo   []string `bson:"assignedTo" json:"assignedTo"`
+	Tags         []string `bson:"tags" json:"tags"`
+	DeadlineFrom string   `bson:"deadlineFrom" json:"deadlineFrom"`
+	DeadlineTo   string   `bson:"deadlineTo" json:"deadlineTo"`
+	IsDone       *bool    `bson:"isDone" json:"isDone"`
+	IsPersonal   *bool    `bson:"isPersonal" json:"isPersonal"`
+	Text         string   `bson:"text" json:"text"`
+	Sort         string   `bson:"sort" json:"sort"`
+	Limit        int      `bson:"limit" json:"limit"`
+	Cursor       string   `bson:"cursor" json:"cursor"`
+}
+
+// Validates the filters and converts them into a query for the user's tasks.
+func (input taskQueryInput) toTaskQuery(userid string) (controllers.TaskQuery, string, bool) {
+	query := controllers.TaskQuery{
+		UserId:     userid,
+		ProjectId:  input.ProjectId,
+		AssignedTo: input.AssignedTo,
+		Tags:       input.Tags,
+		IsDone:     input.IsDone,
+		IsPersonal: input.IsPersonal,
+		Text:       input.Text,
+		Sort:       input.Sort,
+		Limit:      input.Limit,
+		Cursor:     input.Cursor,
+	}
+	if msg, ok := isValidTaskQuery(input.Sort, input.Limit); !ok {
+		return query, msg, false
+	}
+	if input.DeadlineFrom != "" {
+		deadline, err := functions.StringToTime(input.DeadlineFrom)
+		if err != nil {
+			return query, "Please provide time in proper ISO8601 format", false
+		}
+		query.DeadlineFrom = &deadline
+	}
+	if input.DeadlineTo != "" {
+		deadline, err := functions.StringToTime(input.DeadlineTo)
+		if err != nil {
+			return query, "Please provide time in proper ISO8601 format", false
+		}
+		query.DeadlineTo = &deadline
+	}
+	return query, "", true
+}
+
+// Returns a page of the tasks of a project, or of the tasks assigned to the user if projectid is not given, that match the filters.
+func TaskQuery(projectController controllers.ProjectController, taskController controllers.TaskController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var input taskQueryInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		query, msg, ok := input.toTaskQuery(id)
+		if !ok {
+			Respond(ctx, errs.Validation(msg))
+			return
+		}
+
+		if query.ProjectId != "" {
+			project, err := projectController.ProjectRetrieve(ctx, query.ProjectId)
+			if err != nil {
+				Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+				return
+			}
+			if _, ok := project.Members[id]; !ok {
+				Respond(ctx, errs.Forbidden("you lack permissions"))
+				return
+			}
+			query.ProjectTasks = project.Tasks
+		}
+
+		tasks, cursor, err := taskController.TaskQuery(ctx, query)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, taskQueryResponse{Tasks: tasks, Cursor: cursor})
 	}
 }
 
@@ -238,30 +739,33 @@ func TaskGetAll(userController controllers.UserController, projectController con
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query optionalProjectIdQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
 			return
 		}
-		projectid := ctx.DefaultQuery("projectid", "")
+		projectid := query.ProjectId
 		var taskArr []models.Task
 
 		if projectid == "" {
 			user, err := userController.UserRetrieve(ctx, id, "")
-			if err == mongo.ErrNoDocuments {
-				DisplayError(ctx, "user does not exist")
-			} else if err != nil {
-				DisplayError(ctx, err.Error())
+			if err != nil {
+				Respond(ctx, errs.OrNotFound(err, "user does not exist"))
+				return
 			}
 			taskArr = taskController.TaskMapToArrayUser(ctx, user.Tasks)
 		} else {
 			project, err := projectController.ProjectRetrieve(ctx, projectid)
-			if err == mongo.ErrNoDocuments {
-				DisplayError(ctx, "project does not exist")
-			} else if err != nil {
-				DisplayError(ctx, err.Error())
+			if err != nil {
+				Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+				return
 			}
 			taskArr = taskController.TaskMapToArray(ctx, project.Tasks)
 		}
 
-		ctx.JSON(http.StatusOK, gin.H{"tasks": taskArr})
+		ctx.JSON(http.StatusOK, tasksResponse{Tasks: taskArr})
 	}
 }
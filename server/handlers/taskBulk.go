@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/functions"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/recurrence"
+	"github.com/OrgaNiUS/OrgaNiUS/server/socket"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// most tasks that a single bulk operation can change
+	maxBulkTasks = 500
+	// deadlines cannot be shifted by more than 10 years
+	maxShiftDays = 3650
+)
+
+func isValidBulkOperation(operation string, assignedTo, tags []string, days int) (string, bool) {
+	switch operation {
+	case controllers.TaskBulkMarkDone, controllers.TaskBulkDelete:
+	case controllers.TaskBulkReassign:
+		if len(assignedTo) == 0 {
+			return "please provide users to assign", false
+		}
+	case controllers.TaskBulkAddTags, controllers.TaskBulkRemoveTags:
+		if len(tags) == 0 {
+			return "please provide tags", false
+		}
+	case controllers.TaskBulkShiftDeadline:
+		if days == 0 {
+			return "please provide the number of days to shift by", false
+		} else if days > maxShiftDays || days < -maxShiftDays {
+			return "cannot shift deadlines by more than 10 years", false
+		}
+	default:
+		return "unknown operation " + operation, false
+	}
+	return "", true
+}
+
+// Checks whether the user can apply the operation to the task, returning why not if it cannot.
+// project is the project the task belongs to as found by ProjectOfTask, and nil for personal tasks.
+func canBulkModifyTask(project *models.Project, task models.Task, operation string, assignedTo []string, userid string) *errs.Error {
+	if task.IsPersonal {
+		if !functions.Contains(task.AssignedTo, userid) {
+			return errs.Forbidden("you lack permissions")
+		} else if operation == controllers.TaskBulkReassign {
+			return errs.Validation("personal tasks cannot be reassigned")
+		}
+		return nil
+	}
+	if project == nil {
+		return errs.NotFound("project does not exist")
+	}
+	role, ok := project.Members[userid]
+	if !ok {
+		return errs.Forbidden("you lack permissions")
+	} else if project.IsArchived {
+		return errs.Conflict("project is archived")
+	}
+	permissions := project.Settings.Roles[role]
+	switch operation {
+	case controllers.TaskBulkDelete:
+		if !permissions.IsAdmin && !permissions.RemoveTask {
+			return errs.Forbidden("you lack permissions to delete tasks")
+		}
+	case controllers.TaskBulkReassign:
+		if !permissions.IsAdmin && !permissions.CanAssignOthers {
+			return errs.Forbidden("you lack permissions to assign others")
+		}
+		for _, assignee := range assignedTo {
+			if _, ok := project.Members[assignee]; !ok {
+				return errs.Validation("assignees must be members of the project")
+			}
+		}
+	}
+	return nil
+}
+
+// Applies one operation to many tasks, given either by taskids or by a filter as in Task Query.
+// Permissions are checked for each task, and the result of each task is reported.
+func TaskBulk(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query taskBulkBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		if msg, ok := isValidBulkOperation(query.Operation, query.AssignedTo, query.Tags, query.Days); !ok {
+			Respond(ctx, errs.Validation(msg))
+			return
+		}
+		if (len(query.TaskIds) == 0) == (query.Filter == nil) {
+			Respond(ctx, errs.Validation("provide either taskids or a filter"))
+			return
+		}
+		if len(query.TaskIds) > maxBulkTasks {
+			Respond(ctx, errs.Validation(fmt.Sprintf("cannot change more than %v tasks at once", maxBulkTasks)))
+			return
+		}
+
+		// find the tasks, with a result for each in the order they were given
+		results := []taskBulkResult{}
+		tasks := []models.Task{}
+		// the index in results of each task
+		slots := []int{}
+		if query.Filter != nil {
+			taskQuery, msg, ok := query.Filter.toTaskQuery(id)
+			if !ok {
+				Respond(ctx, errs.Validation(msg))
+				return
+			}
+			if taskQuery.ProjectId != "" {
+				project, err := projectController.ProjectRetrieve(ctx, taskQuery.ProjectId)
+				if err != nil {
+					Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+					return
+				}
+				if _, ok := project.Members[id]; !ok {
+					Respond(ctx, errs.Forbidden("you lack permissions"))
+					return
+				}
+				taskQuery.ProjectTasks = project.Tasks
+			}
+			taskQuery.Limit = controllers.MaxTaskQueryLimit
+			for {
+				page, cursor, err := taskController.TaskQuery(ctx, taskQuery)
+				if err != nil {
+					Respond(ctx, err)
+					return
+				}
+				tasks = append(tasks, page...)
+				if len(tasks) > maxBulkTasks {
+					Respond(ctx, errs.Validation(fmt.Sprintf("filter matches more than %v tasks", maxBulkTasks)))
+					return
+				}
+				if cursor == "" {
+					break
+				}
+				taskQuery.Cursor = cursor
+			}
+			for _, task := range tasks {
+				slots = append(slots, len(results))
+				results = append(results, taskBulkResult{TaskId: task.Id.Hex()})
+			}
+		} else {
+			found := map[string]models.Task{}
+			for _, task := range taskController.TaskMapToArray(ctx, query.TaskIds) {
+				found[task.Id.Hex()] = task
+			}
+			for _, taskid := range query.TaskIds {
+				if task, ok := found[taskid]; ok {
+					tasks = append(tasks, task)
+					slots = append(slots, len(results))
+					results = append(results, taskBulkResult{TaskId: taskid})
+					delete(found, taskid) // ignore duplicates
+				} else {
+					results = append(results, taskBulkResult{TaskId: taskid, Error: "task does not exist", Code: errs.CodeNotFound})
+				}
+			}
+		}
+
+		// check permissions of each task, against the project it belongs to
+		projects := map[string]*models.Project{}
+		// the project of each task by taskid, nil for personal tasks
+		owners := map[string]*models.Project{}
+		permitted := []models.Task{}
+		// the index in results of each permitted task
+		permittedSlots := []int{}
+		for i, task := range tasks {
+			slot := slots[i]
+			var project *models.Project
+			if !task.IsPersonal {
+				var ok bool
+				// tasks created before they recorded their projectid are found through the tasks of the projects
+				if project, ok = projects[task.ProjectId]; !ok || task.ProjectId == "" {
+					project, _ = projectController.ProjectOfTask(ctx, task)
+					if task.ProjectId != "" {
+						projects[task.ProjectId] = project
+					}
+				}
+				if project == nil {
+					results[slot].Error, results[slot].Code = "project does not exist", errs.CodeNotFound
+					continue
+				}
+			}
+			owners[task.Id.Hex()] = project
+			if err := canBulkModifyTask(project, task, query.Operation, query.AssignedTo, id); err != nil {
+				results[slot].Error, results[slot].Code = err.Message, err.Code
+				continue
+			}
+			permitted = append(permitted, task)
+			permittedSlots = append(permittedSlots, slot)
+		}
+
+		operation := controllers.TaskBulkOperation{
+			Type:       query.Operation,
+			IsDone:     query.IsDone,
+			AssignedTo: query.AssignedTo,
+			Tags:       query.Tags,
+			Days:       query.Days,
+		}
+		if query.Operation == controllers.TaskBulkMarkDone {
+			// project tasks go to the bottom of the first terminal state (when done) or the initial state (when not done)
+			operation.Placements = map[string]controllers.TaskPlacement{}
+			columns := map[string]int{}
+			for _, task := range permitted {
+				project := owners[task.Id.Hex()]
+				if project == nil {
+					continue
+				}
+				if current, _ := project.Settings.FindState(project.Settings.TaskState(task)); current.IsTerminal == query.IsDone {
+					continue
+				}
+				state := project.Settings.InitialState()
+				if query.IsDone {
+					state = project.Settings.TerminalState()
+				}
+				projectid := project.Id.Hex()
+				key := projectid + "/" + state.Name
+				if _, ok := columns[key]; !ok {
+					columns[key] = len(controllers.TaskColumn(project.Settings, taskController.TaskMapToArray(ctx, project.Tasks), state.Name))
+				}
+				operation.Placements[task.Id.Hex()] = controllers.TaskPlacement{ProjectId: projectid, State: state.Name, Position: columns[key]}
+				columns[key]++
+			}
+		}
+
+		if query.Operation == controllers.TaskBulkDelete {
+			operation.ProjectIds = map[string]string{}
+			for _, task := range permitted {
+				if project := owners[task.Id.Hex()]; project != nil {
+					operation.ProjectIds[task.Id.Hex()] = project.Id.Hex()
+				}
+			}
+		}
+
+		failures := taskController.TaskBulk(ctx, id, permitted, operation)
+
+		// keep references to the changed tasks consistent
+		changed := []models.Task{}
+		for i, task := range permitted {
+			slot := permittedSlots[i]
+			if failures[i] != nil {
+				err := errs.From(failures[i])
+				if err.Code == errs.CodeInternal {
+					slog.ErrorContext(ctx, "internal error in bulk change", "task", task.Id.Hex(), "error", failures[i])
+				}
+				results[slot].Error, results[slot].Code = err.Message, err.Code
+				continue
+			}
+			results[slot].Ok = true
+			changed = append(changed, task)
+		}
+		switch query.Operation {
+		case controllers.TaskBulkMarkDone:
+			if !query.IsDone {
+				break
+			}
+			// completing a recurring task creates its next instance
+			now := time.Now()
+			for _, task := range changed {
+				if task.Recurrence == nil {
+					continue
+				}
+				task.IsDone = true
+				if _, _, err := recurrence.Spawn(ctx, userController, projectController, taskController, task, now); err != nil {
+					slog.ErrorContext(ctx, "failed to create next instance of task", "taskid", task.Id.Hex(), "error", err)
+				}
+			}
+		case controllers.TaskBulkReassign:
+			for _, task := range changed {
+				taskid := task.Id.Hex()
+				added, removed := functions.Diff(task.AssignedTo, query.AssignedTo)
+				if len(removed) > 0 {
+					if err := userController.UsersRemoveTasks(ctx, removed, []string{taskid}); err != nil {
+						slog.ErrorContext(ctx, "failed to remove reassigned task from users", "taskid", taskid, "error", err)
+					}
+				}
+				if len(added) > 0 {
+					if err := userController.UsersAddTask(ctx, added, taskid, false); err != nil {
+						slog.ErrorContext(ctx, "failed to add reassigned task to users", "taskid", taskid, "error", err)
+					}
+				}
+			}
+		case controllers.TaskBulkDelete:
+			// the tasks are in the trash, so only the references to them are removed
+			byProject := map[string][]string{}
+			for _, task := range changed {
+				taskid := task.Id.Hex()
+				if err := userController.UsersRemoveTasks(ctx, task.AssignedTo, []string{taskid}); err != nil {
+					slog.ErrorContext(ctx, "failed to remove deleted task from users", "taskid", taskid, "error", err)
+				}
+				if project := owners[taskid]; project != nil {
+					projectid := project.Id.Hex()
+					byProject[projectid] = append(byProject[projectid], taskid)
+				}
+			}
+			for projectid, taskids := range byProject {
+				if err := projectController.ProjectDeleteTasks(ctx, projectid, taskids); err != nil {
+					slog.ErrorContext(ctx, "failed to remove deleted tasks from project", "projectid", projectid, "error", err)
+				}
+				publishActivity(ctx, projectid, id, socket.ActivityTaskDeleted, socket.DeletedPayload{Ids: taskids})
+			}
+		}
+		if query.Operation != controllers.TaskBulkDelete {
+			for _, task := range changed {
+				if project := owners[task.Id.Hex()]; project != nil {
+					publishTask(ctx, taskController, project.Id.Hex(), id, socket.ActivityTaskModified, task.Id.Hex())
+				}
+			}
+		}
+
+		ctx.JSON(http.StatusOK, taskBulkResponse{Results: results})
+	}
+}
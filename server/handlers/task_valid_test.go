@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+)
+
+func TestIsValidTaskQuery(t *testing.T) {
+	type Input struct {
+		sort  string
+		limit int
+	}
+
+	tests := map[Input]*Result{
+		{"", 0}:               {"", true},
+		{"deadline", 10}:      {"", true},
+		{"-creationTime", 10}: {"", true},
+		{"estimate", controllers.MaxTaskQueryLimit}: {"", true},
+
+		{"tags", 10}:       {"cannot sort on tags", false},
+		{"--deadline", 10}: {"cannot sort on --deadline", false},
+		{"deadline", -1}:   {"limit must be between 1 and 200, or 0 for the default", false},
+		{"deadline", controllers.MaxTaskQueryLimit + 1}: {"limit must be between 1 and 200, or 0 for the default", false},
+	}
+
+	for test, expected := range tests {
+		message, ok := isValidTaskQuery(test.sort, test.limit)
+		if message != expected.message || ok != expected.ok {
+			t.Errorf("Test for %v", test)
+			t.Errorf("Expected %v but got {%v %v}", *expected, message, ok)
+		}
+	}
+}
+
+func TestIsValidBulkOperation(t *testing.T) {
+	type Input struct {
+		operation  string
+		assignedTo int
+		tags       int
+		days       int
+	}
+
+	tests := map[Input]*Result{
+		{controllers.TaskBulkMarkDone, 0, 0, 0}:       {"", true},
+		{controllers.TaskBulkDelete, 0, 0, 0}:         {"", true},
+		{controllers.TaskBulkReassign, 1, 0, 0}:       {"", true},
+		{controllers.TaskBulkAddTags, 0, 2, 0}:        {"", true},
+		{controllers.TaskBulkRemoveTags, 0, 1, 0}:     {"", true},
+		{controllers.TaskBulkShiftDeadline, 0, 0, -7}: {"", true},
+
+		{"archive", 0, 0, 0}:                            {"unknown operation archive", false},
+		{controllers.TaskBulkReassign, 0, 0, 0}:         {"please provide users to assign", false},
+		{controllers.TaskBulkAddTags, 0, 0, 0}:          {"please provide tags", false},
+		{controllers.TaskBulkShiftDeadline, 0, 0, 0}:    {"please provide the number of days to shift by", false},
+		{controllers.TaskBulkShiftDeadline, 0, 0, 4000}: {"cannot shift deadlines by more than 10 years", false},
+	}
+
+	for test, expected := range tests {
+		message, ok := isValidBulkOperation(test.operation, make([]string, test.assignedTo), make([]string, test.tags), test.days)
+		if message != expected.message || ok != expected.ok {
+			t.Errorf("Test for %v", test)
+			t.Errorf("Expected %v but got {%v %v}", *expected, message, ok)
+		}
+	}
+}
+
+func TestCanBulkModifyTask(t *testing.T) {
+	project := models.Project{
+		Members:  map[string]string{"admin": "admin", "member": "member"},
+		Settings: models.DefaultSettings(),
+	}
+	archived := project
+	archived.IsArchived = true
+	personal := models.Task{AssignedTo: []string{"member"}, IsPersonal: true}
+	projectTask := models.Task{AssignedTo: []string{"admin"}, ProjectId: "project"}
+
+	type Input struct {
+		project    *models.Project
+		task       *models.Task
+		operation  string
+		assignedTo string
+		userid     string
+	}
+
+	tests := map[Input]*Result{
+		{nil, &personal, controllers.TaskBulkMarkDone, "", "member"}:        {"", true},
+		{nil, &personal, controllers.TaskBulkMarkDone, "", "admin"}:         {"you lack permissions", false},
+		{nil, &personal, controllers.TaskBulkReassign, "admin", "member"}:   {"personal tasks cannot be reassigned", false},
+		{nil, &projectTask, controllers.TaskBulkAddTags, "", "admin"}:       {"project does not exist", false},
+		{&project, &projectTask, controllers.TaskBulkAddTags, "", "member"}: {"", true},
+		{&project, &projectTask, controllers.TaskBulkAddTags, "", "other"}:  {"you lack permissions", false},
+		{&project, &projectTask, controllers.TaskBulkDelete, "", "member"}:  {"", true},
+		// members cannot assign others by default
+		{&project, &projectTask, controllers.TaskBulkReassign, "member", "member"}: {"you lack permissions to assign others", false},
+		{&project, &projectTask, controllers.TaskBulkReassign, "member", "admin"}:  {"", true},
+		{&project, &projectTask, controllers.TaskBulkReassign, "other", "admin"}:   {"assignees must be members of the project", false},
+		// archived projects are read-only, even for admins
+		{&archived, &projectTask, controllers.TaskBulkAddTags, "", "admin"}: {"project is archived", false},
+	}
+
+	for test, expected := range tests {
+		message, ok := "", true
+		if err := canBulkModifyTask(test.project, *test.task, test.operation, []string{test.assignedTo}, test.userid); err != nil {
+			message, ok = err.Message, false
+		}
+		if message != expected.message || ok != expected.ok {
+			t.Errorf("Test for %v %v by %v", test.operation, test.task, test.userid)
+			t.Errorf("Expected %v but got {%v %v}", *expected, message, ok)
+		}
+	}
+}
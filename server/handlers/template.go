@@ -0,0 +1,433 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/functions"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/socket"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func isValidTaskTemplate(template models.TaskTemplate) (string, bool) {
+	if template.Name == "" {
+		return "please provide a name", false
+	}
+	if msg, ok := isValidEstimate(template.Estimate); !ok {
+		return msg, false
+	}
+	var deadline time.Time
+	if template.DeadlineOffset != nil {
+		if *template.DeadlineOffset < 0 {
+			return "deadlineOffset cannot be negative", false
+		}
+		// any deadline will do, as the recurrence does not end
+		deadline = time.Now()
+	}
+	return isValidRecurrence(template.Recurrence, deadline)
+}
+
+// Parses an optional start date, defaulting to now.
+func parseStart(start string) (time.Time, bool) {
+	if start == "" {
+		return time.Now(), true
+	}
+	parsed, err := functions.StringToTime(start)
+	return parsed, err == nil
+}
+
+// Converts a project into a template, with task deadlines relative to start.
+// Only the latest instance of each recurring task is kept.
+func newProjectTemplate(project models.Project, tasks []models.Task, start time.Time) models.ProjectTemplate {
+	settings := models.ProjectSettings{
+		Roles:       project.Settings.Roles,
+		States:      project.Settings.WorkflowStates(),
+		Attachments: project.Settings.AttachmentLimits(),
+	}
+	template := models.ProjectTemplate{
+		Name:        project.Name,
+		Description: project.Description,
+		Settings:    settings,
+		Tasks:       []models.TaskTemplate{},
+	}
+	for _, task := range tasks {
+		if task.Recurrence != nil && task.NextCreated {
+			continue
+		}
+		template.Tasks = append(template.Tasks, models.NewTaskTemplate(task, start))
+	}
+	// earliest deadline first, tasks without deadlines last
+	sort.SliceStable(template.Tasks, func(i, j int) bool {
+		a, b := template.Tasks[i].DeadlineOffset, template.Tasks[j].DeadlineOffset
+		if a == nil || b == nil {
+			return a != nil
+		}
+		return *a < *b
+	})
+	return template
+}
+
+// projectid: string, name: string, start: string
+// Saves a project as a template for the user. Task deadlines are saved relative to start, which defaults to the creation time of the project.
+func ProjectTemplateCreate(projectController controllers.ProjectController, taskController controllers.TaskController, templateController controllers.TemplateController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query projectTemplateCreateBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		project, err := projectController.ProjectRetrieve(ctx, query.ProjectId)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+			return
+		}
+		if _, ok := project.Members[id]; !ok {
+			Respond(ctx, errs.Forbidden("you lack permissions"))
+			return
+		}
+		start := project.CreationTime
+		if query.Start != "" {
+			if start, ok = parseStart(query.Start); !ok {
+				Respond(ctx, errs.Validation("Please provide time in proper ISO8601 format"))
+				return
+			}
+		}
+
+		template := newProjectTemplate(project, taskController.TaskMapToArray(ctx, project.Tasks), start)
+		template.Owner = id
+		if query.Name != "" {
+			template.Name = query.Name
+		}
+		if err := templateController.ProjectTemplateCreate(ctx, &template); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusCreated, templateIdResponse{TemplateId: template.Id.Hex()})
+	}
+}
+
+// Returns all project templates of the user.
+func ProjectTemplateGetAll(templateController controllers.TemplateController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		templates, err := templateController.ProjectTemplateGetAll(ctx, id)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, projectTemplatesResponse{Templates: templates})
+	}
+}
+
+// templateid: string, name: string, description: string, start: string
+// Creates a new project from a template, with task deadlines rebased on start (defaults to now).
+func ProjectTemplateUse(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, templateController controllers.TemplateController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query projectTemplateUseBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		if msg, ok := isValidProjectName(query.Name); !ok {
+			Respond(ctx, errs.Validation(msg))
+			return
+		}
+		start, ok := parseStart(query.Start)
+		if !ok {
+			Respond(ctx, errs.Validation("Please provide time in proper ISO8601 format"))
+			return
+		}
+		template, err := templateController.ProjectTemplateRetrieve(ctx, query.TemplateId)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "template does not exist"))
+			return
+		}
+		if template.Owner != id {
+			Respond(ctx, errs.Forbidden("you lack permissions"))
+			return
+		}
+
+		project := models.Project{
+			Name:        query.Name,
+			Description: template.Description,
+		}
+		if query.Description != nil {
+			project.Description = *query.Description
+		}
+		if err := projectController.ProjectCreate(ctx, &project, id); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		projectid := project.Id.Hex()
+		userController.UsersAddProject(ctx, []string{id}, projectid)
+
+		// the creator is always an admin
+		settings := template.Settings
+		if settings.Roles == nil {
+			settings.Roles = map[string]models.Permissions{}
+		}
+		settings.Roles["admin"] = models.Permissions{IsAdmin: true}
+		if err := projectController.ProjectModifySettings(ctx, project.Id, settings); err != nil {
+			Respond(ctx, err)
+			return
+		}
+
+		// tasks start unassigned at the bottom of the initial workflow state
+		taskids := []string{}
+		for _, taskTemplate := range template.Tasks {
+			task := taskTemplate.Instantiate(start)
+			task.AssignedTo = []string{}
+			task.ProjectId = projectid
+			task.State = settings.InitialState().Name
+			task.Position = len(taskids)
+			if err := taskController.TaskCreate(ctx, &task); err != nil {
+				Respond(ctx, err)
+				return
+			}
+			taskids = append(taskids, task.Id.Hex())
+		}
+		if len(taskids) > 0 {
+			projectController.ProjectAddTasks(ctx, projectid, taskids)
+		}
+
+		ctx.JSON(http.StatusCreated, projectIdResponse{ProjectId: projectid})
+	}
+}
+
+// Input parameters "templateid"
+func ProjectTemplateDelete(templateController controllers.TemplateController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query templateIdQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		template, err := templateController.ProjectTemplateRetrieve(ctx, query.TemplateId)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "template does not exist"))
+			return
+		}
+		if template.Owner != id {
+			Respond(ctx, errs.Forbidden("you lack permissions"))
+			return
+		}
+		if err := templateController.ProjectTemplateDelete(ctx, template); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, emptyResponse{})
+	}
+}
+
+// Retrieves a project in which the user can add tasks, displaying an error otherwise.
+func retrieveProjectForNewTask(ctx *gin.Context, projectController controllers.ProjectController, projectid, userid string) (models.Project, bool) {
+	project, err := projectController.ProjectRetrieve(ctx, projectid)
+	if err != nil {
+		Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+		return project, false
+	}
+	role, ok := project.Members[userid]
+	if permissions := project.Settings.Roles[role]; !ok || (!permissions.IsAdmin && !permissions.AddTask) {
+		Respond(ctx, errs.Forbidden("you lack permissions"))
+		return project, false
+	}
+	if !checkProjectWritable(ctx, project) {
+		return project, false
+	}
+	return project, true
+}
+
+// projectid: string, and either taskid: string to save an existing task, or the fields of a TaskTemplate
+// Saves a reusable task within a project.
+func TaskTemplateCreate(projectController controllers.ProjectController, taskController controllers.TaskController, templateController controllers.TemplateController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query taskTemplateCreateBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		if _, ok := retrieveProjectForNewTask(ctx, projectController, query.ProjectId, id); !ok {
+			return
+		}
+		template := query.TaskTemplate
+		if query.TaskId != "" {
+			task, err := taskController.TaskRetrieve(ctx, query.TaskId)
+			if err != nil || task.ProjectId != query.ProjectId {
+				Respond(ctx, errs.NotFound("task does not exist"))
+				return
+			}
+			// the deadline is kept relative to when the task was created
+			template = models.NewTaskTemplate(task, task.CreationTime)
+			if template.DeadlineOffset != nil && *template.DeadlineOffset < 0 {
+				zero := 0
+				template.DeadlineOffset = &zero
+			}
+		}
+		template.Id = primitive.NilObjectID
+		template.ProjectId = query.ProjectId
+		template.Creator = id
+		if template.Tags == nil {
+			template.Tags = []string{}
+		}
+		if msg, ok := isValidTaskTemplate(template); !ok {
+			Respond(ctx, errs.Validation(msg))
+			return
+		}
+		if err := templateController.TaskTemplateCreate(ctx, &template); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusCreated, templateIdResponse{TemplateId: template.Id.Hex()})
+	}
+}
+
+// Input parameters "projectid"
+func TaskTemplateGetAll(projectController controllers.ProjectController, templateController controllers.TemplateController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query projectIdQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		project, err := projectController.ProjectRetrieve(ctx, query.ProjectId)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+			return
+		}
+		if _, ok := project.Members[id]; !ok {
+			Respond(ctx, errs.Forbidden("you lack permissions"))
+			return
+		}
+		templates, err := templateController.TaskTemplateGetAll(ctx, query.ProjectId)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, taskTemplatesResponse{Templates: templates})
+	}
+}
+
+// templateid: string, start: string, assignedTo: string[]
+// Creates a task in the project from a task template, with its deadline rebased on start (defaults to now).
+func TaskTemplateUse(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, templateController controllers.TemplateController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query taskTemplateUseBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		start, ok := parseStart(query.Start)
+		if !ok {
+			Respond(ctx, errs.Validation("Please provide time in proper ISO8601 format"))
+			return
+		}
+		template, err := templateController.TaskTemplateRetrieve(ctx, query.TemplateId)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "template does not exist"))
+			return
+		}
+		project, ok := retrieveProjectForNewTask(ctx, projectController, template.ProjectId, id)
+		if !ok {
+			return
+		}
+		for _, userid := range query.AssignedTo {
+			if _, ok := project.Members[userid]; !ok {
+				Respond(ctx, errs.Validation("assignees must be members of the project"))
+				return
+			}
+		}
+
+		// new tasks go to the bottom of the project's initial workflow state
+		task := template.Instantiate(start)
+		task.AssignedTo = append([]string{}, query.AssignedTo...)
+		task.ProjectId = template.ProjectId
+		task.State = project.Settings.InitialState().Name
+		task.Position = len(controllers.TaskColumn(project.Settings, taskController.TaskMapToArray(ctx, project.Tasks), task.State))
+		if err := taskController.TaskCreate(ctx, &task); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		taskid := task.Id.Hex()
+		if len(task.AssignedTo) > 0 {
+			userController.UsersAddTask(ctx, task.AssignedTo, taskid, false)
+		}
+		projectController.ProjectAddTasks(ctx, task.ProjectId, []string{taskid})
+		publishActivity(ctx, task.ProjectId, id, socket.ActivityTaskCreated, socket.TaskPayload{Task: task})
+
+		ctx.JSON(http.StatusCreated, taskIdResponse{TaskId: taskid})
+	}
+}
+
+// Input parameters "templateid"
+// Only the creator of the template or an admin of the project can delete it.
+func TaskTemplateDelete(projectController controllers.ProjectController, templateController controllers.TemplateController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query templateIdQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		template, err := templateController.TaskTemplateRetrieve(ctx, query.TemplateId)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "template does not exist"))
+			return
+		}
+		if template.Creator != id {
+			project, err := projectController.ProjectRetrieve(ctx, template.ProjectId)
+			if err != nil || !project.Settings.Roles[project.Members[id]].IsAdmin {
+				Respond(ctx, errs.Forbidden("you lack permissions"))
+				return
+			}
+		}
+		if err := templateController.TaskTemplateDelete(ctx, template); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, emptyResponse{})
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+)
+
+func TestIsValidTaskTemplate(t *testing.T) {
+	offset := 60
+	negative := -1
+	weekly := &models.Recurrence{Frequency: models.RecurWeekly, Interval: 1}
+
+	tests := map[*models.TaskTemplate]*Result{
+		{Name: "standup"}: {"", true},
+		{Name: "standup", DeadlineOffset: &offset, Recurrence: weekly}: {"", true},
+
+		{}:                              {"please provide a name", false},
+		{Name: "standup", Estimate: -5}: {"estimate cannot be negative", false},
+		{Name: "standup", DeadlineOffset: &negative}: {"deadlineOffset cannot be negative", false},
+		{Name: "standup", Recurrence: weekly}:        {"recurring tasks require a deadline", false},
+	}
+
+	for test, expected := range tests {
+		message, ok := isValidTaskTemplate(*test)
+		if message != expected.message || ok != expected.ok {
+			t.Errorf("Test for %v", *test)
+			t.Errorf("Expected %v but got {%v %v}", *expected, message, ok)
+		}
+	}
+}
+
+func TestNewProjectTemplate(t *testing.T) {
+	start := time.Date(2022, 1, 10, 0, 0, 0, 0, time.UTC)
+	project := models.Project{Name: "CS2103 Team Project", Settings: models.DefaultSettings()}
+	weekly := &models.Recurrence{Frequency: models.RecurWeekly, Interval: 1}
+	tasks := []models.Task{
+		{Name: "someday"},
+		{Name: "final", Deadline: start.AddDate(0, 3, 0)},
+		{Name: "standup", Deadline: start.AddDate(0, 0, 1), Recurrence: weekly, NextCreated: true},
+		{Name: "standup", Deadline: start.AddDate(0, 0, 8), Recurrence: weekly},
+		{Name: "kickoff", Deadline: start.AddDate(0, 0, 2)},
+	}
+
+	template := newProjectTemplate(project, tasks, start)
+
+	names := []string{}
+	for _, task := range template.Tasks {
+		names = append(names, task.Name)
+	}
+	expected := []string{"kickoff", "standup", "final", "someday"}
+	if len(names) != len(expected) {
+		t.Fatalf("Expected tasks %v but got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("Expected tasks %v but got %v", expected, names)
+		}
+	}
+	if len(template.Settings.States) != len(models.DefaultStates()) || template.Settings.Roles["member"] != project.Settings.Roles["member"] {
+		t.Errorf("Expected settings to be kept but got %v", template.Settings)
+	}
+}
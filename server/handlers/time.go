@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/functions"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// a task cannot be estimated to take more than a year
+	maxEstimate = 365 * 24 * 60
+	// a single manual entry cannot be longer than a day
+	maxTimeEntry = 24 * time.Hour
+)
+
+// Estimates are in minutes.
+func isValidEstimate(estimate int) (string, bool) {
+	if estimate < 0 {
+		return "estimate cannot be negative", false
+	} else if estimate > maxEstimate {
+		return "estimate is too large", false
+	}
+	return "", true
+}
+
+func isValidTimeEntry(start, end, now time.Time) (string, bool) {
+	if start.IsZero() || end.IsZero() {
+		return "please provide both start and end", false
+	} else if !end.After(start) {
+		return "end must be after start", false
+	} else if end.Sub(start) > maxTimeEntry {
+		return "time entry cannot be longer than a day", false
+	} else if end.After(now) {
+		return "cannot log time in the future", false
+	}
+	return "", true
+}
+
+// Prefixes cells that spreadsheets would evaluate as formulas with a quote, so that they are shown as text.
+func csvCell(cell string) string {
+	if cell != "" && strings.ContainsAny(cell[:1], "=+-@\t\r") {
+		return "'" + cell
+	}
+	return cell
+}
+
+// Retrieves a task that the user can access, displaying an error otherwise.
+func retrieveAccessibleTask(ctx *gin.Context, projectController controllers.ProjectController, taskController controllers.TaskController, taskid, userid string) (models.Task, bool) {
+	task, err := taskController.TaskRetrieve(ctx, taskid)
+	if err != nil {
+		Respond(ctx, errs.OrNotFound(err, "task does not exist"))
+		return task, false
+	}
+	if !canAccessTask(ctx, projectController, task, userid) {
+		Respond(ctx, errs.Forbidden("you lack permissions"))
+		return task, false
+	}
+	return task, true
+}
+
+// taskid: string
+// Starts a timer on the task. Each user can only have one running timer.
+func TaskTimerStart(projectController controllers.ProjectController, taskController controllers.TaskController, timeEntryController controllers.TimeEntryController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query taskIdBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		task, ok := retrieveAccessibleTask(ctx, projectController, taskController, query.TaskId, id)
+		if !ok || !checkTaskWritable(ctx, projectController, task) {
+			return
+		}
+		entry := models.TimeEntry{
+			TaskId:    query.TaskId,
+			ProjectId: task.ProjectId,
+			UserId:    id,
+		}
+		if err := timeEntryController.TimeEntryStart(ctx, &entry); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusCreated, entryResponse{Entry: &entry})
+	}
+}
+
+// Stops the running timer of the user.
+func TaskTimerStop(timeEntryController controllers.TimeEntryController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		entry, err := timeEntryController.TimeEntryStop(ctx, id)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "no timer is running"))
+			return
+		}
+		ctx.JSON(http.StatusOK, entryResponse{Entry: &entry})
+	}
+}
+
+// Returns the running timer of the user, if any.
+func TaskTimerGet(timeEntryController controllers.TimeEntryController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		entry, err := timeEntryController.TimeEntryRunning(ctx, id)
+		if err == mongo.ErrNoDocuments {
+			ctx.JSON(http.StatusOK, entryResponse{})
+			return
+		} else if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, entryResponse{Entry: &entry})
+	}
+}
+
+// taskid: string, start: string, end: string, note: string
+// Logs time on the task that was not tracked with a timer.
+func TaskTimeAdd(projectController controllers.ProjectController, taskController controllers.TaskController, timeEntryController controllers.TimeEntryController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query timeAddBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		start, err := functions.StringToTime(query.Start)
+		if err != nil {
+			Respond(ctx, errs.Validation("Please provide time in proper ISO8601 format"))
+			return
+		}
+		end, err := functions.StringToTime(query.End)
+		if err != nil {
+			Respond(ctx, errs.Validation("Please provide time in proper ISO8601 format"))
+			return
+		}
+		if msg, ok := isValidTimeEntry(start, end, time.Now()); !ok {
+			Respond(ctx, errs.Validation(msg))
+			return
+		}
+		task, ok := retrieveAccessibleTask(ctx, projectController, taskController, query.TaskId, id)
+		if !ok || !checkTaskWritable(ctx, projectController, task) {
+			return
+		}
+		entry := models.TimeEntry{
+			TaskId:    query.TaskId,
+			ProjectId: task.ProjectId,
+			UserId:    id,
+			Start:     start,
+			End:       end,
+			Note:      query.Note,
+		}
+		if err := timeEntryController.TimeEntryCreate(ctx, &entry); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusCreated, entryResponse{Entry: &entry})
+	}
+}
+
+// Input parameters "taskid"
+func TaskTimeGetAll(projectController controllers.ProjectController, taskController controllers.TaskController, timeEntryController controllers.TimeEntryController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query taskIdQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		taskid := query.TaskId
+		if _, ok := retrieveAccessibleTask(ctx, projectController, taskController, taskid, id); !ok {
+			return
+		}
+		entries, err := timeEntryController.TimeEntryGetAll(ctx, taskid)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, entriesResponse{Entries: entries})
+	}
+}
+
+// Input parameters "entryid"
+// Users can only delete their own time entries.
+func TaskTimeDelete(timeEntryController controllers.TimeEntryController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query entryIdQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		entry, err := timeEntryController.TimeEntryRetrieve(ctx, query.EntryId)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "time entry does not exist"))
+			return
+		}
+		if entry.UserId != id {
+			Respond(ctx, errs.Forbidden("you lack permissions"))
+			return
+		}
+		if err := timeEntryController.TimeEntryDelete(ctx, entry); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, emptyResponse{})
+	}
+}
+
+// Input parameters "projectid", and optionally "from", "to" and "format"
+// Responds with the time logged in the project aggregated by member, tag and week, as JSON or as a CSV file.
+func ProjectTimeReport(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, timeEntryController controllers.TimeEntryController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query timeReportQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		projectid, format := query.ProjectId, query.Format
+		if format == "" {
+			format = "json"
+		}
+		if format != "json" && format != "csv" {
+			Respond(ctx, errs.Validation("format must be json or csv"))
+			return
+		}
+		var from, to time.Time
+		var err error
+		if s := query.From; s != "" {
+			if from, err = functions.StringToTime(s); err != nil {
+				Respond(ctx, errs.Validation("Please provide time in proper ISO8601 format"))
+				return
+			}
+		}
+		if s := query.To; s != "" {
+			if to, err = functions.StringToTime(s); err != nil {
+				Respond(ctx, errs.Validation("Please provide time in proper ISO8601 format"))
+				return
+			}
+		}
+
+		project, err := projectController.ProjectRetrieve(ctx, projectid)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+			return
+		}
+		if _, ok := project.Members[id]; !ok {
+			Respond(ctx, errs.Forbidden("you lack permissions"))
+			return
+		}
+
+		entries, err := timeEntryController.TimeEntryGetByProject(ctx, project, from, to)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		tasks := taskController.TaskMapToArray(ctx, project.Tasks)
+		report := controllers.TimeReport(projectid, tasks, entries, time.Now())
+		for i, row := range report.Members {
+			if user, err := userController.UserRetrieve(ctx, row.Key, ""); err == nil {
+				report.Members[i].Name = user.Name
+			}
+		}
+
+		if format == "json" {
+			ctx.JSON(http.StatusOK, timeReportResponse{Report: report})
+			return
+		}
+		var buf bytes.Buffer
+		writer := csv.NewWriter(&buf)
+		writer.Write([]string{"group", "key", "name", "minutes"})
+		writer.Write([]string{"total", "", "", strconv.FormatInt(report.Total, 10)})
+		writer.Write([]string{"estimate", "", "", strconv.FormatInt(report.Estimate, 10)})
+		groups := []struct {
+			name string
+			rows []models.TimeReportRow
+		}{
+			{"member", report.Members},
+			{"tag", report.Tags},
+			{"week", report.Weeks},
+		}
+		for _, group := range groups {
+			for _, row := range group.rows {
+				writer.Write([]string{group.name, csvCell(row.Key), csvCell(row.Name), strconv.FormatInt(row.Minutes, 10)})
+			}
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.Header("Content-Disposition", "attachment; filename=\"time-report-"+projectid+".csv\"")
+		ctx.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+	}
+}
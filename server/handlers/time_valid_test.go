@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsValidEstimate(t *testing.T) {
+	tests := map[int]*Result{
+		0:           {"", true},
+		90:          {"", true},
+		maxEstimate: {"", true},
+
+		-1:              {"estimate cannot be negative", false},
+		maxEstimate + 1: {"estimate is too large", false},
+	}
+
+	for test, expected := range tests {
+		message, ok := isValidEstimate(test)
+		if message != expected.message || ok != expected.ok {
+			t.Errorf("Test for %v", test)
+			t.Errorf("Expected %v but got {%v %v}", *expected, message, ok)
+		}
+	}
+}
+
+func TestIsValidTimeEntry(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	type Input struct {
+		start time.Time
+		end   time.Time
+	}
+
+	tests := map[Input]*Result{
+		{now.Add(-time.Hour), now}: {"", true},
+
+		{time.Time{}, now}:              {"please provide both start and end", false},
+		{now, now}:                      {"end must be after start", false},
+		{now.Add(-25 * time.Hour), now}: {"time entry cannot be longer than a day", false},
+		{now.Add(-time.Minute), now.Add(time.Minute)}: {"cannot log time in the future", false},
+	}
+
+	for test, expected := range tests {
+		message, ok := isValidTimeEntry(test.start, test.end, now)
+		if message != expected.message || ok != expected.ok {
+			t.Errorf("Test for %v", test)
+			t.Errorf("Expected %v but got {%v %v}", *expected, message, ok)
+		}
+	}
+}
+
+func TestCSVCell(t *testing.T) {
+	tests := map[string]string{
+		"":         "",
+		"design":   "design",
+		"2022-W05": "2022-W05",
+		"=1+1":     "'=1+1",
+		"+1":       "'+1",
+		"-1":       "'-1",
+		"@SUM(A1)": "'@SUM(A1)",
+		"\t=1":     "'\t=1",
+		"a=b":      "a=b",
+	}
+	for test, expected := range tests {
+		if cell := csvCell(test); cell != expected {
+			t.Errorf("Expected %q to be written as %q, got %q", test, expected, cell)
+		}
+	}
+}
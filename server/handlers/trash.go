@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/functions"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	trashTask    = "task"
+	trashProject = "project"
+	trashEvent   = "event"
+)
+
+func isValidTrashType(itemType string) (string, bool) {
+	switch itemType {
+	case trashTask, trashProject, trashEvent:
+		return "", true
+	}
+	return "type must be task, project or event", false
+}
+
+// Returns a conflict if the project is archived, as archived projects are read-only.
+func projectWritable(project models.Project) error {
+	if project.IsArchived {
+		return errs.Conflict("project is archived")
+	}
+	return nil
+}
+
+// Displays an error and returns false if the project is archived.
+func checkProjectWritable(ctx *gin.Context, project models.Project) bool {
+	if err := projectWritable(project); err != nil {
+		Respond(ctx, err)
+		return false
+	}
+	return true
+}
+
+// Same as checkProjectWritable, for the project of the task.
+// Personal tasks are always writable.
+func checkTaskWritable(ctx *gin.Context, projectController controllers.ProjectController, task models.Task) bool {
+	project, err := projectController.ProjectOfTask(ctx, task)
+	if err != nil || project == nil {
+		// left to the permission checks of the caller
+		return true
+	}
+	return checkProjectWritable(ctx, *project)
+}
+
+// Checks whether the user can restore the task from the trash, with the same permissions as deleting it.
+// project is nil for personal tasks.
+func canRestoreTask(project *models.Project, task models.Task, userid string) (string, bool) {
+	if project == nil {
+		if !task.IsPersonal || !functions.Contains(task.AssignedTo, userid) {
+			return "you lack permissions", false
+		}
+		return "", true
+	}
+	role, ok := project.Members[userid]
+	if !ok {
+		return "you lack permissions", false
+	}
+	if permissions := project.Settings.Roles[role]; !permissions.IsAdmin && !permissions.RemoveTask {
+		return "you lack permissions to restore tasks", false
+	}
+	if project.IsArchived {
+		return "project is archived", false
+	}
+	return "", true
+}
+
+// Checks whether the user can restore the event from the trash.
+// project is nil for personal events.
+func canRestoreEvent(project *models.Project, event models.Event, userid string) (string, bool) {
+	if project == nil {
+		if event.DeletedFrom != "" || event.DeletedBy != userid {
+			return "you lack permissions", false
+		}
+		return "", true
+	}
+	if _, ok := project.Members[userid]; !ok {
+		return "you lack permissions", false
+	}
+	if project.IsArchived {
+		return "project is archived", false
+	}
+	return "", true
+}
+
+// Input: projectid (optional)
+// With a projectid, returns the tasks and events of the project in the trash.
+// Otherwise, returns the personal tasks and events of the user, and the projects the user was an admin of, in the trash.
+func TrashGet(projectController controllers.ProjectController, taskController controllers.TaskController, eventController controllers.EventController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query optionalProjectIdQuery
+		if err := ctx.ShouldBindQuery(&query); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		projectid := query.ProjectId
+		projects := []models.Project{}
+		if projectid != "" {
+			project, err := projectController.ProjectRetrieve(ctx, projectid)
+			if err != nil {
+				Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+				return
+			}
+			if _, ok := project.Members[id]; !ok {
+				Respond(ctx, errs.Forbidden("you lack permissions"))
+				return
+			}
+		} else {
+			deleted, err := projectController.ProjectTrash(ctx, id)
+			if err != nil {
+				Respond(ctx, err)
+				return
+			}
+			for _, project := range deleted {
+				if project.Settings.Roles[project.Members[id]].IsAdmin {
+					projects = append(projects, project)
+				}
+			}
+		}
+		tasks, err := taskController.TaskTrash(ctx, id, projectid)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		events, err := eventController.EventTrash(ctx, id, projectid)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.JSON(http.StatusOK, trashResponse{Tasks: tasks, Projects: projects, Events: events})
+	}
+}
+
+// type: "task" | "project" | "event", id: string
+func TrashRestore(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, eventController controllers.EventController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query trashRestoreBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		if msg, ok := isValidTrashType(query.Type); !ok {
+			Respond(ctx, errs.Validation(msg))
+			return
+		}
+
+		switch query.Type {
+		case trashTask:
+			task, err := taskController.TaskRetrieveDeleted(ctx, query.Id)
+			if err != nil {
+				Respond(ctx, errs.OrNotFound(err, "task is not in the trash"))
+				return
+			}
+			var project *models.Project
+			if task.ProjectId != "" {
+				retrieved, err := projectController.ProjectRetrieve(ctx, task.ProjectId)
+				if err != nil {
+					// the whole project is in the trash, and is restored together with its tasks
+					Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+					return
+				}
+				project = &retrieved
+			}
+			if msg, ok := canRestoreTask(project, task, id); !ok {
+				Respond(ctx, errs.Forbidden(msg))
+				return
+			}
+			if err := taskController.TaskRestore(ctx, []string{query.Id}); err != nil {
+				Respond(ctx, err)
+				return
+			}
+			if project == nil {
+				userController.UsersAddTask(ctx, task.AssignedTo, query.Id, true)
+			} else {
+				projectController.ProjectAddTasks(ctx, task.ProjectId, []string{query.Id})
+				userController.UsersAddTask(ctx, membersOf(*project, task.AssignedTo), query.Id, false)
+			}
+		case trashProject:
+			project, err := projectController.ProjectRetrieveDeleted(ctx, query.Id)
+			if err != nil {
+				Respond(ctx, errs.OrNotFound(err, "project is not in the trash"))
+				return
+			}
+			if !project.Settings.Roles[project.Members[id]].IsAdmin {
+				Respond(ctx, errs.Forbidden("lacking admin permissions to execute action"))
+				return
+			}
+			if err := projectController.ProjectRestore(ctx, project.Id); err != nil {
+				Respond(ctx, err)
+				return
+			}
+			members := make([]string, 0, len(project.Members))
+			for userid := range project.Members {
+				members = append(members, userid)
+			}
+			userController.UsersAddProject(ctx, members, query.Id)
+			// tasks and events deleted before the project stay in the trash
+			tasks, err := taskController.TaskRestoreWithProject(ctx, project, *project.DeletedAt)
+			if err != nil {
+				Respond(ctx, err)
+				return
+			}
+			for _, task := range tasks {
+				userController.UsersAddTask(ctx, membersOf(project, task.AssignedTo), task.Id.Hex(), false)
+			}
+			if err := eventController.EventRestoreWithProject(ctx, query.Id, *project.DeletedAt); err != nil {
+				Respond(ctx, err)
+				return
+			}
+		case trashEvent:
+			event, err := eventController.EventRetrieveDeleted(ctx, query.Id)
+			if err != nil {
+				Respond(ctx, errs.OrNotFound(err, "event is not in the trash"))
+				return
+			}
+			var project *models.Project
+			if event.DeletedFrom != "" {
+				retrieved, err := projectController.ProjectRetrieve(ctx, event.DeletedFrom)
+				if err != nil {
+					Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+					return
+				}
+				project = &retrieved
+			}
+			if msg, ok := canRestoreEvent(project, event, id); !ok {
+				Respond(ctx, errs.Forbidden(msg))
+				return
+			}
+			if err := eventController.EventRestore(ctx, []string{query.Id}); err != nil {
+				Respond(ctx, err)
+				return
+			}
+			if project == nil {
+				userController.UserAddEvents(ctx, id, []string{query.Id})
+			} else {
+				projectController.ProjectAddEvents(ctx, event.DeletedFrom, []string{query.Id})
+			}
+		}
+		ctx.JSON(http.StatusOK, emptyResponse{})
+	}
+}
+
+// Returns the users that are still members of the project.
+func membersOf(project models.Project, userids []string) []string {
+	members := []string{}
+	for _, userid := range userids {
+		if _, ok := project.Members[userid]; ok {
+			members = append(members, userid)
+		}
+	}
+	return members
+}
+
+// projectid: string, isArchived: bool
+func ProjectArchive(projectController controllers.ProjectController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query projectArchiveBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		project, err := projectController.ProjectRetrieve(ctx, query.ProjectId)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+			return
+		}
+		if !project.Settings.Roles[project.Members[id]].IsAdmin {
+			Respond(ctx, errs.Forbidden("lacking admin permissions to execute action"))
+			return
+		}
+		if err := projectController.ProjectArchive(ctx, project.Id, query.IsArchived); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		publishProject(ctx, projectController, query.ProjectId, id)
+		ctx.JSON(http.StatusOK, emptyResponse{})
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+)
+
+func TestIsValidTrashType(t *testing.T) {
+	tests := map[string]*Result{
+		"task":    {"", true},
+		"project": {"", true},
+		"event":   {"", true},
+
+		"":        {"type must be task, project or event", false},
+		"comment": {"type must be task, project or event", false},
+	}
+
+	for test, expected := range tests {
+		message, ok := isValidTrashType(test)
+		if message != expected.message || ok != expected.ok {
+			t.Errorf("Test for %v", test)
+			t.Errorf("Expected %v but got {%v %v}", *expected, message, ok)
+		}
+	}
+}
+
+func TestCanRestoreTask(t *testing.T) {
+	project := models.Project{
+		Members:  map[string]string{"admin": "admin", "member": "member", "viewer": "viewer"},
+		Settings: models.DefaultSettings(),
+	}
+	archived := project
+	archived.IsArchived = true
+	personal := models.Task{AssignedTo: []string{"member"}, IsPersonal: true}
+	projectTask := models.Task{AssignedTo: []string{"member"}, ProjectId: "project"}
+
+	type Input struct {
+		project *models.Project
+		task    *models.Task
+		userid  string
+	}
+
+	tests := map[Input]*Result{
+		{nil, &personal, "member"}:         {"", true},
+		{nil, &personal, "admin"}:          {"you lack permissions", false},
+		{nil, &projectTask, "member"}:      {"you lack permissions", false},
+		{&project, &projectTask, "admin"}:  {"", true},
+		{&project, &projectTask, "other"}:  {"you lack permissions", false},
+		{&project, &projectTask, "member"}: {"", true},
+		// roles without the permission to remove tasks cannot restore them either
+		{&project, &projectTask, "viewer"}: {"you lack permissions to restore tasks", false},
+		{&archived, &projectTask, "admin"}: {"project is archived", false},
+	}
+
+	for test, expected := range tests {
+		message, ok := canRestoreTask(test.project, *test.task, test.userid)
+		if message != expected.message || ok != expected.ok {
+			t.Errorf("Test for %v by %v", test.task, test.userid)
+			t.Errorf("Expected %v but got {%v %v}", *expected, message, ok)
+		}
+	}
+}
+
+func TestCanRestoreEvent(t *testing.T) {
+	project := models.Project{
+		Members:  map[string]string{"admin": "admin", "member": "member"},
+		Settings: models.DefaultSettings(),
+	}
+	archived := project
+	archived.IsArchived = true
+	personal := models.Event{DeletedBy: "member"}
+	projectEvent := models.Event{DeletedBy: "admin", DeletedFrom: "project"}
+
+	type Input struct {
+		project *models.Project
+		event   *models.Event
+		userid  string
+	}
+
+	tests := map[Input]*Result{
+		{nil, &personal, "member"}:           {"", true},
+		{nil, &personal, "admin"}:            {"you lack permissions", false},
+		{nil, &projectEvent, "admin"}:        {"you lack permissions", false},
+		{&project, &projectEvent, "member"}:  {"", true},
+		{&project, &projectEvent, "other"}:   {"you lack permissions", false},
+		{&archived, &projectEvent, "member"}: {"project is archived", false},
+	}
+
+	for test, expected := range tests {
+		message, ok := canRestoreEvent(test.project, *test.event, test.userid)
+		if message != expected.message || ok != expected.ok {
+			t.Errorf("Test for %v by %v", test.event, test.userid)
+			t.Errorf("Expected %v but got {%v %v}", *expected, message, ok)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/txn"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Records the writes made to all collections, failing the write at index failAt.
+type journal struct {
+	failAt int
+	writes []string
+	// the last update of a project
+	project bson.D
+	// the filter of the last restore of tasks
+	restored bson.D
+}
+
+func (j *journal) write(name string) error {
+	j.writes = append(j.writes, name)
+	if len(j.writes)-1 == j.failAt {
+		return errors.New(name + " failed")
+	}
+	return nil
+}
+
+type journalUsers struct {
+	controllers.UserCollectionInterface
+	*journal
+}
+
+func (c journalUsers) UpdateManyByID(ctx context.Context, useridArr []primitive.ObjectID, params bson.D) (*mongo.UpdateResult, error) {
+	return &mongo.UpdateResult{}, c.write("users " + params[0].Key)
+}
+
+func (c journalUsers) UpdateMany(ctx context.Context, filter bson.D, params bson.D) (*mongo.UpdateResult, error) {
+	return &mongo.UpdateResult{}, c.write("users " + params[0].Key)
+}
+
+type journalTasks struct {
+	controllers.TaskCollectionInterface
+	*journal
+	tasks []models.Task
+}
+
+func (c journalTasks) FindAll(ctx context.Context, taskidArr []primitive.ObjectID, TaskArr *[]models.Task) error {
+	*TaskArr = c.tasks
+	return nil
+}
+
+func (c journalTasks) InsertOne(ctx context.Context, task *models.Task) (primitive.ObjectID, error) {
+	return primitive.NewObjectID(), c.write("task insert")
+}
+
+func (c journalTasks) DeleteByID(ctx context.Context, id string) (int64, error) {
+	return 1, c.write("task delete")
+}
+
+func (c journalTasks) UpdateManyByID(ctx context.Context, taskIdArr []primitive.ObjectID, params bson.D) (*mongo.UpdateResult, error) {
+	return &mongo.UpdateResult{}, c.write("tasks " + params[0].Key)
+}
+
+func (c journalTasks) UpdateMany(ctx context.Context, filter bson.D, params bson.D) (*mongo.UpdateResult, error) {
+	if params[0].Key == "$unset" {
+		c.journal.restored = filter
+	}
+	return &mongo.UpdateResult{}, c.write("tasks " + params[0].Key)
+}
+
+func (c journalTasks) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	documents := make([]interface{}, len(c.tasks))
+	for i, task := range c.tasks {
+		documents[i] = task
+	}
+	return mongo.NewCursorFromDocuments(documents, nil, nil)
+}
+
+type journalEvents struct {
+	controllers.EventCollectionInterface
+	*journal
+}
+
+func (c journalEvents) UpdateMany(ctx context.Context, filter bson.D, params bson.D) (*mongo.UpdateResult, error) {
+	return &mongo.UpdateResult{}, c.write("events " + params[0].Key)
+}
+
+type journalProjects struct {
+	controllers.ProjectCollectionInterface
+	*journal
+}
+
+func (c journalProjects) UpdateByID(ctx context.Context, id primitive.ObjectID, params bson.D) (*mongo.UpdateResult, error) {
+	c.journal.project = params
+	return &mongo.UpdateResult{}, c.write("project " + params[0].Key)
+}
+
+func journalControllers(j *journal, tasks []models.Task) (controllers.UserController, controllers.ProjectController, controllers.TaskController) {
+	userController := controllers.UserController{
+		Collection: func(name string, opts ...*options.CollectionOptions) controllers.UserCollectionInterface {
+			return journalUsers{journal: j}
+		},
+	}
+	projectController := controllers.ProjectController{
+		Collection: func(name string, opts ...*options.CollectionOptions) controllers.ProjectCollectionInterface {
+			return journalProjects{journal: j}
+		},
+	}
+	taskController := controllers.TaskController{
+		Collection: func(name string, opts ...*options.CollectionOptions) controllers.TaskCollectionInterface {
+			return journalTasks{journal: j, tasks: tasks}
+		},
+	}
+	return userController, projectController, taskController
+}
+
+func TestCreateTaskUndoesOnFailure(t *testing.T) {
+	// the writes made when creating the task fails at each index, followed by the writes undoing the earlier ones
+	tests := map[int][]string{
+		-1: {"task insert", "users $set", "project $addToSet"},
+		0:  {"task insert"},
+		1:  {"task insert", "users $set", "task delete"},
+		2:  {"task insert", "users $set", "project $addToSet", "users $unset", "task delete"},
+	}
+
+	for failAt, expected := range tests {
+		j := &journal{failAt: failAt}
+		userController, projectController, taskController := journalControllers(j, nil)
+		task := models.Task{
+			Name:       "task",
+			AssignedTo: []string{primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()},
+			ProjectId:  primitive.NewObjectID().Hex(),
+		}
+		err := createTask(context.Background(), txn.NewSagaRunner(), userController, projectController, taskController, &task)
+
+		var txnErr *txn.Error
+		if failAt < 0 && err != nil {
+			t.Errorf("Expected no error but got %v", err)
+		} else if failAt >= 0 && (!errors.As(err, &txnErr) || txnErr.Rollback != nil) {
+			t.Errorf("Expected the changes to be undone but got %v when failing at %v", err, failAt)
+		}
+		if !reflect.DeepEqual(j.writes, expected) {
+			t.Errorf("Expected %v but got %v when failing at %v", expected, j.writes, failAt)
+		}
+	}
+}
+
+func TestLeaveProjectUndoesOnFailure(t *testing.T) {
+	user := models.User{Id: primitive.NewObjectID()}
+	userid := user.Id.Hex()
+	other := primitive.NewObjectID().Hex()
+	task := models.Task{Id: primitive.NewObjectID(), AssignedTo: []string{userid, other}}
+	user.Tasks = map[string]bool{task.Id.Hex(): false}
+	project := models.Project{
+		Id:       primitive.NewObjectID(),
+		Members:  map[string]string{userid: "admin", other: "member"},
+		Tasks:    []string{task.Id.Hex()},
+		Settings: models.DefaultSettings(),
+	}
+
+	tests := map[int][]string{
+		-1: {"project $set", "tasks $pull", "users $unset", "users $pull"},
+		1:  {"project $set", "tasks $pull", "project $set"},
+		3:  {"project $set", "tasks $pull", "users $unset", "users $pull", "users $set", "tasks $addToSet", "project $set"},
+	}
+
+	for failAt, expected := range tests {
+		j := &journal{failAt: failAt}
+		userController, projectController, taskController := journalControllers(j, []models.Task{task})
+		err := leaveProject(context.Background(), txn.NewSagaRunner(), userController, projectController, taskController, project, user)
+
+		var txnErr *txn.Error
+		if failAt < 0 && err != nil {
+			t.Errorf("Expected no error but got %v", err)
+		} else if failAt >= 0 && (!errors.As(err, &txnErr) || txnErr.Rollback != nil) {
+			t.Errorf("Expected the changes to be undone but got %v when failing at %v", err, failAt)
+		}
+		if !reflect.DeepEqual(j.writes, expected) {
+			t.Errorf("Expected %v but got %v when failing at %v", expected, j.writes, failAt)
+		}
+
+		members := j.project[0].Value.(bson.D)[0].Value.(map[string]string)
+		if _, ok := members[userid]; ok != (failAt >= 0) {
+			t.Errorf("Expected the user to be a member %v but got %v when failing at %v", failAt >= 0, members, failAt)
+		}
+	}
+}
+
+func TestDeleteProjectUndoesOnFailure(t *testing.T) {
+	userid := primitive.NewObjectID().Hex()
+	task := models.Task{Id: primitive.NewObjectID(), AssignedTo: []string{userid}}
+	project := models.Project{
+		Id:      primitive.NewObjectID(),
+		Members: map[string]string{userid: "admin"},
+		Tasks:   []string{task.Id.Hex()},
+		Events:  []string{primitive.NewObjectID().Hex()},
+	}
+
+	tests := map[int][]string{
+		-1: {"project $set", "users $pull", "users $unset", "tasks $set", "events $set"},
+		// such as when the project was modified since it was read, which leaves nothing to undo
+		0: {"project $set"},
+		3: {"project $set", "users $pull", "users $unset", "tasks $set", "users $set", "users $addToSet", "project $unset"},
+		4: {"project $set", "users $pull", "users $unset", "tasks $set", "events $set", "tasks $unset", "users $set", "users $addToSet", "project $unset"},
+	}
+
+	for failAt, expected := range tests {
+		j := &journal{failAt: failAt}
+		userController, projectController, taskController := journalControllers(j, []models.Task{task})
+		eventController := controllers.EventController{
+			Collection: func(name string, opts ...*options.CollectionOptions) controllers.EventCollectionInterface {
+				return journalEvents{journal: j}
+			},
+		}
+		err := deleteProject(context.Background(), txn.NewSagaRunner(), userController, projectController, taskController, eventController, project, nil, userid, time.Now())
+
+		var txnErr *txn.Error
+		if failAt < 0 && err != nil {
+			t.Errorf("Expected no error but got %v", err)
+		} else if failAt >= 0 && (!errors.As(err, &txnErr) || txnErr.Rollback != nil) {
+			t.Errorf("Expected the changes to be undone but got %v when failing at %v", err, failAt)
+		}
+		if !reflect.DeepEqual(j.writes, expected) {
+			t.Errorf("Expected %v but got %v when failing at %v", expected, j.writes, failAt)
+		}
+		// only the tasks moved to the trash are restored
+		if failAt == 4 {
+			if ids := j.restored.Map()["_id"].(bson.D).Map()["$in"]; !reflect.DeepEqual(ids, []primitive.ObjectID{task.Id}) {
+				t.Errorf("Expected the task to be restored by its id but got %v", j.restored)
+			}
+		}
+	}
+}
+
+func TestMembersAfterLeaving(t *testing.T) {
+	settings := models.DefaultSettings()
+	tests := []struct {
+		members  map[string]string
+		userid   string
+		expected map[string]string
+	}{
+		{map[string]string{"a": "admin"}, "a", map[string]string{}},
+		{map[string]string{"a": "admin", "b": "member"}, "a", map[string]string{"b": "admin"}},
+		{map[string]string{"a": "admin", "b": "admin", "c": "member"}, "a", map[string]string{"b": "admin", "c": "member"}},
+		{map[string]string{"a": "admin", "b": "member"}, "b", map[string]string{"a": "admin"}},
+	}
+
+	for _, test := range tests {
+		project := models.Project{Members: test.members, Settings: settings}
+		actual := membersAfterLeaving(project, test.userid)
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("Expected %v but got %v for %v leaving %v", test.expected, actual, test.userid, test.members)
+		}
+		if len(project.Members) != len(test.members) {
+			t.Errorf("Expected the project members to be left unchanged")
+		}
+	}
+}
+
+func TestDeleteProjectTasksUndoesOnFailure(t *testing.T) {
+	userid := primitive.NewObjectID().Hex()
+	task := models.Task{Id: primitive.NewObjectID(), AssignedTo: []string{userid}}
+	project := models.Project{
+		Id:      primitive.NewObjectID(),
+		Members: map[string]string{userid: "admin"},
+		Tasks:   []string{task.Id.Hex()},
+	}
+
+	tests := map[int][]string{
+		-1: {"tasks $set", "project $pull", "users $unset"},
+		0:  {"tasks $set"},
+		1:  {"tasks $set", "project $pull", "tasks $unset"},
+		2:  {"tasks $set", "project $pull", "users $unset", "project $addToSet", "tasks $unset"},
+	}
+
+	for failAt, expected := range tests {
+		j := &journal{failAt: failAt}
+		userController, projectController, taskController := journalControllers(j, []models.Task{task})
+		err := deleteProjectTasks(context.Background(), txn.NewSagaRunner(), userController, projectController, taskController, project, []models.Task{task}, time.Now())
+
+		var txnErr *txn.Error
+		if failAt < 0 && err != nil {
+			t.Errorf("Expected no error but got %v", err)
+		} else if failAt >= 0 && (!errors.As(err, &txnErr) || txnErr.Rollback != nil) {
+			t.Errorf("Expected the changes to be undone but got %v when failing at %v", err, failAt)
+		}
+		if !reflect.DeepEqual(j.writes, expected) {
+			t.Errorf("Expected %v but got %v when failing at %v", expected, j.writes, failAt)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
 	"net/mail"
 	"strings"
@@ -8,24 +9,28 @@ import (
 
 	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
 	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
 	"github.com/OrgaNiUS/OrgaNiUS/server/mailer"
 	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/socket"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // This handler is meant to be accessed without an account.
 func UserExistsGet(controller controllers.UserController) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		name := ctx.DefaultQuery("name", "")
-		email := ctx.DefaultQuery("email", "")
-		exists, err := controller.UserExists(ctx, name, email)
+		var q nameQuery
+		if err := ctx.ShouldBindQuery(&q); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		exists, err := controller.UserExists(ctx, q.Name, q.Email)
 		if err != nil {
-			DisplayError(ctx, err.Error())
-		} else {
-			ctx.JSON(http.StatusOK, gin.H{"exists": exists})
+			Respond(ctx, err)
+			return
 		}
+		ctx.JSON(http.StatusOK, existsResponse{Exists: exists})
 	}
 }
 
@@ -33,21 +38,17 @@ func UserExistsGet(controller controllers.UserController) gin.HandlerFunc {
 // Thus, no sensitive information should be leaked from this!
 func UserGet(controller controllers.UserController) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		id := ctx.DefaultQuery("id", "")
-		name := ctx.DefaultQuery("name", "")
-		user, err := controller.UserRetrieve(ctx, id, name)
-		if err == mongo.ErrNoDocuments {
-			DisplayError(ctx, "user does not exist")
-		} else if err != nil {
-			DisplayError(ctx, err.Error())
-		} else {
-			returnedUser := gin.H{
-				"name":     user.Name,
-				"email":    user.Email,
-				"projects": user.Projects,
-			}
-			ctx.JSON(http.StatusOK, returnedUser)
+		var q userQuery
+		if err := ctx.ShouldBindQuery(&q); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		user, err := controller.UserRetrieve(ctx, q.Id, q.Name)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "user does not exist"))
+			return
 		}
+		ctx.JSON(http.StatusOK, publicUser{Name: user.Name, Email: user.Email, Projects: user.Projects})
 	}
 }
 
@@ -57,18 +58,16 @@ func UserGet(controller controllers.UserController, projectController controller
 		id := ctx.DefaultQuery("id", "")
 		name := ctx.DefaultQuery("name", "")
 		user, err := controller.UserRetrieve(ctx, id, name)
-		if err == mongo.ErrNoDocuments {
-			DisplayError(ctx, "user does not exist")
-		} else if err != nil {
-			DisplayError(ctx, err.Error())
-		} else {
-			returnedUser := gin.H{
-				"name":     user.Name,
-				"email":    user.Email,
-				"projects": projectController.ProjectIdToArray(ctx, user.Projects),
-			}
-			ctx.JSON(http.StatusOK, returnedUser)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "user does not exist"))
+			return
 		}
+		returnedUser := gin.H{
+			"name":     user.Name,
+			"email":    user.Email,
+			"projects": projectController.ProjectIdToArray(ctx, user.Projects),
+		}
+		ctx.JSON(http.StatusOK, returnedUser)
 	}
 }
 */
@@ -77,17 +76,16 @@ func UserGetSelf(controller controllers.UserController, jwtParser *auth.JWTParse
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
 		user, err := controller.UserRetrieve(ctx, id, "")
-		if err == mongo.ErrNoDocuments {
-			DisplayError(ctx, "user does not exist")
-		} else if err != nil {
-			DisplayError(ctx, err.Error())
-		} else {
-			ctx.JSON(http.StatusOK, user)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "user does not exist"))
+			return
 		}
+		setETag(ctx, user.Version)
+		ctx.JSON(http.StatusOK, user)
 	}
 }
 
@@ -165,109 +163,114 @@ func isValidPassword(name, password string) (string, bool) {
 	return "", true
 }
 
+// Signs the user up, sending a pin to verify their email with.
+func signup(ctx *gin.Context, controller controllers.UserController, mailer *mailer.Mailer, user *models.User) error {
+	tests := []func() (string, bool){
+		func() (string, bool) {
+			return isValidName(user.Name)
+		},
+		func() (string, bool) {
+			return isValidPassword(user.Name, user.Password)
+		},
+		func() (string, bool) {
+			return isValidEmail(user.Email)
+		},
+		func() (string, bool) {
+			return alreadySignedUp(controller, ctx, user.Name, user.Email)
+		},
+	}
+	for _, t := range tests {
+		if msg, ok := t(); !ok {
+			return errs.Validation(msg)
+		}
+	}
+	hashedPassword, err := auth.HashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+	user.Password = hashedPassword
+	// ensure its Verified is false
+	user.Verified = false
+	hash, pin := auth.GeneratePin()
+	user.VerificationPin = hash
+	user.Projects = []string{}
+	user.Events = []string{}
+	user.Invites = []string{}
+	user.Tasks = make(map[string]bool)
+	if err := controller.UserCreate(ctx, user); err != nil {
+		return err
+	}
+	return mailer.SendVerification(ctx, user.Name, user.Email, pin)
+}
+
 func UserSignup(controller controllers.UserController, jwtParser *auth.JWTParser, mailer *mailer.Mailer) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		var user models.User
-		if err := ctx.BindJSON(&user); err != nil {
-			DisplayError(ctx, err.Error())
-			return
-		}
-		tests := []func() (string, bool){
-			func() (string, bool) {
-				return isValidName(user.Name)
-			},
-			func() (string, bool) {
-				return isValidPassword(user.Name, user.Password)
-			},
-			func() (string, bool) {
-				return isValidEmail(user.Email)
-			},
-			func() (string, bool) {
-				return alreadySignedUp(controller, ctx, user.Name, user.Email)
-			},
-		}
-		for _, t := range tests {
-			if msg, ok := t(); !ok {
-				DisplayError(ctx, msg)
-				return
-			}
-		}
-		hashedPassword, err := auth.HashPassword(user.Password)
-		if err != nil {
-			DisplayError(ctx, err.Error())
+		var input signupBody
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			Respond(ctx, invalidBody(err))
 			return
 		}
-		user.Password = hashedPassword
-		// ensure its Verified is false
-		user.Verified = false
-		hash, pin := auth.GeneratePin()
-		user.VerificationPin = hash
-		user.Projects = []string{}
-		user.Events = []string{}
-		user.Invites = []string{}
-		user.Tasks = make(map[string]bool)
-		if err := controller.UserCreate(ctx, &user); err != nil {
-			DisplayError(ctx, err.Error())
-			return
-		}
-		if err := mailer.SendVerification(user.Name, user.Email, pin); err != nil {
-			DisplayError(ctx, err.Error())
+		user := models.User{Name: input.Name, Password: input.Password, Email: input.Email}
+		if err := signup(ctx, controller, mailer, &user); err != nil {
+			Respond(ctx, err)
 			return
 		}
-		ctx.JSON(http.StatusCreated, gin.H{})
+		ctx.JSON(http.StatusCreated, emptyResponse{})
 	}
 }
 
 func UserVerify(controller controllers.UserController, jwtParser *auth.JWTParser) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		type query struct {
-			Name string `bson:"name" json:"name"`
-			Pin  string `bson:"pin" json:"pin"`
-		}
-		var q query
-		if err := ctx.BindJSON(&q); err != nil {
-			DisplayError(ctx, err.Error())
+		var q pinBody
+		if err := ctx.ShouldBindJSON(&q); err != nil {
+			Respond(ctx, invalidBody(err))
 			return
 		}
 		if q.Name == "" || q.Pin == "" {
-			DisplayError(ctx, "please provide name and pin")
+			Respond(ctx, errs.Validation("please provide name and pin"))
 			return
 		}
 		id, err := controller.UserVerifyPin(ctx, q.Name, q.Pin)
 		if err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
 		if err := jwtParser.RefreshJWT(ctx, id.Hex(), q.Name); err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
-		ctx.JSON(http.StatusOK, gin.H{})
+		ctx.JSON(http.StatusOK, emptyResponse{})
 	}
 }
 
+// Checks the name and password of the user, filling in the rest of the user and setting the JWT cookie.
+func login(ctx *gin.Context, controller controllers.UserController, jwtParser *auth.JWTParser, user *models.User) error {
+	if len(user.Name) == 0 || len(user.Password) == 0 {
+		return errs.Validation("please provide a username and password")
+	}
+	validLogin, err := controller.UserCheckPassword(ctx, user)
+	if err != nil {
+		// Intentionally not exposing any other details.
+		return err
+	} else if !validLogin {
+		return errs.Unauthorized("username and password do not match")
+	}
+	return jwtParser.RefreshJWT(ctx, user.Id.Hex(), user.Name)
+}
+
 func UserLogin(controller controllers.UserController, jwtParser *auth.JWTParser) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		var user models.User
-		if err := ctx.BindJSON(&user); err != nil {
-			DisplayError(ctx, err.Error())
-			return
-		}
-		if len(user.Name) == 0 || len(user.Password) == 0 {
-			DisplayError(ctx, "please provide a username and password")
+		var input loginBody
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			Respond(ctx, invalidBody(err))
 			return
 		}
-		validLogin, err := controller.UserCheckPassword(ctx, &user)
-		if !validLogin || err != nil {
-			// Intentionally not exposing any other details.
-			DisplayError(ctx, err.Error())
+		user := models.User{Name: input.Name, Password: input.Password}
+		if err := login(ctx, controller, jwtParser, &user); err != nil {
+			Respond(ctx, err)
 			return
 		}
-		if err := jwtParser.RefreshJWT(ctx, user.Id.Hex(), user.Name); err != nil {
-			DisplayError(ctx, err.Error())
-			return
-		}
-		ctx.JSON(http.StatusCreated, gin.H{})
+		ctx.JSON(http.StatusCreated, emptyResponse{})
 	}
 }
 
@@ -277,10 +280,10 @@ func UserRefreshJWT(controller controllers.UserController, jwtParser *auth.JWTPa
 	return func(ctx *gin.Context) {
 		_, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
-		ctx.JSON(http.StatusOK, gin.H{})
+		ctx.JSON(http.StatusOK, emptyResponse{})
 	}
 }
 
@@ -289,11 +292,11 @@ func UserLogout(controller controllers.UserController, jwtParser *auth.JWTParser
 	return func(ctx *gin.Context) {
 		_, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
 		jwtParser.DeleteJWT(ctx)
-		ctx.JSON(http.StatusOK, gin.H{})
+		ctx.JSON(http.StatusOK, emptyResponse{})
 	}
 }
 
@@ -301,146 +304,152 @@ func UserLogout(controller controllers.UserController, jwtParser *auth.JWTParser
 // This will send a 6-digit PIN (similar to the one used for sign up) to the user's email address.
 func UserForgotPW(controller controllers.UserController, mailer *mailer.Mailer) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		type query struct {
-			Name string `bson:"name" json:"name"`
-		}
-		var q query
-		ctx.BindJSON(&q)
+		var q forgotPWBody
+		ctx.ShouldBindJSON(&q)
 		hash, pin := auth.GeneratePin()
 		email, err := controller.UserForgotPW(ctx, q.Name, hash)
 		if err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
-		if err := mailer.SendForgotPW(q.Name, email, pin); err != nil {
-			DisplayError(ctx, err.Error())
+		if err := mailer.SendForgotPW(ctx, q.Name, email, pin); err != nil {
+			Respond(ctx, err)
 			return
 		}
-		ctx.JSON(http.StatusOK, gin.H{})
+		ctx.JSON(http.StatusOK, emptyResponse{})
 	}
 }
 
 // Verify PIN obtained from Forgot Password.
 func UserVerifyForgotPW(controller controllers.UserController) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		type query struct {
-			Name string `bson:"name" json:"name"`
-			Pin  string `bson:"pin" json:"pin"`
-		}
-		var q query
-		ctx.BindJSON(&q)
+		var q pinBody
+		ctx.ShouldBindJSON(&q)
 		ok, err := controller.UserVerifyForgotPW(ctx, q.Name, q.Pin)
 		if !ok {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
-		ctx.JSON(http.StatusOK, gin.H{
-			"valid": true,
-		})
+		ctx.JSON(http.StatusOK, validResponse{Valid: true})
 	}
 }
 
 // Uses the PIN as validation to change the password of the user account.
 func UserChangeForgotPW(controller controllers.UserController) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		type query struct {
-			Name     string `bson:"name" json:"name"`
-			Pin      string `bson:"pin" json:"pin"`
-			Password string `bson:"password" json:"password"`
-		}
-		var q query
-		ctx.BindJSON(&q)
+		var q changeForgotPWBody
+		ctx.ShouldBindJSON(&q)
 		if msg, ok := isValidPassword(q.Name, q.Password); !ok {
-			DisplayError(ctx, msg)
+			Respond(ctx, errs.Validation(msg))
 			return
 		}
 		hash, err := auth.HashPassword(q.Password)
 		if err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
 		if err := controller.UserChangeForgotPW(ctx, q.Name, q.Pin, hash); err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, err)
 			return
 		}
-		ctx.JSON(http.StatusOK, gin.H{})
+		ctx.JSON(http.StatusOK, emptyResponse{})
 	}
 }
 
 // Only used for modifying username, password and email.
+// Changes to the user, of which only those that are not empty are made.
+type userChanges struct {
+	Name     string `bson:"name" json:"name" doc:"unchanged if empty"`
+	Password string `bson:"password" json:"password" doc:"unchanged if empty"`
+	Email    string `bson:"email" json:"email" doc:"unchanged if empty"`
+}
+
+// Makes the changes to the user with the id and name, returning the fields changed with the password hidden.
+func modifyUser(ctx context.Context, controller controllers.UserController, id, name string, version *int64, q userChanges) (models.User, error) {
+	// If a new name is provided, use it for checks instead.
+	// Currently, only relevant for password check.
+	if q.Name != "" {
+		name = q.Name
+	}
+	tests := []func() (string, bool){
+		func() (string, bool) {
+			if q.Name == "" {
+				return "", true
+			}
+			return isValidName(q.Name)
+		},
+		func() (string, bool) {
+			if q.Password == "" {
+				return "", true
+			}
+			return isValidPassword(name, q.Password)
+		},
+		func() (string, bool) {
+			if q.Email == "" {
+				return "", true
+			}
+			return isValidEmail(q.Email)
+		},
+	}
+	for _, t := range tests {
+		if msg, ok := t(); !ok {
+			return models.User{}, errs.Validation(msg)
+		}
+	}
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return models.User{}, errs.Validation(err.Error())
+	}
+	user := models.User{
+		Id: objectId,
+	}
+	if q.Name != "" {
+		user.Name = q.Name
+	}
+	if q.Password != "" {
+		hashedPassword, err := auth.HashPassword(q.Password)
+		if err != nil {
+			return models.User{}, err
+		}
+		user.Password = hashedPassword
+	}
+	if q.Email != "" {
+		user.Email = q.Email
+	}
+	if err := controller.UserModify(ctx, &user, version); err != nil {
+		return models.User{}, err
+	}
+	// hide password from output
+	user.Password = ""
+	return user, nil
+}
+
 func UserPatch(controller controllers.UserController, jwtParser *auth.JWTParser) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		id, name, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
-			return
-		}
-		type query struct {
-			Name     string `bson:"name" json:"name"`
-			Password string `bson:"password" json:"password"`
-			Email    string `bson:"email" json:"email"`
-		}
-		var q query
-		if err := ctx.BindJSON(&q); err != nil {
-			DisplayError(ctx, err.Error())
-			return
-		}
-		// If a new name is provided, use it for checks instead.
-		// Currently, only relevant for password check.
-		if q.Name != "" {
-			name = q.Name
-		}
-		tests := []func() (string, bool){
-			func() (string, bool) {
-				if q.Name == "" {
-					return "", true
-				}
-				return isValidName(q.Name)
-			},
-			func() (string, bool) {
-				if q.Password == "" {
-					return "", true
-				}
-				return isValidPassword(name, q.Password)
-			},
-			func() (string, bool) {
-				if q.Email == "" {
-					return "", true
-				}
-				return isValidEmail(q.Email)
-			},
-		}
-		for _, t := range tests {
-			if msg, ok := t(); !ok {
-				DisplayError(ctx, msg)
-				return
-			}
-		}
-		objectId, err := primitive.ObjectIDFromHex(id)
-		if err != nil {
-			DisplayError(ctx, err.Error())
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
-		user := models.User{
-			Id: objectId,
+		var q userChanges
+		if err := ctx.ShouldBindJSON(&q); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
 		}
-		if q.Name != "" {
-			user.Name = q.Name
+		version, err := ifMatch(ctx)
+		if err != nil {
+			Respond(ctx, err)
+			return
 		}
-		if q.Password != "" {
-			hashedPassword, err := auth.HashPassword(q.Password)
-			if err != nil {
-				DisplayError(ctx, err.Error())
-				return
-			}
-			user.Password = hashedPassword
+		user, err := modifyUser(ctx, controller, id, name, version, q)
+		if err != nil {
+			Respond(ctx, err)
+			return
 		}
-		if q.Email != "" {
-			user.Email = q.Email
+		if current, err := controller.UserRetrieve(ctx, id, ""); err == nil {
+			user.Version = current.Version
+			setETag(ctx, current.Version)
 		}
-		controller.UserModify(ctx, &user)
-		// hide password from output
-		user.Password = ""
 		ctx.JSON(http.StatusOK, user)
 	}
 }
@@ -450,15 +459,24 @@ func UserDelete(controller controllers.UserController, jwtParser *auth.JWTParser
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
-		if err := controller.UserDelete(ctx, id); err != nil {
-			DisplayError(ctx, err.Error())
-		} else {
-			jwtParser.DeleteJWT(ctx)
-			ctx.JSON(http.StatusOK, gin.H{})
+		if _, err := controller.UserRetrieve(ctx, id, ""); err != nil {
+			Respond(ctx, errs.OrNotFound(err, "user does not exist"))
+			return
+		}
+		version, err := ifMatch(ctx)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		if err := controller.UserDelete(ctx, id, version); err != nil {
+			Respond(ctx, err)
+			return
 		}
+		jwtParser.DeleteJWT(ctx)
+		ctx.JSON(http.StatusOK, emptyResponse{})
 	}
 }
 
@@ -467,28 +485,25 @@ func UserApplyProject(projectController controllers.ProjectController, jwtParser
 	return func(ctx *gin.Context) {
 		userid, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
 
-		type q struct {
-			ProjectId   string `bson:"projectid" json:"projectid"`
-			Description string `bson:"description" json:"description"`
-		}
-		var query q
-		if err := ctx.BindJSON(&query); err != nil {
-			DisplayError(ctx, "bad request")
+		var query applyBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, errs.Validation("bad request"))
+			return
 		}
 
 		projectid := query.ProjectId
 		if projectid == "" {
-			DisplayError(ctx, "provide a projectid")
+			Respond(ctx, errs.Validation("provide a projectid"))
 			return
 		}
 
 		description := query.Description
 		projectController.ProjectAddAppl(ctx, projectid, userid, description)
-		ctx.JSON(http.StatusOK, gin.H{})
+		ctx.JSON(http.StatusOK, emptyResponse{})
 	}
 }
 
@@ -498,30 +513,22 @@ func UserGetProjectInvites(userController controllers.UserController, projectCon
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
 		userModel, err := userController.UserRetrieve(ctx, id, "")
-		if err == mongo.ErrNoDocuments {
-			DisplayError(ctx, "user does not exist")
-		} else if err != nil {
-			DisplayError(ctx, err.Error())
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "user does not exist"))
+			return
 		}
 
 		projectids := userModel.Invites
 		projects := projectController.ProjectArrayToModel(ctx, projectids)
 
-		type invite struct {
-			Id          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-			Name        string             `bson:"name" json:"name"`
-			Description string             `bson:"description" json:"description"`
-			Members     map[string]string  `bson:"members" json:"members"` // Key: UserID, Value: Role
-		}
-
-		invites := []invite{}
+		invites := []projectInvite{}
 
 		for _, project := range projects {
-			invites = append(invites, invite{
+			invites = append(invites, projectInvite{
 				Id:          project.Id,
 				Name:        project.Name,
 				Description: project.Description,
@@ -529,9 +536,7 @@ func UserGetProjectInvites(userController controllers.UserController, projectCon
 			})
 		}
 
-		ctx.JSON(http.StatusOK, gin.H{
-			"projects": invites,
-		})
+		ctx.JSON(http.StatusOK, projectInvitesResponse{Projects: invites})
 	}
 }
 
@@ -541,36 +546,33 @@ func UserAcceptProject(userController controllers.UserController, projectControl
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
 
-		type query struct {
-			Id string `bson:"projectid" json:"projectid"`
-		}
-		var q query
+		var q projectIdBody
 
-		if err := ctx.BindJSON(&q); err != nil {
-			DisplayError(ctx, "bad params")
+		if err := ctx.ShouldBindJSON(&q); err != nil {
+			Respond(ctx, errs.Validation("bad params"))
 			return
 		}
-		if q.Id == "" {
-			DisplayError(ctx, "provide a projectid")
+		if q.ProjectId == "" {
+			Respond(ctx, errs.Validation("provide a projectid"))
 			return
 		}
 
 		userid, _ := primitive.ObjectIDFromHex(id)
-		userController.UserAddProject(ctx, userid, q.Id)          // Add project to user.Projects
-		userController.UserDeleteInvites(ctx, id, []string{q.Id}) // Remove invite from user.Invites
-		project, err := projectController.ProjectRetrieve(ctx, q.Id)
-		if err == mongo.ErrNoDocuments {
-			DisplayError(ctx, "project does not exist")
-		} else if err != nil {
-			DisplayError(ctx, err.Error())
+		userController.UserAddProject(ctx, userid, q.ProjectId)          // Add project to user.Projects
+		userController.UserDeleteInvites(ctx, id, []string{q.ProjectId}) // Remove invite from user.Invites
+		project, err := projectController.ProjectRetrieve(ctx, q.ProjectId)
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+			return
 		}
 		project.Members[id] = "member"
-		projectController.ProjectAddUsers(ctx, q.Id, &project) // Add user to project.Members
-		ctx.JSON(http.StatusOK, gin.H{})
+		projectController.ProjectAddUsers(ctx, q.ProjectId, &project) // Add user to project.Members
+		publishMembers(ctx, userController, q.ProjectId, id, socket.ActivityMemberJoined, []string{id})
+		ctx.JSON(http.StatusOK, emptyResponse{})
 	}
 }
 
@@ -580,25 +582,22 @@ func UserRejectProject(userController controllers.UserController, projectControl
 	return func(ctx *gin.Context) {
 		id, _, ok := jwtParser.GetFromJWT(ctx)
 		if !ok {
-			DisplayNotAuthorized(ctx, "not logged in")
+			Respond(ctx, errs.Unauthorized("not logged in"))
 			return
 		}
 
-		type query struct {
-			Id string `bson:"projectid" json:"projectid"`
-		}
-		var q query
+		var q projectIdBody
 
-		if err := ctx.BindJSON(&q); err != nil {
-			DisplayError(ctx, "bad params")
+		if err := ctx.ShouldBindJSON(&q); err != nil {
+			Respond(ctx, errs.Validation("bad params"))
 			return
 		}
-		if q.Id == "" {
-			DisplayError(ctx, "provide a projectid")
+		if q.ProjectId == "" {
+			Respond(ctx, errs.Validation("provide a projectid"))
 			return
 		}
 
-		userController.UserDeleteInvites(ctx, id, []string{q.Id})
-		ctx.JSON(http.StatusOK, gin.H{})
+		userController.UserDeleteInvites(ctx, id, []string{q.ProjectId})
+		ctx.JSON(http.StatusOK, emptyResponse{})
 	}
 }
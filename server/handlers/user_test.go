@@ -141,8 +141,8 @@ func TestUserGet(t *testing.T) {
 	f(ctx)
 	body, _ = io.ReadAll(w.Result().Body)
 	json.Unmarshal(body, &resp)
-	if w.Code != http.StatusBadRequest {
-		t.Errorf("Expected code %v but got %v", http.StatusBadRequest, w.Code)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected code %v but got %v", http.StatusNotFound, w.Code)
 	}
 }
 
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/gin-gonic/gin"
+)
+
+/*
+	v2 is resource oriented: ids are in the path, the method is the action, and bodies are JSON.
+	Responses are enveloped, as {"data": ...} with "page" for collections, and errors as {"error": {...}}.
+	The handlers share the controllers and the logic of v1, which stays for the React client.
+*/
+
+const (
+	// marks requests to v2, whose errors are enveloped
+	v2Key = "v2"
+
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// The body of v2 responses.
+type data[T any] struct {
+	Data T `json:"data" required:"true"`
+}
+
+// The body of v2 responses with a page of a collection.
+type page[T any] struct {
+	Data []T     `json:"data" required:"true"`
+	Page pageRef `json:"page" required:"true"`
+}
+
+type pageRef struct {
+	Limit int    `json:"limit"`
+	Next  string `json:"next,omitempty" doc:"cursor of the next page, which is left out on the last page"`
+}
+
+// The body of v2 error responses, as written by Respond.
+type errorEnvelope struct {
+	Error problem `json:"error" required:"true"`
+}
+
+type problem struct {
+	Code    errs.Code         `json:"code" required:"true" enum:"validation,unauthorized,forbidden,not_found,conflict,precondition_failed,internal" doc:"compare this rather than the message"`
+	Message string            `json:"message" required:"true" doc:"can be shown to the user"`
+	Fields  map[string]string `json:"fields,omitempty" doc:"the problem with each invalid field"`
+}
+
+// Marks the requests of the group as v2, so that Respond envelopes their errors.
+func V2() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set(v2Key, true)
+		ctx.Next()
+	}
+}
+
+func respondData[T any](ctx *gin.Context, status int, value T) {
+	ctx.JSON(status, data[T]{Data: value})
+}
+
+// Responds with the created resource, which is at the id under the path of the request.
+func respondCreated[T any](ctx *gin.Context, id string, value T) {
+	ctx.Header("Location", path.Join(ctx.Request.URL.Path, id))
+	respondData(ctx, http.StatusCreated, value)
+}
+
+func respondPage[T any](ctx *gin.Context, items []T, limit int, next string) {
+	if items == nil {
+		items = []T{}
+	}
+	ctx.JSON(http.StatusOK, page[T]{Data: items, Page: pageRef{Limit: limit, Next: next}})
+}
+
+func respondNoContent(ctx *gin.Context) {
+	ctx.Status(http.StatusNoContent)
+}
+
+// The page of a collection asked for.
+type pageQuery struct {
+	Limit  int    `form:"limit" doc:"at most 200, 50 by default"`
+	Cursor string `form:"cursor" doc:"the next cursor of the previous page"`
+}
+
+func isValidPageLimit(limit int) (string, bool) {
+	if limit < 0 || limit > maxPageLimit {
+		return fmt.Sprintf("limit must be between 1 and %v, or 0 for the default", maxPageLimit), false
+	}
+	return "", true
+}
+
+// Returns the limit and the offset of the page.
+// The cursors of collections that are not queried from the database are offsets.
+func (q pageQuery) offset() (int, int, error) {
+	if msg, ok := isValidPageLimit(q.Limit); !ok {
+		return 0, 0, errs.Invalid("limit", msg)
+	}
+	limit := q.Limit
+	if limit == 0 {
+		limit = defaultPageLimit
+	}
+	if q.Cursor == "" {
+		return limit, 0, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return 0, 0, controllers.ErrInvalidCursor
+	}
+	offset, err := strconv.Atoi(string(decoded))
+	if err != nil || offset < 0 {
+		return 0, 0, controllers.ErrInvalidCursor
+	}
+	return limit, offset, nil
+}
+
+// Returns the page of the items at the offset, and the cursor of the next page if there are more items.
+func paginate[T any](items []T, limit, offset int) ([]T, string) {
+	if offset >= len(items) {
+		return []T{}, ""
+	}
+	end := offset + limit
+	if end >= len(items) {
+		return items[offset:], ""
+	}
+	return items[offset:end], base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+}
+
+// Responds with the page of the items asked for.
+func respondPaginated[T any](ctx *gin.Context, items []T) {
+	var query pageQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		Respond(ctx, errs.Validation(err.Error()))
+		return
+	}
+	limit, offset, err := query.offset()
+	if err != nil {
+		Respond(ctx, err)
+		return
+	}
+	items, next := paginate(items, limit, offset)
+	respondPage(ctx, items, limit, next)
+}
+
+// A user as seen by themselves.
+type v2Profile struct {
+	Id       string              `json:"id"`
+	Name     string              `json:"name"`
+	Email    string              `json:"email"`
+	Verified bool                `json:"verified"`
+	IsPublic bool                `json:"isPublic"`
+	Projects []string            `json:"projects" doc:"projectids"`
+	Settings models.UserSettings `json:"settings"`
+	Version  int64               `json:"version" doc:"the ETag of the user"`
+}
+
+func toProfile(user models.User) v2Profile {
+	return v2Profile{
+		Id:       user.Id.Hex(),
+		Name:     user.Name,
+		Email:    user.Email,
+		Verified: user.Verified,
+		IsPublic: user.IsPublic,
+		Projects: user.Projects,
+		Settings: user.Settings,
+		Version:  user.Version,
+	}
+}
+
+// A user as seen by others.
+type v2User struct {
+	Id       string   `json:"id"`
+	Name     string   `json:"name"`
+	Email    string   `json:"email"`
+	Projects []string `json:"projects" doc:"projectids"`
+}
+
+// A project, without its tasks and events, which are collections of their own.
+type v2Project struct {
+	Id           string                 `json:"id"`
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description"`
+	CreationTime time.Time              `json:"creationTime"`
+	IsPublic     bool                   `json:"isPublic"`
+	IsArchived   bool                   `json:"isArchived" doc:"archived projects are read-only"`
+	States       []models.WorkflowState `json:"states" doc:"the columns of the task board, in order"`
+	Role         string                 `json:"role" doc:"of the user in the project"`
+	Version      int64                  `json:"version" doc:"the ETag of the project"`
+}
+
+func toProject(project models.Project, userid string) v2Project {
+	return v2Project{
+		Id:           project.Id.Hex(),
+		Name:         project.Name,
+		Description:  project.Description,
+		CreationTime: project.CreationTime,
+		IsPublic:     project.IsPublic,
+		IsArchived:   project.IsArchived,
+		States:       project.Settings.WorkflowStates(),
+		Role:         project.Members[userid],
+		Version:      project.Version,
+	}
+}
+
+type v2Member struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// Returns the members of the project, sorted by name.
+func membersOfProject(ctx *gin.Context, userController controllers.UserController, project models.Project) []v2Member {
+	userids := []string{}
+	for userid := range project.Members {
+		userids = append(userids, userid)
+	}
+	members := []v2Member{}
+	for _, user := range userController.UserMapToArray(ctx, userids) {
+		members = append(members, v2Member{Id: user.Id.Hex(), Name: user.Name, Role: project.Members[user.Id.Hex()]})
+	}
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Name != members[j].Name {
+			return members[i].Name < members[j].Name
+		}
+		return members[i].Id < members[j].Id
+	})
+	return members
+}
+
+// Retrieves the project in the path, displaying an error if the user is not a member of it.
+func memberProject(ctx *gin.Context, projectController controllers.ProjectController, userid string) (models.Project, bool) {
+	project, err := projectController.ProjectRetrieve(ctx, ctx.Param("projectid"))
+	if err != nil {
+		Respond(ctx, errs.OrNotFound(err, "project does not exist"))
+		return project, false
+	}
+	if _, ok := project.Members[userid]; !ok {
+		Respond(ctx, errs.Forbidden("you lack permissions"))
+		return project, false
+	}
+	return project, true
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/functions"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/socket"
+	"github.com/gin-gonic/gin"
+)
+
+/*
+	Events are under /projects/:projectid/events, and personal events under /events.
+	Events do not know who they belong to, so they are looked up in the events of the project or user.
+*/
+
+// Returns the ids of the events of the project in the path, or of the user if there is none.
+// project is nil for personal events.
+func pathEvents(ctx *gin.Context, userController controllers.UserController, projectController controllers.ProjectController, userid string) ([]string, *models.Project, bool) {
+	if ctx.Param("projectid") != "" {
+		project, ok := memberProject(ctx, projectController, userid)
+		if !ok {
+			return nil, nil, false
+		}
+		return project.Events, &project, true
+	}
+	user, err := userController.UserRetrieve(ctx, userid, "")
+	if err != nil {
+		Respond(ctx, errs.OrNotFound(err, "user does not exist"))
+		return nil, nil, false
+	}
+	return user.Events, nil, true
+}
+
+// Retrieves the event in the path, displaying an error if it is not one of the events of the project or user.
+func pathEvent(ctx *gin.Context, userController controllers.UserController, projectController controllers.ProjectController, eventController controllers.EventController, userid string) (models.Event, *models.Project, bool) {
+	eventids, project, ok := pathEvents(ctx, userController, projectController, userid)
+	if !ok {
+		return models.Event{}, nil, false
+	}
+	eventid := ctx.Param("eventid")
+	if !functions.Contains(eventids, eventid) {
+		Respond(ctx, errs.NotFound("event does not exist"))
+		return models.Event{}, nil, false
+	}
+	event, err := eventController.EventGet(ctx, eventid)
+	if err != nil {
+		Respond(ctx, errs.OrNotFound(err, "event does not exist"))
+		return models.Event{}, nil, false
+	}
+	return *event, project, true
+}
+
+// GET /projects/:projectid/events and GET /events
+// Returns a page of the events, by start time.
+func V2EventList(userController controllers.UserController, projectController controllers.ProjectController, eventController controllers.EventController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		eventids, _, ok := pathEvents(ctx, userController, projectController, id)
+		if !ok {
+			return
+		}
+		events := []models.Event{}
+		for _, event := range eventController.EventMapToArray(ctx, eventids) {
+			if !event.Id.IsZero() {
+				events = append(events, event)
+			}
+		}
+		sort.Slice(events, func(i, j int) bool {
+			if !events[i].Start.Equal(events[j].Start) {
+				return events[i].Start.Before(events[j].Start)
+			}
+			return events[i].Id.Hex() < events[j].Id.Hex()
+		})
+		respondPaginated(ctx, events)
+	}
+}
+
+// Times of events are ISO 8601.
+type eventInput struct {
+	Name  string `bson:"name" json:"name" required:"true"`
+	Start string `bson:"start" json:"start" required:"true" doc:"ISO 8601"`
+	End   string `bson:"end" json:"end" required:"true" doc:"ISO 8601"`
+}
+
+// POST /projects/:projectid/events and POST /events
+func V2EventCreate(userController controllers.UserController, projectController controllers.ProjectController, eventController controllers.EventController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var input eventInput
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		event, err := newEvent(input.Name, input.Start, input.End)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		_, project, ok := pathEvents(ctx, userController, projectController, id)
+		if !ok {
+			return
+		}
+		if project != nil && !checkProjectWritable(ctx, *project) {
+			return
+		}
+		if err := eventController.EventCreate(ctx, &event); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		eventids := []string{event.Id.Hex()}
+		if project == nil {
+			userController.UserAddEvents(ctx, id, eventids)
+		} else {
+			projectController.ProjectAddEvents(ctx, project.Id.Hex(), eventids)
+			publishActivity(ctx, project.Id.Hex(), id, socket.ActivityEventCreated, socket.EventPayload{Event: event})
+		}
+		setETag(ctx, event.Version)
+		respondCreated(ctx, event.Id.Hex(), event)
+	}
+}
+
+// GET /projects/:projectid/events/:eventid and GET /events/:eventid
+func V2EventGet(userController controllers.UserController, projectController controllers.ProjectController, eventController controllers.EventController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		event, _, ok := pathEvent(ctx, userController, projectController, eventController, id)
+		if !ok {
+			return
+		}
+		setETag(ctx, event.Version)
+		respondData(ctx, http.StatusOK, event)
+	}
+}
+
+// PATCH /projects/:projectid/events/:eventid and PATCH /events/:eventid
+// Changes the name or times given, only at the version in If-Match if there is one.
+func V2EventModify(userController controllers.UserController, projectController controllers.ProjectController, eventController controllers.EventController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query eventPatchBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		if query.Name != nil && *query.Name == "" {
+			Respond(ctx, errs.Invalid("name", "is required"))
+			return
+		}
+		version, err := ifMatch(ctx)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		event, project, ok := pathEvent(ctx, userController, projectController, eventController, id)
+		if !ok {
+			return
+		}
+		if project != nil && !checkProjectWritable(ctx, *project) {
+			return
+		}
+		if err := eventController.EventModify(ctx, event.Id, version, query.Name, query.Start, query.End); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		modified, err := eventController.EventGet(ctx, event.Id.Hex())
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		if project != nil {
+			publishActivity(ctx, project.Id.Hex(), id, socket.ActivityEventModified, socket.EventPayload{Event: *modified})
+		}
+		setETag(ctx, modified.Version)
+		respondData(ctx, http.StatusOK, *modified)
+	}
+}
+
+// DELETE /projects/:projectid/events/:eventid and DELETE /events/:eventid
+// Moves the event to the trash.
+func V2EventDelete(userController controllers.UserController, projectController controllers.ProjectController, eventController controllers.EventController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		event, project, ok := pathEvent(ctx, userController, projectController, eventController, id)
+		if !ok {
+			return
+		}
+		if project != nil && !checkProjectWritable(ctx, *project) {
+			return
+		}
+		version, err := ifMatch(ctx)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		if err := deleteEvent(ctx, userController, projectController, eventController, event.Id.Hex(), project, version, id); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		if project != nil {
+			publishActivity(ctx, project.Id.Hex(), id, socket.ActivityEventDeleted, socket.DeletedPayload{Ids: []string{event.Id.Hex()}})
+		}
+		respondNoContent(ctx)
+	}
+}
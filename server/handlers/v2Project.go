@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/socket"
+	"github.com/OrgaNiUS/OrgaNiUS/server/txn"
+	"github.com/gin-gonic/gin"
+)
+
+// GET /projects
+// Returns a page of the projects of the user.
+func V2ProjectList(userController controllers.UserController, projectController controllers.ProjectController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		user, err := userController.UserRetrieve(ctx, id, "")
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "user does not exist"))
+			return
+		}
+		projects := []v2Project{}
+		for _, project := range projectController.ProjectArrayToModel(ctx, user.Projects) {
+			projects = append(projects, toProject(project, id))
+		}
+		respondPaginated(ctx, projects)
+	}
+}
+
+// POST /projects
+func V2ProjectCreate(userController controllers.UserController, projectController controllers.ProjectController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query projectCreateBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		project := models.Project{Name: query.Name, Description: query.Description, IsPublic: query.IsPublic}
+		if err := createProject(ctx, userController, projectController, &project, id); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		created, err := projectController.ProjectRetrieve(ctx, project.Id.Hex())
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		setETag(ctx, created.Version)
+		respondCreated(ctx, project.Id.Hex(), toProject(created, id))
+	}
+}
+
+// GET /projects/:projectid
+func V2ProjectGet(projectController controllers.ProjectController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		project, ok := memberProject(ctx, projectController, id)
+		if !ok {
+			return
+		}
+		setETag(ctx, project.Version)
+		respondData(ctx, http.StatusOK, toProject(project, id))
+	}
+}
+
+// PATCH /projects/:projectid
+// Changes the name, description or visibility of the project, for admins, only at the version in If-Match if there is one.
+func V2ProjectModify(projectController controllers.ProjectController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var changes projectChanges
+		if err := ctx.ShouldBindJSON(&changes); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		version, err := ifMatch(ctx)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		project, ok := memberProject(ctx, projectController, id)
+		if !ok {
+			return
+		}
+		if err := modifyProject(ctx, projectController, project, version, changes, id); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		project, err = projectController.ProjectRetrieve(ctx, project.Id.Hex())
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		publishActivity(ctx, project.Id.Hex(), id, socket.ActivityProjectModified, toProjectPayload(project))
+		setETag(ctx, project.Version)
+		respondData(ctx, http.StatusOK, toProject(project, id))
+	}
+}
+
+// DELETE /projects/:projectid
+// Moves the project to the trash together with its tasks and events, for admins.
+func V2ProjectDelete(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, eventController controllers.EventController, runner *txn.Runner, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		project, ok := memberProject(ctx, projectController, id)
+		if !ok {
+			return
+		}
+		if !project.Settings.Roles[project.Members[id]].IsAdmin {
+			Respond(ctx, errs.Forbidden("lacking admin permissions to execute action"))
+			return
+		}
+		version, err := ifMatch(ctx)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		if err := deleteProject(ctx, runner, userController, projectController, taskController, eventController, project, version, id, time.Now()); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		publishActivity(ctx, project.Id.Hex(), id, socket.ActivityProjectDeleted, nil)
+		respondNoContent(ctx)
+	}
+}
+
+// GET /projects/:projectid/members
+// Returns a page of the members of the project, sorted by name.
+func V2MemberList(userController controllers.UserController, projectController controllers.ProjectController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		project, ok := memberProject(ctx, projectController, id)
+		if !ok {
+			return
+		}
+		respondPaginated(ctx, membersOfProject(ctx, userController, project))
+	}
+}
+
+// DELETE /projects/:projectid/members/:userid
+// Members can remove themselves, which is leaving the project, and admins can remove others.
+func V2MemberDelete(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, runner *txn.Runner, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		project, ok := memberProject(ctx, projectController, id)
+		if !ok {
+			return
+		}
+		userid := ctx.Param("userid")
+		if userid == "me" || userid == id {
+			user, err := userController.UserRetrieve(ctx, id, "")
+			if err != nil {
+				Respond(ctx, errs.OrNotFound(err, "user does not exist"))
+				return
+			}
+			if err := leaveProject(ctx, runner, userController, projectController, taskController, project, user); err != nil {
+				Respond(ctx, err)
+				return
+			}
+			publishMembers(ctx, userController, project.Id.Hex(), id, socket.ActivityMemberLeft, []string{id})
+			respondNoContent(ctx)
+			return
+		}
+		if !project.Settings.Roles[project.Members[id]].IsAdmin {
+			Respond(ctx, errs.Forbidden("lacking admin permissions to execute action"))
+			return
+		}
+		if _, ok := project.Members[userid]; !ok {
+			Respond(ctx, errs.NotFound("user is not a member of the project"))
+			return
+		}
+		if err := removeMembers(ctx, userController, projectController, project, []string{userid}); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		publishMembers(ctx, userController, project.Id.Hex(), id, socket.ActivityMemberLeft, []string{userid})
+		respondNoContent(ctx)
+	}
+}
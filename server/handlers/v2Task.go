@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/functions"
+	"github.com/OrgaNiUS/OrgaNiUS/server/mailer"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/socket"
+	"github.com/OrgaNiUS/OrgaNiUS/server/txn"
+	"github.com/gin-gonic/gin"
+)
+
+/*
+	Tasks are under /projects/:projectid/tasks, and personal tasks under /tasks.
+	The same handlers serve both, as the task of a path without a projectid is personal.
+*/
+
+// Retrieves the task in the path, displaying an error if it is not in the project of the path, or the user cannot access it.
+// Tasks are found in projects by the tasks of the project, as tasks created before they recorded their projectid have none.
+// project is nil for personal tasks.
+func pathTask(ctx *gin.Context, projectController controllers.ProjectController, taskController controllers.TaskController, userid string) (models.Task, *models.Project, bool) {
+	var project *models.Project
+	if ctx.Param("projectid") != "" {
+		retrieved, ok := memberProject(ctx, projectController, userid)
+		if !ok {
+			return models.Task{}, nil, false
+		}
+		project = &retrieved
+	}
+	taskid := ctx.Param("taskid")
+	task, err := taskController.TaskRetrieve(ctx, taskid)
+	if err != nil {
+		Respond(ctx, errs.OrNotFound(err, "task does not exist"))
+		return task, nil, false
+	}
+	inScope := task.IsPersonal
+	if project != nil {
+		inScope = !task.IsPersonal && functions.Contains(project.Tasks, taskid)
+	}
+	if task.DeletedAt != nil || !inScope {
+		Respond(ctx, errs.NotFound("task does not exist"))
+		return task, nil, false
+	}
+	if project == nil && !functions.Contains(task.AssignedTo, userid) {
+		Respond(ctx, errs.Forbidden("you lack permissions"))
+		return task, nil, false
+	}
+	return task, project, true
+}
+
+// Filters of the tasks listed, as in Task Query.
+type taskFilter struct {
+	AssignedTo   []string `form:"assignedTo" doc:"userids, any of whom is assigned"`
+	Tags         []string `form:"tags" doc:"all of which the tasks have"`
+	DeadlineFrom string   `form:"deadlineFrom" doc:"ISO 8601, inclusive"`
+	DeadlineTo   string   `form:"deadlineTo" doc:"ISO 8601, exclusive"`
+	IsDone       *bool    `form:"isDone"`
+	IsPersonal   *bool    `form:"isPersonal"`
+	Text         string   `form:"text" doc:"case insensitive match in the name or description"`
+	Sort         string   `form:"sort" doc:"field to sort on, prefixed with - for descending order"`
+	pageQuery
+}
+
+// GET /projects/:projectid/tasks and GET /tasks
+// Returns a page of the tasks of the project, or of the tasks assigned to the user, that match the filters.
+func V2TaskList(projectController controllers.ProjectController, taskController controllers.TaskController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var filter taskFilter
+		if err := ctx.ShouldBindQuery(&filter); err != nil {
+			Respond(ctx, errs.Validation(err.Error()))
+			return
+		}
+		projectid := ctx.Param("projectid")
+		var project models.Project
+		if projectid != "" {
+			if project, ok = memberProject(ctx, projectController, id); !ok {
+				return
+			}
+		}
+		input := taskQueryInput{
+			ProjectId:    projectid,
+			AssignedTo:   filter.AssignedTo,
+			Tags:         filter.Tags,
+			DeadlineFrom: filter.DeadlineFrom,
+			DeadlineTo:   filter.DeadlineTo,
+			IsDone:       filter.IsDone,
+			IsPersonal:   filter.IsPersonal,
+			Text:         filter.Text,
+			Sort:         filter.Sort,
+			Limit:        filter.Limit,
+			Cursor:       filter.Cursor,
+		}
+		query, msg, ok := input.toTaskQuery(id)
+		if !ok {
+			Respond(ctx, errs.Validation(msg))
+			return
+		}
+		query.ProjectTasks = project.Tasks
+		tasks, cursor, err := taskController.TaskQuery(ctx, query)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		limit := query.Limit
+		if limit == 0 {
+			limit = controllers.DefaultTaskQueryLimit
+		}
+		respondPage(ctx, tasks, limit, cursor)
+	}
+}
+
+// POST /projects/:projectid/tasks and POST /tasks
+// Project tasks go to the bottom of the initial workflow state, and personal tasks are assigned to the user.
+func V2TaskCreate(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, runner *txn.Runner, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var body taskBody
+		if err := ctx.ShouldBindJSON(&body); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		input := taskInput{taskBody: body, ProjectId: ctx.Param("projectid")}
+		if input.ProjectId != "" {
+			if _, ok := memberProject(ctx, projectController, id); !ok {
+				return
+			}
+		}
+		task, err := newTask(ctx, projectController, taskController, input, id)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		if err := createTask(ctx, runner, userController, projectController, taskController, &task); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		publishActivity(ctx, task.ProjectId, id, socket.ActivityTaskCreated, socket.TaskPayload{Task: task})
+		setETag(ctx, task.Version)
+		respondCreated(ctx, task.Id.Hex(), task)
+	}
+}
+
+// GET /projects/:projectid/tasks/:taskid and GET /tasks/:taskid
+func V2TaskGet(projectController controllers.ProjectController, taskController controllers.TaskController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		task, _, ok := pathTask(ctx, projectController, taskController, id)
+		if !ok {
+			return
+		}
+		setETag(ctx, task.Version)
+		respondData(ctx, http.StatusOK, task)
+	}
+}
+
+// PATCH /projects/:projectid/tasks/:taskid and PATCH /tasks/:taskid
+// Makes the changes given, as in Task Modify, only at the version in If-Match if there is one.
+func V2TaskModify(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var changes taskChanges
+		if err := ctx.ShouldBindJSON(&changes); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		version, err := ifMatch(ctx)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		task, project, ok := pathTask(ctx, projectController, taskController, id)
+		if !ok {
+			return
+		}
+		if project == nil && (changes.AddAssignedTo != nil || changes.RemoveAssignedTo != nil) {
+			Respond(ctx, errs.Validation("personal tasks cannot be reassigned"))
+			return
+		}
+		if err := modifyTask(ctx, userController, projectController, taskController, task, version, changes, id); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		task, err = taskController.TaskRetrieve(ctx, task.Id.Hex())
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		publishActivity(ctx, ctx.Param("projectid"), id, socket.ActivityTaskModified, socket.TaskPayload{Task: task})
+		setETag(ctx, task.Version)
+		respondData(ctx, http.StatusOK, task)
+	}
+}
+
+// Moves the task to the trash, removing it from its project and assignees.
+// project is the project the task belongs to, and nil for personal tasks.
+// If version is not nil, the task is only deleted if it is still at the version, which is checked first so that nothing else is changed otherwise.
+func deleteTask(ctx context.Context, userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, project *models.Project, task models.Task, version *int64, now time.Time) error {
+	taskid := task.Id.Hex()
+	projectid := ""
+	if project != nil {
+		projectid = project.Id.Hex()
+	}
+	if err := taskController.TaskSoftDeleteOne(ctx, taskid, projectid, version, now); err != nil {
+		return err
+	}
+	if project != nil {
+		if err := projectController.ProjectDeleteTasks(ctx, projectid, []string{taskid}); err != nil {
+			return err
+		}
+	}
+	return userController.UsersRemoveTasks(ctx, task.AssignedTo, []string{taskid})
+}
+
+// DELETE /projects/:projectid/tasks/:taskid and DELETE /tasks/:taskid
+// Moves the task to the trash, for members who can remove tasks.
+func V2TaskDelete(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		task, project, ok := pathTask(ctx, projectController, taskController, id)
+		if !ok {
+			return
+		}
+		if err := canBulkModifyTask(project, task, controllers.TaskBulkDelete, nil, id); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		version, err := ifMatch(ctx)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		if err := deleteTask(ctx, userController, projectController, taskController, project, task, version, time.Now()); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		publishActivity(ctx, ctx.Param("projectid"), id, socket.ActivityTaskDeleted, socket.DeletedPayload{Ids: []string{task.Id.Hex()}})
+		respondNoContent(ctx)
+	}
+}
+
+// GET /projects/:projectid/tasks/:taskid/comments and GET /tasks/:taskid/comments
+// Returns a page of the comments of the task, oldest first. Replies reference their parent comment through parentid.
+func V2CommentList(projectController controllers.ProjectController, taskController controllers.TaskController, commentController controllers.CommentController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		task, _, ok := pathTask(ctx, projectController, taskController, id)
+		if !ok {
+			return
+		}
+		comments, err := commentController.CommentGetAll(ctx, task.Id.Hex())
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		respondPaginated(ctx, comments)
+	}
+}
+
+// POST /projects/:projectid/tasks/:taskid/comments and POST /tasks/:taskid/comments
+// Mentioned users who can access the task are notified by email.
+func V2CommentCreate(userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, commentController controllers.CommentController, jwtParser *auth.JWTParser, mailer *mailer.Mailer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, name, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var query commentBody
+		if err := ctx.ShouldBindJSON(&query); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		task, _, ok := pathTask(ctx, projectController, taskController, id)
+		if !ok {
+			return
+		}
+		comment, err := createComment(ctx, userController, projectController, commentController, mailer, task, query.ParentId, query.Content, id, name)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		respondCreated(ctx, comment.Id.Hex(), comment)
+	}
+}
+
+// DELETE /projects/:projectid/tasks/:taskid/comments/:commentid and DELETE /tasks/:taskid/comments/:commentid
+// Only the author can delete their comment. Replies to it are kept.
+func V2CommentDelete(projectController controllers.ProjectController, taskController controllers.TaskController, commentController controllers.CommentController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		task, _, ok := pathTask(ctx, projectController, taskController, id)
+		if !ok {
+			return
+		}
+		comment, err := commentController.CommentRetrieve(ctx, ctx.Param("commentid"))
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "comment does not exist"))
+			return
+		}
+		if comment.TaskId != task.Id.Hex() {
+			Respond(ctx, errs.NotFound("comment does not exist"))
+			return
+		}
+		if comment.Author != id {
+			Respond(ctx, errs.Forbidden("you lack permissions"))
+			return
+		}
+		if err := commentController.CommentDelete(ctx, comment); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		respondNoContent(ctx)
+	}
+}
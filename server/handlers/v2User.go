@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/mailer"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/gin-gonic/gin"
+)
+
+// POST /users
+// Signs up, sending a pin to verify the email with through POST /api/v1/verify.
+func V2UserCreate(controller controllers.UserController, mailer *mailer.Mailer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var input signupBody
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		user := models.User{Name: input.Name, Password: input.Password, Email: input.Email}
+		if err := signup(ctx, controller, mailer, &user); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		respondCreated(ctx, user.Id.Hex(), toProfile(user))
+	}
+}
+
+// GET /users/:userid
+func V2UserGet(controller controllers.UserController) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		user, err := controller.UserRetrieve(ctx, ctx.Param("userid"), "")
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "user does not exist"))
+			return
+		}
+		respondData(ctx, http.StatusOK, v2User{Id: user.Id.Hex(), Name: user.Name, Email: user.Email, Projects: user.Projects})
+	}
+}
+
+// GET /users/me
+func V2UserGetSelf(controller controllers.UserController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		user, err := controller.UserRetrieve(ctx, id, "")
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "user does not exist"))
+			return
+		}
+		setETag(ctx, user.Version)
+		respondData(ctx, http.StatusOK, toProfile(user))
+	}
+}
+
+// PATCH /users/me
+// Changes the name, password or email, leaving out those that are empty, only at the version in If-Match if there is one.
+func V2UserModifySelf(controller controllers.UserController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, name, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		var changes userChanges
+		if err := ctx.ShouldBindJSON(&changes); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		version, err := ifMatch(ctx)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		if _, err := modifyUser(ctx, controller, id, name, version, changes); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		user, err := controller.UserRetrieve(ctx, id, "")
+		if err != nil {
+			Respond(ctx, errs.OrNotFound(err, "user does not exist"))
+			return
+		}
+		setETag(ctx, user.Version)
+		respondData(ctx, http.StatusOK, toProfile(user))
+	}
+}
+
+// DELETE /users/me
+func V2UserDeleteSelf(controller controllers.UserController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		id, _, ok := jwtParser.GetFromJWT(ctx)
+		if !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		if _, err := controller.UserRetrieve(ctx, id, ""); err != nil {
+			Respond(ctx, errs.OrNotFound(err, "user does not exist"))
+			return
+		}
+		version, err := ifMatch(ctx)
+		if err != nil {
+			Respond(ctx, err)
+			return
+		}
+		if err := controller.UserDelete(ctx, id, version); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		jwtParser.DeleteJWT(ctx)
+		respondNoContent(ctx)
+	}
+}
+
+// POST /sessions
+// Logs in, setting the JWT cookie.
+func V2SessionCreate(controller controllers.UserController, jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var input loginBody
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			Respond(ctx, invalidBody(err))
+			return
+		}
+		user := models.User{Name: input.Name, Password: input.Password}
+		if err := login(ctx, controller, jwtParser, &user); err != nil {
+			Respond(ctx, err)
+			return
+		}
+		ctx.Header("Location", "/api/v2/users/me")
+		respondData(ctx, http.StatusCreated, toProfile(user))
+	}
+}
+
+// DELETE /sessions
+// Logs out, deleting the JWT cookie.
+func V2SessionDelete(jwtParser *auth.JWTParser) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if _, _, ok := jwtParser.GetFromJWT(ctx); !ok {
+			Respond(ctx, errs.Unauthorized("not logged in"))
+			return
+		}
+		jwtParser.DeleteJWT(ctx)
+		respondNoContent(ctx)
+	}
+}
@@ -0,0 +1,305 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type v2Error struct {
+	Error struct {
+		Code    string            `json:"code"`
+		Message string            `json:"message"`
+		Fields  map[string]string `json:"fields"`
+	} `json:"error"`
+}
+
+type v2Project struct {
+	Data struct {
+		Id         string `json:"id"`
+		Name       string `json:"name"`
+		Role       string `json:"role"`
+		IsArchived bool   `json:"isArchived"`
+	} `json:"data"`
+}
+
+type v2Task struct {
+	Data struct {
+		Id        string `json:"id"`
+		Name      string `json:"name"`
+		ProjectId string `json:"projectid"`
+		State     string `json:"state"`
+		IsDone    bool   `json:"isDone"`
+	} `json:"data"`
+}
+
+type v2Page struct {
+	Data []struct {
+		Id   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"data"`
+	Page struct {
+		Limit int    `json:"limit"`
+		Next  string `json:"next"`
+	} `json:"page"`
+}
+
+func (s *memoryServer) createV2Project(t *testing.T, cookie *http.Cookie, name string) string {
+	t.Helper()
+	var created v2Project
+	w := s.v2(t, cookie, "POST", "/projects", nil, gin.H{"name": name}, &created)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected the project to be created, got %v", w.Code)
+	}
+	if location := w.Header().Get("Location"); location != "/api/v2/projects/"+created.Data.Id {
+		t.Errorf("Expected the location of the project but got %v", location)
+	}
+	return created.Data.Id
+}
+
+func TestV2Errors(t *testing.T) {
+	s := newMemoryServer(t)
+	_, cookie := s.signup(t, "errors")
+
+	var response v2Error
+	if w := s.v2(t, nil, "GET", "/projects", nil, nil, &response); w.Code != http.StatusUnauthorized || response.Error.Code != "unauthorized" || response.Error.Message == "" {
+		t.Errorf("Expected an enveloped unauthorized error but got %v %+v", w.Code, response)
+	}
+	response = v2Error{}
+	if w := s.v2(t, cookie, "GET", "/projects", url.Values{"limit": {"1000"}}, nil, &response); w.Code != http.StatusBadRequest || response.Error.Fields["limit"] == "" {
+		t.Errorf("Expected the limit to be invalid but got %v %+v", w.Code, response)
+	}
+	response = v2Error{}
+	if w := s.v2(t, cookie, "GET", "/projects", url.Values{"cursor": {"!"}}, nil, &response); w.Code != http.StatusBadRequest || response.Error.Code != "validation" {
+		t.Errorf("Expected the cursor to be invalid but got %v %+v", w.Code, response)
+	}
+}
+
+func TestV2Projects(t *testing.T) {
+	s := newMemoryServer(t)
+	admin, adminCookie := s.signup(t, "admin")
+	other, otherCookie := s.signup(t, "other")
+
+	first := s.createV2Project(t, adminCookie, "Project One")
+	second := s.createV2Project(t, adminCookie, "Project Two")
+
+	// one project per page
+	var page v2Page
+	if w := s.v2(t, adminCookie, "GET", "/projects", url.Values{"limit": {"1"}}, nil, &page); w.Code != http.StatusOK {
+		t.Fatalf("Expected the projects to be listed, got %v", w.Code)
+	}
+	if len(page.Data) != 1 || page.Data[0].Id != first || page.Page.Limit != 1 || page.Page.Next == "" {
+		t.Fatalf("Expected the first page to have the first project but got %+v", page)
+	}
+	next := page.Page.Next
+	page = v2Page{}
+	s.v2(t, adminCookie, "GET", "/projects", url.Values{"limit": {"1"}, "cursor": {next}}, nil, &page)
+	if len(page.Data) != 1 || page.Data[0].Id != second || page.Page.Next != "" {
+		t.Errorf("Expected the last page to have the second project but got %+v", page)
+	}
+
+	var project v2Project
+	if w := s.v2(t, adminCookie, "GET", "/projects/"+first, nil, nil, &project); w.Code != http.StatusOK || project.Data.Name != "Project One" || project.Data.Role != "admin" {
+		t.Errorf("Expected the project but got %v %+v", w.Code, project)
+	}
+	var response v2Error
+	if w := s.v2(t, otherCookie, "GET", "/projects/"+first, nil, nil, &response); w.Code != http.StatusForbidden || response.Error.Code != "forbidden" {
+		t.Errorf("Expected users outside the project to be forbidden but got %v %+v", w.Code, response)
+	}
+	if w := s.v2(t, adminCookie, "GET", "/projects/000000000000000000000000", nil, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a project that does not exist to be not found but got %v", w.Code)
+	}
+
+	project = v2Project{}
+	if w := s.v2(t, adminCookie, "PATCH", "/projects/"+first, nil, gin.H{"name": "Project Renamed"}, &project); w.Code != http.StatusOK || project.Data.Name != "Project Renamed" {
+		t.Errorf("Expected the project to be renamed but got %v %+v", w.Code, project)
+	}
+	if w := s.v2(t, adminCookie, "PATCH", "/projects/"+first, nil, gin.H{"name": "no"}, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected the name to be too short but got %v", w.Code)
+	}
+
+	// members
+	stored, _ := s.projectController.ProjectRetrieve(context.Background(), first)
+	stored.Members[other.Id.Hex()] = "member"
+	s.projectController.ProjectModifyUser(context.Background(), &stored)
+	page = v2Page{}
+	s.v2(t, otherCookie, "GET", "/projects/"+first+"/members", nil, nil, &page)
+	if len(page.Data) != 2 || page.Data[0].Id != admin.Id.Hex() || page.Data[1].Id != other.Id.Hex() {
+		t.Errorf("Expected the members by name but got %+v", page)
+	}
+	if w := s.v2(t, otherCookie, "DELETE", "/projects/"+first+"/members/"+admin.Id.Hex(), nil, nil, nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected members to not be able to remove others but got %v", w.Code)
+	}
+	if w := s.v2(t, adminCookie, "DELETE", "/projects/"+first+"/members/"+other.Id.Hex(), nil, nil, nil); w.Code != http.StatusNoContent {
+		t.Errorf("Expected the admin to remove the member but got %v", w.Code)
+	}
+
+	if w := s.v2(t, adminCookie, "DELETE", "/projects/"+second, nil, nil, nil); w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("Expected the project to be deleted without content but got %v %v", w.Code, w.Body.String())
+	}
+	page = v2Page{}
+	s.v2(t, adminCookie, "GET", "/projects", nil, nil, &page)
+	if len(page.Data) != 1 || page.Data[0].Id != first {
+		t.Errorf("Expected only the first project to be left but got %+v", page)
+	}
+}
+
+func TestV2Tasks(t *testing.T) {
+	s := newMemoryServer(t)
+	_, cookie := s.signup(t, "tasks")
+	_, otherCookie := s.signup(t, "other")
+	projectid := s.createV2Project(t, cookie, "Project One")
+
+	var task v2Task
+	w := s.v2(t, cookie, "POST", "/projects/"+projectid+"/tasks", nil, gin.H{"name": "project task"}, &task)
+	if w.Code != http.StatusCreated || task.Data.ProjectId != projectid || task.Data.State != "Backlog" {
+		t.Fatalf("Expected the task to be created in the project but got %v %+v", w.Code, task)
+	}
+	if location := w.Header().Get("Location"); location != "/api/v2/projects/"+projectid+"/tasks/"+task.Data.Id {
+		t.Errorf("Expected the location of the task but got %v", location)
+	}
+	taskPath := "/projects/" + projectid + "/tasks/" + task.Data.Id
+
+	var personal v2Task
+	if w := s.v2(t, cookie, "POST", "/tasks", nil, gin.H{"name": "personal task"}, &personal); w.Code != http.StatusCreated || personal.Data.ProjectId != "" {
+		t.Fatalf("Expected the personal task to be created but got %v %+v", w.Code, personal)
+	}
+
+	// each task is only at its own path
+	if w := s.v2(t, cookie, "GET", "/tasks/"+task.Data.Id, nil, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the project task to not be a personal task but got %v", w.Code)
+	}
+	if w := s.v2(t, cookie, "GET", "/projects/"+projectid+"/tasks/"+personal.Data.Id, nil, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the personal task to not be in the project but got %v", w.Code)
+	}
+	if w := s.v2(t, otherCookie, "GET", "/tasks/"+personal.Data.Id, nil, nil, nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected the personal task to be hidden from others but got %v", w.Code)
+	}
+
+	var page v2Page
+	s.v2(t, cookie, "GET", "/projects/"+projectid+"/tasks", nil, nil, &page)
+	if len(page.Data) != 1 || page.Data[0].Id != task.Data.Id {
+		t.Errorf("Expected the project task to be listed but got %+v", page)
+	}
+	page = v2Page{}
+	s.v2(t, cookie, "GET", "/tasks", url.Values{"isPersonal": {"true"}}, nil, &page)
+	if len(page.Data) != 1 || page.Data[0].Id != personal.Data.Id {
+		t.Errorf("Expected the personal task to be listed but got %+v", page)
+	}
+
+	task = v2Task{}
+	if w := s.v2(t, cookie, "PATCH", taskPath, nil, gin.H{"name": "renamed", "isDone": true}, &task); w.Code != http.StatusOK {
+		t.Fatalf("Expected the task to be modified but got %v", w.Code)
+	}
+	if task.Data.Name != "renamed" || !task.Data.IsDone || task.Data.State != "Done" {
+		t.Errorf("Expected the task to be renamed and done but got %+v", task)
+	}
+	if w := s.v2(t, cookie, "PATCH", "/tasks/"+personal.Data.Id, nil, gin.H{"addAssignedTo": []string{}}, nil); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected personal tasks to not be reassigned but got %v", w.Code)
+	}
+
+	if w := s.v2(t, cookie, "DELETE", taskPath, nil, nil, nil); w.Code != http.StatusNoContent {
+		t.Errorf("Expected the task to be deleted but got %v", w.Code)
+	}
+	if w := s.v2(t, cookie, "GET", taskPath, nil, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the deleted task to be not found but got %v", w.Code)
+	}
+}
+
+func TestV2Events(t *testing.T) {
+	s := newMemoryServer(t)
+	_, cookie := s.signup(t, "events")
+
+	for _, name := range []string{"later", "earlier"} {
+		start := "2030-01-02T10:00:00Z"
+		if name == "earlier" {
+			start = "2030-01-01T10:00:00Z"
+		}
+		if w := s.v2(t, cookie, "POST", "/events", nil, gin.H{"name": name, "start": start, "end": "2030-01-03T10:00:00Z"}, nil); w.Code != http.StatusCreated {
+			t.Fatalf("Expected the event to be created but got %v", w.Code)
+		}
+	}
+	var page v2Page
+	s.v2(t, cookie, "GET", "/events", nil, nil, &page)
+	if len(page.Data) != 2 || page.Data[0].Name != "earlier" || page.Data[1].Name != "later" {
+		t.Fatalf("Expected the events by start time but got %+v", page)
+	}
+
+	eventPath := "/events/" + page.Data[0].Id
+	var event struct {
+		Data struct {
+			Name string `json:"name"`
+		} `json:"data"`
+	}
+	if w := s.v2(t, cookie, "PATCH", eventPath, nil, gin.H{"name": "renamed"}, &event); w.Code != http.StatusOK || event.Data.Name != "renamed" {
+		t.Errorf("Expected the event to be renamed but got %v %+v", w.Code, event)
+	}
+	if w := s.v2(t, cookie, "DELETE", eventPath, nil, nil, nil); w.Code != http.StatusNoContent {
+		t.Errorf("Expected the event to be deleted but got %v", w.Code)
+	}
+	if w := s.v2(t, cookie, "DELETE", eventPath, nil, nil, nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected the deleted event to be not found but got %v", w.Code)
+	}
+}
+
+// Same as v2, with the If-Match header.
+func (s *memoryServer) v2IfMatch(t *testing.T, cookie *http.Cookie, etag, method, path string, body interface{}, response interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	return s.request(t, cookie, http.Header{"If-Match": {etag}}, method, "/api/v2"+path, nil, body, response)
+}
+
+func TestV2Versions(t *testing.T) {
+	s := newMemoryServer(t)
+	_, cookie := s.signup(t, "versions")
+	projectid := s.createV2Project(t, cookie, "Project One")
+
+	var task v2Task
+	s.v2(t, cookie, "POST", "/projects/"+projectid+"/tasks", nil, gin.H{"name": "task"}, &task)
+	taskPath := "/projects/" + projectid + "/tasks/" + task.Data.Id
+	w := s.v2(t, cookie, "GET", taskPath, nil, nil, nil)
+	etag := w.Header().Get("ETag")
+	if etag != `"0"` {
+		t.Fatalf("Expected the ETag of the new task but got %v", etag)
+	}
+
+	w = s.v2IfMatch(t, cookie, etag, "PATCH", taskPath, gin.H{"name": "first"}, nil)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"1"` {
+		t.Fatalf("Expected the task to be modified at its version but got %v %v", w.Code, w.Header().Get("ETag"))
+	}
+	// a client that read the task before the modification
+	var response v2Error
+	if w := s.v2IfMatch(t, cookie, etag, "PATCH", taskPath, gin.H{"name": "second"}, &response); w.Code != http.StatusPreconditionFailed || response.Error.Code != "precondition_failed" {
+		t.Errorf("Expected the stale modification to fail but got %v %+v", w.Code, response)
+	}
+	task = v2Task{}
+	if s.v2(t, cookie, "GET", taskPath, nil, nil, &task); task.Data.Name != "first" {
+		t.Errorf("Expected the stale modification to not be applied but got %+v", task)
+	}
+	for _, weak := range []string{`W/"1"`, "1", `"1", "2"`} {
+		if w := s.v2IfMatch(t, cookie, weak, "PATCH", taskPath, gin.H{"name": "second"}, nil); w.Code == http.StatusOK {
+			t.Errorf("Expected %v to not match the version", weak)
+		}
+	}
+	if w := s.v2IfMatch(t, cookie, "*", "PATCH", taskPath, gin.H{"name": "second"}, nil); w.Code != http.StatusOK {
+		t.Errorf("Expected * to match any version but got %v", w.Code)
+	}
+
+	if w := s.v2IfMatch(t, cookie, `"1"`, "DELETE", taskPath, nil, nil); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected the stale deletion to fail but got %v", w.Code)
+	}
+	etag = s.v2(t, cookie, "GET", taskPath, nil, nil, nil).Header().Get("ETag")
+	if w := s.v2IfMatch(t, cookie, etag, "DELETE", taskPath, nil, nil); w.Code != http.StatusNoContent {
+		t.Errorf("Expected the deletion at the current version to succeed but got %v", w.Code)
+	}
+
+	// projects are versioned in the same way, and every write to them changes their ETag
+	etag = s.v2(t, cookie, "GET", "/projects/"+projectid, nil, nil, nil).Header().Get("ETag")
+	s.v2(t, cookie, "POST", "/projects/"+projectid+"/tasks", nil, gin.H{"name": "another task"}, nil)
+	if w := s.v2IfMatch(t, cookie, etag, "PATCH", "/projects/"+projectid, gin.H{"name": "Project Renamed"}, nil); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected adding a task to change the version of the project but got %v", w.Code)
+	}
+}
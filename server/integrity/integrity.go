@@ -0,0 +1,341 @@
+// Finds references between users, projects, tasks and events that do not match, such as those left behind by partial failures, and repairs them.
+package integrity
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/functions"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+)
+
+/*
+	The assignees of tasks and the members of projects are taken to be correct, and the references back to them are repaired to match.
+	Documents in the trash keep their references so that they can be restored, so only references from documents outside the trash are checked.
+	References to documents in the trash are dangling, as deleting removes them.
+*/
+
+const (
+	// the referenced document does not exist, or is in the trash
+	Dangling = "dangling"
+	// the referenced document does not reference back
+	Asymmetric = "asymmetric"
+	// the document is not referenced by anything
+	Orphaned = "orphaned"
+)
+
+type Issue struct {
+	Kind       string `json:"kind"`
+	Collection string `json:"collection"` // of the document with the reference
+	Id         string `json:"id"`
+	Field      string `json:"field"`
+	Ref        string `json:"ref"`    // the referenced id
+	Repair     string `json:"repair"` // what repairing does, empty if it has to be repaired by hand
+	Repaired   bool   `json:"repaired"`
+	Error      string `json:"error,omitempty"` // why repairing failed
+
+	fix func(ctx context.Context) error
+}
+
+type Report struct {
+	Users    int     `json:"users"`
+	Projects int     `json:"projects"`
+	Tasks    int     `json:"tasks"`
+	Events   int     `json:"events"`
+	Issues   []Issue `json:"issues"`
+}
+
+// The references of the documents to check, together with the controllers used to repair them.
+type snapshot struct {
+	users    map[string]models.User
+	projects map[string]models.Project
+	tasks    map[string]models.Task
+	events   map[string]models.Event
+
+	userController    controllers.UserController
+	projectController controllers.ProjectController
+	taskController    controllers.TaskController
+	eventController   controllers.EventController
+
+	issues []Issue
+}
+
+func (s *snapshot) report(kind, collection, id, field, ref, repair string, fix func(ctx context.Context) error) {
+	s.issues = append(s.issues, Issue{
+		Kind:       kind,
+		Collection: collection,
+		Id:         id,
+		Field:      field,
+		Ref:        ref,
+		Repair:     repair,
+		fix:        fix,
+	})
+}
+
+func (s *snapshot) liveUser(id string) bool {
+	_, ok := s.users[id]
+	return ok
+}
+
+func (s *snapshot) liveProject(id string) bool {
+	project, ok := s.projects[id]
+	return ok && project.DeletedAt == nil
+}
+
+func (s *snapshot) liveTask(id string) bool {
+	task, ok := s.tasks[id]
+	return ok && task.DeletedAt == nil
+}
+
+func (s *snapshot) liveEvent(id string) bool {
+	event, ok := s.events[id]
+	return ok && event.DeletedAt == nil
+}
+
+func (s *snapshot) checkUser(user models.User) {
+	userid := user.Id.Hex()
+	for _, projectid := range user.Projects {
+		projectid := projectid
+		fix := func(ctx context.Context) error {
+			return s.userController.UsersDeleteProject(ctx, []string{userid}, projectid)
+		}
+		if !s.liveProject(projectid) {
+			s.report(Dangling, "users", userid, "projects", projectid, "remove the project from the user", fix)
+		} else if _, ok := s.projects[projectid].Members[userid]; !ok {
+			s.report(Asymmetric, "users", userid, "projects", projectid, "remove the project from the user", fix)
+		}
+	}
+	for _, taskid := range sortedKeys(user.Tasks) {
+		taskid := taskid
+		fix := func(ctx context.Context) error {
+			return s.userController.UsersRemoveTasks(ctx, []string{userid}, []string{taskid})
+		}
+		if !s.liveTask(taskid) {
+			s.report(Dangling, "users", userid, "tasks", taskid, "remove the task from the user", fix)
+		} else if !functions.Contains(s.tasks[taskid].AssignedTo, userid) {
+			s.report(Asymmetric, "users", userid, "tasks", taskid, "remove the task from the user", fix)
+		}
+	}
+	for _, eventid := range user.Events {
+		eventid := eventid
+		if !s.liveEvent(eventid) {
+			s.report(Dangling, "users", userid, "events", eventid, "remove the event from the user", func(ctx context.Context) error {
+				s.userController.UserRemoveEvents(ctx, user.Id, []string{eventid})
+				return nil
+			})
+		}
+	}
+	for _, projectid := range user.Invites {
+		projectid := projectid
+		if !s.liveProject(projectid) {
+			s.report(Dangling, "users", userid, "invites", projectid, "remove the invite from the user", func(ctx context.Context) error {
+				s.userController.UserDeleteInvites(ctx, userid, []string{projectid})
+				return nil
+			})
+		}
+	}
+}
+
+func (s *snapshot) checkProject(project models.Project) {
+	projectid := project.Id.Hex()
+	for _, userid := range sortedKeys(project.Members) {
+		userid := userid
+		if !s.liveUser(userid) {
+			s.report(Dangling, "projects", projectid, "members", userid, "remove the member from the project", func(ctx context.Context) error {
+				return s.projectController.ProjectRemoveMembers(ctx, project.Id, []string{userid})
+			})
+		} else if !functions.Contains(s.users[userid].Projects, projectid) {
+			s.report(Asymmetric, "projects", projectid, "members", userid, "add the project to the user", func(ctx context.Context) error {
+				return s.userController.UsersAddProject(ctx, []string{userid}, projectid)
+			})
+		}
+	}
+	for _, userid := range sortedKeys(project.Applications) {
+		userid := userid
+		if !s.liveUser(userid) {
+			s.report(Dangling, "projects", projectid, "applications", userid, "remove the application from the project", func(ctx context.Context) error {
+				s.projectController.ProjectRemoveAppl(ctx, projectid, []string{userid})
+				return nil
+			})
+		}
+	}
+	for _, taskid := range project.Tasks {
+		taskid := taskid
+		fix := func(ctx context.Context) error {
+			return s.projectController.ProjectDeleteTasks(ctx, projectid, []string{taskid})
+		}
+		if !s.liveTask(taskid) {
+			s.report(Dangling, "projects", projectid, "tasks", taskid, "remove the task from the project", fix)
+		} else if task := s.tasks[taskid]; task.ProjectId == "" && !task.IsPersonal {
+			// created before tasks recorded their project
+			s.report(Asymmetric, "projects", projectid, "tasks", taskid, "set the project of the task", func(ctx context.Context) error {
+				return s.taskController.TaskSetProject(ctx, taskid, projectid)
+			})
+		} else if task.ProjectId != projectid {
+			s.report(Asymmetric, "projects", projectid, "tasks", taskid, "remove the task from the project", fix)
+		}
+	}
+	for _, eventid := range project.Events {
+		eventid := eventid
+		if !s.liveEvent(eventid) {
+			s.report(Dangling, "projects", projectid, "events", eventid, "remove the event from the project", func(ctx context.Context) error {
+				s.projectController.ProjectRemoveEvents(ctx, project.Id, []string{eventid})
+				return nil
+			})
+		}
+	}
+}
+
+func (s *snapshot) checkTask(task models.Task) {
+	taskid := task.Id.Hex()
+	for _, userid := range task.AssignedTo {
+		userid := userid
+		if !s.liveUser(userid) {
+			s.report(Dangling, "tasks", taskid, "assignedTo", userid, "unassign the user from the task", func(ctx context.Context) error {
+				return s.taskController.TasksDeleteUser(ctx, []string{taskid}, userid)
+			})
+		} else if _, ok := s.users[userid].Tasks[taskid]; !ok {
+			s.report(Asymmetric, "tasks", taskid, "assignedTo", userid, "add the task to the user", func(ctx context.Context) error {
+				return s.userController.UsersAddTask(ctx, []string{userid}, taskid, task.IsPersonal)
+			})
+		}
+	}
+	if task.ProjectId == "" {
+		return
+	}
+	project, ok := s.projects[task.ProjectId]
+	if !ok {
+		s.report(Dangling, "tasks", taskid, "projectid", task.ProjectId, "", nil)
+	} else if project.DeletedAt != nil {
+		// moved to the trash together with its project, so that they are restored together
+		deletedAt := *project.DeletedAt
+		s.report(Dangling, "tasks", taskid, "projectid", task.ProjectId, "move the task to the trash with the project", func(ctx context.Context) error {
+			return s.taskController.TaskSoftDelete(ctx, []string{taskid}, task.ProjectId, deletedAt)
+		})
+	} else if !functions.Contains(project.Tasks, taskid) {
+		s.report(Asymmetric, "tasks", taskid, "projectid", task.ProjectId, "add the task to the project", func(ctx context.Context) error {
+			return s.projectController.ProjectAddTasks(ctx, task.ProjectId, []string{taskid})
+		})
+	}
+}
+
+// Events only have references to them, so events that nothing references cannot be reached.
+func (s *snapshot) checkEvents(now time.Time) {
+	referenced := map[string]bool{}
+	for _, user := range s.users {
+		for _, eventid := range user.Events {
+			referenced[eventid] = true
+		}
+	}
+	for _, project := range s.projects {
+		if project.DeletedAt != nil {
+			continue
+		}
+		for _, eventid := range project.Events {
+			referenced[eventid] = true
+		}
+	}
+	for _, eventid := range sortedKeys(s.events) {
+		eventid := eventid
+		if !s.liveEvent(eventid) || referenced[eventid] {
+			continue
+		}
+		s.report(Orphaned, "events", eventid, "", "", "move the event to the trash", func(ctx context.Context) error {
+			return s.eventController.EventSoftDelete(ctx, []string{eventid}, "", "", now)
+		})
+	}
+}
+
+// Finds the issues in the documents, in a stable order.
+func (s *snapshot) check(now time.Time) {
+	for _, userid := range sortedKeys(s.users) {
+		s.checkUser(s.users[userid])
+	}
+	for _, projectid := range sortedKeys(s.projects) {
+		if s.liveProject(projectid) {
+			s.checkProject(s.projects[projectid])
+		}
+	}
+	for _, taskid := range sortedKeys(s.tasks) {
+		if s.liveTask(taskid) {
+			s.checkTask(s.tasks[taskid])
+		}
+	}
+	s.checkEvents(now)
+}
+
+// Checks the references between all documents, repairing the issues found if repair is set.
+// Issues that fail to be repaired are reported with the error, and the rest are still repaired.
+func Check(ctx context.Context, userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, eventController controllers.EventController, repair bool) (Report, error) {
+	s := &snapshot{
+		users:             map[string]models.User{},
+		projects:          map[string]models.Project{},
+		tasks:             map[string]models.Task{},
+		events:            map[string]models.Event{},
+		userController:    userController,
+		projectController: projectController,
+		taskController:    taskController,
+		eventController:   eventController,
+	}
+	// only the references are kept, see the controllers
+	err := userController.UsersEach(ctx, func(user models.User) {
+		s.users[user.Id.Hex()] = user
+	})
+	if err != nil {
+		return Report{}, err
+	}
+	err = projectController.ProjectsEach(ctx, func(project models.Project) {
+		s.projects[project.Id.Hex()] = project
+	})
+	if err != nil {
+		return Report{}, err
+	}
+	err = taskController.TasksEach(ctx, func(task models.Task) {
+		s.tasks[task.Id.Hex()] = task
+	})
+	if err != nil {
+		return Report{}, err
+	}
+	err = eventController.EventsEach(ctx, func(event models.Event) {
+		s.events[event.Id.Hex()] = event
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	s.check(time.Now())
+	if repair {
+		repairAll(ctx, s.issues)
+	}
+	return Report{
+		Users:    len(s.users),
+		Projects: len(s.projects),
+		Tasks:    len(s.tasks),
+		Events:   len(s.events),
+		Issues:   s.issues,
+	}, nil
+}
+
+func repairAll(ctx context.Context, issues []Issue) {
+	for i := range issues {
+		if issues[i].fix == nil {
+			continue
+		}
+		if err := issues[i].fix(ctx); err != nil {
+			issues[i].Error = err.Error()
+		} else {
+			issues[i].Repaired = true
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
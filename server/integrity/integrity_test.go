@@ -0,0 +1,203 @@
+package integrity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/testdb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func id(n byte) primitive.ObjectID {
+	var objectid primitive.ObjectID
+	objectid[11] = n
+	return objectid
+}
+
+func summarise(issues []Issue) []string {
+	summaries := []string{}
+	for _, issue := range issues {
+		summaries = append(summaries, fmt.Sprintf("%v %v %v.%v %v", issue.Kind, issue.Collection, issue.Id, issue.Field, issue.Ref))
+	}
+	return summaries
+}
+
+func TestCheck(t *testing.T) {
+	deletedAt := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	// users 1 to 3, projects 11 to 13, tasks 21 to 25, events 31 to 33
+	user1, user2, user3 := id(1), id(2), id(3)
+	missing := id(9).Hex()
+	project1, project2, project3 := id(11), id(12), id(13)
+	task1, task2, task3, task4, task5 := id(21), id(22), id(23), id(24), id(25)
+	event1, event2, event3 := id(31), id(32), id(33)
+
+	s := &snapshot{
+		users: map[string]models.User{
+			user1.Hex(): {
+				Id:       user1,
+				Projects: []string{project1.Hex(), project2.Hex()},
+				Tasks:    map[string]bool{task1.Hex(): false, task2.Hex(): false},
+				Events:   []string{event1.Hex(), event2.Hex()},
+			},
+			user2.Hex(): {
+				Id:      user2,
+				Tasks:   map[string]bool{task3.Hex(): true},
+				Invites: []string{missing},
+			},
+			user3.Hex(): {Id: user3},
+		},
+		projects: map[string]models.Project{
+			project1.Hex(): {
+				Id:           project1,
+				Members:      map[string]string{user1.Hex(): "admin", missing: "member"},
+				Tasks:        []string{task1.Hex(), task5.Hex()},
+				Applications: map[string]models.ProjectApplication{missing: {}},
+			},
+			project2.Hex(): {
+				Id:      project2,
+				Members: map[string]string{user3.Hex(): "admin"},
+				Events:  []string{event3.Hex()},
+			},
+			// in the trash, so its references are not checked
+			project3.Hex(): {
+				Id:        project3,
+				Members:   map[string]string{missing: "admin"},
+				Tasks:     []string{task4.Hex()},
+				DeletedAt: &deletedAt,
+			},
+		},
+		tasks: map[string]models.Task{
+			task1.Hex(): {Id: task1, ProjectId: project1.Hex(), AssignedTo: []string{user1.Hex(), user2.Hex()}},
+			task2.Hex(): {Id: task2, ProjectId: project1.Hex(), AssignedTo: []string{}},
+			task3.Hex(): {Id: task3, IsPersonal: true, AssignedTo: []string{user2.Hex(), missing}},
+			task4.Hex(): {Id: task4, ProjectId: project3.Hex()},
+			task5.Hex(): {Id: task5, ProjectId: project1.Hex(), DeletedAt: &deletedAt},
+		},
+		events: map[string]models.Event{
+			event1.Hex(): {Id: event1},
+			event2.Hex(): {Id: event2, DeletedAt: &deletedAt},
+			event3.Hex(): {Id: event3, DeletedAt: &deletedAt},
+		},
+	}
+	// not referenced by anything
+	orphan := id(34)
+	s.events[orphan.Hex()] = models.Event{Id: orphan}
+
+	s.check(time.Now())
+
+	expected := []string{
+		fmt.Sprintf("asymmetric users %v.projects %v", user1.Hex(), project2.Hex()),
+		fmt.Sprintf("asymmetric users %v.tasks %v", user1.Hex(), task2.Hex()),
+		fmt.Sprintf("dangling users %v.events %v", user1.Hex(), event2.Hex()),
+		fmt.Sprintf("dangling users %v.invites %v", user2.Hex(), missing),
+		fmt.Sprintf("dangling projects %v.members %v", project1.Hex(), missing),
+		fmt.Sprintf("dangling projects %v.applications %v", project1.Hex(), missing),
+		fmt.Sprintf("dangling projects %v.tasks %v", project1.Hex(), task5.Hex()),
+		fmt.Sprintf("asymmetric projects %v.members %v", project2.Hex(), user3.Hex()),
+		fmt.Sprintf("dangling projects %v.events %v", project2.Hex(), event3.Hex()),
+		fmt.Sprintf("asymmetric tasks %v.assignedTo %v", task1.Hex(), user2.Hex()),
+		fmt.Sprintf("asymmetric tasks %v.projectid %v", task2.Hex(), project1.Hex()),
+		fmt.Sprintf("dangling tasks %v.assignedTo %v", task3.Hex(), missing),
+		fmt.Sprintf("dangling tasks %v.projectid %v", task4.Hex(), project3.Hex()),
+		fmt.Sprintf("orphaned events %v. ", orphan.Hex()),
+	}
+	if actual := summarise(s.issues); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected\n%v\nbut got\n%v", expected, actual)
+	}
+	for _, issue := range s.issues {
+		if issue.Repair == "" || issue.fix == nil {
+			t.Errorf("Expected %v to be repairable", summarise([]Issue{issue}))
+		}
+	}
+}
+
+func TestCheckTaskOfMissingProject(t *testing.T) {
+	task := id(21)
+	s := &snapshot{
+		tasks: map[string]models.Task{task.Hex(): {Id: task, ProjectId: id(11).Hex()}},
+	}
+	s.check(time.Now())
+	if len(s.issues) != 1 || s.issues[0].Kind != Dangling || s.issues[0].fix != nil {
+		t.Errorf("Expected a dangling projectid to be repaired by hand, got %v", s.issues)
+	}
+}
+
+func TestCheckLegacyProjectTask(t *testing.T) {
+	ctx := context.Background()
+	database := testdb.New()
+	userController := controllers.NewU(database, "", nil)
+	projectController := controllers.NewP(database, "", nil)
+	taskController := controllers.NewT(database, "")
+	eventController := controllers.NewE(database, "")
+
+	legacy := models.Task{Name: "legacy", AssignedTo: []string{}}
+	moved := models.Task{Name: "moved", AssignedTo: []string{}, ProjectId: id(12).Hex()}
+	for _, task := range []*models.Task{&legacy, &moved} {
+		if err := taskController.TaskCreate(ctx, task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	project := models.Project{Name: "project"}
+	if err := projectController.ProjectCreate(ctx, &project, id(1).Hex()); err != nil {
+		t.Fatal(err)
+	}
+	projectid := project.Id
+	if err := projectController.ProjectAddTasks(ctx, projectid.Hex(), []string{legacy.Id.Hex(), moved.Id.Hex()}); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Check(ctx, *userController, *projectController, *taskController, *eventController, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Tasks != 2 || report.Projects != 1 {
+		t.Errorf("Expected every document to be checked, got %+v", report)
+	}
+
+	// the task without a project is given the one listing it, and the task of another project is removed from it
+	stored, _ := taskController.TaskRetrieve(ctx, legacy.Id.Hex())
+	if stored.ProjectId != projectid.Hex() {
+		t.Errorf("Expected the legacy task to be set to the project but got %q", stored.ProjectId)
+	}
+	storedProject, _ := projectController.ProjectRetrieve(ctx, projectid.Hex())
+	if !reflect.DeepEqual(storedProject.Tasks, []string{legacy.Id.Hex()}) {
+		t.Errorf("Expected only the legacy task to remain in the project but got %v", storedProject.Tasks)
+	}
+}
+
+func TestRepairAll(t *testing.T) {
+	fixed := 0
+	issues := []Issue{
+		{fix: func(ctx context.Context) error {
+			fixed++
+			return nil
+		}},
+		{fix: func(ctx context.Context) error {
+			return errors.New("write failed")
+		}},
+		// repaired by hand
+		{},
+		{fix: func(ctx context.Context) error {
+			fixed++
+			return nil
+		}},
+	}
+	repairAll(context.Background(), issues)
+
+	if fixed != 2 {
+		t.Errorf("Expected the issues after a failure to be repaired")
+	}
+	repaired := []bool{issues[0].Repaired, issues[1].Repaired, issues[2].Repaired, issues[3].Repaired}
+	if !reflect.DeepEqual(repaired, []bool{true, false, false, true}) {
+		t.Errorf("Expected %v but got %v", []bool{true, false, false, true}, repaired)
+	}
+	if issues[1].Error != "write failed" {
+		t.Errorf("Expected the error to be reported but got %q", issues[1].Error)
+	}
+}
@@ -0,0 +1,154 @@
+// Structured logging with log/slog, with the id of the request being served added to each record.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/config"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Attributes with these words in their key are redacted, such as "password", "newPin", "jwt_token" and "X-Api-Key".
+// Only whole words of the key are matched, so that "ping" and "pinned" are kept.
+var sensitive = map[string]bool{"password": true, "pin": true, "secret": true, "token": true, "jwt": true, "cookie": true, "authorization": true, "apikey": true}
+
+const redacted = "REDACTED"
+
+func isSensitive(key string) bool {
+	words := keyWords(key)
+	for i, word := range words {
+		// "api" and "key" together, as in "api_key"
+		if i+1 < len(words) && sensitive[word+words[i+1]] {
+			return true
+		}
+		if sensitive[word] || sensitive[strings.TrimSuffix(word, "s")] {
+			return true
+		}
+	}
+	return false
+}
+
+// Splits the key into lowercase words at separators and at the start of each capitalised word, so "newJWTToken" is "new", "jwt" and "token".
+func keyWords(key string) []string {
+	words := []string{}
+	word := []rune{}
+	runes := []rune(key)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(word) > 0 {
+				words = append(words, strings.ToLower(string(word)))
+				word = word[:0]
+			}
+			continue
+		}
+		if unicode.IsUpper(r) && len(word) > 0 {
+			previous := runes[i-1]
+			// "newPin", or the end of an acronym as in "JWTToken"
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				words = append(words, strings.ToLower(string(word)))
+				word = word[:0]
+			}
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		words = append(words, strings.ToLower(string(word)))
+	}
+	return words
+}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	if isSensitive(a.Key) && a.Value.Kind() != slog.KindGroup {
+		return slog.String(a.Key, redacted)
+	}
+	return a
+}
+
+// Adds the request id and trace id in the context to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if ctx != nil {
+		if span := trace.SpanContextFromContext(tracing.Context(ctx)); span.IsValid() {
+			r.AddAttrs(slog.String("trace_id", span.TraceID().String()), slog.String("span_id", span.SpanID().String()))
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+func level(name string) slog.Level {
+	switch name {
+	case config.LevelDebug:
+		return slog.LevelDebug
+	case config.LevelWarn:
+		return slog.LevelWarn
+	case config.LevelError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// Returns a logger that writes to w.
+func NewLogger(w io.Writer, cfg config.Log) *slog.Logger {
+	options := &slog.HandlerOptions{Level: level(cfg.Level), ReplaceAttr: redact}
+	var handler slog.Handler
+	if cfg.Format == config.FormatText {
+		handler = slog.NewTextHandler(w, options)
+	} else {
+		handler = slog.NewJSONHandler(w, options)
+	}
+	return slog.New(contextHandler{handler})
+}
+
+// Returns a logger writing to the sink in the config, which is closed by the returned io.Closer.
+// Files are rotated once they reach the maximum size.
+func New(cfg config.Log) (*slog.Logger, io.Closer, error) {
+	var w io.WriteCloser
+	switch cfg.File {
+	case "-", "stderr":
+		w = nopCloser{os.Stderr}
+	case "stdout":
+		w = nopCloser{os.Stdout}
+	default:
+		// Create the logs directory if it does not exist.
+		if err := os.MkdirAll(filepath.Dir(cfg.File), os.ModePerm); err != nil {
+			return nil, nil, err
+		}
+		w = &lumberjack.Logger{
+			Filename:   cfg.File,
+			MaxSize:    cfg.MaxSizeMB,
+			MaxBackups: cfg.MaxBackups,
+			MaxAge:     cfg.MaxAgeDays,
+		}
+	}
+	return NewLogger(w, cfg), w, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
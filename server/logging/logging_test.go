@@ -0,0 +1,118 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/config"
+	"github.com/gin-gonic/gin"
+)
+
+func records(t *testing.T, b *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	parsed := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(b.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected JSON, got %q", line)
+		}
+		parsed = append(parsed, record)
+	}
+	return parsed
+}
+
+func TestRedaction(t *testing.T) {
+	var b bytes.Buffer
+	logger := NewLogger(&b, config.Log{Level: config.LevelInfo, Format: config.FormatJSON})
+	logger.Info("signup", "name", "alice", "password", "hunter2", slog.Group("user", "newPin", "123456"), "jwt_token", "abc")
+	logger.Debug("hidden below the level")
+
+	logged := b.String()
+	for _, secret := range []string{"hunter2", "123456", `"abc"`, "hidden"} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("Expected %v not to be logged in %v", secret, logged)
+		}
+	}
+	parsed := records(t, &b)
+	if len(parsed) != 1 || parsed[0]["name"] != "alice" || parsed[0]["password"] != redacted {
+		t.Errorf("Expected the other fields to be kept, got %v", parsed)
+	}
+}
+
+func TestIsSensitive(t *testing.T) {
+	tests := map[string]bool{
+		"password":      true,
+		"newPin":        true,
+		"jwt_token":     true,
+		"X-Api-Key":     true,
+		"apiKey":        true,
+		"Authorization": true,
+		"set-cookie":    true,
+		"JWTToken":      true,
+		"pins":          true,
+		"ping":          false,
+		"pinned":        false,
+		"spinner":       false,
+		"tokenizer":     false,
+		"name":          false,
+		"keywords":      false,
+	}
+	for key, expected := range tests {
+		if actual := isSensitive(key); actual != expected {
+			t.Errorf("Expected %v for %q but got %v", expected, key, actual)
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var b bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(NewLogger(&b, config.Log{Level: config.LevelDebug, Format: config.FormatJSON}))
+	defer slog.SetDefault(previous)
+
+	router := gin.New()
+	router.Use(RequestIDMiddleware(), AccessLog())
+	router.GET("/ping", func(ctx *gin.Context) {
+		// controllers are given the *gin.Context, and goroutines the context of the request
+		slog.InfoContext(ctx, "from gin")
+		slog.InfoContext(ctx.Request.Context(), "from request")
+	})
+
+	tests := map[string]bool{
+		"abc-123":                true,
+		"":                       false,
+		"has spaces":             false,
+		strings.Repeat("a", 100): false,
+	}
+	for header, kept := range tests {
+		b.Reset()
+		w := httptest.NewRecorder()
+		request := httptest.NewRequest("GET", "/ping?pin=123456", nil)
+		request.Header.Set(RequestIDHeader, header)
+		router.ServeHTTP(w, request)
+
+		id := w.Header().Get(RequestIDHeader)
+		if kept && id != header || !kept && (id == header || !validRequestID(id)) {
+			t.Errorf("Expected the id %q to be kept: %v, got %q", header, kept, id)
+		}
+		parsed := records(t, &b)
+		if len(parsed) != 3 {
+			t.Fatalf("Expected 3 records, got %v", parsed)
+		}
+		for _, record := range parsed {
+			if record["request_id"] != id {
+				t.Errorf("Expected %v to have the request id %v", record, id)
+			}
+		}
+		if parsed[2]["msg"] != "request" || parsed[2]["route"] != "/ping" || strings.Contains(b.String(), "123456") {
+			t.Errorf("Expected the request to be logged without the query, got %v", parsed[2])
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package mailer
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -16,7 +17,7 @@ Regards,
 OrgaNiUS Team`
 )
 
-func (m *Mailer) SendForgotPW(name, email, pin string) error {
+func (m *Mailer) SendForgotPW(ctx context.Context, name, email, pin string) error {
 	body := fmt.Sprintf(ForgotPWFormat, name, pin)
-	return m.Send(name, email, ForgotPWSubject, body)
+	return m.Send(ctx, name, email, ForgotPWSubject, body)
 }
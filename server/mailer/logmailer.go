@@ -0,0 +1,39 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/sendgrid/rest"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// Logs emails instead of sending them, for development without a SendGrid key.
+type LogClient struct{}
+
+func (c *LogClient) Send(email *mail.SGMailV3) (*rest.Response, error) {
+	return c.SendWithContext(context.Background(), email)
+}
+
+func (c *LogClient) SendWithContext(ctx context.Context, email *mail.SGMailV3) (*rest.Response, error) {
+	to := []string{}
+	for _, p := range email.Personalizations {
+		for _, address := range p.To {
+			to = append(to, address.Address)
+		}
+	}
+	body := ""
+	if len(email.Content) > 0 {
+		body = email.Content[0].Value
+	}
+	slog.InfoContext(ctx, "email", "to", to, "subject", email.Subject, "body", body)
+	return &rest.Response{StatusCode: http.StatusAccepted}, nil
+}
+
+func NewLog(name, sender string) *Mailer {
+	return &Mailer{
+		Sender: mail.NewEmail(name, sender),
+		Client: &LogClient{},
+	}
+}
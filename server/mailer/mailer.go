@@ -2,11 +2,18 @@ package mailer
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
+	"net/http"
 
+	"github.com/OrgaNiUS/OrgaNiUS/server/metrics"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
 	"github.com/sendgrid/rest"
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
 )
 
 type Client interface {
@@ -14,6 +21,30 @@ type Client interface {
 	SendWithContext(ctx context.Context, email *mail.SGMailV3) (*rest.Response, error)
 }
 
+// Implemented by clients that can check they are able to send, without sending an email.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Sends with SendGrid.
+type SendGridClient struct {
+	*sendgrid.Client
+	key string
+}
+
+// Checks that SendGrid can be reached and accepts the key.
+func (c *SendGridClient) Ping(ctx context.Context) error {
+	request := sendgrid.GetRequest(c.key, "/v3/scopes", "https://api.sendgrid.com")
+	response, err := sendgrid.MakeRequestWithContext(ctx, request)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("sendgrid responded with status %v", response.StatusCode)
+	}
+	return nil
+}
+
 type Mailer struct {
 	Sender *mail.Email
 	Client Client
@@ -22,19 +53,41 @@ type Mailer struct {
 func New(name, sender, key string) *Mailer {
 	return &Mailer{
 		Sender: mail.NewEmail(name, sender),
-		Client: sendgrid.NewSendClient(key),
+		Client: &SendGridClient{sendgrid.NewSendClient(key), key},
+	}
+}
+
+// Checks that the client is able to send, if it can tell.
+func (m *Mailer) Ping(ctx context.Context) error {
+	if pinger, ok := m.Client.(Pinger); ok {
+		return pinger.Ping(ctx)
 	}
+	return nil
 }
 
-func (m *Mailer) Send(name, address, subject, body string) error {
+func (m *Mailer) Send(ctx context.Context, name, address, subject, body string) error {
+	ctx, span := tracing.Start(ctx, "mailer.Send", attribute.String("subject", subject))
+	defer span.End()
+
 	from := m.Sender
 	to := mail.NewEmail(name, address)
 	// there is also a mail.NewSingleEmail() that accepts HTML content
 	message := mail.NewSingleEmailPlainText(from, subject, to, body)
-	_, err := m.Client.Send(message)
+	response, err := m.Client.SendWithContext(ctx, message)
 	if err != nil {
-		log.Printf("failed to send email: %v", err)
+		metrics.MailSent.WithLabelValues("failed").Inc()
+		tracing.Fail(span, err)
+		slog.ErrorContext(ctx, "failed to send email", "error", err)
 		return err
 	}
+	if response != nil && response.StatusCode >= http.StatusBadRequest {
+		// the email is not sent, but this is not reported to the user, as before
+		metrics.MailSent.WithLabelValues("rejected").Inc()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(response.StatusCode))
+		span.SetStatus(codes.Error, "rejected")
+		slog.ErrorContext(ctx, "email rejected", "status", response.StatusCode, "body", response.Body)
+		return nil
+	}
+	metrics.MailSent.WithLabelValues("sent").Inc()
 	return nil
 }
@@ -1,7 +1,12 @@
 package mailer_test
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"log"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/OrgaNiUS/OrgaNiUS/server/mailer"
@@ -20,7 +25,7 @@ func TestSend(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		mailer.Send(test.name, test.address, test.subject, test.body)
+		mailer.Send(context.Background(), test.name, test.address, test.subject, test.body)
 		subject := mail.Subject
 		content := mail.Content
 		body := content[0].Value
@@ -46,7 +51,7 @@ func TestSendVerification(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		mailer_.SendVerification(test.name, test.email, test.pin)
+		mailer_.SendVerification(context.Background(), test.name, test.email, test.pin)
 		if mail.Subject != mailer.SignupSubject {
 			t.Errorf("Expected subject %v but got %v", mailer.SignupSubject, mail.Subject)
 		}
@@ -71,7 +76,7 @@ func TestSendForgotPW(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		mailer_.SendForgotPW(test.name, test.email, test.pin)
+		mailer_.SendForgotPW(context.Background(), test.name, test.email, test.pin)
 		if mail.Subject != mailer.ForgotPWSubject {
 			t.Errorf("Expected subject %v but got %v", mailer.ForgotPWSubject, mail.Subject)
 		}
@@ -82,3 +87,44 @@ func TestSendForgotPW(t *testing.T) {
 		}
 	}
 }
+
+func TestSendMention(t *testing.T) {
+	mail, mailer_ := mailer.GetMock()
+
+	type sendData struct {
+		name, email, author, taskName, comment string
+	}
+
+	tests := []sendData{
+		{"name1", "xxxx@mail.com", "name2", "submit lab report", "@name1 can you take this?"},
+		{"name2", "yyyy@mail.com", "name1", "update progress log", "done, thanks @name2"},
+	}
+
+	for _, test := range tests {
+		mailer_.SendMention(context.Background(), test.name, test.email, test.author, test.taskName, test.comment)
+		if mail.Subject != mailer.MentionSubject {
+			t.Errorf("Expected subject %v but got %v", mailer.MentionSubject, mail.Subject)
+		}
+		actual := mail.Content[0].Value
+		expected := fmt.Sprintf(mailer.MentionFormat, test.name, test.author, test.taskName, test.comment)
+		if actual != expected {
+			t.Errorf("Expected body %v but got %v", expected, actual)
+		}
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	var b bytes.Buffer
+	log.SetOutput(&b)
+	defer log.SetOutput(os.Stderr)
+
+	if err := mailer.NewLog("OrgaNiUS", "team@organius.com").SendVerification(context.Background(), "name1", "xxxx@mail.com", "ABCDE0"); err != nil {
+		t.Fatal(err)
+	}
+	logged := b.String()
+	for _, expected := range []string{"xxxx@mail.com", mailer.SignupSubject, "ABCDE0"} {
+		if !strings.Contains(logged, expected) {
+			t.Errorf("Expected %v to be logged in %v", expected, logged)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	MentionSubject = "OrgaNiUS: You were mentioned in a comment"
+	MentionFormat  = `Hey %s!
+
+%s mentioned you in a comment on the task "%s":
+
+%s
+
+Regards,
+OrgaNiUS Team`
+)
+
+func (m *Mailer) SendMention(ctx context.Context, name, email, author, taskName, comment string) error {
+	body := fmt.Sprintf(MentionFormat, name, author, taskName, comment)
+	return m.Send(ctx, name, email, MentionSubject, body)
+}
@@ -12,12 +12,11 @@ type MockClient struct {
 }
 
 func (c *MockClient) Send(email *mail.SGMailV3) (*rest.Response, error) {
-	*c.lastSend = *email
-	return nil, nil
+	return c.SendWithContext(context.Background(), email)
 }
 
 func (c *MockClient) SendWithContext(ctx context.Context, email *mail.SGMailV3) (*rest.Response, error) {
-	// Not used.
+	*c.lastSend = *email
 	return nil, nil
 }
 
@@ -1,6 +1,7 @@
 package mailer
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -14,7 +15,7 @@ Regards,
 OrgaNiUS Team`
 )
 
-func (m *Mailer) SendVerification(name, email, pin string) error {
+func (m *Mailer) SendVerification(ctx context.Context, name, email, pin string) error {
 	body := fmt.Sprintf(SignupFormat, name, pin)
-	return m.Send(name, email, SignupSubject, body)
+	return m.Send(ctx, name, email, SignupSubject, body)
 }
@@ -0,0 +1,311 @@
+package memdb
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/search"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func runStage(documents []bson.D, name string, spec interface{}) ([]bson.D, error) {
+	switch name {
+	case "$match":
+		filter, ok := spec.(bson.D)
+		if !ok {
+			return nil, errors.New("the match filter must be an expression in an object")
+		}
+		matched := []bson.D{}
+		for _, document := range documents {
+			ok, err := match(document, filter)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				matched = append(matched, document)
+			}
+		}
+		return matched, nil
+	case "$sort":
+		by, ok := spec.(bson.D)
+		if !ok {
+			return nil, errors.New("the $sort key specification must be an object")
+		}
+		sortDocuments(documents, by)
+		return documents, nil
+	case "$skip", "$limit":
+		n, ok := toFloat(spec)
+		if !ok || n < 0 {
+			return nil, errors.New(name + " must be a non-negative number")
+		}
+		count := int64(n)
+		if name == "$skip" {
+			return page(documents, &count, nil), nil
+		}
+		if count == 0 {
+			return nil, errors.New("the limit must be positive")
+		}
+		return page(documents, nil, &count), nil
+	case "$project":
+		p, ok := spec.(bson.D)
+		if !ok {
+			return nil, errors.New("$project specification must be an object")
+		}
+		projected := make([]bson.D, len(documents))
+		for i, document := range documents {
+			var err error
+			if projected[i], err = project(document, p); err != nil {
+				return nil, err
+			}
+		}
+		return projected, nil
+	case "$search":
+		s, ok := spec.(bson.D)
+		if !ok {
+			return nil, errors.New("$search specification must be an object")
+		}
+		return searchStage(documents, s)
+	}
+	return nil, errors.New("unsupported pipeline stage: " + name)
+}
+
+// Whether the projection value includes the field, such as 1 or true, as opposed to 0 or false.
+func isInclusion(value interface{}) (include bool, isFlag bool) {
+	switch v := value.(type) {
+	case bool:
+		return v, true
+	}
+	if n, ok := toFloat(value); ok {
+		return n != 0, true
+	}
+	return false, false
+}
+
+// Applies a projection of find or $project.
+// Fields are either all included or all excluded, apart from _id which is included unless excluded.
+// Other values are expressions computing a new field, such as "$field" or {$toString: "$field"}.
+func project(document bson.D, projection bson.D) (bson.D, error) {
+	inclusive := false
+	excludeID := false
+	for _, field := range projection {
+		include, isFlag := isInclusion(field.Value)
+		if field.Key == "_id" && isFlag {
+			excludeID = !include
+			continue
+		}
+		if !isFlag || include {
+			inclusive = true
+		}
+	}
+
+	if !inclusive {
+		excluded := document
+		for _, field := range projection {
+			if include, isFlag := isInclusion(field.Value); isFlag && !include {
+				excluded = unsetPath(excluded, strings.Split(field.Key, ".")).(bson.D)
+			}
+		}
+		return excluded, nil
+	}
+
+	projected := bson.D{}
+	if !excludeID {
+		if id := idOf(document); id != nil {
+			projected = append(projected, bson.E{Key: "_id", Value: id})
+		}
+	}
+	for _, field := range projection {
+		if field.Key == "_id" {
+			if _, isFlag := isInclusion(field.Value); isFlag {
+				continue
+			}
+		}
+		var value interface{}
+		if include, isFlag := isInclusion(field.Value); isFlag {
+			if !include {
+				return nil, errors.New("cannot do exclusion on field " + field.Key + " in inclusion projection")
+			}
+			values := lookup(document, strings.Split(field.Key, "."))
+			if len(values) == 0 {
+				continue
+			}
+			value = values[0]
+		} else {
+			var err error
+			if value, err = evaluate(document, field.Value); err != nil {
+				return nil, err
+			}
+		}
+		updated, err := setPath(projected, strings.Split(field.Key, "."), value)
+		if err != nil {
+			return nil, err
+		}
+		projected = updated.(bson.D)
+	}
+	return projected, nil
+}
+
+// Evaluates an aggregation expression: a "$field" path, {$toString: expression}, or a literal.
+func evaluate(document bson.D, expression interface{}) (interface{}, error) {
+	switch e := expression.(type) {
+	case string:
+		if strings.HasPrefix(e, "$") {
+			values := lookup(document, strings.Split(e[1:], "."))
+			if len(values) == 0 {
+				return nil, nil
+			}
+			return values[0], nil
+		}
+		return e, nil
+	case bson.D:
+		if len(e) == 1 && e[0].Key == "$toString" {
+			value, err := evaluate(document, e[0].Value)
+			if err != nil {
+				return nil, err
+			}
+			return toString(value)
+		}
+		if isOperators(e) {
+			return nil, errors.New("unsupported expression: " + e[0].Key)
+		}
+	}
+	return expression, nil
+}
+
+func toString(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return v, nil
+	case primitive.ObjectID:
+		return v.Hex(), nil
+	case bool:
+		return fmt.Sprint(v), nil
+	case primitive.DateTime:
+		return v.Time().UTC().Format("2006-01-02T15:04:05.000Z"), nil
+	case int32, int64, float64:
+		return fmt.Sprint(v), nil
+	}
+	return nil, fmt.Errorf("unsupported conversion to string from %T", value)
+}
+
+/*
+	Atlas Search is approximated by matching the words of the query against the words of the field:
+	- autocomplete matches words starting with each word of the query, allowing fuzzy.maxEdits edits after fuzzy.prefixLength characters.
+	  With tokenOrder "sequential", the words have to be matched in order.
+	- text matches words equal to any word of the query, allowing the same edits.
+	Results are ordered by how closely they match, which is close to but not the same as Atlas' scores.
+*/
+
+type searchSpec struct {
+	paths   []string
+	query   string
+	options search.Options
+}
+
+func parseSearch(spec bson.D) (searchSpec, error) {
+	parsed := searchSpec{}
+	operator := ""
+	var options bson.D
+	for _, e := range spec {
+		switch e.Key {
+		case "index":
+			// indexes are not needed to search in memory
+		case "autocomplete", "text":
+			o, ok := e.Value.(bson.D)
+			if !ok {
+				return parsed, errors.New(e.Key + " must be an object")
+			}
+			operator = e.Key
+			options = o
+		default:
+			return parsed, errors.New("unsupported $search operator: " + e.Key)
+		}
+	}
+	if operator == "" {
+		return parsed, errors.New("$search needs an autocomplete or text operator")
+	}
+	parsed.options.Autocomplete = operator == "autocomplete"
+	for _, e := range options {
+		switch e.Key {
+		case "path":
+			switch path := e.Value.(type) {
+			case string:
+				parsed.paths = []string{path}
+			case bson.A:
+				for _, p := range path {
+					if s, ok := p.(string); ok {
+						parsed.paths = append(parsed.paths, s)
+					}
+				}
+			}
+		case "query":
+			parsed.query, _ = e.Value.(string)
+		case "tokenOrder":
+			parsed.options.Sequential = e.Value == "sequential"
+		case "fuzzy":
+			fuzzy, _ := e.Value.(bson.D)
+			parsed.options.MaxEdits = 2
+			for _, f := range fuzzy {
+				n, _ := toFloat(f.Value)
+				switch f.Key {
+				case "maxEdits":
+					parsed.options.MaxEdits = int(n)
+				case "prefixLength":
+					parsed.options.PrefixLength = int(n)
+				}
+			}
+		}
+	}
+	if len(parsed.paths) == 0 {
+		return parsed, errors.New("$search needs a path")
+	}
+	return parsed, nil
+}
+
+func searchStage(documents []bson.D, spec bson.D) ([]bson.D, error) {
+	s, err := parseSearch(spec)
+	if err != nil {
+		return nil, err
+	}
+	type result struct {
+		document bson.D
+		edits    int
+		// matching the start of the whole value ranks higher
+		atStart bool
+	}
+	results := []result{}
+	for _, document := range documents {
+		best := result{document: document, edits: -1}
+		for _, path := range s.paths {
+			for _, value := range expand(lookup(document, strings.Split(path, "."))) {
+				text, ok := value.(string)
+				if !ok {
+					continue
+				}
+				if edits := s.options.Score(s.query, text); edits >= 0 && (best.edits < 0 || edits < best.edits) {
+					best.edits = edits
+					best.atStart = search.AtStart(s.query, text)
+				}
+			}
+		}
+		if best.edits >= 0 {
+			results = append(results, best)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].edits != results[j].edits {
+			return results[i].edits < results[j].edits
+		}
+		return results[i].atStart && !results[j].atStart
+	})
+	matched := make([]bson.D, len(results))
+	for i, r := range results {
+		matched[i] = r.document
+	}
+	return matched, nil
+}
@@ -0,0 +1,457 @@
+package memdb
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Returns the values at the dotted path, following arrays of documents as MongoDB does.
+// Returns nothing if the path does not exist.
+func lookup(value interface{}, parts []string) []interface{} {
+	if len(parts) == 0 {
+		return []interface{}{value}
+	}
+	switch v := value.(type) {
+	case bson.D:
+		for _, e := range v {
+			if e.Key == parts[0] {
+				return lookup(e.Value, parts[1:])
+			}
+		}
+	case bson.M:
+		if field, ok := v[parts[0]]; ok {
+			return lookup(field, parts[1:])
+		}
+	case bson.A:
+		if i, err := strconv.Atoi(parts[0]); err == nil {
+			if i >= 0 && i < len(v) {
+				return lookup(v[i], parts[1:])
+			}
+			return nil
+		}
+		values := []interface{}{}
+		for _, element := range v {
+			if isDocument(element) {
+				values = append(values, lookup(element, parts)...)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func isDocument(value interface{}) bool {
+	switch value.(type) {
+	case bson.D, bson.M:
+		return true
+	}
+	return false
+}
+
+// Whether the value is a document of query operators, such as {$in: [...]}.
+func isOperators(value interface{}) bool {
+	d, ok := value.(bson.D)
+	return ok && len(d) > 0 && strings.HasPrefix(d[0].Key, "$")
+}
+
+// The values a condition on a field is tested against: the values themselves, and the elements of arrays.
+func expand(values []interface{}) []interface{} {
+	expanded := []interface{}{}
+	for _, value := range values {
+		expanded = append(expanded, value)
+		if array, ok := value.(bson.A); ok {
+			expanded = append(expanded, array...)
+		}
+	}
+	return expanded
+}
+
+// Whether the document matches the filter.
+func match(document bson.D, filter bson.D) (bool, error) {
+	for _, e := range filter {
+		ok, err := matchElement(document, e)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func subfilters(value interface{}, operator string) ([]bson.D, error) {
+	array, ok := value.(bson.A)
+	if !ok || len(array) == 0 {
+		return nil, errors.New(operator + " must be a nonempty array")
+	}
+	filters := make([]bson.D, len(array))
+	for i, element := range array {
+		f, ok := element.(bson.D)
+		if !ok {
+			return nil, errors.New(operator + " must be an array of documents")
+		}
+		filters[i] = f
+	}
+	return filters, nil
+}
+
+func matchElement(document bson.D, e bson.E) (bool, error) {
+	switch e.Key {
+	case "$and", "$or", "$nor":
+		filters, err := subfilters(e.Value, e.Key)
+		if err != nil {
+			return false, err
+		}
+		for _, f := range filters {
+			ok, err := match(document, f)
+			if err != nil {
+				return false, err
+			}
+			if e.Key == "$and" && !ok {
+				return false, nil
+			} else if e.Key == "$or" && ok {
+				return true, nil
+			} else if e.Key == "$nor" && ok {
+				return false, nil
+			}
+		}
+		return e.Key != "$or", nil
+	}
+	if strings.HasPrefix(e.Key, "$") {
+		return false, errors.New("unknown top level operator: " + e.Key)
+	}
+	return matchField(lookup(document, strings.Split(e.Key, ".")), e.Value)
+}
+
+// Whether the values of a field match the condition, which is either a value to equal or a document of operators.
+func matchField(values []interface{}, condition interface{}) (bool, error) {
+	if !isOperators(condition) {
+		return matchEqual(values, condition), nil
+	}
+	operators := condition.(bson.D)
+	for i := 0; i < len(operators); i++ {
+		operator := operators[i]
+		var ok bool
+		var err error
+		switch operator.Key {
+		case "$eq":
+			ok = matchEqual(values, operator.Value)
+		case "$ne":
+			ok = !matchEqual(values, operator.Value)
+		case "$gt", "$gte", "$lt", "$lte":
+			ok = matchCompare(values, operator.Key, operator.Value)
+		case "$in", "$nin":
+			array, isArray := operator.Value.(bson.A)
+			if !isArray {
+				return false, errors.New(operator.Key + " needs an array")
+			}
+			for _, element := range array {
+				if matchEqual(values, element) {
+					ok = true
+					break
+				}
+			}
+			if operator.Key == "$nin" {
+				ok = !ok
+			}
+		case "$all":
+			array, isArray := operator.Value.(bson.A)
+			if !isArray {
+				return false, errors.New("$all needs an array")
+			}
+			ok = len(array) > 0
+			for _, element := range array {
+				if !matchEqual(values, element) {
+					ok = false
+					break
+				}
+			}
+		case "$exists":
+			ok = (len(values) > 0) == truthy(operator.Value)
+		case "$size":
+			n, isNumber := toFloat(operator.Value)
+			if !isNumber {
+				return false, errors.New("$size needs a number")
+			}
+			for _, value := range values {
+				if array, isArray := value.(bson.A); isArray && float64(len(array)) == n {
+					ok = true
+				}
+			}
+		case "$regex":
+			pattern, isString := operator.Value.(string)
+			if regex, isRegex := operator.Value.(primitive.Regex); isRegex {
+				pattern, isString = regex.Pattern, true
+			}
+			if !isString {
+				return false, errors.New("$regex has to be a string")
+			}
+			flags := ""
+			// $options may follow $regex
+			if i+1 < len(operators) && operators[i+1].Key == "$options" {
+				flags, _ = operators[i+1].Value.(string)
+				i++
+			}
+			ok, err = matchRegex(values, primitive.Regex{Pattern: pattern, Options: flags})
+		case "$not":
+			ok, err = matchField(values, operator.Value)
+			ok = !ok
+		case "$elemMatch":
+			f, isDoc := operator.Value.(bson.D)
+			if !isDoc {
+				return false, errors.New("$elemMatch needs an Object")
+			}
+			ok, err = matchElemMatch(values, f)
+		default:
+			return false, errors.New("unknown operator: " + operator.Key)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// Equality as in {field: value}, where null also matches a missing field and arrays match if any element does.
+func matchEqual(values []interface{}, target interface{}) bool {
+	if regex, ok := target.(primitive.Regex); ok {
+		matched, _ := matchRegex(values, regex)
+		return matched
+	}
+	if target == nil && len(values) == 0 {
+		return true
+	}
+	for _, value := range expand(values) {
+		if equal(value, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchCompare(values []interface{}, operator string, target interface{}) bool {
+	for _, value := range expand(values) {
+		c, ok := compare(value, target)
+		if !ok {
+			continue
+		}
+		if (operator == "$gt" && c > 0) || (operator == "$gte" && c >= 0) || (operator == "$lt" && c < 0) || (operator == "$lte" && c <= 0) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRegex(values []interface{}, regex primitive.Regex) (bool, error) {
+	flags := ""
+	for _, option := range regex.Options {
+		// the options of MongoDB that Go also has
+		if strings.ContainsRune("ims", option) {
+			flags += string(option)
+		}
+	}
+	pattern := regex.Pattern
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, err
+	}
+	for _, value := range expand(values) {
+		if s, ok := value.(string); ok && compiled.MatchString(s) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchElemMatch(values []interface{}, filter bson.D) (bool, error) {
+	for _, value := range values {
+		array, ok := value.(bson.A)
+		if !ok {
+			continue
+		}
+		for _, element := range array {
+			var matched bool
+			var err error
+			if document, isDoc := element.(bson.D); isDoc && !isOperators(filter) {
+				matched, err = match(document, filter)
+			} else {
+				matched, err = matchField([]interface{}{element}, filter)
+			}
+			if err != nil {
+				return false, err
+			}
+			if matched {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	}
+	if n, ok := toFloat(value); ok {
+		return n != 0
+	}
+	return true
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// The order of types when sorting, as in MongoDB.
+func typeOrder(value interface{}) int {
+	switch value.(type) {
+	case nil, primitive.Undefined, primitive.Null:
+		return 1
+	case int32, int64, float64, int, primitive.Decimal128:
+		return 2
+	case string, primitive.Symbol:
+		return 3
+	case bson.D, bson.M:
+		return 4
+	case bson.A:
+		return 5
+	case primitive.Binary:
+		return 6
+	case primitive.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case primitive.DateTime:
+		return 9
+	case primitive.Timestamp:
+		return 10
+	case primitive.Regex:
+		return 11
+	}
+	return 12
+}
+
+// Compares values of the same type, returning false if they cannot be compared.
+func compare(a, b interface{}) (int, bool) {
+	if typeOrder(a) != typeOrder(b) {
+		return 0, false
+	}
+	switch x := a.(type) {
+	case nil, primitive.Undefined, primitive.Null:
+		return 0, true
+	case string:
+		return strings.Compare(x, b.(string)), true
+	case primitive.ObjectID:
+		y := b.(primitive.ObjectID)
+		return bytes.Compare(x[:], y[:]), true
+	case bool:
+		y := b.(bool)
+		if x == y {
+			return 0, true
+		} else if !x {
+			return -1, true
+		}
+		return 1, true
+	case primitive.DateTime:
+		return compareInt(int64(x), int64(b.(primitive.DateTime))), true
+	case primitive.Timestamp:
+		y := b.(primitive.Timestamp)
+		return compareInt(int64(x.T)<<32|int64(x.I), int64(y.T)<<32|int64(y.I)), true
+	case bson.A:
+		y := b.(bson.A)
+		for i := 0; i < len(x) && i < len(y); i++ {
+			if c := compareForSort(x[i], y[i]); c != 0 {
+				return c, true
+			}
+		}
+		return compareInt(int64(len(x)), int64(len(y))), true
+	}
+	if x, ok := toFloat(a); ok {
+		y, _ := toFloat(b)
+		if x < y {
+			return -1, true
+		} else if x > y {
+			return 1, true
+		}
+		return 0, true
+	}
+	// documents and anything else, compared by their encoding
+	ra, errA := bson.Marshal(bson.D{{Key: "v", Value: a}})
+	rb, errB := bson.Marshal(bson.D{{Key: "v", Value: b}})
+	if errA != nil || errB != nil {
+		return 0, false
+	}
+	return bytes.Compare(ra, rb), true
+}
+
+func compareInt(a, b int64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// Compares values of any type, ordering by type first.
+func compareForSort(a, b interface{}) int {
+	if c, ok := compare(a, b); ok {
+		return c
+	}
+	return compareInt(int64(typeOrder(a)), int64(typeOrder(b)))
+}
+
+func equal(a, b interface{}) bool {
+	c, ok := compare(a, b)
+	return ok && c == 0
+}
+
+// The value of the field to sort by, which is null if the field is missing.
+func sortValue(document bson.D, path string) interface{} {
+	values := lookup(document, strings.Split(path, "."))
+	if len(values) == 0 {
+		return nil
+	}
+	return values[0]
+}
+
+func direction(value interface{}) int {
+	if n, ok := toFloat(value); ok && n < 0 {
+		return -1
+	}
+	return 1
+}
+
+// Sorts the documents in place by the fields of the sort document, keeping the order of equal documents.
+func sortDocuments(documents []bson.D, by bson.D) {
+	sort.SliceStable(documents, func(i, j int) bool {
+		for _, field := range by {
+			c := compareForSort(sortValue(documents[i], field.Key), sortValue(documents[j], field.Key)) * direction(field.Value)
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,554 @@
+// An in-memory stand-in for MongoDB collections, for running the server without a database and for tests.
+// Supports the queries and updates used by the server, with the same results as MongoDB.
+package memdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type Database struct {
+	mutex       sync.Mutex
+	collections map[string]*Collection
+}
+
+func New() *Database {
+	return &Database{collections: map[string]*Collection{}}
+}
+
+// Returns the collection with the name, creating it if it does not exist.
+func (d *Database) Collection(name string) *Collection {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	collection, ok := d.collections[name]
+	if !ok {
+		collection = &Collection{}
+		d.collections[name] = collection
+	}
+	return collection
+}
+
+// Documents are kept in insertion order, which is also the order they are found in without a sort.
+type Collection struct {
+	mutex     sync.RWMutex
+	documents []bson.D
+	unique    map[string]uniqueIndex
+}
+
+// Same code as MongoDB for a duplicate _id.
+const duplicateKeyCode = 11000
+
+// No two documents matching the partial filter can have the same values of the keys.
+type uniqueIndex struct {
+	keys    []string
+	partial bson.D
+}
+
+// Stands in for a unique index of MongoDB, over the documents matching the partial filter, or all of them if it is empty.
+// Memory collections have no other indexes, as they are only needed for performance.
+func (c *Collection) CreateUniqueIndex(name string, keys []string, partial bson.D) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.unique == nil {
+		c.unique = map[string]uniqueIndex{}
+	}
+	index := uniqueIndex{keys: keys, partial: partial}
+	for i, document := range c.documents {
+		if err := c.checkUnique(index, document, i); err != nil {
+			return err
+		}
+	}
+	c.unique[name] = index
+	return nil
+}
+
+func (c *Collection) DropUniqueIndex(name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.unique, name)
+}
+
+func duplicateKeyError() error {
+	return mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: duplicateKeyCode, Message: "duplicate key error"}}}
+}
+
+// Checks the document against the other documents for the unique index, skipping the document at the index it is stored at.
+func (c *Collection) checkUnique(index uniqueIndex, document bson.D, at int) error {
+	if ok, err := match(document, index.partial); err != nil || !ok {
+		return err
+	}
+	for i, other := range c.documents {
+		if i == at {
+			continue
+		}
+		if ok, err := match(other, index.partial); err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+		same := true
+		for _, key := range index.keys {
+			if !equal(sortValue(document, key), sortValue(other, key)) {
+				same = false
+				break
+			}
+		}
+		if same {
+			return duplicateKeyError()
+		}
+	}
+	return nil
+}
+
+// Checks the document against every unique index, as it would be stored at the index, or -1 if it is new.
+func (c *Collection) checkAllUnique(document bson.D, at int) error {
+	for _, index := range c.unique {
+		if err := c.checkUnique(index, document, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Converts a value into the form it is stored in, as if it was written to and read from MongoDB.
+// Structs and maps become bson.D, slices become bson.A, and times become primitive.DateTime.
+func normalize(value interface{}) (interface{}, error) {
+	raw, err := bson.Marshal(bson.D{{Key: "v", Value: value}})
+	if err != nil {
+		return nil, err
+	}
+	var wrapper bson.D
+	if err := bson.Unmarshal(raw, &wrapper); err != nil {
+		return nil, err
+	}
+	return wrapper[0].Value, nil
+}
+
+func toDocument(value interface{}) (bson.D, error) {
+	if value == nil {
+		return bson.D{}, nil
+	}
+	raw, err := bson.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var document bson.D
+	if err := bson.Unmarshal(raw, &document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+func idOf(document bson.D) interface{} {
+	for _, e := range document {
+		if e.Key == "_id" {
+			return e.Value
+		}
+	}
+	return nil
+}
+
+// Copies the document, so that changes to the stored document are not seen by the caller and vice versa.
+func clone(document bson.D) bson.D {
+	copied, _ := toDocument(document)
+	return copied
+}
+
+func (c *Collection) insert(document interface{}) (interface{}, error) {
+	d, err := toDocument(document)
+	if err != nil {
+		return nil, err
+	}
+	id := idOf(d)
+	if id == nil {
+		id = primitive.NewObjectID()
+		d = append(bson.D{{Key: "_id", Value: id}}, d...)
+	}
+	for _, existing := range c.documents {
+		if equal(idOf(existing), id) {
+			return nil, duplicateKeyError()
+		}
+	}
+	if err := c.checkAllUnique(d, -1); err != nil {
+		return nil, err
+	}
+	c.documents = append(c.documents, d)
+	return id, nil
+}
+
+func (c *Collection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	id, err := c.insert(document)
+	if err != nil {
+		return nil, err
+	}
+	return &mongo.InsertOneResult{InsertedID: id}, nil
+}
+
+// Inserts the documents in order, stopping at the first failure.
+func (c *Collection) InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	result := &mongo.InsertManyResult{InsertedIDs: []interface{}{}}
+	for _, document := range documents {
+		id, err := c.insert(document)
+		if err != nil {
+			return result, err
+		}
+		result.InsertedIDs = append(result.InsertedIDs, id)
+	}
+	return result, nil
+}
+
+// Returns the indexes of the documents matching the filter, in insertion order.
+func (c *Collection) matching(filter interface{}) ([]int, error) {
+	f, err := toDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+	indexes := []int{}
+	for i, document := range c.documents {
+		ok, err := match(document, f)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes, nil
+}
+
+func (c *Collection) find(filter interface{}, sort interface{}, skip, limit *int64, projection interface{}) ([]bson.D, error) {
+	indexes, err := c.matching(filter)
+	if err != nil {
+		return nil, err
+	}
+	documents := make([]bson.D, len(indexes))
+	for i, index := range indexes {
+		documents[i] = clone(c.documents[index])
+	}
+	if sort != nil {
+		s, err := toDocument(sort)
+		if err != nil {
+			return nil, err
+		}
+		sortDocuments(documents, s)
+	}
+	documents = page(documents, skip, limit)
+	if projection != nil {
+		p, err := toDocument(projection)
+		if err != nil {
+			return nil, err
+		}
+		for i, document := range documents {
+			if documents[i], err = project(document, p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return documents, nil
+}
+
+func page(documents []bson.D, skip, limit *int64) []bson.D {
+	if skip != nil {
+		if int(*skip) >= len(documents) {
+			return []bson.D{}
+		}
+		documents = documents[*skip:]
+	}
+	// as in MongoDB, a limit of 0 is no limit and a negative limit is the same as a positive one
+	if limit != nil && *limit != 0 {
+		n := int(*limit)
+		if n < 0 {
+			n = -n
+		}
+		if n < len(documents) {
+			documents = documents[:n]
+		}
+	}
+	return documents
+}
+
+func cursorOf(documents []bson.D) (*mongo.Cursor, error) {
+	values := make([]interface{}, len(documents))
+	for i, document := range documents {
+		values[i] = document
+	}
+	return mongo.NewCursorFromDocuments(values, nil, nil)
+}
+
+func (c *Collection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	opt := options.MergeFindOptions(opts...)
+	documents, err := c.find(filter, opt.Sort, opt.Skip, opt.Limit, opt.Projection)
+	if err != nil {
+		return nil, err
+	}
+	return cursorOf(documents)
+}
+
+func (c *Collection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	var sort, projection interface{}
+	var skip *int64
+	for _, opt := range opts {
+		if opt.Sort != nil {
+			sort = opt.Sort
+		}
+		if opt.Skip != nil {
+			skip = opt.Skip
+		}
+		if opt.Projection != nil {
+			projection = opt.Projection
+		}
+	}
+	one := int64(1)
+	documents, err := c.find(filter, sort, skip, &one, projection)
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.D{}, err, nil)
+	}
+	if len(documents) == 0 {
+		return mongo.NewSingleResultFromDocument(bson.D{}, mongo.ErrNoDocuments, nil)
+	}
+	return mongo.NewSingleResultFromDocument(documents[0], nil, nil)
+}
+
+// Applies the update to the documents at the indexes, stopping at the first failure.
+func (c *Collection) updateAt(indexes []int, update interface{}) (*mongo.UpdateResult, error) {
+	u, err := toDocument(update)
+	if err != nil {
+		return nil, err
+	}
+	result := &mongo.UpdateResult{MatchedCount: int64(len(indexes))}
+	for _, index := range indexes {
+		before, _ := bson.Marshal(c.documents[index])
+		updated, err := apply(clone(c.documents[index]), u)
+		if err != nil {
+			return result, err
+		}
+		if !equal(idOf(updated), idOf(c.documents[index])) {
+			return result, errors.New("the _id of a document cannot be changed")
+		}
+		if err := c.checkAllUnique(updated, index); err != nil {
+			return result, err
+		}
+		after, _ := bson.Marshal(updated)
+		if !bytes.Equal(before, after) {
+			result.ModifiedCount++
+		}
+		c.documents[index] = updated
+	}
+	return result, nil
+}
+
+func (c *Collection) updateOne(filter, update interface{}) (*mongo.UpdateResult, error) {
+	indexes, err := c.matching(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(indexes) > 1 {
+		indexes = indexes[:1]
+	}
+	return c.updateAt(indexes, update)
+}
+
+func (c *Collection) updateMany(filter, update interface{}) (*mongo.UpdateResult, error) {
+	indexes, err := c.matching(filter)
+	if err != nil {
+		return nil, err
+	}
+	return c.updateAt(indexes, update)
+}
+
+func (c *Collection) UpdateByID(ctx context.Context, id interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return c.UpdateOne(ctx, bson.D{{Key: "_id", Value: id}}, update, opts...)
+}
+
+func (c *Collection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.updateOne(filter, update)
+}
+
+func (c *Collection) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.updateMany(filter, update)
+}
+
+func (c *Collection) replaceOne(filter, replacement interface{}) (*mongo.UpdateResult, error) {
+	indexes, err := c.matching(filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(indexes) == 0 {
+		return &mongo.UpdateResult{}, nil
+	}
+	d, err := toDocument(replacement)
+	if err != nil {
+		return nil, err
+	}
+	id := idOf(c.documents[indexes[0]])
+	if replaced := idOf(d); replaced != nil && !equal(replaced, id) {
+		return nil, errors.New("the _id of a document cannot be changed")
+	} else if replaced == nil {
+		d = append(bson.D{{Key: "_id", Value: id}}, d...)
+	}
+	if err := c.checkAllUnique(d, indexes[0]); err != nil {
+		return nil, err
+	}
+	c.documents[indexes[0]] = d
+	return &mongo.UpdateResult{MatchedCount: 1, ModifiedCount: 1}, nil
+}
+
+func (c *Collection) deleteAt(indexes []int) int64 {
+	deleted := map[int]bool{}
+	for _, index := range indexes {
+		deleted[index] = true
+	}
+	remaining := []bson.D{}
+	for i, document := range c.documents {
+		if !deleted[i] {
+			remaining = append(remaining, document)
+		}
+	}
+	c.documents = remaining
+	return int64(len(indexes))
+}
+
+func (c *Collection) deleteOne(filter interface{}) (int64, error) {
+	indexes, err := c.matching(filter)
+	if err != nil {
+		return 0, err
+	}
+	if len(indexes) > 1 {
+		indexes = indexes[:1]
+	}
+	return c.deleteAt(indexes), nil
+}
+
+func (c *Collection) deleteMany(filter interface{}) (int64, error) {
+	indexes, err := c.matching(filter)
+	if err != nil {
+		return 0, err
+	}
+	return c.deleteAt(indexes), nil
+}
+
+func (c *Collection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	n, err := c.deleteOne(filter)
+	if err != nil {
+		return nil, err
+	}
+	return &mongo.DeleteResult{DeletedCount: n}, nil
+}
+
+func (c *Collection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	n, err := c.deleteMany(filter)
+	if err != nil {
+		return nil, err
+	}
+	return &mongo.DeleteResult{DeletedCount: n}, nil
+}
+
+// Runs the writes in order. As in MongoDB, ordered writes (the default) stop at the first failure,
+// and unordered writes carry on, with the failures reported in a mongo.BulkWriteException.
+func (c *Collection) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	ordered := true
+	for _, opt := range opts {
+		if opt.Ordered != nil {
+			ordered = *opt.Ordered
+		}
+	}
+
+	result := &mongo.BulkWriteResult{UpsertedIDs: map[int64]interface{}{}}
+	exception := mongo.BulkWriteException{}
+	for i, model := range models {
+		var err error
+		var updated *mongo.UpdateResult
+		var deleted int64
+		switch m := model.(type) {
+		case *mongo.InsertOneModel:
+			if _, err = c.insert(m.Document); err == nil {
+				result.InsertedCount++
+			}
+		case *mongo.UpdateOneModel:
+			updated, err = c.updateOne(m.Filter, m.Update)
+		case *mongo.UpdateManyModel:
+			updated, err = c.updateMany(m.Filter, m.Update)
+		case *mongo.ReplaceOneModel:
+			updated, err = c.replaceOne(m.Filter, m.Replacement)
+		case *mongo.DeleteOneModel:
+			deleted, err = c.deleteOne(m.Filter)
+		case *mongo.DeleteManyModel:
+			deleted, err = c.deleteMany(m.Filter)
+		default:
+			err = errors.New("unsupported write model")
+		}
+		if updated != nil {
+			result.MatchedCount += updated.MatchedCount
+			result.ModifiedCount += updated.ModifiedCount
+		}
+		result.DeletedCount += deleted
+		if err != nil {
+			exception.WriteErrors = append(exception.WriteErrors, mongo.BulkWriteError{
+				WriteError: mongo.WriteError{Index: i, Message: err.Error()},
+				Request:    model,
+			})
+			if ordered {
+				break
+			}
+		}
+	}
+	if len(exception.WriteErrors) > 0 {
+		return result, exception
+	}
+	return result, nil
+}
+
+func (c *Collection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	stages, err := normalize(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	array, ok := stages.(bson.A)
+	if !ok {
+		return nil, errors.New("pipeline must be an array")
+	}
+	documents := make([]bson.D, len(c.documents))
+	for i, document := range c.documents {
+		documents[i] = clone(document)
+	}
+	for i, stage := range array {
+		s, ok := stage.(bson.D)
+		if !ok || len(s) != 1 {
+			return nil, errors.New("each stage of the pipeline must have exactly one field")
+		}
+		if s[0].Key == "$search" && i != 0 {
+			return nil, errors.New("$search is only valid as the first stage in a pipeline")
+		}
+		if documents, err = runStage(documents, s[0].Key, s[0].Value); err != nil {
+			return nil, err
+		}
+	}
+	return cursorOf(documents)
+}
@@ -0,0 +1,309 @@
+package memdb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type item struct {
+	Id      primitive.ObjectID `bson:"_id,omitempty"`
+	Name    string             `bson:"name"`
+	Tags    []string           `bson:"tags"`
+	Members map[string]string  `bson:"members"`
+	Count   int                `bson:"count"`
+	Due     time.Time          `bson:"due"`
+}
+
+func names(t *testing.T, cursor *mongo.Cursor, err error) []string {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []item
+	if err := cursor.All(context.Background(), &items); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, i := range items {
+		names = append(names, i.Name)
+	}
+	return names
+}
+
+func seed(t *testing.T) *Collection {
+	t.Helper()
+	c := New().Collection("items")
+	due := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+	_, err := c.InsertMany(context.Background(), []interface{}{
+		item{Name: "alpha", Tags: []string{"a", "b"}, Members: map[string]string{"u1": "admin"}, Count: 3, Due: due},
+		item{Name: "beta", Tags: []string{"b"}, Members: map[string]string{"u2": "admin"}, Count: 1, Due: due.AddDate(0, 0, 1)},
+		item{Name: "gamma", Tags: []string{}, Members: map[string]string{"u1": "member", "u2": "admin"}, Count: 2, Due: due.AddDate(0, 0, 2)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestFind(t *testing.T) {
+	c := seed(t)
+	ctx := context.Background()
+	due := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		filter   interface{}
+		opts     *options.FindOptions
+		expected []string
+	}{
+		{"everything", bson.D{}, nil, []string{"alpha", "beta", "gamma"}},
+		{"element of an array", bson.D{{Key: "tags", Value: "b"}}, nil, []string{"alpha", "beta"}},
+		{"$all", bson.M{"tags": bson.M{"$all": []string{"a", "b"}}}, nil, []string{"alpha"}},
+		{"$size", bson.M{"tags": bson.M{"$size": 0}}, nil, []string{"gamma"}},
+		{"$exists on a map key", bson.M{"members.u1": bson.M{"$exists": true}}, nil, []string{"alpha", "gamma"}},
+		{"$in", bson.M{"name": bson.M{"$in": []string{"beta", "delta"}}}, nil, []string{"beta"}},
+		{"time range", bson.D{{Key: "due", Value: bson.M{"$gte": due.AddDate(0, 0, 1)}}, {Key: "due", Value: bson.M{"$lt": due.AddDate(0, 0, 2)}}}, nil, []string{"beta"}},
+		{"$or", bson.M{"$or": []bson.M{{"count": 3}, {"name": "gamma"}}}, nil, []string{"alpha", "gamma"}},
+		{"case insensitive regex", bson.M{"name": primitive.Regex{Pattern: "^BE", Options: "i"}}, nil, []string{"beta"}},
+		{"sort and limit", bson.D{}, options.Find().SetSort(bson.D{{Key: "count", Value: -1}}).SetLimit(2), []string{"alpha", "gamma"}},
+		{"skip", bson.D{}, options.Find().SetSort(bson.M{"name": 1}).SetSkip(1), []string{"beta", "gamma"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []*options.FindOptions{}
+			if tt.opts != nil {
+				opts = append(opts, tt.opts)
+			}
+			cursor, err := c.Find(ctx, tt.filter, opts...)
+			if actual := names(t, cursor, err); !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("Expected %v but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFindOne(t *testing.T) {
+	c := seed(t)
+	ctx := context.Background()
+
+	var found item
+	if err := c.FindOne(ctx, bson.M{"name": "beta"}).Decode(&found); err != nil {
+		t.Fatal(err)
+	}
+	if found.Name != "beta" || found.Id.IsZero() || !found.Due.Equal(time.Date(2022, 7, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected beta to be found, got %v", found)
+	}
+
+	projected := bson.M{}
+	if err := c.FindOne(ctx, bson.M{"_id": found.Id}, options.FindOne().SetProjection(bson.D{{Key: "name", Value: 1}})).Decode(&projected); err != nil {
+		t.Fatal(err)
+	}
+	if expected := (bson.M{"_id": found.Id, "name": "beta"}); !reflect.DeepEqual(projected, expected) {
+		t.Errorf("Expected %v but got %v", expected, projected)
+	}
+
+	if err := c.FindOne(ctx, bson.M{"name": "delta"}).Err(); !errors.Is(err, mongo.ErrNoDocuments) {
+		t.Errorf("Expected no documents, got %v", err)
+	}
+}
+
+func TestInsertDuplicateID(t *testing.T) {
+	c := New().Collection("items")
+	id := primitive.NewObjectID()
+	if _, err := c.InsertOne(context.Background(), item{Id: id}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.InsertOne(context.Background(), item{Id: id})
+	if !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("Expected a duplicate key error, got %v", err)
+	}
+}
+
+func TestUniqueIndex(t *testing.T) {
+	c := New().Collection("items")
+	ctx := context.Background()
+	if err := c.CreateUniqueIndex("name_1", []string{"name"}, bson.D{{Key: "count", Value: bson.D{{Key: "$gt", Value: 0}}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.InsertOne(ctx, item{Name: "alpha", Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// documents outside the partial filter are not checked
+	if _, err := c.InsertOne(ctx, item{Name: "alpha"}); err != nil {
+		t.Errorf("Expected a document outside the partial filter to be inserted, got %v", err)
+	}
+	if _, err := c.InsertOne(ctx, item{Name: "alpha", Count: 2}); !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("Expected a duplicate key error, got %v", err)
+	}
+	// nor can updates bring a document into the partial filter with the same keys
+	_, err := c.UpdateOne(ctx, bson.M{"name": "alpha", "count": 0}, bson.M{"$set": bson.M{"count": 3}})
+	if !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("Expected a duplicate key error, got %v", err)
+	}
+
+	c.DropUniqueIndex("name_1")
+	if _, err := c.InsertOne(ctx, item{Name: "alpha", Count: 2}); err != nil {
+		t.Errorf("Expected the document to be inserted once the index is dropped, got %v", err)
+	}
+	if err := c.CreateUniqueIndex("name_1", []string{"name"}, nil); !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("Expected the index to not be created over duplicates, got %v", err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	c := seed(t)
+	ctx := context.Background()
+
+	result, err := c.UpdateMany(ctx, bson.M{"members.u2": "admin"}, bson.D{
+		{Key: "$addToSet", Value: bson.M{"tags": bson.M{"$each": []string{"b", "c"}}}},
+		{Key: "$unset", Value: bson.M{"members.u2": ""}},
+		{Key: "$inc", Value: bson.M{"count": 10}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.MatchedCount != 2 || result.ModifiedCount != 2 {
+		t.Errorf("Expected 2 documents to be updated, got %v", result)
+	}
+
+	if _, err := c.UpdateOne(ctx, bson.M{"name": "alpha"}, bson.M{"$pull": bson.M{"tags": bson.M{"$in": []string{"a", "z"}}}}); err != nil {
+		t.Fatal(err)
+	}
+	// the field does not exist, so nothing is pulled
+	if _, err := c.UpdateOne(ctx, bson.M{"name": "alpha"}, bson.M{"$pull": bson.M{"missing": "a"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := c.Find(ctx, bson.D{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []item
+	if err := cursor.All(ctx, &items); err != nil {
+		t.Fatal(err)
+	}
+	expected := []item{
+		{Name: "alpha", Tags: []string{"b"}, Members: map[string]string{"u1": "admin"}, Count: 3},
+		{Name: "beta", Tags: []string{"b", "c"}, Members: map[string]string{}, Count: 11},
+		{Name: "gamma", Tags: []string{"b", "c"}, Members: map[string]string{"u1": "member"}, Count: 12},
+	}
+	for i := range items {
+		items[i].Id, items[i].Due = primitive.ObjectID{}, time.Time{}
+	}
+	if !reflect.DeepEqual(items, expected) {
+		t.Errorf("Expected\n%v\nbut got\n%v", expected, items)
+	}
+
+	unchanged, err := c.UpdateOne(ctx, bson.M{"name": "alpha"}, bson.M{"$set": bson.M{"count": 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unchanged.MatchedCount != 1 || unchanged.ModifiedCount != 0 {
+		t.Errorf("Expected setting the same value to not modify the document, got %v", unchanged)
+	}
+}
+
+func TestBulkWriteOrdered(t *testing.T) {
+	c := seed(t)
+	ctx := context.Background()
+	_, err := c.BulkWrite(ctx, []mongo.WriteModel{
+		mongo.NewUpdateOneModel().SetFilter(bson.M{"name": "alpha"}).SetUpdate(bson.M{"$set": bson.M{"count": 100}}),
+		mongo.NewUpdateOneModel().SetFilter(bson.M{"name": "beta"}).SetUpdate(bson.M{"$inc": bson.M{"name": 1}}),
+		mongo.NewDeleteOneModel().SetFilter(bson.M{"name": "gamma"}),
+	})
+	var exception mongo.BulkWriteException
+	if !errors.As(err, &exception) || len(exception.WriteErrors) != 1 || exception.WriteErrors[0].Index != 1 {
+		t.Fatalf("Expected the second write to fail, got %v", err)
+	}
+	cursor, err := c.Find(ctx, bson.M{"count": 100})
+	if actual := names(t, cursor, err); !reflect.DeepEqual(actual, []string{"alpha"}) {
+		t.Errorf("Expected the writes before the failure to be applied, got %v", actual)
+	}
+	cursor, err = c.Find(ctx, bson.M{"name": "gamma"})
+	if actual := names(t, cursor, err); len(actual) != 1 {
+		t.Errorf("Expected the writes after the failure to be skipped")
+	}
+}
+
+func TestAggregateSearch(t *testing.T) {
+	c := New().Collection("items")
+	ctx := context.Background()
+	for _, name := range []string{"Project Orange", "orange juice", "Apple pie", "Oranges and lemons"} {
+		if _, err := c.InsertOne(ctx, item{Name: name}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pipeline := func(query string) mongo.Pipeline {
+		return mongo.Pipeline{
+			{{Key: "$search", Value: bson.D{
+				{Key: "index", Value: "name"},
+				{Key: "autocomplete", Value: bson.D{
+					{Key: "path", Value: "name"},
+					{Key: "query", Value: query},
+					{Key: "tokenOrder", Value: "sequential"},
+					{Key: "fuzzy", Value: bson.D{{Key: "maxEdits", Value: 1}, {Key: "prefixLength", Value: 1}}},
+				}},
+			}}},
+			{{Key: "$limit", Value: 10}},
+			{{Key: "$project", Value: bson.D{{Key: "_id", Value: 0}, {Key: "id", Value: bson.M{"$toString": "$_id"}}, {Key: "name", Value: 1}}}},
+		}
+	}
+
+	tests := []struct {
+		query    string
+		expected []string
+	}{
+		{"ora", []string{"orange juice", "Oranges and lemons", "Project Orange"}},
+		// one edit away
+		{"oarnge", []string{}},
+		{"ornge", []string{"Project Orange", "orange juice", "Oranges and lemons"}},
+		{"orange ju", []string{"orange juice"}},
+		// out of order
+		{"juice orange", []string{}},
+		{"pie", []string{"Apple pie"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			cursor, err := c.Aggregate(ctx, pipeline(tt.query))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var results []struct {
+				Id   string `bson:"id"`
+				Name string `bson:"name"`
+			}
+			if err := cursor.All(ctx, &results); err != nil {
+				t.Fatal(err)
+			}
+			actual := []string{}
+			for _, r := range results {
+				if len(r.Id) != 24 {
+					t.Errorf("Expected the id to be a hex string, got %q", r.Id)
+				}
+				actual = append(actual, r.Name)
+			}
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("Expected %v but got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSearchMustBeFirst(t *testing.T) {
+	c := New().Collection("items")
+	_, err := c.Aggregate(context.Background(), mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{}}},
+		{{Key: "$search", Value: bson.D{{Key: "text", Value: bson.D{{Key: "path", Value: "name"}, {Key: "query", Value: "a"}}}}}},
+	})
+	if err == nil {
+		t.Errorf("Expected $search after the first stage to fail")
+	}
+}
@@ -0,0 +1,265 @@
+package memdb
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Applies the update operators to the document, returning the updated document.
+func apply(document bson.D, update bson.D) (bson.D, error) {
+	if len(update) == 0 {
+		return nil, errors.New("update document must not be empty")
+	}
+	for _, operator := range update {
+		fields, ok := operator.Value.(bson.D)
+		if !ok {
+			return nil, errors.New("modifiers for " + operator.Key + " must be an object")
+		}
+		for _, field := range fields {
+			parts := strings.Split(field.Key, ".")
+			if field.Key == "" {
+				return nil, errors.New("an empty update path is not valid")
+			}
+			var updated interface{}
+			var err error
+			switch operator.Key {
+			case "$set":
+				updated, err = setPath(document, parts, field.Value)
+			case "$unset":
+				updated = unsetPath(document, parts)
+			case "$inc":
+				updated, err = updatePath(document, parts, func(current interface{}, exists bool) (interface{}, error) {
+					return increment(current, exists, field.Value)
+				})
+			case "$push", "$addToSet":
+				each := bson.A{field.Value}
+				if d, isDoc := field.Value.(bson.D); isDoc && len(d) > 0 && d[0].Key == "$each" {
+					if each, ok = d[0].Value.(bson.A); !ok {
+						return nil, errors.New("$each must be an array")
+					}
+				}
+				unique := operator.Key == "$addToSet"
+				updated, err = updatePath(document, parts, func(current interface{}, exists bool) (interface{}, error) {
+					return addToArray(current, exists, each, unique)
+				})
+			case "$pull", "$pullAll":
+				if len(lookup(document, parts)) == 0 {
+					// nothing to remove from
+					continue
+				}
+				updated, err = updatePath(document, parts, func(current interface{}, exists bool) (interface{}, error) {
+					return pullFromArray(current, operator.Key, field.Value)
+				})
+			default:
+				return nil, errors.New("unknown modifier: " + operator.Key)
+			}
+			if err != nil {
+				return nil, err
+			}
+			document = updated.(bson.D)
+		}
+	}
+	return document, nil
+}
+
+// Replaces the value at the path with the result of fn, creating the documents on the path if they do not exist.
+// fn is given the current value, and whether it exists.
+func updatePath(value interface{}, parts []string, fn func(current interface{}, exists bool) (interface{}, error)) (interface{}, error) {
+	switch v := value.(type) {
+	case bson.D:
+		for i, e := range v {
+			if e.Key != parts[0] {
+				continue
+			}
+			var updated interface{}
+			var err error
+			if len(parts) == 1 {
+				updated, err = fn(e.Value, true)
+			} else {
+				updated, err = updatePath(e.Value, parts[1:], fn)
+			}
+			if err != nil {
+				return nil, err
+			}
+			copied := append(bson.D{}, v...)
+			copied[i].Value = updated
+			return copied, nil
+		}
+		var created interface{}
+		var err error
+		if len(parts) == 1 {
+			created, err = fn(nil, false)
+		} else {
+			created, err = updatePath(bson.D{}, parts[1:], fn)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return append(append(bson.D{}, v...), bson.E{Key: parts[0], Value: created}), nil
+	case bson.A:
+		i, err := strconv.Atoi(parts[0])
+		if err != nil || i < 0 {
+			return nil, errors.New("cannot create field '" + parts[0] + "' in an array")
+		}
+		copied := append(bson.A{}, v...)
+		for len(copied) <= i {
+			copied = append(copied, nil)
+		}
+		if len(parts) == 1 {
+			copied[i], err = fn(copied[i], true)
+		} else {
+			if copied[i] == nil {
+				copied[i] = bson.D{}
+			}
+			copied[i], err = updatePath(copied[i], parts[1:], fn)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return copied, nil
+	}
+	return nil, errors.New("cannot create field '" + parts[0] + "' in a value that is not a document")
+}
+
+func setPath(document bson.D, parts []string, value interface{}) (interface{}, error) {
+	return updatePath(document, parts, func(interface{}, bool) (interface{}, error) {
+		return value, nil
+	})
+}
+
+// Removes the field at the path, if it exists.
+func unsetPath(value interface{}, parts []string) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		for i, e := range v {
+			if e.Key != parts[0] {
+				continue
+			}
+			copied := append(bson.D{}, v...)
+			if len(parts) == 1 {
+				return append(copied[:i], copied[i+1:]...)
+			}
+			copied[i].Value = unsetPath(e.Value, parts[1:])
+			return copied
+		}
+	case bson.A:
+		i, err := strconv.Atoi(parts[0])
+		if err != nil || i < 0 || i >= len(v) {
+			return v
+		}
+		copied := append(bson.A{}, v...)
+		if len(parts) == 1 {
+			// as in MongoDB, unsetting an array element sets it to null
+			copied[i] = nil
+		} else {
+			copied[i] = unsetPath(v[i], parts[1:])
+		}
+		return copied
+	}
+	return value
+}
+
+func increment(current interface{}, exists bool, by interface{}) (interface{}, error) {
+	if !exists || current == nil {
+		current = int32(0)
+	}
+	switch x := current.(type) {
+	case int32:
+		if y, ok := by.(int32); ok {
+			return x + y, nil
+		} else if y, ok := by.(int64); ok {
+			return int64(x) + y, nil
+		}
+	case int64:
+		if y, ok := by.(int32); ok {
+			return x + int64(y), nil
+		} else if y, ok := by.(int64); ok {
+			return x + y, nil
+		}
+	}
+	x, okX := toFloat(current)
+	y, okY := toFloat(by)
+	if !okX || !okY {
+		return nil, errors.New("cannot increment with a non-numeric value")
+	}
+	return x + y, nil
+}
+
+func addToArray(current interface{}, exists bool, values bson.A, unique bool) (interface{}, error) {
+	array := bson.A{}
+	if exists && current != nil {
+		existing, ok := current.(bson.A)
+		if !ok {
+			return nil, errors.New("cannot apply $push or $addToSet to a non-array field")
+		}
+		array = append(array, existing...)
+	}
+	for _, value := range values {
+		duplicate := false
+		if unique {
+			for _, element := range array {
+				if equal(element, value) {
+					duplicate = true
+					break
+				}
+			}
+		}
+		if !duplicate {
+			array = append(array, value)
+		}
+	}
+	return array, nil
+}
+
+// Removes the elements matching the condition from the array.
+// For $pull, the condition is a value, a document of operators, or a filter for arrays of documents.
+// For $pullAll, it is an array of values.
+func pullFromArray(current interface{}, operator string, condition interface{}) (interface{}, error) {
+	array, ok := current.(bson.A)
+	if !ok {
+		if current == nil {
+			return current, nil
+		}
+		return nil, errors.New("cannot apply " + operator + " to a non-array value")
+	}
+	var values bson.A
+	if operator == "$pullAll" {
+		if values, ok = condition.(bson.A); !ok {
+			return nil, errors.New("$pullAll requires an array argument")
+		}
+	}
+	remaining := bson.A{}
+	for _, element := range array {
+		var remove bool
+		var err error
+		switch {
+		case operator == "$pullAll":
+			for _, value := range values {
+				if equal(element, value) {
+					remove = true
+					break
+				}
+			}
+		case isOperators(condition):
+			remove, err = matchField([]interface{}{element}, condition)
+		default:
+			if filter, isDoc := condition.(bson.D); isDoc {
+				if document, elementIsDoc := element.(bson.D); elementIsDoc {
+					remove, err = match(document, filter)
+					break
+				}
+			}
+			remove = equal(element, condition)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !remove {
+			remaining = append(remaining, element)
+		}
+	}
+	return remaining, nil
+}
@@ -0,0 +1,104 @@
+// Prometheus metrics of the server, served at /metrics.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Holds the metrics of the server, along with those of the Go runtime and the process.
+var Registry = prometheus.NewRegistry()
+
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+}
+
+var (
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "organius_http_requests_total",
+		Help: "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	HTTPDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "organius_http_request_duration_seconds",
+		Help:    "Time taken to respond to HTTP requests by route and method, excluding websockets.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	ChatRooms = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "organius_chat_rooms",
+		Help: "Project chat rooms with at least one client.",
+	})
+
+	ChatClients = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "organius_chat_clients",
+		Help: "Clients connected to project chat.",
+	})
+
+	ChatDrops = factory.NewCounter(prometheus.CounterOpts{
+		Name: "organius_chat_broadcast_drops_total",
+		Help: "Clients disconnected from project chat because they could not keep up with the messages.",
+	})
+
+	ActivityClients = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "organius_activity_clients",
+		Help: "Clients connected to project activity streams.",
+	})
+
+	ActivityDrops = factory.NewCounter(prometheus.CounterOpts{
+		Name: "organius_activity_drops_total",
+		Help: "Clients disconnected from project activity streams because they could not keep up with the activities.",
+	})
+
+	DBDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "organius_db_operation_duration_seconds",
+		Help:    "Time taken by database operations by collection and operation.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"collection", "operation"})
+
+	DBErrors = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "organius_db_operation_errors_total",
+		Help: "Database operations that failed by collection and operation, not counting finding no documents.",
+	}, []string{"collection", "operation"})
+
+	MailSent = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "organius_mail_sent_total",
+		Help: `Emails by outcome: "sent", "rejected" by the transport, or "failed" to reach it.`,
+	}, []string{"outcome"})
+)
+
+// Serves the metrics in the Prometheus text format.
+func Handler() gin.HandlerFunc {
+	handler := promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+	return func(ctx *gin.Context) {
+		handler.ServeHTTP(ctx.Writer, ctx.Request)
+	}
+}
+
+// Counts and times the requests by the route they matched, such as "/api/v1/task_get".
+// Requests matching no route, such as those for the React build, are grouped as "unmatched" to keep the number of labels small.
+func Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		ctx.Next()
+
+		route := ctx.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := ctx.Request.Method
+		HTTPRequests.WithLabelValues(route, method, strconv.Itoa(ctx.Writer.Status())).Inc()
+		// websockets stay open for as long as the client is connected
+		if !ctx.IsWebsocket() {
+			HTTPDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+		}
+	}
+}
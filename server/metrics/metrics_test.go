@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware(t *testing.T) {
+	router := gin.New()
+	router.Use(Middleware())
+	router.GET("/api/v1/task_get/:id", func(ctx *gin.Context) {
+		ctx.Status(http.StatusTeapot)
+	})
+	router.GET("/metrics", Handler())
+
+	for _, path := range []string{"/api/v1/task_get/1", "/api/v1/task_get/2", "/favicon.ico"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	// requests are grouped by their route, not their path
+	if n := testutil.ToFloat64(HTTPRequests.WithLabelValues("/api/v1/task_get/:id", "GET", "418")); n != 2 {
+		t.Errorf("Expected 2 requests to the route, got %v", n)
+	}
+	if n := testutil.ToFloat64(HTTPRequests.WithLabelValues("unmatched", "GET", "404")); n != 1 {
+		t.Errorf("Expected 1 unmatched request, got %v", n)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, metric := range []string{"organius_http_request_duration_seconds_bucket", "go_goroutines", `route="/api/v1/task_get/:id"`} {
+		if !strings.Contains(w.Body.String(), metric) {
+			t.Errorf("Expected %v in the metrics", metric)
+		}
+	}
+}
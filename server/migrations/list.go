@@ -0,0 +1,228 @@
+package migrations
+
+import (
+	"context"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// All migrations, in order. New migrations are added at the end with the next version.
+var All = []Migration{
+	{
+		Version: 1,
+		Name:    "backfill the lists and maps of users",
+		Up: func(ctx context.Context, db controllers.Database) error {
+			// users created before these fields existed have them missing, which decodes to nil maps
+			return backfill(ctx, db, "users", bson.D{
+				{Key: "tasks", Value: bson.D{}},
+				{Key: "projects", Value: bson.A{}},
+				{Key: "events", Value: bson.A{}},
+				{Key: "invites", Value: bson.A{}},
+				{Key: "isPublic", Value: false},
+			})
+		},
+		// the backfilled values are the same as those of new users, so there is nothing to undo
+	},
+	{
+		Version: 2,
+		Name:    "backfill the lists, maps and settings of projects",
+		Up: func(ctx context.Context, db controllers.Database) error {
+			// the default settings of projects when this was written, as later defaults are not what these projects had
+			roles := bson.D{
+				{Key: "admin", Value: permissionsV2(true, false, false)},
+				{Key: "member", Value: permissionsV2(false, true, true)},
+			}
+			states := bson.A{
+				bson.D{{Key: "name", Value: "Backlog"}, {Key: "isTerminal", Value: false}},
+				bson.D{{Key: "name", Value: "In Progress"}, {Key: "isTerminal", Value: false}},
+				bson.D{{Key: "name", Value: "Review"}, {Key: "isTerminal", Value: false}},
+				bson.D{{Key: "name", Value: "Done"}, {Key: "isTerminal", Value: true}},
+			}
+			attachments := bson.D{
+				{Key: "maxSize", Value: int64(10 << 20)},
+				{Key: "allowedTypes", Value: bson.A{}},
+			}
+			settings := bson.D{
+				{Key: "roles", Value: roles},
+				{Key: "deadlineNotification", Value: time.Time{}},
+				{Key: "states", Value: states},
+				{Key: "attachments", Value: attachments},
+			}
+			return backfill(ctx, db, "projects", bson.D{
+				{Key: "members", Value: bson.D{}},
+				{Key: "applications", Value: bson.D{}},
+				{Key: "tasks", Value: bson.A{}},
+				{Key: "events", Value: bson.A{}},
+				{Key: "isPublic", Value: false},
+				{Key: "isArchived", Value: false},
+				// the whole settings first, as the fields of a null settings cannot be set
+				{Key: "settings", Value: settings},
+				{Key: "settings.roles", Value: roles},
+				{Key: "settings.states", Value: states},
+				{Key: "settings.attachments", Value: attachments},
+			})
+		},
+	},
+	{
+		Version: 3,
+		Name:    "backfill the lists of tasks",
+		Up: func(ctx context.Context, db controllers.Database) error {
+			// tasks created before they recorded their project are given the project listing them
+			cursor, err := db("projects").Find(ctx, bson.D{}, options.Find().SetProjection(bson.D{{Key: "tasks", Value: 1}}))
+			if err != nil {
+				return err
+			}
+			defer cursor.Close(ctx)
+			for cursor.Next(ctx) {
+				var project struct {
+					Id    primitive.ObjectID `bson:"_id"`
+					Tasks []string           `bson:"tasks"`
+				}
+				if err := cursor.Decode(&project); err != nil {
+					return err
+				}
+				if len(project.Tasks) == 0 {
+					continue
+				}
+				taskids := bson.A{}
+				for _, taskid := range project.Tasks {
+					if id, err := primitive.ObjectIDFromHex(taskid); err == nil {
+						taskids = append(taskids, id)
+					}
+				}
+				filter := bson.D{
+					{Key: "_id", Value: bson.D{{Key: "$in", Value: taskids}}},
+					{Key: "projectid", Value: bson.D{{Key: "$in", Value: bson.A{nil, ""}}}},
+					{Key: "isPersonal", Value: bson.D{{Key: "$ne", Value: true}}},
+				}
+				update := bson.D{{Key: "$set", Value: bson.D{{Key: "projectid", Value: project.Id.Hex()}}}}
+				if _, err := db("tasks").UpdateMany(ctx, filter, update); err != nil {
+					return err
+				}
+			}
+			if err := cursor.Err(); err != nil {
+				return err
+			}
+			return backfill(ctx, db, "tasks", bson.D{
+				{Key: "assignedTo", Value: bson.A{}},
+				{Key: "tags", Value: bson.A{}},
+				// the rest are personal tasks, which have no project
+				{Key: "projectid", Value: ""},
+			})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create the indexes for querying tasks and the items belonging to tasks",
+		Up: func(ctx context.Context, db controllers.Database) error {
+			for collection, keys := range indexesV4() {
+				if err := createIndexes(ctx, db, collection, keys); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(ctx context.Context, db controllers.Database) error {
+			for collection, keys := range indexesV4() {
+				if err := dropIndexes(ctx, db, collection, keys); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 5,
+		Name:    "allow each user only one running timer",
+		Up: func(ctx context.Context, db controllers.Database) error {
+			// timers started at the same time before this index existed are stopped, except the first
+			cursor, err := db("timeEntries").Find(ctx, bson.D{{Key: "isRunning", Value: true}}, options.Find().SetSort(bson.D{{Key: "start", Value: 1}, {Key: "_id", Value: 1}}))
+			if err != nil {
+				return err
+			}
+			var running []struct {
+				Id     primitive.ObjectID `bson:"_id"`
+				UserId string             `bson:"userid"`
+				Start  time.Time          `bson:"start"`
+			}
+			if err := cursor.All(ctx, &running); err != nil {
+				return err
+			}
+			kept := map[string]bool{}
+			for _, entry := range running {
+				if !kept[entry.UserId] {
+					kept[entry.UserId] = true
+					continue
+				}
+				update := bson.D{{Key: "$set", Value: bson.D{
+					{Key: "end", Value: entry.Start},
+					{Key: "isRunning", Value: false},
+				}}}
+				if _, err := db("timeEntries").UpdateByID(ctx, entry.Id, update); err != nil {
+					return err
+				}
+			}
+			keys, partial := runningTimerIndexV5()
+			return createUniqueIndex(ctx, db, "timeEntries", keys, partial)
+		},
+		Down: func(ctx context.Context, db controllers.Database) error {
+			keys, _ := runningTimerIndexV5()
+			return dropIndexes(ctx, db, "timeEntries", []bson.D{keys})
+		},
+	},
+}
+
+// The permissions of a role, with the fields that roles had when migration 2 was written.
+func permissionsV2(isAdmin, addTask, removeTask bool) bson.D {
+	return bson.D{
+		{Key: "isAdmin", Value: isAdmin},
+		{Key: "addMember", Value: false},
+		{Key: "removeMember", Value: false},
+		{Key: "editName", Value: false},
+		{Key: "editDesc", Value: false},
+		{Key: "editSettings", Value: false},
+		{Key: "addTask", Value: addTask},
+		{Key: "removeTask", Value: removeTask},
+		{Key: "canAssignOthers", Value: false},
+	}
+}
+
+// Unique over the running timers only, as users have any number of stopped ones.
+func runningTimerIndexV5() (bson.D, bson.D) {
+	return bson.D{{Key: "userid", Value: 1}}, bson.D{{Key: "isRunning", Value: true}}
+}
+
+func indexesV4() map[string][]bson.D {
+	tasks := []bson.D{
+		// assignedTo and tags cannot be indexed together as both are arrays
+		{{Key: "projectid", Value: 1}, {Key: "tags", Value: 1}},
+	}
+	// sorts of TaskQuery that are backed by an index, in both the user and project scope
+	// sorting on other fields still works, but without an index
+	for _, field := range []string{"deadline", "creationTime", "name"} {
+		for _, scope := range []string{"projectid", "assignedTo"} {
+			tasks = append(tasks, bson.D{{Key: scope, Value: 1}, {Key: field, Value: 1}, {Key: "_id", Value: 1}})
+		}
+	}
+	byTask := []bson.D{{{Key: "taskid", Value: 1}}}
+	return map[string][]bson.D{
+		"tasks":          tasks,
+		"comments":       byTask,
+		"attachments":    {{{Key: "ownerType", Value: 1}, {Key: "ownerid", Value: 1}}},
+		"taskActivities": byTask,
+		"timeEntries":    {{{Key: "taskid", Value: 1}}, {{Key: "userid", Value: 1}, {Key: "isRunning", Value: 1}}},
+	}
+}
+
+// The indexes expected once all migrations are applied, by collection.
+// Update this when a migration creates or drops indexes.
+func Indexes() map[string][]bson.D {
+	indexes := indexesV4()
+	keys, _ := runningTimerIndexV5()
+	indexes["timeEntries"] = append(indexes["timeEntries"], keys)
+	return indexes
+}
@@ -0,0 +1,306 @@
+// Versioned changes to the documents and indexes in the database, applied in order and recorded in the migrations collection.
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	migrationCollection = "migrations"
+)
+
+// A change to the database.
+// Up has to be safe to run again if it fails partway, as it is only recorded once it succeeds,
+// and safe to run by several instances at once, as instances starting together each apply the pending migrations.
+// Down undoes Up, and is nil if there is nothing to undo.
+// Migrations refer to collections and fields by name, as they were when the migration was written,
+// so that later changes to the controllers and models do not change what an old migration does.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db controllers.Database) error
+	Down    func(ctx context.Context, db controllers.Database) error
+}
+
+// An applied migration, as recorded in the migrations collection.
+type Record struct {
+	Version   int       `bson:"_id" json:"version"`
+	Name      string    `bson:"name" json:"name"`
+	AppliedAt time.Time `bson:"appliedAt" json:"appliedAt"`
+}
+
+type Status struct {
+	Version int     `json:"version"`
+	Name    string  `json:"name"`
+	Applied *Record `json:"applied"` // nil if pending
+}
+
+// Checks that the versions are positive and in increasing order.
+func Validate(migrations []Migration) error {
+	previous := 0
+	for _, m := range migrations {
+		if m.Version <= previous {
+			return fmt.Errorf("migration %v (%v) must have a version greater than %v", m.Version, m.Name, previous)
+		}
+		if m.Up == nil {
+			return fmt.Errorf("migration %v (%v) has no up", m.Version, m.Name)
+		}
+		previous = m.Version
+	}
+	return nil
+}
+
+// Returns the applied migrations by version.
+func Applied(ctx context.Context, db controllers.Database) (map[int]Record, error) {
+	cursor, err := db(migrationCollection).Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	var records []Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	applied := map[int]Record{}
+	for _, r := range records {
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// Returns the status of every migration, including those applied by a newer version of the server.
+func Statuses(ctx context.Context, db controllers.Database, migrations []Migration) ([]Status, error) {
+	applied, err := Applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	statuses := []Status{}
+	for _, m := range migrations {
+		status := Status{Version: m.Version, Name: m.Name}
+		if r, ok := applied[m.Version]; ok {
+			status.Applied = &r
+			delete(applied, m.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, r := range applied {
+		r := r
+		statuses = append(statuses, Status{Version: r.Version, Name: r.Name, Applied: &r})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+	return statuses, nil
+}
+
+// Applies the pending migrations up to and including the version, or all of them if the version is 0.
+// Stops at the first failure. Returns the migrations applied.
+func Up(ctx context.Context, db controllers.Database, migrations []Migration, to int) ([]Migration, error) {
+	if err := Validate(migrations); err != nil {
+		return nil, err
+	}
+	applied, err := Applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	done := []Migration{}
+	for _, m := range migrations {
+		if to > 0 && m.Version > to {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		slog.InfoContext(ctx, "applying migration", "version", m.Version, "name", m.Name)
+		if err := m.Up(ctx, db); err != nil {
+			return done, fmt.Errorf("migration %v (%v) failed: %w", m.Version, m.Name, err)
+		}
+		record := Record{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}
+		_, err := db(migrationCollection).InsertOne(ctx, record)
+		if mongo.IsDuplicateKeyError(err) {
+			// another instance starting at the same time applied it too, which is safe as Up can run again
+			slog.InfoContext(ctx, "migration was applied by another instance", "version", m.Version, "name", m.Name)
+			continue
+		}
+		if err != nil {
+			return done, fmt.Errorf("migration %v (%v) was applied but could not be recorded: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// Undoes the applied migrations after the version, newest first.
+// Stops at the first failure. Returns the migrations undone.
+func Down(ctx context.Context, db controllers.Database, migrations []Migration, to int) ([]Migration, error) {
+	if err := Validate(migrations); err != nil {
+		return nil, err
+	}
+	applied, err := Applied(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	for version := range applied {
+		if version > to && !known(migrations, version) {
+			return nil, fmt.Errorf("migration %v was applied by a newer version of the server and cannot be undone by this one", version)
+		}
+	}
+	done := []Migration{}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.Version <= to {
+			break
+		}
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		slog.InfoContext(ctx, "undoing migration", "version", m.Version, "name", m.Name)
+		if m.Down != nil {
+			if err := m.Down(ctx, db); err != nil {
+				return done, fmt.Errorf("undoing migration %v (%v) failed: %w", m.Version, m.Name, err)
+			}
+		}
+		if _, err := db(migrationCollection).DeleteOne(ctx, bson.D{{Key: "_id", Value: m.Version}}); err != nil {
+			return done, fmt.Errorf("migration %v (%v) was undone but is still recorded: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+func known(migrations []Migration, version int) bool {
+	for _, m := range migrations {
+		if m.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Sets each field that is missing or null to its value, in every document of the collection.
+func backfill(ctx context.Context, db controllers.Database, collection string, fields bson.D) error {
+	for _, field := range fields {
+		filter := bson.D{{Key: field.Key, Value: nil}}
+		update := bson.D{{Key: "$set", Value: bson.D{field}}}
+		if _, err := db(collection).UpdateMany(ctx, filter, update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The collections kept in MongoDB have indexes, those kept in memory only have unique ones (controllers.UniqueIndexer).
+type indexer interface {
+	Indexes() mongo.IndexView
+}
+
+// The name MongoDB gives an index by default, such as "projectid_1_tags_1".
+func indexName(keys bson.D) string {
+	name := ""
+	for i, key := range keys {
+		if i > 0 {
+			name += "_"
+		}
+		name += fmt.Sprintf("%v_%v", key.Key, key.Value)
+	}
+	return name
+}
+
+func createIndexes(ctx context.Context, db controllers.Database, collection string, keys []bson.D) error {
+	c, ok := db(collection).(indexer)
+	if !ok {
+		return nil
+	}
+	indexes := make([]mongo.IndexModel, len(keys))
+	for i, k := range keys {
+		indexes[i] = mongo.IndexModel{Keys: k, Options: options.Index().SetName(indexName(k))}
+	}
+	_, err := c.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// Creates a unique index on the keys, over the documents matching the partial filter, or all of them if it is empty.
+func createUniqueIndex(ctx context.Context, db controllers.Database, collection string, keys, partial bson.D) error {
+	switch c := db(collection).(type) {
+	case indexer:
+		opts := options.Index().SetName(indexName(keys)).SetUnique(true)
+		if len(partial) > 0 {
+			opts.SetPartialFilterExpression(partial)
+		}
+		_, err := c.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: keys, Options: opts})
+		return err
+	case controllers.UniqueIndexer:
+		fields := make([]string, len(keys))
+		for i, key := range keys {
+			fields[i] = key.Key
+		}
+		return c.CreateUniqueIndex(indexName(keys), fields, partial)
+	}
+	return nil
+}
+
+func dropIndexes(ctx context.Context, db controllers.Database, collection string, keys []bson.D) error {
+	collectionOf := db(collection)
+	if unique, ok := collectionOf.(controllers.UniqueIndexer); ok {
+		for _, k := range keys {
+			unique.DropUniqueIndex(indexName(k))
+		}
+		return nil
+	}
+	c, ok := collectionOf.(indexer)
+	if !ok {
+		return nil
+	}
+	for _, k := range keys {
+		_, err := c.Indexes().DropOne(ctx, indexName(k))
+		var commandErr mongo.CommandError
+		// already dropped
+		if errors.As(err, &commandErr) && commandErr.Name == "IndexNotFound" {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks that the indexes expected once all migrations are applied exist, returning an error naming those missing.
+// Collections kept in memory have no indexes, and are skipped.
+func CheckIndexes(ctx context.Context, db controllers.Database) error {
+	missing := []string{}
+	for collection, keys := range Indexes() {
+		c, ok := db(collection).(indexer)
+		if !ok {
+			continue
+		}
+		specifications, err := c.Indexes().ListSpecifications(ctx)
+		if err != nil {
+			return err
+		}
+		names := map[string]bool{}
+		for _, s := range specifications {
+			names[s.Name] = true
+		}
+		for _, k := range keys {
+			if !names[indexName(k)] {
+				missing = append(missing, collection+"."+indexName(k))
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("missing indexes %v, apply the migrations creating them", strings.Join(missing, ", "))
+	}
+	return nil
+}
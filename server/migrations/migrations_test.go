@@ -0,0 +1,286 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/testdb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// records the order in which the migrations run
+func recording(versions ...int) ([]Migration, *[]int) {
+	ran := []int{}
+	migrations := []Migration{}
+	for _, v := range versions {
+		v := v
+		migrations = append(migrations, Migration{
+			Version: v,
+			Name:    "test",
+			Up: func(ctx context.Context, db controllers.Database) error {
+				ran = append(ran, v)
+				return nil
+			},
+			Down: func(ctx context.Context, db controllers.Database) error {
+				ran = append(ran, -v)
+				return nil
+			},
+		})
+	}
+	return migrations, &ran
+}
+
+func appliedVersions(t *testing.T, db controllers.Database) []int {
+	t.Helper()
+	statuses, err := Statuses(context.Background(), db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := []int{}
+	for _, s := range statuses {
+		versions = append(versions, s.Version)
+	}
+	return versions
+}
+
+func TestUp(t *testing.T) {
+	db := testdb.New()
+	ctx := context.Background()
+	migrations, ran := recording(1, 2, 5)
+
+	done, err := Up(ctx, db, migrations, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 || !reflect.DeepEqual(appliedVersions(t, db), []int{1, 2}) {
+		t.Errorf("Expected versions 1 and 2 to be applied, got %v", appliedVersions(t, db))
+	}
+
+	// applied migrations are not run again
+	if _, err := Up(ctx, db, migrations, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Up(ctx, db, migrations, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*ran, []int{1, 2, 5}) {
+		t.Errorf("Expected each migration to run once in order, got %v", *ran)
+	}
+
+	statuses, err := Statuses(ctx, db, append(migrations, Migration{Version: 6, Name: "pending"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 4 || statuses[2].Applied == nil || statuses[3].Applied != nil {
+		t.Errorf("Expected version 6 to be pending, got %+v", statuses)
+	}
+}
+
+func TestUpStopsAtFailure(t *testing.T) {
+	db := testdb.New()
+	migrations, ran := recording(1, 2, 3)
+	migrations[1].Up = func(ctx context.Context, db controllers.Database) error {
+		return errors.New("failed")
+	}
+
+	done, err := Up(context.Background(), db, migrations, 0)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if len(done) != 1 || !reflect.DeepEqual(*ran, []int{1}) {
+		t.Errorf("Expected only version 1 to run, got %v", *ran)
+	}
+	if !reflect.DeepEqual(appliedVersions(t, db), []int{1}) {
+		t.Errorf("Expected the failed migration not to be recorded, got %v", appliedVersions(t, db))
+	}
+}
+
+func TestUpConcurrently(t *testing.T) {
+	db := testdb.New()
+	ctx := context.Background()
+	migrations, ran := recording(1, 2)
+	// another instance records migration 2 while this one is applying it
+	up := migrations[1].Up
+	migrations[1].Up = func(ctx context.Context, db controllers.Database) error {
+		if _, err := db(migrationCollection).InsertOne(ctx, Record{Version: 2, Name: "test", AppliedAt: time.Now()}); err != nil {
+			return err
+		}
+		return up(ctx, db)
+	}
+
+	done, err := Up(ctx, db, migrations, 0)
+	if err != nil {
+		t.Fatalf("Expected a migration applied by another instance to be skipped, got %v", err)
+	}
+	if len(done) != 1 || done[0].Version != 1 || !reflect.DeepEqual(*ran, []int{1, 2}) {
+		t.Errorf("Expected only migration 1 to be recorded by this instance, got %v", done)
+	}
+	if versions := appliedVersions(t, db); !reflect.DeepEqual(versions, []int{1, 2}) {
+		t.Errorf("Expected %v but got %v", []int{1, 2}, versions)
+	}
+}
+
+func TestDown(t *testing.T) {
+	db := testdb.New()
+	ctx := context.Background()
+	migrations, ran := recording(1, 2, 3)
+	if _, err := Up(ctx, db, migrations, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := Down(ctx, db, migrations, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 || !reflect.DeepEqual(*ran, []int{1, 2, 3, -3, -2}) {
+		t.Errorf("Expected versions 3 and 2 to be undone newest first, got %v", *ran)
+	}
+	if !reflect.DeepEqual(appliedVersions(t, db), []int{1}) {
+		t.Errorf("Expected only version 1 to remain applied, got %v", appliedVersions(t, db))
+	}
+
+	// a migration applied by a newer server cannot be undone
+	if _, err := Down(ctx, db, migrations[:0], 0); err == nil {
+		t.Error("Expected an error undoing an unknown migration")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	noop := func(ctx context.Context, db controllers.Database) error { return nil }
+	tests := map[string][]Migration{
+		"zero version":     {{Version: 0, Up: noop}},
+		"repeated version": {{Version: 1, Up: noop}, {Version: 1, Up: noop}},
+		"out of order":     {{Version: 2, Up: noop}, {Version: 1, Up: noop}},
+		"no up":            {{Version: 1}},
+	}
+	for name, migrations := range tests {
+		if err := Validate(migrations); err == nil {
+			t.Errorf("Expected an error for %v", name)
+		}
+	}
+	if err := Validate(All); err != nil {
+		t.Errorf("Expected All to be valid, got %v", err)
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	db := testdb.New()
+	ctx := context.Background()
+	_, err := db("projects").InsertMany(ctx, []interface{}{
+		// created before members, tags and settings existed
+		bson.D{{Key: "name", Value: "old"}},
+		bson.D{{Key: "name", Value: "null"}, {Key: "members", Value: nil}, {Key: "settings", Value: bson.D{{Key: "roles", Value: nil}}}},
+		models.Project{Name: "new", Members: map[string]string{"u1": "admin"}, Settings: models.DefaultSettings()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Up(ctx, db, All, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := db("projects").Find(ctx, bson.D{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var projects []models.Project
+	if err := cursor.All(ctx, &projects); err != nil {
+		t.Fatal(err)
+	}
+	defaults := models.DefaultSettings()
+	for _, p := range projects {
+		if p.Members == nil || p.Applications == nil || p.Tasks == nil || p.Events == nil {
+			t.Errorf("Expected the lists and maps of %v to be backfilled, got %+v", p.Name, p)
+		}
+		if !reflect.DeepEqual(p.Settings.Roles, defaults.Roles) {
+			t.Errorf("Expected the roles of %v to be backfilled, got %+v", p.Name, p.Settings.Roles)
+		}
+	}
+	if !reflect.DeepEqual(projects[2].Members, map[string]string{"u1": "admin"}) {
+		t.Errorf("Expected existing members to be kept, got %v", projects[2].Members)
+	}
+}
+
+func TestBackfillProjectOfTasks(t *testing.T) {
+	db := testdb.New()
+	ctx := context.Background()
+	legacy, personal := primitive.NewObjectID(), primitive.NewObjectID()
+	_, err := db("tasks").InsertMany(ctx, []interface{}{
+		// created before tasks recorded their project
+		bson.D{{Key: "_id", Value: legacy}, {Key: "name", Value: "legacy"}, {Key: "projectid", Value: ""}},
+		bson.D{{Key: "_id", Value: personal}, {Key: "name", Value: "personal"}, {Key: "isPersonal", Value: true}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	project, err := db("projects").InsertOne(ctx, bson.D{{Key: "name", Value: "project"}, {Key: "tasks", Value: bson.A{legacy.Hex()}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Up(ctx, db, All, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[primitive.ObjectID]string{legacy: project.InsertedID.(primitive.ObjectID).Hex(), personal: ""}
+	for id, projectid := range expected {
+		var task models.Task
+		if err := db("tasks").FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&task); err != nil {
+			t.Fatal(err)
+		}
+		if task.ProjectId != projectid {
+			t.Errorf("Expected %v to have the project %q but got %q", task.Name, projectid, task.ProjectId)
+		}
+	}
+}
+
+func TestRunningTimerIndex(t *testing.T) {
+	db := testdb.New()
+	ctx := context.Background()
+	start := time.Date(2022, 7, 1, 9, 0, 0, 0, time.UTC)
+	// started twice by concurrent requests before the index existed
+	_, err := db("timeEntries").InsertMany(ctx, []interface{}{
+		models.TimeEntry{UserId: "u1", Start: start, IsRunning: true},
+		models.TimeEntry{UserId: "u1", Start: start.Add(time.Millisecond), IsRunning: true},
+		models.TimeEntry{UserId: "u2", Start: start, IsRunning: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Up(ctx, db, All, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := db("timeEntries").Find(ctx, bson.D{{Key: "userid", Value: "u1"}, {Key: "isRunning", Value: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var running []models.TimeEntry
+	if err := cursor.All(ctx, &running); err != nil {
+		t.Fatal(err)
+	}
+	if len(running) != 1 || !running[0].Start.Equal(start) {
+		t.Errorf("Expected only the first timer to keep running, got %+v", running)
+	}
+	// the unique index stops a timer started after the check for a running one
+	_, err = db("timeEntries").InsertOne(ctx, models.TimeEntry{UserId: "u2", Start: start, IsRunning: true})
+	if !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("Expected a second running timer to be rejected, got %v", err)
+	}
+	if _, err := db("timeEntries").InsertOne(ctx, models.TimeEntry{UserId: "u2", Start: start, End: start.Add(time.Hour)}); err != nil {
+		t.Errorf("Expected stopped timers to be allowed, got %v", err)
+	}
+
+	if _, err := Down(ctx, db, All, 4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db("timeEntries").InsertOne(ctx, models.TimeEntry{UserId: "u2", Start: start, IsRunning: true}); err != nil {
+		t.Errorf("Expected the index to be dropped, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AttachmentOwnerTask    = "task"
+	AttachmentOwnerProject = "project"
+
+	// default upload size limit of 10MiB, also used for personal tasks
+	DefaultAttachmentMaxSize = 10 << 20
+)
+
+type Attachment struct {
+	Id           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	OwnerType    string             `bson:"ownerType" json:"ownerType"` // task or project
+	OwnerId      string             `bson:"ownerid" json:"ownerid"`     // taskid or projectid
+	Name         string             `bson:"name" json:"name"`           // original file name
+	ContentType  string             `bson:"contentType" json:"contentType"`
+	Size         int64              `bson:"size" json:"size"` // in bytes
+	Key          string             `bson:"key" json:"-"`     // location in blob storage
+	Uploader     string             `bson:"uploader" json:"uploader"`
+	CreationTime time.Time          `bson:"creationTime" json:"creationTime"`
+}
+
+type AttachmentLimits struct {
+	MaxSize      int64    `bson:"maxSize" json:"maxSize"`           // in bytes
+	AllowedTypes []string `bson:"allowedTypes" json:"allowedTypes"` // MIME types such as "application/pdf", or prefixes such as "image/"; empty to allow all
+}
+
+func DefaultAttachmentLimits() AttachmentLimits {
+	return AttachmentLimits{
+		MaxSize:      DefaultAttachmentMaxSize,
+		AllowedTypes: []string{},
+	}
+}
+
+// Whether files of the content type can be uploaded.
+func (l AttachmentLimits) Allows(contentType string) bool {
+	if len(l.AllowedTypes) == 0 {
+		return true
+	}
+	// ignore parameters such as "; charset=utf-8"
+	contentType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	for _, allowed := range l.AllowedTypes {
+		if strings.HasSuffix(allowed, "/") && strings.HasPrefix(contentType, allowed) {
+			return true
+		} else if contentType == allowed {
+			return true
+		}
+	}
+	return false
+}
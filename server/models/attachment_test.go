@@ -0,0 +1,34 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+)
+
+func TestAttachmentLimitsAllows(t *testing.T) {
+	limits := models.AttachmentLimits{
+		MaxSize:      models.DefaultAttachmentMaxSize,
+		AllowedTypes: []string{"application/pdf", "image/"},
+	}
+
+	tests := map[string]bool{
+		"application/pdf":           true,
+		"image/png":                 true,
+		"image/jpeg":                true,
+		"text/plain; charset=utf-8": false,
+		"application/zip":           false,
+		"imagex/png":                false,
+	}
+
+	for contentType, expected := range tests {
+		if got := limits.Allows(contentType); got != expected {
+			t.Errorf("Allows(%q): expected %v but got %v", contentType, expected, got)
+		}
+	}
+
+	// no restrictions by default
+	if !models.DefaultAttachmentLimits().Allows("application/zip") {
+		t.Errorf("default limits should allow all types")
+	}
+}
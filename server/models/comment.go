@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Comment struct {
+	Id           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	TaskId       string             `bson:"taskid" json:"taskid"`
+	ParentId     string             `bson:"parentid" json:"parentid"` // commentid being replied to, empty for top level comments
+	Author       string             `bson:"author" json:"author"`     // userid
+	Content      string             `bson:"content" json:"content"`
+	Mentions     []string           `bson:"mentions" json:"mentions"` // string[] of userid
+	CreationTime time.Time          `bson:"creationTime" json:"creationTime"`
+	IsDeleted    bool               `bson:"isDeleted" json:"isDeleted"` // deleted comments are kept so that replies stay threaded
+}
+
+// A single change made to a task.
+type TaskActivity struct {
+	Id     primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	TaskId string             `bson:"taskid" json:"taskid"`
+	UserId string             `bson:"userid" json:"userid"` // user who made the change
+	Field  string             `bson:"field" json:"field"`   // name, deadline, estimate, assignedTo, tags or isDone
+	Old    interface{}        `bson:"old" json:"old"`
+	New    interface{}        `bson:"new" json:"new"`
+	Time   time.Time          `bson:"time" json:"time"`
+}
@@ -11,4 +11,10 @@ type Event struct {
 	Name  string             `bson:"name" json:"name"`
 	Start time.Time          `bson:"start" json:"start"`
 	End   time.Time          `bson:"end" json:"end"`
+
+	DeletedAt   *time.Time `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`     // in the trash if set
+	DeletedBy   string     `bson:"deletedBy,omitempty" json:"deletedBy,omitempty"`     // userid, the owner of personal events
+	DeletedFrom string     `bson:"deletedFrom,omitempty" json:"deletedFrom,omitempty"` // projectid, empty for personal events
+
+	Version int64 `bson:"version" json:"version"` // incremented by every write, the ETag of the event
 }
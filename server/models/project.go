@@ -17,6 +17,9 @@ type Project struct {
 	Settings     ProjectSettings               `bson:"settings" json:"settings"`
 	Applications map[string]ProjectApplication `bson:"applications" json:"applications"` // userid -> appliication
 	IsPublic     bool                          `bson:"isPublic" json:"isPublic"`
+	IsArchived   bool                          `bson:"isArchived" json:"isArchived"`                   // archived projects are read-only
+	DeletedAt    *time.Time                    `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"` // in the trash if set
+	Version      int64                         `bson:"version" json:"version"`                         // incremented by every write, the ETag of the project
 }
 
 // using a struct so we can expand this further if needed
@@ -28,6 +31,15 @@ type ProjectApplication struct {
 type ProjectSettings struct {
 	Roles                map[string]Permissions `bson:"roles" json:"roles"`
 	DeadlineNotification time.Time              `bson:"deadlineNotification" json:"deadlineNotification"`
+	States               []WorkflowState        `bson:"states" json:"states"` // ordered columns of the task board
+	Attachments          AttachmentLimits       `bson:"attachments" json:"attachments"`
+}
+
+// A column of the project's task board.
+// Tasks in a terminal state are considered done.
+type WorkflowState struct {
+	Name       string `bson:"name" json:"name"`
+	IsTerminal bool   `bson:"isTerminal" json:"isTerminal"`
 }
 
 type Permissions struct {
@@ -55,5 +67,78 @@ func DefaultSettings() ProjectSettings {
 		AddTask:    true,
 		RemoveTask: true,
 	}
+	settings.States = DefaultStates()
+	settings.Attachments = DefaultAttachmentLimits()
 	return settings
 }
+
+// Returns the upload limits of the project.
+// Projects created before attachments existed fall back to the default limits.
+func (s ProjectSettings) AttachmentLimits() AttachmentLimits {
+	if s.Attachments.MaxSize == 0 {
+		return DefaultAttachmentLimits()
+	}
+	return s.Attachments
+}
+
+func DefaultStates() []WorkflowState {
+	return []WorkflowState{
+		{Name: "Backlog"},
+		{Name: "In Progress"},
+		{Name: "Review"},
+		{Name: "Done", IsTerminal: true},
+	}
+}
+
+// Returns the workflow states of the project.
+// Projects created before workflow states existed fall back to the default states.
+func (s ProjectSettings) WorkflowStates() []WorkflowState {
+	if len(s.States) == 0 {
+		return DefaultStates()
+	}
+	return s.States
+}
+
+// Returns the state with the given name, and whether it exists.
+func (s ProjectSettings) FindState(name string) (WorkflowState, bool) {
+	for _, state := range s.WorkflowStates() {
+		if state.Name == name {
+			return state, true
+		}
+	}
+	return WorkflowState{}, false
+}
+
+// The state new tasks are placed in, which is the first non-terminal state.
+func (s ProjectSettings) InitialState() WorkflowState {
+	states := s.WorkflowStates()
+	for _, state := range states {
+		if !state.IsTerminal {
+			return state
+		}
+	}
+	return states[0]
+}
+
+// The state tasks are moved to when marked as done, which is the first terminal state.
+func (s ProjectSettings) TerminalState() WorkflowState {
+	states := s.WorkflowStates()
+	for _, state := range states {
+		if state.IsTerminal {
+			return state
+		}
+	}
+	return states[len(states)-1]
+}
+
+// Returns the state a task is in.
+// Tasks created before workflow states existed have no state, so it is derived from IsDone instead.
+func (s ProjectSettings) TaskState(task Task) string {
+	if _, ok := s.FindState(task.State); ok {
+		return task.State
+	}
+	if task.IsDone {
+		return s.TerminalState().Name
+	}
+	return s.InitialState().Name
+}
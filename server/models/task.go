@@ -15,5 +15,75 @@ type Task struct {
 	Deadline     time.Time          `bson:"deadline" json:"deadline"`
 	IsDone       bool               `bson:"isDone" json:"isDone"`
 	Tags         []string           `bson:"tags" json:"tags"`
+	Estimate     int                `bson:"estimate" json:"estimate"` // in minutes, 0 if not estimated
 	IsPersonal   bool               `bson:"isPersonal" json:"isPersonal"`
+	ProjectId    string             `bson:"projectid" json:"projectid"` // empty for personal tasks
+	State        string             `bson:"state" json:"state"`         // name of the project's workflow state
+	Position     int                `bson:"position" json:"position"`   // position within the state's column
+	Recurrence   *Recurrence        `bson:"recurrence,omitempty" json:"recurrence,omitempty"`
+	SeriesId     string             `bson:"seriesid,omitempty" json:"seriesid,omitempty"`   // taskid of the first task in the series
+	NextCreated  bool               `bson:"nextCreated" json:"nextCreated"`                 // whether the next instance of the series exists
+	DeletedAt    *time.Time         `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"` // in the trash if set
+	Version      int64              `bson:"version" json:"version"`                         // incremented by every write, the ETag of the task
+}
+
+const (
+	RecurDaily   = "daily"
+	RecurWeekly  = "weekly"
+	RecurMonthly = "monthly"
+)
+
+// Rule for repeating a task.
+// The next instance of the task is created when the current one is done or its deadline passes.
+type Recurrence struct {
+	Frequency string    `bson:"frequency" json:"frequency"`         // daily, weekly or monthly
+	Interval  int       `bson:"interval" json:"interval"`           // repeat every N days, weeks or months
+	Until     time.Time `bson:"until" json:"until"`                 // no instances after this time, zero time for no end
+	Day       int       `bson:"day,omitempty" json:"day,omitempty"` // day of the month of monthly deadlines, that of the first deadline
+}
+
+// Anchors monthly deadlines to the day of the month of the first deadline,
+// so that a month too short for it does not move the deadlines after it.
+func (r *Recurrence) Anchor(deadline time.Time) {
+	if r.Day == 0 {
+		r.Day = deadline.Day()
+	}
+}
+
+// Returns the deadline after the given one.
+func (r Recurrence) Next(deadline time.Time) time.Time {
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+	switch r.Frequency {
+	case RecurDaily:
+		return deadline.AddDate(0, 0, interval)
+	case RecurMonthly:
+		day := r.Day
+		if day == 0 {
+			day = deadline.Day()
+		}
+		// AddDate would overflow into the month after, such as from Jan 31 to Mar 3
+		first := time.Date(deadline.Year(), deadline.Month()+time.Month(interval), 1, deadline.Hour(), deadline.Minute(), deadline.Second(), deadline.Nanosecond(), deadline.Location())
+		if last := first.AddDate(0, 1, -1).Day(); day > last {
+			day = last
+		}
+		return first.AddDate(0, 0, day-1)
+	default:
+		return deadline.AddDate(0, 0, 7*interval)
+	}
+}
+
+// Returns the first deadline after both the given deadline and now, and whether it is before the end of the recurrence.
+func (r Recurrence) NextAfter(deadline, now time.Time) (time.Time, bool) {
+	r.Anchor(deadline)
+	next := r.Next(deadline)
+	for !next.After(now) {
+		next = r.Next(next)
+	}
+	if !r.Until.IsZero() && next.After(r.Until) {
+		return next, false
+	}
+	return next, true
 }
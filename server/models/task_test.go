@@ -0,0 +1,59 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+)
+
+func TestRecurrenceNextAfter(t *testing.T) {
+	deadline := time.Date(2022, 1, 31, 23, 59, 0, 0, time.UTC)
+
+	type test struct {
+		rule     models.Recurrence
+		now      time.Time
+		expected time.Time
+		ok       bool
+	}
+
+	tests := []test{
+		// completed before the deadline
+		{models.Recurrence{Frequency: models.RecurWeekly, Interval: 1}, deadline.Add(-time.Hour), deadline.AddDate(0, 0, 7), true},
+		{models.Recurrence{Frequency: models.RecurDaily, Interval: 2}, deadline.Add(-time.Hour), deadline.AddDate(0, 0, 2), true},
+		// months too short for the day end on their last day
+		{models.Recurrence{Frequency: models.RecurMonthly, Interval: 1}, deadline.Add(-time.Hour), time.Date(2022, 2, 28, 23, 59, 0, 0, time.UTC), true},
+		{models.Recurrence{Frequency: models.RecurMonthly, Interval: 1}, time.Date(2022, 3, 15, 0, 0, 0, 0, time.UTC), time.Date(2022, 3, 31, 23, 59, 0, 0, time.UTC), true},
+		{models.Recurrence{Frequency: models.RecurMonthly, Interval: 3}, deadline, time.Date(2022, 4, 30, 23, 59, 0, 0, time.UTC), true},
+		// deadline passed long ago, skip to the first upcoming deadline
+		{models.Recurrence{Frequency: models.RecurWeekly, Interval: 1}, deadline.AddDate(0, 0, 10), deadline.AddDate(0, 0, 14), true},
+		// series has ended
+		{models.Recurrence{Frequency: models.RecurWeekly, Interval: 1, Until: deadline.AddDate(0, 0, 3)}, deadline, deadline.AddDate(0, 0, 7), false},
+		// interval defaults to 1
+		{models.Recurrence{Frequency: models.RecurDaily}, deadline, deadline.AddDate(0, 0, 1), true},
+	}
+
+	for _, test := range tests {
+		next, ok := test.rule.NextAfter(deadline, test.now)
+		if !next.Equal(test.expected) || ok != test.ok {
+			t.Errorf("Expected (%v, %v) but got (%v, %v) for %v", test.expected, test.ok, next, ok, test.rule)
+		}
+	}
+}
+
+func TestRecurrenceMonthlyKeepsDay(t *testing.T) {
+	rule := models.Recurrence{Frequency: models.RecurMonthly, Interval: 1}
+	deadline := time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC)
+	rule.Anchor(deadline)
+	expected := []time.Time{
+		time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 3, 31, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 4, 30, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 5, 31, 9, 0, 0, 0, time.UTC),
+	}
+	for _, next := range expected {
+		if deadline = rule.Next(deadline); !deadline.Equal(next) {
+			t.Errorf("Expected %v but got %v", next, deadline)
+		}
+	}
+}
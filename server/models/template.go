@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// A saved project skeleton that new projects can be created from.
+// Members, events and the progress of tasks are not saved.
+type ProjectTemplate struct {
+	Id           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Owner        string             `bson:"owner" json:"owner"` // userid, only the owner can see and use the template
+	Name         string             `bson:"name" json:"name"`
+	Description  string             `bson:"description" json:"description"`
+	Settings     ProjectSettings    `bson:"settings" json:"settings"` // roles, workflow states and attachment limits
+	Tasks        []TaskTemplate     `bson:"tasks" json:"tasks"`
+	CreationTime time.Time          `bson:"creationTime" json:"creationTime"`
+}
+
+// A reusable task, either saved within a project or as part of a project template.
+type TaskTemplate struct {
+	Id             primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	ProjectId      string             `bson:"projectid,omitempty" json:"projectid,omitempty"` // empty within a project template
+	Creator        string             `bson:"creator,omitempty" json:"creator,omitempty"`     // userid
+	Name           string             `bson:"name" json:"name"`
+	Description    string             `bson:"description" json:"description"`
+	Tags           []string           `bson:"tags" json:"tags"`
+	Estimate       int                `bson:"estimate" json:"estimate"`                                 // in minutes
+	DeadlineOffset *int               `bson:"deadlineOffset,omitempty" json:"deadlineOffset,omitempty"` // minutes after the start date, nil for no deadline
+	Recurrence     *Recurrence        `bson:"recurrence,omitempty" json:"recurrence,omitempty"`         // until is not kept
+}
+
+// Converts a task into a template, with its deadline relative to start.
+func NewTaskTemplate(task Task, start time.Time) TaskTemplate {
+	template := TaskTemplate{
+		Name:        task.Name,
+		Description: task.Description,
+		Tags:        append([]string{}, task.Tags...),
+		Estimate:    task.Estimate,
+	}
+	if !task.Deadline.IsZero() {
+		offset := int(task.Deadline.Sub(start) / time.Minute)
+		template.DeadlineOffset = &offset
+	}
+	if task.Recurrence != nil && !task.Deadline.IsZero() {
+		recurrence := *task.Recurrence
+		recurrence.Until = time.Time{}
+		// anchored again to the deadline of each task created from the template
+		recurrence.Day = 0
+		template.Recurrence = &recurrence
+	}
+	return template
+}
+
+// Creates a new task from the template, with its deadline rebased on start.
+func (t TaskTemplate) Instantiate(start time.Time) Task {
+	task := Task{
+		Name:        t.Name,
+		Description: t.Description,
+		Tags:        append([]string{}, t.Tags...),
+		Estimate:    t.Estimate,
+	}
+	if t.DeadlineOffset != nil {
+		task.Deadline = start.Add(time.Duration(*t.DeadlineOffset) * time.Minute)
+		if t.Recurrence != nil {
+			recurrence := *t.Recurrence
+			task.Recurrence = &recurrence
+		}
+	}
+	return task
+}
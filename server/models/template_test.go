@@ -0,0 +1,49 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+)
+
+func TestTaskTemplate(t *testing.T) {
+	start := time.Date(2022, 1, 10, 0, 0, 0, 0, time.UTC)
+	task := models.Task{
+		Name:       "weekly report",
+		Tags:       []string{"report"},
+		Estimate:   60,
+		Deadline:   start.AddDate(0, 0, 14).Add(18 * time.Hour),
+		IsDone:     true,
+		State:      "Done",
+		AssignedTo: []string{"user"},
+		Recurrence: &models.Recurrence{Frequency: models.RecurWeekly, Interval: 1, Until: start.AddDate(0, 3, 0)},
+	}
+
+	template := models.NewTaskTemplate(task, start)
+	if template.DeadlineOffset == nil || *template.DeadlineOffset != (14*24+18)*60 {
+		t.Fatalf("Expected deadline offset of 14 days and 18 hours but got %v", template.DeadlineOffset)
+	}
+	if !template.Recurrence.Until.IsZero() {
+		t.Errorf("Expected end of recurrence to be dropped but got %v", template.Recurrence.Until)
+	}
+
+	// rebased on a new start date, without the progress of the original task
+	newStart := time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)
+	instance := template.Instantiate(newStart)
+	if !instance.Deadline.Equal(newStart.AddDate(0, 0, 14).Add(18 * time.Hour)) {
+		t.Errorf("Expected deadline to be rebased but got %v", instance.Deadline)
+	}
+	if instance.Name != task.Name || instance.Estimate != task.Estimate || len(instance.Tags) != 1 || instance.Recurrence == nil {
+		t.Errorf("Expected fields to be copied but got %v", instance)
+	}
+	if instance.IsDone || instance.State != "" || len(instance.AssignedTo) != 0 {
+		t.Errorf("Expected a fresh task but got %v", instance)
+	}
+
+	// tasks without deadlines stay without deadlines
+	noDeadline := models.NewTaskTemplate(models.Task{Name: "someday"}, start).Instantiate(newStart)
+	if !noDeadline.Deadline.IsZero() {
+		t.Errorf("Expected no deadline but got %v", noDeadline.Deadline)
+	}
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Time spent by a user on a task, either tracked with a timer or entered manually.
+type TimeEntry struct {
+	Id        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	TaskId    string             `bson:"taskid" json:"taskid"`
+	ProjectId string             `bson:"projectid" json:"projectid"` // empty for personal tasks
+	UserId    string             `bson:"userid" json:"userid"`
+	Start     time.Time          `bson:"start" json:"start"`
+	End       time.Time          `bson:"end" json:"end"`             // zero time while the timer is running
+	IsRunning bool               `bson:"isRunning" json:"isRunning"` // each user has at most one running timer
+	IsManual  bool               `bson:"isManual" json:"isManual"`
+	Note      string             `bson:"note" json:"note"`
+}
+
+// Time spent, counting a running timer up till now.
+func (e TimeEntry) Duration(now time.Time) time.Duration {
+	end := e.End
+	if e.IsRunning {
+		end = now
+	}
+	if end.Before(e.Start) {
+		return 0
+	}
+	return end.Sub(e.Start)
+}
+
+// Logged time of a project, aggregated in different ways.
+// All times are in minutes.
+type TimeReport struct {
+	ProjectId string          `json:"projectid"`
+	Total     int64           `json:"total"`
+	Estimate  int64           `json:"estimate"` // sum of the estimates of all tasks in the project
+	Members   []TimeReportRow `json:"members"`  // key is the userid
+	Tags      []TimeReportRow `json:"tags"`     // key is the tag, empty for untagged tasks; time on tasks with many tags counts towards each tag
+	Weeks     []TimeReportRow `json:"weeks"`    // key is the ISO week of the start of the entry, such as "2022-W05"
+}
+
+type TimeReportRow struct {
+	Key     string `json:"key"`
+	Name    string `json:"name,omitempty"` // name of the member
+	Minutes int64  `json:"minutes"`
+}
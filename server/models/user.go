@@ -21,6 +21,7 @@ type User struct {
 	Settings        UserSettings       `bson:"settings" json:"settings"`
 	Invites         []string           `bson:"invites" json:"invites"` // [projectid]
 	IsPublic        bool               `bson:"isPublic" json:"isPublic"`
+	Version         int64              `bson:"version" json:"version"` // incremented by every write, the ETag of the user
 }
 
 type UserSettings struct {
@@ -1,6 +1,7 @@
 package nusmods
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,6 +13,9 @@ import (
 	"time"
 
 	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // This package is for parsing nusmods content, used for EventNusmods handler.
@@ -126,21 +130,39 @@ type ModuleInfo struct {
 	FulFillRequirements interface{} // not using
 }
 
-func GetModuleInfo(acadYear int, moduleCode string) (ModuleInfo, error) {
+// Traces the requests to the NUSMods API, passing the trace on to it.
+var client = &http.Client{
+	Transport: otelhttp.NewTransport(http.DefaultTransport),
+	Timeout:   10 * time.Second,
+}
+
+func GetModuleInfo(ctx context.Context, acadYear int, moduleCode string) (ModuleInfo, error) {
 	// API info from: https://api.nusmods.com/v2/#/Modules/get__acadYear__modules__moduleCode__json
 
 	var moduleInfo ModuleInfo
 
+	ctx, span := tracing.Start(ctx, "nusmods.GetModuleInfo", attribute.String("module", moduleCode), attribute.Int("acadYear", acadYear))
+	defer span.End()
+
 	url := fmt.Sprintf("https://api.nusmods.com/v2/%v-%v/modules/%v.json", acadYear, acadYear+1, moduleCode)
-	resp, err := http.Get(url)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		tracing.Fail(span, err)
+		return moduleInfo, err
+	}
+	resp, err := client.Do(request)
 	if err != nil {
+		tracing.Fail(span, err)
 		return moduleInfo, err
 	}
+	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
+		tracing.Fail(span, err)
 		return moduleInfo, err
 	}
 	if err := json.Unmarshal(body, &moduleInfo); err != nil {
+		tracing.Fail(span, err)
 		return moduleInfo, err
 	}
 	return moduleInfo, nil
@@ -250,7 +272,7 @@ func ParseURL(url string) (int, []Module, error) {
 }
 
 // This is the entrypoint used by EventsNusmods handler.
-func GenerateEvents(url string) ([]*models.Event, error) {
+func GenerateEvents(ctx context.Context, url string) ([]*models.Event, error) {
 	semester, modules, err := ParseURL(url)
 	if err != nil {
 		return nil, err
@@ -273,7 +295,7 @@ func GenerateEvents(url string) ([]*models.Event, error) {
 	events := []*models.Event{}
 
 	for _, module := range modules {
-		moduleInfo, err := GetModuleInfo(acadYear, module.Code)
+		moduleInfo, err := GetModuleInfo(ctx, acadYear, module.Code)
 		if err != nil {
 			return nil, err
 		}
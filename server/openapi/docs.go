@@ -0,0 +1,33 @@
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A page that renders the document at "openapi.json" next to it, without loading anything else.
+//
+//go:embed docs.html
+var docsPage []byte
+
+// Serves the document as JSON, which is only encoded once.
+func Handler(doc *Document) gin.HandlerFunc {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		// only possible if a schema is not valid JSON, which is a bug
+		panic(err)
+	}
+	return func(ctx *gin.Context) {
+		ctx.Data(http.StatusOK, "application/json; charset=utf-8", body)
+	}
+}
+
+// Serves the docs page, which must be on the same path as the document served by Handler.
+func Docs() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Data(http.StatusOK, "text/html; charset=utf-8", docsPage)
+	}
+}
@@ -0,0 +1,432 @@
+// OpenAPI 3 documents of the API, built from its routes and the Go types that they take and respond with.
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const Version = "3.0.3"
+
+// A route of the API, described by zero values of the Go types it takes and responds with.
+// Their fields are named by their json tags (form tags for query parameters), and can be annotated with
+// doc:"description", required:"true" and enum:"a,b,c" tags.
+type Route struct {
+	Method      string // http.MethodGet and so on
+	Path        string // as registered with gin, with parameters written as :id
+	Tag         string // the group of the route
+	Summary     string
+	Description string
+	Auth        bool   // whether the route requires logging in
+	Query       any    // struct whose fields are the query parameters
+	Body        any    // JSON body
+	Form        any    // multipart form body, whose *multipart.FileHeader fields are files
+	Status      int    // of a successful response, 200 if not set
+	Response    any    // JSON body of a successful response, an empty object if nil
+	ContentType string // of a successful response that is not JSON, such as "text/csv"
+	WebSocket   bool   // upgraded to a websocket connection
+	Versioned   bool   // the resource has an ETag, which successful responses with it carry and PATCH and DELETE take in If-Match
+}
+
+// What the whole document is built from.
+type Spec struct {
+	Title       string
+	Description string
+	Version     string // of the API
+	Routes      []Route
+	Error       any // JSON body of failed responses
+}
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Tags       []Tag               `json:"tags,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Tag struct {
+	Name string `json:"name"`
+}
+
+// Operations by their lowercase HTTP method.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` // "query", "path" or "header"
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type string `json:"type"`
+	In   string `json:"in"`
+	Name string `json:"name"`
+}
+
+// The JWT cookie set by logging in.
+const securityScheme = "jwt"
+
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+// Converts a gin path to an OpenAPI one, such as /tasks/:id to /tasks/{id}.
+func Path(path string) string {
+	return pathParam.ReplaceAllString(path, "{$1}")
+}
+
+// Builds the document of the spec.
+// The named struct types used by the routes are shared as components.
+func Build(spec Spec) *Document {
+	b := builder{schemas: map[string]*Schema{}, names: map[reflect.Type]string{}}
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: spec.Title, Description: spec.Description, Version: spec.Version},
+		Paths:   map[string]PathItem{},
+		Components: Components{
+			Schemas:         b.schemas,
+			SecuritySchemes: map[string]SecurityScheme{securityScheme: {Type: "apiKey", In: "cookie", Name: "jwt"}},
+		},
+	}
+	var errorSchema *Schema
+	if spec.Error != nil {
+		errorSchema = b.schema(reflect.TypeOf(spec.Error))
+	}
+
+	tags := map[string]bool{}
+	for _, route := range spec.Routes {
+		path := Path(route.Path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = b.operation(route, errorSchema)
+		if route.Tag != "" && !tags[route.Tag] {
+			tags[route.Tag] = true
+			doc.Tags = append(doc.Tags, Tag{Name: route.Tag})
+		}
+	}
+	return doc
+}
+
+// Whether the document has the operation of the gin route.
+func (d *Document) Has(method, path string) bool {
+	_, ok := d.Paths[Path(path)][strings.ToLower(method)]
+	return ok
+}
+
+type builder struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func (b *builder) operation(route Route, errorSchema *Schema) *Operation {
+	op := &Operation{
+		Summary:     route.Summary,
+		Description: route.Description,
+		OperationID: operationID(route),
+		Responses:   map[string]Response{},
+	}
+	if route.Tag != "" {
+		op.Tags = []string{route.Tag}
+	}
+	if route.Auth {
+		op.Security = []map[string][]string{{securityScheme: {}}}
+	}
+
+	for _, match := range pathParam.FindAllStringSubmatch(route.Path, -1) {
+		op.Parameters = append(op.Parameters, Parameter{Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+	if route.Query != nil {
+		op.Parameters = append(op.Parameters, b.queryParameters(reflect.TypeOf(route.Query))...)
+	}
+	if route.Versioned && (route.Method == http.MethodPatch || route.Method == http.MethodDelete) {
+		op.Parameters = append(op.Parameters, Parameter{
+			Name:        "If-Match",
+			In:          "header",
+			Description: "the ETag the resource was read at, failing with 412 if it was modified since",
+			Schema:      &Schema{Type: "string"},
+		})
+	}
+	if route.Body != nil {
+		op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{
+			"application/json": {Schema: b.schema(reflect.TypeOf(route.Body))},
+		}}
+	} else if route.Form != nil {
+		op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{
+			"multipart/form-data": {Schema: b.schema(reflect.TypeOf(route.Form))},
+		}}
+	}
+
+	status := route.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := Response{Description: http.StatusText(status)}
+	switch {
+	case route.WebSocket:
+		status = http.StatusSwitchingProtocols
+		success.Description = "Upgraded to a websocket connection."
+	case route.ContentType != "":
+		success.Content = map[string]MediaType{route.ContentType: {Schema: &Schema{Type: "string", Format: "binary"}}}
+	case route.Response != nil:
+		success.Content = map[string]MediaType{"application/json": {Schema: b.schema(reflect.TypeOf(route.Response))}}
+	default:
+		success.Content = map[string]MediaType{"application/json": {Schema: &Schema{Type: "object"}}}
+	}
+	// an empty body is not the resource, so it carries no ETag
+	if t := reflect.TypeOf(route.Response); route.Versioned && t != nil && !(t.Kind() == reflect.Struct && t.NumField() == 0) {
+		success.Headers = map[string]Header{"ETag": {Description: "the version of the resource", Schema: &Schema{Type: "string"}}}
+	}
+	op.Responses[strconv.Itoa(status)] = success
+	if errorSchema != nil {
+		op.Responses["default"] = Response{
+			Description: "The request failed, with the HTTP status of the error code.",
+			Content:     map[string]MediaType{"application/json": {Schema: errorSchema}},
+		}
+	}
+	return op
+}
+
+// Such as "get_/api/v1/task_get_all" becoming "getApiV1TaskGetAll".
+func operationID(route Route) string {
+	var id strings.Builder
+	id.WriteString(strings.ToLower(route.Method))
+	for _, word := range strings.FieldsFunc(route.Path, func(r rune) bool { return r == '/' || r == '_' || r == ':' || r == '.' || r == '-' }) {
+		id.WriteString(strings.ToUpper(word[:1]) + word[1:])
+	}
+	return id.String()
+}
+
+func (b *builder) queryParameters(t reflect.Type) []Parameter {
+	params := []Parameter{}
+	for _, field := range fields(t) {
+		name := field.Tag.Get("form")
+		if name == "" {
+			name = jsonName(field)
+		}
+		schema := b.fieldSchema(field)
+		// described by the parameter instead
+		schema.Description = ""
+		params = append(params, Parameter{
+			Name:        name,
+			In:          "query",
+			Description: field.Tag.Get("doc"),
+			Required:    field.Tag.Get("required") == "true",
+			Schema:      schema,
+		})
+	}
+	return params
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	durationType   = reflect.TypeOf(time.Duration(0))
+	fileType       = reflect.TypeOf(&multipart.FileHeader{})
+	jsonMarshaler  = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler  = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	emptyInterface = reflect.TypeOf((*any)(nil)).Elem()
+)
+
+// Returns the schema of the type, referring to the components for named structs.
+func (b *builder) schema(t reflect.Type) *Schema {
+	switch {
+	case t == fileType:
+		return &Schema{Type: "string", Format: "binary"}
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == durationType:
+		return &Schema{Type: "integer", Format: "int64", Description: "nanoseconds"}
+	case t == emptyInterface:
+		return &Schema{}
+	}
+	if t.Kind() == reflect.Pointer {
+		return b.schema(t.Elem())
+	}
+	if t.Kind() != reflect.String && (t.Implements(jsonMarshaler) || t.Implements(textMarshaler)) {
+		// such as object ids, which are written as hex strings
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + b.component(t)}
+	}
+	return &Schema{}
+}
+
+// Adds the named struct to the components if it is not there, returning its name.
+func (b *builder) component(t reflect.Type) string {
+	if name, ok := b.names[t]; ok {
+		return name
+	}
+	name := componentName(t.Name())
+	if _, taken := b.schemas[name]; taken {
+		// the same name in another package
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = pkg + "." + name
+	}
+	b.names[t] = name
+	b.schemas[name] = &Schema{} // placeholder, for types that refer to themselves
+	*b.schemas[name] = *b.object(t)
+	return name
+}
+
+// Returns the name of the type as a component.
+// Unexported types of the spec are named as exported ones, and instances of generic types are named after their type arguments,
+// such as "Page" and "Task" for page[models.Task].
+func componentName(name string) string {
+	var component strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '[' || r == ']' || r == ',' || r == '*' }) {
+		// the package paths of type arguments are left out
+		part = part[strings.LastIndexAny(part, "./")+1:]
+		if part != "" {
+			component.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return component.String()
+}
+
+func (b *builder) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for _, field := range fields(t) {
+		name := jsonName(field)
+		s.Properties[name] = b.fieldSchema(field)
+		if field.Tag.Get("required") == "true" {
+			s.Required = append(s.Required, name)
+		}
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+func (b *builder) fieldSchema(field reflect.StructField) *Schema {
+	s := b.schema(field.Type)
+	doc, enum := field.Tag.Get("doc"), field.Tag.Get("enum")
+	if doc == "" && enum == "" {
+		return s
+	}
+	if s.Ref != "" {
+		// siblings of $ref are ignored, so the reference is wrapped
+		return &Schema{Description: doc, AllOf: []*Schema{s}}
+	}
+	copied := *s
+	copied.Description = doc
+	if enum != "" {
+		copied.Enum = strings.Split(enum, ",")
+	}
+	return &copied
+}
+
+// The fields of the struct that are written as JSON, with those of embedded structs.
+func fields(t reflect.Type) []reflect.StructField {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	result := []reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Tag.Get("json") == "-" {
+			continue
+		}
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			result = append(result, fields(field.Type)...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		result = append(result, field)
+	}
+	return result
+}
+
+func jsonName(field reflect.StructField) string {
+	if name, _, _ := strings.Cut(field.Tag.Get("json"), ","); name != "" {
+		return name
+	}
+	return field.Name
+}
@@ -0,0 +1,173 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/openapi"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type base struct {
+	Id primitive.ObjectID `json:"id"`
+}
+
+type item struct {
+	base
+	Name     string           `json:"name" required:"true" doc:"shown to users"`
+	Kind     string           `json:"kind" enum:"a,b"`
+	Created  time.Time        `json:"created"`
+	Tags     []string         `json:"tags,omitempty"`
+	Counts   map[string]int64 `json:"counts"`
+	Parent   *item            `json:"parent" doc:"the item this is under"`
+	Secret   string           `json:"-"`
+	internal string
+	Plain    bool
+}
+
+type itemQuery struct {
+	Limit int `form:"limit" doc:"at most 100"`
+}
+
+type upload struct {
+	File *multipart.FileHeader `json:"file" required:"true"`
+}
+
+type envelope[T any] struct {
+	Data T `json:"data"`
+}
+
+type problem struct {
+	Error string `json:"error"`
+}
+
+func build() *openapi.Document {
+	return openapi.Build(openapi.Spec{
+		Title:   "test",
+		Version: "v1",
+		Error:   problem{},
+		Routes: []openapi.Route{
+			{Method: http.MethodGet, Path: "/items/:id", Tag: "items", Summary: "Returns an item", Auth: true, Query: itemQuery{}, Response: item{}},
+			{Method: http.MethodPost, Path: "/items", Tag: "items", Body: item{}, Status: http.StatusCreated},
+			{Method: http.MethodPost, Path: "/uploads", Form: upload{}},
+			{Method: http.MethodGet, Path: "/items/:id/csv", ContentType: "text/csv"},
+			{Method: http.MethodGet, Path: "/envelopes", Response: envelope[[]item]{}},
+			{Method: http.MethodPatch, Path: "/items/:id", Body: item{}, Response: item{}, Versioned: true},
+			{Method: http.MethodDelete, Path: "/items/:id", Response: struct{}{}, Versioned: true},
+		},
+	})
+}
+
+func TestBuild(t *testing.T) {
+	doc := build()
+
+	if !doc.Has(http.MethodGet, "/items/:id") || !doc.Has(http.MethodPost, "/items") || doc.Has(http.MethodDelete, "/items") {
+		t.Errorf("Expected the document to have exactly the routes given")
+	}
+
+	get := doc.Paths["/items/{id}"]["get"]
+	if get.OperationID != "getItemsId" || get.Summary != "Returns an item" || len(get.Security) != 1 {
+		t.Errorf("Expected the operation to be described but got %+v", get)
+	}
+	expectedParams := []openapi.Parameter{
+		{Name: "id", In: "path", Required: true, Schema: &openapi.Schema{Type: "string"}},
+		{Name: "limit", In: "query", Description: "at most 100", Schema: &openapi.Schema{Type: "integer", Format: "int32"}},
+	}
+	if !reflect.DeepEqual(get.Parameters, expectedParams) {
+		t.Errorf("Expected parameters %+v but got %+v", expectedParams, get.Parameters)
+	}
+	if ref := get.Responses["200"].Content["application/json"].Schema.Ref; ref != "#/components/schemas/Item" {
+		t.Errorf("Expected the response to refer to Item but got %v", ref)
+	}
+	if ref := get.Responses["default"].Content["application/json"].Schema.Ref; ref != "#/components/schemas/Problem" {
+		t.Errorf("Expected errors to refer to Problem but got %v", ref)
+	}
+
+	if _, ok := doc.Paths["/items"]["post"].Responses["201"]; !ok {
+		t.Errorf("Expected the status of the response to be 201")
+	}
+	if schema := doc.Paths["/uploads"]["post"].RequestBody.Content["multipart/form-data"].Schema; schema.Ref != "#/components/schemas/Upload" {
+		t.Errorf("Expected the form to refer to Upload but got %+v", schema)
+	}
+	if file := doc.Components.Schemas["Upload"].Properties["file"]; file.Format != "binary" {
+		t.Errorf("Expected files to be binary but got %+v", file)
+	}
+	if _, ok := doc.Paths["/items/{id}/csv"]["get"].Responses["200"].Content["text/csv"]; !ok {
+		t.Errorf("Expected the response to be CSV")
+	}
+	if ref := doc.Paths["/envelopes"]["get"].Responses["200"].Content["application/json"].Schema.Ref; ref != "#/components/schemas/EnvelopeItem" {
+		t.Errorf("Expected generic types to be named after their type arguments but got %v", ref)
+	}
+
+	patch := doc.Paths["/items/{id}"]["patch"]
+	if last := patch.Parameters[len(patch.Parameters)-1]; last.Name != "If-Match" || last.In != "header" {
+		t.Errorf("Expected versioned changes to take If-Match but got %+v", patch.Parameters)
+	}
+	if _, ok := patch.Responses["200"].Headers["ETag"]; !ok {
+		t.Errorf("Expected versioned responses to have an ETag but got %+v", patch.Responses["200"])
+	}
+	if del := doc.Paths["/items/{id}"]["delete"]; len(del.Responses["200"].Headers) != 0 {
+		t.Errorf("Expected empty responses to have no ETag but got %+v", del.Responses["200"].Headers)
+	}
+	if len(get.Responses["200"].Headers) != 0 {
+		t.Errorf("Expected responses that are not versioned to have no headers but got %+v", get.Responses["200"].Headers)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	schema := build().Components.Schemas["Item"]
+
+	names := []string{}
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	expected := map[string]bool{"id": true, "name": true, "kind": true, "created": true, "tags": true, "counts": true, "parent": true, "Plain": true}
+	if len(names) != len(expected) {
+		t.Errorf("Expected properties %v but got %v", expected, names)
+	}
+	for _, name := range names {
+		if !expected[name] {
+			t.Errorf("Unexpected property %v", name)
+		}
+	}
+
+	tests := map[string]openapi.Schema{
+		"id":      {Type: "string"},
+		"name":    {Type: "string", Description: "shown to users"},
+		"kind":    {Type: "string", Enum: []string{"a", "b"}},
+		"created": {Type: "string", Format: "date-time"},
+		"tags":    {Type: "array", Items: &openapi.Schema{Type: "string"}},
+		"counts":  {Type: "object", AdditionalProperties: &openapi.Schema{Type: "integer", Format: "int64"}},
+		// references cannot have a description beside them
+		"parent": {Description: "the item this is under", AllOf: []*openapi.Schema{{Ref: "#/components/schemas/Item"}}},
+		"Plain":  {Type: "boolean"},
+	}
+	for name, expected := range tests {
+		if actual := schema.Properties[name]; !reflect.DeepEqual(*actual, expected) {
+			t.Errorf("Expected %v to be %+v but got %+v", name, expected, *actual)
+		}
+	}
+	if !reflect.DeepEqual(schema.Required, []string{"name"}) {
+		t.Errorf("Expected only name to be required but got %v", schema.Required)
+	}
+	if _, err := json.Marshal(build()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPath(t *testing.T) {
+	tests := map[string]string{
+		"/api/v1/task_get_all":               "/api/v1/task_get_all",
+		"/projects/:id":                      "/projects/{id}",
+		"/projects/:projectid/tasks/:taskid": "/projects/{projectid}/tasks/{taskid}",
+	}
+	for path, expected := range tests {
+		if actual := openapi.Path(path); actual != expected {
+			t.Errorf("Expected %v but got %v", expected, actual)
+		}
+	}
+}
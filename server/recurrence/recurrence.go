@@ -0,0 +1,100 @@
+// Creates the next instances of recurring tasks.
+package recurrence
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+)
+
+const (
+	// how often to look for recurring tasks whose deadline has passed
+	checkInterval = 5 * time.Minute
+)
+
+// Creates the next instance of a recurring task, with the deadline moved forward and the assignees and tags copied.
+// Returns false if the task does not recur, the series has ended, or the next instance was already created.
+// The next instance is returned with an error if it was created but could not be added to its assignees or project.
+func Spawn(ctx context.Context, userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, task models.Task, now time.Time) (models.Task, bool, error) {
+	if task.Recurrence == nil || task.Deadline.IsZero() {
+		return models.Task{}, false, nil
+	}
+	deadline, ok := task.Recurrence.NextAfter(task.Deadline, now)
+	// tasks created before they recorded their projectid are found through their project
+	project, err := projectController.ProjectOfTask(ctx, task)
+	if err != nil {
+		return models.Task{}, false, err
+	}
+	// claim even when the series has ended, so that the task is not checked again
+	claimed, err := taskController.TaskClaimNext(ctx, task.Id)
+	if err != nil || !claimed || !ok {
+		return models.Task{}, false, err
+	}
+
+	next := models.Task{
+		Name:        task.Name,
+		AssignedTo:  append([]string{}, task.AssignedTo...),
+		Description: task.Description,
+		Deadline:    deadline,
+		Tags:        append([]string{}, task.Tags...),
+		Estimate:    task.Estimate,
+		IsPersonal:  task.IsPersonal,
+		ProjectId:   task.ProjectId,
+		Recurrence:  task.Recurrence,
+		SeriesId:    task.SeriesId,
+	}
+
+	if project == nil {
+		if err := taskController.TaskCreate(ctx, &next); err != nil {
+			return models.Task{}, false, err
+		}
+		if err := userController.UsersAddTask(ctx, next.AssignedTo, next.Id.Hex(), true); err != nil {
+			return next, true, err
+		}
+		return next, true, nil
+	}
+
+	next.ProjectId = project.Id.Hex()
+	next.State = project.Settings.InitialState().Name
+	next.Position = len(controllers.TaskColumn(project.Settings, taskController.TaskMapToArray(ctx, project.Tasks), next.State))
+	if err := taskController.TaskCreate(ctx, &next); err != nil {
+		return models.Task{}, false, err
+	}
+	taskid := next.Id.Hex()
+	if err := userController.UsersAddTask(ctx, next.AssignedTo, taskid, false); err != nil {
+		return next, true, err
+	}
+	if err := projectController.ProjectAddTasks(ctx, next.ProjectId, []string{taskid}); err != nil {
+		return next, true, err
+	}
+	return next, true, nil
+}
+
+// Periodically creates the next instance of recurring tasks whose deadline has passed.
+// Blocks until ctx is cancelled.
+func Run(ctx context.Context, userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		tasks, err := taskController.TaskFindOverdueRecurring(ctx, now)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to find overdue recurring tasks", "error", err)
+		}
+		for _, task := range tasks {
+			if _, _, err := Spawn(ctx, userController, projectController, taskController, task, now); err != nil {
+				slog.ErrorContext(ctx, "failed to create next instance of task", "taskid", task.Id.Hex(), "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
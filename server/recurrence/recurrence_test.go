@@ -0,0 +1,136 @@
+package recurrence_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/functions"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/recurrence"
+	"github.com/OrgaNiUS/OrgaNiUS/server/testdb"
+)
+
+type controllerSet struct {
+	user    controllers.UserController
+	project controllers.ProjectController
+	task    controllers.TaskController
+}
+
+func newControllers(t *testing.T) (controllerSet, *models.User) {
+	t.Helper()
+	database := testdb.New()
+	c := controllerSet{
+		user:    *controllers.NewU(database, "", nil),
+		project: *controllers.NewP(database, "", nil),
+		task:    *controllers.NewT(database, ""),
+	}
+	user := &models.User{Name: "user", Email: "user@mail.com", Tasks: map[string]bool{}, Projects: []string{}, Events: []string{}}
+	if err := c.user.UserCreate(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return c, user
+}
+
+func (c controllerSet) createTask(t *testing.T, task models.Task) models.Task {
+	t.Helper()
+	if err := c.task.TaskCreate(context.Background(), &task); err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+func TestSpawn(t *testing.T) {
+	ctx := context.Background()
+	c, user := newControllers(t)
+	userid := user.Id.Hex()
+	deadline := time.Date(2022, 1, 31, 12, 0, 0, 0, time.UTC)
+	now := deadline.Add(-time.Hour)
+	monthly := &models.Recurrence{Frequency: models.RecurMonthly, Interval: 1}
+	task := c.createTask(t, models.Task{Name: "rent", AssignedTo: []string{userid}, Tags: []string{"home"}, IsPersonal: true, Deadline: deadline, Recurrence: monthly})
+
+	next, ok, err := recurrence.Spawn(ctx, c.user, c.project, c.task, task, now)
+	if err != nil || !ok {
+		t.Fatalf("Expected the next instance to be created, got %v %v", ok, err)
+	}
+	if next.Name != "rent" || next.SeriesId != task.SeriesId || !next.Deadline.Equal(time.Date(2022, 2, 28, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the next instance of the series at the end of February, got %+v", next)
+	}
+	if retrieved, err := c.user.UserRetrieve(ctx, userid, ""); err != nil || !retrieved.Tasks[next.Id.Hex()] {
+		t.Errorf("Expected the next instance to be a personal task of the user, got %v", retrieved.Tasks)
+	}
+
+	// the next instance is only created once
+	if _, ok, err := recurrence.Spawn(ctx, c.user, c.project, c.task, task, now); ok || err != nil {
+		t.Errorf("Expected the next instance to not be created again, got %v %v", ok, err)
+	}
+
+	// and keeps the day the series started on
+	after, ok, err := recurrence.Spawn(ctx, c.user, c.project, c.task, next, now)
+	if err != nil || !ok || !after.Deadline.Equal(time.Date(2022, 3, 31, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the instance after to be at the end of March, got %v %v %v", after.Deadline, ok, err)
+	}
+
+	// series that have ended are claimed without creating anything
+	ended := c.createTask(t, models.Task{Name: "ended", IsPersonal: true, Deadline: deadline, Recurrence: &models.Recurrence{Frequency: models.RecurDaily, Interval: 1, Until: deadline}})
+	if _, ok, err := recurrence.Spawn(ctx, c.user, c.project, c.task, ended, now); ok || err != nil {
+		t.Errorf("Expected no instance after the end of the series, got %v %v", ok, err)
+	}
+	if retrieved, _ := c.task.TaskRetrieve(ctx, ended.Id.Hex()); !retrieved.NextCreated {
+		t.Errorf("Expected the ended series to be claimed")
+	}
+}
+
+func TestSpawnProjectTask(t *testing.T) {
+	ctx := context.Background()
+	c, user := newControllers(t)
+	userid := user.Id.Hex()
+	project := &models.Project{Name: "project"}
+	if err := c.project.ProjectCreate(ctx, project, userid); err != nil {
+		t.Fatal(err)
+	}
+	projectid := project.Id.Hex()
+	deadline := time.Date(2022, 1, 3, 12, 0, 0, 0, time.UTC)
+	weekly := &models.Recurrence{Frequency: models.RecurWeekly, Interval: 1}
+
+	// including tasks created before they recorded their projectid
+	for _, projectOf := range []string{projectid, ""} {
+		task := c.createTask(t, models.Task{Name: "standup", AssignedTo: []string{userid}, ProjectId: projectOf, Deadline: deadline, Recurrence: weekly, IsDone: true})
+		c.project.ProjectAddTasks(ctx, projectid, []string{task.Id.Hex()})
+
+		next, ok, err := recurrence.Spawn(ctx, c.user, c.project, c.task, task, deadline)
+		if err != nil || !ok {
+			t.Fatalf("Expected the next instance to be created, got %v %v", ok, err)
+		}
+		if next.ProjectId != projectid || next.State != "Backlog" || !next.Deadline.Equal(deadline.AddDate(0, 0, 7)) {
+			t.Errorf("Expected the next instance in the initial state of the project, got %+v", next)
+		}
+		retrieved, err := c.project.ProjectRetrieve(ctx, projectid)
+		if err != nil || !functions.Contains(retrieved.Tasks, next.Id.Hex()) {
+			t.Errorf("Expected the next instance to be added to the project, got %v", retrieved.Tasks)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	c, user := newControllers(t)
+	overdue := c.createTask(t, models.Task{Name: "overdue", AssignedTo: []string{user.Id.Hex()}, IsPersonal: true, Deadline: time.Now().Add(-time.Hour), Recurrence: &models.Recurrence{Frequency: models.RecurDaily, Interval: 1}})
+	upcoming := c.createTask(t, models.Task{Name: "upcoming", IsPersonal: true, Deadline: time.Now().Add(time.Hour), Recurrence: &models.Recurrence{Frequency: models.RecurDaily, Interval: 1}})
+
+	// checks once before waiting, and returns once cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	recurrence.Run(ctx, c.user, c.project, c.task)
+
+	if retrieved, _ := c.task.TaskRetrieve(context.Background(), overdue.Id.Hex()); !retrieved.NextCreated {
+		t.Errorf("Expected the next instance of the overdue task to be created")
+	}
+	if retrieved, _ := c.task.TaskRetrieve(context.Background(), upcoming.Id.Hex()); retrieved.NextCreated {
+		t.Errorf("Expected the upcoming task to be left alone")
+	}
+	retrieved, err := c.user.UserRetrieve(context.Background(), user.Id.Hex(), "")
+	if err != nil || len(retrieved.Tasks) != 1 {
+		t.Errorf("Expected the user to be given the next instance, got %v", retrieved.Tasks)
+	}
+}
@@ -0,0 +1,167 @@
+// The routes of the API, shared by the server and the tests of the handlers so that they cannot drift apart.
+package routes
+
+import (
+	"github.com/OrgaNiUS/OrgaNiUS/server/auth"
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/handlers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/mailer"
+	"github.com/OrgaNiUS/OrgaNiUS/server/socket"
+	"github.com/OrgaNiUS/OrgaNiUS/server/storage"
+	"github.com/OrgaNiUS/OrgaNiUS/server/txn"
+	"github.com/gin-gonic/gin"
+)
+
+// Registers the routes of v1 and v2.
+// The chat and activity routes are only registered if hub and activity are not nil.
+func API(router *gin.Engine, userController controllers.UserController, projectController controllers.ProjectController, taskController controllers.TaskController, eventController controllers.EventController, commentController controllers.CommentController, attachmentController controllers.AttachmentController, store storage.Store, timeEntryController controllers.TimeEntryController, templateController controllers.TemplateController, runner *txn.Runner, jwtParser *auth.JWTParser, mailer *mailer.Mailer, hub *socket.ChatHub, activity *socket.ActivityHub) {
+	// API Routes Group
+	// accessed via "http://{URL}/api/v1/{path}" (with correct GET/POST/PATCH/DELETE request)
+	v1 := router.Group("/api/v1")
+	if activity != nil {
+		// the handlers publish the changes they make to projects
+		v1.Use(handlers.Activity(activity))
+	}
+
+	v1.POST("/signup", handlers.UserSignup(userController, jwtParser, mailer))
+	v1.POST("/verify", handlers.UserVerify(userController, jwtParser))
+	v1.POST("/login", handlers.UserLogin(userController, jwtParser))
+	v1.GET("/refresh_jwt", handlers.UserRefreshJWT(userController, jwtParser))
+	v1.DELETE("/logout", handlers.UserLogout(userController, jwtParser))
+
+	v1.POST("/forgot_pw", handlers.UserForgotPW(userController, mailer))
+	v1.POST("/verify_forgot_pw", handlers.UserVerifyForgotPW(userController))
+	v1.POST("/change_forgot_pw", handlers.UserChangeForgotPW(userController))
+
+	v1.GET("/own_user", handlers.UserGetSelf(userController, jwtParser))
+	v1.PATCH("/user", handlers.UserPatch(userController, jwtParser))
+	v1.DELETE("/user", handlers.UserDelete(userController, jwtParser))
+
+	v1.GET("/user_exists", handlers.UserExistsGet(userController))
+	v1.GET("/user", handlers.UserGet(userController))
+
+	v1.GET("/user_get_project_invites", handlers.UserGetProjectInvites(userController, projectController, jwtParser))
+	v1.PATCH("/user_apply", handlers.UserApplyProject(projectController, jwtParser))
+	v1.PATCH("/user_accept", handlers.UserAcceptProject(userController, projectController, jwtParser))
+	v1.PATCH("/user_reject", handlers.UserRejectProject(userController, projectController, jwtParser))
+
+	v1.POST("/project_create", handlers.ProjectCreate(userController, projectController, jwtParser))
+	v1.GET("/project_get", handlers.ProjectGet(userController, projectController, taskController, eventController, jwtParser))
+	v1.GET("/project_get_all", handlers.ProjectGetAll(userController, projectController, jwtParser))
+	v1.PATCH("/project_modify", handlers.ProjectModify(projectController, jwtParser))
+	v1.PATCH("/project_modify_states", handlers.ProjectModifyStates(projectController, taskController, jwtParser))
+	v1.PATCH("/project_modify_attachment_limits", handlers.ProjectModifyAttachmentLimits(projectController, jwtParser))
+	v1.POST("/project_template_create", handlers.ProjectTemplateCreate(projectController, taskController, templateController, jwtParser))
+	v1.GET("/project_template_get_all", handlers.ProjectTemplateGetAll(templateController, jwtParser))
+	v1.POST("/project_template_use", handlers.ProjectTemplateUse(userController, projectController, taskController, templateController, jwtParser))
+	v1.DELETE("/project_template_delete", handlers.ProjectTemplateDelete(templateController, jwtParser))
+	v1.GET("/project_time_report", handlers.ProjectTimeReport(userController, projectController, taskController, timeEntryController, jwtParser))
+	v1.PATCH("/project_invite", handlers.ProjectInviteUser(userController, jwtParser))
+	v1.GET("/project_get_applications", handlers.ProjectGetApplicants(userController, projectController, jwtParser))
+	v1.PATCH("/project_choose", handlers.ProjectChooseUsers(userController, projectController, jwtParser))
+	v1.PATCH("/project_remove_user", handlers.ProjectRemoveUsers(userController, projectController, jwtParser))
+	v1.PATCH("/project_leave", handlers.ProjectLeave(userController, projectController, taskController, runner, jwtParser))
+	v1.DELETE("/project_delete", handlers.ProjectDelete(userController, projectController, taskController, eventController, runner, jwtParser))
+	v1.PATCH("/project_archive", handlers.ProjectArchive(projectController, jwtParser))
+
+	v1.GET("/trash_get", handlers.TrashGet(projectController, taskController, eventController, jwtParser))
+	v1.PATCH("/trash_restore", handlers.TrashRestore(userController, projectController, taskController, eventController, jwtParser))
+
+	v1.POST("/task_create", handlers.TaskCreate(userController, projectController, taskController, runner, jwtParser))
+	v1.DELETE("/task_delete", handlers.TaskDelete(userController, projectController, taskController, runner, jwtParser))
+	v1.PATCH("/task_modify", handlers.TaskModify(userController, projectController, taskController, jwtParser))
+	v1.PATCH("/task_move", handlers.TaskMove(userController, projectController, taskController, jwtParser))
+	v1.PATCH("/task_series_modify", handlers.TaskSeriesModify(projectController, taskController, jwtParser))
+	v1.PATCH("/task_series_stop", handlers.TaskSeriesStop(projectController, taskController, jwtParser))
+	v1.GET("/task_get_all", handlers.TaskGetAll(userController, projectController, taskController, jwtParser))
+	v1.POST("/task_query", handlers.TaskQuery(projectController, taskController, jwtParser))
+	v1.POST("/task_bulk", handlers.TaskBulk(userController, projectController, taskController, jwtParser))
+	v1.POST("/task_template_create", handlers.TaskTemplateCreate(projectController, taskController, templateController, jwtParser))
+	v1.GET("/task_template_get_all", handlers.TaskTemplateGetAll(projectController, templateController, jwtParser))
+	v1.POST("/task_template_use", handlers.TaskTemplateUse(userController, projectController, taskController, templateController, jwtParser))
+	v1.DELETE("/task_template_delete", handlers.TaskTemplateDelete(projectController, templateController, jwtParser))
+	v1.GET("/task_get_activity", handlers.TaskGetActivity(projectController, taskController, jwtParser))
+
+	v1.POST("/task_comment_create", handlers.TaskCommentCreate(userController, projectController, taskController, commentController, jwtParser, mailer))
+	v1.GET("/task_comment_get_all", handlers.TaskCommentGetAll(projectController, taskController, commentController, jwtParser))
+	v1.DELETE("/task_comment_delete", handlers.TaskCommentDelete(commentController, jwtParser))
+
+	v1.POST("/task_timer_start", handlers.TaskTimerStart(projectController, taskController, timeEntryController, jwtParser))
+	v1.PATCH("/task_timer_stop", handlers.TaskTimerStop(timeEntryController, jwtParser))
+	v1.GET("/task_timer_get", handlers.TaskTimerGet(timeEntryController, jwtParser))
+	v1.POST("/task_time_add", handlers.TaskTimeAdd(projectController, taskController, timeEntryController, jwtParser))
+	v1.GET("/task_time_get_all", handlers.TaskTimeGetAll(projectController, taskController, timeEntryController, jwtParser))
+	v1.DELETE("/task_time_delete", handlers.TaskTimeDelete(timeEntryController, jwtParser))
+
+	v1.POST("/attachment_upload", handlers.AttachmentUpload(projectController, taskController, attachmentController, store, jwtParser))
+	v1.GET("/attachment_get_all", handlers.AttachmentGetAll(projectController, taskController, attachmentController, jwtParser))
+	v1.GET("/attachment_download", handlers.AttachmentDownload(projectController, taskController, attachmentController, store, jwtParser))
+	v1.DELETE("/attachment_delete", handlers.AttachmentDelete(projectController, taskController, attachmentController, store, jwtParser))
+
+	v1.POST("/event_create", handlers.EventCreate(userController, projectController, eventController, jwtParser))
+	v1.GET("/event_get", handlers.EventGet(eventController, jwtParser))
+	v1.GET("/event_get_all", handlers.EventGetAll(userController, projectController, eventController, jwtParser))
+	v1.PATCH("/event_modify", handlers.EventModify(projectController, eventController, jwtParser))
+	v1.DELETE("/event_delete", handlers.EventDelete(userController, projectController, eventController, jwtParser))
+	v1.POST("/event_nusmods", handlers.EventNusmods(userController, eventController, jwtParser))
+	v1.POST("/event_ics", handlers.EventIcs(userController, eventController, jwtParser))
+	v1.POST("/event_find_common", handlers.EventCommonSlots(userController, projectController, eventController, jwtParser))
+
+	// web socket handlers here
+	v1.GET("/project_search", handlers.ProjectSearch(projectController, jwtParser))
+	v1.GET("/project_invite_search", handlers.ProjectInviteSearch(userController, jwtParser))
+
+	if hub != nil {
+		v1.GET("/project_chat", handlers.ProjectChat(hub, userController, jwtParser))
+	}
+	if activity != nil {
+		v1.GET("/project_activity", handlers.ProjectActivity(activity, projectController, jwtParser))
+	}
+
+	// the document of the routes above, checked against them by TestOpenAPICoversRoutes
+	v1.GET("/openapi.json", handlers.OpenAPISpec())
+	v1.GET("/docs", handlers.OpenAPIDocs())
+
+	// accessed via "http://{URL}/api/v2/{resource}", with the same controllers as v1
+	v2 := router.Group("/api/v2", handlers.V2())
+	if activity != nil {
+		v2.Use(handlers.Activity(activity))
+	}
+
+	v2.POST("/users", handlers.V2UserCreate(userController, mailer))
+	v2.GET("/users/me", handlers.V2UserGetSelf(userController, jwtParser))
+	v2.PATCH("/users/me", handlers.V2UserModifySelf(userController, jwtParser))
+	v2.DELETE("/users/me", handlers.V2UserDeleteSelf(userController, jwtParser))
+	v2.GET("/users/:userid", handlers.V2UserGet(userController))
+	v2.POST("/sessions", handlers.V2SessionCreate(userController, jwtParser))
+	v2.DELETE("/sessions", handlers.V2SessionDelete(jwtParser))
+
+	v2.GET("/projects", handlers.V2ProjectList(userController, projectController, jwtParser))
+	v2.POST("/projects", handlers.V2ProjectCreate(userController, projectController, jwtParser))
+	v2.GET("/projects/:projectid", handlers.V2ProjectGet(projectController, jwtParser))
+	v2.PATCH("/projects/:projectid", handlers.V2ProjectModify(projectController, jwtParser))
+	v2.DELETE("/projects/:projectid", handlers.V2ProjectDelete(userController, projectController, taskController, eventController, runner, jwtParser))
+	v2.GET("/projects/:projectid/members", handlers.V2MemberList(userController, projectController, jwtParser))
+	v2.DELETE("/projects/:projectid/members/:userid", handlers.V2MemberDelete(userController, projectController, taskController, runner, jwtParser))
+
+	// the tasks and events of a project, and the personal ones of the user, are served by the same handlers
+	for _, scope := range []*gin.RouterGroup{v2.Group("/projects/:projectid"), v2} {
+		scope.GET("/tasks", handlers.V2TaskList(projectController, taskController, jwtParser))
+		scope.POST("/tasks", handlers.V2TaskCreate(userController, projectController, taskController, runner, jwtParser))
+		scope.GET("/tasks/:taskid", handlers.V2TaskGet(projectController, taskController, jwtParser))
+		scope.PATCH("/tasks/:taskid", handlers.V2TaskModify(userController, projectController, taskController, jwtParser))
+		scope.DELETE("/tasks/:taskid", handlers.V2TaskDelete(userController, projectController, taskController, jwtParser))
+		scope.GET("/tasks/:taskid/comments", handlers.V2CommentList(projectController, taskController, commentController, jwtParser))
+		scope.POST("/tasks/:taskid/comments", handlers.V2CommentCreate(userController, projectController, taskController, commentController, jwtParser, mailer))
+		scope.DELETE("/tasks/:taskid/comments/:commentid", handlers.V2CommentDelete(projectController, taskController, commentController, jwtParser))
+		scope.GET("/events", handlers.V2EventList(userController, projectController, eventController, jwtParser))
+		scope.POST("/events", handlers.V2EventCreate(userController, projectController, eventController, jwtParser))
+		scope.GET("/events/:eventid", handlers.V2EventGet(userController, projectController, eventController, jwtParser))
+		scope.PATCH("/events/:eventid", handlers.V2EventModify(userController, projectController, eventController, jwtParser))
+		scope.DELETE("/events/:eventid", handlers.V2EventDelete(userController, projectController, eventController, jwtParser))
+	}
+
+	// the document of the routes above, checked against them by TestOpenAPICoversRoutes
+	v2.GET("/openapi.json", handlers.OpenAPISpecV2())
+	v2.GET("/docs", handlers.OpenAPIDocs())
+}
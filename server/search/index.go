@@ -0,0 +1,183 @@
+package search
+
+import (
+	"sort"
+	"sync"
+)
+
+// An in-memory index of the edge n-grams of the words of each document, such as "or", "org" and "orga" for "organius".
+// Safe for concurrent use.
+type Index struct {
+	minGrams int
+	maxGrams int
+
+	mu    sync.RWMutex
+	texts map[string]string              // id -> text
+	grams map[string]map[string]struct{} // gram -> ids
+}
+
+// Words shorter than minGrams are indexed whole, and only the first maxGrams characters of longer words are indexed.
+func NewIndex(minGrams, maxGrams int) *Index {
+	return &Index{
+		minGrams: minGrams,
+		maxGrams: maxGrams,
+		texts:    map[string]string{},
+		grams:    map[string]map[string]struct{}{},
+	}
+}
+
+func (x *Index) edgeGrams(text string) []string {
+	grams := []string{}
+	for _, word := range Words(text) {
+		w := []rune(word)
+		if len(w) < x.minGrams {
+			grams = append(grams, word)
+			continue
+		}
+		for n := x.minGrams; n <= len(w) && n <= x.maxGrams; n++ {
+			grams = append(grams, string(w[:n]))
+		}
+	}
+	return grams
+}
+
+func (x *Index) set(id, text string) {
+	x.remove(id)
+	x.texts[id] = text
+	for _, gram := range x.edgeGrams(text) {
+		if x.grams[gram] == nil {
+			x.grams[gram] = map[string]struct{}{}
+		}
+		x.grams[gram][id] = struct{}{}
+	}
+}
+
+func (x *Index) remove(id string) {
+	text, ok := x.texts[id]
+	if !ok {
+		return
+	}
+	delete(x.texts, id)
+	for _, gram := range x.edgeGrams(text) {
+		delete(x.grams[gram], id)
+		if len(x.grams[gram]) == 0 {
+			delete(x.grams, gram)
+		}
+	}
+}
+
+// Adds the document, replacing its text if it is already indexed.
+func (x *Index) Set(id, text string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.set(id, text)
+}
+
+func (x *Index) Remove(id string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.remove(id)
+}
+
+// Replaces all the documents in the index.
+func (x *Index) Replace(texts map[string]string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.texts = map[string]string{}
+	x.grams = map[string]map[string]struct{}{}
+	for id, text := range texts {
+		x.set(id, text)
+	}
+}
+
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.texts)
+}
+
+// The ids of the documents with a word whose grams are within the edits of the query word.
+func (x *Index) candidates(queryWord string, options Options) map[string]struct{} {
+	q := []rune(queryWord)
+	if len(q) > x.maxGrams {
+		q = q[:x.maxGrams]
+	}
+	ids := map[string]struct{}{}
+	for gram, gramIds := range x.grams {
+		g := []rune(gram)
+		matches := false
+		switch {
+		case len(q) < x.minGrams:
+			// shorter than any gram, so match the start of the shortest grams
+			matches = len(g) <= x.minGrams && hasPrefix(g, q, len(q)) ||
+				options.MaxEdits > 0 && hasPrefix(g, q, options.PrefixLength) && Levenshtein(q, g) <= options.MaxEdits
+		case len(g) < len(q)-options.MaxEdits || len(g) > len(q)+options.MaxEdits:
+		default:
+			matches = hasPrefix(g, q, options.PrefixLength) && Levenshtein(q, g) <= options.MaxEdits
+		}
+		if matches {
+			for id := range gramIds {
+				ids[id] = struct{}{}
+			}
+		}
+	}
+	return ids
+}
+
+// Returns the ids of the documents matching the query, best first, as ranked by Score and AtStart.
+// Documents that rank the same are ordered by their text.
+func (x *Index) Search(query string, options Options) []string {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	queryWords := Words(query)
+	if len(queryWords) == 0 {
+		return []string{}
+	}
+	var ids map[string]struct{}
+	for _, word := range queryWords {
+		found := x.candidates(word, options)
+		if ids == nil {
+			ids = found
+			continue
+		}
+		for id := range ids {
+			if _, ok := found[id]; !ok {
+				delete(ids, id)
+			}
+		}
+	}
+
+	type result struct {
+		id      string
+		text    string
+		edits   int
+		atStart bool
+	}
+	results := []result{}
+	for id := range ids {
+		text := x.texts[id]
+		// the grams do not check the order of the words, or the words after the first maxGrams characters
+		if edits := options.Score(query, text); edits >= 0 {
+			results = append(results, result{id, text, edits, AtStart(query, text)})
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.edits != b.edits {
+			return a.edits < b.edits
+		}
+		if a.atStart != b.atStart {
+			return a.atStart
+		}
+		if a.text != b.text {
+			return a.text < b.text
+		}
+		return a.id < b.id
+	})
+	matched := make([]string, len(results))
+	for i, r := range results {
+		matched[i] = r.id
+	}
+	return matched
+}
@@ -0,0 +1,81 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+var autocomplete = Options{Autocomplete: true, Sequential: true, MaxEdits: 1, PrefixLength: 1}
+
+func TestIndexSearch(t *testing.T) {
+	x := NewIndex(2, 15)
+	x.Replace(map[string]string{
+		"1": "Orange Juice",
+		"2": "Apple Juice",
+		"3": "Juice Orange",
+		"4": "Crème Brûlée",
+		"5": "Organising Committee",
+		"6": "Orbit",
+	})
+
+	tests := map[string][]string{
+		"or":           {"1", "6", "5", "3"}, // those starting with the query first, then by text
+		"orange juice": {"1"},                // words in order
+		"juice":        {"3", "2", "1"},
+		"ornge":        {"3", "1"}, // one edit
+		"organis":      {"5"},
+		"creme":        {"4"}, // diacritics are folded
+		"brulee":       {"4"},
+		"xrange":       {}, // the first character has to match
+		"":             {},
+	}
+	for query, expected := range tests {
+		if got := x.Search(query, autocomplete); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected %q to find %v, got %v", query, expected, got)
+		}
+	}
+
+	// exact matches rank before fuzzy ones
+	x.Set("7", "Oragne")
+	if got := x.Search("orag", autocomplete); !reflect.DeepEqual(got, []string{"7", "3", "1", "5"}) {
+		t.Errorf("Expected the exact match first, got %v", got)
+	}
+}
+
+func TestIndexSetAndRemove(t *testing.T) {
+	x := NewIndex(2, 15)
+	x.Set("1", "Orange")
+	x.Set("1", "Banana")
+	if got := x.Search("orange", autocomplete); len(got) != 0 {
+		t.Errorf("Expected the old text to be removed, got %v", got)
+	}
+	if got := x.Search("ban", autocomplete); !reflect.DeepEqual(got, []string{"1"}) {
+		t.Errorf("Expected the new text to be found, got %v", got)
+	}
+	x.Remove("1")
+	if x.Len() != 0 || len(x.grams) != 0 {
+		t.Errorf("Expected the index to be empty, got %v documents and %v grams", x.Len(), len(x.grams))
+	}
+}
+
+func TestScore(t *testing.T) {
+	text := Options{MaxEdits: 1}
+	tests := []struct {
+		options Options
+		query   string
+		value   string
+		edits   int
+	}{
+		{autocomplete, "org", "OrgaNiUS", 0},
+		{autocomplete, "ogr", "OrgaNiUS", 1},
+		{autocomplete, "juice orange", "Orange Juice", -1},
+		{Options{Autocomplete: true, MaxEdits: 1}, "juice orange", "Orange Juice", 0},
+		{text, "org", "OrgaNiUS", -1},
+		{text, "organiu", "OrgaNiUS", 1},
+	}
+	for _, tt := range tests {
+		if edits := tt.options.Score(tt.query, tt.value); edits != tt.edits {
+			t.Errorf("Expected %q to match %q with %v edits, got %v", tt.query, tt.value, tt.edits, edits)
+		}
+	}
+}
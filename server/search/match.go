@@ -0,0 +1,124 @@
+// Fuzzy matching of queries against text, approximating the autocomplete and text operators of Atlas Search,
+// and an in-memory index of edge n-grams for searching without Atlas.
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// How a query matches a value.
+type Options struct {
+	Autocomplete bool // match the start of words, instead of whole words
+	Sequential   bool // match the words of the query in order
+	MaxEdits     int  // edits allowed for each word
+	PrefixLength int  // characters at the start of each word that have to match exactly
+}
+
+// The lowercase words of s, with diacritics removed.
+func Words(s string) []string {
+	folded := strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		return r
+	}, norm.NFD.String(s))
+	return strings.FieldsFunc(strings.ToLower(folded), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// The edit distance between a and b.
+func Levenshtein(a, b []rune) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
+
+func min(values ...int) int {
+	smallest := values[0]
+	for _, v := range values[1:] {
+		if v < smallest {
+			smallest = v
+		}
+	}
+	return smallest
+}
+
+func hasPrefix(a, b []rune, n int) bool {
+	return len(a) >= n && len(b) >= n && string(a[:n]) == string(b[:n])
+}
+
+// The number of edits for the word to match the query word, or -1 if it does not.
+// Autocomplete matches the start of the word.
+func (o Options) Edits(queryWord, word string) int {
+	q, w := []rune(queryWord), []rune(word)
+	if !hasPrefix(q, w, o.PrefixLength) {
+		return -1
+	}
+	best := -1
+	if !o.Autocomplete {
+		best = Levenshtein(q, w)
+	} else {
+		// the closest prefix of the word
+		for n := len(q) - o.MaxEdits; n <= len(q)+o.MaxEdits; n++ {
+			if n < 0 || n > len(w) {
+				continue
+			}
+			if d := Levenshtein(q, w[:n]); best < 0 || d < best {
+				best = d
+			}
+		}
+	}
+	if best > o.MaxEdits {
+		return -1
+	}
+	return best
+}
+
+// The total edits for the value to match the query, or -1 if it does not.
+func (o Options) Score(query, value string) int {
+	queryWords, valueWords := Words(query), Words(value)
+	if len(queryWords) == 0 {
+		return -1
+	}
+	total := 0
+	start := 0
+	for _, queryWord := range queryWords {
+		best, at := -1, -1
+		for i := start; i < len(valueWords); i++ {
+			if d := o.Edits(queryWord, valueWords[i]); d >= 0 && (best < 0 || d < best) {
+				best, at = d, i
+			}
+		}
+		if best < 0 {
+			return -1
+		}
+		total += best
+		if o.Sequential {
+			start = at + 1
+		}
+	}
+	return total
+}
+
+// Whether the value starts with the query, which ranks higher among values with the same score.
+func AtStart(query, value string) bool {
+	return strings.HasPrefix(strings.Join(Words(value), " "), strings.Join(Words(query), " "))
+}
@@ -0,0 +1,454 @@
+package socket
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/metrics"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/*
+	The activity stream sends the changes made to a project to its members as they happen, so that they need not refresh.
+
+	It follows the register/unregister model of ChatHub, with one room per project. Every activity has a sequence number,
+	and each room keeps its recent activities, so that clients reconnecting with the last sequence number they received
+	are sent what they missed. If it is no longer kept, or the client has none, a reset is sent instead, after which the
+	client should load the project again.
+*/
+
+const (
+	// recent activities kept by each room for clients to resume from
+	historySize = 256
+
+	// rooms without clients are dropped once their last activity is older than this, along with their history
+	historyAge = 10 * time.Minute
+)
+
+// Types of activities.
+const (
+	ActivityReset           = "reset"            // no payload, the activities the client missed are not kept
+	ActivityTaskCreated     = "task.created"     // TaskPayload
+	ActivityTaskModified    = "task.modified"    // TaskPayload
+	ActivityTaskDeleted     = "task.deleted"     // DeletedPayload
+	ActivityEventCreated    = "event.created"    // EventPayload
+	ActivityEventModified   = "event.modified"   // EventPayload
+	ActivityEventDeleted    = "event.deleted"    // DeletedPayload
+	ActivityProjectModified = "project.modified" // ProjectPayload
+	ActivityProjectDeleted  = "project.deleted"  // no payload, the clients are closed after it
+	ActivityMemberJoined    = "member.joined"    // MemberPayload
+	ActivityMemberLeft      = "member.left"      // MemberPayload, the clients of the member are closed after it
+)
+
+type Activity struct {
+	ProjectId string `json:"projectid"`
+	// increasing across all projects, but not consecutive within one
+	Seq  uint64 `json:"seq"`
+	Type string `json:"type"`
+	// userid of the user who made the change
+	Actor   string      `json:"actor,omitempty"`
+	Time    time.Time   `json:"time"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+// The task after it was created or modified.
+type TaskPayload struct {
+	Task models.Task `json:"task"`
+}
+
+// The event after it was created or modified.
+type EventPayload struct {
+	Event models.Event `json:"event"`
+}
+
+// The ids of the tasks or events moved to the trash.
+type DeletedPayload struct {
+	Ids []string `json:"ids"`
+}
+
+// The project after it was modified.
+type ProjectPayload struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	IsPublic    bool                   `json:"isPublic"`
+	IsArchived  bool                   `json:"isArchived"`
+	States      []models.WorkflowState `json:"states"`
+}
+
+type MemberPayload struct {
+	UserId string `json:"userid"`
+	Name   string `json:"name"`
+}
+
+type activityRoom struct {
+	clients map[*ActivityClient]bool
+
+	// the recent activities, oldest first
+	history []Activity
+
+	// every activity after this sequence number is in history
+	since uint64
+
+	// when the room was created or last had an activity
+	updated time.Time
+}
+
+// The sequence number of the last activity of the room.
+func (r *activityRoom) latest() uint64 {
+	if len(r.history) == 0 {
+		return r.since
+	}
+	return r.history[len(r.history)-1].Seq
+}
+
+type ActivityHub struct {
+	rooms map[string]*activityRoom
+
+	// sequence number of the last activity
+	seq uint64
+
+	// activities to be numbered and sent
+	publish chan Activity
+
+	// register requests from client
+	register chan *ActivityClient
+
+	// unregister requests from client
+	unregister chan *ActivityClient
+
+	// closed to stop the hub, see Shutdown
+	quit     chan struct{}
+	quitOnce sync.Once
+
+	// closed once the hub has stopped
+	done chan struct{}
+
+	// writePumps of the registered clients, which send the close frames on shutdown
+	pumps sync.WaitGroup
+}
+
+func NewActivityHub() *ActivityHub {
+	return &ActivityHub{
+		rooms: make(map[string]*activityRoom),
+		// starting from the time, sequence numbers of a previous run of the server are older than every room,
+		// while staying within the integers that JavaScript numbers hold exactly
+		seq:        uint64(time.Now().UnixMicro()),
+		publish:    make(chan Activity, 64),
+		register:   make(chan *ActivityClient),
+		unregister: make(chan *ActivityClient),
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// Sends the activity to the clients of its project, numbering it.
+// Does nothing once the hub has stopped.
+func (h *ActivityHub) Publish(projectid, actor, activityType string, payload interface{}) {
+	activity := Activity{
+		ProjectId: projectid,
+		Type:      activityType,
+		Actor:     actor,
+		Time:      time.Now(),
+		Payload:   payload,
+	}
+	select {
+	case h.publish <- activity:
+	case <-h.done:
+	}
+}
+
+// Returns the room of the project, creating it if it does not exist.
+func (h *ActivityHub) room(projectid string) *activityRoom {
+	room, isRoomOk := h.rooms[projectid]
+	if !isRoomOk {
+		room = &activityRoom{
+			clients: make(map[*ActivityClient]bool),
+			since:   h.seq,
+			updated: time.Now(),
+		}
+		h.rooms[projectid] = room
+	}
+	return room
+}
+
+// Closes the connection of the client, after the activities queued for it are sent.
+func (h *ActivityHub) closeClient(room *activityRoom, client *ActivityClient, code int, reason string) {
+	delete(room.clients, client)
+	client.closeCode = code
+	client.closeReason = reason
+	close(client.send)
+	metrics.ActivityClients.Dec()
+}
+
+func (h *ActivityHub) broadcastActivity(activity Activity) {
+	room := h.room(activity.ProjectId)
+	h.seq++
+	activity.Seq = h.seq
+	room.history = append(room.history, activity)
+	if len(room.history) > historySize {
+		room.since = room.history[0].Seq
+		room.history = room.history[1:]
+	}
+	room.updated = activity.Time
+
+	for client := range room.clients {
+		select {
+		case client.send <- activity:
+		default:
+			// the client can resume once it reconnects
+			client.span.AddEvent("dropped for falling behind")
+			metrics.ActivityDrops.Inc()
+			h.closeClient(room, client, websocket.CloseTryAgainLater, "Fell behind, reconnect with the last seq.")
+		}
+	}
+
+	switch activity.Type {
+	case ActivityMemberLeft:
+		payload, _ := activity.Payload.(MemberPayload)
+		for client := range room.clients {
+			if client.userid == payload.UserId {
+				h.closeClient(room, client, websocket.ClosePolicyViolation, "No longer a member of the project.")
+			}
+		}
+	case ActivityProjectDeleted:
+		for client := range room.clients {
+			h.closeClient(room, client, websocket.CloseNormalClosure, "Project deleted.")
+		}
+		delete(h.rooms, activity.ProjectId)
+	}
+}
+
+// Queues the activities the client missed since the sequence number, or a reset if they are not kept.
+func (h *ActivityHub) resume(room *activityRoom, client *ActivityClient) {
+	if client.since != nil && *client.since >= room.since && *client.since <= h.seq {
+		for _, activity := range room.history {
+			if activity.Seq > *client.since {
+				client.send <- activity
+			}
+		}
+		client.span.AddEvent("resumed")
+		return
+	}
+	client.send <- Activity{
+		ProjectId: client.projectid,
+		Seq:       room.latest(),
+		Type:      ActivityReset,
+		Time:      time.Now(),
+	}
+}
+
+func (h *ActivityHub) Run() {
+	prune := time.NewTicker(time.Minute)
+	defer prune.Stop()
+	// infinite loop to handle register/unregister & publishing activities
+	for {
+		select {
+		case client := <-h.register:
+			room := h.room(client.projectid)
+			room.clients[client] = true
+			h.pumps.Add(1)
+			metrics.ActivityClients.Inc()
+			// send is empty and can hold the whole history
+			h.resume(room, client)
+		case client := <-h.unregister:
+			room, isRoomOk := h.rooms[client.projectid]
+			if !isRoomOk {
+				continue
+			}
+			if _, ok := room.clients[client]; ok {
+				delete(room.clients, client)
+				close(client.send)
+				metrics.ActivityClients.Dec()
+			}
+		case activity := <-h.publish:
+			h.broadcastActivity(activity)
+		case now := <-prune.C:
+			for projectid, room := range h.rooms {
+				if len(room.clients) == 0 && now.Sub(room.updated) > historyAge {
+					delete(h.rooms, projectid)
+				}
+			}
+		case <-h.quit:
+			// tell every client that the server is going away
+			for projectid, room := range h.rooms {
+				for client := range room.clients {
+					h.closeClient(room, client, websocket.CloseGoingAway, "Server shutting down.")
+				}
+				delete(h.rooms, projectid)
+			}
+			close(h.done)
+			return
+		}
+	}
+}
+
+// Stops the hub, sending a close frame to every client.
+// Waits until the close frames are sent or the context is done, whichever is first.
+// Clients connecting afterwards are closed immediately.
+func (h *ActivityHub) Shutdown(ctx context.Context) error {
+	h.quitOnce.Do(func() {
+		close(h.quit)
+	})
+	return awaitPumps(ctx, h.done, &h.pumps)
+}
+
+type ActivityClient struct {
+	projectid string
+
+	userid string
+
+	// the sequence number of the last activity the client received, nil if it has none
+	since *uint64
+
+	hub *ActivityHub
+
+	// The websocket connection.
+	conn *websocket.Conn
+
+	// Buffered channel of outbound activities.
+	send chan Activity
+
+	// the close frame sent once the hub closes send, set before it is closed
+	closeCode   int
+	closeReason string
+
+	// traces the connection, from the upgrade until the connection is closed
+	span trace.Span
+}
+
+// reads from the websocket connection until it is closed, as clients only receive
+func (c *ActivityClient) readPump() {
+	defer func() {
+		// unregister from hub, unless it has stopped
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.done:
+		}
+		c.conn.Close()
+		c.span.End()
+	}()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	// ensures that the client is still actively conneced to the server
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				tracing.Fail(c.span, err)
+				slog.Warn("activity connection closed unexpectedly", "project", c.projectid, "error", err)
+			}
+			return
+		}
+	}
+}
+
+// sends activities to the client through websocket connection
+func (c *ActivityClient) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+
+	defer func() {
+		ticker.Stop()
+		c.hub.pumps.Done()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case activity, isChannelOk := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !isChannelOk {
+				// hub closed the channel
+				code, reason := c.closeCode, c.closeReason
+				if code == 0 {
+					code, reason = websocket.CloseNormalClosure, "Connection closed."
+				}
+				c.span.AddEvent("closed by server", trace.WithAttributes(attribute.Int("code", code)))
+				c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+				return
+			}
+
+			n := len(c.send)
+			activities := make([]Activity, 1, n+1)
+			activities[0] = activity
+			for i := 0; i < n; i++ {
+				// gather the activities queued since, stopping at the end of the channel if the hub closed it
+				activity, isChannelOk := <-c.send
+				if !isChannelOk {
+					break
+				}
+				activities = append(activities, activity)
+			}
+
+			type r struct {
+				Activities []Activity `json:"activities"`
+			}
+
+			if err := c.conn.WriteJSON(r{Activities: activities}); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			// send ping message
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// entrypoint for ProjectActivity handler
+// since is the sequence number of the last activity the client received, nil if it has none.
+func ConnectActivityClient(ctx *gin.Context, hub *ActivityHub, projectid, userid string, since *uint64) {
+	attributes := []attribute.KeyValue{attribute.String("project", projectid)}
+	if since != nil {
+		attributes = append(attributes, attribute.String("since", strconv.FormatUint(*since, 10)))
+	}
+	// outlives the request, which ends once the pumps are started
+	_, span := tracing.Start(ctx, "activity.connection", attributes...)
+	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		tracing.Fail(span, err)
+		span.End()
+		slog.WarnContext(ctx, "error when upgrading websocket connection for activity", "error", err)
+		return
+	}
+
+	client := &ActivityClient{
+		projectid: projectid,
+		userid:    userid,
+		since:     since,
+		hub:       hub,
+		conn:      conn,
+		// room for the whole history and the activities published while it is sent
+		send: make(chan Activity, 2*historySize),
+		span: span,
+	}
+
+	select {
+	case client.hub.register <- client:
+	case <-client.hub.done:
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "Server shutting down."), time.Now().Add(writeWait))
+		conn.Close()
+		span.AddEvent("rejected as the server is shutting down")
+		span.End()
+		return
+	}
+	span.AddEvent("registered")
+
+	go client.writePump()
+	go client.readPump()
+}
@@ -0,0 +1,117 @@
+package socket
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+type activityFrame struct {
+	Activities []Activity `json:"activities"`
+}
+
+func TestActivityHub(t *testing.T) {
+	hub := NewActivityHub()
+	go hub.Run()
+	defer hub.Shutdown(context.Background())
+	router := gin.New()
+	router.GET("/activity", func(ctx *gin.Context) {
+		var since *uint64
+		if query := ctx.Query("since"); query != "" {
+			seq, _ := strconv.ParseUint(query, 10, 64)
+			since = &seq
+		}
+		ConnectActivityClient(ctx, hub, "project", ctx.Query("userid"), since)
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/activity?userid="
+
+	// reads the next activity, which may be batched with others
+	connect := func(userid, since string) (*websocket.Conn, func() Activity) {
+		t.Helper()
+		query := userid
+		if since != "" {
+			query += "&since=" + since
+		}
+		conn, _, err := websocket.DefaultDialer.Dial(url+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		queued := []Activity{}
+		return conn, func() Activity {
+			t.Helper()
+			for len(queued) == 0 {
+				var frame activityFrame
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				if err := conn.ReadJSON(&frame); err != nil {
+					t.Fatalf("Expected an activity, got %v", err)
+				}
+				queued = frame.Activities
+			}
+			activity := queued[0]
+			queued = queued[1:]
+			return activity
+		}
+	}
+
+	alice, next := connect("alice", "")
+	defer alice.Close()
+	reset := next()
+	if reset.Type != ActivityReset {
+		t.Fatalf("Expected a new client to be sent a reset, got %+v", reset)
+	}
+
+	hub.Publish("project", "bob", ActivityTaskDeleted, DeletedPayload{Ids: []string{"task"}})
+	hub.Publish("other", "bob", ActivityTaskDeleted, DeletedPayload{Ids: []string{"other task"}})
+	hub.Publish("project", "bob", ActivityMemberJoined, MemberPayload{UserId: "carol"})
+	first, second := next(), next()
+	if first.Type != ActivityTaskDeleted || first.Actor != "bob" || first.Seq <= reset.Seq {
+		t.Errorf("Expected the deleted task after the reset, got %+v", first)
+	}
+	if second.Type != ActivityMemberJoined || second.Seq <= first.Seq {
+		t.Errorf("Expected only the activities of the project in order, got %+v", second)
+	}
+
+	// resuming sends what was missed, and nothing else
+	resumed, nextResumed := connect("alice", strconv.FormatUint(first.Seq, 10))
+	defer resumed.Close()
+	if activity := nextResumed(); activity.Seq != second.Seq {
+		t.Errorf("Expected to resume from the activity after %v, got %+v", first.Seq, activity)
+	}
+	hub.Publish("project", "bob", ActivityProjectModified, ProjectPayload{Name: "renamed"})
+	if activity := nextResumed(); activity.Type != ActivityProjectModified {
+		t.Errorf("Expected the resumed client to be sent new activities, got %+v", activity)
+	}
+
+	// sequence numbers that are no longer kept, or of another run of the server, cannot be resumed from
+	for i := 0; i < historySize; i++ {
+		hub.Publish("project", "bob", ActivityTaskDeleted, DeletedPayload{})
+	}
+	for _, since := range []string{strconv.FormatUint(first.Seq, 10), strconv.FormatUint(1<<53, 10)} {
+		stale, nextStale := connect("alice", since)
+		if activity := nextStale(); activity.Type != ActivityReset {
+			t.Errorf("Expected a reset for %v, got %+v", since, activity)
+		}
+		stale.Close()
+	}
+
+	// removed members are sent their removal and then closed
+	carol, nextCarol := connect("carol", "")
+	defer carol.Close()
+	nextCarol()
+	hub.Publish("project", "bob", ActivityMemberLeft, MemberPayload{UserId: "carol"})
+	if activity := nextCarol(); activity.Type != ActivityMemberLeft {
+		t.Errorf("Expected carol to be told of the removal, got %+v", activity)
+	}
+	carol.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := carol.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Errorf("Expected carol to be closed, got %v", err)
+	}
+}
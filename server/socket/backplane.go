@@ -0,0 +1,135 @@
+package socket
+
+import (
+	"errors"
+	"sync"
+)
+
+/*
+	The backplane carries chat messages between the instances of the server, so that clients in the same room are
+	reached wherever they are connected. Every hub delivers its messages to its own clients right away and publishes
+	them to the backplane, skipping its own when they come back, so that its clients are still reached while the
+	backplane is unreachable.
+
+	MemoryBus connects the hubs of one process, which is all a single instance needs. RedisBackplane connects
+	instances through a Redis channel.
+*/
+
+// Carries messages between the hubs of every instance of the server.
+type Backplane interface {
+	// Sends the message to every hub, including the one publishing it. Does not wait for it to be sent.
+	Publish(message []byte) error
+
+	// The messages published by every hub, in the order they were published.
+	// Closed once the backplane is closed.
+	Messages() <-chan []byte
+
+	// Signalled once the backplane receives messages again after missing some, such as while it was reconnecting.
+	// nil if it never misses any.
+	Resubscribed() <-chan struct{}
+
+	// Stops receiving messages, after sending those already published.
+	Close() error
+}
+
+var errBackplaneClosed = errors.New("backplane is closed")
+
+// Connects backplanes within the process, for a single instance and for tests.
+type MemoryBus struct {
+	mu         sync.Mutex
+	backplanes map[*memoryBackplane]bool
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{backplanes: make(map[*memoryBackplane]bool)}
+}
+
+// Returns a backplane receiving the messages published to every backplane of the bus.
+func (b *MemoryBus) Connect() Backplane {
+	p := &memoryBackplane{
+		bus:      b,
+		messages: make(chan []byte),
+		wake:     make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+	}
+	b.mu.Lock()
+	b.backplanes[p] = true
+	b.mu.Unlock()
+	go p.pump()
+	return p
+}
+
+type memoryBackplane struct {
+	bus *MemoryBus
+
+	messages chan []byte
+
+	// messages waiting to be received, so that publishing never waits for a slow hub, even one publishing to itself
+	mu    sync.Mutex
+	queue [][]byte
+	wake  chan struct{}
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (p *memoryBackplane) Publish(message []byte) error {
+	select {
+	case <-p.closed:
+		return errBackplaneClosed
+	default:
+	}
+	p.bus.mu.Lock()
+	defer p.bus.mu.Unlock()
+	for backplane := range p.bus.backplanes {
+		backplane.mu.Lock()
+		backplane.queue = append(backplane.queue, message)
+		backplane.mu.Unlock()
+		select {
+		case backplane.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (p *memoryBackplane) Messages() <-chan []byte {
+	return p.messages
+}
+
+func (p *memoryBackplane) Resubscribed() <-chan struct{} {
+	return nil
+}
+
+// moves the queued messages to the channel, in order
+func (p *memoryBackplane) pump() {
+	defer close(p.messages)
+	for {
+		p.mu.Lock()
+		queue := p.queue
+		p.queue = nil
+		p.mu.Unlock()
+		for _, message := range queue {
+			select {
+			case p.messages <- message:
+			case <-p.closed:
+				return
+			}
+		}
+		select {
+		case <-p.wake:
+		case <-p.closed:
+			return
+		}
+	}
+}
+
+func (p *memoryBackplane) Close() error {
+	p.closeOnce.Do(func() {
+		p.bus.mu.Lock()
+		delete(p.bus.backplanes, p)
+		p.bus.mu.Unlock()
+		close(p.closed)
+	})
+	return nil
+}
@@ -0,0 +1,147 @@
+package socket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Starts a hub on the backplane, returning a function connecting a user to its room.
+func startChatNode(t *testing.T, backplane Backplane, heartbeat time.Duration) (*ChatHub, func(name string) (*websocket.Conn, func() ChatMessage)) {
+	t.Helper()
+	hub := NewChatHubWithBackplane(backplane)
+	hub.heartbeat = heartbeat
+	go hub.Run()
+	t.Cleanup(func() { hub.Shutdown(context.Background()) })
+	router := gin.New()
+	router.GET("/chat", func(ctx *gin.Context) {
+		ConnectClient(ctx, hub, "room", ctx.Query("name"))
+	})
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	return hub, func(name string) (*websocket.Conn, func() ChatMessage) {
+		t.Helper()
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/chat?name="+name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		// reads the next message, which may be batched with others
+		queued := []ChatMessage{}
+		return conn, func() ChatMessage {
+			t.Helper()
+			for len(queued) == 0 {
+				var frame struct {
+					Messages []ChatMessage `json:"messages"`
+				}
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				if err := conn.ReadJSON(&frame); err != nil {
+					t.Fatalf("Expected a message for %v, got %v", name, err)
+				}
+				queued = frame.Messages
+			}
+			message := queued[0]
+			queued = queued[1:]
+			return message
+		}
+	}
+}
+
+func TestChatHubBackplane(t *testing.T) {
+	bus := NewMemoryBus()
+	_, connectA := startChatNode(t, bus.Connect(), time.Hour)
+	_, connectB := startChatNode(t, bus.Connect(), time.Hour)
+
+	_, nextAlice := connectA("alice")
+	bob, nextBob := connectB("bob")
+	if message := nextAlice(); message.MessageType != "join" || message.User != "bob" || !message.Joined {
+		t.Fatalf("Expected alice to be told that bob joined on the other instance, got %+v", message)
+	}
+	if message := nextBob(); message.MessageType != "presence" || len(message.Users) != 1 || message.Users[0] != "alice" {
+		t.Errorf("Expected bob to be told that alice is in the room, got %+v", message)
+	}
+
+	// messages reach both instances, once each
+	_, nextCarol := connectA("carol")
+	if message := nextCarol(); message.MessageType != "presence" || len(message.Users) != 2 {
+		t.Errorf("Expected carol to be told of alice and bob, got %+v", message)
+	}
+	nextAlice()
+	nextBob()
+	bob.WriteMessage(websocket.TextMessage, []byte("hello"))
+	for _, next := range []func() ChatMessage{nextAlice, nextBob, nextCarol} {
+		if message := next(); message.MessageType != "text" || message.Message != "hello" || message.User != "bob" {
+			t.Errorf("Expected bob's message, got %+v", message)
+		}
+	}
+
+	bob.Close()
+	for _, next := range []func() ChatMessage{nextAlice, nextCarol} {
+		if message := next(); message.MessageType != "join" || message.User != "bob" || message.Joined {
+			t.Errorf("Expected bob to leave, got %+v", message)
+		}
+	}
+}
+
+func TestChatHubBackplaneClosed(t *testing.T) {
+	backplane := NewMemoryBus().Connect()
+	_, connect := startChatNode(t, backplane, time.Hour)
+	alice, nextAlice := connect("alice")
+	_, nextBob := connect("bob")
+	nextAlice()
+	nextBob()
+
+	// the clients of the instance are still reached without the backplane
+	backplane.Close()
+	alice.WriteMessage(websocket.TextMessage, []byte("hello"))
+	for _, next := range []func() ChatMessage{nextAlice, nextBob} {
+		if message := next(); message.MessageType != "text" || message.Message != "hello" || message.User != "alice" {
+			t.Errorf("Expected alice's message, got %+v", message)
+		}
+	}
+}
+
+func TestChatHubPresence(t *testing.T) {
+	bus := NewMemoryBus()
+	heartbeat := 50 * time.Millisecond
+	_, connect := startChatNode(t, bus.Connect(), heartbeat)
+	_, nextAlice := connect("alice")
+
+	// another instance whose users were missed, such as while the backplane was unreachable
+	other := bus.Connect()
+	defer other.Close()
+	presence, _ := json.Marshal(chatEnvelope{Node: "other", Kind: envelopePresence, Rooms: map[string][]string{"room": {"dave"}, "elsewhere": {"erin"}}})
+	other.Publish(presence)
+	if message := nextAlice(); message.MessageType != "join" || message.User != "dave" || !message.Joined {
+		t.Fatalf("Expected the join of dave to be inferred from the presence, got %+v", message)
+	}
+
+	// which then stops without saying so
+	start := time.Now()
+	if message := nextAlice(); message.MessageType != "join" || message.User != "dave" || message.Joined {
+		t.Errorf("Expected dave to leave once the instance expired, got %+v", message)
+	}
+	if elapsed := time.Since(start); elapsed < (presenceMisses-1)*heartbeat {
+		t.Errorf("Expected the instance to expire after %v, took %v", presenceMisses*heartbeat, elapsed)
+	}
+
+	// instances stopping tell the others that their users left
+	hub, connectB := startChatNode(t, bus.Connect(), time.Hour)
+	connectB("bob")
+	nextAlice()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := hub.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if message := nextAlice(); message.MessageType != "join" || message.User != "bob" || message.Joined {
+		t.Errorf("Expected bob to leave as his instance stopped, got %+v", message)
+	}
+}
@@ -1,11 +1,21 @@
 package socket
 
 import (
-	"log"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/OrgaNiUS/OrgaNiUS/server/metrics"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 /*
@@ -18,6 +28,7 @@ import (
 	2. Users
 	3. Join/Leave messages
 	4. Integrated into our application (of course!)
+	5. Rooms shared between instances through a backplane, see backplane.go
 */
 
 const (
@@ -32,6 +43,12 @@ const (
 
 	// maximum message size (in bytes)
 	maxMessageSize = 512
+
+	// how often a hub tells the other instances who is in its rooms
+	presenceInterval = 10 * time.Second
+
+	// instances not heard from for this many intervals are taken to have stopped, and their users to have left
+	presenceMisses = 3
 )
 
 type ChatMessage struct {
@@ -41,6 +58,37 @@ type ChatMessage struct {
 	Message     string    `json:"message"`
 	Joined      bool      `json:"joined"`
 	Time        time.Time `json:"time"`
+	// for presence messages, the other users in the room
+	Users []string `json:"users,omitempty"`
+}
+
+// what hubs send each other through the backplane
+type chatEnvelope struct {
+	// the instance sending it
+	Node string `json:"node"`
+	Kind string `json:"kind"`
+
+	// for messages
+	Message *ChatMessage `json:"message,omitempty"`
+
+	// for presence, the users in each room of the instance, once for each of their connections
+	Rooms map[string][]string `json:"rooms,omitempty"`
+}
+
+const (
+	// a message for the clients of every instance
+	envelopeMessage = "message"
+	// the users of an instance, sent every presenceInterval and before it stops
+	envelopePresence = "presence"
+	// sent by an instance starting or resubscribing, which the others answer with their presence
+	envelopeHello = "hello"
+)
+
+// the users of another instance, as last heard from it
+type chatNode struct {
+	// number of connections of each user in each room
+	rooms map[string]map[string]int
+	seen  time.Time
 }
 
 var (
@@ -56,6 +104,21 @@ type ChatHub struct {
 	// set of registered clients
 	rooms map[string]Clients
 
+	// carries the messages between the hubs of every instance
+	backplane Backplane
+
+	// identifies this hub on the backplane
+	node string
+
+	// the users of the other instances
+	nodes map[string]*chatNode
+
+	// how often the presence is sent, see presenceInterval
+	heartbeat time.Duration
+
+	// the id of the last registered client
+	clients uint64
+
 	// messages to be broadcasted
 	broadcast chan ChatMessage
 
@@ -64,19 +127,44 @@ type ChatHub struct {
 
 	// unregister requests from client
 	unregister chan *ChatClient
+
+	// closed to stop the hub, see Shutdown
+	quit     chan struct{}
+	quitOnce sync.Once
+
+	// closed once the hub has stopped
+	done chan struct{}
+
+	// writePumps of the registered clients, which send the close frames on shutdown
+	pumps sync.WaitGroup
 }
 
+// Returns a hub keeping its rooms within this instance.
 func NewChatHub() *ChatHub {
+	return NewChatHubWithBackplane(NewMemoryBus().Connect())
+}
+
+// Returns a hub sharing its rooms with the hubs of other instances through the backplane, which it closes on Shutdown.
+func NewChatHubWithBackplane(backplane Backplane) *ChatHub {
+	node := make([]byte, 8)
+	rand.Read(node)
 	return &ChatHub{
-		rooms: make(map[string]Clients),
+		rooms:     make(map[string]Clients),
+		backplane: backplane,
+		node:      hex.EncodeToString(node),
+		nodes:     make(map[string]*chatNode),
+		heartbeat: presenceInterval,
 		// needs a buffer, else cannot pass anything to it in Run()
 		broadcast:  make(chan ChatMessage, 1),
 		register:   make(chan *ChatClient),
 		unregister: make(chan *ChatClient),
+		quit:       make(chan struct{}),
+		done:       make(chan struct{}),
 	}
 }
 
-func (h *ChatHub) broadcastMessage(message ChatMessage) {
+// sends the message to the clients of the room on this instance, except the client with the id
+func (h *ChatHub) broadcastMessage(message ChatMessage, except uint64) {
 	room, isRoomOk := h.rooms[message.RoomId]
 	if !isRoomOk {
 		// should not happen, because room should be created on register
@@ -86,6 +174,9 @@ func (h *ChatHub) broadcastMessage(message ChatMessage) {
 
 	for client := range room {
 		// loop through all the clients in the room and broadcast to them
+		if client.id == except {
+			continue
+		}
 		select {
 		// broadcast the message to client's receiving channel
 		case client.send <- message:
@@ -93,16 +184,177 @@ func (h *ChatHub) broadcastMessage(message ChatMessage) {
 		default:
 			delete(room, client)
 			close(client.send)
+			client.span.AddEvent("dropped for falling behind")
+			metrics.ChatDrops.Inc()
+			metrics.ChatClients.Dec()
 
 			if len(room) == 0 {
 				// if room is now empty, remove it
 				delete(h.rooms, client.roomid)
+				metrics.ChatRooms.Dec()
+			}
+			h.announce(client, false)
+		}
+	}
+}
+
+// sends the envelope to the other hubs, this one skips it when it comes back
+func (h *ChatHub) publish(envelope chatEnvelope) {
+	envelope.Node = h.node
+	data, err := json.Marshal(envelope)
+	if err == nil {
+		err = h.backplane.Publish(data)
+	}
+	if err != nil {
+		slog.Warn("error publishing to the chat backplane", "kind", envelope.Kind, "error", err)
+	}
+}
+
+// tells the room on every instance that the client joined or left, except the client joining
+func (h *ChatHub) announce(client *ChatClient, joined bool) {
+	message := ChatMessage{
+		RoomId:      client.roomid,
+		MessageType: "join",
+		User:        client.user,
+		Joined:      joined,
+		Time:        time.Now(),
+	}
+	except := uint64(0)
+	if joined {
+		except = client.id
+	}
+	h.broadcastMessage(message, except)
+	h.publish(chatEnvelope{Kind: envelopeMessage, Message: &message})
+}
+
+// tells the other instances who is in the rooms of this one
+func (h *ChatHub) publishPresence() {
+	rooms := make(map[string][]string, len(h.rooms))
+	for roomid, room := range h.rooms {
+		for client := range room {
+			rooms[roomid] = append(rooms[roomid], client.user)
+		}
+	}
+	h.publish(chatEnvelope{Kind: envelopePresence, Rooms: rooms})
+}
+
+// handles what a hub sent through the backplane
+func (h *ChatHub) receive(data []byte) {
+	var envelope chatEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		slog.Warn("ignoring malformed message from the chat backplane", "error", err)
+		return
+	}
+	if envelope.Node == h.node {
+		// already delivered when it was sent
+		return
+	}
+	h.observe(envelope)
+	if envelope.Kind == envelopeMessage && envelope.Message != nil {
+		h.broadcastMessage(*envelope.Message, 0)
+	}
+}
+
+// keeps track of the users of another instance
+func (h *ChatHub) observe(envelope chatEnvelope) {
+	node, ok := h.nodes[envelope.Node]
+	if !ok {
+		node = &chatNode{rooms: make(map[string]map[string]int)}
+		h.nodes[envelope.Node] = node
+	}
+	node.seen = time.Now()
+
+	switch envelope.Kind {
+	case envelopeHello:
+		h.publishPresence()
+	case envelopeMessage:
+		if message := envelope.Message; message != nil && message.MessageType == "join" {
+			users := node.rooms[message.RoomId]
+			if users == nil {
+				users = make(map[string]int)
+				node.rooms[message.RoomId] = users
+			}
+			if message.Joined {
+				users[message.User]++
+			} else if users[message.User] > 1 {
+				users[message.User]--
+			} else {
+				delete(users, message.User)
+			}
+		}
+	case envelopePresence:
+		h.reconcile(node, envelope.Rooms)
+	}
+}
+
+// replaces what is known of the users of the instance, sending the join and leave messages that were missed,
+// such as while the backplane was unreachable or once the instance stopped
+func (h *ChatHub) reconcile(node *chatNode, rooms map[string][]string) {
+	next := make(map[string]map[string]int, len(rooms))
+	for roomid, users := range rooms {
+		next[roomid] = make(map[string]int, len(users))
+		for _, user := range users {
+			next[roomid][user]++
+		}
+	}
+	changed := func(from, to map[string]map[string]int, joined bool) {
+		for roomid, users := range from {
+			for user, n := range users {
+				for i := to[roomid][user]; i < n; i++ {
+					h.broadcastMessage(ChatMessage{
+						RoomId:      roomid,
+						MessageType: "join",
+						User:        user,
+						Joined:      joined,
+						Time:        time.Now(),
+					}, 0)
+				}
 			}
 		}
 	}
+	changed(node.rooms, next, false)
+	changed(next, node.rooms, true)
+	node.rooms = next
+}
+
+// forgets the instances that were not heard from in a while, whose users are taken to have left
+func (h *ChatHub) expire() {
+	for id, node := range h.nodes {
+		if time.Since(node.seen) > presenceMisses*h.heartbeat {
+			slog.Warn("chat instance stopped responding", "node", id)
+			h.reconcile(node, nil)
+			delete(h.nodes, id)
+		}
+	}
+}
+
+// the users in the room on every instance, each once
+func (h *ChatHub) present(roomid string) []string {
+	seen := map[string]bool{}
+	for client := range h.rooms[roomid] {
+		seen[client.user] = true
+	}
+	for _, node := range h.nodes {
+		for user := range node.rooms[roomid] {
+			seen[user] = true
+		}
+	}
+	users := make([]string, 0, len(seen))
+	for user := range seen {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+	return users
 }
 
 func (h *ChatHub) Run() {
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	messages := h.backplane.Messages()
+	resubscribed := h.backplane.Resubscribed()
+	// ask the other instances who is in their rooms
+	h.publish(chatEnvelope{Kind: envelopeHello})
+
 	// infinite loop to handle register/unregister & broadcasting messages
 	for {
 		select {
@@ -113,19 +365,24 @@ func (h *ChatHub) Run() {
 				// room does not exist yet -> create a room
 				h.rooms[client.roomid] = make(map[*ChatClient]bool)
 				room = h.rooms[client.roomid]
-			} else {
-				// user has joined message
-				joinMessage := ChatMessage{
+				metrics.ChatRooms.Inc()
+			}
+			// tell the client who is already in the room, on any instance
+			if users := h.present(client.roomid); len(users) > 0 {
+				client.send <- ChatMessage{
 					RoomId:      client.roomid,
-					MessageType: "join",
-					User:        client.user,
-					Joined:      true,
+					MessageType: "presence",
+					Users:       users,
 					Time:        time.Now(),
 				}
-
-				h.broadcastMessage(joinMessage)
 			}
+			h.clients++
+			client.id = h.clients
 			room[client] = true
+			h.pumps.Add(1)
+			metrics.ChatClients.Inc()
+			// user has joined message
+			h.announce(client, true)
 		case client := <-h.unregister:
 			// client requests to leave hub
 			room, isRoomOk := h.rooms[client.roomid]
@@ -138,30 +395,69 @@ func (h *ChatHub) Run() {
 				// check if client exists in list of clients before closing connection
 				delete(room, client)
 				close(client.send)
+				metrics.ChatClients.Dec()
 
 				if len(room) == 0 {
 					// if room is now empty, remove it
 					delete(h.rooms, client.roomid)
-				} else {
-					// user has left message
-					leftMessage := ChatMessage{
-						RoomId:      client.roomid,
-						MessageType: "join",
-						User:        client.user,
-						Joined:      false,
-						Time:        time.Now(),
-					}
-
-					h.broadcastMessage(leftMessage)
+					metrics.ChatRooms.Dec()
 				}
+				// user has left message, which the other instances may still have clients for
+				h.announce(client, false)
 			}
 		case message := <-h.broadcast:
-			h.broadcastMessage(message)
+			// delivered here right away, so that the room is still reached while the backplane is unreachable
+			h.broadcastMessage(message, 0)
+			h.publish(chatEnvelope{Kind: envelopeMessage, Message: &message})
+		case data, ok := <-messages:
+			if !ok {
+				// the backplane was closed, the clients are only told of what happens here from now on
+				slog.Error("chat backplane closed while the hub is running")
+				messages = nil
+				continue
+			}
+			h.receive(data)
+		case <-resubscribed:
+			// the users that joined or left the other instances meanwhile were missed
+			h.publish(chatEnvelope{Kind: envelopeHello})
+		case <-heartbeat.C:
+			h.publishPresence()
+			h.expire()
+		case <-h.quit:
+			// tell every client that the server is going away
+			for roomid, room := range h.rooms {
+				for client := range room {
+					client.closeCode = websocket.CloseGoingAway
+					close(client.send)
+					metrics.ChatClients.Dec()
+				}
+				delete(h.rooms, roomid)
+				metrics.ChatRooms.Dec()
+			}
+			// and the other instances that its users left
+			h.publishPresence()
+			close(h.done)
+			return
 		}
 	}
 }
 
+// Stops the hub, sending a close frame to every client.
+// Waits until the close frames are sent or the context is done, whichever is first.
+// Clients connecting afterwards are closed immediately.
+func (h *ChatHub) Shutdown(ctx context.Context) error {
+	h.quitOnce.Do(func() {
+		close(h.quit)
+	})
+	err := awaitPumps(ctx, h.done, &h.pumps)
+	h.backplane.Close()
+	return err
+}
+
 type ChatClient struct {
+	// identifies the client within its hub
+	id uint64
+
 	roomid string
 
 	user string
@@ -173,17 +469,29 @@ type ChatClient struct {
 
 	// Buffered channel of outbound messages.
 	send chan ChatMessage
+
+	// the close code sent once the hub closes send, set before it is closed
+	closeCode int
+
+	// traces the connection, from the upgrade until the connection is closed
+	span trace.Span
 }
 
 // reads messages from the websocket connection
 func (c *ChatClient) readPump() {
+	received := 0
 	defer func() {
 		// handles when client closes the connection
 
-		// unregister from hub
-		c.hub.unregister <- c
+		// unregister from hub, unless it has stopped
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.done:
+		}
 		// close connection
 		c.conn.Close()
+		c.span.SetAttributes(attribute.Int("messages", received))
+		c.span.End()
 	}()
 
 	c.conn.SetReadLimit(maxMessageSize)
@@ -198,10 +506,12 @@ func (c *ChatClient) readPump() {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Print(err)
+				tracing.Fail(c.span, err)
+				slog.Warn("chat connection closed unexpectedly", "room", c.roomid, "error", err)
 			}
 			break
 		}
+		received++
 
 		chatMessage := ChatMessage{
 			RoomId:      c.roomid,
@@ -210,7 +520,11 @@ func (c *ChatClient) readPump() {
 			Message:     string(message),
 			Time:        time.Now(),
 		}
-		c.hub.broadcast <- chatMessage
+		select {
+		case c.hub.broadcast <- chatMessage:
+		case <-c.hub.done:
+			return
+		}
 	}
 }
 
@@ -223,6 +537,7 @@ func (c *ChatClient) writePump() {
 
 		// stops the ticker
 		ticker.Stop()
+		c.hub.pumps.Done()
 		// closes connection
 		c.conn.Close()
 	}()
@@ -233,7 +548,12 @@ func (c *ChatClient) writePump() {
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !isChannelOk {
 				// hub closed the channel
-				c.conn.WriteMessage(websocket.CloseMessage, []byte("Connection closed."))
+				c.span.AddEvent("closed by server", trace.WithAttributes(attribute.Int("code", c.closeCode)))
+				if c.closeCode == websocket.CloseGoingAway {
+					c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "Server shutting down."))
+				} else {
+					c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Connection closed."))
+				}
 				return
 			}
 
@@ -266,9 +586,13 @@ func (c *ChatClient) writePump() {
 
 // entrypoint for ProjectChat handler
 func ConnectClient(ctx *gin.Context, hub *ChatHub, roomid, name string) {
+	// outlives the request, which ends once the pumps are started
+	_, span := tracing.Start(ctx, "chat.connection", attribute.String("room", roomid))
 	conn, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
 	if err != nil {
-		log.Print("Error when upgrading websocket connection (for chat): ", err)
+		tracing.Fail(span, err)
+		span.End()
+		slog.WarnContext(ctx, "error when upgrading websocket connection for chat", "error", err)
 		return
 	}
 
@@ -278,10 +602,20 @@ func ConnectClient(ctx *gin.Context, hub *ChatHub, roomid, name string) {
 		hub:    hub,
 		conn:   conn,
 		send:   make(chan ChatMessage, 256),
+		span:   span,
 	}
 
 	// register new client
-	client.hub.register <- client
+	select {
+	case client.hub.register <- client:
+	case <-client.hub.done:
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "Server shutting down."), time.Now().Add(writeWait))
+		conn.Close()
+		span.AddEvent("rejected as the server is shutting down")
+		span.End()
+		return
+	}
+	span.AddEvent("registered")
 
 	// run in goroutines for concurrency
 	go client.writePump()
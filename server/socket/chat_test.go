@@ -0,0 +1,72 @@
+package socket
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+func TestChatHubShutdown(t *testing.T) {
+	hub := NewChatHub()
+	go hub.Run()
+	router := gin.New()
+	router.GET("/chat", func(ctx *gin.Context) {
+		ConnectClient(ctx, hub, "room", ctx.Query("name"))
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/chat?name="
+
+	conns := []*websocket.Conn{}
+	for _, name := range []string{"alice", "bob"} {
+		conn, _, err := websocket.DefaultDialer.Dial(url+name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns = append(conns, conn)
+	}
+	// alice is told that bob joined, so both are registered
+	var joined struct {
+		Messages []ChatMessage `json:"messages"`
+	}
+	if err := conns[0].ReadJSON(&joined); err != nil || len(joined.Messages) != 1 || joined.Messages[0].User != "bob" {
+		t.Fatalf("Expected bob to join, got %+v (%v)", joined, err)
+	}
+	// and bob that alice is in the room
+	var presence struct {
+		Messages []ChatMessage `json:"messages"`
+	}
+	if err := conns[1].ReadJSON(&presence); err != nil || len(presence.Messages) != 1 || presence.Messages[0].MessageType != "presence" {
+		t.Fatalf("Expected bob to be told of alice, got %+v (%v)", presence, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := hub.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, conn := range conns {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, _, err := conn.ReadMessage()
+		if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+			t.Errorf("Expected a going away close frame, got %v", err)
+		}
+	}
+
+	// clients connecting after the shutdown are closed straight away
+	conn, _, err := websocket.DefaultDialer.Dial(url+"carol", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("Expected a going away close frame, got %v", err)
+	}
+}
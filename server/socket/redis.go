@@ -0,0 +1,226 @@
+package socket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// time allowed to connect to Redis, and for Redis to answer a command
+	redisTimeout = 5 * time.Second
+
+	// messages waiting to be published, beyond which Publish fails
+	redisQueueSize = 1024
+
+	// longest wait between attempts to reconnect
+	redisMaxBackoff = 30 * time.Second
+)
+
+// Carries the messages through a Redis channel, to the hubs of every instance using the same channel.
+// The subscription is renewed by go-redis when its connection is lost, the messages published meanwhile are dropped.
+type RedisBackplane struct {
+	client  *redis.Client
+	pubsub  *redis.PubSub
+	channel string
+
+	// messages waiting to be published
+	outbound chan []byte
+	messages chan []byte
+
+	// signalled once the subscription is renewed
+	resubscribed chan struct{}
+
+	quit      chan struct{}
+	closeOnce sync.Once
+	loops     sync.WaitGroup
+}
+
+// Connects to the Redis at the redis:// or rediss:// (TLS) URL, returning an error if it is unreachable or refuses
+// the credentials of the URL. skipVerify accepts any certificate from a rediss:// URL, for providers using
+// self-signed ones.
+func NewRedisBackplane(rawURL, channel string, skipVerify bool) (*RedisBackplane, error) {
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url, expected redis://[user:password@]host[:port]: %w", err)
+	}
+	if channel == "" {
+		return nil, fmt.Errorf("redis channel cannot be empty")
+	}
+	opts.DialTimeout = redisTimeout
+	opts.ReadTimeout = redisTimeout
+	opts.WriteTimeout = redisTimeout
+	// a message is dropped rather than retried, as it may have been published before failing
+	opts.MaxRetries = -1
+	opts.DisableIndentity = true
+	if opts.TLSConfig != nil && skipVerify {
+		opts.TLSConfig.InsecureSkipVerify = true
+	}
+
+	b := &RedisBackplane{
+		client:       redis.NewClient(opts),
+		channel:      channel,
+		outbound:     make(chan []byte, redisQueueSize),
+		messages:     make(chan []byte),
+		resubscribed: make(chan struct{}, 1),
+		quit:         make(chan struct{}),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	// the error of connecting is returned with the confirmation of the subscription
+	b.pubsub = b.client.Subscribe(ctx, channel)
+	if _, err := b.pubsub.ReceiveTimeout(ctx, redisTimeout); err != nil {
+		b.pubsub.Close()
+		b.client.Close()
+		return nil, fmt.Errorf("error subscribing to redis: %w", err)
+	}
+	b.loops.Add(2)
+	go b.publishLoop()
+	go b.receiveLoop()
+	return b, nil
+}
+
+func (b *RedisBackplane) Publish(message []byte) error {
+	select {
+	case <-b.quit:
+		return errBackplaneClosed
+	default:
+	}
+	select {
+	case b.outbound <- message:
+		return nil
+	default:
+		return errors.New("too many messages waiting to be published to redis")
+	}
+}
+
+func (b *RedisBackplane) Messages() <-chan []byte {
+	return b.messages
+}
+
+func (b *RedisBackplane) Resubscribed() <-chan struct{} {
+	return b.resubscribed
+}
+
+func (b *RedisBackplane) Close() error {
+	b.closeOnce.Do(func() {
+		close(b.quit)
+		// unblocks the receiveLoop
+		b.pubsub.Close()
+	})
+	b.loops.Wait()
+	return b.client.Close()
+}
+
+// receives the messages of the channel, waiting longer between attempts to resubscribe while Redis is unreachable
+func (b *RedisBackplane) receiveLoop() {
+	defer b.loops.Done()
+	defer close(b.messages)
+	backoff := time.Duration(0)
+	for {
+		reply, err := b.pubsub.Receive(context.Background())
+		select {
+		case <-b.quit:
+			return
+		default:
+		}
+		if err != nil {
+			slog.Warn("lost the subscription to the chat backplane", "error", err)
+			backoff = nextBackoff(backoff)
+			select {
+			case <-time.After(backoff):
+			case <-b.quit:
+				return
+			}
+			continue
+		}
+		backoff = 0
+
+		switch reply := reply.(type) {
+		case *redis.Subscription:
+			// the confirmation of the first subscription was received when connecting
+			slog.Info("resubscribed to the chat backplane")
+			select {
+			case b.resubscribed <- struct{}{}:
+			default:
+			}
+		case *redis.Message:
+			select {
+			case b.messages <- []byte(reply.Payload):
+			case <-b.quit:
+				return
+			}
+		}
+	}
+}
+
+// publishes the queued messages in order, and those still queued once closed
+func (b *RedisBackplane) publishLoop() {
+	defer b.loops.Done()
+	p := &redisPublisher{backplane: b}
+	for {
+		select {
+		case message := <-b.outbound:
+			p.publish(message)
+		case <-b.quit:
+			for {
+				select {
+				case message := <-b.outbound:
+					if p.publish(message) != nil {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// publishes the messages, without waiting on Redis for each of them while it is unreachable
+type redisPublisher struct {
+	backplane *RedisBackplane
+
+	// when to next try publishing after failing to
+	backoff time.Duration
+	retry   time.Time
+}
+
+func (p *redisPublisher) publish(message []byte) error {
+	err := p.send(message)
+	if err != nil {
+		slog.Warn("dropped a message for the chat backplane", "error", err)
+	}
+	return err
+}
+
+func (p *redisPublisher) send(message []byte) error {
+	if time.Now().Before(p.retry) {
+		return errors.New("redis is unreachable")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := p.backplane.client.Publish(ctx, p.backplane.channel, message).Err(); err != nil {
+		p.backoff = nextBackoff(p.backoff)
+		p.retry = time.Now().Add(p.backoff)
+		return err
+	}
+	p.backoff = 0
+	return nil
+}
+
+// doubles the wait between attempts to reconnect, up to redisMaxBackoff
+func nextBackoff(backoff time.Duration) time.Duration {
+	if backoff == 0 {
+		return 100 * time.Millisecond
+	}
+	if backoff *= 2; backoff > redisMaxBackoff {
+		return redisMaxBackoff
+	}
+	return backoff
+}
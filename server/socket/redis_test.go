@@ -0,0 +1,226 @@
+package socket
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A Redis server knowing AUTH, SUBSCRIBE and PUBLISH, to test the backplane without one.
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mu          sync.Mutex
+	conns       map[net.Conn]bool
+	subscribers map[string][]net.Conn
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRedis{
+		listener:    listener,
+		password:    password,
+		conns:       make(map[net.Conn]bool),
+		subscribers: make(map[string][]net.Conn),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			r.mu.Lock()
+			r.conns[conn] = true
+			r.mu.Unlock()
+			go r.serve(conn)
+		}
+	}()
+	t.Cleanup(func() {
+		listener.Close()
+		r.drop()
+	})
+	return r
+}
+
+func (r *fakeRedis) url() string {
+	return fmt.Sprintf("redis://:%v@%v", r.password, r.listener.Addr())
+}
+
+// closes every connection, as a restart of Redis would
+func (r *fakeRedis) drop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for c := range r.conns {
+		c.Close()
+	}
+	r.conns = make(map[net.Conn]bool)
+	r.subscribers = make(map[string][]net.Conn)
+}
+
+// reads a command, sent as an array of bulk strings
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	readLine := func(prefix byte) (int, error) {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return 0, err
+		}
+		if line[0] != prefix {
+			return 0, fmt.Errorf("unexpected line %q", line)
+		}
+		return strconv.Atoi(strings.TrimSpace(line[1:]))
+	}
+	n, err := readLine('*')
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		size, err := readLine('$')
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		args[i] = string(data[:size])
+	}
+	return args, nil
+}
+
+func (r *fakeRedis) serve(c net.Conn) {
+	reader := bufio.NewReader(c)
+	authenticated := r.password == ""
+	for {
+		args, err := readCommand(reader)
+		if err != nil || len(args) == 0 {
+			return
+		}
+		// commands are case insensitive
+		args[0] = strings.ToUpper(args[0])
+		r.mu.Lock()
+		switch {
+		case args[0] == "AUTH":
+			if authenticated = args[len(args)-1] == r.password; authenticated {
+				c.Write([]byte("+OK\r\n"))
+			} else {
+				c.Write([]byte("-WRONGPASS invalid password\r\n"))
+			}
+		case !authenticated:
+			c.Write([]byte("-NOAUTH Authentication required.\r\n"))
+		case args[0] == "SUBSCRIBE":
+			r.subscribers[args[1]] = append(r.subscribers[args[1]], c)
+			fmt.Fprintf(c, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(args[1]), args[1])
+		case args[0] == "PUBLISH":
+			for _, subscriber := range r.subscribers[args[1]] {
+				fmt.Fprintf(subscriber, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(args[1]), args[1], len(args[2]), args[2])
+			}
+			fmt.Fprintf(c, ":%d\r\n", len(r.subscribers[args[1]]))
+		default:
+			c.Write([]byte("-ERR unknown command\r\n"))
+		}
+		r.mu.Unlock()
+	}
+}
+
+// reads the next message of the backplane
+func nextMessage(t *testing.T, backplane Backplane) string {
+	t.Helper()
+	select {
+	case message := <-backplane.Messages():
+		return string(message)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a message from the backplane")
+		return ""
+	}
+}
+
+func testRedisBackplanes(t *testing.T, url string) (*RedisBackplane, *RedisBackplane) {
+	t.Helper()
+	channel := fmt.Sprintf("organius:test:%d", time.Now().UnixNano())
+	a, err := NewRedisBackplane(url, channel, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	b, err := NewRedisBackplane(url, channel, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	// both receive what either publishes, in order
+	for _, message := range []string{"first", "second\r\nwith a line break"} {
+		a.Publish([]byte(message))
+	}
+	for _, backplane := range []Backplane{a, b} {
+		for _, expected := range []string{"first", "second\r\nwith a line break"} {
+			if message := nextMessage(t, backplane); message != expected {
+				t.Errorf("Expected %q, got %q", expected, message)
+			}
+		}
+	}
+	return a, b
+}
+
+func TestRedisBackplane(t *testing.T) {
+	redis := newFakeRedis(t, "secret")
+	if _, err := NewRedisBackplane("redis://:wrong@"+redis.listener.Addr().String(), "chat", false); err == nil {
+		t.Errorf("Expected the wrong password to be refused")
+	}
+	if _, err := NewRedisBackplane("http://"+redis.listener.Addr().String(), "chat", false); err == nil {
+		t.Errorf("Expected urls other than redis:// to be refused")
+	}
+
+	a, b := testRedisBackplanes(t, redis.url())
+
+	// both connections are reopened once lost, the messages published meanwhile may be lost
+	redis.drop()
+	deadline := time.Now().Add(5 * time.Second)
+	received := false
+	for !received && time.Now().Before(deadline) {
+		b.Publish([]byte("reconnected"))
+		select {
+		case message := <-a.Messages():
+			received = string(message) == "reconnected"
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	if !received {
+		t.Fatal("Expected the backplane to reconnect")
+	}
+	select {
+	case <-a.Resubscribed():
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected the backplane to signal that it resubscribed")
+	}
+
+	// closing sends what was published and closes the messages
+	a.Close()
+	if err := a.Publish([]byte("closed")); err == nil {
+		t.Errorf("Expected publishing after closing to fail")
+	}
+	for range a.Messages() {
+	}
+}
+
+// Runs against a real Redis if REDIS_TEST_URL is set, such as redis://localhost:6379.
+func TestRedisBackplaneLive(t *testing.T) {
+	url := os.Getenv("REDIS_TEST_URL")
+	if url == "" {
+		t.Skip("REDIS_TEST_URL is not set")
+	}
+	testRedisBackplanes(t, url)
+}
@@ -1,8 +1,11 @@
 package socket
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"sync"
 
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
@@ -17,21 +20,27 @@ func CreateWebSocketFunction(transform func(ctx *gin.Context, message []byte) (i
 	return func(ctx *gin.Context) {
 		c, err := upgrader.Upgrade(ctx.Writer, ctx.Request, nil)
 		if err != nil {
-			log.Print("Error when upgrading websocket connection: ", err)
+			slog.WarnContext(ctx, "error when upgrading websocket connection", "error", err)
 			// need this early return because if upgrade fails, it will attempt to close a nil connection
 			return
 		}
 		defer c.Close()
 
+		// each message gets its own span, as the connection can stay open for long
+		requestCtx := ctx.Request.Context()
 		// start infinite loop
 		for {
 			_, message, err := c.ReadMessage()
 			if err != nil {
-				log.Print("Error when reading from websocket connection: ", err)
+				slog.DebugContext(ctx, "error when reading from websocket connection", "error", err)
 				break
 			}
 
+			messageCtx, span := tracing.Start(requestCtx, "websocket.message")
+			// transform finds the span in the request, as *gin.Context cannot hold it
+			ctx.Request = ctx.Request.WithContext(messageCtx)
 			returnMessage, shouldClose := transform(ctx, message)
+			span.End()
 
 			if shouldClose {
 				break
@@ -39,9 +48,30 @@ func CreateWebSocketFunction(transform func(ctx *gin.Context, message []byte) (i
 
 			err = c.WriteJSON(returnMessage)
 			if err != nil {
-				log.Print("Error when writing to websocket connection: ", err)
+				slog.WarnContext(ctx, "error when writing to websocket connection", "error", err)
 				break
 			}
 		}
 	}
 }
+
+// Waits until the hub has stopped and the writePumps of its clients have sent their close frames, or the context is done.
+func awaitPumps(ctx context.Context, done <-chan struct{}, pumps *sync.WaitGroup) error {
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	sent := make(chan struct{})
+	go func() {
+		pumps.Wait()
+		close(sent)
+	}()
+	select {
+	case <-sent:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,53 @@
+// Blob storage for file attachments.
+package storage
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/errs"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+)
+
+var (
+	ErrNotFound   = errs.NotFound("file does not exist")
+	ErrInvalidKey = errs.Validation("invalid file key")
+)
+
+type Store interface {
+	// Stores the contents of r under key, replacing any existing file.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+
+	// Returns the contents stored under key. The caller must close it.
+	// Returns ErrNotFound if there is nothing stored under key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+
+	// Deletes the file stored under key. Deleting a missing file is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Deletes the files of attachments that were deleted.
+// Failures are logged, as the attachments no longer refer to the files and cannot be deleted again.
+func DeleteFiles(ctx context.Context, store Store, attachments []models.Attachment) {
+	for _, attachment := range attachments {
+		if err := store.Delete(ctx, attachment.Key); err != nil {
+			slog.ErrorContext(ctx, "failed to delete file", "key", attachment.Key, "error", err)
+		}
+	}
+}
+
+// Keys are slash separated paths such as "task/<taskid>/<attachmentid>".
+// They cannot be empty, absolute, or contain "." or ".." segments.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
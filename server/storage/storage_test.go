@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A minimal in-memory stand-in for an S3-compatible server.
+// Requests are rejected unless their signature matches what the server computes from the received request.
+func newFakeS3(t *testing.T, accessKey, secretKey string) *httptest.Server {
+	var mutex sync.Mutex
+	objects := map[string][]byte{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		amzDate, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		expected := r.Clone(r.Context())
+		expected.Header = r.Header.Clone()
+		// requests received by a server only have the host in r.Host
+		expected.URL.Host = r.Host
+		sign(expected, r.Header.Get("X-Amz-Content-Sha256"), "us-east-1", accessKey, secretKey, amzDate)
+		if expected.Header.Get("Authorization") != r.Header.Get("Authorization") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = body
+			w.WriteHeader(http.StatusOK)
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(body)
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+}
+
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	key := "task/62a0b1c2d3e4f5a6b7c8d9e0/62a0b1c2d3e4f5a6b7c8d9e1"
+	content := []byte("lab report contents")
+
+	if err := store.Put(ctx, key, bytes.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+		t.Fatalf("Expected no error on put but got %v", err)
+	}
+
+	reader, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Expected no error on get but got %v", err)
+	}
+	actual, _ := io.ReadAll(reader)
+	reader.Close()
+	if !bytes.Equal(actual, content) {
+		t.Errorf("Expected %q but got %q", content, actual)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Expected no error on delete but got %v", err)
+	}
+	if _, err := store.Get(ctx, key); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound after delete but got %v", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("Expected deleting a missing file to succeed but got %v", err)
+	}
+
+	for _, badKey := range []string{"", "/abs", "../escape", "a/../../b", "a//b", "a\\b"} {
+		if err := store.Put(ctx, badKey, strings.NewReader("x"), 1, ""); err != ErrInvalidKey {
+			t.Errorf("Expected ErrInvalidKey for %q but got %v", badKey, err)
+		}
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+}
+
+func TestS3Store(t *testing.T) {
+	server := newFakeS3(t, "access", "secret")
+	defer server.Close()
+
+	store, err := NewS3(server.URL, "organius", "", "access", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, store)
+
+	// wrong credentials are rejected by the server
+	wrong, _ := NewS3(server.URL, "organius", "", "access", "wrong")
+	if err := wrong.Put(context.Background(), "a/b", strings.NewReader("x"), 1, ""); err == nil {
+		t.Error("Expected error when signing with wrong secret")
+	}
+}
@@ -0,0 +1,17 @@
+// Databases kept in memory for tests, so that controllers and handlers can be tested without MongoDB.
+package testdb
+
+import (
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/memdb"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// An empty database, which is lost when the test ends.
+// Collection options are ignored.
+func New() controllers.Database {
+	database := memdb.New()
+	return func(name string, opts ...*options.CollectionOptions) controllers.MongoCollection {
+		return database.Collection(name)
+	}
+}
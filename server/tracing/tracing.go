@@ -0,0 +1,128 @@
+// Tracing with OpenTelemetry, with the spans sent to a collector over OTLP or written to stdout.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/config"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const ServiceName = "organius"
+
+// Names the tracer of the whole server.
+const instrumentation = "github.com/OrgaNiUS/OrgaNiUS/server"
+
+// Returns the tracer of the current provider, which records nothing until Setup is called.
+// Not kept in a variable, as a tracer keeps using the provider that was set first.
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Records the spans of the server with the exporter in the config, returning a function that sends the spans left and stops recording.
+// Nothing is recorded if the exporter is "none".
+// The server continues the traces of callers that send a W3C traceparent header.
+func Setup(ctx context.Context, cfg config.Tracing) (func(ctx context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case config.TracingNone:
+		return func(ctx context.Context) error { return nil }, nil
+	case config.TracingStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case config.TracingOTLP:
+		options := []otlptracehttp.Option{}
+		if cfg.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+	default:
+		err = fmt.Errorf("unknown exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// the traces of callers are recorded if they are, so that they are not left with holes
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Returns the context holding the span of the request.
+// *gin.Context only looks up values by string keys, so the span is kept in the context of its *http.Request instead.
+func Context(ctx context.Context) context.Context {
+	if ginCtx, ok := ctx.(*gin.Context); ok && ginCtx.Request != nil {
+		return ginCtx.Request.Context()
+	}
+	return ctx
+}
+
+// Starts a span as a child of the one in ctx, which may be a *gin.Context.
+// The returned context holds the new span and is to be passed on in its place; the span must be ended by the caller.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(Context(ctx), name, trace.WithAttributes(attributes...))
+}
+
+// Records the error on the span and marks it as failed, if the error is not nil.
+func Fail(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Starts a span for each request, named by the route it matched, such as "POST /api/v1/task_create".
+// The span is put in the context of the request, where Start finds it.
+func Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		request := ctx.Request
+		parent := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+
+		route := ctx.FullPath()
+		name := request.Method
+		attributes := []attribute.KeyValue{
+			semconv.HTTPRequestMethodKey.String(request.Method),
+			semconv.URLPath(request.URL.Path),
+		}
+		if route != "" {
+			name += " " + route
+			attributes = append(attributes, semconv.HTTPRoute(route))
+		}
+		spanCtx, span := tracer().Start(parent, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attributes...))
+		defer span.End()
+		ctx.Request = request.WithContext(spanCtx)
+
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
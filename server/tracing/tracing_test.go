@@ -0,0 +1,100 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/config"
+	"github.com/OrgaNiUS/OrgaNiUS/server/tracing"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// Records the spans of the test in memory.
+func record(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		provider.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+func TestMiddleware(t *testing.T) {
+	recorder := record(t)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(tracing.Middleware())
+	router.GET("/api/v1/task_get", func(ctx *gin.Context) {
+		// as the controllers are passed the *gin.Context
+		_, span := tracing.Start(ctx, "TaskController.TaskRetrieve")
+		span.End()
+		ctx.Status(http.StatusInternalServerError)
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/task_get?id=1", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), request)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %v", len(spans))
+	}
+	controller, handler := spans[0], spans[1]
+	if handler.Name() != "GET /api/v1/task_get" {
+		t.Errorf("Expected the span to be named by the route, got %v", handler.Name())
+	}
+	if handler.Parent().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || !handler.Parent().IsRemote() {
+		t.Errorf("Expected the trace of the caller to be continued, got parent %v", handler.Parent())
+	}
+	if controller.Parent().SpanID() != handler.SpanContext().SpanID() {
+		t.Errorf("Expected the span of the controller to be a child of that of the request")
+	}
+	if handler.Status().Code != codes.Error {
+		t.Errorf("Expected a server error to fail the span, got %v", handler.Status())
+	}
+}
+
+func TestFail(t *testing.T) {
+	recorder := record(t)
+
+	_, span := tracing.Start(context.Background(), "ok")
+	tracing.Fail(span, nil)
+	span.End()
+	_, span = tracing.Start(context.Background(), "failed")
+	tracing.Fail(span, errors.New("no such document"))
+	span.End()
+
+	spans := recorder.Ended()
+	if spans[0].Status().Code != codes.Unset {
+		t.Errorf("Expected no error to leave the status unset, got %v", spans[0].Status())
+	}
+	if spans[1].Status().Code != codes.Error || len(spans[1].Events()) != 1 {
+		t.Errorf("Expected the error to be recorded, got %v with %v events", spans[1].Status(), len(spans[1].Events()))
+	}
+}
+
+func TestSetup(t *testing.T) {
+	for _, exporter := range []string{config.TracingNone, config.TracingStdout, config.TracingOTLP} {
+		shutdown, err := tracing.Setup(context.Background(), config.Tracing{Exporter: exporter, SampleRatio: 1})
+		if err != nil {
+			t.Fatalf("Expected %v to be set up, got %v", exporter, err)
+		}
+		// nothing was recorded, so nothing is sent
+		if err := shutdown(context.Background()); err != nil {
+			t.Errorf("Expected %v to shut down, got %v", exporter, err)
+		}
+	}
+	if _, err := tracing.Setup(context.Background(), config.Tracing{Exporter: "jaeger"}); err == nil {
+		t.Error("Expected an unknown exporter to fail")
+	}
+}
@@ -0,0 +1,93 @@
+// Permanently deletes tasks, projects and events that have been in the trash for too long.
+package trash
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/OrgaNiUS/OrgaNiUS/server/controllers"
+	"github.com/OrgaNiUS/OrgaNiUS/server/models"
+	"github.com/OrgaNiUS/OrgaNiUS/server/storage"
+)
+
+const (
+	// how often to look for items to purge
+	checkInterval = time.Hour
+)
+
+// Permanently deletes the items moved to the trash before the time, together with everything that belongs to them.
+// Failures to delete the data belonging to an item are logged, as the item itself can no longer be restored.
+func Purge(ctx context.Context, projectController controllers.ProjectController, taskController controllers.TaskController, eventController controllers.EventController, commentController controllers.CommentController, attachmentController controllers.AttachmentController, store storage.Store, timeEntryController controllers.TimeEntryController, templateController controllers.TemplateController, before time.Time) error {
+	// tasks deleted together with their project have the same deletion time, so they are purged in the same run
+	tasks, err := taskController.TaskFindPurgeable(ctx, before)
+	if err != nil {
+		return err
+	}
+	taskids := make([]string, len(tasks))
+	for i, task := range tasks {
+		taskids[i] = task.Id.Hex()
+	}
+	if len(taskids) > 0 {
+		if err := taskController.TaskDeleteMany(ctx, taskids); err != nil {
+			return err
+		}
+		if err := commentController.CommentDeleteByTasks(ctx, taskids); err != nil {
+			slog.ErrorContext(ctx, "failed to delete comments of purged tasks", "error", err)
+		}
+		if err := taskController.TaskActivityDelete(ctx, taskids); err != nil {
+			slog.ErrorContext(ctx, "failed to delete activity of purged tasks", "error", err)
+		}
+		deleteAttachments(ctx, attachmentController, store, models.AttachmentOwnerTask, taskids)
+		if err := timeEntryController.TimeEntryDeleteByTasks(ctx, taskids); err != nil {
+			slog.ErrorContext(ctx, "failed to delete time entries of purged tasks", "error", err)
+		}
+	}
+
+	projects, err := projectController.ProjectFindPurgeable(ctx, before)
+	if err != nil {
+		return err
+	}
+	for _, project := range projects {
+		projectid := project.Id.Hex()
+		if err := projectController.ProjectDelete(ctx, projectid); err != nil {
+			return err
+		}
+		deleteAttachments(ctx, attachmentController, store, models.AttachmentOwnerProject, []string{projectid})
+		if err := templateController.TaskTemplateDeleteByProject(ctx, projectid); err != nil {
+			slog.ErrorContext(ctx, "failed to delete task templates of purged project", "error", err)
+		}
+	}
+
+	_, err = eventController.EventPurge(ctx, before)
+	return err
+}
+
+// Deletes the attachments of purged tasks or projects, along with their files.
+func deleteAttachments(ctx context.Context, attachmentController controllers.AttachmentController, store storage.Store, ownerType string, ownerids []string) {
+	attachments, err := attachmentController.AttachmentDeleteByOwners(ctx, ownerType, ownerids)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to delete attachments of purged item", "ownerType", ownerType, "error", err)
+	}
+	storage.DeleteFiles(ctx, store, attachments)
+}
+
+// Periodically purges items that have been in the trash for longer than the retention period.
+// Blocks until ctx is cancelled.
+func Run(ctx context.Context, projectController controllers.ProjectController, taskController controllers.TaskController, eventController controllers.EventController, commentController controllers.CommentController, attachmentController controllers.AttachmentController, store storage.Store, timeEntryController controllers.TimeEntryController, templateController controllers.TemplateController, retention time.Duration) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		before := time.Now().Add(-retention)
+		if err := Purge(ctx, projectController, taskController, eventController, commentController, attachmentController, store, timeEntryController, templateController, before); err != nil {
+			slog.ErrorContext(ctx, "failed to purge the trash", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
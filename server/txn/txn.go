@@ -0,0 +1,123 @@
+// Runs updates spanning multiple documents as a unit, so that a failure midway does not leave dangling references.
+package txn
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Returned by Run when the updates failed.
+// The updates made before the failure are undone, unless Rollback is set.
+type Error struct {
+	Err      error // the update that failed
+	Rollback error // failure to undo the earlier updates, nil if they were undone
+}
+
+func (e *Error) Error() string {
+	if e.Rollback != nil {
+		return fmt.Sprintf("%v (could not undo earlier changes: %v)", e.Err, e.Rollback)
+	}
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Tells the client that the earlier updates were left in place, without the cause which is logged.
+func (e *Error) Note() string {
+	if e.Rollback != nil {
+		return "could not undo earlier changes"
+	}
+	return ""
+}
+
+// The updates made within Run, together with the actions that undo them.
+type Saga struct {
+	// in a transaction, aborting it undoes everything
+	inTransaction bool
+	undo          []func(ctx context.Context) error
+}
+
+// Makes an update, returning its error.
+// undo is called if a later update fails, in the reverse order of the updates, when they are not in a transaction.
+func (s *Saga) Do(ctx context.Context, do, undo func(ctx context.Context) error) error {
+	if err := do(ctx); err != nil {
+		return err
+	}
+	if !s.inTransaction && undo != nil {
+		s.undo = append(s.undo, undo)
+	}
+	return nil
+}
+
+// Undoes the updates made so far, from the latest.
+// Every update is attempted even if some fail, and the first failure is returned.
+func (s *Saga) compensate(ctx context.Context) error {
+	var first error
+	for i := len(s.undo) - 1; i >= 0; i-- {
+		if err := s.undo[i](ctx); err != nil && first == nil {
+			first = err
+		}
+	}
+	s.undo = nil
+	return first
+}
+
+type Runner struct {
+	client       *mongo.Client
+	transactions bool
+}
+
+// Uses transactions if the deployment supports them (replica sets and sharded clusters, such as Atlas).
+// Standalone servers fall back to sagas, where the updates made are undone one by one.
+func New(ctx context.Context, client *mongo.Client) *Runner {
+	var hello bson.M
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		slog.WarnContext(ctx, "could not check for transaction support, using sagas", "error", err)
+		return &Runner{}
+	}
+	_, isReplicaSet := hello["setName"]
+	isSharded := hello["msg"] == "isdbgrid"
+	return &Runner{client: client, transactions: isReplicaSet || isSharded}
+}
+
+// Always uses sagas, such as for tests.
+func NewSagaRunner() *Runner {
+	return &Runner{}
+}
+
+// Whether updates are made in transactions.
+func (r *Runner) Transactional() bool {
+	return r.transactions
+}
+
+// Runs fn, making its updates through saga with the ctx passed to fn.
+// If fn returns an error, the updates are undone and an *Error is returned.
+// In a transaction, fn may be called again if the transaction has to be retried.
+func (r *Runner) Run(ctx context.Context, fn func(ctx context.Context, saga *Saga) error) error {
+	if r.transactions {
+		session, err := r.client.StartSession()
+		if err != nil {
+			return &Error{Err: err}
+		}
+		defer session.EndSession(ctx)
+		_, err = session.WithTransaction(ctx, func(sessionCtx mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sessionCtx, &Saga{inTransaction: true})
+		})
+		if err != nil {
+			return &Error{Err: err}
+		}
+		return nil
+	}
+
+	saga := &Saga{}
+	if err := fn(ctx, saga); err != nil {
+		return &Error{Err: err, Rollback: saga.compensate(ctx)}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package txn
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Records the updates made and undone, failing the update at index failAt.
+type steps struct {
+	failAt     int
+	failUndoAt int
+	done       []int
+	undone     []int
+}
+
+func (s *steps) run(ctx context.Context, saga *Saga, n int) error {
+	for i := 0; i < n; i++ {
+		i := i
+		err := saga.Do(ctx, func(ctx context.Context) error {
+			if i == s.failAt {
+				return errors.New("update failed")
+			}
+			s.done = append(s.done, i)
+			return nil
+		}, func(ctx context.Context) error {
+			s.undone = append(s.undone, i)
+			if i == s.failUndoAt {
+				return errors.New("undo failed")
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestRunSuccess(t *testing.T) {
+	s := &steps{failAt: -1, failUndoAt: -1}
+	err := NewSagaRunner().Run(context.Background(), func(ctx context.Context, saga *Saga) error {
+		return s.run(ctx, saga, 3)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(s.done, []int{0, 1, 2}) || len(s.undone) != 0 {
+		t.Errorf("done %v, undone %v", s.done, s.undone)
+	}
+}
+
+func TestRunCompensatesInReverse(t *testing.T) {
+	s := &steps{failAt: 3, failUndoAt: -1}
+	err := NewSagaRunner().Run(context.Background(), func(ctx context.Context, saga *Saga) error {
+		return s.run(ctx, saga, 5)
+	})
+	var txnErr *Error
+	if !errors.As(err, &txnErr) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	if txnErr.Err.Error() != "update failed" || txnErr.Rollback != nil {
+		t.Errorf("unexpected error: %v", txnErr)
+	}
+	if !reflect.DeepEqual(s.undone, []int{2, 1, 0}) {
+		t.Errorf("expected updates to be undone in reverse, got %v", s.undone)
+	}
+}
+
+func TestRunReportsRollbackFailure(t *testing.T) {
+	s := &steps{failAt: 3, failUndoAt: 1}
+	err := NewSagaRunner().Run(context.Background(), func(ctx context.Context, saga *Saga) error {
+		return s.run(ctx, saga, 5)
+	})
+	var txnErr *Error
+	if !errors.As(err, &txnErr) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	if txnErr.Rollback == nil || txnErr.Rollback.Error() != "undo failed" {
+		t.Errorf("expected rollback failure, got %v", txnErr.Rollback)
+	}
+	// the remaining updates are still undone
+	if !reflect.DeepEqual(s.undone, []int{2, 1, 0}) {
+		t.Errorf("expected every update to be undone, got %v", s.undone)
+	}
+	if err.Error() != "update failed (could not undo earlier changes: undo failed)" {
+		t.Errorf("unexpected message: %v", err)
+	}
+}
+
+func TestSagaInTransactionDoesNotUndo(t *testing.T) {
+	s := &steps{failAt: -1, failUndoAt: -1}
+	saga := &Saga{inTransaction: true}
+	if err := s.run(context.Background(), saga, 3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := saga.compensate(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(s.undone) != 0 {
+		t.Errorf("aborting the transaction undoes the updates, got %v", s.undone)
+	}
+}